@@ -0,0 +1,192 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_IncDecMemoryOperands(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		initialValue  uint16
+		carry         bool
+		expectedValue uint16
+		expectedZero  bool
+	}{
+		// inc byte [0x0800]
+		{"TestIncByteMemory", []uint8{0xfe, 0x06, 0x00, 0x08}, 0x0041, true, 0x0042, false},
+		{"TestIncByteMemoryWrap", []uint8{0xfe, 0x06, 0x00, 0x08}, 0x00ff, true, 0x0000, true},
+		// dec byte [0x0800]
+		{"TestDecByteMemory", []uint8{0xfe, 0x0e, 0x00, 0x08}, 0x0041, false, 0x0040, false},
+		// inc word [0x0800]
+		{"TestIncWordMemory", []uint8{0xff, 0x06, 0x00, 0x08}, 0x00ff, true, 0x0100, false},
+		// dec word [0x0800]
+		{"TestDecWordMemory", []uint8{0xff, 0x0e, 0x00, 0x08}, 0x0001, false, 0x0000, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x0800, tt.initialValue)
+			cpu.SetFlag(intel8086.CarryFlag, tt.carry)
+
+			cpu.Step()
+
+			value, _ := mem.ReadAddr16(0x0800)
+			if tt.instruction[0] == 0xfe {
+				// byte operand must not touch the following byte
+				value &= 0x00ff
+				if high, _ := mem.ReadAddr8(0x0801); high != uint8(tt.initialValue>>8) {
+					t.Errorf("Expected byte after operand [%#02x] but got [%#02x]", uint8(tt.initialValue>>8), high)
+				}
+			}
+			if value != tt.expectedValue {
+				t.Errorf("Expected memory value [%#04x] but got [%#04x]", tt.expectedValue, value)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.carry {
+				t.Errorf("Expected carry flag to be preserved as %v", tt.carry)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZero {
+				t.Errorf("Expected zero flag %v but got %v", tt.expectedZero, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetIP() != 0x104 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x104, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_IncDecRegisterOperands(t *testing.T) {
+
+	// mov ax, 0x7fff; inc ax; dec cx; inc bl (fe c3)
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xb8, 0xff, 0x7f, 0x40, 0x49, 0xfe, 0xc3})
+	cpu := testPc.GetPrimaryCpu()
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().AX != 0x8000 {
+		t.Errorf("Expected AX [%#04x] but got [%#04x]", 0x8000, cpu.GetRegisters().AX)
+	}
+	if cpu.GetRegisters().CX != 0xffff {
+		t.Errorf("Expected CX [%#04x] but got [%#04x]", 0xffff, cpu.GetRegisters().CX)
+	}
+	if cpu.GetRegisters().BL != 0x01 {
+		t.Errorf("Expected BL [%#02x] but got [%#02x]", 0x01, cpu.GetRegisters().BL)
+	}
+}
+
+func Test_ShiftAndRotate(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		initialValue  uint16
+		carry         bool
+		expectedValue uint16
+		expectedCarry bool
+	}{
+		// shl word [0x0800], 1
+		{"TestShlWord", []uint8{0xd1, 0x26, 0x00, 0x08}, 0x8001, false, 0x0002, true},
+		// shr byte [0x0800], 4
+		{"TestShrByteImm", []uint8{0xc0, 0x2e, 0x00, 0x08, 0x04}, 0x0018, false, 0x0001, true},
+		// sar word [0x0800], 1
+		{"TestSarWord", []uint8{0xd1, 0x3e, 0x00, 0x08}, 0x8002, true, 0xc001, false},
+		// sar byte [0x0800], 1 keeps bit 7, not bit 8, and leaves the next byte alone
+		{"TestSarByte", []uint8{0xd0, 0x3e, 0x00, 0x08}, 0x0081, false, 0x00c0, true},
+		// sar word [0x0800], 1 keeps bit 15 across the whole word
+		{"TestSarWordHighByte", []uint8{0xd1, 0x3e, 0x00, 0x08}, 0x8100, false, 0xc080, false},
+		// rol byte [0x0800], 1
+		{"TestRolByte", []uint8{0xd0, 0x06, 0x00, 0x08}, 0x0081, false, 0x0003, true},
+		// ror word [0x0800], 1
+		{"TestRorWord", []uint8{0xd1, 0x0e, 0x00, 0x08}, 0x0001, false, 0x8000, true},
+		// rcl byte [0x0800], 1
+		{"TestRclByte", []uint8{0xd0, 0x16, 0x00, 0x08}, 0x0040, true, 0x0081, false},
+		// rcr word [0x0800], 1
+		{"TestRcrWord", []uint8{0xd1, 0x1e, 0x00, 0x08}, 0x0002, true, 0x8001, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x0800, tt.initialValue)
+			cpu.SetFlag(intel8086.CarryFlag, tt.carry)
+
+			cpu.Step()
+
+			value, _ := mem.ReadAddr16(0x0800)
+			if value != tt.expectedValue {
+				t.Errorf("Expected memory value [%#04x] but got [%#04x]", tt.expectedValue, value)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCarry {
+				t.Errorf("Expected carry flag %v but got %v", tt.expectedCarry, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if length := uint16(len(tt.instruction)); cpu.GetIP() != 0x100+length {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+length, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_AccumulatorImmediate(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedEAX uint32
+	}{
+		// EAX is 0x12340101 with CF set to start with
+		// add al, 0x01
+		{"TestAddAl", []uint8{0x04, 0x01}, 0x12340102},
+		// add ax, 0x0101
+		{"TestAddAx", []uint8{0x05, 0x01, 0x01}, 0x12340202},
+		// adc al, 0x01
+		{"TestAdcAl", []uint8{0x14, 0x01}, 0x12340103},
+		// adc ax, 0x0001
+		{"TestAdcAx", []uint8{0x15, 0x01, 0x00}, 0x12340103},
+		// and al, 0x0f
+		{"TestAndAl", []uint8{0x24, 0x0f}, 0x12340101},
+		// and ax, 0x00ff
+		{"TestAndAx", []uint8{0x25, 0xff, 0x00}, 0x12340001},
+		// sub al, 0x01
+		{"TestSubAl", []uint8{0x2c, 0x01}, 0x12340100},
+		// sub ax, 0x0101
+		{"TestSubAx", []uint8{0x2d, 0x01, 0x01}, 0x12340000},
+		// add eax, 0x00010000
+		{"TestAddEax", []uint8{0x66, 0x05, 0x00, 0x00, 0x01, 0x00}, 0x12350101},
+		// sub eax, 0x12340101
+		{"TestSubEax", []uint8{0x66, 0x2d, 0x01, 0x01, 0x34, 0x12}, 0x00000000},
+		// xor eax, 0xffffffff
+		{"TestXorEax", []uint8{0x66, 0x35, 0xff, 0xff, 0xff, 0xff}, 0xedcbfefe},
+		// cmp eax, 0x12340101 leaves EAX alone
+		{"TestCmpEax", []uint8{0x66, 0x3d, 0x01, 0x01, 0x34, 0x12}, 0x12340101},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().EAX = 0x12340101
+			cpu.SetFlag(intel8086.CarryFlag, true)
+
+			cpu.Step()
+
+			if cpu.GetRegisters().EAX != tt.expectedEAX {
+				t.Errorf("Expected EAX [%#08x] but got [%#08x]", tt.expectedEAX, cpu.GetRegisters().EAX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_AsciiAdjust(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		ah, al      uint8
+		expectedAH  uint8
+		expectedAL  uint8
+		expectedZF  bool
+		expectedSF  bool
+		expectedPF  bool
+	}{
+		// aam
+		{"TestAamBase10", []uint8{0xd4, 0x0a}, 0x00, 79, 7, 9, false, false, true},
+		// aam 16
+		{"TestAamBase16", []uint8{0xd4, 0x10}, 0x00, 0xab, 0x0a, 0x0b, false, false, false},
+		{"TestAamZero", []uint8{0xd4, 0x0a}, 0x12, 0x00, 0x00, 0x00, true, false, true},
+		// aad
+		{"TestAadBase10", []uint8{0xd5, 0x0a}, 7, 9, 0x00, 79, false, false, false},
+		// aad 16
+		{"TestAadBase16", []uint8{0xd5, 0x10}, 0x0a, 0x0b, 0x00, 0xab, false, true, false},
+		// aad wraps at a byte
+		{"TestAadWraps", []uint8{0xd5, 0x0a}, 30, 0x00, 0x00, 0x2c, false, false, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			registers := cpu.GetRegisters()
+			registers.AH = tt.ah
+			registers.AL = tt.al
+			registers.SetFlag(intel8086.CarryFlag, true)
+
+			cpu.Step()
+
+			if registers.AH != tt.expectedAH || registers.AL != tt.expectedAL {
+				t.Errorf("Expected AH [%#02x] AL [%#02x] but got AH [%#02x] AL [%#02x]", tt.expectedAH, tt.expectedAL, registers.AH, registers.AL)
+			}
+			if registers.AX != uint16(tt.expectedAH)<<8|uint16(tt.expectedAL) {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", uint16(tt.expectedAH)<<8|uint16(tt.expectedAL), registers.AX)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetFlag(intel8086.SignFlag) != tt.expectedSF {
+				t.Errorf("Expected SF %t but got %t", tt.expectedSF, cpu.GetFlag(intel8086.SignFlag))
+			}
+			if cpu.GetFlag(intel8086.ParityFlag) != tt.expectedPF {
+				t.Errorf("Expected PF %t but got %t", tt.expectedPF, cpu.GetFlag(intel8086.ParityFlag))
+			}
+			if !cpu.GetFlag(intel8086.CarryFlag) {
+				t.Errorf("Expected CF to be left alone")
+			}
+			if cpu.GetIP() != 0x102 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x102, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_AamBaseZeroRaisesDe(t *testing.T) {
+
+	// aam 0
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xd4, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().AH = 0x12
+	cpu.GetRegisters().AL = 0x34
+
+	// #DE handler at 0000:0500
+	mem.WriteAddr16(0x00*4, 0x0500)
+	mem.WriteAddr16(0x00*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+		t.Errorf("Expected the fault to return to the aam [%#04x] but got [%#04x]", 0x0100, returnIP)
+	}
+	if cpu.GetRegisters().AH != 0x12 || cpu.GetRegisters().AL != 0x34 {
+		t.Errorf("Expected AH and AL to be left alone but got [%#02x] [%#02x]", cpu.GetRegisters().AH, cpu.GetRegisters().AL)
+	}
+}
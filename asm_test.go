@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086/asm"
+	"testing"
+)
+
+func Test_AssemblerEncoding(t *testing.T) {
+
+	tests := []struct {
+		source   string
+		expected []uint8
+	}{
+		{"mov ax, 5", []uint8{0xb8, 0x05, 0x00}},
+		{"mov cl, 'A'", []uint8{0xb1, 0x41}},
+		{"mov bx, ax", []uint8{0x89, 0xc3}},
+		{"mov ax, [0x0600]", []uint8{0x8b, 0x06, 0x00, 0x06}},
+		{"mov [bx+si+4], dl", []uint8{0x88, 0x50, 0x04}},
+		{"mov ax, [bp]", []uint8{0x8b, 0x46, 0x00}},
+		{"mov ax, es:[di-0x200]", []uint8{0x26, 0x8b, 0x85, 0x00, 0xfe}},
+		{"mov ds, ax", []uint8{0x8e, 0xd8}},
+		{"add ax, bx", []uint8{0x01, 0xd8}},
+		{"add al, 0x10", []uint8{0x04, 0x10}},
+		{"cmp cx, 10", []uint8{0x83, 0xf9, 0x0a}},
+		{"sub dx, 0x1234", []uint8{0x81, 0xea, 0x34, 0x12}},
+		{"and byte [bx], 0fh", []uint8{0x80, 0x27, 0x0f}},
+		{"xor si, word ptr [0x10]", []uint8{0x33, 0x36, 0x10, 0x00}},
+		{"test al, 1", []uint8{0xa8, 0x01}},
+		{"xchg ax, dx", []uint8{0x87, 0xc2}},
+		{"inc cx; dec byte [di]", []uint8{0x41, 0xfe, 0x0d}},
+		{"push ax; push es; push fs; push 8", []uint8{0x50, 0x06, 0x0f, 0xa0, 0x6a, 0x08}},
+		{"pop bx; pop ds; pop gs", []uint8{0x5b, 0x1f, 0x0f, 0xa9}},
+		{"shl ax, 1; shr bl, cl; sar dx, 3", []uint8{0xd1, 0xe0, 0xd2, 0xeb, 0xc1, 0xfa, 0x03}},
+		{"in al, dx; out 0x80, ax", []uint8{0xec, 0xe7, 0x80}},
+		{"rep movsb; int 0x10; ret 4", []uint8{0xf3, 0xa4, 0xcd, 0x10, 0xc2, 0x04, 0x00}},
+		{"jmp far 0xf000:0xfff0", []uint8{0xea, 0xf0, 0xff, 0x00, 0xf0}},
+		{"back: nop; jz back; jmp back; call back", []uint8{0x90, 0x74, 0xfd, 0xe9, 0xfa, 0xff, 0xe8, 0xf7, 0xff}},
+		{"jmp short ahead; db 1, 2; ahead: dw ahead", []uint8{0xeb, 0x02, 0x01, 0x02, 0x04, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			code, err := asm.Assemble(0x100, tt.source)
+			if err != nil {
+				t.Fatalf("Expected %q to assemble but got %s", tt.source, err.Error())
+			}
+			if string(code) != string(tt.expected) {
+				t.Errorf("Expected % x but got % x", tt.expected, code)
+			}
+		})
+	}
+}
+
+func Test_AssemblerErrors(t *testing.T) {
+
+	tests := []string{
+		"frob ax",
+		"mov ax, bl",
+		"mov [bx], 5",
+		"jz nowhere",
+		"mov al, 0x100",
+		"nop 1",
+		"here: nop; here: nop",
+		"pop cs",
+		"mov ax, [bx+bp]",
+	}
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			if code, err := asm.Assemble(0x100, source); err == nil {
+				t.Errorf("Expected %q to fail but got % x", source, code)
+			}
+		})
+	}
+
+	// rel8 can't reach 200 bytes
+	if _, err := asm.Assemble(0x100, "jz far_away; db "+repeatedOperand("0", 200)+"; far_away: nop"); err == nil {
+		t.Errorf("Expected an out of range jz to fail")
+	}
+}
+
+func Test_AssembledProgram(t *testing.T) {
+
+	testPc := newTestPcWithProgram(0x100, `
+		mov ax, 5
+		mov bx, 3
+		add ax, bx
+		mov cx, 0
+		mov dx, 2
+	again:
+		add ax, dx
+		inc cx
+		cmp ax, 16
+		jnz again
+		mov [0x0600], ax
+		push cx
+		pop dx
+		cmp ax, 16
+		jz done
+		mov dx, 0xdead
+	done:
+		hlt
+	`)
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	for i := 0; i < 100 && !cpu.IsHalted(); i++ {
+		cpu.Step()
+	}
+
+	if !cpu.IsHalted() {
+		t.Fatalf("Expected the program to reach hlt, IP is [%#04x]", cpu.GetIP())
+	}
+	if cpu.GetRegisters().AX != 16 || cpu.GetRegisters().CX != 4 || cpu.GetRegisters().DX != 4 {
+		t.Errorf("Expected AX [0x0010] CX [0x0004] DX [0x0004] but got [%#04x] [%#04x] [%#04x]", cpu.GetRegisters().AX, cpu.GetRegisters().CX, cpu.GetRegisters().DX)
+	}
+	if stored, _ := testPc.GetMemoryController().ReadAddr16(0x0600); stored != 16 {
+		t.Errorf("Expected [0x0010] stored at [0x0600] but got [%#04x]", stored)
+	}
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP back at [0x2000] but got [%#04x]", cpu.GetRegisters().SP)
+	}
+}
+
+func repeatedOperand(operand string, count int) string {
+	operands := operand
+	for i := 1; i < count; i++ {
+		operands += ", " + operand
+	}
+	return operands
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// builds an image of size bytes whose first byte is marker, with the last byte set so the image sums to zero
+func newTestBiosImage(size int, marker uint8) []byte {
+	image := make([]byte, size)
+	image[0] = marker
+	image[size-2] = 0xea // jmp far at the reset vector offset
+	image[size-1] = -(marker + 0xea)
+	return image
+}
+
+func Test_LoadBiosImage(t *testing.T) {
+
+	testPc := newTestPc()
+
+	err := testPc.LoadBiosImage(newTestBiosImage(pc.BiosImageSize128K, 0x55), pc.BiosImageOptions{VerifyChecksum: true})
+	if err != nil {
+		t.Fatalf("Expected the image to load but got %s", err)
+	}
+
+	testPc.GetMemoryController().LockBootVector()
+
+	if b := testPc.ReadMemory(0xe0000, 1); b[0] != 0x55 {
+		t.Errorf("Expected the first byte of the image at [%#05x] but got [%#02x]", 0xe0000, b[0])
+	}
+	if b := testPc.ReadMemory(0xffffe, 1); b[0] != 0xea {
+		t.Errorf("Expected the end of the image at the top of the first megabyte but got [%#02x]", b[0])
+	}
+}
+
+func Test_LoadBiosImageRejects(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		image   []byte
+		options pc.BiosImageOptions
+	}{
+		{"TestOversized", make([]byte, pc.BiosImageSize256K), pc.BiosImageOptions{Window: pc.BiosImageSize128K}},
+		{"TestTooLarge", make([]byte, pc.BiosImageSize256K*2), pc.BiosImageOptions{}},
+		{"TestMisaligned", make([]byte, pc.BiosImageSize64K+0x800), pc.BiosImageOptions{Window: pc.BiosImageSize128K}},
+		{"TestBadWindow", make([]byte, pc.BiosImageSize64K), pc.BiosImageOptions{Window: 0x30000}},
+		{"TestBadChecksum", append(make([]byte, pc.BiosImageSize64K-1), 0x01), pc.BiosImageOptions{VerifyChecksum: true}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testPc.LoadBiosImage(tt.image, tt.options); err == nil {
+				t.Errorf("Expected a %#x byte image to be rejected", len(tt.image))
+			}
+		})
+	}
+}
+
+func Test_LoadBiosImageMirrored(t *testing.T) {
+
+	testPc := newTestPc()
+
+	err := testPc.LoadBiosImage(newTestBiosImage(pc.BiosImageSize64K, 0x55), pc.BiosImageOptions{Window: pc.BiosImageSize128K})
+	if err != nil {
+		t.Fatalf("Expected the image to load but got %s", err)
+	}
+
+	testPc.GetMemoryController().LockBootVector()
+
+	for _, addr := range []uint32{0xe0000, 0xf0000} {
+		if b := testPc.ReadMemory(addr, 1); b[0] != 0x55 {
+			t.Errorf("Expected a copy of the image at [%#05x] but got [%#02x]", addr, b[0])
+		}
+	}
+	for _, addr := range []uint32{0xefffe, 0xffffe} {
+		if b := testPc.ReadMemory(addr, 1); b[0] != 0xea {
+			t.Errorf("Expected the end of a copy at [%#05x] but got [%#02x]", addr, b[0])
+		}
+	}
+
+	for _, region := range testPc.GetMemoryController().MemoryMap() {
+		if region.Name == "bios" && (region.Start != 0xe0000 || region.End != 0xfffff) {
+			t.Errorf("Expected the bios to occupy [0xe0000-0xfffff] but got [%#05x-%#05x]", region.Start, region.End)
+		}
+	}
+}
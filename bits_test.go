@@ -0,0 +1,175 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_BitTestMemoryBitmap(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		index       uint16
+		ip          uint16
+		addr        uint32
+		before      uint8
+		expected    uint8
+		expectedCF  bool
+	}{
+		// bit 100 of the bitmap at 0x0600 is bit 4 of the byte at 0x060c
+		{"TestBts", []uint8{0x0f, 0xab, 0x06, 0x00, 0x06}, 100, 0x105, 0x060c, 0x00, 0x10, false},
+		{"TestBtr", []uint8{0x0f, 0xb3, 0x06, 0x00, 0x06}, 100, 0x105, 0x060c, 0xff, 0xef, true},
+		{"TestBtc", []uint8{0x0f, 0xbb, 0x06, 0x00, 0x06}, 100, 0x105, 0x060c, 0x10, 0x00, true},
+		{"TestBt", []uint8{0x0f, 0xa3, 0x06, 0x00, 0x06}, 100, 0x105, 0x060c, 0x10, 0x10, true},
+		// the index is signed, bit -1 is the top bit of the byte below the bitmap
+		{"TestNegativeIndex", []uint8{0x0f, 0xab, 0x06, 0x00, 0x06}, 0xffff, 0x105, 0x05ff, 0x00, 0x80, false},
+		{"TestLockedBts", []uint8{0xf0, 0x0f, 0xab, 0x06, 0x00, 0x06}, 100, 0x106, 0x060c, 0x00, 0x10, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr8(tt.addr, tt.before)
+			cpu.GetRegisters().AX = tt.index
+
+			cpu.Step()
+
+			if value, _ := mem.ReadAddr8(tt.addr); value != tt.expected {
+				t.Errorf("Expected [%#02x] at [%#04x] but got [%#02x]", tt.expected, tt.addr, value)
+			}
+			if value, _ := mem.ReadAddr16(0x0600); value != 0 {
+				t.Errorf("Expected the start of the bitmap to be left alone but got [%#04x]", value)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if cpu.GetIP() != tt.ip {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.ip, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_BitTestIndexWraps(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedBX  uint16
+		expectedM   uint16
+		expectedCF  bool
+	}{
+		// bts bx, ax, bit 100 of a register is bit 4
+		{"TestRegisterDestination", []uint8{0x0f, 0xab, 0xc3}, 0x8010, 0x0000, false},
+		// bts word [0x0600], 100 only reaches the addressed word
+		{"TestImmediateMemory", []uint8{0x0f, 0xba, 0x2e, 0x00, 0x06, 0x64}, 0x8000, 0x0010, false},
+		// btr bx, 15
+		{"TestImmediateRegister", []uint8{0x0f, 0xba, 0xf3, 0x0f}, 0x0000, 0x0000, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().AX = 100
+			cpu.GetRegisters().BX = 0x8000
+
+			cpu.Step()
+
+			if cpu.GetRegisters().BX != tt.expectedBX {
+				t.Errorf("Expected BX [%#04x] but got [%#04x]", tt.expectedBX, cpu.GetRegisters().BX)
+			}
+			if value, _ := mem.ReadAddr16(0x0600); value != tt.expectedM {
+				t.Errorf("Expected [%#04x] in memory but got [%#04x]", tt.expectedM, value)
+			}
+			if value, _ := mem.ReadAddr8(0x060c); value != 0 {
+				t.Errorf("Expected the byte at [%#04x] to be left alone but got [%#02x]", 0x060c, value)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_BitTestIndex32(t *testing.T) {
+
+	// bts [0x0600], eax
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0x0f, 0xab, 0x06, 0x00, 0x06})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().EAX = 100
+
+	cpu.Step()
+
+	if value, _ := mem.ReadAddr8(0x060c); value != 0x10 {
+		t.Errorf("Expected [%#02x] at [%#04x] but got [%#02x]", 0x10, 0x060c, value)
+	}
+}
+
+func Test_BitTestLeavesOperand(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		index       uint32
+		expectedCF  bool
+	}{
+		// bt bx, ax
+		{"TestRegisterSet", []uint8{0x0f, 0xa3, 0xc3}, 15, true},
+		{"TestRegisterClear", []uint8{0x0f, 0xa3, 0xc3}, 14, false},
+		// bt ebx, eax
+		{"TestRegister32", []uint8{0x66, 0x0f, 0xa3, 0xc3}, 31, true},
+		// bt [0x0600], ax, bit 9 is bit 1 of the byte at 0x0601
+		{"TestMemorySet", []uint8{0x0f, 0xa3, 0x06, 0x00, 0x06}, 9, true},
+		{"TestMemoryClear", []uint8{0x0f, 0xa3, 0x06, 0x00, 0x06}, 8, false},
+		// bt [0x0600], eax reaching past the first dword
+		{"TestMemoryFarIndex", []uint8{0x66, 0x0f, 0xa3, 0x06, 0x00, 0x06}, 37, true},
+		// bt word [0x0600], 9
+		{"TestImmediateMemory", []uint8{0x0f, 0xba, 0x26, 0x00, 0x06, 0x09}, 0, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+
+			bitmap := []uint8{0x5a, 0xa2, 0x00, 0xff, 0x3c, 0x20, 0x81, 0x7e}
+			for i, b := range bitmap {
+				mem.WriteAddr8(0x0600+uint32(i), b)
+			}
+			cpu.GetRegisters().EAX = tt.index
+			// bit 15 of BX and bit 31 of EBX
+			cpu.GetRegisters().EBX = 0x80008000
+			cpu.GetRegisters().SetFlag(intel8086.CarryFlag, !tt.expectedCF)
+
+			cpu.Step()
+
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if cpu.GetRegisters().BX != 0x8000 || cpu.GetRegisters().EBX != 0x80008000 {
+				t.Errorf("Expected the register operand to be left alone but got BX [%#04x] EBX [%#08x]", cpu.GetRegisters().BX, cpu.GetRegisters().EBX)
+			}
+			for i, b := range bitmap {
+				if value, _ := mem.ReadAddr8(0x0600 + uint32(i)); value != b {
+					t.Errorf("Expected [%#02x] at [%#04x] to be left alone but got [%#02x]", b, 0x0600+i, value)
+				}
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
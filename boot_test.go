@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// writes a disk image with the boot code at the start of sector 0
+func writeTestBootImage(t *testing.T, code []uint8, signature bool) string {
+	image := make([]byte, 1024)
+	copy(image, code)
+	if signature {
+		image[510] = 0x55
+		image[511] = 0xaa
+	}
+
+	file, err := ioutil.TempFile("", "bootsector")
+	if err != nil {
+		t.Fatalf("Failed to create boot image: %s", err.Error())
+	}
+	defer file.Close()
+
+	_, err = file.Write(image)
+	if err != nil {
+		t.Fatalf("Failed to write boot image: %s", err.Error())
+	}
+
+	return file.Name()
+}
+
+func Test_BootFromImage(t *testing.T) {
+
+	// mov ax, 0x1234
+	path := writeTestBootImage(t, []uint8{0xb8, 0x34, 0x12}, true)
+	defer os.Remove(path)
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+
+	err := testPc.BootFromImage(path)
+	if err != nil {
+		t.Fatalf("Unexpected boot error: %s", err.Error())
+	}
+
+	if signature, _ := testPc.GetMemoryController().ReadAddr16(0x7c00 + 510); signature != 0xaa55 {
+		t.Errorf("Expected the sector loaded at [%#04x] but got signature [%#04x]", 0x7c00, signature)
+	}
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x7c00 {
+		t.Errorf("Expected entry point [0000:7c00] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().DL != 0x80 {
+		t.Errorf("Expected boot drive [%#02x] in DL but got [%#02x]", 0x80, cpu.GetRegisters().DL)
+	}
+	if testPc.GetBiosServices().GetDisk(0x80) == nil {
+		t.Errorf("Expected the image to be attached as drive [%#02x]", 0x80)
+	}
+
+	cpu.Step()
+	if cpu.GetRegisters().AX != 0x1234 {
+		t.Errorf("Expected the boot sector to run but AX is [%#04x]", cpu.GetRegisters().AX)
+	}
+
+	// the entry point survives a reset
+	cpu.Reset()
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x7c00 || cpu.GetRegisters().DL != 0x80 {
+		t.Errorf("Expected reset to [0000:7c00] with DL [%#02x] but got [%04x:%04x] with [%#02x]", 0x80, cpu.GetCS(), cpu.GetIP(), cpu.GetRegisters().DL)
+	}
+}
+
+func Test_BootFromImageRequiresSignature(t *testing.T) {
+
+	path := writeTestBootImage(t, []uint8{0xb8, 0x34, 0x12}, false)
+	defer os.Remove(path)
+
+	testPc := newTestPc()
+
+	if err := testPc.BootFromImage(path); err == nil {
+		t.Errorf("Expected a boot sector without the 0x55AA signature to be rejected")
+	}
+	if testPc.GetPrimaryCpu().GetCS() != 0xf000 {
+		t.Errorf("Expected CS to stay at the reset vector but got [%#04x]", testPc.GetPrimaryCpu().GetCS())
+	}
+}
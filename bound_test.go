@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_Bound(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		index       uint16
+		expectedIP  uint16
+	}{
+		// bound ax, [0x0600] with bounds [-2, 10]
+		{"TestBoundInRange", []uint8{0x62, 0x06, 0x00, 0x06}, 0x0005, 0x0104},
+		{"TestBoundAtLowerBound", []uint8{0x62, 0x06, 0x00, 0x06}, 0xfffe, 0x0104},
+		{"TestBoundAtUpperBound", []uint8{0x62, 0x06, 0x00, 0x06}, 0x000a, 0x0104},
+		{"TestBoundAboveUpperBound", []uint8{0x62, 0x06, 0x00, 0x06}, 0x000b, 0x0500},
+		{"TestBoundBelowLowerBound", []uint8{0x62, 0x06, 0x00, 0x06}, 0xfffd, 0x0500},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().AX = tt.index
+			mem.WriteAddr16(0x0600, 0xfffe)
+			mem.WriteAddr16(0x0602, 0x000a)
+
+			// #BR handler at 0000:0500
+			mem.WriteAddr16(0x05*4, 0x0500)
+			mem.WriteAddr16(0x05*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+			if tt.expectedIP == 0x0500 {
+				if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+					t.Errorf("Expected #BR to return to the bound instruction [%#04x] but got [%#04x]", 0x0100, returnIP)
+				}
+			}
+		})
+	}
+}
+
+func Test_Bound32(t *testing.T) {
+
+	// bound eax, [0x0600] with bounds [0x10000, 0x20000]
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0x62, 0x06, 0x00, 0x06, 0x66, 0x62, 0x06, 0x00, 0x06})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().EAX = 0x00018000
+	mem.WriteAddr32(0x0600, 0x00010000)
+	mem.WriteAddr32(0x0604, 0x00020000)
+	mem.WriteAddr16(0x05*4, 0x0500)
+	mem.WriteAddr16(0x05*4+2, 0x0000)
+
+	cpu.Step()
+	if cpu.GetIP() != 0x0105 {
+		t.Fatalf("Expected an in range index to continue at [%#04x] but got [%#04x]", 0x0105, cpu.GetIP())
+	}
+
+	cpu.GetRegisters().EAX = 0x00020001
+	cpu.Step()
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected #BR for an out of range index, IP [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+}
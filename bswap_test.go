@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_Bswap(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedEAX uint32
+		expectedEBX uint32
+		expectedAX  uint16
+	}{
+		// bswap eax
+		{"TestBswapEax", []uint8{0x66, 0x0f, 0xc8}, 0x66552211, 0x01020304, 0x2211},
+		// bswap ebx
+		{"TestBswapEbx", []uint8{0x66, 0x0f, 0xcb}, 0x11225566, 0x04030201, 0x5566},
+		// bswap ax, the 16 bit form clears the register and leaves the high word of EAX
+		{"TestBswap16", []uint8{0x0f, 0xc8}, 0x11220000, 0x01020304, 0x0000},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(intel8086.CpuFeatures{ByteSwap: true})
+			cpu.GetRegisters().EAX = 0x11225566
+			cpu.GetRegisters().EBX = 0x01020304
+
+			cpu.Step()
+
+			if cpu.GetRegisters().EAX != tt.expectedEAX {
+				t.Errorf("Expected EAX [%#08x] but got [%#08x]", tt.expectedEAX, cpu.GetRegisters().EAX)
+			}
+			if cpu.GetRegisters().EBX != tt.expectedEBX {
+				t.Errorf("Expected EBX [%#08x] but got [%#08x]", tt.expectedEBX, cpu.GetRegisters().EBX)
+			}
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_BswapWithoutFeature(t *testing.T) {
+
+	// bswap eax is #UD on a plain 386
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0x0f, 0xc8})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().EAX = 0x11223344
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if cpu.GetRegisters().EAX != 0x11223344 {
+		t.Errorf("Expected EAX to be unchanged but got [%#08x]", cpu.GetRegisters().EAX)
+	}
+}
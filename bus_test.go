@@ -0,0 +1,174 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"testing"
+)
+
+const testModuleUart = 0x40
+
+type stubBusDevice struct {
+	busId uint32
+	name  string
+}
+
+func (device *stubBusDevice) SetDeviceBusId(id uint32) {
+	device.busId = id
+}
+
+func (device *stubBusDevice) OnReceiveMessage(message bus.BusMessage) {
+
+}
+
+func (device *stubBusDevice) FriendlyPartName() string {
+	return device.name
+}
+
+func Test_BusListDevices(t *testing.T) {
+
+	testBus := bus.NewDeviceBus()
+
+	devices := []*stubBusDevice{
+		{name: "COM1"},
+		{name: "COM2"},
+		{name: "TIMER"},
+	}
+
+	testBus.RegisterDevice(devices[0], testModuleUart)
+	testBus.RegisterDevice(devices[1], testModuleUart)
+	testBus.RegisterDevice(devices[2], testModuleUart+1)
+
+	listed := testBus.ListDevices()
+	if len(listed) != len(devices) {
+		t.Fatalf("Expected %d devices but got %d", len(devices), len(listed))
+	}
+
+	expectedModules := []bus.DeviceType{testModuleUart, testModuleUart, testModuleUart + 1}
+	for i, info := range listed {
+		if info.ModuleId != expectedModules[i] {
+			t.Errorf("Device %d: expected module id %d but got %d", i, expectedModules[i], info.ModuleId)
+		}
+		if info.FriendlyName != devices[i].name {
+			t.Errorf("Device %d: expected name %s but got %s", i, devices[i].name, info.FriendlyName)
+		}
+		if info.BusId != devices[i].busId {
+			t.Errorf("Device %d: expected bus id %#08x but got %#08x", i, devices[i].busId, info.BusId)
+		}
+	}
+}
+
+func Test_BusFindDevices(t *testing.T) {
+
+	testBus := bus.NewDeviceBus()
+
+	com1 := &stubBusDevice{name: "COM1"}
+	com2 := &stubBusDevice{name: "COM2"}
+	timer := &stubBusDevice{name: "TIMER"}
+
+	testBus.RegisterDevice(com1, testModuleUart)
+	testBus.RegisterDevice(timer, testModuleUart+1)
+	testBus.RegisterDevice(com2, testModuleUart)
+
+	uarts := testBus.FindDevices(testModuleUart)
+	if len(uarts) != 2 || uarts[0] != com1 || uarts[1] != com2 {
+		t.Errorf("Expected [COM1 COM2] but got %v", uarts)
+	}
+
+	if missing := testBus.FindDevices(testModuleUart + 2); len(missing) != 0 {
+		t.Errorf("Expected no devices but got %v", missing)
+	}
+}
+
+func Test_BusListDevicesDefaultName(t *testing.T) {
+
+	testPc := newTestPc()
+
+	for _, info := range testPc.GetBus().ListDevices() {
+		if info.FriendlyName == "" || info.FriendlyName == "Unknown" {
+			t.Errorf("Device with module id %d has no friendly name", info.ModuleId)
+		}
+	}
+}
+
+type stubConnectedDevice struct {
+	stubBusDevice
+	bus *bus.Bus
+}
+
+func (device *stubConnectedDevice) SetBus(bus *bus.Bus) {
+	device.bus = bus
+}
+
+func Test_AttachDevice(t *testing.T) {
+
+	testPc := newTestPc()
+
+	uart := &stubConnectedDevice{stubBusDevice: stubBusDevice{name: "COM1"}}
+	busId := testPc.AttachDevice(uart, testModuleUart)
+
+	if uart.busId != busId {
+		t.Errorf("Expected the device to be given bus id %#08x but got %#08x", busId, uart.busId)
+	}
+	if uart.bus != testPc.GetBus() {
+		t.Errorf("Expected the device to be connected to the machine's bus")
+	}
+	if found := testPc.GetBus().FindSingleDevice(testModuleUart); found != uart {
+		t.Errorf("Expected to find COM1 but got %v", found)
+	}
+
+	devices := testPc.GetBus().ListDevices()
+	last := devices[len(devices)-1]
+	if last.FriendlyName != "COM1" || last.BusId != busId {
+		t.Errorf("Expected COM1 to be listed last but got %v", last)
+	}
+}
+
+func Test_BusMessageTracer(t *testing.T) {
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+
+	type tracedMessage struct {
+		message bus.BusMessage
+		fromId  uint32
+		toId    uint32
+	}
+	var traced []tracedMessage
+	testPc.GetBus().SetMessageTracer(func(message bus.BusMessage, fromId uint32, toId uint32) {
+		traced = append(traced, tracedMessage{message, fromId, toId})
+	})
+
+	cpu.EnterMode(common.PROTECTED_MODE)
+
+	devices := testPc.GetBus().ListDevices()
+	var cpuId uint32
+	for _, info := range devices {
+		if info.ModuleId == common.MODULE_PRIMARY_PROCESSOR {
+			cpuId = info.BusId
+		}
+	}
+
+	// the mode switch goes to every device, in registration order
+	if len(traced) != len(devices) {
+		t.Fatalf("Expected %d traced messages but got %d", len(devices), len(traced))
+	}
+	for i, trace := range traced {
+		if trace.message.Subject != common.MESSAGE_GLOBAL_CPU_MODESWITCH || string(trace.message.Data) != string([]byte{common.PROTECTED_MODE}) {
+			t.Errorf("Message %d: expected a switch to protected mode but got subject %#04x data % x", i, trace.message.Subject, trace.message.Data)
+		}
+		if trace.fromId != cpuId {
+			t.Errorf("Message %d: expected it from the cpu [%#08x] but got [%#08x]", i, cpuId, trace.fromId)
+		}
+		if trace.toId != devices[i].BusId {
+			t.Errorf("Message %d: expected it to %s [%#08x] but got [%#08x]", i, devices[i].FriendlyName, devices[i].BusId, trace.toId)
+		}
+	}
+
+	testPc.GetBus().SetMessageTracer(nil)
+	cpu.EnterMode(common.REAL_MODE)
+
+	if len(traced) != len(devices) {
+		t.Errorf("Expected no messages traced after the tracer was removed but got %d", len(traced)-len(devices))
+	}
+}
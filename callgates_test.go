@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// builds a pc in protected mode with ring 0 and ring 3 segments, a 16 bit TSS at 0x3000 and the given call gate
+// at selector 0x30. The code loads the task register and drops to ring 3 at 0x1b:0x0200 with the stack at 0x23:0x2000.
+func newTestPcWithCallGate(gate []uint8) *pc.PersonalComputer {
+	gdt := [][]uint8{
+		// 0x08: ring 0 code, base 0, limit 0xffff
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x10: ring 0 data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x18: ring 3 code
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0xfa, 0x00, 0x00},
+		// 0x20: ring 3 data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0xf2, 0x00, 0x00},
+		// 0x28: available 16 bit TSS, base 0x3000, limit 0x2b
+		{0x2b, 0x00, 0x00, 0x30, 0x00, 0x81, 0x00, 0x00},
+		// 0x30: call gate
+		gate,
+	}
+
+	// mov ax, 0x28; ltr ax; push 0x23; push 0x2000; push 0x1b; push 0x0200; retf
+	testPc := newTestPcWithGdt(gdt, []uint8{
+		0xb8, 0x28, 0x00, 0x0f, 0x00, 0xd8,
+		0x68, 0x23, 0x00, 0x68, 0x00, 0x20, 0x68, 0x1b, 0x00, 0x68, 0x00, 0x02, 0xcb,
+	})
+
+	// ring 0 stack in the TSS: SP0 0x4000, SS0 0x10
+	testPc.GetMemoryController().WriteAddr16(0x3002, 0x4000)
+	testPc.GetMemoryController().WriteAddr16(0x3004, 0x0010)
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x1000
+	for i := 0; i < 7; i++ {
+		cpu.Step()
+	}
+
+	return testPc
+}
+
+func Test_CallGateInnerPrivilegeStackSwitch(t *testing.T) {
+
+	// gate dpl 3 to 0x08:0x0400 copying 2 parameter words
+	testPc := newTestPcWithCallGate([]uint8{0x00, 0x04, 0x08, 0x00, 0x02, 0xe4, 0x00, 0x00})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	if b, _ := mem.ReadAddr8(0x1028 + 5); b != 0x83 {
+		t.Errorf("Expected ltr to mark the TSS busy [%#02x] but got [%#02x]", 0x83, b)
+	}
+
+	if cpu.GetCS() != 0x001b || cpu.GetIP() != 0x0200 || cpu.GetRegisters().SS.Selector() != 0x0023 {
+		t.Fatalf("Expected to be running at ring 3 but got [%04x:%04x] with SS [%#04x]", cpu.GetCS(), cpu.GetIP(), cpu.GetRegisters().SS.Selector())
+	}
+
+	// push 0x1111; push 0x2222; call 0x0033:0x0000
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0x68, 0x11, 0x11, 0x68, 0x22, 0x22, 0x9a, 0x00, 0x00, 0x33, 0x00},
+		0x400: {0xca, 0x04, 0x00}, // retf 4
+	})
+
+	// the retf that dropped to ring 3 had no matching call
+	setupMismatches := len(cpu.CallStackMismatches())
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0400 {
+		t.Errorf("Expected call gate to [0008:0400] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0010 || cpu.GetRegisters().SP != 0x3ff4 {
+		t.Errorf("Expected ring 0 stack [0010:3ff4] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+
+	// return IP, return CS, the parameters in their original order, then the caller's SP and SS
+	expectedStack := []uint16{0x020b, 0x001b, 0x2222, 0x1111, 0x1ffc, 0x0023}
+	for i, expected := range expectedStack {
+		value, _ := mem.ReadAddr16(0x3ff4 + uint32(i*2))
+		if value != expected {
+			t.Errorf("Expected stack word %d [%#04x] but got [%#04x]", i, expected, value)
+		}
+	}
+
+	cpu.Step() // retf 4
+
+	if cpu.GetCS() != 0x001b || cpu.GetIP() != 0x020b {
+		t.Errorf("Expected retf to [001b:020b] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0023 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected ring 3 stack [0023:2000] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+	if len(cpu.CallStackMismatches()) != setupMismatches {
+		t.Errorf("Expected the gate return to match its call but got %+v", cpu.CallStackMismatches())
+	}
+}
+
+func Test_CallGatePrivilegeCheck(t *testing.T) {
+
+	// gate dpl 0, can't be called from ring 3
+	testPc := newTestPcWithCallGate([]uint8{0x00, 0x04, 0x08, 0x00, 0x00, 0x84, 0x00, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+
+	// call 0x0033:0x0000
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0x9a, 0x00, 0x00, 0x33, 0x00},
+	})
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x001b {
+		t.Errorf("Expected the call to fault leaving CS [%#04x] but got [%#04x]", 0x001b, cpu.GetCS())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0023 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected ring 3 stack [0023:2000] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+}
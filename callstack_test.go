@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_CallStackNestedCalls(t *testing.T) {
+
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xe8, 0xfd, 0x00, 0x90}) // call 0x200; nop
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0xe8, 0xfd, 0x00, 0xc3}, // call 0x300; ret
+		0x300: {0xc3},                   // ret
+	})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step()
+	cpu.Step()
+
+	frames := cpu.CallStack()
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 call stack frames but got %d", len(frames))
+	}
+	if frames[0].ReturnIP != 0x103 || frames[0].TargetIP != 0x200 || frames[0].CallAddress != 0x100 {
+		t.Errorf("Unexpected outer frame: %+v", frames[0])
+	}
+	if frames[1].ReturnIP != 0x203 || frames[1].TargetIP != 0x300 || frames[1].CallAddress != 0x200 {
+		t.Errorf("Unexpected inner frame: %+v", frames[1])
+	}
+
+	cpu.Step() // ret from 0x300
+	if cpu.GetIP() != 0x203 || len(cpu.CallStack()) != 1 {
+		t.Errorf("Expected to return to [%#04x] with 1 frame but got [%#04x] with %d", 0x203, cpu.GetIP(), len(cpu.CallStack()))
+	}
+
+	cpu.Step() // ret from 0x200
+	if cpu.GetIP() != 0x103 || len(cpu.CallStack()) != 0 {
+		t.Errorf("Expected to return to [%#04x] with 0 frames but got [%#04x] with %d", 0x103, cpu.GetIP(), len(cpu.CallStack()))
+	}
+
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+	if len(cpu.CallStackMismatches()) != 0 {
+		t.Errorf("Expected no call stack mismatches but got %+v", cpu.CallStackMismatches())
+	}
+}
+
+func Test_CallStackFarCall(t *testing.T) {
+
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x9a, 0x00, 0x00, 0x40, 0x00, 0x90}) // call 0040:0000; nop
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x400: {0xcb}, // retf
+	})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step()
+	if cpu.GetCS() != 0x0040 || cpu.GetIP() != 0x0000 {
+		t.Errorf("Expected far call to [0040:0000] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if frames := cpu.CallStack(); len(frames) != 1 || !frames[0].Far || frames[0].TargetCS != 0x0040 {
+		t.Errorf("Unexpected call stack %+v", frames)
+	}
+
+	cpu.Step()
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0105 {
+		t.Errorf("Expected retf to [0000:0105] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if len(cpu.CallStack()) != 0 || len(cpu.CallStackMismatches()) != 0 {
+		t.Errorf("Expected empty call stack without mismatches")
+	}
+}
+
+func Test_CallStackMismatchDetected(t *testing.T) {
+
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xe8, 0xfd, 0x00, 0x90}) // call 0x200; nop
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x150: {0x90},                   // nop
+		0x200: {0x68, 0x50, 0x01, 0xc3}, // push 0x150; ret
+	})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step() // call
+	cpu.Step() // push
+	cpu.Step() // ret to the pushed address
+
+	if cpu.GetIP() != 0x150 {
+		t.Errorf("Expected ret to [%#04x] but got [%#04x]", 0x150, cpu.GetIP())
+	}
+
+	mismatches := cpu.CallStackMismatches()
+	if len(mismatches) != 1 {
+		t.Fatalf("Expected 1 call stack mismatch but got %d", len(mismatches))
+	}
+	if mismatches[0].ReturnIP != 0x150 || mismatches[0].Expected == nil || mismatches[0].Expected.ReturnIP != 0x103 {
+		t.Errorf("Unexpected mismatch %+v", mismatches[0])
+	}
+	if mismatches[0].RetAddress != 0x203 {
+		t.Errorf("Expected mismatch at ret [%#04x] but got [%#04x]", 0x203, mismatches[0].RetAddress)
+	}
+}
+
+func Test_CallStackRetWithoutCall(t *testing.T) {
+
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x68, 0x50, 0x01, 0xc3}) // push 0x150; ret
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step()
+	cpu.Step()
+
+	mismatches := cpu.CallStackMismatches()
+	if len(mismatches) != 1 || mismatches[0].Expected != nil {
+		t.Errorf("Expected a ret without a call to be flagged but got %+v", mismatches)
+	}
+}
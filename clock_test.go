@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+	"time"
+)
+
+// builds a new pc with a frozen clock and loads the instructions at 0000:ip
+func newTestPcWithClock(clock common.Clock, ip uint16, instructions []uint8) *pc.PersonalComputer {
+	testPc := pc.NewPcWithClock(clock)
+	testPc.GetPrimaryCpu().Init(testPc.GetBus())
+	testPc.GetMemoryController().UnlockBootVector()
+	testPc.GetPrimaryCpu().SetCS(0x0)
+	testPc.GetPrimaryCpu().SetIP(ip)
+
+	for x := 0; x < len(instructions); x++ {
+		testPc.GetMemoryController().WriteAddr8(uint32(ip)+uint32(x), instructions[x])
+	}
+
+	return testPc
+}
+
+func Test_RtcFrozenClock(t *testing.T) {
+
+	clock := common.NewFixedClock(time.Date(1994, time.March, 17, 13, 45, 30, 0, time.UTC))
+
+	tests := []struct {
+		name     string
+		register uint8
+		expected uint8
+	}{
+		{"TestRtcSeconds", 0x00, 0x30},
+		{"TestRtcMinutes", 0x02, 0x45},
+		{"TestRtcHours", 0x04, 0x13},
+		{"TestRtcDayOfWeek", 0x06, 0x05},
+		{"TestRtcDayOfMonth", 0x07, 0x17},
+		{"TestRtcMonth", 0x08, 0x03},
+		{"TestRtcYear", 0x09, 0x94},
+		{"TestRtcCentury", 0x32, 0x19},
+	}
+	for _, tt := range tests {
+
+		// mov al, register; out 0x70, al; in al, 0x71
+		testPc := newTestPcWithClock(clock, 0x100, []uint8{0xb0, tt.register, 0xe6, 0x70, 0xe4, 0x71})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().AL != tt.expected {
+				t.Errorf("Expected RTC register %#02x to read [%#02x] but got [%#02x]", tt.register, tt.expected, cpu.GetRegisters().AL)
+			}
+		})
+	}
+}
+
+func Test_PitCounterFollowsClock(t *testing.T) {
+
+	clock := common.NewFixedClock(time.Date(1994, time.March, 17, 13, 45, 30, 0, time.UTC))
+
+	// mov al, 0x34; out 0x43, al; mov al, 0x00; out 0x40, al; out 0x40, al
+	// channel 0, lo/hi access, rate generator, reload 0x10000
+	testPc := newTestPcWithClock(clock, 0x100, []uint8{0xb0, 0x34, 0xe6, 0x43, 0xb0, 0x00, 0xe6, 0x40, 0xe6, 0x40, 0xe4, 0x40, 0x86, 0xc4, 0xe4, 0x40})
+	cpu := testPc.GetPrimaryCpu()
+
+	for i := 0; i < 5; i++ {
+		cpu.Step()
+	}
+
+	// exactly 1193182 input clock ticks, 18 whole periods of 0x10000 and 0x34de ticks into the next
+	clock.Advance(time.Second)
+
+	// in al, 0x40; xchg al, ah; in al, 0x40
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	count := uint16(cpu.GetRegisters().AL)<<8 | uint16(cpu.GetRegisters().AH)
+	if count != 0x10000-0x34de {
+		t.Errorf("Expected PIT count [%#04x] but got [%#04x]", 0x10000-0x34de, count)
+	}
+}
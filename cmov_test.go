@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_CmovZ(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		zeroFlag    bool
+		expectedAX  uint16
+		expectedEAX uint32
+		expectedIP  uint16
+	}{
+		// cmovz ax, bx
+		{"TestCmovzTaken", []uint8{0x0f, 0x44, 0xc3}, true, 0x5678, 0x11115678, 0x0103},
+		{"TestCmovzNotTaken", []uint8{0x0f, 0x44, 0xc3}, false, 0x1234, 0x11111234, 0x0103},
+		// cmovz ax, [0x0600], the displacement is consumed either way
+		{"TestCmovzMemoryTaken", []uint8{0x0f, 0x44, 0x06, 0x00, 0x06}, true, 0xbeef, 0x1111beef, 0x0105},
+		{"TestCmovzMemoryNotTaken", []uint8{0x0f, 0x44, 0x06, 0x00, 0x06}, false, 0x1234, 0x11111234, 0x0105},
+		// cmovz eax, ebx
+		{"TestCmovz32Taken", []uint8{0x66, 0x0f, 0x44, 0xc3}, true, 0x5678, 0x22225678, 0x0104},
+		{"TestCmovz32NotTaken", []uint8{0x66, 0x0f, 0x44, 0xc3}, false, 0x1234, 0x11111234, 0x0104},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(intel8086.CpuFeatures{ConditionalMove: true})
+			testPc.GetMemoryController().WriteAddr16(0x0600, 0xbeef)
+			cpu.GetRegisters().EAX = 0x11111234
+			cpu.GetRegisters().EBX = 0x22225678
+			cpu.SetFlag(intel8086.ZeroFlag, tt.zeroFlag)
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetRegisters().EAX != tt.expectedEAX {
+				t.Errorf("Expected EAX [%#08x] but got [%#08x]", tt.expectedEAX, cpu.GetRegisters().EAX)
+			}
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_CmovWithoutFeature(t *testing.T) {
+
+	// cmovz ax, bx is #UD on a plain 386
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x44, 0xc3})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().BX = 0x5678
+	cpu.SetFlag(intel8086.ZeroFlag, true)
+
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if cpu.GetRegisters().AX == 0x5678 {
+		t.Errorf("Expected AX to be left unchanged without the feature")
+	}
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"time"
+)
+
+/*
+	Time source consulted by devices that depend on the host clock (RTC, PIT)
+	Machines default to the system clock, tests can inject a FixedClock for reproducible runs
+*/
+
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock struct{}
+
+func (clock SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Clock that only moves when told to
+type FixedClock struct {
+	current time.Time
+}
+
+func NewFixedClock(t time.Time) *FixedClock {
+	return &FixedClock{current: t}
+}
+
+func (clock *FixedClock) Now() time.Time {
+	return clock.current
+}
+
+func (clock *FixedClock) Set(t time.Time) {
+	clock.current = t
+}
+
+func (clock *FixedClock) Advance(d time.Duration) {
+	clock.current = clock.current.Add(d)
+}
@@ -14,13 +14,41 @@ const (
 	MODULE_IO_PORT_ACCESS_CONTROLLER
 	MODULE_PS2_CONTROLLER
 	MODULE_INTEL_82335_MCR
+	MODULE_REAL_TIME_CLOCK
+	MODULE_PROGRAMMABLE_INTERVAL_TIMER
+	MODULE_BIOS_SERVICES
+	MODULE_VIDEO_ADAPTER
+	MODULE_PCI_HOST_BRIDGE
+	MODULE_SERIAL_PORT
 )
 
+// Segment override prefixes, 0 is no override
 const (
-	SEGMENT_CS = iota
+	SEGMENT_CS = iota + 1
 	SEGMENT_SS
 	SEGMENT_DS
 	SEGMENT_ES
 	SEGMENT_FS
 	SEGMENT_GS
 )
+
+func ModuleIdToString(moduleId uint8) string {
+	switch moduleId {
+	case MODULE_PRIMARY_PROCESSOR: return "PRIMARY PROCESSOR"
+	case MODULE_MATH_CO_PROCESSOR: return "MATH CO PROCESSOR"
+	case MODULE_MASTER_INTERRUPT_CONTROLLER: return "MASTER INTERRUPT CONTROLLER"
+	case MODULE_SLAVE_INTERRUPT_CONTROLLER: return "SLAVE INTERRUPT CONTROLLER"
+	case MODULE_MEMORY_ACCESS_CONTROLLER: return "MEMORY ACCESS CONTROLLER"
+	case MODULE_IO_PORT_ACCESS_CONTROLLER: return "IO PORT ACCESS CONTROLLER"
+	case MODULE_PS2_CONTROLLER: return "PS2 CONTROLLER"
+	case MODULE_INTEL_82335_MCR: return "INTEL 82335 MCR"
+	case MODULE_REAL_TIME_CLOCK: return "REAL TIME CLOCK"
+	case MODULE_PROGRAMMABLE_INTERVAL_TIMER: return "PROGRAMMABLE INTERVAL TIMER"
+	case MODULE_BIOS_SERVICES: return "BIOS SERVICES"
+	case MODULE_VIDEO_ADAPTER: return "VIDEO ADAPTER"
+	case MODULE_PCI_HOST_BRIDGE: return "PCI HOST BRIDGE"
+	case MODULE_SERIAL_PORT: return "SERIAL PORT"
+	default:
+		return "Unknown"
+	}
+}
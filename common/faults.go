@@ -1,11 +1,30 @@
 package common
 
+import "fmt"
 
-type GeneralProtectionFault struct {
+const (
+	GP_ERROR_CODE_EXTERNAL = 0x1 // the fault happened delivering an external interrupt
+	GP_ERROR_CODE_IDT      = 0x2 // the index refers to an IDT gate
+	GP_ERROR_CODE_LDT      = 0x4 // the index refers to the LDT (TI bit)
+)
 
+// ErrorCode holds the selector index with the EXT/IDT/TI bits, 0 when no selector is involved
+type GeneralProtectionFault struct {
+	ErrorCode uint16
 }
 
-func (GeneralProtectionFault) Error() string {
+func (fault GeneralProtectionFault) Error() string {
+	if fault.ErrorCode != 0 {
+		return fmt.Sprintf("General Protection Fault (error code %#04x)", fault.ErrorCode)
+	}
 	return "General Protection Fault"
 }
 
+// Raised as #NP for a segment or gate which isn't present, the error code is built as for GeneralProtectionFault
+type SegmentNotPresentFault struct {
+	ErrorCode uint16
+}
+
+func (fault SegmentNotPresentFault) Error() string {
+	return fmt.Sprintf("Segment Not Present Fault (error code %#04x)", fault.ErrorCode)
+}
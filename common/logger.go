@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+/*
+	Leveled logger used by the emulated devices
+	Per-instruction tracing is logged at LOG_LEVEL_TRACE so it is hidden by default
+*/
+
+type LogLevel uint8
+
+const (
+	LOG_LEVEL_TRACE LogLevel = iota
+	LOG_LEVEL_DEBUG
+	LOG_LEVEL_INFO
+	LOG_LEVEL_WARN
+	LOG_LEVEL_ERROR
+)
+
+const DefaultLogLevel = LOG_LEVEL_WARN
+
+type Logger struct {
+	level  LogLevel
+	output *log.Logger
+}
+
+// Shared logger for devices that don't carry their own
+var DefaultLogger = NewLogger(DefaultLogLevel)
+
+func NewLogger(level LogLevel) *Logger {
+	return &Logger{
+		level:  level,
+		output: log.New(os.Stderr, "", log.LstdFlags),
+	}
+}
+
+func (logger *Logger) SetLevel(level LogLevel) {
+	logger.level = level
+}
+
+func (logger *Logger) GetLevel() LogLevel {
+	return logger.level
+}
+
+func (logger *Logger) SetOutput(w io.Writer) {
+	logger.output.SetOutput(w)
+}
+
+// Sets the log package header flags, 0 drops the timestamp
+func (logger *Logger) SetFlags(flags int) {
+	logger.output.SetFlags(flags)
+}
+
+func (logger *Logger) IsEnabled(level LogLevel) bool {
+	return level >= logger.level
+}
+
+func (logger *Logger) logf(level LogLevel, format string, v ...interface{}) {
+	if !logger.IsEnabled(level) {
+		return
+	}
+	logger.output.Output(3, logLevelPrefix(level)+fmt.Sprintf(format, v...))
+}
+
+func (logger *Logger) Tracef(format string, v ...interface{}) {
+	logger.logf(LOG_LEVEL_TRACE, format, v...)
+}
+
+func (logger *Logger) Debugf(format string, v ...interface{}) {
+	logger.logf(LOG_LEVEL_DEBUG, format, v...)
+}
+
+func (logger *Logger) Infof(format string, v ...interface{}) {
+	logger.logf(LOG_LEVEL_INFO, format, v...)
+}
+
+func (logger *Logger) Warnf(format string, v ...interface{}) {
+	logger.logf(LOG_LEVEL_WARN, format, v...)
+}
+
+func (logger *Logger) Errorf(format string, v ...interface{}) {
+	logger.logf(LOG_LEVEL_ERROR, format, v...)
+}
+
+// Logs regardless of the level and then exits, same as log.Fatalf
+func (logger *Logger) Fatalf(format string, v ...interface{}) {
+	logger.output.Output(2, logLevelPrefix(LOG_LEVEL_ERROR)+fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+func logLevelPrefix(level LogLevel) string {
+	switch level {
+	case LOG_LEVEL_TRACE: return "TRACE "
+	case LOG_LEVEL_DEBUG: return "DEBUG "
+	case LOG_LEVEL_INFO: return "INFO "
+	case LOG_LEVEL_WARN: return "WARN "
+	case LOG_LEVEL_ERROR: return "ERROR "
+	default:
+		return ""
+	}
+}
@@ -5,4 +5,24 @@ const (
 	MESSAGE_REQUEST_CPU_MODESWITCH = 0x101
 	MESSAGE_GLOBAL_LOCK_BIOS_MEM_REGION = 0x200
 	MESSAGE_GLOBAL_UNLOCK_BIOS_MEM_REGION = 0x201
+	MESSAGE_LOCK_REGION = 0x202 // Data is a region, see EncodeRegion
+	MESSAGE_UNLOCK_REGION = 0x203
+	MESSAGE_GLOBAL_RESET = 0x300 // devices return to their power on state
 )
+
+// Encodes the inclusive address range start-end for the region messages, as two little endian dwords
+func EncodeRegion(start uint32, end uint32) []byte {
+	return []byte{
+		uint8(start), uint8(start >> 8), uint8(start >> 16), uint8(start >> 24),
+		uint8(end), uint8(end >> 8), uint8(end >> 16), uint8(end >> 24),
+	}
+}
+
+func DecodeRegion(data []byte) (start uint32, end uint32, ok bool) {
+	if len(data) < 8 {
+		return 0, 0, false
+	}
+	start = uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+	end = uint32(data[4]) | uint32(data[5])<<8 | uint32(data[6])<<16 | uint32(data[7])<<24
+	return start, end, start <= end
+}
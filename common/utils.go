@@ -36,7 +36,7 @@ func B(val bool) byte {
 
 
 func GetMSB(value uint8) uint8 {
-	return (value >> 8) & 1
+	return (value >> 7) & 1
 }
 
 func GetBitValue(value uint8, place uint8) uint8 {
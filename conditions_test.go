@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_EvaluateCondition(t *testing.T) {
+
+	const (
+		cf = intel8086.CarryFlag
+		pf = intel8086.ParityFlag
+		zf = intel8086.ZeroFlag
+		sf = intel8086.SignFlag
+		of = intel8086.OverFlowFlag
+	)
+
+	tests := []struct {
+		name     string
+		cc       uint8
+		flags    uint16
+		expected bool
+	}{
+		{"TestO", intel8086.ConditionOverflow, of, true},
+		{"TestOClear", intel8086.ConditionOverflow, cf | zf | sf | pf, false},
+		{"TestNO", intel8086.ConditionNotOverflow, 0, true},
+		{"TestNOSet", intel8086.ConditionNotOverflow, of, false},
+		{"TestB", intel8086.ConditionBelow, cf, true},
+		{"TestBClear", intel8086.ConditionBelow, zf, false},
+		{"TestNB", intel8086.ConditionNotBelow, zf, true},
+		{"TestNBSet", intel8086.ConditionNotBelow, cf, false},
+		{"TestZ", intel8086.ConditionZero, zf, true},
+		{"TestZClear", intel8086.ConditionZero, cf, false},
+		{"TestNZ", intel8086.ConditionNotZero, cf, true},
+		{"TestNZSet", intel8086.ConditionNotZero, zf, false},
+		{"TestBECarry", intel8086.ConditionBelowOrEqual, cf, true},
+		{"TestBEZero", intel8086.ConditionBelowOrEqual, zf, true},
+		{"TestBEClear", intel8086.ConditionBelowOrEqual, sf | of, false},
+		{"TestA", intel8086.ConditionAbove, 0, true},
+		{"TestACarry", intel8086.ConditionAbove, cf, false},
+		{"TestAZero", intel8086.ConditionAbove, zf, false},
+		{"TestS", intel8086.ConditionSign, sf, true},
+		{"TestSClear", intel8086.ConditionSign, of, false},
+		{"TestNS", intel8086.ConditionNotSign, of, true},
+		{"TestNSSet", intel8086.ConditionNotSign, sf, false},
+		{"TestP", intel8086.ConditionParity, pf, true},
+		{"TestPClear", intel8086.ConditionParity, 0, false},
+		{"TestNP", intel8086.ConditionNotParity, 0, true},
+		{"TestNPSet", intel8086.ConditionNotParity, pf, false},
+		{"TestLSign", intel8086.ConditionLess, sf, true},
+		{"TestLOverflow", intel8086.ConditionLess, of, true},
+		{"TestLBoth", intel8086.ConditionLess, sf | of, false},
+		{"TestLNeither", intel8086.ConditionLess, zf, false},
+		{"TestGE", intel8086.ConditionGreaterOrEqual, sf | of, true},
+		{"TestGENeither", intel8086.ConditionGreaterOrEqual, 0, true},
+		{"TestGESign", intel8086.ConditionGreaterOrEqual, sf, false},
+		{"TestLEZero", intel8086.ConditionLessOrEqual, zf | sf | of, true},
+		{"TestLESign", intel8086.ConditionLessOrEqual, sf, true},
+		{"TestLEGreater", intel8086.ConditionLessOrEqual, sf | of, false},
+		{"TestG", intel8086.ConditionGreater, sf | of, true},
+		{"TestGNeither", intel8086.ConditionGreater, 0, true},
+		{"TestGZero", intel8086.ConditionGreater, zf, false},
+		{"TestGOverflow", intel8086.ConditionGreater, of, false},
+	}
+
+	covered := map[uint8]bool{}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().FLAGS = tt.flags
+
+			if result := intel8086.EvaluateCondition(cpu, tt.cc); result != tt.expected {
+				t.Errorf("Expected condition %#x with flags [%#04x] to be %t but got %t", tt.cc, tt.flags, tt.expected, result)
+			}
+		})
+		covered[tt.cc] = true
+	}
+
+	if len(covered) != 16 {
+		t.Errorf("Expected all 16 condition codes to be covered but got %d", len(covered))
+	}
+}
+
+func Test_JccShortRel8(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		flags       uint16
+		expectedIP  uint16
+	}{
+		// jl +0x10 with SF != OF
+		{"TestJLTaken", []uint8{0x7c, 0x10}, intel8086.SignFlag, 0x0112},
+		// jl +0x10 with SF == OF
+		{"TestJLNotTaken", []uint8{0x7c, 0x10}, intel8086.SignFlag | intel8086.OverFlowFlag, 0x0102},
+		// ja -0x02 with CF and ZF clear
+		{"TestJATaken", []uint8{0x77, 0xfe}, 0, 0x0100},
+		// jb +0x10 with CF clear
+		{"TestJBNotTaken", []uint8{0x72, 0x10}, intel8086.ZeroFlag, 0x0102},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().FLAGS = tt.flags
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
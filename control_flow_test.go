@@ -160,3 +160,37 @@ func Test_BufferInitTest_INSTRUCTIONS(t *testing.T) {
 		})
 	}
 }
+
+func Test_BackwardShortJumps(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		zeroFlag    bool
+		cxValue     uint16
+		expectedIP  uint16
+	}{
+		{"TestJMP_SHORT_REL8_Minus128", []uint8{0xeb, 0x80}, false, 1, 0x0182},
+		{"TestJMP_SHORT_REL8_Minus16", []uint8{0xeb, 0xf0}, false, 1, 0x01f2},
+		{"TestJZ_SHORT_REL8_Minus128", []uint8{0x74, 0x80}, true, 1, 0x0182},
+		{"TestJNZ_SHORT_REL8_Minus127", []uint8{0x75, 0x81}, false, 1, 0x0183},
+		{"TestJCXZ_SHORT_REL8_Minus128", []uint8{0xe3, 0x80}, false, 0, 0x0182},
+		{"TestJMP_SHORT_REL8_Plus127", []uint8{0xeb, 0x7f}, false, 1, 0x0281},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x200, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFlag(intel8086.ZeroFlag, tt.zeroFlag)
+			cpu.GetRegisters().CX = tt.cxValue
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected ip [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
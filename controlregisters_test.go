@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_MovControlRegisters(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedECX uint32
+		expectedIP  uint16
+	}{
+		// mov cr2, eax; mov ecx, cr2
+		{"TestCr2", []uint8{0x0f, 0x22, 0xd0, 0x0f, 0x20, 0xd1}, 0x12345678, 0x0106},
+		// mov cr4, eax; mov ecx, cr4
+		{"TestCr4", []uint8{0x0f, 0x22, 0xe0, 0x0f, 0x20, 0xe1}, 0x12345678, 0x0106},
+		// mov cr3, eax; mov ecx, cr3 with mod 0, which still names a register and takes no displacement
+		{"TestCr3IgnoresMod", []uint8{0x0f, 0x22, 0x18, 0x0f, 0x20, 0x19}, 0x12345678, 0x0106},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().EAX = 0x12345678
+
+			cpu.Step()
+			cpu.Step()
+
+			if cpu.GetRegisters().ECX != tt.expectedECX {
+				t.Errorf("Expected ECX [%#08x] but got [%#08x]", tt.expectedECX, cpu.GetRegisters().ECX)
+			}
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_MovDebugRegisters(t *testing.T) {
+
+	// mov dr0, eax; mov ebx, dr0; mov edx, dr4
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x23, 0xc0, 0x0f, 0x21, 0xc3, 0x0f, 0x21, 0xe2})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().EAX = 0x00007c00
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().DR0 != 0x00007c00 {
+		t.Errorf("Expected DR0 [%#08x] but got [%#08x]", 0x00007c00, cpu.GetRegisters().DR0)
+	}
+	if cpu.GetRegisters().EBX != 0x00007c00 {
+		t.Errorf("Expected EBX [%#08x] but got [%#08x]", 0x00007c00, cpu.GetRegisters().EBX)
+	}
+	if cpu.GetRegisters().EDX != 0xffff0ff0 {
+		t.Errorf("Expected DR4 to read DR6 [%#08x] but got [%#08x]", 0xffff0ff0, cpu.GetRegisters().EDX)
+	}
+	if cpu.GetIP() != 0x0109 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0109, cpu.GetIP())
+	}
+}
+
+func Test_MovControlRegisterInvalid(t *testing.T) {
+
+	// mov eax, cr1 is #UD
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x20, 0xc8})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+}
+
+func Test_MovDebugRegisterRequiresRing0(t *testing.T) {
+
+	// any gate will do, the code only needs to be running at ring 3
+	testPc := newTestPcWithCallGate([]uint8{0x00, 0x04, 0x08, 0x00, 0x00, 0x84, 0x00, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().EAX = 0x00007c00
+
+	// mov dr0, eax
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0x0f, 0x23, 0xc0},
+	})
+
+	cpu.Step()
+
+	if cpu.GetRegisters().DR0 != 0 {
+		t.Errorf("Expected mov dr0 to fault at ring 3 leaving DR0 clear but got [%#08x]", cpu.GetRegisters().DR0)
+	}
+	if cpu.GetIP() == 0x0203 {
+		t.Errorf("Expected mov dr0 to fault at ring 3 rather than complete")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_ExecuteBreakpoint(t *testing.T) {
+
+	// nop; nop; nop with DR0 on the second nop, the #DB handler is an iret
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x90, 0x90, 0x90})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	mem.WriteAddr16(0x01*4, 0x0500)
+	mem.WriteAddr16(0x01*4+2, 0x0000)
+	mem.WriteAddr8(0x0500, 0xcf)
+
+	cpu.GetRegisters().DR0 = 0x0101
+	cpu.GetRegisters().DR7 = 0x00000401 // L0, execute, 1 byte
+
+	cpu.Step()
+	if cpu.GetIP() != 0x0101 {
+		t.Fatalf("Expected IP [%#04x] but got [%#04x]", 0x0101, cpu.GetIP())
+	}
+
+	cpu.Step()
+	if cpu.GetIP() != 0x0500 {
+		t.Fatalf("Expected the #DB handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if cpu.GetRegisters().DR6&0xf != 0x1 {
+		t.Errorf("Expected B0 set in DR6 but got [%#08x]", cpu.GetRegisters().DR6)
+	}
+	if ret, _ := mem.ReadAddr16(0x2000 - 6); ret != 0x0101 {
+		t.Errorf("Expected the fault to return to the breakpoint [%#04x] but got [%#04x]", 0x0101, ret)
+	}
+
+	cpu.Step() // iret
+	cpu.Step()
+	if cpu.GetIP() != 0x0102 {
+		t.Errorf("Expected the instruction at the breakpoint to run after the handler returned, IP [%#04x] but got [%#04x]", 0x0102, cpu.GetIP())
+	}
+}
+
+func Test_DataBreakpoint(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		dr7         uint32
+		expectFire  bool
+	}{
+		// mov [0x0600], bx with a 2 byte write breakpoint on DR1
+		{"TestWriteFires", []uint8{0x89, 0x1e, 0x00, 0x06}, 0x00500408, true},
+		// mov [0x0601], bl overlaps the watched word
+		{"TestOverlappingWriteFires", []uint8{0x88, 0x1e, 0x01, 0x06}, 0x00500408, true},
+		// mov [0x0602], bx is past it
+		{"TestWriteOutsideRange", []uint8{0x89, 0x1e, 0x02, 0x06}, 0x00500408, false},
+		// mov bx, [0x0600] doesn't fire a write breakpoint
+		{"TestReadIgnoredByWriteBreakpoint", []uint8{0x8b, 0x1e, 0x00, 0x06}, 0x00500408, false},
+		// mov bx, [0x0600] fires a read/write breakpoint
+		{"TestReadFiresReadWriteBreakpoint", []uint8{0x8b, 0x1e, 0x00, 0x06}, 0x00700408, true},
+		// push bx lands on the watched word
+		{"TestPushFires", []uint8{0x53}, 0x00500408, true},
+		// mov [0x0600], bx with the breakpoint disabled
+		{"TestDisabled", []uint8{0x89, 0x1e, 0x00, 0x06}, 0x00500400, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x0602
+			cpu.GetRegisters().BX = 0xbeef
+			mem.WriteAddr16(0x01*4, 0x0500)
+			mem.WriteAddr16(0x01*4+2, 0x0000)
+
+			cpu.GetRegisters().DR1 = 0x0600
+			cpu.GetRegisters().DR7 = tt.dr7
+
+			cpu.Step()
+
+			next := uint16(0x100 + len(tt.instruction))
+			if !tt.expectFire {
+				if cpu.GetIP() != next {
+					t.Errorf("Expected no #DB, IP [%#04x] but got [%#04x]", next, cpu.GetIP())
+				}
+				if cpu.GetRegisters().DR6&0xf != 0 {
+					t.Errorf("Expected no B bits in DR6 but got [%#08x]", cpu.GetRegisters().DR6)
+				}
+				return
+			}
+
+			if cpu.GetIP() != 0x0500 {
+				t.Fatalf("Expected the #DB handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+			}
+			if cpu.GetRegisters().DR6&0xf != 0x2 {
+				t.Errorf("Expected B1 set in DR6 but got [%#08x]", cpu.GetRegisters().DR6)
+			}
+			if ret, _ := mem.ReadAddr16(uint32(cpu.GetRegisters().SP)); ret != next {
+				t.Errorf("Expected the trap to return past the instruction [%#04x] but got [%#04x]", next, ret)
+			}
+		})
+	}
+}
+
+func Test_DataBreakpointNotHitByDelivery(t *testing.T) {
+
+	// int3 pushes its return frame over the watched word, then the handler runs a nop
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xcc})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x0606
+	mem.WriteAddr16(0x03*4, 0x0500)
+	mem.WriteAddr16(0x03*4+2, 0x0000)
+	mem.WriteAddr16(0x01*4, 0x0700)
+	mem.WriteAddr16(0x01*4+2, 0x0000)
+	mem.WriteAddr8(0x0500, 0x90)
+
+	cpu.GetRegisters().DR1 = 0x0600
+	cpu.GetRegisters().DR7 = 0x00500408
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0501 {
+		t.Errorf("Expected the breakpoint handler to run undisturbed, IP [%#04x] but got [%#04x]", 0x0501, cpu.GetIP())
+	}
+}
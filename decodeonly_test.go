@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"reflect"
+	"testing"
+)
+
+func Test_DecodeOnlyLength(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		instruction    []uint8
+		expectedLength uint32
+	}{
+		{"TestNoOperands", []uint8{0xfa}, 1},
+		{"TestImm16", []uint8{0xb8, 0x34, 0x12}, 3},
+		{"TestImm32WithOperandOverride", []uint8{0x66, 0xb8, 0x78, 0x56, 0x34, 0x12}, 6},
+		{"TestModRmRegister", []uint8{0x89, 0xd8}, 2},
+		{"TestModRmDisp16", []uint8{0x8b, 0x1e, 0x00, 0x06}, 4},
+		{"TestModRmDisp8Imm8", []uint8{0x83, 0x47, 0x04, 0x01}, 4},
+		{"TestModRmDisp16Imm16", []uint8{0x81, 0x06, 0x00, 0x06, 0x34, 0x12}, 6},
+		{"TestSibWithAddressOverride", []uint8{0x67, 0x8b, 0x04, 0x24}, 4},
+		{"TestSibDisp32WithAddressOverride", []uint8{0x67, 0x8b, 0x04, 0x25, 0x00, 0x06, 0x00, 0x00}, 8},
+		{"TestMemoryOffset", []uint8{0xa1, 0x00, 0x06}, 3},
+		{"TestFarPointer", []uint8{0xea, 0x00, 0x01, 0x00, 0xf0}, 5},
+		{"TestTestImmediate", []uint8{0xf7, 0xc3, 0x34, 0x12}, 4},
+		{"TestNotHasNoImmediate", []uint8{0xf7, 0xd3}, 2},
+		{"TestTwoByte", []uint8{0x0f, 0xb1, 0x0e, 0x00, 0x06}, 5},
+		{"TestHintNop", []uint8{0x67, 0x0f, 0x1f, 0x44, 0x00, 0x00}, 6},
+		{"TestCmpxchg8b", []uint8{0x0f, 0xc7, 0x4f, 0x08}, 4},
+		{"TestSegmentOverride", []uint8{0x26, 0x8b, 0x1e, 0x00, 0x06}, 5},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			decoded, err := cpu.DecodeOnly(0x100)
+			if err != nil {
+				t.Fatalf("Expected the instruction to decode but got %s", err)
+			}
+			if decoded.Length != tt.expectedLength {
+				t.Errorf("Expected length %d but got %d", tt.expectedLength, decoded.Length)
+			}
+			if cpu.GetIP() != 0x100 {
+				t.Errorf("Expected IP to be left at [%#04x] but got [%#04x]", 0x100, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_DecodeOnlyRejects(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+	}{
+		{"TestUnrecognisedOpcode", []uint8{0x0f, 0xff}},
+		{"TestLockOnRegisterDestination", []uint8{0xf0, 0x01, 0xd8}},
+		{"TestTooLong", []uint8{0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x90}},
+		{"TestLongImmediate", []uint8{0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0xb8, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testPc.GetPrimaryCpu().DecodeOnly(0x100); err == nil {
+				t.Errorf("Expected % x to be rejected", tt.instruction)
+			}
+		})
+	}
+}
+
+func Test_DecodeOnlyMatchesExecution(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+	}{
+		{"TestMovImm", []uint8{0xb8, 0x34, 0x12}},
+		{"TestMovDisp16", []uint8{0x8b, 0x1e, 0x00, 0x06}},
+		{"TestAddDisp8Imm8", []uint8{0x83, 0x47, 0x04, 0x01}},
+		{"TestAddDisp16Imm16", []uint8{0x81, 0x06, 0x00, 0x06, 0x34, 0x12}},
+		{"TestCmpAx", []uint8{0x3d, 0x34, 0x12}},
+		{"TestXchg", []uint8{0x87, 0xcb}},
+		{"TestPushImm32", []uint8{0x66, 0x68, 0x21, 0x43, 0x65, 0x87}},
+		{"TestXadd", []uint8{0x0f, 0xc1, 0x0e, 0x00, 0x06}},
+		{"TestBtsImm", []uint8{0x0f, 0xba, 0x2e, 0x00, 0x06, 0x64}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(intel8086.CpuFeatures{CompareExchange: true})
+			cpu.GetRegisters().SP = 0x2000
+
+			decoded, err := cpu.DecodeOnly(0x100)
+			if err != nil {
+				t.Fatalf("Expected the instruction to decode but got %s", err)
+			}
+
+			cpu.Step()
+
+			if executed := uint32(cpu.GetIP()) - 0x100; executed != decoded.Length {
+				t.Errorf("Expected the handler to consume %d bytes but it consumed %d", decoded.Length, executed)
+			}
+		})
+	}
+}
+
+func Test_DecodeOnlyMatchesEveryHandler(t *testing.T) {
+
+	features := intel8086.CpuFeatures{TimeStampCounter: true, ConditionalMove: true, ModelSpecificRegisters: true, CacheControl: true,
+		CompareExchange: true, CompareExchange8Byte: true, SpinLoopHint: true, ByteSwap: true, FloatingPoint: true, HintNop: true}
+
+	// each form plain, with a 32 bit operand size and with a 32 bit address size
+	for _, sizePrefix := range [][]uint8{{}, {0x66}, {0x67}} {
+		for _, twoByte := range []bool{false, true} {
+			for opcode := 0; opcode < 256; opcode++ {
+				prefix := append(append([]uint8{}, sizePrefix...), uint8(opcode))
+				if twoByte {
+					prefix = append(append([]uint8{}, sizePrefix...), 0x0f, uint8(opcode))
+				}
+
+				// immediates and displacements are left zero, so relative transfers land on the next instruction
+				plain := append(append([]uint8{}, prefix...), make([]uint8, 8)...)
+				decoded, err := newTestPcWithInstructions(0x100, plain).GetPrimaryCpu().DecodeOnly(0x100)
+
+				var forms [][]uint8
+				switch {
+				case err == nil && len(decoded.Prefixes) > len(sizePrefix):
+					forms = append(forms, append(append([]uint8{}, sizePrefix...), uint8(opcode), 0x90))
+				case err == nil && !decoded.HasModRm:
+					forms = append(forms, plain)
+				default:
+					for reg := 0; reg < 8; reg++ {
+						// the register form uses cx, the memory form [0x0600], as disp32 with a 32 bit address size
+						memory := []uint8{uint8(0x06 | reg<<3), 0x00, 0x06}
+						if len(sizePrefix) > 0 && sizePrefix[0] == 0x67 {
+							memory = []uint8{uint8(0x05 | reg<<3), 0x00, 0x06, 0x00, 0x00}
+						}
+						forms = append(forms, append(append(append([]uint8{}, prefix...), uint8(0xc1|reg<<3)), make([]uint8, 8)...))
+						forms = append(forms, append(append(append([]uint8{}, prefix...), memory...), make([]uint8, 8)...))
+					}
+				}
+
+				for _, form := range forms {
+					runDecodedForm(t, form, features)
+				}
+			}
+		}
+	}
+}
+
+// Executes an instruction which decodes, checking it runs on to the next instruction the decoder found.
+// Every operand a transfer of control can take its target from points at that next instruction.
+func runDecodedForm(t *testing.T, code []uint8, features intel8086.CpuFeatures) {
+	testPc := newTestPcWithInstructions(0x100, code)
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.SetFeatures(features)
+
+	decoded, err := cpu.DecodeOnly(0x100)
+	if err != nil {
+		return
+	}
+
+	t.Run(fmt.Sprintf("% x", code[:decoded.Length]), func(t *testing.T) {
+		next := uint16(0x100 + decoded.Length)
+		prefixes := uint32(len(decoded.Prefixes))
+
+		// a 32 bit operand size takes 32 bit offsets and pops dwords
+		wide := false
+		for _, prefix := range decoded.Prefixes {
+			wide = wide != (prefix == 0x66)
+		}
+		slot := uint32(2)
+		if wide {
+			slot = 4
+		}
+
+		if !decoded.TwoByte && (decoded.Opcode == 0x9a || decoded.Opcode == 0xea) {
+			// far call and jmp take ptr16:16 or ptr16:32 from the instruction
+			mem.WriteAddr16(0x101+prefixes, next)
+		}
+
+		// near and far returns, and iret
+		cpu.GetRegisters().SP = 0x2000
+		mem.WriteAddr16(0x2000, next)
+		mem.WriteAddr16(0x2000+slot, 0)
+		mem.WriteAddr16(0x2000+2*slot, 0x0002)
+
+		// indirect calls and jumps through cx or [0x0600], and interrupt 0
+		cpu.GetRegisters().CX = next
+		mem.WriteAddr16(0x0600, next)
+		mem.WriteAddr16(0x0600+slot, 0)
+		mem.WriteAddr16(0x0000, next)
+		mem.WriteAddr16(0x0002, 0)
+
+		raised := false
+		cpu.SetExceptionHook(func(e intel8086.Exception) bool {
+			raised = true
+			return true
+		})
+
+		output := &bytes.Buffer{}
+		cpu.GetLogger().SetOutput(output)
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("Expected % x to execute but it panicked with %v\n%s", code[:decoded.Length], r, output.String())
+			}
+		}()
+
+		cpu.Step()
+
+		if raised {
+			// not a valid form, such as a memory operand where only a register is allowed
+			return
+		}
+		if cpu.GetCS() != 0 || cpu.GetIP() != next {
+			t.Errorf("Expected % x to run on to [0000:%#04x] as it decoded but got [%#04x:%#04x]", code[:decoded.Length], next, cpu.GetCS(), cpu.GetIP())
+		}
+	})
+}
+
+func FuzzDecodeOnly(f *testing.F) {
+
+	f.Add([]byte{0x90})
+	f.Add([]byte{0x66, 0xb8, 0x78, 0x56, 0x34, 0x12})
+	f.Add([]byte{0x67, 0x8b, 0x04, 0x25, 0x00, 0x06, 0x00, 0x00})
+	f.Add([]byte{0xf0, 0x0f, 0xb1, 0x0e, 0x00, 0x06})
+	f.Add([]byte{0x26, 0xf7, 0x06, 0x00, 0x06, 0x34, 0x12})
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.SetCS(0x0)
+	cpu.SetIP(0x100)
+
+	// decodes code at 0x100, with the rest of the window filled with fill
+	decode := func(code []byte, fill uint8) (intel8086.DecodedInstruction, error) {
+		for i := uint32(0); i < intel8086.MaxInstructionLength; i++ {
+			b := fill
+			if int(i) < len(code) {
+				b = code[i]
+			}
+			mem.WriteAddr8(0x100+i, b)
+		}
+		return cpu.DecodeOnly(0x100)
+	}
+
+	f.Fuzz(func(t *testing.T, code []byte) {
+		if len(code) > intel8086.MaxInstructionLength {
+			code = code[:intel8086.MaxInstructionLength]
+		}
+
+		registers := *cpu.GetRegisters()
+
+		decoded, err := decode(code, 0x00)
+
+		if !reflect.DeepEqual(*cpu.GetRegisters(), registers) {
+			t.Fatalf("Expected decoding % x to leave the registers alone", code)
+		}
+		if err != nil {
+			return
+		}
+
+		if decoded.Length < 1 || decoded.Length > intel8086.MaxInstructionLength {
+			t.Fatalf("Decoded % x to an impossible length %d", code, decoded.Length)
+		}
+
+		parts := uint32(len(decoded.Prefixes)) + 1 + decoded.Displacement + decoded.Immediate
+		if decoded.TwoByte {
+			parts++
+		}
+		if decoded.HasModRm {
+			parts++
+		}
+		if decoded.HasSib {
+			parts++
+		}
+		if parts != decoded.Length {
+			t.Fatalf("Decoded % x to length %d but its parts add up to %d", code, decoded.Length, parts)
+		}
+
+		if decoded.Length > uint32(len(code)) {
+			// the instruction ran into the fill, a different fill may change it
+			return
+		}
+
+		// the bytes after the instruction can't change how it decodes
+		again, err := decode(code, 0xff)
+		if err != nil || again.Length != decoded.Length {
+			t.Fatalf("Decoded % x to length %d but got %d (%v) with different trailing bytes", code, decoded.Length, again.Length, err)
+		}
+	})
+}
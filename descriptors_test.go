@@ -0,0 +1,291 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// builds a pc with a gdt at 0x1000 loaded from the given 8 byte entries (entry 0 is the null descriptor),
+// executes lgdt and switches to protected mode, leaving IP at the first of the instructions
+func newTestPcWithGdt(entries [][]uint8, instructions []uint8) *pc.PersonalComputer {
+	// lgdt [0x0800]
+	testPc := newTestPcWithInstructions(0x100, append([]uint8{0x0f, 0x01, 0x16, 0x00, 0x08}, instructions...))
+	mem := testPc.GetMemoryController()
+
+	limit := uint16((len(entries)+1)*8 - 1)
+	mem.WriteAddr16(0x0800, limit)
+	mem.WriteAddr16(0x0802, 0x1000)
+	mem.WriteAddr16(0x0804, 0x0000)
+
+	for i, entry := range entries {
+		for j, b := range entry {
+			mem.WriteAddr8(0x1008+uint32(i*8+j), b)
+		}
+	}
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.Step() // lgdt
+	cpu.EnterMode(common.PROTECTED_MODE)
+
+	return testPc
+}
+
+func Test_LarLslDescriptorQueries(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data, base 0, limit 0x00003 with 4k granularity
+		{0x03, 0x00, 0x00, 0x00, 0x00, 0x92, 0x80, 0x00},
+		// 0x10: code, base 0, limit 0x01234 byte granularity
+		{0x34, 0x12, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x18: ring 0 data accessed through rpl 3
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x20: interrupt gate, not visible to lar/lsl
+		{0x00, 0x00, 0x10, 0x00, 0x00, 0x8e, 0x00, 0x00},
+	}
+
+	tests := []struct {
+		name        string
+		selector    uint16
+		expectedZF  bool
+		expectedLsl uint16
+		expectedLar uint16
+	}{
+		{"TestGranularDataSegment", 0x0008, true, 0x3fff, 0x9200},
+		{"TestCodeSegment", 0x0010, true, 0x1234, 0x9a00},
+		{"TestNullSelector", 0x0000, false, 0xaaaa, 0xaaaa},
+		{"TestSelectorBeyondGdtLimit", 0x0028, false, 0xaaaa, 0xaaaa},
+		{"TestRplAboveDpl", 0x001b, false, 0xaaaa, 0xaaaa},
+		{"TestGateDescriptor", 0x0020, false, 0xaaaa, 0xaaaa},
+	}
+	for _, tt := range tests {
+
+		// mov bx, selector; lsl ax, bx; lar cx, bx
+		testPc := newTestPcWithGdt(gdt, []uint8{0xbb, uint8(tt.selector), uint8(tt.selector >> 8), 0x0f, 0x03, 0xc3, 0x0f, 0x02, 0xcb})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().AX = 0xaaaa
+			cpu.GetRegisters().CX = 0xaaaa
+
+			cpu.Step() // mov bx
+			cpu.Step() // lsl
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected lsl ZF %v but got %v", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+
+			cpu.Step() // lar
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected lar ZF %v but got %v", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+
+			if cpu.GetRegisters().AX != tt.expectedLsl {
+				t.Errorf("Expected lsl result [%#04x] but got [%#04x]", tt.expectedLsl, cpu.GetRegisters().AX)
+			}
+			if cpu.GetRegisters().CX != tt.expectedLar {
+				t.Errorf("Expected lar result [%#04x] but got [%#04x]", tt.expectedLar, cpu.GetRegisters().CX)
+			}
+			if cpu.GetIP() != 0x010e {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x010e, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_LldtLdtSelectors(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: LDT, base 0x2000, limit 0x0f
+		{0x0f, 0x00, 0x00, 0x20, 0x00, 0x82, 0x00, 0x00},
+	}
+
+	// mov ax, 0x08; lldt ax; sldt bx; mov ax, 0x0c; mov ds, ax; mov ax, 0x14; mov es, ax
+	testPc := newTestPcWithGdt(gdt, []uint8{
+		0xb8, 0x08, 0x00, 0x0f, 0x00, 0xd0, 0x0f, 0x00, 0xc3,
+		0xb8, 0x0c, 0x00, 0x8e, 0xd8,
+		0xb8, 0x14, 0x00, 0x8e, 0xc0,
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	// LDT entry 1: data, base 0x00040000, limit 0xffff
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x2008: {0xff, 0xff, 0x00, 0x00, 0x04, 0x92, 0x00, 0x00},
+	})
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().LDTR.Selector() != 0x0008 || cpu.GetRegisters().LDTR.DescriptorBase() != 0x2000 {
+		t.Errorf("Expected LDTR [%#04x] base [%#08x] but got [%#04x] base [%#08x]", 0x0008, 0x2000, cpu.GetRegisters().LDTR.Selector(), cpu.GetRegisters().LDTR.DescriptorBase())
+	}
+	if cpu.GetRegisters().BX != 0x0008 {
+		t.Errorf("Expected sldt to store [%#04x] but got [%#04x]", 0x0008, cpu.GetRegisters().BX)
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetRegisters().DS.Selector() != 0x000c || cpu.GetRegisters().DS.DescriptorBase() != 0x00040000 {
+		t.Errorf("Expected DS [%#04x] base [%#08x] from the LDT but got [%#04x] base [%#08x]", 0x000c, 0x00040000, cpu.GetRegisters().DS.Selector(), cpu.GetRegisters().DS.DescriptorBase())
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	// 0x14 is beyond the LDT limit
+	if cpu.GetRegisters().ES.Selector() != 0x0000 {
+		t.Errorf("Expected ES load beyond the LDT limit to fail but got [%#04x]", cpu.GetRegisters().ES.Selector())
+	}
+}
+
+func Test_VerrVerw(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: LDT
+		{0x0f, 0x00, 0x00, 0x20, 0x00, 0x82, 0x00, 0x00},
+		// 0x10: read/write data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x18: execute only code
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x98, 0x00, 0x00},
+		// 0x20: readable code
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x28: read only data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x90, 0x00, 0x00},
+	}
+
+	tests := []struct {
+		name         string
+		selector     uint16
+		expectedVerr bool
+		expectedVerw bool
+	}{
+		{"TestReadWriteData", 0x0010, true, true},
+		{"TestExecuteOnlyCode", 0x0018, false, false},
+		{"TestReadableCode", 0x0020, true, false},
+		{"TestReadOnlyData", 0x0028, true, false},
+		{"TestSystemDescriptor", 0x0008, false, false},
+		{"TestNullSelector", 0x0000, false, false},
+	}
+	for _, tt := range tests {
+
+		// mov bx, selector; verr bx; verw bx
+		testPc := newTestPcWithGdt(gdt, []uint8{0xbb, uint8(tt.selector), uint8(tt.selector >> 8), 0x0f, 0x00, 0xe3, 0x0f, 0x00, 0xeb})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			cpu.Step()
+			cpu.Step()
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedVerr {
+				t.Errorf("Expected verr ZF %v but got %v", tt.expectedVerr, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+
+			cpu.Step()
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedVerw {
+				t.Errorf("Expected verw ZF %v but got %v", tt.expectedVerw, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+		})
+	}
+}
+
+func Test_Arpl(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		instruction      []uint8
+		expectedSelector uint16
+		expectedZF       bool
+	}{
+		// mov ax, 0x0008; mov bx, 0x0003; arpl ax, bx
+		{"TestArplAdjusts", []uint8{0xb8, 0x08, 0x00, 0xbb, 0x03, 0x00, 0x63, 0xd8}, 0x000b, true},
+		// mov ax, 0x000a; mov bx, 0x0001; arpl ax, bx
+		{"TestArplLeavesHigherRpl", []uint8{0xb8, 0x0a, 0x00, 0xbb, 0x01, 0x00, 0x63, 0xd8}, 0x000a, false},
+		// mov ax, 0x0009; mov bx, 0x0001; arpl ax, bx with equal RPLs
+		{"TestArplEqualRpl", []uint8{0xb8, 0x09, 0x00, 0xbb, 0x01, 0x00, 0x63, 0xd8}, 0x0009, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithGdt([][]uint8{}, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFlag(intel8086.ZeroFlag, !tt.expectedZF)
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().AX != tt.expectedSelector {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedSelector, cpu.GetRegisters().AX)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetIP() != 0x010d {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x010d, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_ArplMemoryOperand(t *testing.T) {
+
+	// mov bx, 0x0002; arpl [0x0600], bx
+	testPc := newTestPcWithGdt([][]uint8{}, []uint8{0xbb, 0x02, 0x00, 0x63, 0x1e, 0x00, 0x06})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x0600, 0x0010)
+
+	cpu.Step()
+	cpu.Step()
+
+	if value, _ := mem.ReadAddr16(0x0600); value != 0x0012 {
+		t.Errorf("Expected the selector in memory to be adjusted to [%#04x] but got [%#04x]", 0x0012, value)
+	}
+	if !cpu.GetFlag(intel8086.ZeroFlag) {
+		t.Errorf("Expected ZF to be set after adjusting the RPL")
+	}
+}
+
+func Test_SgdtSidt(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expected    []uint8
+	}{
+		// lgdt [0x0800]; sgdt [0x0900]
+		{"TestSgdt", []uint8{0x0f, 0x01, 0x16, 0x00, 0x08, 0x0f, 0x01, 0x06, 0x00, 0x09}, []uint8{0xff, 0x00, 0x78, 0x56, 0x34, 0x00}},
+		// lgdt [0x0800]; sgdt [0x0900] with a 32 bit operand size
+		{"TestSgdt32", []uint8{0x66, 0x0f, 0x01, 0x16, 0x00, 0x08, 0x66, 0x0f, 0x01, 0x06, 0x00, 0x09}, []uint8{0xff, 0x00, 0x78, 0x56, 0x34, 0x12}},
+		// lidt [0x0800]; sidt [0x0900] with a 32 bit operand size
+		{"TestSidt32", []uint8{0x66, 0x0f, 0x01, 0x1e, 0x00, 0x08, 0x66, 0x0f, 0x01, 0x0e, 0x00, 0x09}, []uint8{0xff, 0x00, 0x78, 0x56, 0x34, 0x12}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x0800, 0x00ff)
+			mem.WriteAddr32(0x0802, 0x12345678)
+			mem.WriteAddr32(0x0900, 0xaaaaaaaa)
+			mem.WriteAddr16(0x0904, 0xaaaa)
+
+			cpu.Step()
+			cpu.Step()
+
+			for i, b := range tt.expected {
+				if stored, _ := mem.ReadAddr8(0x0900 + uint32(i)); stored != b {
+					t.Errorf("Expected byte %d of the stored table register to be [%#02x] but got [%#02x]", i, b, stored)
+				}
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
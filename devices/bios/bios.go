@@ -0,0 +1,189 @@
+package bios
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/disk"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/devices/memmap"
+	"github.com/andrewjc/threeatesix/devices/vga"
+)
+
+/*
+	BIOS services layer
+	Host side implementation of BIOS functionality that runs alongside (or instead of) a bios image
+*/
+
+const (
+	OPTION_ROM_SCAN_START = 0xC0000
+	OPTION_ROM_SCAN_END   = 0xF0000 // exclusive
+	OPTION_ROM_SCAN_STEP  = 0x800   // option roms start on a 2KB boundary
+	OPTION_ROM_BLOCK_SIZE = 512     // rom size byte is in 512 byte blocks
+	OPTION_ROM_INIT_ENTRY = 0x0003
+
+	// upper bound on instructions executed by a single option rom init entry
+	OPTION_ROM_INIT_MAX_STEPS = 1000000
+
+	BOOT_SECTOR_LOAD_ADDRESS   = 0x7C00
+	BOOT_SECTOR_SIZE           = 512
+	BOOT_SIGNATURE_OFFSET      = 510
+	BOOT_DRIVE_FIRST_FLOPPY    = 0x00
+	BOOT_DRIVE_FIRST_HARD_DISK = 0x80
+)
+
+type BiosServices struct {
+	bus   *bus.Bus
+	busId uint32
+
+	cpu    *intel8086.CpuCore
+	memory *memmap.MemoryAccessController
+	video  *vga.Vga
+
+	initializedOptionRoms []uint16 // segments of roms whose init entry has been called
+
+	disks map[uint8]*disk.Disk // by drive number, see disks.go
+}
+
+func NewBiosServices(cpu *intel8086.CpuCore, memory *memmap.MemoryAccessController, video *vga.Vga) *BiosServices {
+	services := &BiosServices{cpu: cpu, memory: memory, video: video, disks: make(map[uint8]*disk.Disk)}
+	services.installInt10()
+	services.installInt13()
+	services.installInt15()
+	return services
+}
+
+func (services *BiosServices) SetDeviceBusId(id uint32) {
+	services.busId = id
+}
+
+func (services *BiosServices) OnReceiveMessage(message bus.BusMessage) {
+
+}
+
+func (services *BiosServices) GetBus() *bus.Bus {
+	return services.bus
+}
+
+func (services *BiosServices) SetBus(bus *bus.Bus) {
+	services.bus = bus
+}
+
+// Runs the power on self test steps handled by the services layer
+func (services *BiosServices) Post() error {
+	return services.InitOptionRoms()
+}
+
+// Copies an option rom image into the expansion rom area at segment:0000
+func (services *BiosServices) RegisterOptionRom(segment uint16, image []byte) error {
+	addr := uint32(segment) << 4
+
+	if addr < OPTION_ROM_SCAN_START || addr%OPTION_ROM_SCAN_STEP != 0 {
+		return fmt.Errorf("option rom segment %#04x is not on a 2KB boundary in the expansion rom area", segment)
+	}
+
+	if addr+uint32(len(image)) > OPTION_ROM_SCAN_END {
+		return fmt.Errorf("option rom at segment %#04x does not fit in the expansion rom area", segment)
+	}
+
+	if len(image) < 3 || image[0] != 0x55 || image[1] != 0xAA {
+		return errors.New("option rom image is missing the 0x55AA signature")
+	}
+
+	for i, b := range image {
+		err := services.memory.WriteAddr8(addr+uint32(i), b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Scans the expansion rom area for option roms with a valid signature and checksum, returns their segments
+func (services *BiosServices) ScanOptionRoms() []uint16 {
+	var segments []uint16
+
+	for addr := uint32(OPTION_ROM_SCAN_START); addr < OPTION_ROM_SCAN_END; addr += OPTION_ROM_SCAN_STEP {
+		header := services.memory.PeekNextBytes(addr, 3)
+		if header[0] != 0x55 || header[1] != 0xAA {
+			continue
+		}
+
+		length := uint32(header[2]) * OPTION_ROM_BLOCK_SIZE
+		if length == 0 || addr+length > OPTION_ROM_SCAN_END {
+			common.DefaultLogger.Warnf("Option rom at %#05x has an invalid length", addr)
+			continue
+		}
+
+		var checksum uint8
+		for _, b := range services.memory.PeekNextBytes(addr, length) {
+			checksum += b
+		}
+		if checksum != 0 {
+			common.DefaultLogger.Warnf("Option rom at %#05x failed checksum", addr)
+			continue
+		}
+
+		segments = append(segments, uint16(addr>>4))
+
+		// skip over the rest of this rom
+		addr += (length - 1) / OPTION_ROM_SCAN_STEP * OPTION_ROM_SCAN_STEP
+	}
+
+	return segments
+}
+
+// Calls the init entry (segment:0003) of every option rom found by ScanOptionRoms
+func (services *BiosServices) InitOptionRoms() error {
+	for _, segment := range services.ScanOptionRoms() {
+		common.DefaultLogger.Infof("Initializing option rom at %04x:%04x", segment, OPTION_ROM_INIT_ENTRY)
+
+		err := services.cpu.CallFar(segment, OPTION_ROM_INIT_ENTRY, OPTION_ROM_INIT_MAX_STEPS)
+		if err != nil {
+			return err
+		}
+
+		services.initializedOptionRoms = append(services.initializedOptionRoms, segment)
+	}
+
+	return nil
+}
+
+// Segments of the option roms that have been initialized
+func (services *BiosServices) GetInitializedOptionRoms() []uint16 {
+	return services.initializedOptionRoms
+}
+
+// Loads the first sector of a disk image to 0000:7C00 and points the cpu at it with the boot drive in DL.
+// The entry point is also set as the reset vector so that it survives the cpu being reset.
+func (services *BiosServices) LoadBootSector(image []byte, drive uint8) error {
+	if len(image) < BOOT_SECTOR_SIZE {
+		return fmt.Errorf("boot image is %d bytes, shorter than a %d byte sector", len(image), BOOT_SECTOR_SIZE)
+	}
+
+	if image[BOOT_SIGNATURE_OFFSET] != 0x55 || image[BOOT_SIGNATURE_OFFSET+1] != 0xAA {
+		return errors.New("boot sector is missing the 0x55AA signature")
+	}
+
+	for i, b := range image[:BOOT_SECTOR_SIZE] {
+		err := services.memory.WriteAddr8(BOOT_SECTOR_LOAD_ADDRESS+uint32(i), b)
+		if err != nil {
+			return err
+		}
+	}
+
+	seedBootDrive := func(registers *intel8086.CpuRegisters) {
+		registers.DL = drive
+	}
+
+	services.cpu.SetResetConfig(&intel8086.ResetConfig{CS: 0x0000, IP: BOOT_SECTOR_LOAD_ADDRESS, SeedRegisters: seedBootDrive})
+	services.cpu.SetCS(0x0000)
+	services.cpu.SetIP(BOOT_SECTOR_LOAD_ADDRESS)
+	seedBootDrive(services.cpu.GetRegisters())
+
+	common.DefaultLogger.Infof("Loaded boot sector for drive %#02x at 0000:%04x", drive, BOOT_SECTOR_LOAD_ADDRESS)
+
+	return nil
+}
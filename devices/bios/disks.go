@@ -0,0 +1,25 @@
+package bios
+
+import (
+	"github.com/andrewjc/threeatesix/devices/disk"
+)
+
+/*
+	Attached disks
+	The drives the disk services can reach, by bios drive number: 00h-7Fh for floppies, 80h and up for hard disks.
+	Each disk carries its own geometry, used to translate the cylinder, head and sector the cpu asks for.
+*/
+
+// Attaches a disk as drive, replacing any disk already there. nil detaches it.
+func (services *BiosServices) AttachDisk(drive uint8, attached *disk.Disk) {
+	if attached == nil {
+		delete(services.disks, drive)
+		return
+	}
+	services.disks[drive] = attached
+}
+
+// The disk attached as drive, nil if there isn't one
+func (services *BiosServices) GetDisk(drive uint8) *disk.Disk {
+	return services.disks[drive]
+}
@@ -0,0 +1,37 @@
+package bios
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+)
+
+/*
+	INT 10h video services
+	Only the teletype call, AH=0Eh with the character in AL, which writes at the adapter's text cursor and scrolls
+	the screen when it runs off the bottom. The page in BH and the colour in BL only mean anything in graphics
+	modes and are ignored. As with INT 15h the call is read from AX. Any other function is left to the IVT handler.
+*/
+
+const (
+	INT10_TELETYPE = 0x0E // in AH
+)
+
+func (services *BiosServices) installInt10() {
+	services.cpu.SetInterruptService(0x10, services.int10)
+}
+
+func (services *BiosServices) int10(registers *intel8086.CpuRegisters) bool {
+	if services.video == nil {
+		return false
+	}
+
+	switch registers.AX >> 8 {
+	case INT10_TELETYPE:
+		err := services.video.Teletype(uint8(registers.AX))
+		if err != nil {
+			common.DefaultLogger.Warnf("INT 10h teletype failed: %s", err.Error())
+		}
+		return true
+	}
+	return false
+}
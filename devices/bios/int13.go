@@ -0,0 +1,170 @@
+package bios
+
+import (
+	"github.com/andrewjc/threeatesix/devices/disk"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+)
+
+/*
+	INT 13h disk services
+	The extended calls loaders use to reach sectors by logical block address rather than cylinder, head and sector:
+	AH=41h checks the extensions are present, AH=42h reads and AH=43h writes. The drive is in DL and reads and
+	writes take a disk address packet at DS:SI:
+
+		0x00 byte  packet size, 10h or more
+		0x01 byte  reserved, 0
+		0x02 word  number of sectors, set to the number moved on return
+		0x04 word  buffer offset
+		0x06 word  buffer segment
+		0x08 qword first logical block address
+
+	Sectors go between the buffer and the disk attached as the drive, see disks.go. Success clears CF and AH,
+	failure sets CF with the status in AH. A transfer is all or nothing, the count in the packet is 0 when it
+	fails.
+*/
+
+const (
+	INT13_CHECK_EXTENSIONS = 0x41
+	INT13_EXTENDED_READ    = 0x42
+	INT13_EXTENDED_WRITE   = 0x43
+
+	INT13_EXTENSIONS_SIGNATURE = 0x55AA // in BX for AH=41h
+	INT13_EXTENSIONS_INSTALLED = 0xAA55 // returned in BX
+	INT13_EXTENSIONS_VERSION   = 0x30   // EDD 3.0
+	INT13_EXTENSIONS_PACKET    = 0x0001 // CX bit for the packet calls
+
+	INT13_STATUS_OK              = 0x00
+	INT13_STATUS_INVALID         = 0x01
+	INT13_STATUS_WRITE_PROTECTED = 0x03
+	INT13_STATUS_NOT_FOUND       = 0x04
+	INT13_STATUS_TIMEOUT         = 0x80 // no disk in the drive
+
+	DISK_ADDRESS_PACKET_SIZE = 0x10
+	DISK_ADDRESS_MAX_SECTORS = 127
+)
+
+type diskAddressPacket struct {
+	count   uint16
+	offset  uint16
+	segment uint16
+	lba     uint64
+}
+
+func (services *BiosServices) installInt13() {
+	services.cpu.SetInterruptService(0x13, services.int13)
+}
+
+func (services *BiosServices) int13(registers *intel8086.CpuRegisters) bool {
+	status := uint8(INT13_STATUS_OK)
+
+	switch registers.AH {
+	case INT13_CHECK_EXTENSIONS:
+		if registers.BX != INT13_EXTENSIONS_SIGNATURE || services.GetDisk(registers.DL) == nil {
+			status = INT13_STATUS_INVALID
+			break
+		}
+		registers.BX = INT13_EXTENSIONS_INSTALLED
+		registers.CX = INT13_EXTENSIONS_PACKET
+		registers.SetAH(INT13_EXTENSIONS_VERSION)
+		registers.SetFlag(intel8086.CarryFlag, false)
+		return true
+	case INT13_EXTENDED_READ, INT13_EXTENDED_WRITE:
+		status = services.int13Extended(registers, registers.AH == INT13_EXTENDED_WRITE)
+	default:
+		status = INT13_STATUS_INVALID
+	}
+
+	registers.SetAH(status)
+	registers.SetFlag(intel8086.CarryFlag, status != INT13_STATUS_OK)
+	return true
+}
+
+// AH=42h and AH=43h: moves the sectors the packet at DS:SI describes
+func (services *BiosServices) int13Extended(registers *intel8086.CpuRegisters, write bool) uint8 {
+	packetAddr := uint32(registers.DS.Selector())<<4 + uint32(registers.SI)
+
+	packet, ok := services.readDiskAddressPacket(packetAddr)
+	if !ok {
+		return INT13_STATUS_INVALID
+	}
+
+	drive := services.GetDisk(registers.DL)
+	if drive == nil {
+		return INT13_STATUS_TIMEOUT
+	}
+
+	// the count reads 0 unless the whole transfer succeeds
+	if services.memory.WriteAddr16(packetAddr+2, 0) != nil {
+		return INT13_STATUS_INVALID
+	}
+	if packet.count == 0 {
+		return INT13_STATUS_OK
+	}
+	if packet.lba > uint64(^uint32(0)) {
+		return INT13_STATUS_NOT_FOUND
+	}
+
+	buffer := uint32(packet.segment)<<4 + uint32(packet.offset)
+	size := uint32(packet.count) * disk.SECTOR_SIZE
+
+	if write {
+		if drive.IsReadOnly() {
+			return INT13_STATUS_WRITE_PROTECTED
+		}
+		data := make([]byte, size)
+		for i := range data {
+			value, err := services.memory.ReadAddr8(buffer + uint32(i))
+			if err != nil {
+				return INT13_STATUS_INVALID
+			}
+			data[i] = value
+		}
+		if drive.WriteSectors(uint32(packet.lba), data) != nil {
+			return INT13_STATUS_NOT_FOUND
+		}
+	} else {
+		data, err := drive.ReadSectors(uint32(packet.lba), uint32(packet.count))
+		if err != nil {
+			return INT13_STATUS_NOT_FOUND
+		}
+		for i, value := range data {
+			if services.memory.WriteAddr8(buffer+uint32(i), value) != nil {
+				return INT13_STATUS_INVALID
+			}
+		}
+	}
+
+	if services.memory.WriteAddr16(packetAddr+2, packet.count) != nil {
+		return INT13_STATUS_INVALID
+	}
+	return INT13_STATUS_OK
+}
+
+func (services *BiosServices) readDiskAddressPacket(addr uint32) (diskAddressPacket, bool) {
+	var packet diskAddressPacket
+
+	size, err := services.memory.ReadAddr8(addr)
+	if err != nil || size < DISK_ADDRESS_PACKET_SIZE {
+		return packet, false
+	}
+
+	fields := []*uint16{&packet.count, &packet.offset, &packet.segment}
+	for i, field := range fields {
+		*field, err = services.memory.ReadAddr16(addr + 2 + uint32(i)*2)
+		if err != nil {
+			return packet, false
+		}
+	}
+
+	low, err := services.memory.ReadAddr32(addr + 8)
+	if err != nil {
+		return packet, false
+	}
+	high, err := services.memory.ReadAddr32(addr + 12)
+	if err != nil {
+		return packet, false
+	}
+	packet.lba = uint64(high)<<32 | uint64(low)
+
+	return packet, packet.count <= DISK_ADDRESS_MAX_SECTORS
+}
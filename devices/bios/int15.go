@@ -0,0 +1,156 @@
+package bios
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+)
+
+/*
+	INT 15h system services
+	The calls protected mode loaders make before leaving real mode: the A20 gate functions (AX=2400h-2403h) and
+	the extended memory sizes from AH=88h, AX=E801h and EAX=E820h. Sizes come from the ram installed in the
+	machine. The E820 map is fixed apart from the top of ram: conventional memory below the extended bios data
+	area, the EBDA and the bios area reserved, and everything from 1MB usable.
+
+	The call is picked from AX, or EAX for E820. A function that isn't handled returns CF set with AH=86h.
+	Success clears CF, and sets AH to 0 for the A20 functions.
+*/
+
+const (
+	INT15_A20_DISABLE = 0x2400
+	INT15_A20_ENABLE  = 0x2401
+	INT15_A20_STATUS  = 0x2402
+	INT15_A20_SUPPORT = 0x2403
+
+	INT15_EXTENDED_MEMORY_SIZE = 0x88 // in AH
+	INT15_MEMORY_SIZE_E801     = 0xE801
+	INT15_MEMORY_MAP_E820      = 0xE820
+
+	INT15_STATUS_UNSUPPORTED = 0x86
+
+	E820_SIGNATURE     = 0x534D4150 // "SMAP"
+	E820_ENTRY_SIZE    = 20
+	E820_TYPE_USABLE   = 1
+	E820_TYPE_RESERVED = 2
+
+	EXTENDED_MEMORY_START = 0x100000
+	EBDA_START            = 0x9FC00
+	BIOS_AREA_START       = 0xF0000
+)
+
+type e820Entry struct {
+	base   uint64
+	length uint64
+	kind   uint32
+}
+
+func (services *BiosServices) installInt15() {
+	services.cpu.SetInterruptService(0x15, services.int15)
+}
+
+func (services *BiosServices) int15(registers *intel8086.CpuRegisters) bool {
+	success := true
+
+	switch {
+	case registers.EAX == INT15_MEMORY_MAP_E820:
+		success = services.int15MemoryMap(registers)
+	case registers.AX == INT15_A20_DISABLE, registers.AX == INT15_A20_ENABLE:
+		services.memory.SetA20Enabled(registers.AX == INT15_A20_ENABLE)
+		registers.SetAH(0)
+	case registers.AX == INT15_A20_STATUS:
+		registers.AX = 0
+		if services.memory.IsA20Enabled() {
+			registers.AX = 1
+		}
+		registers.AL = uint8(registers.AX)
+		registers.AH = 0
+	case registers.AX == INT15_A20_SUPPORT:
+		// the gate is only reachable through these calls, not the keyboard controller or port 92h
+		registers.BX = 0
+		registers.SetAH(0)
+	case registers.AX>>8 == INT15_EXTENDED_MEMORY_SIZE:
+		extended := services.extendedMemoryKb()
+		if extended > 0xFFFF {
+			extended = 0xFFFF
+		}
+		registers.AX = uint16(extended)
+	case registers.AX == INT15_MEMORY_SIZE_E801:
+		// kb from 1MB to 16MB, and 64kb blocks above 16MB
+		below16M := services.extendedMemoryKb()
+		var above16M uint32
+		if below16M > 0x3C00 {
+			above16M = (below16M - 0x3C00) / 64
+			below16M = 0x3C00
+		}
+		if above16M > 0xFFFF {
+			above16M = 0xFFFF
+		}
+		registers.AX = uint16(below16M)
+		registers.CX = uint16(below16M)
+		registers.BX = uint16(above16M)
+		registers.DX = uint16(above16M)
+	default:
+		success = false
+	}
+
+	if !success {
+		registers.SetAH(INT15_STATUS_UNSUPPORTED)
+	}
+	registers.SetFlag(intel8086.CarryFlag, !success)
+	return true
+}
+
+// Kb of ram above 1MB
+func (services *BiosServices) extendedMemoryKb() uint32 {
+	ramSize := services.memory.GetRamSize()
+	if ramSize <= EXTENDED_MEMORY_START {
+		return 0
+	}
+	return (ramSize - EXTENDED_MEMORY_START) / 1024
+}
+
+// The address map reported by E820, in address order
+func (services *BiosServices) memoryMap() []e820Entry {
+	ramSize := uint64(services.memory.GetRamSize())
+
+	conventional := ramSize
+	if conventional > EBDA_START {
+		conventional = EBDA_START
+	}
+
+	entries := []e820Entry{
+		{0, conventional, E820_TYPE_USABLE},
+		{EBDA_START, 0xA0000 - EBDA_START, E820_TYPE_RESERVED},
+		{BIOS_AREA_START, EXTENDED_MEMORY_START - BIOS_AREA_START, E820_TYPE_RESERVED},
+	}
+	if ramSize > EXTENDED_MEMORY_START {
+		entries = append(entries, e820Entry{EXTENDED_MEMORY_START, ramSize - EXTENDED_MEMORY_START, E820_TYPE_USABLE})
+	}
+	return entries
+}
+
+// E820: writes the entry numbered EBX to ES:DI and returns the number of the next, 0 after the last
+func (services *BiosServices) int15MemoryMap(registers *intel8086.CpuRegisters) bool {
+	entries := services.memoryMap()
+
+	if registers.EDX != E820_SIGNATURE || registers.ECX < E820_ENTRY_SIZE || registers.EBX >= uint32(len(entries)) {
+		return false
+	}
+
+	entry := entries[registers.EBX]
+	addr := uint32(registers.ES.Selector())<<4 + uint32(registers.DI)
+
+	fields := []uint32{uint32(entry.base), uint32(entry.base >> 32), uint32(entry.length), uint32(entry.length >> 32), entry.kind}
+	for i, field := range fields {
+		if err := services.memory.WriteAddr32(addr+uint32(i)*4, field); err != nil {
+			return false
+		}
+	}
+
+	registers.EAX = E820_SIGNATURE
+	registers.ECX = E820_ENTRY_SIZE
+	registers.EBX++
+	if registers.EBX == uint32(len(entries)) {
+		registers.EBX = 0
+	}
+	return true
+}
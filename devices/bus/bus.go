@@ -1,26 +1,51 @@
 package bus
 import (
 	"container/list"
+	"github.com/andrewjc/threeatesix/common"
 	"github.com/google/uuid"
-	"log"
 )
 
 type DeviceType uint8
 
 type Bus struct {
 	deviceMap map[DeviceType]*list.List
+
+	registrations []*deviceRegistration // devices in the order they were attached
+
+	tracer MessageTracer
+}
+
+// Describes a device attached to the bus
+type DeviceInfo struct {
+	ModuleId     DeviceType
+	FriendlyName string
+	BusId        uint32
+}
+
+type deviceRegistration struct {
+	device BusDevice
+	info   DeviceInfo
 }
 
 type BusMessage struct {
 	Subject uint32
 	Data []byte
+	Sender uint32 // bus id of the sending device, 0 when the machine itself sends it
 }
 
+// Called as each message is delivered, with the bus ids of the sender and of the device receiving it
+type MessageTracer func(message BusMessage, fromId uint32, toId uint32)
+
 type BusDevice interface {
 	SetDeviceBusId(id uint32)
 	OnReceiveMessage(message BusMessage)
 }
 
+// Devices can optionally implement this to provide the name reported by ListDevices
+type NamedBusDevice interface {
+	FriendlyPartName() string
+}
+
 func NewDeviceBus() *Bus {
 	bus := &Bus{}
 
@@ -29,16 +54,36 @@ func NewDeviceBus() *Bus {
 	return bus
 }
 
-func (bus *Bus) RegisterDevice(device BusDevice, deviceType DeviceType) {
+// Registers a device under the given module id and returns the bus id assigned to it
+func (bus *Bus) RegisterDevice(device BusDevice, deviceType DeviceType) uint32 {
 
 	if _, ok := bus.deviceMap[deviceType]; !ok {
 		bus.deviceMap[deviceType] = list.New()
 	}
 
 	deviceList := bus.deviceMap[deviceType]
-	device.SetDeviceBusId(getRandomUUID())
+	busId := getRandomUUID()
+	device.SetDeviceBusId(busId)
 
 	deviceList.PushBack(device)
+
+	bus.registrations = append(bus.registrations, &deviceRegistration{
+		device: device,
+		info: DeviceInfo{
+			ModuleId:     deviceType,
+			FriendlyName: getFriendlyName(device, deviceType),
+			BusId:        busId,
+		},
+	})
+
+	return busId
+}
+
+func getFriendlyName(device BusDevice, deviceType DeviceType) string {
+	if named, ok := device.(NamedBusDevice); ok {
+		return named.FriendlyPartName()
+	}
+	return common.ModuleIdToString(uint8(deviceType))
 }
 
 func getRandomUUID() uint32 {
@@ -50,40 +95,85 @@ func (bus *Bus) FindDevice(deviceType DeviceType) *list.List {
 	if device, ok := bus.deviceMap[deviceType]; ok {
 		return device
 	} else {
-		log.Fatalf("Could not find device on bus of type %v", deviceType)
+		common.DefaultLogger.Fatalf("Could not find device on bus of type %v", deviceType)
 		return nil
 	}
 }
 
+// Returns every device registered with the given module id, in registration order
+func (bus *Bus) FindDevices(deviceType DeviceType) []BusDevice {
+	var devices []BusDevice
+	if deviceList, ok := bus.deviceMap[deviceType]; ok {
+		for dev := deviceList.Front(); dev != nil; dev = dev.Next() {
+			devices = append(devices, dev.Value.(BusDevice))
+		}
+	}
+	return devices
+}
+
+// Lists all devices attached to the bus, in registration order
+func (bus *Bus) ListDevices() []DeviceInfo {
+	devices := make([]DeviceInfo, 0, len(bus.registrations))
+	for _, reg := range bus.registrations {
+		devices = append(devices, reg.info)
+	}
+	return devices
+}
+
 func (bus *Bus) FindSingleDevice(deviceType DeviceType) BusDevice {
 	deviceList := bus.FindDevice(deviceType)
 	return deviceList.Front().Value.(BusDevice)
 }
 
-// Sends a message to all devices on the bus
-func (bus *Bus) SendMessage(message BusMessage) {
-	for e, _ := range bus.deviceMap {
-		devList := bus.deviceMap[e]
-		for dev := devList.Front(); dev != nil; dev = dev.Next() {
-			dev.Value.(BusDevice).OnReceiveMessage(message)
+// Traces every message delivered from now on, nil stops tracing
+func (bus *Bus) SetMessageTracer(tracer MessageTracer) {
+	bus.tracer = tracer
+}
+
+// A tracer writing each message delivered to the logger at trace level
+func LoggingMessageTracer(logger *common.Logger) MessageTracer {
+	return func(message BusMessage, fromId uint32, toId uint32) {
+		logger.Tracef("bus message %#04x from %#08x to %#08x: % x", message.Subject, fromId, toId, message.Data)
+	}
+}
+
+func (bus *Bus) deliver(device BusDevice, message BusMessage) {
+	if bus.tracer != nil {
+		bus.tracer(message, message.Sender, bus.busIdOf(device))
+	}
+	device.OnReceiveMessage(message)
+}
+
+func (bus *Bus) busIdOf(device BusDevice) uint32 {
+	for _, reg := range bus.registrations {
+		if reg.device == device {
+			return reg.info.BusId
 		}
 	}
+	return 0
+}
+
+// Sends a message to all devices on the bus, in registration order
+func (bus *Bus) SendMessage(message BusMessage) {
+	for _, reg := range bus.registrations {
+		bus.deliver(reg.device, message)
+	}
 }
 
 func (bus *Bus) SendMessageToAll(deviceType DeviceType, message BusMessage) error {
 	if devList, ok := bus.deviceMap[deviceType]; ok {
 		for dev := devList.Front(); dev != nil; dev = dev.Next() {
-			dev.Value.(BusDevice).OnReceiveMessage(message)
+			bus.deliver(dev.Value.(BusDevice), message)
 		}
 	} else {
-		log.Fatalf("Could not find device on bus of type %v", deviceType)
+		common.DefaultLogger.Fatalf("Could not find device on bus of type %v", deviceType)
 	}
 
 	return nil
 }
 
 func (bus *Bus) SendMessageSingle(deviceType DeviceType, message BusMessage) error {
-	bus.FindSingleDevice(deviceType).OnReceiveMessage(message)
+	bus.deliver(bus.FindSingleDevice(deviceType), message)
 
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,88 @@
+package bus
+
+/*
+	Test bus
+	Stands in for the machine when a device is tested on its own. It is an ordinary Bus, so the device under test
+	and any real peers it needs are registered and find each other just as they do in a pc, but every message
+	delivered is also recorded for the test to inspect. Stub devices take the place of peers which aren't wanted,
+	holding the messages they receive.
+
+	Recording uses the bus's message tracer, a tracer set through SetMessageTracer is called as well.
+*/
+
+// A message delivered on a test bus, with the bus id of the device it was delivered to
+type RecordedMessage struct {
+	Message BusMessage
+	To      uint32
+}
+
+type TestBus struct {
+	*Bus
+
+	recorded []RecordedMessage
+	tracer   MessageTracer
+}
+
+// A device which only keeps the messages it receives
+type StubDevice struct {
+	BusId    uint32
+	Received []BusMessage
+}
+
+func (device *StubDevice) SetDeviceBusId(id uint32) {
+	device.BusId = id
+}
+
+func (device *StubDevice) OnReceiveMessage(message BusMessage) {
+	device.Received = append(device.Received, message)
+}
+
+func NewTestBus() *TestBus {
+	bus := &TestBus{Bus: NewDeviceBus()}
+	bus.Bus.SetMessageTracer(bus.record)
+	return bus
+}
+
+func (bus *TestBus) record(message BusMessage, fromId uint32, toId uint32) {
+	bus.recorded = append(bus.recorded, RecordedMessage{Message: message, To: toId})
+	if bus.tracer != nil {
+		bus.tracer(message, fromId, toId)
+	}
+}
+
+// Traces every message delivered, alongside the recording
+func (bus *TestBus) SetMessageTracer(tracer MessageTracer) {
+	bus.tracer = tracer
+}
+
+// Registers a stub device under the given module id
+func (bus *TestBus) RegisterStub(deviceType DeviceType) *StubDevice {
+	stub := &StubDevice{}
+	bus.RegisterDevice(stub, deviceType)
+	return stub
+}
+
+// Delivers a message to one device as if another device had sent it to it
+func (bus *TestBus) Inject(device BusDevice, message BusMessage) {
+	bus.deliver(device, message)
+}
+
+// The messages delivered since the bus was made or last cleared, in delivery order
+func (bus *TestBus) Recorded() []RecordedMessage {
+	return bus.recorded
+}
+
+// The messages delivered with the given subject, one entry for each device it was delivered to
+func (bus *TestBus) RecordedWithSubject(subject uint32) []RecordedMessage {
+	var matching []RecordedMessage
+	for _, recorded := range bus.recorded {
+		if recorded.Message.Subject == subject {
+			matching = append(matching, recorded)
+		}
+	}
+	return matching
+}
+
+func (bus *TestBus) ClearRecorded() {
+	bus.recorded = nil
+}
@@ -0,0 +1,106 @@
+package disk
+
+import (
+	"fmt"
+)
+
+/*
+	Disk image
+	The sectors of an attached drive, held in memory, and the geometry they're addressed with. An image shorter
+	than its geometry is extended with zeroed sectors, one longer is refused. Writes change the copy held here,
+	never the file the image came from.
+*/
+
+type Disk struct {
+	image    []byte
+	geometry Geometry
+	readOnly bool
+}
+
+// Builds a disk from image addressed with geometry, the image is copied
+func NewDisk(image []byte, geometry Geometry) (*Disk, error) {
+	size := geometry.Sectors() * SECTOR_SIZE
+	if size == 0 {
+		return nil, fmt.Errorf("geometry %s has no sectors", geometry)
+	}
+	if uint32(len(image)) > size {
+		return nil, fmt.Errorf("image of %d bytes doesn't fit geometry %s of %d bytes", len(image), geometry, size)
+	}
+
+	disk := &Disk{image: make([]byte, size), geometry: geometry}
+	copy(disk.image, image)
+	return disk, nil
+}
+
+// Builds a disk from image with the geometry GeometryForImageSize picks for it
+func NewDiskFromImage(image []byte) (*Disk, error) {
+	return NewDisk(image, GeometryForImageSize(uint32(len(image))))
+}
+
+func (disk *Disk) GetGeometry() Geometry {
+	return disk.geometry
+}
+
+// Refuses writes when set, the way a write protected floppy does
+func (disk *Disk) SetReadOnly(readOnly bool) {
+	disk.readOnly = readOnly
+}
+
+func (disk *Disk) IsReadOnly() bool {
+	return disk.readOnly
+}
+
+func (disk *Disk) checkRange(lba uint32, count uint32) error {
+	if count > disk.geometry.Sectors() || lba > disk.geometry.Sectors()-count {
+		return fmt.Errorf("%d sectors from block %d run past the last of %d", count, lba, disk.geometry.Sectors())
+	}
+	return nil
+}
+
+// Reads count sectors from the logical block address
+func (disk *Disk) ReadSectors(lba uint32, count uint32) ([]byte, error) {
+	err := disk.checkRange(lba, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, count*SECTOR_SIZE)
+	copy(data, disk.image[lba*SECTOR_SIZE:])
+	return data, nil
+}
+
+// Writes whole sectors from the logical block address
+func (disk *Disk) WriteSectors(lba uint32, data []byte) error {
+	if disk.readOnly {
+		return fmt.Errorf("disk is read only")
+	}
+	if len(data)%SECTOR_SIZE != 0 {
+		return fmt.Errorf("%d bytes isn't a whole number of sectors", len(data))
+	}
+
+	err := disk.checkRange(lba, uint32(len(data)/SECTOR_SIZE))
+	if err != nil {
+		return err
+	}
+
+	copy(disk.image[lba*SECTOR_SIZE:], data)
+	return nil
+}
+
+// Reads count sectors from the cylinder, head and sector
+func (disk *Disk) ReadSectorsCHS(c, h, s uint32, count uint32) ([]byte, error) {
+	lba, err := disk.geometry.ToLBA(c, h, s)
+	if err != nil {
+		return nil, err
+	}
+	return disk.ReadSectors(lba, count)
+}
+
+// Writes whole sectors from the cylinder, head and sector
+func (disk *Disk) WriteSectorsCHS(c, h, s uint32, data []byte) error {
+	lba, err := disk.geometry.ToLBA(c, h, s)
+	if err != nil {
+		return err
+	}
+	return disk.WriteSectors(lba, data)
+}
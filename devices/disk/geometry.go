@@ -0,0 +1,101 @@
+package disk
+
+import (
+	"fmt"
+)
+
+/*
+	Disk geometry
+	A drive addressed by cylinder, head and sector has heads tracks per cylinder and sectors per track sectors on
+	each. Sectors count from 1, cylinders and heads from 0, and a logical block address counts every sector from 0
+	in cylinder, head, sector order:
+
+		lba = (c * heads + h) * spt + s - 1
+
+	Floppies and hard disks share these helpers, so a sector is found the same way whichever drive or bios call
+	asks for it.
+*/
+
+const SECTOR_SIZE = 512
+
+type Geometry struct {
+	Cylinders       uint32
+	Heads           uint32
+	SectorsPerTrack uint32
+}
+
+// The standard floppy formats
+var (
+	Floppy360K  = Geometry{Cylinders: 40, Heads: 2, SectorsPerTrack: 9}
+	Floppy720K  = Geometry{Cylinders: 80, Heads: 2, SectorsPerTrack: 9}
+	Floppy1200K = Geometry{Cylinders: 80, Heads: 2, SectorsPerTrack: 15}
+	Floppy1440K = Geometry{Cylinders: 80, Heads: 2, SectorsPerTrack: 18}
+	Floppy2880K = Geometry{Cylinders: 80, Heads: 2, SectorsPerTrack: 36}
+)
+
+// Heads and sectors per track given to a hard disk image without a geometry of its own, the usual bios
+// translation
+const (
+	HARD_DISK_HEADS             = 16
+	HARD_DISK_SECTORS_PER_TRACK = 63
+)
+
+// Converts a cylinder, head and sector to a logical block address
+func CHSToLBA(c, h, s, heads, spt uint32) (uint32, error) {
+	if s == 0 || s > spt {
+		return 0, fmt.Errorf("sector %d is outside 1-%d", s, spt)
+	}
+	if h >= heads {
+		return 0, fmt.Errorf("head %d is outside 0-%d", h, heads-1)
+	}
+	return (c*heads+h)*spt + s - 1, nil
+}
+
+// Converts a logical block address to a cylinder, head and sector
+func LBAToCHS(lba, heads, spt uint32) (c, h, s uint32) {
+	track := lba / spt
+	return track / heads, track % heads, lba%spt + 1
+}
+
+// Number of sectors on the drive
+func (geometry Geometry) Sectors() uint32 {
+	return geometry.Cylinders * geometry.Heads * geometry.SectorsPerTrack
+}
+
+// Converts a cylinder, head and sector on this drive to a logical block address
+func (geometry Geometry) ToLBA(c, h, s uint32) (uint32, error) {
+	if c >= geometry.Cylinders {
+		return 0, fmt.Errorf("cylinder %d is outside 0-%d", c, geometry.Cylinders-1)
+	}
+	return CHSToLBA(c, h, s, geometry.Heads, geometry.SectorsPerTrack)
+}
+
+// Converts a logical block address on this drive to a cylinder, head and sector
+func (geometry Geometry) ToCHS(lba uint32) (c, h, s uint32, err error) {
+	if lba >= geometry.Sectors() {
+		return 0, 0, 0, fmt.Errorf("block %d is past the last of %d", lba, geometry.Sectors())
+	}
+	c, h, s = LBAToCHS(lba, geometry.Heads, geometry.SectorsPerTrack)
+	return c, h, s, nil
+}
+
+// Picks the geometry for an image: the floppy format of exactly that size, otherwise a hard disk with the usual
+// translation and enough cylinders to hold the whole image
+func GeometryForImageSize(size uint32) Geometry {
+	for _, floppy := range []Geometry{Floppy360K, Floppy720K, Floppy1200K, Floppy1440K, Floppy2880K} {
+		if floppy.Sectors()*SECTOR_SIZE == size {
+			return floppy
+		}
+	}
+
+	cylinderSize := uint32(HARD_DISK_HEADS * HARD_DISK_SECTORS_PER_TRACK * SECTOR_SIZE)
+	return Geometry{
+		Cylinders:       (size + cylinderSize - 1) / cylinderSize,
+		Heads:           HARD_DISK_HEADS,
+		SectorsPerTrack: HARD_DISK_SECTORS_PER_TRACK,
+	}
+}
+
+func (geometry Geometry) String() string {
+	return fmt.Sprintf("%d/%d/%d", geometry.Cylinders, geometry.Heads, geometry.SectorsPerTrack)
+}
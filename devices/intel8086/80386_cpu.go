@@ -4,15 +4,16 @@ import (
 	"fmt"
 	"github.com/andrewjc/threeatesix/common"
 	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
 	"github.com/andrewjc/threeatesix/devices/io"
 	"github.com/andrewjc/threeatesix/devices/memmap"
-	"log"
 )
 
 func New80386CPU() *CpuCore {
 
 	cpuCore := &CpuCore{}
 	cpuCore.partId = common.MODULE_PRIMARY_PROCESSOR
+	cpuCore.logger = common.NewLogger(common.DefaultLogLevel)
 
 	cpuCore.registers = &CpuRegisters{}
 
@@ -70,9 +71,11 @@ func New80386CPU() *CpuCore {
 
 type CpuCore struct {
 	partId                 uint8
+	logger                 *common.Logger
 	bus                    *bus.Bus
 	memoryAccessController *memmap.MemoryAccessController
 	ioPortAccessController *io.IOPortAccessController
+	interruptController    *intel8259a.Intel8259a
 
 	registers      *CpuRegisters
 	opCodeMap      []OpCodeImpl
@@ -81,22 +84,62 @@ type CpuCore struct {
 	mode  uint8
 	flags CpuExecutionFlags
 
+	stackGuard  stackGuard  // reports stack pointer wraps, see stackguard.go
+	strictFlags strictFlags // reports reads of undefined flags, see strictflags.go
+
+	callStack           []StackFrame // shadow call stack, see callstack.go
+	callStackMismatches []CallStackMismatch
+
+	resetConfig *ResetConfig // overrides the reset vector, see reset.go
+
+	interruptServices map[uint8]InterruptService // host handlers for software interrupts, see softint.go
+
+	pendingException *Exception    // raised by the executing instruction, see exceptions.go
+	serialException  *Exception    // raised after pendingException without escalating to #DF
+	exceptionHook    ExceptionHook // host side observer of exceptions, see exceptions.go
+
+	escalatedExceptions []Exception // the pair a pending #DF was raised for, shown to the exception hook
+
+	cpuModel CpuModel    // see features.go
+	features CpuFeatures // optional instructions beyond the 386
+	cycles   uint64      // time stamp counter, see timestamp.go
+
+	fpu fpuState // x87 registers, see fpu.go
+
+	modelSpecificRegisters map[uint32]uint64 // see msr.go
+
+	prefetch prefetchQueue // see prefetch.go
+
+	debug debugState // hardware breakpoints, see debug.go
+
+	trace *instructionTrace // set by TraceToFile, see trace.go
+
+	opcodeProfile *opcodeProfile // set by EnableOpcodeProfiling, see profile.go
+
+	lastEffectiveAddress EffectiveAddress // memory operand of the instruction being executed, see modrm.go
+
+	executing      bool // an instruction handler is running
+	resetRequested bool // a reset arrived while executing, done once the instruction completes
+
+	halted           bool // set by HLT, cleared when an interrupt is dispatched
+	interruptInhibit bool // set by STI, interrupts are recognised after the next instruction
+
 	busId uint32
 
-	currentByteDecodeStart         uint32 //the start addr of the instruction being decoded (including prefixes etc)
-	currentPrefixBytes             []uint8 //current prefix bytes read for the byte being decoded in the instruction
-	currentByteAddr                uint32 //the current address of the byte being decoded in the current instruction
-	currentOpCodeBeingExecuted     uint8  //the opcode of the instruction currently being exected
-	lastExecutedInstructionPointer uint32
+	currentByteDecodeStart     uint32  //the start addr of the instruction being decoded (including prefixes etc)
+	currentPrefixBytes         []uint8 //current prefix bytes read for the byte being decoded in the instruction
+	currentByteAddr            uint32  //the current address of the byte being decoded in the current instruction
+	currentOpCodeBeingExecuted uint8   //the opcode of the instruction currently being exected
 }
 
 type CpuExecutionFlags struct {
 	OperandSizeOverrideEnabled bool //treat operand size as 32bit
 	AddressSizeOverrideEnabled bool //treat address size as 32bit
 
-	MemorySegmentOverride uint32
-	LockPrefixEnabled     bool
-	RepPrefixEnabled      bool
+	MemorySegmentOverride    uint32
+	LockPrefixEnabled        bool
+	RepPrefixEnabled         bool // 0xF3, or 0xF2 which also sets RepNotEqualPrefixEnabled
+	RepNotEqualPrefixEnabled bool
 }
 
 func (device *CpuCore) SetDeviceBusId(id uint32) {
@@ -107,27 +150,97 @@ func (device *CpuCore) OnReceiveMessage(message bus.BusMessage) {
 	switch {
 	case message.Subject == common.MESSAGE_REQUEST_CPU_MODESWITCH:
 		device.EnterMode(message.Data[0])
+	case message.Subject == common.MESSAGE_GLOBAL_RESET:
+		// a core that was never initialised has nothing to reset
+		if device.bus == nil {
+			break
+		}
+		if device.executing {
+			// raised by the instruction being executed, such as an out to the keyboard controller, which has to
+			// finish before the core can be reset
+			device.resetRequested = true
+			break
+		}
+		device.EnterMode(common.REAL_MODE)
+		device.Reset()
 	}
 }
 
+// Sets the verbosity of this core's log output. Per-instruction tracing is logged at trace level.
+func (core *CpuCore) SetLogLevel(level common.LogLevel) {
+	core.logger.SetLevel(level)
+}
+
+func (core *CpuCore) GetLogger() *common.Logger {
+	return core.logger
+}
+
 func (core *CpuCore) SetCS(addr uint16) {
 	core.registers.CS.base = addr
 }
 
+// Loads the instruction pointer with a 16 bit offset, clearing the upper half of EIP
 func (core *CpuCore) SetIP(addr uint16) {
-	core.registers.IP = addr
+	core.setEIP(uint32(addr))
 }
 
+// The low word of the instruction pointer, see GetEIP for 32 bit code segments
 func (core *CpuCore) GetIP() uint16 {
 	return core.registers.IP
 }
 
+func (core *CpuCore) SetEIP(addr uint32) {
+	core.setEIP(addr)
+}
+
+func (core *CpuCore) GetEIP() uint32 {
+	return core.registers.EIP
+}
+
 func (core *CpuCore) GetCS() uint16 {
 	return core.registers.CS.base
 }
 
 func (core *CpuCore) IncrementIP() {
-	core.registers.IP++
+	core.advanceIP(1)
+}
+
+/*
+	Instruction pointer
+	IP is the low word of EIP. A 32 bit code segment (the D bit set in its descriptor) fetches from all of EIP and
+	advances it without wrapping, a 16 bit segment only uses IP, which wraps at 64k, and keeps the upper half of EIP
+	clear. Handlers which only deal in 16 bit offsets write IP directly and the core folds it back into EIP at the
+	end of the instruction, anything that moves the full pointer goes through setEIP.
+*/
+
+// The offset of the next instruction in CS
+func (core *CpuCore) instructionPointer() uint32 {
+	if core.codeSegmentIs32Bit() {
+		return core.registers.EIP
+	}
+	return uint32(core.registers.IP)
+}
+
+// Loads the full instruction pointer, IP takes the low word
+func (core *CpuCore) setEIP(offset uint32) {
+	core.registers.EIP = offset
+	core.registers.IP = uint16(offset)
+}
+
+// Moves past length bytes of instruction
+func (core *CpuCore) advanceIP(length uint32) {
+	if core.codeSegmentIs32Bit() {
+		core.setEIP(core.registers.EIP + length)
+		return
+	}
+	core.setEIP(uint32(core.registers.IP + uint16(length)))
+}
+
+// Folds a write of IP by a 16 bit handler back into EIP, a 16 bit code segment never has the upper half set
+func (core *CpuCore) syncInstructionPointer() {
+	if !core.codeSegmentIs32Bit() || core.registers.IP != uint16(core.registers.EIP) {
+		core.registers.EIP = uint32(core.registers.IP)
+	}
 }
 
 func (core *CpuCore) Init(bus *bus.Bus) {
@@ -142,6 +255,8 @@ func (core *CpuCore) Init(bus *bus.Bus) {
 	dev2 := core.bus.FindSingleDevice(common.MODULE_IO_PORT_ACCESS_CONTROLLER).(*io.IOPortAccessController)
 	core.ioPortAccessController = dev2
 
+	dev3 := core.bus.FindSingleDevice(common.MODULE_MASTER_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a)
+	core.interruptController = dev3
 
 	core.EnterMode(common.REAL_MODE)
 
@@ -149,15 +264,29 @@ func (core *CpuCore) Init(bus *bus.Bus) {
 }
 
 func (core *CpuCore) Reset() {
-	core.registers.CS.base = 0xF000
-	core.registers.IP = 0xFFF0
-	core.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_LOCK_BIOS_MEM_REGION, Data:[]byte{}})
+	core.halted = false
+	core.interruptInhibit = false
+	core.pendingException = nil
+	core.serialException = nil
+	core.escalatedExceptions = nil
+	core.cycles = 0
+	core.fpu.init()
+	core.resetModelSpecificRegisters()
+	core.resetDebugRegisters()
+	core.flushPrefetchQueue()
+	core.resetCallStack()
+	core.resetSegmentRegisters()
+	core.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_LOCK_BIOS_MEM_REGION, Data:[]byte{}, Sender: core.busId})
 }
 
 func (core *CpuCore) EnterMode(mode uint8) {
+	if mode == common.PROTECTED_MODE && core.mode != common.PROTECTED_MODE {
+		// the caches keep their limits and attributes, only the bases follow the real mode selectors
+		core.refreshRealModeSegmentBases()
+	}
 	core.mode = mode
 
-	core.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_CPU_MODESWITCH, Data:[]byte{mode}})
+	core.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_CPU_MODESWITCH, Data:[]byte{mode}, Sender: core.busId})
 
 	processorString := core.FriendlyPartName()
 	modeString := ""
@@ -166,66 +295,108 @@ func (core *CpuCore) EnterMode(mode uint8) {
 	} else if core.mode == common.PROTECTED_MODE {
 		modeString = "PROTECTED MODE"
 	}
-	log.Printf("%s entered %s\r\n", processorString, modeString)
+	core.logger.Infof("%s entered %s", processorString, modeString)
 }
 
 // Gets the current code segment + IP addr in memory
 func (core *CpuCore) GetCurrentCodePointer() uint32 {
-	addr := core.SegmentAddressToLinearAddress(core.registers.CS, core.registers.IP)
+	// instruction fetches always use CS, segment override prefixes don't apply
+	addr := core.segmentBase(core.registers.CS) + core.instructionPointer()
 	return addr
 }
 
 func (core *CpuCore) SegmentAddressToLinearAddress(segment SegmentRegister, offset uint16) uint32 {
+	return core.segmentBase(*core.overrideSegment(&segment)) + uint32(offset)
+}
 
-	if core.flags.MemorySegmentOverride > 0 {
-		// default segment override
-		switch core.flags.MemorySegmentOverride {
-		case common.SEGMENT_CS:
-			return uint32(core.registers.CS.base) << 16 + uint32(offset)
-		case common.SEGMENT_SS:
-			return uint32(core.registers.SS.base) << 16 + uint32(offset)
-		case common.SEGMENT_DS:
-			return uint32(core.registers.DS.base) << 16 + uint32(offset)
-		case common.SEGMENT_ES:
-			return uint32(core.registers.ES.base) << 16 + uint32(offset)
-		case common.SEGMENT_FS:
-			return uint32(core.registers.FS.base) << 16 + uint32(offset)
-		case common.SEGMENT_GS:
-			return uint32(core.registers.GS.base) << 16 + uint32(offset)
-		default:
-			panic("Unhandled segment register override")
-		}
+// Gets the base address of a segment. In protected mode this comes from the cached descriptor.
+func (core *CpuCore) segmentBase(segment SegmentRegister) uint32 {
+	if core.mode == common.PROTECTED_MODE {
+		return segment.descriptorBase
 	}
 
-	addr := uint32(segment.base) << 16 + uint32(offset)
-
-	return addr
+	return uint32(segment.base) << 4
 }
 
 // Returns the address in memory of the instruction currently executing.
 // This is different from GetCurrentCodePointer in that the currently executing
-// instruction can update the CS and IP registers.
+// instruction can update the CS and IP registers. Trace lines use it so a jump
+// is reported at its own address rather than its target's.
 func (core *CpuCore) GetCurrentlyExecutingInstructionAddress() uint32 {
 	return core.currentByteDecodeStart
 }
 
 func (core *CpuCore) Step() {
-	core.currentByteAddr = core.GetCurrentCodePointer()
-	tmp := core.currentByteAddr
-	if core.currentByteAddr == core.lastExecutedInstructionPointer {
-		log.Fatalf("CPU appears to be in a loop! Did you forget to increment the IP register?")
+	if core.trace != nil {
+		core.tracedStep()
+		return
+	}
+	core.step()
+}
+
+func (core *CpuCore) step() {
+	// writes made to the registers between steps, and by this instruction, reach every view of them
+	core.registers.syncViews()
+	defer core.registers.syncViews()
+
+	core.cycles++
+
+	if core.interruptInhibit {
+		core.interruptInhibit = false
+	} else {
+		core.handlePendingInterrupt()
 	}
+	core.syncInstructionPointer()
+
+	if core.halted {
+		return
+	}
+
+	core.currentByteAddr = core.GetCurrentCodePointer()
 
 	core.currentByteDecodeStart = core.currentByteAddr
+	core.syncPrefetchQueue(core.currentByteAddr)
+
+	instructionCS := core.registers.CS
+	instructionIP := core.instructionPointer()
 
+	if core.checkExecuteBreakpoints(core.currentByteAddr) {
+		core.deliverPendingException(instructionCS, instructionIP)
+		return
+	}
+
+	// accesses made delivering the last exception don't count against this instruction
+	core.debug.pendingHits = 0
+	core.lastEffectiveAddress = EffectiveAddress{}
+
+	// TF is sampled before the instruction, so an instruction which sets it doesn't trap itself
+	singleStep := core.registers.GetFlag(TrapFlag)
+
+	core.executing = true
 	status := core.decodeInstruction()
+	core.executing = false
 
 	if status != 0 {
 		panic(0)
 	}
 
-	core.lastExecutedInstructionPointer = tmp
+	core.prefetch.sequentialNext = core.currentByteAddr
+	core.raiseDataBreakpoints()
+	if singleStep {
+		core.raiseSingleStep()
+	}
+
+	if core.pendingException != nil {
+		core.deliverPendingException(instructionCS, instructionIP)
+	}
+
+	core.syncInstructionPointer()
 
+	if core.resetRequested {
+		core.resetRequested = false
+		core.EnterMode(common.REAL_MODE)
+		core.Reset()
+	}
 }
 
 func (core *CpuCore) FriendlyPartName() string {
@@ -241,19 +412,55 @@ func (core *CpuCore) FriendlyPartName() string {
 }
 
 func (core *CpuCore) readImm8() (uint8, error) {
-	retVal, err := core.memoryAccessController.ReadAddr8(uint32(core.currentByteAddr))
+	retVal, err := core.fetch8(uint32(core.currentByteAddr))
 	if err != nil { return 0, err }
 	core.currentByteAddr++
 	return retVal, nil
 }
 
 func (core *CpuCore) readImm16() (uint16, error) {
-	retVal, err := core.memoryAccessController.ReadAddr16(uint32(core.currentByteAddr))
+	retVal, err := core.fetch16(uint32(core.currentByteAddr))
 	if err != nil { return 0, err }
 	core.currentByteAddr+=2
 	return retVal, nil
 }
 
+func (core *CpuCore) readImm32() (uint32, error) {
+	retVal, err := core.fetch32(uint32(core.currentByteAddr))
+	if err != nil { return 0, err }
+	core.currentByteAddr+=4
+	return retVal, nil
+}
+
+// Reads a rel16 displacement, or rel32 with a 32 bit operand size
+func (core *CpuCore) readRelOperand() (int32, error) {
+	if core.flags.OperandSizeOverrideEnabled {
+		value, err := core.readImm32()
+		return int32(value), err
+	}
+	value, err := core.readImm16()
+	return int32(int16(value)), err
+}
+
+// The offset of the instruction after the one being decoded
+func (core *CpuCore) nextInstructionPointer() uint32 {
+	return core.instructionPointer() + (core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Applies a signed displacement to the offset of the next instruction. With a 16 bit operand size the target
+// wraps at 64k.
+func (core *CpuCore) relativeJumpTarget(offset int32) uint32 {
+	target := core.nextInstructionPointer() + uint32(offset)
+	if !core.flags.OperandSizeOverrideEnabled {
+		target &= 0xFFFF
+	}
+	return target
+}
+
+func (core *CpuCore) jumpRelative(offset int32) {
+	core.setEIP(core.relativeJumpTarget(offset))
+}
+
 func (core *CpuCore) readRm8(modrm *ModRm) (*uint8, string, error) {
 	if modrm.mod == 3 {
 		dest := core.registers.registers8Bit[modrm.rm]
@@ -261,8 +468,13 @@ func (core *CpuCore) readRm8(modrm *ModRm) (*uint8, string, error) {
 		return dest, destName, nil
 
 	} else {
-		addressMode := modrm.getAddressMode16(core)
-		destValue, err := core.memoryAccessController.ReadAddr8(uint32(addressMode))
+		addressMode := modrm.effectiveAddress(core)
+		address, err := core.translateRm(modrm, addressMode, 1, accessRead)
+		if err != nil {
+			return new(uint8), "", err
+		}
+		core.watchData(address, 1, false)
+		destValue, err := core.memoryAccessController.ReadAddr8(address)
 		destName := fmt.Sprintf("dword_F%#04x", addressMode)
 		return &destValue, destName, err
 	}
@@ -275,8 +487,32 @@ func (core *CpuCore) readRm16(modrm *ModRm) (*uint16, string, error) {
 		return dest, destName, nil
 
 	} else {
-		addressMode := modrm.getAddressMode16(core)
-		destValue, err := core.memoryAccessController.ReadAddr16(uint32(addressMode))
+		addressMode := modrm.effectiveAddress(core)
+		address, err := core.translateRm(modrm, addressMode, 2, accessRead)
+		if err != nil {
+			return new(uint16), "", err
+		}
+		core.watchData(address, 2, false)
+		destValue, err := core.memoryAccessController.ReadAddr16(address)
+		destName := fmt.Sprintf("dword_F%#04x", addressMode)
+		return &destValue, destName, err
+	}
+}
+
+func (core *CpuCore) readRm32(modrm *ModRm) (*uint32, string, error) {
+	if modrm.mod == 3 {
+		dest := core.registers.registers32Bit[modrm.rm]
+		destName := core.registers.index32ToString(modrm.rm)
+		return dest, destName, nil
+
+	} else {
+		addressMode := modrm.effectiveAddress(core)
+		address, err := core.translateRm(modrm, addressMode, 4, accessRead)
+		if err != nil {
+			return new(uint32), "", err
+		}
+		core.watchData(address, 4, false)
+		destValue, err := core.memoryAccessController.ReadAddr32(address)
 		destName := fmt.Sprintf("dword_F%#04x", addressMode)
 		return &destValue, destName, err
 	}
@@ -297,12 +533,16 @@ func (core *CpuCore) readR16(modrm *ModRm) (*uint16, string) {
 
 func (core *CpuCore) writeRm8(modrm *ModRm, value *uint8) error {
 	if modrm.mod == 3 {
-		core.registers.registers8Bit[modrm.rm] = value
+		*core.registers.registers8Bit[modrm.rm] = *value
 	} else {
-		addressMode := modrm.getAddressMode16(core)
-		err := core.memoryAccessController.WriteAddr8(uint32(addressMode), *value)
+		address, err := core.translateRm(modrm, modrm.effectiveAddress(core), 1, accessWrite)
+		if err != nil {
+			return err
+		}
+		core.watchData(address, 1, true)
+		err = core.memoryAccessController.WriteAddr8(address, *value)
 		if err != nil {
-			return nil
+			return err
 		}
 	}
 
@@ -311,10 +551,112 @@ func (core *CpuCore) writeRm8(modrm *ModRm, value *uint8) error {
 
 func (core *CpuCore) writeRm16(modrm *ModRm, value *uint16) error {
 	if modrm.mod == 3 {
-		core.registers.registers16Bit[modrm.rm] = value
+		*core.registers.registers16Bit[modrm.rm] = *value
+	} else {
+		address, err := core.translateRm(modrm, modrm.effectiveAddress(core), 2, accessWrite)
+		if err != nil {
+			return err
+		}
+		core.watchData(address, 2, true)
+		err = core.memoryAccessController.WriteAddr16(address, *value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read-modify-write of an r/m8 operand, the effective address is only computed once
+func (core *CpuCore) modifyRm8(modrm *ModRm, modify func(uint8) uint8) (string, error) {
+	if modrm.mod == 3 {
+		dest := core.registers.registers8Bit[modrm.rm]
+		*dest = modify(*dest)
+		return core.registers.index8ToString(modrm.rm), nil
+	}
+
+	addressMode := modrm.effectiveAddress(core)
+	destName := fmt.Sprintf("byte_F%#04x", addressMode)
+
+	address, err := core.translateRm(modrm, addressMode, 1, accessWrite)
+	if err != nil {
+		return destName, err
+	}
+
+	value, err := core.memoryAccessController.ReadAddr8(address)
+	if err != nil {
+		return destName, err
+	}
+
+	core.watchData(address, 1, true)
+	return destName, core.memoryAccessController.WriteAddr8(address, modify(value))
+}
+
+// Read-modify-write of an r/m16 operand, the effective address is only computed once
+func (core *CpuCore) modifyRm16(modrm *ModRm, modify func(uint16) uint16) (string, error) {
+	if modrm.mod == 3 {
+		dest := core.registers.registers16Bit[modrm.rm]
+		*dest = modify(*dest)
+		return core.registers.index16ToString(modrm.rm), nil
+	}
+
+	addressMode := modrm.effectiveAddress(core)
+	destName := fmt.Sprintf("word_F%#04x", addressMode)
+
+	address, err := core.translateRm(modrm, addressMode, 2, accessWrite)
+	if err != nil {
+		return destName, err
+	}
+
+	value, err := core.memoryAccessController.ReadAddr16(address)
+	if err != nil {
+		return destName, err
+	}
+
+	core.watchData(address, 2, true)
+	return destName, core.memoryAccessController.WriteAddr16(address, modify(value))
+}
+
+// Read-modify-write of an r/m32 operand, the effective address is only computed once
+func (core *CpuCore) modifyRm32(modrm *ModRm, modify func(uint32) uint32) (string, error) {
+	if modrm.mod == 3 {
+		core.registers.setRegister32(modrm.rm, modify(*core.registers.registers32Bit[modrm.rm]))
+		return core.registers.index32ToString(modrm.rm), nil
+	}
+
+	addressMode := modrm.effectiveAddress(core)
+	destName := fmt.Sprintf("dword_F%#04x", addressMode)
+
+	address, err := core.translateRm(modrm, addressMode, 4, accessWrite)
+	if err != nil {
+		return destName, err
+	}
+
+	value, err := core.memoryAccessController.ReadAddr32(address)
+	if err != nil {
+		return destName, err
+	}
+
+	core.watchData(address, 4, true)
+	return destName, core.memoryAccessController.WriteAddr32(address, modify(value))
+}
+
+func (core *CpuCore) readR32(modrm *ModRm) (*uint32, string) {
+	dest := core.registers.registers32Bit[modrm.reg]
+	dstName := core.registers.index32ToString(modrm.reg)
+	return dest, dstName
+}
+
+func (core *CpuCore) writeRm32(modrm *ModRm, value *uint32) error {
+	if modrm.mod == 3 {
+		core.registers.setRegister32(modrm.rm, *value)
 	} else {
-		addressMode := modrm.getAddressMode16(core)
-		err := core.memoryAccessController.WriteAddr16(uint32(addressMode), *value)
+		address, err := core.translateRm(modrm, modrm.effectiveAddress(core), 4, accessWrite)
+		if err != nil {
+			return err
+		}
+		core.watchData(address, 4, true)
+		err = core.memoryAccessController.WriteAddr32(address, *value)
 		if err != nil {
 			return err
 		}
@@ -323,12 +665,16 @@ func (core *CpuCore) writeRm16(modrm *ModRm, value *uint16) error {
 	return nil
 }
 
+func (core *CpuCore) writeR32(modrm *ModRm, value *uint32) {
+	core.registers.setRegister32(modrm.reg, *value)
+}
+
 func (core *CpuCore) writeR8(modrm *ModRm, value *uint8) {
-	core.registers.registers8Bit[modrm.reg] = value
+	*core.registers.registers8Bit[modrm.reg] = *value
 }
 
 func (core *CpuCore) writeR16(modrm *ModRm, value *uint16) {
-	core.registers.registers16Bit[modrm.reg] = value
+	*core.registers.registers16Bit[modrm.reg] = *value
 }
 
 func (core *CpuCore) SetFlag(mask uint16, status bool) {
@@ -2,7 +2,6 @@ package intel8086
 
 import (
 	"fmt"
-	"log"
 	"math/bits"
 )
 
@@ -27,23 +26,27 @@ func INSTR_ADC(core *CpuCore) {
 			if err != nil { goto eof }
 			term1 = uint32(core.registers.AL)
 			result = uint32(term1) + uint32(term2) + uint32(core.registers.GetFlagInt(CarryFlag))
-			core.registers.AL = uint8(term1)
-			log.Printf("[%#04x] adc al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.registers.SetAL(uint8(result))
+			core.logger.Tracef("[%#04x] adc al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 
 			goto success
 		}
 	case 0x15:
 		{
-			// adc AX,imm16
+			// adc AX,imm16, or EAX,imm32 with a 32 bit operand size
 			core.currentByteAddr++
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
 			term2, err := core.readImm16()
 			if err != nil { goto eof }
 
 			term1 = uint32(core.registers.AX)
 			result = uint32(term1) + uint32(term2) + uint32(core.registers.GetFlagInt(CarryFlag))
-			core.registers.AX = uint16(term1)
+			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] adc ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] adc ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -64,7 +67,7 @@ func INSTR_ADC(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x81:
@@ -84,7 +87,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x83:
@@ -103,7 +106,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] adc %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x10:
@@ -122,7 +125,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x11:
@@ -141,7 +144,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x12:
@@ -160,7 +163,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x13:
@@ -179,7 +182,7 @@ func INSTR_ADC(core *CpuCore) {
 			tmp := uint16(result)
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] adc %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	}
@@ -201,7 +204,7 @@ func INSTR_ADC(core *CpuCore) {
 	core.registers.SetFlag(OverFlowFlag,  (sign1 == 0 && sign2 == 1 && signr == 1) || (sign1 == 1 && sign2 == 0 && signr == 0))
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 
@@ -211,36 +214,39 @@ func INSTR_ADD(core *CpuCore) {
 	var term2 uint32
 	var result uint32
 
-	var signr uint8
-	var sign1 uint32
-	var sign2 uint32
-	var bitLength uint32
+	var width uint
 
 	switch core.currentOpCodeBeingExecuted {
 	case 0x04:
 		{
 			// 	add AL,imm8
 			core.currentByteAddr++
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			term1 = uint32(core.registers.AL)
 			result = uint32(term1) + uint32(term2)
-			core.registers.AL = uint8(term1)
+			core.registers.SetAL(uint8(result))
 
-			log.Printf("[%#04x] add al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] add al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x05:
 		{
-			// 		add AX,imm16
+			// 		add AX,imm16, or EAX,imm32 with a 32 bit operand size
 			core.currentByteAddr++
-			term2, err := core.readImm16()
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			term1 = uint32(core.registers.AX)
 			result = uint32(term1) + uint32(term2)
-			core.registers.AX = uint16(term1)
+			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] add ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] add ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -253,12 +259,14 @@ func INSTR_ADD(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
+			if err != nil { goto eof }
+			term2 = uint32(imm)
 			result = uint32(term1) + uint32(term2)
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x81:
@@ -271,14 +279,15 @@ func INSTR_ADD(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			result = uint32(term1) + uint32(term2)
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x83:
@@ -291,14 +300,16 @@ func INSTR_ADD(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			// sign extended to the operand size
+			term2 = uint32(uint16(int8(imm)))
 			result = uint32(term1) + uint32(term2)
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x00:
@@ -318,7 +329,7 @@ func INSTR_ADD(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x01:
@@ -338,7 +349,7 @@ func INSTR_ADD(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x02:
@@ -358,7 +369,7 @@ func INSTR_ADD(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x03:
@@ -378,29 +389,21 @@ func INSTR_ADD(core *CpuCore) {
 			tmp := uint16(result)
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	}
 
 	success:
-	bitLength = uint32(bits.Len32(result))
-
-	// update flags
-	sign1 = (term1 >> (bitLength)) & 0x01
-	sign2 = (term2 >> (bitLength)) & 0x01
-	signr = uint8((result >> (bitLength)) & 0x01)
-
-	core.registers.SetFlag(CarryFlag, result>>(bitLength) != 0)
-
-	core.registers.SetFlag(ZeroFlag, result == 0)
-
-	core.registers.SetFlag(SignFlag, signr != 0)
-
-	core.registers.SetFlag(OverFlowFlag,  (sign1 == 0 && sign2 == 1 && signr == 1) || (sign1 == 1 && sign2 == 0 && signr == 0))
+	// the w bit of the opcode is clear for byte operands
+	width = 16
+	if core.currentOpCodeBeingExecuted&0x01 == 0 {
+		width = 8
+	}
+	core.setAddFlags(term1, term2, width)
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 func INSTR_AND(core *CpuCore) {
@@ -424,22 +427,26 @@ func INSTR_AND(core *CpuCore) {
 			if err != nil { goto eof }
 			term1 = uint32(core.registers.AL)
 			result = uint32(term1) & uint32(term2)
-			core.registers.AL = uint8(term1)
+			core.registers.SetAL(uint8(result))
 
-			log.Printf("[%#04x] add al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] add al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x25:
 		{
-			// 	and AX,imm16
+			// 	and AX,imm16, or EAX,imm32 with a 32 bit operand size
 			core.currentByteAddr++
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
 			term2, err := core.readImm16()
 			if err != nil { goto eof }
 			term1 = uint32(core.registers.AX)
 			result = uint32(term1) & uint32(term2)
-			core.registers.AX = uint16(term1)
+			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] add ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] add ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -458,7 +465,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x81:
@@ -477,7 +484,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x83:
@@ -496,7 +503,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] add %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x20:
@@ -515,7 +522,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x21:
@@ -534,7 +541,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x22:
@@ -553,7 +560,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x23:
@@ -572,7 +579,7 @@ func INSTR_AND(core *CpuCore) {
 			tmp := uint16(result)
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] add %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	}
@@ -593,8 +600,11 @@ func INSTR_AND(core *CpuCore) {
 
 	core.registers.SetFlag(OverFlowFlag,  (sign1 == 0 && sign2 == 1 && signr == 1) || (sign1 == 1 && sign2 == 0 && signr == 0))
 
+	// AF is undefined after the logical operations
+	core.undefineFlags(AdjustFlag)
+
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 
@@ -617,13 +627,17 @@ func INSTR_OR(core *CpuCore) {
 			result = uint32(term1) | uint32(term2)
 			core.registers.AL = uint8(result)
 
-			log.Printf("[%#04x] or al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] or al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x0d:
 		{
-			// OR AX,imm16
+			// OR AX,imm16, or EAX,imm32 with a 32 bit operand size
 			core.currentByteAddr++
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
 			term2, err := core.readImm16()
 			if err != nil { goto eof }
 
@@ -631,7 +645,7 @@ func INSTR_OR(core *CpuCore) {
 			result = uint32(term1) | uint32(term2)
 			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] or ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] or ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -651,7 +665,7 @@ func INSTR_OR(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x81:
@@ -672,7 +686,7 @@ func INSTR_OR(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x83:
@@ -692,7 +706,7 @@ func INSTR_OR(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x08:
@@ -712,7 +726,7 @@ func INSTR_OR(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x09:
@@ -732,7 +746,7 @@ func INSTR_OR(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x0A:
@@ -751,7 +765,7 @@ func INSTR_OR(core *CpuCore) {
 
 			core.writeR8(&modrm, &tmp)
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x0B:
@@ -771,7 +785,7 @@ func INSTR_OR(core *CpuCore) {
 
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] or %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	}
@@ -789,10 +803,12 @@ func INSTR_OR(core *CpuCore) {
 
 	core.registers.SetFlag(ZeroFlag, result == 0)
 
-	core.registers.SetFlag(ParityFlag, bits.OnesCount32(result)%2 == 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+
+	core.undefineFlags(AdjustFlag)
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 func INSTR_XOR(core *CpuCore) {
@@ -815,13 +831,17 @@ func INSTR_XOR(core *CpuCore) {
 			result = uint32(term1) ^ uint32(term2)
 			core.registers.AL = uint8(result)
 
-			log.Printf("[%#04x] xor al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] xor al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x35:
 		{
-			// XOR AX,imm16
+			// XOR AX,imm16, or EAX,imm32 with a 32 bit operand size
 			core.currentByteAddr++
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
 			term2, err := core.readImm16()
 			if err != nil { goto eof }
 
@@ -829,7 +849,7 @@ func INSTR_XOR(core *CpuCore) {
 			result = uint32(term1) ^ uint32(term2)
 			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] xor ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] xor ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -849,7 +869,7 @@ func INSTR_XOR(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof}
 
-			log.Printf("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x81:
@@ -870,7 +890,7 @@ func INSTR_XOR(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
 
-			log.Printf("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x83:
@@ -890,7 +910,7 @@ func INSTR_XOR(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
 
-			log.Printf("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] xor %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x30:
@@ -911,7 +931,7 @@ func INSTR_XOR(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof}
 
-			log.Printf("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x31:
@@ -930,7 +950,7 @@ func INSTR_XOR(core *CpuCore) {
 
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof}
-			log.Printf("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x32:
@@ -949,7 +969,7 @@ func INSTR_XOR(core *CpuCore) {
 
 			core.writeR8(&modrm, &tmp)
 
-			log.Printf("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x33:
@@ -968,7 +988,7 @@ func INSTR_XOR(core *CpuCore) {
 
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] xor %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	}
@@ -986,9 +1006,11 @@ func INSTR_XOR(core *CpuCore) {
 
 	core.registers.SetFlag(ZeroFlag, result == 0)
 
-	core.registers.SetFlag(ParityFlag, bits.OnesCount32(result)%2 == 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+
+	core.undefineFlags(AdjustFlag)
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 
@@ -999,34 +1021,37 @@ func INSTR_SUB(core *CpuCore) {
 	var term2 uint32
 	var result uint32
 
-	var signr uint8
-	var sign1 uint32
-	var sign2 uint32
-	var bitLength uint32
+	var width uint
 
 	switch core.currentOpCodeBeingExecuted {
 	case 0x2c:
 		{
 			// 	SUB AL,imm8
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			term1 = uint32(core.registers.AL)
 			result = uint32(term1) - uint32(term2)
-			core.registers.AL = uint8(term1)
+			core.registers.SetAL(uint8(result))
 
-			log.Printf("[%#04x] sub al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] sub al, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x2d:
 		{
-			// 		SUB AX,imm16
-			term2, err := core.readImm16()
+			// 		SUB AX,imm16, or EAX,imm32 with a 32 bit operand size
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			term1 = uint32(core.registers.AX)
 			result = uint32(term1) - uint32(term2)
-			core.registers.AX = uint16(term1)
+			core.registers.AX = uint16(result)
 
-			log.Printf("[%#04x] sub ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] sub ax, %#04x", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -1038,14 +1063,15 @@ func INSTR_SUB(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			result = uint32(term1) - uint32(term2)
 			tmp := uint8(result)
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x81:
@@ -1057,14 +1083,15 @@ func INSTR_SUB(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 			result = uint32(term1) - uint32(term2)
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x83:
@@ -1076,14 +1103,16 @@ func INSTR_SUB(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*t1)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			// sign extended to the operand size
+			term2 = uint32(uint16(int8(imm)))
 			result = uint32(term1) - uint32(term2)
 			tmp := uint16(result)
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
+			core.logger.Tracef("[%#04x] sub %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), t1Name, term2)
 			goto success
 		}
 	case 0x28:
@@ -1103,7 +1132,7 @@ func INSTR_SUB(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x29:
@@ -1123,7 +1152,7 @@ func INSTR_SUB(core *CpuCore) {
 			err = core.writeRm16(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x2A:
@@ -1143,7 +1172,7 @@ func INSTR_SUB(core *CpuCore) {
 			err = core.writeRm8(&modrm, &tmp)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	case 0x2B:
@@ -1162,158 +1191,519 @@ func INSTR_SUB(core *CpuCore) {
 			tmp := uint16(result)
 			core.writeR16(&modrm, &tmp)
 
-			log.Printf("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
+			core.logger.Tracef("[%#04x] sub %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Name, t2Name)
 			goto success
 		}
 	default:
-		log.Fatal(fmt.Sprintf("Unrecognised SUB instruction: %#04x!", core.currentOpCodeBeingExecuted ))
+		core.logger.Fatalf("Unrecognised SUB instruction: %#04x!", core.currentOpCodeBeingExecuted)
 	}
 
 	success:
-	bitLength = uint32(bits.Len32(result))
+	// the w bit of the opcode is clear for byte operands
+	width = 16
+	if core.currentOpCodeBeingExecuted&0x01 == 0 {
+		width = 8
+	}
+	core.setSubtractFlags(term1, term2, width)
 
-	// update flags
-	sign1 = (term1 >> (bitLength)) & 0x01
-	sign2 = (term2 >> (bitLength)) & 0x01
-	signr = uint8((result >> (bitLength)) & 0x01)
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
 
-	core.registers.SetFlag(CarryFlag, result>>(bitLength) != 0)
+// SBB subtracts the source and CF from the destination, in the same forms as SUB
+func INSTR_SBB(core *CpuCore) {
+	var modrm ModRm
+	var bytesConsumed uint32
+	var err error
 
-	core.registers.SetFlag(ZeroFlag, result == 0)
+	var term1 uint32
+	var term2 uint32
+	var borrow uint32
+	var result uint32
+	var width uint
+	var destName string
 
-	core.registers.SetFlag(SignFlag, signr != 0)
+	core.currentByteAddr++
+	borrow = uint32(core.registers.GetFlagInt(CarryFlag))
 
-	core.registers.SetFlag(OverFlowFlag,  (sign1 == 0 && sign2 == 1 && signr == 1) || (sign1 == 1 && sign2 == 0 && signr == 0))
+	// the w bit of the opcode is clear for byte operands
+	width = 16
+	if core.currentOpCodeBeingExecuted&0x01 == 0 {
+		width = 8
+	}
+
+	switch core.currentOpCodeBeingExecuted {
+	case 0x1C, 0x1D:
+		{
+			// sbb al, imm8 and sbb ax, imm16, or eax, imm32 with a 32 bit operand size
+			if width == 16 && core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
+			if width == 8 {
+				var imm uint8
+				imm, err = core.readImm8()
+				term1, term2, destName = uint32(core.registers.AL), uint32(imm), "al"
+			} else {
+				var imm uint16
+				imm, err = core.readImm16()
+				term1, term2, destName = uint32(core.registers.AX), uint32(imm), "ax"
+			}
+			if err != nil { goto eof }
+
+			result = term1 - term2 - borrow
+			if width == 8 {
+				core.registers.SetAL(uint8(result))
+			} else {
+				core.registers.AX = uint16(result)
+			}
+		}
+	case 0x1A, 0x1B:
+		{
+			// sbb r8, r/m8 and sbb r16, r/m16
+			modrm, bytesConsumed, err = core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+
+			if width == 8 {
+				var src *uint8
+				src, _, err = core.readRm8(&modrm)
+				if err != nil { goto eof }
+				dest, name := core.readR8(&modrm)
+				term1, term2, destName = uint32(*dest), uint32(*src), name
+				value := uint8(term1 - term2 - borrow)
+				core.writeR8(&modrm, &value)
+			} else {
+				var src *uint16
+				src, _, err = core.readRm16(&modrm)
+				if err != nil { goto eof }
+				dest, name := core.readR16(&modrm)
+				term1, term2, destName = uint32(*dest), uint32(*src), name
+				value := uint16(term1 - term2 - borrow)
+				core.writeR16(&modrm, &value)
+			}
+		}
+	default:
+		{
+			// sbb r/m8, r8 (0x18), sbb r/m16, r16 (0x19) and the 0x80, 0x81 and 0x83 /3 immediate forms
+			modrm, bytesConsumed, err = core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+
+			switch core.currentOpCodeBeingExecuted {
+			case 0x18:
+				term2 = uint32(*core.registers.registers8Bit[modrm.reg])
+			case 0x19:
+				term2 = uint32(*core.registers.registers16Bit[modrm.reg])
+			case 0x81:
+				var imm uint16
+				imm, err = core.readImm16()
+				term2 = uint32(imm)
+			default:
+				var imm uint8
+				imm, err = core.readImm8()
+				term2 = uint32(imm)
+				if core.currentOpCodeBeingExecuted == 0x83 {
+					// sign extended to the operand size
+					term2 = uint32(uint16(int8(imm)))
+				}
+			}
+			if err != nil { goto eof }
+
+			if width == 8 {
+				destName, err = core.modifyRm8(&modrm, func(value uint8) uint8 {
+					term1 = uint32(value)
+					return uint8(term1 - term2 - borrow)
+				})
+			} else {
+				destName, err = core.modifyRm16(&modrm, func(value uint16) uint16 {
+					term1 = uint32(value)
+					return uint16(term1 - term2 - borrow)
+				})
+			}
+			if err != nil { goto eof }
+		}
+	}
+
+	core.setSubtractWithBorrowFlags(term1, term2, borrow, width)
+	core.logger.Tracef("[%#04x] sbb %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), destName, term2)
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// NOT (0xF6/0xF7 /2) leaves the flags alone, NEG (/3) sets them as 0 - operand does, so CF is set unless it was 0
+func INSTR_NOT_NEG(core *CpuCore) {
+	var modrm ModRm
+	var bytesConsumed uint32
+	var err error
+
+	var operand uint32
+	var negate bool
+	var width uint
+	var destName string
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err = core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	negate = modrm.reg == 3
+
+	switch {
+	case core.currentOpCodeBeingExecuted == 0xF6:
+		width = 8
+		destName, err = core.modifyRm8(&modrm, func(value uint8) uint8 {
+			operand = uint32(value)
+			if negate {
+				return -value
+			}
+			return ^value
+		})
+	case core.flags.OperandSizeOverrideEnabled:
+		width = 32
+		destName, err = core.modifyRm32(&modrm, func(value uint32) uint32 {
+			operand = value
+			if negate {
+				return -value
+			}
+			return ^value
+		})
+	default:
+		width = 16
+		destName, err = core.modifyRm16(&modrm, func(value uint16) uint16 {
+			operand = uint32(value)
+			if negate {
+				return -value
+			}
+			return ^value
+		})
+	}
+	if err != nil { goto eof }
+
+	if negate {
+		core.setSubtractFlags(0, operand, width)
+		core.logger.Tracef("[%#04x] neg %s", core.GetCurrentlyExecutingInstructionAddress(), destName)
+	} else {
+		core.logger.Tracef("[%#04x] not %s", core.GetCurrentlyExecutingInstructionAddress(), destName)
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 func INSTR_SHIFT(core *CpuCore) {
 	core.currentByteAddr++
 
-	// SAL
-	var destTerm interface{}
-	var bitLength uint8
-	var t1Str string
-	var t2Str string
-	var opCode uint8
+	var destName string
+	var countName string
 	var countTerm uint8
-	var err error
+	var opName string
 
 	modrm, bytesConsumed, err := core.consumeModRm()
 	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
 
+	switch core.currentOpCodeBeingExecuted {
+	case 0xD0, 0xD1: countTerm = 1; countName = "1"
+	case 0xD2, 0xD3: countTerm = core.registers.CL; countName = "CL"
+	case 0xC0, 0xC1: countTerm, err = core.readImm8(); if err != nil { goto eof }; countName = fmt.Sprintf("%#02x", countTerm)
+	}
 
-	opCode = core.currentOpCodeBeingExecuted
+	// the reg field of the modrm picks the operation, /6 is an alias of SAL
+	opName = [8]string{"ROL", "ROR", "RCL", "RCR", "SAL", "SHR", "SAL", "SAR"}[modrm.reg]
+
+	// the w bit of the opcode is clear for byte operands
+	if core.currentOpCodeBeingExecuted&0x01 == 0 {
+		destName, err = core.modifyRm8(&modrm, func(value uint8) uint8 {
+			return uint8(core.shift(modrm.reg, uint32(value), countTerm, 8))
+		})
+	} else {
+		destName, err = core.modifyRm16(&modrm, func(value uint16) uint16 {
+			return uint16(core.shift(modrm.reg, uint32(value), countTerm, 16))
+		})
+	}
+	if err != nil { goto eof }
 
-	switch modrm.mod {
-	case 4:
-		{
-			// sal
-			switch opCode {
-			// 8 bit versions
-			case 0xd0: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed; countTerm = 1; t2Str = "1"; bitLength = 8
-			case 0xd2: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = core.registers.CL; t2Str = "CL"; bitLength = 8
-			case 0xC0: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm, err := core.readImm8(); if err != nil { goto eof}; t2Str = string(countTerm); bitLength = 8
-
-			// 16 bit versions
-			case 0xd1: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = 1; t2Str = "1"; bitLength = 16
-			case 0xd3: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = core.registers.CL; t2Str = "CL"; bitLength = 16
-			case 0xC1: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm, err := core.readImm8(); if err != nil { goto eof}; t2Str = string(countTerm); bitLength = 16
-
-			default: {
-				log.Printf("Unhandled shift sal variant")
-				doCoreDump(core)
-				panic(false)
+	core.logger.Tracef("[%#04x] %s %s, %s", core.GetCurrentlyExecutingInstructionAddress(), opName, destName, countName)
+
+	// OF is only defined for a shift by 1, AF for none, rotates leave AF alone
+	if countTerm > 1 {
+		core.undefineFlags(OverFlowFlag)
+	}
+	if countTerm != 0 && modrm.reg >= 4 {
+		core.undefineFlags(AdjustFlag)
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Shifts or rotates a bitLength wide value count times, leaving the last bit shifted out in CF
+// rol/ror - rotate left and right
+// rcl/rcr - rotate left and right through CF
+// sal - shifts to the left
+// shr - shifts to the right, and clears the most significant bit (unsigned)
+// sar - shifts to the right, preserves the most significant bit (signed)
+func (core *CpuCore) shift(operation uint8, value uint32, count uint8, bitLength uint) uint32 {
+	msb := uint32(1) << (bitLength - 1)
+
+	for i := uint8(0); i < count; i++ {
+		// the odd operations shift to the right
+		out := value&msb != 0
+		if operation&0x01 == 1 {
+			out = value&1 == 1
+		}
+
+		switch operation {
+		case 0:
+			value <<= 1
+			if out {
+				value |= 1
+			}
+		case 1:
+			value >>= 1
+			if out {
+				value |= msb
+			}
+		case 2:
+			value <<= 1
+			if core.registers.GetFlag(CarryFlag) {
+				value |= 1
 			}
+		case 3:
+			value >>= 1
+			if core.registers.GetFlag(CarryFlag) {
+				value |= msb
 			}
+		case 4, 6:
+			value <<= 1
+		case 5:
+			value >>= 1
+		case 7:
+			value = value>>1 | value&msb
+		}
 
-			for i:=uint8(0);i<countTerm;i++ {
-				if bitLength == 8 {
+		core.registers.SetFlag(CarryFlag, out)
+	}
 
-					if *destTerm.(*uint8) << 1 > (0 & 11111111) {
-						// shift into carry
-						core.registers.SetFlag(CarryFlag,  *destTerm.(*uint8) >> (bitLength-1) & 1 == 1)
-					}
+	return value & (msb<<1 - 1)
+}
 
-					*destTerm.(*uint8) <<= 1
-				}
 
-				if bitLength == 16 {
 
-					if *destTerm.(*uint16) << 1 > (0 & 11111111) {
-						// shift into carry
-						core.registers.SetFlag(CarryFlag,  *destTerm.(*uint16) >> (bitLength-1) & 1 == 1)
-					}
+func (core *CpuCore) setIncDecFlags8(result uint8, overflow bool) {
+	// carry flag is not affected by inc/dec
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&0x80 != 0)
+	core.registers.SetFlag(OverFlowFlag, overflow)
+	core.registers.SetFlag(ParityFlag, evenParity(result))
+}
 
-					*destTerm.(*uint16) <<= 1
-				}
-			}
+func (core *CpuCore) setIncDecFlags16(result uint16, overflow bool) {
+	// carry flag is not affected by inc/dec
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&0x8000 != 0)
+	core.registers.SetFlag(OverFlowFlag, overflow)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+}
 
-			log.Printf("[%#04x] sal %s, %s", core.GetCurrentlyExecutingInstructionAddress(), t1Str, t2Str)
+func (core *CpuCore) incRm8(value uint8) uint8 {
+	result := value + 1
+	core.registers.SetFlag(AdjustFlag, value&0x0F == 0x0F)
+	core.setIncDecFlags8(result, value == 0x7F)
+	return result
+}
 
-		}
-	case 5, 7:
-		{
-			// shr - shifts to the right, and clears the most significant bit (unsigned)
-			// sar - shifts to the right, preserves the most significant bit (signed)
-			switch opCode {
-			// 8 bit versions
-			case 0xd0: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = 1; t2Str = "1"; bitLength = 8
-			case 0xd2: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = core.registers.CL; t2Str = "CL"; bitLength = 8
-			case 0xC0: destTerm, t1Str, err = core.readRm8(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm, err := core.readImm8(); if err != nil { goto eof }; t2Str = string(countTerm); bitLength = 8
-
-			// 16 bit versions
-			case 0xd1: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = 1; t2Str = "1"; bitLength = 16
-			case 0xd3: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm = core.registers.CL; t2Str = "CL"; bitLength = 16
-			case 0xC1: destTerm, t1Str, err = core.readRm16(&modrm); if err != nil { goto eof }; core.currentByteAddr += bytesConsumed;  countTerm, err := core.readImm8(); if err != nil { goto eof }; t2Str = string(countTerm); bitLength = 16
-
-			default: {
-				log.Printf("Unhandled shift sal variant")
-				doCoreDump(core)
-				panic(false)
-			}
-			}
+func (core *CpuCore) incRm16(value uint16) uint16 {
+	result := value + 1
+	core.registers.SetFlag(AdjustFlag, value&0x0F == 0x0F)
+	core.setIncDecFlags16(result, value == 0x7FFF)
+	return result
+}
 
-			var msbBit interface{}
-			for i:=uint8(0);i<countTerm;i++ {
+func (core *CpuCore) decRm8(value uint8) uint8 {
+	result := value - 1
+	core.registers.SetFlag(AdjustFlag, value&0x0F == 0x00)
+	core.setIncDecFlags8(result, value == 0x80)
+	return result
+}
 
-				if bitLength == 8 {
+func (core *CpuCore) decRm16(value uint16) uint16 {
+	result := value - 1
+	core.registers.SetFlag(AdjustFlag, value&0x0F == 0x00)
+	core.setIncDecFlags16(result, value == 0x8000)
+	return result
+}
 
-					core.registers.SetFlag(CarryFlag,  *destTerm.(*uint8) & 1 == 1)
+func INSTR_INC(core *CpuCore) {
 
-					msbBit = (*destTerm.(*uint8) >> 8) & 1
-					*destTerm.(*uint8) >>= 1
-					if modrm.mod == 7 {
-						*destTerm.(*uint8) = *destTerm.(*uint8) | (msbBit.(uint8) << (bitLength-1))
-					}
-				}
+	var destName string
 
-				if bitLength == 16 {
+	switch {
+	case core.currentOpCodeBeingExecuted >= 0x40 && core.currentOpCodeBeingExecuted <= 0x47:
+		{
+			// inc r16
+			core.currentByteAddr++
+			index := core.currentOpCodeBeingExecuted - 0x40
+			dest := core.registers.registers16Bit[index]
+			*dest = core.incRm16(*dest)
+			destName = core.registers.index16ToString(index)
+		}
+	case core.currentOpCodeBeingExecuted == 0xFE:
+		{
+			// inc r/m8
+			core.currentByteAddr++
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+			destName, err = core.modifyRm8(&modrm, core.incRm8)
+			if err != nil { goto eof }
+		}
+	case core.currentOpCodeBeingExecuted == 0xFF:
+		{
+			// inc r/m16
+			core.currentByteAddr++
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+			destName, err = core.modifyRm16(&modrm, core.incRm16)
+			if err != nil { goto eof }
+		}
+	}
 
-					core.registers.SetFlag(CarryFlag,  *destTerm.(*uint16) & 1 == 1)
+	core.logger.Tracef("[%#04x] inc %s", core.GetCurrentlyExecutingInstructionAddress(), destName)
 
-					msbBit = (*destTerm.(*uint16) >> 8) & 1
-					*destTerm.(*uint8) >>= 1
-					if modrm.mod == 7 {
-						*destTerm.(*uint16) = *destTerm.(*uint16) | (msbBit.(uint16) << (bitLength-1))
-					}
-				}
-			}
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
 
-			opCode := "SHR"
-			if modrm.mod == 7 {
-				opCode = "SAR"
-			}
+func INSTR_DEC(core *CpuCore) {
 
-			log.Printf("[%#04x] %s %s, %s", core.GetCurrentlyExecutingInstructionAddress(), opCode, t1Str, t2Str)
+	var destName string
 
+	switch {
+	case core.currentOpCodeBeingExecuted >= 0x48 && core.currentOpCodeBeingExecuted <= 0x4F:
+		{
+			// dec r16
+			core.currentByteAddr++
+			index := core.currentOpCodeBeingExecuted - 0x48
+			dest := core.registers.registers16Bit[index]
+			*dest = core.decRm16(*dest)
+			destName = core.registers.index16ToString(index)
+		}
+	case core.currentOpCodeBeingExecuted == 0xFE:
+		{
+			// dec r/m8
+			core.currentByteAddr++
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+			destName, err = core.modifyRm8(&modrm, core.decRm8)
+			if err != nil { goto eof }
+		}
+	case core.currentOpCodeBeingExecuted == 0xFF:
+		{
+			// dec r/m16
+			core.currentByteAddr++
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+			destName, err = core.modifyRm16(&modrm, core.decRm16)
+			if err != nil { goto eof }
 		}
 	}
 
+	core.logger.Tracef("[%#04x] dec %s", core.GetCurrentlyExecutingInstructionAddress(), destName)
+
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+var arithmeticNames = [8]string{"add", "or", "adc", "sbb", "and", "sub", "xor", "cmp"}
+
+// Performs the operation numbered as in bits 3 to 5 of the accumulator opcodes and the reg field of the 0x80 to 0x83
+// groups on 32 bit operands, setting the flags. The result is returned, for cmp it's only what the flags were set from.
+func (core *CpuCore) arithmetic32(operation uint8, a uint32, b uint32) uint32 {
+	switch operation {
+	case 0:
+		core.setAddFlags(a, b, 32)
+		return a + b
+	case 1:
+		core.setLogicFlags(a|b, 32)
+		return a | b
+	case 2:
+		carry := uint32(core.registers.GetFlagInt(CarryFlag))
+		core.setAddWithCarryFlags(a, b, carry, 32)
+		return a + b + carry
+	case 3:
+		borrow := uint32(core.registers.GetFlagInt(CarryFlag))
+		core.setSubtractWithBorrowFlags(a, b, borrow, 32)
+		return a - b - borrow
+	case 4:
+		core.setLogicFlags(a&b, 32)
+		return a & b
+	case 6:
+		core.setLogicFlags(a^b, 32)
+		return a ^ b
+	default:
+		core.setSubtractFlags(a, b, 32)
+		return a - b
+	}
+}
+
+// op EAX, imm32, the accumulator form of an operation with a 32 bit operand size. currentByteAddr is past the opcode.
+func (core *CpuCore) arithmeticAccumulator32() {
+	operation := core.currentOpCodeBeingExecuted >> 3 & 0x07
+
+	imm, err := core.readImm32()
+	if err != nil {
+		return
+	}
+
+	result := core.arithmetic32(operation, core.registers.EAX, imm)
+	if operation != 7 {
+		core.registers.setRegister32(0, result)
+	}
+
+	core.logger.Tracef("[%#04x] %s eax, %#08x", core.GetCurrentlyExecutingInstructionAddress(), arithmeticNames[operation], imm)
 }
 
+// op r/m32, imm32 (0x81) and op r/m32, imm8 (0x83, sign extended), the immediate group forms with a 32 bit
+// operand size. The operation is in the reg field.
+func (core *CpuCore) arithmeticRm32Immediate() {
+	var imm uint32
+	var destName string
 
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.currentOpCodeBeingExecuted == 0x83 {
+		var imm8 uint8
+		imm8, err = core.readImm8()
+		imm = uint32(int32(int8(imm8)))
+	} else {
+		imm, err = core.readImm32()
+	}
+	if err != nil { goto eof }
+
+	if modrm.reg == 7 {
+		// cmp only sets the flags
+		var dest *uint32
+		dest, destName, err = core.readRm32(&modrm)
+		if err != nil { goto eof }
+		core.arithmetic32(modrm.reg, *dest, imm)
+	} else {
+		destName, err = core.modifyRm32(&modrm, func(value uint32) uint32 {
+			return core.arithmetic32(modrm.reg, value, imm)
+		})
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] %s %s, %#08x", core.GetCurrentlyExecutingInstructionAddress(), arithmeticNames[modrm.reg], destName, imm)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
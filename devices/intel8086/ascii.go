@@ -0,0 +1,55 @@
+package intel8086
+
+/*
+	ASCII adjust for multiply and divide
+	AAM (0xD4) splits AL into digits of the immediate base, AH=AL/base and AL=AL%base. AAD (0xD5) joins them back,
+	AL=AH*base+AL and AH=0. Assemblers emit a base of 10 but any byte works. SF, ZF and PF follow AL, the other
+	arithmetic flags are undefined and left as they were. AAM with a base of 0 raises #DE before anything is changed.
+*/
+
+func INSTR_AAM(core *CpuCore) {
+	var base uint8
+	var err error
+
+	core.currentByteAddr++
+
+	base, err = core.readImm8()
+	if err != nil { goto eof }
+
+	if base == 0 {
+		core.raiseException(NewFault(ExceptionDivideError))
+		goto eof
+	}
+
+	core.setAsciiAdjusted(core.registers.AL/base, core.registers.AL%base)
+	core.logger.Tracef("[%#04x] aam %#02x", core.GetCurrentlyExecutingInstructionAddress(), base)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_AAD(core *CpuCore) {
+	var base uint8
+	var err error
+
+	core.currentByteAddr++
+
+	base, err = core.readImm8()
+	if err != nil { goto eof }
+
+	core.setAsciiAdjusted(0, core.registers.AH*base+core.registers.AL)
+	core.logger.Tracef("[%#04x] aad %#02x", core.GetCurrentlyExecutingInstructionAddress(), base)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func (core *CpuCore) setAsciiAdjusted(ah uint8, al uint8) {
+	core.registers.SetAH(ah)
+	core.registers.SetAL(al)
+
+	core.registers.SetFlag(ZeroFlag, al == 0)
+	core.registers.SetFlag(SignFlag, al&0x80 != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(al))
+	core.undefineFlags(CarryFlag | AdjustFlag | OverFlowFlag)
+}
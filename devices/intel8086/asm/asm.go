@@ -0,0 +1,898 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	Test assembler
+	Assembles 16 bit real mode code for test fixtures, covering the instructions the emulator implements rather
+	than the whole instruction set. Statements are separated by newlines or semicolons and written in intel
+	order, "mov ax, 5; add ax, bx; cmp ax, 10; jz done", with labels ending in a colon.
+
+	Registers are the 8 and 16 bit general registers and the segment registers. Memory operands use the 16 bit
+	addressing forms, [bx+si+4], [bp-2] or [0x0600], and can carry a segment override, es:[di], and a size,
+	byte [bx] or word ptr [bx], which is only needed when no register gives it. Numbers are decimal, 0x hex,
+	hex with an h suffix, or a quoted character, and a label can stand in for a number.
+
+	Every form has a fixed length, so labels are resolved in a second pass: conditional jumps, jcxz and jmp short
+	take rel8 and fail when the target is out of range, jmp and call take rel16. The alu ops and push take the
+	sign extended imm8 form when a number fits it, but never for a label. db and dw emit data.
+*/
+
+var registers8 = []string{"al", "cl", "dl", "bl", "ah", "ch", "dh", "bh"}
+var registers16 = []string{"ax", "cx", "dx", "bx", "sp", "bp", "si", "di"}
+var segmentRegisters = []string{"es", "cs", "ss", "ds", "fs", "gs"}
+
+var segmentOverrides = map[string]uint8{"es": 0x26, "cs": 0x2e, "ss": 0x36, "ds": 0x3e, "fs": 0x64, "gs": 0x65}
+
+var prefixes = map[string]uint8{"lock": 0xf0, "rep": 0xf3, "repe": 0xf3, "repz": 0xf3, "repne": 0xf2, "repnz": 0xf2}
+
+// Instructions without operands
+var implied = map[string][]uint8{
+	"nop": {0x90}, "hlt": {0xf4}, "cli": {0xfa}, "sti": {0xfb}, "cld": {0xfc}, "std": {0xfd},
+	"pushf": {0x9c}, "popf": {0x9d}, "sahf": {0x9e}, "lahf": {0x9f}, "leave": {0xc9}, "iret": {0xcf}, "int3": {0xcc}, "ret": {0xc3}, "retf": {0xcb},
+	"lodsb": {0xac}, "lodsw": {0xad}, "movsb": {0xa4}, "movsw": {0xa5}, "cmpsb": {0xa6}, "cmpsw": {0xa7},
+	"stosb": {0xaa}, "stosw": {0xab}, "scasb": {0xae}, "scasw": {0xaf},
+	"insb": {0x6c}, "insw": {0x6d}, "outsb": {0x6e}, "outsw": {0x6f},
+	"salc": {0xd6}, "wait": {0x9b}, "aam": {0xd4, 0x0a}, "aad": {0xd5, 0x0a},
+}
+
+// The reg field of the alu ops, which is also their row in the one byte opcode map
+var aluOps = map[string]uint8{"add": 0, "or": 1, "adc": 2, "sbb": 3, "and": 4, "sub": 5, "xor": 6, "cmp": 7}
+
+var shiftOps = map[string]uint8{"rol": 0, "ror": 1, "rcl": 2, "rcr": 3, "shl": 4, "sal": 4, "shr": 5, "sar": 7}
+
+var conditions = map[string]uint8{
+	"jo": 0x0, "jno": 0x1, "jb": 0x2, "jc": 0x2, "jnae": 0x2, "jnb": 0x3, "jae": 0x3, "jnc": 0x3,
+	"je": 0x4, "jz": 0x4, "jne": 0x5, "jnz": 0x5, "jbe": 0x6, "jna": 0x6, "ja": 0x7, "jnbe": 0x7,
+	"js": 0x8, "jns": 0x9, "jp": 0xa, "jpe": 0xa, "jnp": 0xb, "jpo": 0xb,
+	"jl": 0xc, "jnge": 0xc, "jge": 0xd, "jnl": 0xd, "jle": 0xe, "jng": 0xe, "jg": 0xf, "jnle": 0xf,
+}
+
+// 16 bit addressing, the rm field for each base and index pair
+var addressingForms = map[string]uint8{
+	"bx+si": 0, "bx+di": 1, "bp+si": 2, "bp+di": 3, "si": 4, "di": 5, "bp": 6, "bx": 7,
+}
+
+type operandKind int
+
+const (
+	operandRegister operandKind = iota
+	operandSegment
+	operandImmediate
+	operandMemory
+	operandFarPointer
+)
+
+type operand struct {
+	kind     operandKind
+	size     int   // 8 or 16, 0 for a memory operand without a size or an immediate
+	index    uint8 // register number, or the rm field of a memory operand
+	mod      uint8 // memory operands
+	value    int64 // immediate, displacement or far pointer offset
+	segment  int64 // far pointer selector
+	override uint8 // segment override prefix of a memory operand, 0 for none
+	symbolic bool  // the value came from a label
+}
+
+type statement struct {
+	line      int
+	labels    []string
+	prefixes  []uint8
+	mnemonic  string
+	operands  []string
+	qualifier string // short or far on a jump
+}
+
+type assembler struct {
+	origin uint16
+	labels map[string]uint16
+	final  bool // labels are all known
+	code   []uint8
+}
+
+// Assembles source for code loaded at origin, returning the encoded bytes
+func Assemble(origin uint16, source string) ([]uint8, error) {
+	statements, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &assembler{origin: origin, labels: map[string]uint16{}}
+	for pass := 0; pass < 2; pass++ {
+		a.final = pass == 1
+		a.code = nil
+		for _, s := range statements {
+			for _, label := range s.labels {
+				if _, exists := a.labels[label]; exists && !a.final {
+					return nil, fmt.Errorf("line %d: label %q is already defined", s.line, label)
+				}
+				a.labels[label] = a.address()
+			}
+			if s.mnemonic == "" {
+				continue
+			}
+			if err := a.assemble(s); err != nil {
+				return nil, fmt.Errorf("line %d: %s", s.line, err.Error())
+			}
+		}
+	}
+	return a.code, nil
+}
+
+// Assembles source for code loaded at origin, panicking if it doesn't assemble
+func MustAssemble(origin uint16, source string) []uint8 {
+	code, err := Assemble(origin, source)
+	if err != nil {
+		panic(err)
+	}
+	return code
+}
+
+func parse(source string) ([]statement, error) {
+	var statements []statement
+	for number, line := range strings.Split(source, "\n") {
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		for _, text := range strings.Split(line, ";") {
+			s := statement{line: number + 1}
+			text = strings.TrimSpace(text)
+
+			// labels
+			for {
+				colon := strings.Index(text, ":")
+				if colon < 0 || !isIdentifier(text[:colon]) {
+					break
+				}
+				s.labels = append(s.labels, strings.ToLower(text[:colon]))
+				text = strings.TrimSpace(text[colon+1:])
+			}
+
+			fields := strings.Fields(text)
+			for len(fields) > 0 {
+				prefix, ok := prefixes[strings.ToLower(fields[0])]
+				if !ok {
+					break
+				}
+				s.prefixes = append(s.prefixes, prefix)
+				fields = fields[1:]
+			}
+			if len(fields) == 0 {
+				if len(s.prefixes) > 0 {
+					return nil, fmt.Errorf("line %d: prefix without an instruction", s.line)
+				}
+				if len(s.labels) > 0 {
+					statements = append(statements, s)
+				}
+				continue
+			}
+
+			s.mnemonic = strings.ToLower(fields[0])
+			fields = fields[1:]
+			if len(fields) > 0 && (strings.EqualFold(fields[0], "short") || strings.EqualFold(fields[0], "far")) {
+				s.qualifier = strings.ToLower(fields[0])
+				fields = fields[1:]
+			}
+			if rest := strings.Join(fields, " "); rest != "" {
+				for _, o := range strings.Split(rest, ",") {
+					s.operands = append(s.operands, strings.TrimSpace(o))
+				}
+			}
+			statements = append(statements, s)
+		}
+	}
+	return statements, nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *assembler) address() uint16 {
+	return a.origin + uint16(len(a.code))
+}
+
+func (a *assembler) emit(bytes ...uint8) {
+	a.code = append(a.code, bytes...)
+}
+
+func (a *assembler) emit16(value int64) {
+	a.emit(uint8(value), uint8(value>>8))
+}
+
+// A number, a quoted character or a label
+func (a *assembler) number(text string) (int64, bool, error) {
+	lower := strings.ToLower(text)
+	switch {
+	case len(text) == 3 && text[0] == '\'' && text[2] == '\'':
+		return int64(text[1]), false, nil
+	case isIdentifier(lower):
+		if !a.final {
+			return int64(a.origin), true, nil
+		}
+		value, ok := a.labels[lower]
+		if !ok {
+			return 0, true, fmt.Errorf("undefined label %q", text)
+		}
+		return int64(value), true, nil
+	case strings.HasSuffix(lower, "h"):
+		value, err := strconv.ParseInt(strings.TrimSuffix(lower, "h"), 16, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("bad number %q", text)
+		}
+		return value, false, nil
+	}
+	value, err := strconv.ParseInt(lower, 0, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad number %q", text)
+	}
+	return value, false, nil
+}
+
+func (a *assembler) operand(text string) (operand, error) {
+	lower := strings.ToLower(text)
+
+	if i := indexOf(registers8, lower); i >= 0 {
+		return operand{kind: operandRegister, size: 8, index: uint8(i)}, nil
+	}
+	if i := indexOf(registers16, lower); i >= 0 {
+		return operand{kind: operandRegister, size: 16, index: uint8(i)}, nil
+	}
+	if i := indexOf(segmentRegisters, lower); i >= 0 {
+		return operand{kind: operandSegment, size: 16, index: uint8(i)}, nil
+	}
+
+	size := 0
+	if fields := strings.Fields(lower); len(fields) > 1 && (fields[0] == "byte" || fields[0] == "word") {
+		size = 8
+		if fields[0] == "word" {
+			size = 16
+		}
+		fields = fields[1:]
+		if len(fields) > 1 && fields[0] == "ptr" {
+			fields = fields[1:]
+		}
+		lower = strings.Join(fields, " ")
+	}
+
+	if strings.Contains(lower, "[") {
+		return a.memoryOperand(text, lower, size)
+	}
+	if size != 0 {
+		return operand{}, fmt.Errorf("size given for %q which isn't a memory operand", text)
+	}
+
+	if colon := strings.Index(lower, ":"); colon >= 0 {
+		segment, _, err := a.number(strings.TrimSpace(lower[:colon]))
+		if err != nil {
+			return operand{}, err
+		}
+		offset, _, err := a.number(strings.TrimSpace(lower[colon+1:]))
+		if err != nil {
+			return operand{}, err
+		}
+		return operand{kind: operandFarPointer, value: offset, segment: segment}, nil
+	}
+
+	value, symbolic, err := a.number(strings.TrimSpace(text))
+	if err != nil {
+		return operand{}, err
+	}
+	return operand{kind: operandImmediate, value: value, symbolic: symbolic}, nil
+}
+
+func (a *assembler) memoryOperand(text string, lower string, size int) (operand, error) {
+	o := operand{kind: operandMemory, size: size}
+
+	open, close := strings.Index(lower, "["), strings.LastIndex(lower, "]")
+	if close != len(lower)-1 {
+		return o, fmt.Errorf("bad memory operand %q", text)
+	}
+	inside := strings.TrimSpace(lower[open+1 : close])
+
+	// the override can go in front of the brackets or inside them
+	segment := strings.TrimSpace(lower[:open])
+	if segment != "" {
+		if !strings.HasSuffix(segment, ":") {
+			return o, fmt.Errorf("bad memory operand %q", text)
+		}
+		segment = strings.TrimSpace(strings.TrimSuffix(segment, ":"))
+	} else if colon := strings.Index(inside, ":"); colon >= 0 {
+		segment, inside = strings.TrimSpace(inside[:colon]), strings.TrimSpace(inside[colon+1:])
+	}
+	if segment != "" {
+		prefix, ok := segmentOverrides[segment]
+		if !ok {
+			return o, fmt.Errorf("bad segment override in %q", text)
+		}
+		o.override = prefix
+	}
+
+	var bases []string
+	var displacement int64
+	hasDisplacement := false
+	term := ""
+	negative := false
+	add := func() error {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return fmt.Errorf("bad memory operand %q", text)
+		}
+		if indexOf([]string{"bx", "bp", "si", "di"}, term) >= 0 {
+			if negative {
+				return fmt.Errorf("register subtracted in %q", text)
+			}
+			bases = append(bases, term)
+			return nil
+		}
+		value, symbolic, err := a.number(term)
+		if err != nil {
+			return err
+		}
+		if negative {
+			value = -value
+		}
+		displacement += value
+		hasDisplacement = true
+		o.symbolic = o.symbolic || symbolic
+		return nil
+	}
+	for _, c := range inside {
+		if (c == '+' || c == '-') && strings.TrimSpace(term) != "" {
+			if err := add(); err != nil {
+				return o, err
+			}
+			term, negative = "", c == '-'
+			continue
+		}
+		if c == '-' {
+			negative = !negative
+			continue
+		}
+		if c != '+' {
+			term += string(c)
+		}
+	}
+	if err := add(); err != nil {
+		return o, err
+	}
+
+	o.value = displacement
+	if len(bases) == 0 {
+		// [disp16]
+		o.mod, o.index = 0, 6
+		return o, nil
+	}
+	if len(bases) == 2 && (bases[0] == "si" || bases[0] == "di") {
+		bases[0], bases[1] = bases[1], bases[0]
+	}
+	rm, ok := addressingForms[strings.Join(bases, "+")]
+	if !ok {
+		return o, fmt.Errorf("no addressing form for %q", text)
+	}
+	o.index = rm
+
+	switch {
+	case o.symbolic:
+		o.mod = 2
+	case !hasDisplacement && rm != 6:
+		o.mod = 0
+	case displacement >= -128 && displacement <= 127:
+		o.mod = 1
+	default:
+		o.mod = 2
+	}
+	return o, nil
+}
+
+// Emits a memory operand's override, then the opcode, the modrm byte and any displacement
+func (a *assembler) emitModRm(opcode []uint8, reg uint8, rm operand) {
+	if rm.kind != operandMemory {
+		a.emit(opcode...)
+		a.emit(0xc0 | reg<<3 | rm.index)
+		return
+	}
+
+	if rm.override != 0 {
+		a.emit(rm.override)
+	}
+	a.emit(opcode...)
+	a.emit(rm.mod<<6 | reg<<3 | rm.index)
+	switch {
+	case rm.mod == 1:
+		a.emit(uint8(rm.value))
+	case rm.mod == 2, rm.mod == 0 && rm.index == 6:
+		a.emit16(rm.value)
+	}
+}
+
+func (a *assembler) emitImmediate(value int64, size int) {
+	if size == 8 {
+		a.emit(uint8(value))
+	} else {
+		a.emit16(value)
+	}
+}
+
+func checkImmediate(value int64, size int) error {
+	if size == 8 && (value < -0x80 || value > 0xff) || size == 16 && (value < -0x8000 || value > 0xffff) {
+		return fmt.Errorf("immediate %#x doesn't fit %d bits", value, size)
+	}
+	return nil
+}
+
+// Whether an immediate can take the sign extended imm8 form of an instruction
+func fitsImm8(o operand) bool {
+	value := int16(uint16(o.value))
+	return !o.symbolic && value >= -0x80 && value <= 0x7f
+}
+
+func isRegisterOrMemory(o operand) bool {
+	return o.kind == operandRegister || o.kind == operandMemory
+}
+
+// The size of a pair of operands, taken from whichever gives one
+func operandSize(dest operand, src operand) (int, error) {
+	if dest.size != 0 && src.size != 0 && dest.size != src.size {
+		return 0, fmt.Errorf("operand sizes don't match")
+	}
+	if dest.size != 0 {
+		return dest.size, nil
+	}
+	if src.size != 0 {
+		return src.size, nil
+	}
+	return 0, fmt.Errorf("operand size not specified")
+}
+
+func (a *assembler) assemble(s statement) error {
+	var ops []operand
+	for _, text := range s.operands {
+		o, err := a.operand(text)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, o)
+	}
+
+	a.emit(s.prefixes...)
+
+	if code, ok := implied[s.mnemonic]; ok && len(ops) == 0 {
+		a.emit(code...)
+		return nil
+	}
+	if n, ok := aluOps[s.mnemonic]; ok {
+		return a.alu(n, ops)
+	}
+	if n, ok := shiftOps[s.mnemonic]; ok {
+		return a.shift(n, ops)
+	}
+	if cc, ok := conditions[s.mnemonic]; ok {
+		return a.relative8([]uint8{0x70 + cc}, ops)
+	}
+
+	switch s.mnemonic {
+	case "db", "dw":
+		return a.data(s)
+	case "mov":
+		return a.mov(ops)
+	case "test":
+		return a.test(ops)
+	case "xchg":
+		return a.xchg(ops)
+	case "inc", "dec":
+		return a.incDec(s.mnemonic == "dec", ops)
+	case "push":
+		return a.push(ops)
+	case "pop":
+		return a.pop(ops)
+	case "jcxz":
+		return a.relative8([]uint8{0xe3}, ops)
+	case "jmp", "call":
+		return a.jump(s, ops)
+	case "ret", "retf":
+		if len(ops) != 1 || ops[0].kind != operandImmediate {
+			return fmt.Errorf("%s takes an imm16", s.mnemonic)
+		}
+		if s.mnemonic == "ret" {
+			a.emit(0xc2)
+		} else {
+			a.emit(0xca)
+		}
+		a.emit16(ops[0].value)
+		return checkImmediate(ops[0].value, 16)
+	case "int":
+		if len(ops) != 1 || ops[0].kind != operandImmediate {
+			return fmt.Errorf("int takes an imm8")
+		}
+		a.emit(0xcd, uint8(ops[0].value))
+		return checkImmediate(ops[0].value, 8)
+	case "in", "out":
+		return a.inOut(s.mnemonic == "out", ops)
+	}
+	if _, ok := implied[s.mnemonic]; ok {
+		return fmt.Errorf("%s takes no operands", s.mnemonic)
+	}
+	return fmt.Errorf("unknown instruction %q", s.mnemonic)
+}
+
+func (a *assembler) data(s statement) error {
+	for _, text := range s.operands {
+		if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+			for _, c := range []byte(text[1 : len(text)-1]) {
+				a.emit(c)
+				if s.mnemonic == "dw" {
+					a.emit(0)
+				}
+			}
+			continue
+		}
+		value, _, err := a.number(text)
+		if err != nil {
+			return err
+		}
+		if s.mnemonic == "db" {
+			a.emit(uint8(value))
+			if err := checkImmediate(value, 8); err != nil {
+				return err
+			}
+		} else {
+			a.emit16(value)
+			if err := checkImmediate(value, 16); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *assembler) alu(n uint8, ops []operand) error {
+	if len(ops) != 2 || !isRegisterOrMemory(ops[0]) {
+		return fmt.Errorf("unsupported operands")
+	}
+	dest, src := ops[0], ops[1]
+	size, err := operandSize(dest, src)
+	if err != nil {
+		return err
+	}
+	wide := uint8(0)
+	if size == 16 {
+		wide = 1
+	}
+
+	switch {
+	case src.kind == operandRegister:
+		// op r/m, r
+		a.emitModRm([]uint8{n<<3 | wide}, src.index, dest)
+	case src.kind == operandMemory && dest.kind == operandRegister:
+		// op r, r/m
+		a.emitModRm([]uint8{n<<3 | 0x2 | wide}, dest.index, src)
+	case src.kind == operandImmediate && dest.kind == operandRegister && dest.index == 0:
+		// op al, imm8 and op ax, imm16
+		a.emit(n<<3 | 0x4 | wide)
+		a.emitImmediate(src.value, size)
+	case src.kind == operandImmediate && size == 16 && fitsImm8(src):
+		a.emitModRm([]uint8{0x83}, n, dest)
+		a.emit(uint8(src.value))
+	case src.kind == operandImmediate:
+		a.emitModRm([]uint8{0x80 | wide}, n, dest)
+		a.emitImmediate(src.value, size)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	if src.kind == operandImmediate {
+		return checkImmediate(src.value, size)
+	}
+	return nil
+}
+
+func (a *assembler) shift(n uint8, ops []operand) error {
+	if len(ops) != 2 || !isRegisterOrMemory(ops[0]) {
+		return fmt.Errorf("unsupported operands")
+	}
+	dest, count := ops[0], ops[1]
+	if dest.size == 0 {
+		return fmt.Errorf("operand size not specified")
+	}
+	wide := uint8(0)
+	if dest.size == 16 {
+		wide = 1
+	}
+
+	switch {
+	case count.kind == operandRegister && count.size == 8 && count.index == 1:
+		// by cl
+		a.emitModRm([]uint8{0xd2 | wide}, n, dest)
+	case count.kind == operandImmediate && count.value == 1 && !count.symbolic:
+		a.emitModRm([]uint8{0xd0 | wide}, n, dest)
+	case count.kind == operandImmediate:
+		a.emitModRm([]uint8{0xc0 | wide}, n, dest)
+		a.emit(uint8(count.value))
+		return checkImmediate(count.value, 8)
+	default:
+		return fmt.Errorf("shift count must be 1, cl or an imm8")
+	}
+	return nil
+}
+
+func (a *assembler) mov(ops []operand) error {
+	if len(ops) != 2 {
+		return fmt.Errorf("mov takes two operands")
+	}
+	dest, src := ops[0], ops[1]
+
+	if dest.kind == operandSegment || src.kind == operandSegment {
+		switch {
+		case dest.kind == operandSegment && isRegisterOrMemory(src) && src.size != 8:
+			a.emitModRm([]uint8{0x8e}, dest.index, src)
+		case src.kind == operandSegment && isRegisterOrMemory(dest) && dest.size != 8:
+			a.emitModRm([]uint8{0x8c}, src.index, dest)
+		default:
+			return fmt.Errorf("unsupported operands")
+		}
+		return nil
+	}
+
+	size, err := operandSize(dest, src)
+	if err != nil {
+		return err
+	}
+	wide := uint8(0)
+	if size == 16 {
+		wide = 1
+	}
+
+	switch {
+	case dest.kind == operandRegister && src.kind == operandImmediate:
+		// mov r8, imm8 and mov r16, imm16
+		a.emit(0xb0 | wide<<3 | dest.index)
+		a.emitImmediate(src.value, size)
+		return checkImmediate(src.value, size)
+	case isRegisterOrMemory(dest) && src.kind == operandRegister:
+		a.emitModRm([]uint8{0x88 | wide}, src.index, dest)
+	case dest.kind == operandRegister && src.kind == operandMemory:
+		a.emitModRm([]uint8{0x8a | wide}, dest.index, src)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+func (a *assembler) test(ops []operand) error {
+	if len(ops) != 2 || !isRegisterOrMemory(ops[0]) {
+		return fmt.Errorf("unsupported operands")
+	}
+	dest, src := ops[0], ops[1]
+	size, err := operandSize(dest, src)
+	if err != nil {
+		return err
+	}
+	wide := uint8(0)
+	if size == 16 {
+		wide = 1
+	}
+
+	switch {
+	case src.kind == operandRegister:
+		a.emitModRm([]uint8{0x84 | wide}, src.index, dest)
+	case src.kind == operandImmediate && dest.kind == operandRegister && dest.index == 0:
+		a.emit(0xa8 | wide)
+		a.emitImmediate(src.value, size)
+		return checkImmediate(src.value, size)
+	case src.kind == operandImmediate:
+		a.emitModRm([]uint8{0xf6 | wide}, 0, dest)
+		a.emitImmediate(src.value, size)
+		return checkImmediate(src.value, size)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+func (a *assembler) xchg(ops []operand) error {
+	if len(ops) != 2 {
+		return fmt.Errorf("xchg takes two operands")
+	}
+	dest, src := ops[0], ops[1]
+	if dest.kind != operandRegister {
+		dest, src = src, dest
+	}
+	if dest.kind != operandRegister || !isRegisterOrMemory(src) {
+		return fmt.Errorf("unsupported operands")
+	}
+	size, err := operandSize(dest, src)
+	if err != nil {
+		return err
+	}
+	if size == 16 {
+		a.emitModRm([]uint8{0x87}, dest.index, src)
+	} else {
+		a.emitModRm([]uint8{0x86}, dest.index, src)
+	}
+	return nil
+}
+
+func (a *assembler) incDec(dec bool, ops []operand) error {
+	if len(ops) != 1 || !isRegisterOrMemory(ops[0]) {
+		return fmt.Errorf("unsupported operands")
+	}
+	o := ops[0]
+	n := uint8(0)
+	if dec {
+		n = 1
+	}
+
+	switch {
+	case o.kind == operandRegister && o.size == 16:
+		a.emit(0x40 | n<<3 | o.index)
+	case o.size == 8:
+		a.emitModRm([]uint8{0xfe}, n, o)
+	case o.size == 16:
+		a.emitModRm([]uint8{0xff}, n, o)
+	default:
+		return fmt.Errorf("operand size not specified")
+	}
+	return nil
+}
+
+func (a *assembler) push(ops []operand) error {
+	if len(ops) != 1 {
+		return fmt.Errorf("push takes one operand")
+	}
+	o := ops[0]
+
+	switch {
+	case o.kind == operandRegister && o.size == 16:
+		a.emit(0x50 | o.index)
+	case o.kind == operandSegment && o.index < 4:
+		a.emit(0x06 | o.index<<3)
+	case o.kind == operandSegment:
+		a.emit(0x0f, 0xa0|(o.index-4)<<3)
+	case o.kind == operandImmediate && fitsImm8(o):
+		a.emit(0x6a, uint8(o.value))
+	case o.kind == operandImmediate:
+		a.emit(0x68)
+		a.emit16(o.value)
+		return checkImmediate(o.value, 16)
+	case o.kind == operandMemory && o.size == 16:
+		a.emitModRm([]uint8{0xff}, 6, o)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+func (a *assembler) pop(ops []operand) error {
+	if len(ops) != 1 {
+		return fmt.Errorf("pop takes one operand")
+	}
+	o := ops[0]
+
+	switch {
+	case o.kind == operandRegister && o.size == 16:
+		a.emit(0x58 | o.index)
+	case o.kind == operandSegment && o.index == 1:
+		return fmt.Errorf("pop cs is not an instruction")
+	case o.kind == operandSegment && o.index < 4:
+		a.emit(0x07 | o.index<<3)
+	case o.kind == operandSegment:
+		a.emit(0x0f, 0xa1|(o.index-4)<<3)
+	case o.kind == operandMemory && o.size == 16:
+		a.emitModRm([]uint8{0x8f}, 0, o)
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+// The displacement from the end of an instruction, whose size bytes are still to be emitted, to its target
+func (a *assembler) displacement(target operand, size int) int64 {
+	return target.value - int64(a.address()) - int64(size)
+}
+
+func (a *assembler) relative8(opcode []uint8, ops []operand) error {
+	if len(ops) != 1 || ops[0].kind != operandImmediate {
+		return fmt.Errorf("jump takes a label or address")
+	}
+	a.emit(opcode...)
+	displacement := a.displacement(ops[0], 1)
+	a.emit(uint8(displacement))
+	if a.final && (displacement < -0x80 || displacement > 0x7f) {
+		return fmt.Errorf("jump target is %d bytes away, out of rel8 range", displacement)
+	}
+	return nil
+}
+
+func (a *assembler) jump(s statement, ops []operand) error {
+	if len(ops) != 1 {
+		return fmt.Errorf("%s takes one operand", s.mnemonic)
+	}
+	o := ops[0]
+	call := s.mnemonic == "call"
+
+	switch {
+	case s.qualifier == "short" && !call:
+		return a.relative8([]uint8{0xeb}, ops)
+	case o.kind == operandFarPointer:
+		if call {
+			a.emit(0x9a)
+		} else {
+			a.emit(0xea)
+		}
+		a.emit16(o.value)
+		a.emit16(o.segment)
+	case s.qualifier == "far":
+		return fmt.Errorf("far %s takes a segment:offset", s.mnemonic)
+	case o.kind == operandImmediate:
+		if call {
+			a.emit(0xe8)
+		} else {
+			a.emit(0xe9)
+		}
+		a.emit16(a.displacement(o, 2))
+	case isRegisterOrMemory(o) && o.size != 8:
+		if call {
+			a.emitModRm([]uint8{0xff}, 2, o)
+		} else {
+			a.emitModRm([]uint8{0xff}, 4, o)
+		}
+	default:
+		return fmt.Errorf("unsupported operands")
+	}
+	return nil
+}
+
+func (a *assembler) inOut(out bool, ops []operand) error {
+	if len(ops) != 2 {
+		return fmt.Errorf("in and out take two operands")
+	}
+	accumulator, port := ops[0], ops[1]
+	if out {
+		accumulator, port = port, accumulator
+	}
+	if accumulator.kind != operandRegister || accumulator.index != 0 {
+		return fmt.Errorf("the data register must be al or ax")
+	}
+
+	opcode := uint8(0xe4)
+	if accumulator.size == 16 {
+		opcode |= 0x1
+	}
+	if out {
+		opcode |= 0x2
+	}
+
+	switch {
+	case port.kind == operandRegister && port.size == 16 && port.index == 2:
+		// port in dx
+		a.emit(opcode | 0x8)
+	case port.kind == operandImmediate:
+		a.emit(opcode, uint8(port.value))
+		return checkImmediate(port.value, 8)
+	default:
+		return fmt.Errorf("the port must be dx or an imm8")
+	}
+	return nil
+}
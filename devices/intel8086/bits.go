@@ -0,0 +1,171 @@
+package intel8086
+
+import (
+	"fmt"
+)
+
+/*
+	Bit tests
+	BT, BTS, BTR and BTC copy the selected bit of the destination into CF, then leave it, set it, clear it or
+	complement it. With an immediate index (0x0F 0xBA) the index is taken modulo the operand size, as it is for
+	a register destination. With a register index and a memory destination the index is a signed bit offset from
+	the effective address and may reach well past the operand: index/8 is added to the address and index%8 picks
+	the bit within that byte. The address is computed once for the read and the write back.
+*/
+
+const (
+	bitOpTest = iota
+	bitOpSet
+	bitOpReset
+	bitOpComplement
+)
+
+var bitOpNames = []string{"bt", "bts", "btr", "btc"}
+
+// Copies the bit into CF and returns the value with the operation applied to it
+func (core *CpuCore) applyBitOp(value uint32, bit uint32, op uint8) uint32 {
+	mask := uint32(1) << bit
+	core.registers.SetFlag(CarryFlag, value&mask != 0)
+	core.undefineFlags(ParityFlag | AdjustFlag | SignFlag | OverFlowFlag)
+
+	switch op {
+	case bitOpSet:
+		return value | mask
+	case bitOpReset:
+		return value &^ mask
+	case bitOpComplement:
+		return value ^ mask
+	}
+	return value
+}
+
+// Applies a bit operation to the r/m operand itself, the bit index wraps at the operand size
+func (core *CpuCore) bitOpOperand(modrm *ModRm, bit uint32, op uint8) (string, error) {
+	if core.flags.OperandSizeOverrideEnabled {
+		bit &= 31
+		if op == bitOpTest {
+			value, name, err := core.readRm32(modrm)
+			if err != nil {
+				return name, err
+			}
+			core.applyBitOp(*value, bit, op)
+			return name, nil
+		}
+		return core.modifyRm32(modrm, func(value uint32) uint32 {
+			return core.applyBitOp(value, bit, op)
+		})
+	}
+
+	bit &= 15
+	if op == bitOpTest {
+		value, name, err := core.readRm16(modrm)
+		if err != nil {
+			return name, err
+		}
+		core.applyBitOp(uint32(*value), bit, op)
+		return name, nil
+	}
+	return core.modifyRm16(modrm, func(value uint16) uint16 {
+		return uint16(core.applyBitOp(uint32(value), bit, op))
+	})
+}
+
+// Applies a bit operation to the bit index bits away from the effective address of a memory operand
+func (core *CpuCore) bitOpMemory(modrm *ModRm, index int32, op uint8) (string, error) {
+	addressMode := modrm.wrapOffset(modrm.effectiveAddress(core) + uint32(index>>3))
+	bit := uint32(index & 0x7)
+	destName := fmt.Sprintf("byte_F%#04x", addressMode)
+
+	access := accessWrite
+	if op == bitOpTest {
+		access = accessRead
+	}
+	address, err := core.translateRm(modrm, addressMode, 1, access)
+	if err != nil {
+		return destName, err
+	}
+
+	value, err := core.memoryAccessController.ReadAddr8(address)
+	if err != nil {
+		return destName, err
+	}
+
+	if op == bitOpTest {
+		core.watchData(address, 1, false)
+		core.applyBitOp(uint32(value), bit, op)
+		return destName, nil
+	}
+
+	core.watchData(address, 1, true)
+	return destName, core.memoryAccessController.WriteAddr8(address, uint8(core.applyBitOp(uint32(value), bit, op)))
+}
+
+// BT (0x0F 0xA3), BTS (0x0F 0xAB), BTR (0x0F 0xB3) and BTC (0x0F 0xBB) r/m16, r16 / r/m32, r32
+func INSTR_BIT_TEST(core *CpuCore) {
+	var index int32
+	var rmStr, rStr string
+	var op uint8
+
+	core.currentByteAddr++
+	op = (core.currentOpCodeBeingExecuted >> 3) & 0x3
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		if core.flags.OperandSizeOverrideEnabled {
+			var r32 *uint32
+			r32, rStr = core.readR32(&modrm)
+			index = int32(*r32)
+		} else {
+			var r16 *uint16
+			r16, rStr = core.readR16(&modrm)
+			index = int32(int16(*r16))
+		}
+
+		if modrm.mod == 3 {
+			rmStr, err = core.bitOpOperand(&modrm, uint32(index), op)
+		} else {
+			rmStr, err = core.bitOpMemory(&modrm, index, op)
+		}
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] %s %s, %s", core.GetCurrentlyExecutingInstructionAddress(), bitOpNames[op], rmStr, rStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// BT, BTS, BTR and BTC r/m16, imm8 / r/m32, imm8 (0x0F 0xBA /4-/7)
+func INSTR_BIT_TEST_IMM(core *CpuCore) {
+	var bit uint8
+	var rmStr string
+	var op uint8
+
+	core.currentByteAddr++
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		bit, err = core.readImm8()
+		if err != nil { goto eof }
+
+		if modrm.reg < 4 {
+			core.raiseException(NewFault(ExceptionInvalidOpcode))
+			goto eof
+		}
+		op = modrm.reg - 4
+
+		rmStr, err = core.bitOpOperand(&modrm, uint32(bit), op)
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] %s %s, %#02x", core.GetCurrentlyExecutingInstructionAddress(), bitOpNames[op], rmStr, bit)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -1,145 +1,504 @@
 package intel8086
 
 import (
+	"fmt"
 	"github.com/andrewjc/threeatesix/common"
-	"log"
 )
 
 func INSTR_RET_NEAR(core *CpuCore) {
+	var ip uint32
+	var releaseBytes uint16
+	var err error
 
-	log.Printf("[%#04x] retn", core.GetCurrentCodePointer())
+	core.currentByteAddr++
 
-	stackPntrAddr := core.registers.SP
+	if core.currentOpCodeBeingExecuted == 0xC2 {
+		// ret imm16, release imm16 bytes of parameters
+		releaseBytes, err = core.readImm16()
+		if err != nil { goto eof }
+	}
+
+	// a 32 bit operand size pops all of EIP
+	ip, err = core.popOperand()
+	if err != nil { goto eof }
 
-	core.registers.IP = uint16(stackPntrAddr)
+	core.registers.SetSP(core.registers.SP + releaseBytes)
+	core.setEIP(ip)
 
-	core.registers.SP += 2
+	core.logger.Tracef("[%#04x] retn (%#04x)", core.GetCurrentlyExecutingInstructionAddress(), ip)
+	core.recordReturn()
+	return
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
-func INSTR_JMP_FAR_PTR16(core *CpuCore) {
-	destAddr, err := core.memoryAccessController.ReadAddr16(uint32(core.GetCurrentCodePointer()) + 1)
-	segment, err := core.memoryAccessController.ReadAddr16(uint32(core.GetCurrentCodePointer()) + 3)
+func INSTR_CALL(core *CpuCore) {
+	var returnIP uint32
+
+	switch core.currentOpCodeBeingExecuted {
+	case 0xE8:
+		{
+			// call rel16 / rel32
+			core.currentByteAddr++
+			offset, err := core.readRelOperand()
+			if err != nil { goto eof }
+
+			returnIP = core.nextInstructionPointer()
+			err = core.pushOperand(returnIP)
+			if err != nil { goto eof }
+
+			core.jumpRelative(offset)
+			core.logger.Tracef("[%#04x] call %#04x (NEAR_REL)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.EIP)
+			core.recordCall(false, core.registers.CS.base, uint16(returnIP))
+			return
+		}
+	case 0x9A:
+		{
+			// call ptr16:16 / ptr16:32
+			core.currentByteAddr++
+			segment, offset, err := core.readImmFarPointer()
+			if err != nil { goto eof }
+
+			returnIP = core.nextInstructionPointer()
+			err = core.callFar(segment, offset, returnIP, core.flags.OperandSizeOverrideEnabled)
+			if err != nil {
+				core.raiseProtectionFault(err)
+				goto eof
+			}
+
+			core.logger.Tracef("[%#04x] call %#04x:%#04x (FAR_PTR)", core.GetCurrentlyExecutingInstructionAddress(), segment, offset)
+			return
+		}
+	case 0xFF:
+		{
+			core.currentByteAddr++
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+
+			returnIP = core.nextInstructionPointer()
+
+			if modrm.reg == 2 {
+				// call r/m16 / r/m32
+				var target uint32
+				var targetName string
+				if core.flags.OperandSizeOverrideEnabled {
+					target32, name, err := core.readRm32(&modrm)
+					if err != nil { goto eof }
+					target, targetName = *target32, name
+				} else {
+					target16, name, err := core.readRm16(&modrm)
+					if err != nil { goto eof }
+					target, targetName = uint32(*target16), name
+				}
+
+				err = core.pushOperand(returnIP)
+				if err != nil { goto eof }
+
+				core.setEIP(target)
+				core.logger.Tracef("[%#04x] call %s (NEAR_RM)", core.GetCurrentlyExecutingInstructionAddress(), targetName)
+				core.recordCall(false, core.registers.CS.base, uint16(returnIP))
+				return
+			}
+
+			// call m16:16 / m16:32
+			segment, offset, err := core.readMemoryFarPointer(&modrm)
+			if err != nil { goto eof }
+
+			err = core.callFar(segment, offset, returnIP, core.flags.OperandSizeOverrideEnabled)
+			if err != nil {
+				core.raiseProtectionFault(err)
+				goto eof
+			}
+
+			core.logger.Tracef("[%#04x] call %#04x:%#04x (FAR_MEM)", core.GetCurrentlyExecutingInstructionAddress(), segment, offset)
+			return
+		}
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Pushes the return CS:IP and transfers control to segment:offset, or through the call gate or task segment references.
+// A wide call pushes the return address as two dwords, for a 16:32 pointer.
+func (core *CpuCore) callFar(segment uint16, offset uint32, returnIP uint32, wide bool) error {
+	if core.isCallGateSelector(segment) {
+		return core.callGate(segment, uint16(returnIP))
+	}
+
+	if core.isTaskSelector(segment) {
+		// the nested task returns with IRET, so there's no frame for the shadow call stack
+		return core.taskSwitch(segment, taskSwitchCall, uint16(returnIP))
+	}
+
+	return core.callFarDirect(segment, offset, returnIP, wide)
+}
 
-	log.Printf("[%#04x] JMP %#04x:%#04x (FAR_PTR16)", core.GetCurrentlyExecutingInstructionAddress(), segment, destAddr)
+func (core *CpuCore) callFarDirect(segment uint16, offset uint32, returnIP uint32, wide bool) error {
+	returnCS := core.registers.CS.base
+	savedCS := core.registers.CS
+	savedSP := core.registers.SP
+
+	push := func(value uint32) error {
+		if wide {
+			return core.pushDword(value)
+		}
+		return core.pushWord(uint16(value))
+	}
+
+	err := push(uint32(returnCS))
+	if err != nil {
+		return err
+	}
+	err = push(returnIP)
+	if err != nil {
+		core.registers.SetSP(savedSP)
+		return err
+	}
+
+	err = core.loadCodeSegment(segment)
 	if err == nil {
-		core.writeSegmentRegister(&core.registers.CS, segment)
+		err = core.checkFarOffset(offset)
+	}
+	if err != nil {
+		core.registers.CS = savedCS
+		core.registers.SetSP(savedSP)
+		return err
 	}
 
-	core.registers.IP = destAddr
+	core.setEIP(offset)
+	core.recordCall(true, returnCS, uint16(returnIP))
+
+	return nil
 }
 
-func INSTR_JMP_FAR_M16(core *CpuCore, modrm *ModRm) {
-	if modrm.mod == 3 {
-		addr := core.registers.registers16Bit[modrm.rm]
-		core.registers.IP = *addr
-		log.Printf("[%#04x] JMP %#04x (JMP_FAR_M16)", core.GetCurrentlyExecutingInstructionAddress(), uint16(*addr))
+// Reads the ptr16:16, or with a 0x66 prefix ptr16:32, immediate of a direct far jump or call
+func (core *CpuCore) readImmFarPointer() (uint16, uint32, error) {
+	var offset uint32
+	var err error
+
+	if core.flags.OperandSizeOverrideEnabled {
+		offset, err = core.readImm32()
 	} else {
-		addr := modrm.getAddressMode16(core)
-		core.registers.IP = addr
-		log.Printf("[%#04x] JMP %#04x (JMP_FAR_M16)", core.GetCurrentlyExecutingInstructionAddress(), uint16(addr))
+		var offset16 uint16
+		offset16, err = core.readImm16()
+		offset = uint32(offset16)
+	}
+	if err != nil {
+		return 0, 0, err
 	}
 
+	segment, err := core.readImm16()
+	return segment, offset, err
 }
 
-func INSTR_JMP_NEAR_REL16(core *CpuCore) {
+// Reads the m16:16, or with a 0x66 prefix m16:32, operand of an indirect far jump or call. The offset comes first.
+func (core *CpuCore) readMemoryFarPointer(modrm *ModRm) (uint16, uint32, error) {
+	var offset uint32
+	var err error
 
-	offset, err := common.Int16Err(core.memoryAccessController.ReadAddr16(uint32(core.GetCurrentCodePointer()) + 1))
+	size := uint32(2)
+	if core.flags.OperandSizeOverrideEnabled {
+		size = 4
+	}
 
+	addressMode, err := core.translateRm(modrm, modrm.effectiveAddress(core), size+2, accessRead)
 	if err != nil {
-		return
+		return 0, 0, err
 	}
 
-	var destAddr = int16(core.registers.IP + 3)
+	if size == 4 {
+		offset, err = core.memoryAccessController.ReadAddr32(addressMode)
+	} else {
+		var offset16 uint16
+		offset16, err = core.memoryAccessController.ReadAddr16(addressMode)
+		offset = uint32(offset16)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
 
-	destAddr = destAddr + int16(offset)
+	segment, err := core.memoryAccessController.ReadAddr16(addressMode + size)
+	return segment, offset, err
+}
 
-	log.Printf("[%#04x] JMP %#04x (NEAR_REL16)", core.GetCurrentlyExecutingInstructionAddress(), uint16(destAddr))
-	core.registers.IP = uint16(destAddr)
+// Checks the offset of a far transfer against the limit of the code segment it lands in. In real mode the limit
+// is 0xFFFF, which only a 32 bit offset can pass.
+func (core *CpuCore) checkFarOffset(offset uint32) error {
+	limit := uint32(0xFFFF)
+	if core.mode == common.PROTECTED_MODE {
+		limit = core.registers.CS.limit
+	}
+	if offset > limit {
+		return common.GeneralProtectionFault{}
+	}
+	return nil
 }
 
-func INSTR_JZ_SHORT_REL8(core *CpuCore) {
+// Transfers control to segment:offset, or switches to the task segment it references
+func (core *CpuCore) jumpFar(segment uint16, offset uint32) error {
+	if core.isTaskSelector(segment) {
+		nextIP := core.registers.IP + uint16(core.currentByteAddr-core.currentByteDecodeStart)
+		return core.taskSwitch(segment, taskSwitchJump, nextIP)
+	}
 
-	offset, err := common.Int8Err(core.memoryAccessController.ReadAddr8(uint32(core.GetCurrentCodePointer()) + 1))
+	savedCS := core.registers.CS
 
+	err := core.loadCodeSegment(segment)
+	if err == nil {
+		err = core.checkFarOffset(offset)
+	}
 	if err != nil {
-		return
+		core.registers.CS = savedCS
+		return err
 	}
 
-	var destAddr = uint16(core.registers.IP + 2)
+	core.setEIP(offset)
+	return nil
+}
 
-	destAddr = destAddr + uint16(offset)
+// JMP ptr16:16 / ptr16:32 (0xEA)
+func INSTR_JMP_FAR_PTR16(core *CpuCore) {
+	var segment uint16
+	var offset uint32
+	var err error
 
-	log.Printf("[%#04x] JZ %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), uint16(destAddr))
-	if core.registers.GetFlag(ZeroFlag) {
-		core.registers.IP = uint16(destAddr)
-		log.Printf("[%#04x]   |-> jumped", core.GetCurrentlyExecutingInstructionAddress())
-	} else {
-		core.registers.IP = uint16(uint16(core.GetIP() + 2))
-		log.Printf("[%#04x]   |-> no jump", core.GetCurrentlyExecutingInstructionAddress())
+	core.currentByteAddr++
+
+	segment, offset, err = core.readImmFarPointer()
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] JMP %#04x:%#04x (FAR_PTR)", core.GetCurrentlyExecutingInstructionAddress(), segment, offset)
+
+	err = core.jumpFar(segment, offset)
+	if err != nil {
+		if !core.raiseProtectionFault(err) {
+			core.logger.Errorf("[%#04x] JMP %#04x:%#04x failed: %s", core.GetCurrentlyExecutingInstructionAddress(), segment, offset, err.Error())
+		}
+		goto eof
 	}
+	return
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
-func INSTR_JNZ_SHORT_REL8(core *CpuCore) {
+// JMP m16:16 / m16:32 (0xFF /5)
+func INSTR_JMP_FAR_MEM(core *CpuCore) {
+	var segment uint16
+	var offset uint32
+
+	core.currentByteAddr++
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
 
-	offset, err := common.Int8Err(core.memoryAccessController.ReadAddr8(uint32(core.GetCurrentCodePointer()) + 1))
+		segment, offset, err = core.readMemoryFarPointer(&modrm)
+		if err != nil { goto eof }
 
+		core.logger.Tracef("[%#04x] JMP %#04x:%#04x (FAR_MEM)", core.GetCurrentlyExecutingInstructionAddress(), segment, offset)
+
+		err = core.jumpFar(segment, offset)
+		if err != nil {
+			if !core.raiseProtectionFault(err) {
+				core.logger.Errorf("[%#04x] JMP %#04x:%#04x failed: %s", core.GetCurrentlyExecutingInstructionAddress(), segment, offset, err.Error())
+			}
+			goto eof
+		}
+		return
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_JMP_FAR_M16(core *CpuCore, modrm *ModRm) {
+	// the target is the value of the operand, not its address
+	addr, addrName, err := core.readRm16(modrm)
 	if err != nil {
 		return
 	}
 
-	var destAddr = uint16(core.registers.IP + 2)
+	core.registers.IP = *addr
+	core.logger.Tracef("[%#04x] JMP %s (JMP_FAR_M16)", core.GetCurrentlyExecutingInstructionAddress(), addrName)
+}
 
-	destAddr = destAddr + uint16(offset)
+// JMP rel16 / rel32 (0xE9)
+func INSTR_JMP_NEAR_REL16(core *CpuCore) {
+	var offset int32
+	var err error
 
-	log.Printf("[%#04x] JNZ %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), uint16(destAddr))
-	if !core.registers.GetFlag(ZeroFlag) {
-		core.registers.IP = uint16(destAddr)
-		log.Printf("[%#04x]   |-> jumped", core.GetCurrentlyExecutingInstructionAddress())
-	} else {
-		core.registers.IP = uint16(core.GetIP() + 2)
-		log.Printf("[%#04x]   |-> no jump", core.GetCurrentlyExecutingInstructionAddress())
+	core.currentByteAddr++
+
+	offset, err = core.readRelOperand()
+	if err != nil { goto eof }
+
+	core.jumpRelative(offset)
+	core.logger.Tracef("[%#04x] JMP %#04x (NEAR_REL)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.EIP)
+	return
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Reads the rel8 displacement of a short jump, sign extended
+func (core *CpuCore) readRel8Operand() (int32, error) {
+	value, err := core.readImm8()
+	return int32(int8(value)), err
+}
+
+func INSTR_JCC_SHORT_REL8(core *CpuCore) {
+	// 0x70-0x7F, the condition is the low nibble of the opcode
+	cc := core.currentOpCodeBeingExecuted & 0xF
+
+	core.currentByteAddr++
+
+	offset, err := core.readRel8Operand()
+	if err != nil {
+		core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+		return
 	}
 
+	core.logger.Tracef("[%#04x] J%s %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), conditionMnemonic(cc), core.relativeJumpTarget(offset))
+	if EvaluateCondition(core, cc) {
+		core.jumpRelative(offset)
+		core.logger.Tracef("[%#04x]   |-> jumped", core.GetCurrentlyExecutingInstructionAddress())
+	} else {
+		core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+		core.logger.Tracef("[%#04x]   |-> no jump", core.GetCurrentlyExecutingInstructionAddress())
+	}
 }
 
+// JCXZ / JECXZ (0xE3), the address size picks whether CX or ECX is tested
 func INSTR_JCXZ_SHORT_REL8(core *CpuCore) {
 
-	offset, err := common.Int8Err(core.memoryAccessController.ReadAddr8(uint32(core.GetCurrentCodePointer()) + 1))
+	core.currentByteAddr++
 
+	offset, err := core.readRel8Operand()
 	if err != nil {
+		core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 		return
 	}
 
-	var destAddr = uint16(core.registers.IP + 2)
-
-	destAddr = destAddr + uint16(offset)
+	name, count := "JCXZ", uint32(core.registers.CX)
+	if core.flags.AddressSizeOverrideEnabled {
+		name, count = "JECXZ", core.registers.ECX
+	}
 
-	log.Printf("[%#04x] JCXZ %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), uint16(destAddr))
-	if core.registers.CX == 0 {
-		core.registers.IP = uint16(destAddr)
-		log.Printf("[%#04x]   |-> jumped", core.GetCurrentlyExecutingInstructionAddress())
+	core.logger.Tracef("[%#04x] %s %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), name, core.relativeJumpTarget(offset))
+	if count == 0 {
+		core.jumpRelative(offset)
+		core.logger.Tracef("[%#04x]   |-> jumped", core.GetCurrentlyExecutingInstructionAddress())
 	} else {
-		core.registers.IP = uint16(core.GetIP() + 2)
-		log.Printf("[%#04x]   |-> no jump", core.GetCurrentlyExecutingInstructionAddress())
+		core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+		core.logger.Tracef("[%#04x]   |-> no jump", core.GetCurrentlyExecutingInstructionAddress())
 	}
 
 }
 
 func INSTR_JMP_SHORT_REL8(core *CpuCore) {
 
-	offset, err := common.Int8Err(core.memoryAccessController.ReadAddr8(uint32(core.GetCurrentCodePointer()) + 1))
+	core.currentByteAddr++
 
+	offset, err := core.readRel8Operand()
 	if err != nil {
+		core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 		return
 	}
 
-	var destAddr = uint16(core.registers.IP + 2)
+	core.jumpRelative(offset)
+	core.logger.Tracef("[%#04x] JMP %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.EIP)
 
-	destAddr = destAddr + uint16(offset)
+}
 
-	log.Printf("[%#04x] JMP %#04x (SHORT REL8)", core.GetCurrentlyExecutingInstructionAddress(), uint16(destAddr))
-	core.registers.IP = uint16(destAddr)
 
+
+func INSTR_RETF(core *CpuCore) {
+	var ip, cs, sp, ss, releaseBytes uint16
+	var savedSP uint16
+	var savedCS, savedSS SegmentRegister
+	var err error
+
+	core.currentByteAddr++
+
+	if core.currentOpCodeBeingExecuted == 0xCA {
+		// retf imm16, release imm16 bytes of parameters
+		releaseBytes, err = core.readImm16()
+		if err != nil { goto eof }
+	}
+
+	savedSP = core.registers.SP
+
+	savedCS = core.registers.CS
+	savedSS = core.registers.SS
+
+	// a 0x66 prefix pops the dwords pushed by a call through a 16:32 pointer
+	ip, err = core.popOperandWord()
+	if err != nil { goto fault }
+	cs, err = core.popOperandWord()
+	if err != nil { goto fault }
+
+	core.registers.SetSP(core.registers.SP + releaseBytes)
+
+	if core.mode == common.PROTECTED_MODE && uint8(cs&0x3) > core.currentPrivilegeLevel() {
+		// return to an outer privilege level, the caller's stack was pushed by the call gate
+		sp, err = core.popWord()
+		if err != nil { goto fault }
+		ss, err = core.popWord()
+		if err != nil { goto fault }
+
+		err = core.loadCodeSegment(cs)
+		if err != nil { goto fault }
+		err = core.loadSegmentRegister(&core.registers.SS, ss)
+		if err != nil { goto fault }
+
+		core.registers.SetSP(sp + releaseBytes)
+	} else {
+		err = core.loadCodeSegment(cs)
+		if err != nil { goto fault }
+	}
+
+	core.registers.IP = ip
+
+	core.logger.Tracef("[%#04x] retf (%#04x:%#04x)", core.GetCurrentlyExecutingInstructionAddress(), cs, ip)
+	core.recordReturn()
+	return
+
+	fault:
+	core.registers.CS = savedCS
+	core.registers.SS = savedSS
+	core.registers.SetSP(savedSP)
+	if !core.raiseProtectionFault(err) {
+		core.logger.Errorf("[%#04x] retf failed: %s", core.GetCurrentlyExecutingInstructionAddress(), err.Error())
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
+// Calls emulated code at segment:offset from the host, as if by a far call, and runs the core until it
+// returns to the caller. Used by the bios services to invoke option rom entry points.
+func (core *CpuCore) CallFar(segment uint16, offset uint16, maxSteps int) error {
+	returnCS := core.registers.CS.base
+	returnIP := core.registers.IP
+	returnSP := core.registers.SP
+
+	err := core.callFar(segment, uint32(offset), uint32(returnIP), false)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < maxSteps; i++ {
+		core.Step()
 
+		if core.registers.CS.base == returnCS && core.registers.IP == returnIP && core.registers.SP == returnSP {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("far call to %04x:%04x did not return within %d steps", segment, offset, maxSteps)
+}
@@ -0,0 +1,39 @@
+package intel8086
+
+import "math/bits"
+
+/*
+	BSWAP
+	BSWAP r32 (0x0F 0xC8+reg) reverses the byte order of a register. Flags are left alone.
+
+	With a 16 bit operand size the result is undefined. Real parts clear the low word, so that's what the 16 bit form
+	does here: the 16 bit register is zeroed.
+*/
+
+func INSTR_BSWAP(core *CpuCore) {
+	var index uint8
+	var name string
+
+	core.currentByteAddr++
+
+	if !core.features.ByteSwap {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	index = core.currentOpCodeBeingExecuted & 0x7
+
+	if core.flags.OperandSizeOverrideEnabled {
+		reg := core.registers.registers32Bit[index]
+		*reg = bits.ReverseBytes32(*reg)
+		name = core.registers.index32ToString(index)
+	} else {
+		*core.registers.registers16Bit[index] = 0
+		name = core.registers.index16ToString(index)
+	}
+
+	core.logger.Tracef("[%#04x] bswap %s", core.GetCurrentlyExecutingInstructionAddress(), name)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
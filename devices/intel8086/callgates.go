@@ -0,0 +1,199 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Far calls through call gates
+	A call gate names the target code segment and entry point. Calling through a gate to a more privileged
+	non-conforming segment switches to the target ring's stack from the TSS and copies the gate's parameter words.
+*/
+
+const (
+	GateTypeCall16 = 0x4
+	GateTypeCall32 = 0xC
+)
+
+type CallGateDescriptor struct {
+	selector       uint16
+	offset         uint32
+	parameterCount uint8
+	access         uint8
+}
+
+func (g CallGateDescriptor) isPresent() bool {
+	return g.access&DescriptorAccessPresent != 0
+}
+
+func (g CallGateDescriptor) dpl() uint8 {
+	return (g.access >> 5) & 0x3
+}
+
+func decodeCallGateDescriptor(raw []byte) CallGateDescriptor {
+	return CallGateDescriptor{
+		offset:         uint32(raw[0]) | uint32(raw[1])<<8 | uint32(raw[6])<<16 | uint32(raw[7])<<24,
+		selector:       uint16(raw[2]) | uint16(raw[3])<<8,
+		parameterCount: raw[4] & 0x1F,
+		access:         raw[5],
+	}
+}
+
+func (core *CpuCore) currentPrivilegeLevel() uint8 {
+	return uint8(core.registers.CS.base & 0x3)
+}
+
+// Checks whether a far call selector references a call gate rather than a code segment
+func (core *CpuCore) isCallGateSelector(selector uint16) bool {
+	if core.mode != common.PROTECTED_MODE || selector&0xFFFC == 0 {
+		return false
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil || descriptor.isCodeOrData() {
+		return false
+	}
+
+	return descriptor.systemType() == GateTypeCall16 || descriptor.systemType() == GateTypeCall32
+}
+
+// Performs a far call through the call gate referenced by gateSelector, the offset from the call instruction is ignored
+func (core *CpuCore) callGate(gateSelector uint16, returnIP uint16) error {
+	raw, err := core.readDescriptorBytes(gateSelector)
+	if err != nil {
+		return err
+	}
+
+	gate := decodeCallGateDescriptor(raw)
+	if raw[5]&0x0F == GateTypeCall32 {
+		// needs 32 bit stack operations
+		core.logger.Warnf("[%#04x] 32 bit call gates are not supported", core.GetCurrentlyExecutingInstructionAddress())
+		return selectorFault(gateSelector)
+	}
+
+	cpl := core.currentPrivilegeLevel()
+	rpl := uint8(gateSelector & 0x3)
+	if gate.dpl() < cpl || gate.dpl() < rpl {
+		return selectorFault(gateSelector)
+	}
+
+	if !gate.isPresent() {
+		return selectorFault(gateSelector)
+	}
+
+	if gate.selector&0xFFFC == 0 {
+		return common.GeneralProtectionFault{}
+	}
+
+	target, err := core.readSegmentDescriptor(gate.selector)
+	if err != nil {
+		return err
+	}
+
+	if !target.isCodeOrData() || !target.isExecutable() || target.dpl() > cpl {
+		return selectorFault(gate.selector)
+	}
+
+	if !target.isPresent() {
+		return selectorFault(gate.selector)
+	}
+
+	if !target.isConforming() && target.dpl() < cpl {
+		return core.callGateInnerPrivilege(gate, target.dpl(), returnIP)
+	}
+
+	// same privilege, the target runs at the current privilege level
+	return core.callFarDirect(gate.selector&0xFFFC|uint16(cpl), gate.offset&0xFFFF, uint32(returnIP), false)
+}
+
+// Loads SS:ESP with the stack for a more privileged level from the current TSS
+func (core *CpuCore) switchToInnerStack(targetPrivilegeLevel uint8) error {
+	newSS, newSP, err := core.innerStack(targetPrivilegeLevel)
+	if err != nil {
+		return err
+	}
+
+	if uint8(newSS&0x3) != targetPrivilegeLevel {
+		return selectorFault(newSS)
+	}
+
+	stackDescriptor, err := core.readSegmentDescriptor(newSS)
+	if err != nil {
+		return err
+	}
+	if stackDescriptor.dpl() != targetPrivilegeLevel {
+		return selectorFault(newSS)
+	}
+
+	err = core.loadSegmentRegister(&core.registers.SS, newSS)
+	if err != nil {
+		return err
+	}
+	core.setStackPointer(newSP)
+
+	return nil
+}
+
+// Switches to the stack for the target privilege level, copies the parameters and pushes the return frame
+func (core *CpuCore) callGateInnerPrivilege(gate CallGateDescriptor, targetPrivilegeLevel uint8, returnIP uint16) error {
+	returnCS := core.registers.CS.base
+	outerSS := core.registers.SS
+	outerSP := core.registers.SP
+	outerESP := core.registers.ESP
+	outerStackBase := core.segmentBase(core.registers.SS)
+
+	err := core.switchToInnerStack(targetPrivilegeLevel)
+	if err != nil {
+		return err
+	}
+
+	restoreOuterStack := func() {
+		core.registers.SS = outerSS
+		core.registers.SetSP(outerSP)
+		core.registers.ESP = outerESP
+	}
+
+	err = core.pushWord(outerSS.base)
+	if err != nil {
+		restoreOuterStack()
+		return err
+	}
+	err = core.pushWord(outerSP)
+	if err != nil {
+		restoreOuterStack()
+		return err
+	}
+
+	// parameters keep their order, the deepest one is copied first
+	for i := int(gate.parameterCount) - 1; i >= 0; i-- {
+		param, err := core.memoryAccessController.ReadAddr16(outerStackBase + uint32(outerSP+uint16(i*2)))
+		if err == nil {
+			err = core.pushWord(param)
+		}
+		if err != nil {
+			restoreOuterStack()
+			return err
+		}
+	}
+
+	err = core.pushWord(returnCS)
+	if err == nil {
+		err = core.pushWord(returnIP)
+	}
+	if err != nil {
+		restoreOuterStack()
+		return err
+	}
+
+	// the target selector's rpl becomes the new cpl
+	err = core.loadCodeSegment(gate.selector&0xFFFC | uint16(targetPrivilegeLevel))
+	if err != nil {
+		restoreOuterStack()
+		return err
+	}
+
+	core.registers.IP = uint16(gate.offset)
+	core.recordCall(true, returnCS, returnIP)
+
+	return nil
+}
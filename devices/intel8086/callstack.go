@@ -0,0 +1,77 @@
+package intel8086
+
+/*
+	Shadow call stack for call/return tracing
+	CALL pushes a frame, RET pops it and checks the return address against the one the matching CALL pushed
+*/
+
+type StackFrame struct {
+	CallAddress uint32 // linear address of the call instruction
+	ReturnCS    uint16
+	ReturnIP    uint16
+	TargetCS    uint16
+	TargetIP    uint16
+	Far         bool
+}
+
+type CallStackMismatch struct {
+	RetAddress uint32 // linear address of the ret instruction
+	ReturnCS   uint16 // where the ret actually went
+	ReturnIP   uint16
+	Expected   *StackFrame // frame on top of the shadow stack, nil for a ret without a call
+}
+
+// Returns the shadow call stack, outermost call first
+func (core *CpuCore) CallStack() []StackFrame {
+	frames := make([]StackFrame, len(core.callStack))
+	copy(frames, core.callStack)
+	return frames
+}
+
+// Returns the returns that didn't match the shadow call stack
+func (core *CpuCore) CallStackMismatches() []CallStackMismatch {
+	return core.callStackMismatches
+}
+
+func (core *CpuCore) resetCallStack() {
+	core.callStack = nil
+	core.callStackMismatches = nil
+}
+
+func (core *CpuCore) recordCall(far bool, returnCS uint16, returnIP uint16) {
+	core.callStack = append(core.callStack, StackFrame{
+		CallAddress: core.GetCurrentlyExecutingInstructionAddress(),
+		ReturnCS:    returnCS,
+		ReturnIP:    returnIP,
+		TargetCS:    core.registers.CS.base,
+		TargetIP:    core.registers.IP,
+		Far:         far,
+	})
+}
+
+// Called after a return has loaded CS:IP
+func (core *CpuCore) recordReturn() {
+	returnCS := core.registers.CS.base
+	returnIP := core.registers.IP
+
+	mismatch := CallStackMismatch{
+		RetAddress: core.GetCurrentlyExecutingInstructionAddress(),
+		ReturnCS:   returnCS,
+		ReturnIP:   returnIP,
+	}
+
+	if len(core.callStack) == 0 {
+		core.logger.Warnf("[%#04x] call stack mismatch: ret to %04x:%04x without a matching call", mismatch.RetAddress, returnCS, returnIP)
+		core.callStackMismatches = append(core.callStackMismatches, mismatch)
+		return
+	}
+
+	top := core.callStack[len(core.callStack)-1]
+	core.callStack = core.callStack[:len(core.callStack)-1]
+
+	if top.ReturnCS != returnCS || top.ReturnIP != returnIP {
+		core.logger.Warnf("[%#04x] call stack mismatch: ret to %04x:%04x, expected %04x:%04x (call at %#04x)", mismatch.RetAddress, returnCS, returnIP, top.ReturnCS, top.ReturnIP, top.CallAddress)
+		mismatch.Expected = &top
+		core.callStackMismatches = append(core.callStackMismatches, mismatch)
+	}
+}
@@ -1,10 +1,5 @@
 package intel8086
 
-import (
-	"log"
-	"math/bits"
-)
-
 func INSTR_TEST(core *CpuCore) {
 	core.currentByteAddr++
 
@@ -18,20 +13,32 @@ func INSTR_TEST(core *CpuCore) {
 		{
 			//  TEST al, imm8
 			term1 = uint32(core.registers.AL)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
+			bitLength = 8
 
-			log.Printf("[%#04x] test al, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] test al, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0xA9:
 		{
-			// TEST ax, imm16
+			// TEST ax, imm16, or eax, imm32 with a 32 bit operand size
+			if core.flags.OperandSizeOverrideEnabled {
+				imm, err := core.readImm32()
+				if err != nil { goto eof }
+				core.setLogicFlags(core.registers.EAX&imm, 32)
+
+				core.logger.Tracef("[%#04x] test eax, [%#08x]", core.GetCurrentlyExecutingInstructionAddress(), imm)
+				goto eof
+			}
 			term1 = uint32(core.registers.AX)
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
+			bitLength = 16
 
-			log.Printf("[%#04x] test ax, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] test ax, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0xF6:
@@ -45,13 +52,30 @@ func INSTR_TEST(core *CpuCore) {
 
 			term1 = uint32(*rm)
 
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
+			bitLength = 8
 
-			log.Printf("[%#04x] test %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] test %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0xF7:
+		if core.flags.OperandSizeOverrideEnabled {
+			// TEST r/m32, imm32
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			rm, rmStr, err := core.readRm32(&modrm)
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+
+			imm, err := core.readImm32()
+			if err != nil { goto eof }
+			core.setLogicFlags(*rm&imm, 32)
+
+			core.logger.Tracef("[%#04x] test %s, [%#08x]", core.GetCurrentlyExecutingInstructionAddress(), rmStr, imm)
+			goto eof
+		}
 		{
 			// TEST r/m16, imm16
 			modrm, bytesConsumed, err := core.consumeModRm()
@@ -62,10 +86,12 @@ func INSTR_TEST(core *CpuCore) {
 
 			term1 = uint32(*rm)
 
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
+			bitLength = 16
 
-			log.Printf("[%#04x] test %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
+			core.logger.Tracef("[%#04x] test %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rmStr, term2)
 			goto success
 		}
 	case 0x84:
@@ -82,8 +108,9 @@ func INSTR_TEST(core *CpuCore) {
 			rm2, rm2Str := core.readR8(&modrm)
 
 			term2 = uint32(*rm2)
+			bitLength = 8
 
-			log.Printf("[%#04x] test %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] test %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	case 0x85:
@@ -100,29 +127,30 @@ func INSTR_TEST(core *CpuCore) {
 			rm2, rm2Str := core.readR16(&modrm)
 
 			term2 = uint32(*rm2)
+			bitLength = 16
 
-			log.Printf("[%#04x] test %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
+			core.logger.Tracef("[%#04x] test %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rm2Str)
 			goto success
 		}
 	}
 
 	success:
-	bitLength = uint32(bits.Len32(result))
-
 	result = term1 & term2
 
 	core.registers.SetFlag(OverFlowFlag,  false)
 
 	core.registers.SetFlag(CarryFlag, false)
 
-	core.registers.SetFlag(SignFlag, (result >> bitLength) != 0)
+	core.registers.SetFlag(SignFlag, (result >> (bitLength - 1)) & 1 != 0)
 
 	core.registers.SetFlag(ZeroFlag, result == 0)
 
-	core.registers.SetFlag(ParityFlag, bits.OnesCount32(result)%2 == 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+
+	core.undefineFlags(AdjustFlag)
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 
@@ -130,15 +158,30 @@ func INSTR_XCHG(core *CpuCore) {
 	core.currentByteAddr++
 
 	switch core.currentOpCodeBeingExecuted {
-	case 0x90, 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98:
+	case 0x90:
+		{
+			// nop, encoded as xchg ax, ax. With a REP prefix it is PAUSE on cores that have the spin loop hint,
+			// either way nothing happens beyond stepping past the prefix and opcode.
+			if core.flags.RepPrefixEnabled && !core.flags.RepNotEqualPrefixEnabled && core.features.SpinLoopHint {
+				core.logger.Tracef("[%#04x] pause", core.GetCurrentlyExecutingInstructionAddress())
+				goto eof
+			}
+			core.logger.Tracef("[%#04x] nop", core.GetCurrentlyExecutingInstructionAddress())
+			goto eof
+		}
+	case 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97:
 		{
-			// xchg ax, 16
-			term1 := core.registers.AX
-			r16, r16Str := core.registers.registers16Bit[core.currentOpCodeBeingExecuted-0x90], core.registers.index16ToString(core.currentOpCodeBeingExecuted-0x90)
-			term2 := *r16
-			core.registers.AX = term2
-			*r16 = term1
-			log.Printf("[%#04x] xchg AX, %s", core.GetCurrentlyExecutingInstructionAddress(), r16Str)
+			// xchg ax, r16 / xchg eax, r32
+			index := core.currentOpCodeBeingExecuted - 0x90
+			if core.flags.OperandSizeOverrideEnabled {
+				r32 := core.registers.registers32Bit[index]
+				core.registers.EAX, *r32 = *r32, core.registers.EAX
+				core.logger.Tracef("[%#04x] xchg EAX, %s", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index32ToString(index))
+			} else {
+				r16 := core.registers.registers16Bit[index]
+				core.registers.AX, *r16 = *r16, core.registers.AX
+				core.logger.Tracef("[%#04x] xchg AX, %s", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index16ToString(index))
+			}
 			goto eof
 		}
 	case 0x86:
@@ -146,48 +189,58 @@ func INSTR_XCHG(core *CpuCore) {
 			// XCHG r/m8, r8
 			modrm, bytesConsumed, err := core.consumeModRm()
 			if err != nil { goto eof }
-			rm8, rm8Str, err := core.readRm8(&modrm)
-			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
 			r8, r8Str := core.readR8(&modrm)
 
-			tmp := *rm8
-
-			*rm8 = *r8
-
-			*r8 = tmp
+			// the memory operand is written back, not just the copy read from it
+			rm8Str, err := core.modifyRm8(&modrm, func(value uint8) uint8 {
+				swapped := *r8
+				*r8 = value
+				return swapped
+			})
+			if err != nil { goto eof }
 
-			log.Printf("[%#04x] xchg %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
+			core.logger.Tracef("[%#04x] xchg %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
 			goto eof
 		}
 	case 0x87:
 		{
-			// XCHG r/m16, r16
+			// XCHG r/m16, r16 / XCHG r/m32, r32
 			modrm, bytesConsumed, err := core.consumeModRm()
 			if err != nil { goto eof }
-			rm8, rm8Str, err := core.readRm16(&modrm)
-			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
-			r8, r8Str := core.readR16(&modrm)
-
-			tmp := *rm8
-
-			*rm8 = *r8
-
-			*r8 = tmp
-
-			log.Printf("[%#04x] xchg %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
+			var rmStr, rStr string
+			if core.flags.OperandSizeOverrideEnabled {
+				var r32 *uint32
+				r32, rStr = core.readR32(&modrm)
+				rmStr, err = core.modifyRm32(&modrm, func(value uint32) uint32 {
+					swapped := *r32
+					*r32 = value
+					return swapped
+				})
+			} else {
+				var r16 *uint16
+				r16, rStr = core.readR16(&modrm)
+				rmStr, err = core.modifyRm16(&modrm, func(value uint16) uint16 {
+					swapped := *r16
+					*r16 = value
+					return swapped
+				})
+			}
+			if err != nil { goto eof }
+
+			core.logger.Tracef("[%#04x] xchg %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rStr)
 			goto eof
 		}
 	default:
-		log.Println("Unrecognised xchg instruction!")
+		core.logger.Errorf("Unrecognised xchg instruction!")
 		doCoreDump(core)
 	}
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 func INSTR_CMP(core *CpuCore) {
@@ -195,65 +248,34 @@ func INSTR_CMP(core *CpuCore) {
 
 	var term1 uint32
 	var term2 uint32
-	var result uint32
-
-	var sign1 uint32
-	var sign2 uint32
-	var signr uint8
 
-	var bitLength uint32
+	var width uint
 
 	switch core.currentOpCodeBeingExecuted {
-	case 0xA6:
-		{
-			//  CMPS m8, m8
-			tmp1, err := core.memoryAccessController.ReadAddr8(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.SI))
-			if err != nil { goto eof }
-			tmp2, err := core.memoryAccessController.ReadAddr8(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.DI))
-			if err != nil { goto eof }
-			term1 = uint32(tmp1)
-			term2 = uint32(tmp2)
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp m8, m8", core.GetCurrentlyExecutingInstructionAddress())
-			goto success
-		}
-	case 0xA7:
-		{
-			// CMPS m16, m16
-			tmp1, err := core.memoryAccessController.ReadAddr16(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.SI))
-			if err != nil { goto eof }
-			tmp2, err := core.memoryAccessController.ReadAddr16(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.DI))
-			if err != nil { goto eof }
-			term1 = uint32(tmp1)
-			term2 = uint32(tmp2)
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp m16, m16", core.GetCurrentlyExecutingInstructionAddress())
-			goto success
-		}
 	case 0x3C:
 		{
 			// CMP AL, imm8
 			term1 = uint32(core.registers.AL)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp AL, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] cmp AL, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x3D:
 		{
-			//	CMP AX, imm16
+			//	CMP AX, imm16, or EAX, imm32 with a 32 bit operand size
+			if core.flags.OperandSizeOverrideEnabled {
+				core.arithmeticAccumulator32()
+				goto eof
+			}
 			term1 = uint32(core.registers.AX)
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp AX, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
+			core.logger.Tracef("[%#04x] cmp AX, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), term2)
 			goto success
 		}
 	case 0x80:
@@ -265,12 +287,11 @@ func INSTR_CMP(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*rm8)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
+			core.logger.Tracef("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
 			goto success
 		}
 	case 0x81:
@@ -282,12 +303,11 @@ func INSTR_CMP(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*rm8)
-			term2, err := core.readImm16()
+			imm, err := core.readImm16()
 			if err != nil { goto eof }
+			term2 = uint32(imm)
 
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
+			core.logger.Tracef("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
 			goto success
 		}
 	case 0x83:
@@ -300,12 +320,12 @@ func INSTR_CMP(core *CpuCore) {
 
 			core.currentByteAddr += bytesConsumed
 			term1 = uint32(*rm8)
-			term2, err := core.readImm8()
+			imm, err := core.readImm8()
 			if err != nil { goto eof }
+			// sign extended to the operand size
+			term2 = uint32(uint16(int8(imm)))
 
-			result = uint32(term1) - uint32(term2)
-
-			log.Printf("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
+			core.logger.Tracef("[%#04x] cmp %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, term2)
 			goto success
 		}
 	case 0x38:
@@ -319,9 +339,8 @@ func INSTR_CMP(core *CpuCore) {
 			term1 = uint32(*rm8)
 			r8, r8Str := core.readR8(&modrm)
 			term2 = uint32(*r8)
-			result = uint32(term1) - uint32(term2)
 
-			log.Printf("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
+			core.logger.Tracef("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
 			goto success
 		}
 	case 0x39:
@@ -335,9 +354,8 @@ func INSTR_CMP(core *CpuCore) {
 			term1 = uint32(*rm8)
 			r8, r8Str := core.readR16(&modrm)
 			term2 = uint32(*r8)
-			result = uint32(term1) - uint32(term2)
 
-			log.Printf("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
+			core.logger.Tracef("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rm8Str, r8Str)
 			goto success
 		}
 	case 0x3A:
@@ -352,9 +370,8 @@ func INSTR_CMP(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term2 = uint32(*rm8)
-			result = uint32(term1) - uint32(term2)
 
-			log.Printf("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), r8Str, rm8Str)
+			core.logger.Tracef("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), r8Str, rm8Str)
 			goto success
 		}
 	case 0x3B:
@@ -369,29 +386,74 @@ func INSTR_CMP(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 			term2 = uint32(*rm8)
-			result = uint32(term1) - uint32(term2)
 
-			log.Printf("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), r8Str, rm8Str)
+			core.logger.Tracef("[%#04x] cmp %s, %s", core.GetCurrentlyExecutingInstructionAddress(), r8Str, rm8Str)
 			goto success
 		}
 	}
 
 	success:
-	bitLength = uint32(bits.Len32(result))
+	// the w bit of the opcode is clear for byte operands
+	width = 16
+	if core.currentOpCodeBeingExecuted&0x01 == 0 {
+		width = 8
+	}
+	core.setSubtractFlags(term1, term2, width)
 
-	// update flags
-	sign1 = (term1 >> (bitLength)) & 0x01
-	sign2 = (term2 >> (bitLength)) & 0x01
-	signr = uint8((result >> (bitLength)) & 0x01)
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
 
-	core.registers.SetFlag(CarryFlag, result>>(bitLength) != 0)
+// BOUND r16, m16&16 (0x62), raises #BR when the signed index in the register is outside the bounds pair in memory
+func INSTR_BOUND(core *CpuCore) {
+	var addressMode uint32
+	var index, lower, upper int32
+	var size uint32 = 2
 
-	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if modrm.mod == 3 {
+		// the bounds have to be in memory
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
 
-	core.registers.SetFlag(SignFlag, signr != 0)
+	if core.flags.OperandSizeOverrideEnabled {
+		size = 4
+	}
 
-	core.registers.SetFlag(OverFlowFlag,  (sign1 == 0 && sign2 == 1 && signr == 1) || (sign1 == 1 && sign2 == 0 && signr == 0))
+	addressMode, err = core.translateRm(&modrm, modrm.effectiveAddress(core), size*2, accessRead)
+	if err != nil { goto eof }
+
+	if size == 4 {
+		r32, _ := core.readR32(&modrm)
+		index = int32(*r32)
+
+		lower32, err := core.memoryAccessController.ReadAddr32(uint32(addressMode))
+		if err != nil { goto eof }
+		upper32, err := core.memoryAccessController.ReadAddr32(uint32(addressMode) + 4)
+		if err != nil { goto eof }
+		lower, upper = int32(lower32), int32(upper32)
+	} else {
+		r16, _ := core.readR16(&modrm)
+		index = int32(int16(*r16))
+
+		lower16, err := core.memoryAccessController.ReadAddr16(uint32(addressMode))
+		if err != nil { goto eof }
+		upper16, err := core.memoryAccessController.ReadAddr16(uint32(addressMode) + 2)
+		if err != nil { goto eof }
+		lower, upper = int32(int16(lower16)), int32(int16(upper16))
+	}
+
+	core.logger.Tracef("[%#04x] bound %d, [%d, %d]", core.GetCurrentlyExecutingInstructionAddress(), index, lower, upper)
+
+	if index < lower || index > upper {
+		core.raiseException(NewFault(ExceptionBoundRange))
+	}
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
@@ -0,0 +1,75 @@
+package intel8086
+
+/*
+	Condition codes
+	Jcc, SETcc, CMOVcc and friends encode one of 16 conditions in the low nibble of the opcode. Odd conditions
+	are the negation of the even condition before them.
+*/
+
+const (
+	ConditionOverflow       = 0x0 // O
+	ConditionNotOverflow    = 0x1 // NO
+	ConditionBelow          = 0x2 // B, C, NAE
+	ConditionNotBelow       = 0x3 // NB, NC, AE
+	ConditionZero           = 0x4 // Z, E
+	ConditionNotZero        = 0x5 // NZ, NE
+	ConditionBelowOrEqual   = 0x6 // BE, NA
+	ConditionAbove          = 0x7 // A, NBE
+	ConditionSign           = 0x8 // S
+	ConditionNotSign        = 0x9 // NS
+	ConditionParity         = 0xA // P, PE
+	ConditionNotParity      = 0xB // NP, PO
+	ConditionLess           = 0xC // L, NGE
+	ConditionGreaterOrEqual = 0xD // GE, NL
+	ConditionLessOrEqual    = 0xE // LE, NG
+	ConditionGreater        = 0xF // G, NLE
+)
+
+var conditionMnemonics = [16]string{"O", "NO", "B", "NB", "Z", "NZ", "BE", "A", "S", "NS", "P", "NP", "L", "GE", "LE", "G"}
+
+// The flags each pair of conditions reads
+var conditionFlags = [8]uint16{
+	OverFlowFlag,
+	CarryFlag,
+	ZeroFlag,
+	CarryFlag | ZeroFlag,
+	SignFlag,
+	ParityFlag,
+	SignFlag | OverFlowFlag,
+	ZeroFlag | SignFlag | OverFlowFlag,
+}
+
+// Evaluates condition code cc (0x0-0xF) against the current flags
+func EvaluateCondition(core *CpuCore, cc uint8) bool {
+	flags := core.registers
+	core.checkFlagsRead(conditionFlags[(cc&0xF)>>1])
+
+	var result bool
+	switch (cc & 0xF) >> 1 {
+	case ConditionOverflow >> 1:
+		result = flags.GetFlag(OverFlowFlag)
+	case ConditionBelow >> 1:
+		result = flags.GetFlag(CarryFlag)
+	case ConditionZero >> 1:
+		result = flags.GetFlag(ZeroFlag)
+	case ConditionBelowOrEqual >> 1:
+		result = flags.GetFlag(CarryFlag) || flags.GetFlag(ZeroFlag)
+	case ConditionSign >> 1:
+		result = flags.GetFlag(SignFlag)
+	case ConditionParity >> 1:
+		result = flags.GetFlag(ParityFlag)
+	case ConditionLess >> 1:
+		result = flags.GetFlag(SignFlag) != flags.GetFlag(OverFlowFlag)
+	case ConditionLessOrEqual >> 1:
+		result = flags.GetFlag(ZeroFlag) || flags.GetFlag(SignFlag) != flags.GetFlag(OverFlowFlag)
+	}
+
+	if cc&0x1 != 0 {
+		return !result
+	}
+	return result
+}
+
+func conditionMnemonic(cc uint8) string {
+	return conditionMnemonics[cc&0xF]
+}
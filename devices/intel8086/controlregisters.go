@@ -0,0 +1,151 @@
+package intel8086
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Control and debug register moves
+	MOV to and from CR0, CR2, CR3, CR4 (0x0F 0x20/0x22) and DR0-DR7 (0x0F 0x21/0x23). These are privileged, in
+	protected mode anything other than ring 0 gets #GP(0). The modrm byte always names a general register, the
+	mod field is ignored and no displacement follows. Setting or clearing CR0.PE switches the processor mode.
+
+	CR2 holds the linear address of the last page fault, it is loaded when a #PF is delivered. DR4 and DR5 are
+	aliases of DR6 and DR7 as on the 386.
+*/
+
+const (
+	ControlRegisterProtectionEnable = 0x1
+	DebugStatusReset                = 0xFFFF0FF0
+	DebugControlReset               = 0x00000400
+)
+
+func (core *CpuCore) resetDebugRegisters() {
+	core.registers.DR0 = 0
+	core.registers.DR1 = 0
+	core.registers.DR2 = 0
+	core.registers.DR3 = 0
+	core.registers.DR6 = DebugStatusReset
+	core.registers.DR7 = DebugControlReset
+	core.debug = debugState{}
+}
+
+// Gets the control register named by a modrm reg field, nil for the ones the 386 doesn't have
+func (core *CpuCore) controlRegister(index uint8) *uint32 {
+	switch index {
+	case 0:
+		return &core.registers.CR0
+	case 2:
+		return &core.registers.CR2
+	case 3:
+		return &core.registers.CR3
+	case 4:
+		return &core.registers.CR4
+	}
+	return nil
+}
+
+func (core *CpuCore) debugRegister(index uint8) *uint32 {
+	switch index {
+	case 0:
+		return &core.registers.DR0
+	case 1:
+		return &core.registers.DR1
+	case 2:
+		return &core.registers.DR2
+	case 3:
+		return &core.registers.DR3
+	case 4, 6:
+		return &core.registers.DR6
+	}
+	return &core.registers.DR7
+}
+
+// Loads a control register, a change to CR0.PE enters or leaves protected mode
+func (core *CpuCore) writeControlRegister(index uint8, value uint32) {
+	reg := core.controlRegister(index)
+	previous := *reg
+	*reg = value
+
+	if index != 0 || (previous^value)&ControlRegisterProtectionEnable == 0 {
+		return
+	}
+
+	if value&ControlRegisterProtectionEnable != 0 {
+		core.EnterMode(common.PROTECTED_MODE)
+	} else {
+		core.EnterMode(common.REAL_MODE)
+	}
+}
+
+func INSTR_MOV_CONTROL_REGISTER(core *CpuCore) {
+	var modrmByte uint8
+	var err error
+	var index uint8
+	var gpr *uint32
+	var gprName string
+
+	core.currentByteAddr++
+
+	modrmByte, err = core.fetch8(core.currentByteAddr)
+	if err != nil { goto eof }
+	core.currentByteAddr++
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	index = (modrmByte >> 3) & 0x7
+	if core.controlRegister(index) == nil {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	gpr = core.registers.registers32Bit[modrmByte&0x7]
+	gprName = core.registers.index32ToString(modrmByte & 0x7)
+
+	if core.currentOpCodeBeingExecuted == 0x22 {
+		core.writeControlRegister(index, *gpr)
+		core.logger.Tracef("[%#04x] MOV CR%d,%s", core.GetCurrentlyExecutingInstructionAddress(), index, gprName)
+	} else {
+		*gpr = *core.controlRegister(index)
+		core.logger.Tracef("[%#04x] MOV %s,CR%d", core.GetCurrentlyExecutingInstructionAddress(), gprName, index)
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_MOV_DEBUG_REGISTER(core *CpuCore) {
+	var modrmByte uint8
+	var err error
+	var index uint8
+	var gpr *uint32
+	var name string
+
+	core.currentByteAddr++
+
+	modrmByte, err = core.fetch8(core.currentByteAddr)
+	if err != nil { goto eof }
+	core.currentByteAddr++
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	index = (modrmByte >> 3) & 0x7
+	gpr = core.registers.registers32Bit[modrmByte&0x7]
+	name = fmt.Sprintf("DR%d", index)
+
+	if core.currentOpCodeBeingExecuted == 0x23 {
+		*core.debugRegister(index) = *gpr
+		core.logger.Tracef("[%#04x] MOV %s,%s", core.GetCurrentlyExecutingInstructionAddress(), name, core.registers.index32ToString(modrmByte&0x7))
+	} else {
+		*gpr = *core.debugRegister(index)
+		core.logger.Tracef("[%#04x] MOV %s,%s", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index32ToString(modrmByte&0x7), name)
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,122 @@
+package intel8086
+
+/*
+	Hardware breakpoints
+	DR0-DR3 hold linear addresses and DR7 enables each one (its L or G bit) and picks what it watches: instruction
+	execution, data writes, or data reads and writes, over 1, 2 or 4 bytes. A hit sets the breakpoint's B bit in DR6,
+	which stays set until software clears it, and raises #DB. Execute breakpoints are faults taken before the
+	instruction runs. Data breakpoints are traps taken after the instruction which made the access.
+
+	With TF set at the start of an instruction a single step trap follows it, sharing the #DB with any data
+	breakpoints it hit. Entering the handler clears TF so the handler itself isn't stepped.
+
+	FLAGS is only 16 bits here so there is no RF bit to stop an execute breakpoint firing again when its handler
+	returns. Instead the address of the last one taken is remembered and the next fetch from it is let through.
+*/
+
+const (
+	DebugBreakpointExecute   = 0x0
+	DebugBreakpointWrite     = 0x1
+	DebugBreakpointReadWrite = 0x3
+
+	DebugStatusBreakpointMask = 0xF    // B0-B3 in DR6
+	DebugStatusSingleStep     = 0x4000 // BS in DR6
+)
+
+type debugState struct {
+	pendingHits   uint32 // data breakpoints hit by the executing instruction, as DR6 B bits
+	resumeAddress uint32 // execute breakpoint address to let through once
+	resuming      bool
+}
+
+// Whether breakpoint n is enabled, and what it watches
+func (core *CpuCore) breakpoint(n uint32) (enabled bool, kind uint32, address uint32, size uint32) {
+	dr7 := core.registers.DR7
+	enabled = dr7&(0x3<<(n*2)) != 0
+	kind = (dr7 >> (16 + n*4)) & 0x3
+
+	switch (dr7 >> (18 + n*4)) & 0x3 {
+	case 1:
+		size = 2
+	case 3:
+		size = 4
+	default:
+		size = 1
+	}
+
+	address = *core.debugRegister(uint8(n)) &^ (size - 1)
+	return
+}
+
+// Checks the execute breakpoints against the address of the next instruction, raises #DB on a hit
+func (core *CpuCore) checkExecuteBreakpoints(addr uint32) bool {
+	if core.debug.resuming && core.debug.resumeAddress == addr {
+		core.debug.resuming = false
+		return false
+	}
+
+	var hits uint32
+	for n := uint32(0); n < 4; n++ {
+		enabled, kind, address, _ := core.breakpoint(n)
+		if enabled && kind == DebugBreakpointExecute && address == addr {
+			hits |= 1 << n
+		}
+	}
+
+	if hits == 0 {
+		return false
+	}
+
+	core.registers.DR6 |= hits
+	core.debug.resumeAddress = addr
+	core.debug.resuming = true
+	core.raiseException(NewFault(ExceptionDebug))
+	return true
+}
+
+// Records data breakpoints hit by an access of size bytes at the linear address addr
+func (core *CpuCore) watchData(addr uint32, size uint32, write bool) {
+	if core.registers.DR7&0xFF == 0 {
+		return
+	}
+
+	for n := uint32(0); n < 4; n++ {
+		enabled, kind, address, length := core.breakpoint(n)
+		if !enabled || kind == DebugBreakpointExecute {
+			continue
+		}
+		if kind == DebugBreakpointWrite && !write {
+			continue
+		}
+		if addr < address+length && address < addr+size {
+			core.debug.pendingHits |= 1 << n
+		}
+	}
+}
+
+// Raises the #DB trap for data breakpoints hit by the instruction which just ran. A faulting instruction is
+// restarted, so its hits are dropped.
+func (core *CpuCore) raiseDataBreakpoints() {
+	hits := core.debug.pendingHits
+	core.debug.pendingHits = 0
+
+	if hits == 0 || core.pendingException != nil {
+		return
+	}
+
+	core.registers.DR6 |= hits
+	core.raiseException(NewTrap(ExceptionDebug))
+}
+
+// Raises the single step #DB after an instruction which started with TF set. An instruction which faulted didn't
+// complete, so it isn't reported.
+func (core *CpuCore) raiseSingleStep() {
+	if core.pendingException != nil && (core.pendingException.Vector != ExceptionDebug || core.pendingException.Kind != ExceptionTrap) {
+		return
+	}
+
+	core.registers.DR6 |= DebugStatusSingleStep
+	if core.pendingException == nil {
+		core.raiseException(NewTrap(ExceptionDebug))
+	}
+}
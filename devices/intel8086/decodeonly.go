@@ -0,0 +1,357 @@
+package intel8086
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Decode only mode
+	DecodeOnly walks the prefixes, opcode, modrm, sib, displacement and immediate bytes of the instruction at an
+	address and reports how long it is, without running the handler. Nothing is written: registers, flags, memory,
+	the prefetch queue and the pending exception are left alone, and bytes are read straight from the memory
+	controller so a bad address comes back as an error rather than a #GP.
+
+	Operand and address sizes follow the architecture (the CS D bit in protected mode, flipped by 0x66 and 0x67),
+	so the lengths can be compared with a reference disassembler and used to catch byte counting bugs in the
+	handlers.
+*/
+
+const MaxInstructionLength = 15
+
+type DecodedInstruction struct {
+	Length       uint32
+	Prefixes     []uint8 // not including the 0x0F escape
+	Opcode       uint8
+	TwoByte      bool
+	HasModRm     bool
+	ModRm        uint8
+	HasSib       bool
+	Sib          uint8
+	Displacement uint32 // size in bytes
+	Immediate    uint32 // size in bytes
+}
+
+// How the bytes after the opcode are laid out
+type operandForm uint8
+
+const (
+	operandsNone operandForm = iota
+	operandsModRm
+	operandsImm8
+	operandsImm16
+	operandsImmSize // imm16, or imm32 with a 32 bit operand size
+	operandsModRmImm8
+	operandsModRmImmSize
+	operandsMemoryOffset    // moffs, sized by the address size
+	operandsFarPointer      // offset then a 16 bit selector
+	operandsEnter           // imm16 then imm8
+	operandsGroup3          // modrm, TEST (reg 0 and 1) also takes an immediate
+	operandsControlRegister // modrm which always names a register, mod is ignored
+)
+
+func oneByteOperandForm(opcode uint8) operandForm {
+	switch {
+	case opcode < 0x40:
+		// alu ops follow the same pattern in each row
+		switch opcode & 0x7 {
+		case 0, 1, 2, 3:
+			return operandsModRm
+		case 4:
+			return operandsImm8
+		case 5:
+			return operandsImmSize
+		}
+		return operandsNone
+	case opcode < 0x62:
+		return operandsNone
+	case opcode == 0x62, opcode == 0x63:
+		return operandsModRm
+	case opcode == 0x68:
+		return operandsImmSize
+	case opcode == 0x69:
+		return operandsModRmImmSize
+	case opcode == 0x6A:
+		return operandsImm8
+	case opcode == 0x6B:
+		return operandsModRmImm8
+	case opcode < 0x70:
+		return operandsNone
+	case opcode < 0x80:
+		return operandsImm8
+	case opcode == 0x81:
+		return operandsModRmImmSize
+	case opcode < 0x84:
+		return operandsModRmImm8
+	case opcode < 0x90:
+		return operandsModRm
+	case opcode == 0x9A:
+		return operandsFarPointer
+	case opcode < 0xA0:
+		return operandsNone
+	case opcode < 0xA4:
+		return operandsMemoryOffset
+	case opcode == 0xA8:
+		return operandsImm8
+	case opcode == 0xA9:
+		return operandsImmSize
+	case opcode < 0xB0:
+		return operandsNone
+	case opcode < 0xB8:
+		return operandsImm8
+	case opcode < 0xC0:
+		return operandsImmSize
+	case opcode == 0xC0, opcode == 0xC1, opcode == 0xC6:
+		return operandsModRmImm8
+	case opcode == 0xC2, opcode == 0xCA:
+		return operandsImm16
+	case opcode == 0xC4, opcode == 0xC5:
+		return operandsModRm
+	case opcode == 0xC7:
+		return operandsModRmImmSize
+	case opcode == 0xC8:
+		return operandsEnter
+	case opcode == 0xCD, opcode == 0xD4, opcode == 0xD5:
+		return operandsImm8
+	case opcode < 0xD0:
+		return operandsNone
+	case opcode < 0xD4:
+		return operandsModRm
+	case opcode < 0xD8:
+		return operandsNone
+	case opcode < 0xE0:
+		// coprocessor escapes
+		return operandsModRm
+	case opcode < 0xE8:
+		return operandsImm8
+	case opcode == 0xE8, opcode == 0xE9:
+		return operandsImmSize
+	case opcode == 0xEA:
+		return operandsFarPointer
+	case opcode == 0xEB:
+		return operandsImm8
+	case opcode == 0xF6, opcode == 0xF7:
+		return operandsGroup3
+	case opcode == 0xFE, opcode == 0xFF:
+		return operandsModRm
+	}
+	return operandsNone
+}
+
+func twoByteOperandForm(opcode uint8) operandForm {
+	switch {
+	case opcode < 0x04:
+		return operandsModRm
+	case opcode >= 0x18 && opcode < 0x20:
+		return operandsModRm
+	case opcode >= 0x20 && opcode < 0x28:
+		return operandsControlRegister
+	case opcode >= 0x40 && opcode < 0x50:
+		return operandsModRm
+	case opcode >= 0x80 && opcode < 0x90:
+		return operandsImmSize
+	case opcode >= 0x90 && opcode < 0xA0:
+		return operandsModRm
+	case opcode == 0xA4, opcode == 0xAC, opcode == 0xBA:
+		return operandsModRmImm8
+	case opcode == 0xA3, opcode == 0xA5, opcode == 0xAB, opcode == 0xAD, opcode == 0xAF:
+		return operandsModRm
+	case opcode >= 0xB0 && opcode < 0xC2, opcode == 0xC7:
+		return operandsModRm
+	}
+	return operandsNone
+}
+
+// Reads the bytes of one instruction, failing once it runs past the end of the code or the length limit
+type decodeCursor struct {
+	code []uint8
+	pos  uint32
+}
+
+func (cursor *decodeCursor) next() (uint8, error) {
+	if cursor.pos >= MaxInstructionLength {
+		return 0, fmt.Errorf("instruction is longer than %d bytes", MaxInstructionLength)
+	}
+	if cursor.pos >= uint32(len(cursor.code)) {
+		return 0, fmt.Errorf("instruction is truncated after %d bytes", cursor.pos)
+	}
+	b := cursor.code[cursor.pos]
+	cursor.pos++
+	return b, nil
+}
+
+func (cursor *decodeCursor) skip(n uint32) error {
+	for i := uint32(0); i < n; i++ {
+		if _, err := cursor.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether the code segment defaults to 32 bit operands and addresses
+func (core *CpuCore) codeSegmentIs32Bit() bool {
+	return core.mode == common.PROTECTED_MODE && core.registers.CS.access_information&(DescriptorFlagSize<<8) != 0
+}
+
+// Decodes the instruction at the linear address addr without executing it
+func (core *CpuCore) DecodeOnly(addr uint32) (DecodedInstruction, error) {
+	code := make([]uint8, 0, MaxInstructionLength)
+	for i := uint32(0); i < MaxInstructionLength; i++ {
+		b, err := core.memoryAccessController.ReadAddr8(addr + i)
+		if err != nil {
+			break
+		}
+		code = append(code, b)
+	}
+
+	return core.decodeOnly(code)
+}
+
+func (core *CpuCore) decodeOnly(code []uint8) (DecodedInstruction, error) {
+	decoded := DecodedInstruction{}
+	cursor := &decodeCursor{code: code}
+
+	operand32 := core.codeSegmentIs32Bit()
+	address32 := operand32
+	lock := false
+
+	opcode, err := cursor.next()
+	for err == nil && isPrefixByte(opcode) {
+		decoded.Prefixes = append(decoded.Prefixes, opcode)
+		switch opcode {
+		case 0x66:
+			operand32 = !core.codeSegmentIs32Bit()
+		case 0x67:
+			address32 = !core.codeSegmentIs32Bit()
+		case 0xf0:
+			lock = true
+		}
+		opcode, err = cursor.next()
+	}
+	if err != nil {
+		return decoded, err
+	}
+
+	var form operandForm
+	var implemented bool
+	if opcode == 0x0F {
+		opcode, err = cursor.next()
+		if err != nil {
+			return decoded, err
+		}
+		decoded.TwoByte = true
+		form = twoByteOperandForm(opcode)
+		implemented = core.opCodeMap2Byte[opcode] != nil
+	} else {
+		form = oneByteOperandForm(opcode)
+		implemented = core.opCodeMap[opcode] != nil
+	}
+	decoded.Opcode = opcode
+
+	if !implemented {
+		return decoded, fmt.Errorf("unrecognised opcode %#02x", opcode)
+	}
+
+	immediateSize := uint32(2)
+	if operand32 {
+		immediateSize = 4
+	}
+
+	switch form {
+	case operandsModRm, operandsModRmImm8, operandsModRmImmSize, operandsGroup3, operandsControlRegister:
+		decoded.ModRm, err = cursor.next()
+		if err != nil {
+			return decoded, err
+		}
+		decoded.HasModRm = true
+
+		if form != operandsControlRegister {
+			if err = decoded.decodeAddressing(cursor, address32); err != nil {
+				return decoded, err
+			}
+		}
+
+		switch form {
+		case operandsModRmImm8:
+			decoded.Immediate = 1
+		case operandsModRmImmSize:
+			decoded.Immediate = immediateSize
+		case operandsGroup3:
+			if (decoded.ModRm>>3)&0x7 < 2 {
+				decoded.Immediate = 1
+				if opcode == 0xF7 {
+					decoded.Immediate = immediateSize
+				}
+			}
+		}
+	case operandsImm8:
+		decoded.Immediate = 1
+	case operandsImm16:
+		decoded.Immediate = 2
+	case operandsImmSize:
+		decoded.Immediate = immediateSize
+	case operandsMemoryOffset:
+		decoded.Displacement = 2
+		if address32 {
+			decoded.Displacement = 4
+		}
+	case operandsFarPointer:
+		decoded.Immediate = immediateSize + 2
+	case operandsEnter:
+		decoded.Immediate = 3
+	}
+
+	if err = cursor.skip(decoded.Immediate); err != nil {
+		return decoded, err
+	}
+	if form == operandsMemoryOffset {
+		if err = cursor.skip(decoded.Displacement); err != nil {
+			return decoded, err
+		}
+	}
+
+	if lock && (!decoded.HasModRm || !lockAllowed(opcode, decoded.TwoByte, decoded.ModRm)) {
+		return decoded, fmt.Errorf("lock prefix on opcode %#02x", opcode)
+	}
+
+	decoded.Length = cursor.pos
+	return decoded, nil
+}
+
+// Consumes the sib and displacement bytes selected by the modrm byte
+func (decoded *DecodedInstruction) decodeAddressing(cursor *decodeCursor, address32 bool) error {
+	mod := decoded.ModRm >> 6
+	rm := decoded.ModRm & 0x7
+
+	if mod == 3 {
+		return nil
+	}
+
+	if !address32 {
+		switch {
+		case mod == 0 && rm == 6, mod == 2:
+			decoded.Displacement = 2
+		case mod == 1:
+			decoded.Displacement = 1
+		}
+		return cursor.skip(decoded.Displacement)
+	}
+
+	if rm == 4 {
+		sib, err := cursor.next()
+		if err != nil {
+			return err
+		}
+		decoded.HasSib = true
+		decoded.Sib = sib
+	}
+
+	switch {
+	case mod == 0 && rm == 5, mod == 0 && decoded.HasSib && decoded.Sib&0x7 == 5, mod == 2:
+		decoded.Displacement = 4
+	case mod == 1:
+		decoded.Displacement = 1
+	}
+	return cursor.skip(decoded.Displacement)
+}
@@ -1,9 +1,7 @@
 package intel8086
 
 import (
-	"fmt"
 	"github.com/andrewjc/threeatesix/common"
-	"log"
 )
 
 func (core *CpuCore) decodeInstruction() uint8 {
@@ -16,11 +14,19 @@ func (core *CpuCore) decodeInstruction() uint8 {
 	core.flags.AddressSizeOverrideEnabled = false
 	core.flags.LockPrefixEnabled = false
 	core.flags.RepPrefixEnabled = false
+	core.flags.RepNotEqualPrefixEnabled = false
 
 	core.currentPrefixBytes = []byte{}
-	for isPrefixByte(core.memoryAccessController.PeekNextBytes(uint32(core.currentByteAddr), 1)[0]) {
+	for {
+		prefixByte, err := core.fetch8(core.currentByteAddr)
+		if err != nil {
+			// the fetch fault is delivered by Step
+			return 0
+		}
+		if !isPrefixByte(prefixByte) {
+			break
+		}
 
-		prefixByte := core.memoryAccessController.PeekNextBytes(uint32(core.currentByteAddr), 1)[0]
 		core.currentPrefixBytes = append(core.currentPrefixBytes, prefixByte)
 		switch prefixByte {
 		case 0x2e:
@@ -45,10 +51,13 @@ func (core *CpuCore) decodeInstruction() uint8 {
 			// lock prefix
 			core.flags.LockPrefixEnabled = true
 		case 0xf2:
-			// repne/repnz prefix
+			// repne/repnz prefix, the string instructions which don't compare repeat as with rep
+			core.flags.RepPrefixEnabled = true
+			core.flags.RepNotEqualPrefixEnabled = true
 		case 0xf3:
 			// rep or repe/repz prefix
 			core.flags.RepPrefixEnabled = true
+			core.flags.RepNotEqualPrefixEnabled = false
 		case 0x66:
 			// operand size override
 			core.flags.OperandSizeOverrideEnabled = true
@@ -60,20 +69,29 @@ func (core *CpuCore) decodeInstruction() uint8 {
 		core.currentByteAddr++
 	}
 
-	instrByte, err = core.memoryAccessController.ReadAddr8(uint32(core.currentByteAddr))
+	if core.codeSegmentIs32Bit() {
+		// 32 bit code segments default to 32 bit operands and addresses, the prefixes select 16 bits
+		core.flags.OperandSizeOverrideEnabled = !core.flags.OperandSizeOverrideEnabled
+		core.flags.AddressSizeOverrideEnabled = !core.flags.AddressSizeOverrideEnabled
+	}
+
+	instrByte, err = core.fetch8(uint32(core.currentByteAddr))
 	if err != nil {
-		panic("Core read error.")
+		// the fetch fault is delivered by Step
+		return 0
 	}
 
 	var instructionImpl OpCodeImpl
-	if core.memoryAccessController.PeekNextBytes(uint32(core.currentByteAddr), 1)[0] == 0x0F {
+	var twoByte bool
+	if instrByte == 0x0F {
 		// 2 byte opcode
-		core.IncrementIP()
-		instrByte, err = core.memoryAccessController.ReadAddr8(uint32(core.currentByteAddr +1))
+		core.currentByteAddr++
+		instrByte, err = core.fetch8(uint32(core.currentByteAddr))
 		if err != nil {
-			panic("Core read error.")
+			return 0
 		}
 
+		twoByte = true
 		core.currentOpCodeBeingExecuted = instrByte
 		instructionImpl = core.opCodeMap2Byte[core.currentOpCodeBeingExecuted]
 		core.currentPrefixBytes = append(core.currentPrefixBytes, 0x0F)
@@ -82,15 +100,27 @@ func (core *CpuCore) decodeInstruction() uint8 {
 		instructionImpl = core.opCodeMap[core.currentOpCodeBeingExecuted]
 	}
 
+	if core.flags.LockPrefixEnabled {
+		valid, err := core.lockPrefixValid(instrByte, twoByte)
+		if err != nil {
+			return 0
+		}
+		if !valid {
+			core.logger.Debugf("[%#04x] lock prefix on opcode %#2x", core.GetCurrentlyExecutingInstructionAddress(), instrByte)
+			core.raiseException(NewFault(ExceptionInvalidOpcode))
+			return 0
+		}
+	}
+
 	if instructionImpl != nil {
+		if core.opcodeProfile != nil {
+			core.opcodeProfile.count(instrByte, twoByte)
+		}
 		instructionImpl(core)
 	} else {
-		log.Printf("[%#04x] Unrecognised opcode: %#2x %#2x\n", core.registers.IP, core.currentPrefixBytes, instrByte)
-
-		log.Printf("CPU CORE ERROR!!!")
-
-		doCoreDump(core)
-		panic(0)
+		// an opcode with no handler is undefined, as far as the program running can tell
+		core.logger.Errorf("[%#04x] Unrecognised opcode: %#2x %#2x", core.GetCurrentlyExecutingInstructionAddress(), core.currentPrefixBytes, instrByte)
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
 	}
 
 	return 0
@@ -136,11 +166,62 @@ func isPrefixByte(b byte) bool {
 }
 
 
+func INSTR_0F00_OPCODES(core *CpuCore) {
+
+	core.currentByteAddr++
+	modrm, _, err := core.consumeModRm()
+	core.currentByteAddr--
+	if err != nil { goto eof }
+
+	switch modrm.reg {
+	case 0:
+		INSTR_SLDT(core)
+	case 1:
+		INSTR_STR(core)
+	case 2:
+		INSTR_LLDT(core)
+	case 3:
+		INSTR_LTR(core)
+	case 4, 5:
+		INSTR_VERR_VERW(core)
+	default:
+		// /6 and /7 are undefined
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+	}
+	eof:
+}
+
+func INSTR_0F01_OPCODES(core *CpuCore) {
+
+	core.currentByteAddr++
+	modrm, _, err := core.consumeModRm()
+	core.currentByteAddr--
+	if err != nil { goto eof }
+
+	switch modrm.reg {
+	case 0, 1:
+		INSTR_SGDT_SIDT(core)
+	case 2:
+		INSTR_LGDT(core)
+	case 3:
+		INSTR_LIDT(core)
+	case 4:
+		INSTR_SMSW(core)
+	case 5:
+		// /5 is undefined
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+	case 6:
+		INSTR_LMSW(core)
+	default:
+		INSTR_INVLPG(core)
+	}
+	eof:
+}
+
 func INSTR_SMSW(core *CpuCore) {
 	var value uint16
 
-
-	core.IncrementIP()
+	core.currentByteAddr++
 	modrm, bytesConsumed, err := core.consumeModRm()
 	if err != nil { goto eof }
 	core.currentByteAddr += bytesConsumed
@@ -149,8 +230,80 @@ func INSTR_SMSW(core *CpuCore) {
 
 	err = core.writeRm16(&modrm, &value)
 	eof:
-	log.Printf("[%#04x] smsw %s", core.GetCurrentlyExecutingInstructionAddress(), "r/m16")
-	core.registers.IP = uint16(core.GetIP() + 1)
+	core.logger.Tracef("[%#04x] smsw %s", core.GetCurrentlyExecutingInstructionAddress(), "r/m16")
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Loads PE, MP, EM and TS, the low four bits of CR0, from a word. PE can be set but not cleared, only a MOV to CR0
+// leaves protected mode.
+func INSTR_LMSW(core *CpuCore) {
+	var value *uint16
+	var name string
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	value, name, err = core.readRm16(&modrm)
+	if err != nil { goto eof }
+
+	core.writeControlRegister(0, core.registers.CR0&^0x0F|uint32(*value)&0x0F|core.registers.CR0&ControlRegisterProtectionEnable)
+	core.logger.Tracef("[%#04x] lmsw %s", core.GetCurrentlyExecutingInstructionAddress(), name)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Invalidates the TLB entry of the page holding a memory operand. Paging isn't modelled so there's no TLB and only
+// the checks are made, INVLPG arrived with the 486 cache control instructions.
+func INSTR_INVLPG(core *CpuCore) {
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if !core.features.CacheControl || modrm.mod == 3 {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	core.logger.Tracef("[%#04x] invlpg [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), modrm.effectiveAddress(core))
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_FE_OPCODES(core *CpuCore) {
+
+	core.currentByteAddr++
+	modrm, _, err := core.consumeModRm()
+	core.currentByteAddr--
+	if err != nil { goto eof }
+
+	switch modrm.reg {
+	case 0:
+		{
+			// inc rm8
+			INSTR_INC(core)
+		}
+	case 1:
+		{
+			// dec rm8
+			INSTR_DEC(core)
+		}
+	default:
+		// /2 to /7 are undefined
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+	}
+	eof:
 }
 
 func INSTR_FF_OPCODES(core *CpuCore) {
@@ -161,22 +314,26 @@ func INSTR_FF_OPCODES(core *CpuCore) {
 	if err != nil { goto eof }
 
 	switch modrm.reg {
-	/*case modrm.rm == 0:
+	case 0:
 		{
-			// inc rm32
+			// inc rm16
+			INSTR_INC(core)
 		}
-	case modrm.rm == 1:
+	case 1:
 		{
-			// dec rm32
+			// dec rm16
+			INSTR_DEC(core)
 		}
-	case modrm.rm == 2:
+	case 2:
 		{
-			// call rm32
+			// call rm16
+			INSTR_CALL(core)
 		}
-	case modrm.rm == 3:
+	case 3:
 		{
-			// call m16
-		}*/
+			// call m16:16
+			INSTR_CALL(core)
+		}
 	case 4:
 		{
 			// jmp rm32
@@ -184,8 +341,8 @@ func INSTR_FF_OPCODES(core *CpuCore) {
 		}
 	case 5:
 		{
-			// jmp m16
-			INSTR_JMP_FAR_M16(core, &modrm)
+			// jmp m16:16 / m16:32
+			INSTR_JMP_FAR_MEM(core)
 		}
 	case 6:
 		{
@@ -193,9 +350,35 @@ func INSTR_FF_OPCODES(core *CpuCore) {
 			INSTR_PUSH(core)
 		}
 	default:
-		log.Println(fmt.Sprintf("INSTR_FF_OPCODE UNHANDLED OPER: (modrm: base:%d, reg:%d, mod:%d, rm: %d)\n\n", modrm.base, modrm.reg, modrm.mod, modrm.rm))
-		doCoreDump(core)
-		panic(0)
+		// /7 is undefined
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+	}
+	eof:
+}
+
+func INSTR_F6_OPCODES(core *CpuCore) {
+
+	core.currentByteAddr++
+	modrm, _, err := core.consumeModRm()
+	core.currentByteAddr--
+	if err != nil { goto eof }
+
+	switch modrm.reg {
+	case 0, 1:
+		{
+			// test rm8, imm8 / test rm16, imm16
+			INSTR_TEST(core)
+		}
+	case 2, 3:
+		{
+			// not rm / neg rm
+			INSTR_NOT_NEG(core)
+		}
+	default:
+		{
+			// mul, imul, div and idiv rm
+			INSTR_MUL_DIV(core)
+		}
 	}
 	eof:
 }
@@ -208,8 +391,14 @@ func INSTR_80_OPCODES(core *CpuCore) {
 	if err != nil { goto eof }
 
 	switch modrm.reg {
+	case 0:
+		INSTR_ADD(core)
 	case 1:
 		INSTR_OR(core)
+	case 2:
+		INSTR_ADC(core)
+	case 3:
+		INSTR_SBB(core)
 	case 4:
 		INSTR_AND(core)
 	case 5:
@@ -218,10 +407,6 @@ func INSTR_80_OPCODES(core *CpuCore) {
 		INSTR_XOR(core)
 	case 7:
 		INSTR_CMP(core)
-	default:
-		log.Println(fmt.Sprintf("INSTR_80_OPCODE UNHANDLED OPER: (modrm: base:%d, reg:%d, mod:%d, rm: %d)\n\n", modrm.base, modrm.reg, modrm.mod, modrm.rm))
-		doCoreDump(core)
-		panic(0)
 	}
 
 	eof:
@@ -234,21 +419,29 @@ func INSTR_81_OPCODES(core *CpuCore) {
 	core.currentByteAddr--
 	if err != nil { goto eof }
 
+	if core.flags.OperandSizeOverrideEnabled {
+		// the 32 bit forms of every operation share one handler
+		core.arithmeticRm32Immediate()
+		goto eof
+	}
+
 	switch modrm.reg {
 	case 0:
 		INSTR_ADD(core)
 	case 1:
 		INSTR_OR(core)
+	case 2:
+		INSTR_ADC(core)
+	case 3:
+		INSTR_SBB(core)
 	case 4:
 		INSTR_AND(core)
+	case 5:
+		INSTR_SUB(core)
 	case 6:
 		INSTR_XOR(core)
 	case 7:
 		INSTR_CMP(core)
-	default:
-		log.Println(fmt.Sprintf("INSTR_81_OPCODE UNHANDLED OPER: (modrm: base:%d, reg:%d, mod:%d, rm: %d)\n\n", modrm.base, modrm.reg, modrm.mod, modrm.rm))
-		doCoreDump(core)
-		panic(0)
 	}
 	eof:
 }
@@ -260,11 +453,21 @@ func INSTR_83_OPCODES(core *CpuCore) {
 	core.currentByteAddr--
 	if err != nil { goto eof }
 
+	if core.flags.OperandSizeOverrideEnabled {
+		// the 32 bit forms of every operation share one handler
+		core.arithmeticRm32Immediate()
+		goto eof
+	}
+
 	switch modrm.reg {
 	case 0:
 		INSTR_ADD(core)
 	case 1:
 		INSTR_OR(core)
+	case 2:
+		INSTR_ADC(core)
+	case 3:
+		INSTR_SBB(core)
 	case 4:
 		INSTR_AND(core)
 	case 5:
@@ -273,10 +476,6 @@ func INSTR_83_OPCODES(core *CpuCore) {
 		INSTR_XOR(core)
 	case 7:
 		INSTR_CMP(core)
-	default:
-		log.Println(fmt.Sprintf("INSTR_83_OPCODE UNHANDLED OPER: (modrm: base:%d, reg:%d, mod:%d, rm: %d)\n\n", modrm.base, modrm.reg, modrm.mod, modrm.rm))
-		doCoreDump(core)
-		panic(0)
 	}
 	eof:
 }
@@ -0,0 +1,604 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Protected mode segment descriptors
+	https://wiki.osdev.org/Global_Descriptor_Table
+*/
+
+const (
+	DescriptorAccessPresent    = 0x80
+	DescriptorAccessCodeOrData = 0x10
+	DescriptorAccessExecutable = 0x08
+	DescriptorAccessReadWrite  = 0x02 // readable for code segments, writable for data segments
+
+	DescriptorFlagGranularity = 0x8
+	DescriptorFlagSize        = 0x4
+
+	DescriptorTypeLdt = 0x2
+)
+
+type DescriptorTableRegister struct {
+	base  uint32
+	limit uint16
+}
+
+type SegmentDescriptor struct {
+	base   uint32
+	limit  uint32 // limit after applying the granularity bit
+	access uint8
+	flags  uint8
+}
+
+func (d SegmentDescriptor) isPresent() bool {
+	return d.access&DescriptorAccessPresent != 0
+}
+
+func (d SegmentDescriptor) isCodeOrData() bool {
+	return d.access&DescriptorAccessCodeOrData != 0
+}
+
+func (d SegmentDescriptor) isExecutable() bool {
+	return d.access&DescriptorAccessExecutable != 0
+}
+
+func (d SegmentDescriptor) isReadWrite() bool {
+	return d.access&DescriptorAccessReadWrite != 0
+}
+
+func (d SegmentDescriptor) isConforming() bool {
+	return d.isExecutable() && d.access&0x04 != 0
+}
+
+func (d SegmentDescriptor) dpl() uint8 {
+	return (d.access >> 5) & 0x3
+}
+
+// Type field of a system descriptor (gates and task state segments)
+func (d SegmentDescriptor) systemType() uint8 {
+	return d.access & 0x0F
+}
+
+func decodeSegmentDescriptor(raw []byte) SegmentDescriptor {
+	d := SegmentDescriptor{}
+	d.limit = uint32(raw[0]) | uint32(raw[1])<<8 | uint32(raw[6]&0x0F)<<16
+	d.base = uint32(raw[2]) | uint32(raw[3])<<8 | uint32(raw[4])<<16 | uint32(raw[7])<<24
+	d.access = raw[5]
+	d.flags = raw[6] >> 4
+
+	if d.flags&DescriptorFlagGranularity != 0 {
+		d.limit = d.limit<<12 | 0xFFF
+	}
+
+	return d
+}
+
+// #GP for a protection check on a selector, the error code is the selector index and TI bit
+func selectorFault(selector uint16) common.GeneralProtectionFault {
+	// the index and TI bit, the rpl is dropped
+	return common.GeneralProtectionFault{ErrorCode: selector&0xFFF8 | selector&common.GP_ERROR_CODE_LDT}
+}
+
+// Gets the linear address of the descriptor referenced by a selector, the TI bit selects the LDT
+func (core *CpuCore) descriptorAddress(selector uint16) (uint32, error) {
+	offset := uint32(selector & 0xFFF8)
+
+	if selector&0x4 != 0 {
+		if core.registers.LDTR.base&0xFFFC == 0 {
+			// no LDT loaded
+			return 0, selectorFault(selector)
+		}
+		if offset+7 > core.registers.LDTR.limit {
+			return 0, selectorFault(selector)
+		}
+		return core.registers.LDTR.descriptorBase + offset, nil
+	}
+
+	if offset+7 > uint32(core.registers.GDTR.limit) {
+		return 0, selectorFault(selector)
+	}
+
+	return core.registers.GDTR.base + offset, nil
+}
+
+// Reads the raw 8 bytes of the descriptor referenced by a selector
+func (core *CpuCore) readDescriptorBytes(selector uint16) ([]byte, error) {
+	addr, err := core.descriptorAddress(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 8)
+	for i := uint32(0); i < 8; i++ {
+		b, err := core.memoryAccessController.ReadAddr8(addr + i)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = b
+	}
+
+	return raw, nil
+}
+
+// Reads the descriptor referenced by a selector from the descriptor table
+func (core *CpuCore) readSegmentDescriptor(selector uint16) (SegmentDescriptor, error) {
+	raw, err := core.readDescriptorBytes(selector)
+	if err != nil {
+		return SegmentDescriptor{}, err
+	}
+
+	return decodeSegmentDescriptor(raw), nil
+}
+
+// Loads a selector into a segment register. In protected mode the descriptor is read from
+// the descriptor table and cached in the segment register.
+func (core *CpuCore) loadSegmentRegister(register *SegmentRegister, selector uint16) error {
+	if core.mode != common.PROTECTED_MODE {
+		register.base = selector
+		return nil
+	}
+
+	isStackSegment := register == &core.registers.SS
+
+	if selector&0xFFFC == 0 {
+		// null selector, valid for data segments until used
+		if isStackSegment {
+			return selectorFault(selector)
+		}
+		register.base = selector
+		register.descriptorBase = 0
+		register.limit = 0
+		register.access_information = 0
+		return nil
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return err
+	}
+
+	if !descriptor.isCodeOrData() {
+		return selectorFault(selector)
+	}
+
+	if isStackSegment && (descriptor.isExecutable() || !descriptor.isReadWrite()) {
+		// stack must be a writable data segment
+		return selectorFault(selector)
+	}
+
+	if !isStackSegment && descriptor.isExecutable() && !descriptor.isReadWrite() {
+		// execute only code segments can't be loaded into data segment registers
+		return selectorFault(selector)
+	}
+
+	if !descriptor.isPresent() {
+		return selectorFault(selector)
+	}
+
+	register.base = selector
+	register.descriptorBase = descriptor.base
+	register.limit = descriptor.limit
+	register.access_information = uint16(descriptor.access) | uint16(descriptor.flags)<<8
+
+	return nil
+}
+
+// Loads CS for a control transfer. Unlike the data segment registers, CS must reference an executable segment.
+func (core *CpuCore) loadCodeSegment(selector uint16) error {
+	if core.mode != common.PROTECTED_MODE {
+		core.registers.CS.base = selector
+		return nil
+	}
+
+	if selector&0xFFFC == 0 {
+		return selectorFault(selector)
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return err
+	}
+
+	if !descriptor.isCodeOrData() || !descriptor.isExecutable() || !descriptor.isPresent() {
+		return selectorFault(selector)
+	}
+
+	core.registers.CS.base = selector
+	core.registers.CS.descriptorBase = descriptor.base
+	core.registers.CS.limit = descriptor.limit
+	core.registers.CS.access_information = uint16(descriptor.access) | uint16(descriptor.flags)<<8
+
+	return nil
+}
+
+func (core *CpuCore) readDescriptorTableOperand(modrm *ModRm) (DescriptorTableRegister, error) {
+	addressMode, err := core.translateRm(modrm, modrm.effectiveAddress(core), 6, accessRead)
+	if err != nil {
+		return DescriptorTableRegister{}, err
+	}
+
+	limit, err := core.memoryAccessController.ReadAddr16(uint32(addressMode))
+	if err != nil {
+		return DescriptorTableRegister{}, err
+	}
+
+	baseLow, err := core.memoryAccessController.ReadAddr16(uint32(addressMode) + 2)
+	if err != nil {
+		return DescriptorTableRegister{}, err
+	}
+
+	baseHigh, err := core.memoryAccessController.ReadAddr16(uint32(addressMode) + 4)
+	if err != nil {
+		return DescriptorTableRegister{}, err
+	}
+
+	base := uint32(baseHigh)<<16 | uint32(baseLow)
+	if !core.flags.OperandSizeOverrideEnabled {
+		// with a 16 bit operand size only 24 bits of the base are used
+		base &= 0x00FFFFFF
+	}
+
+	return DescriptorTableRegister{base: base, limit: limit}, nil
+}
+
+// Stores a descriptor table register as the 6 byte limit and base. With a 16 bit operand size only 24 bits of the
+// base are stored and the top byte is written as 0.
+func (core *CpuCore) writeDescriptorTableOperand(modrm *ModRm, table DescriptorTableRegister) error {
+	addressMode, err := core.translateRm(modrm, modrm.effectiveAddress(core), 6, accessWrite)
+	if err != nil {
+		return err
+	}
+
+	base := table.base
+	if !core.flags.OperandSizeOverrideEnabled {
+		base &= 0x00FFFFFF
+	}
+
+	err = core.memoryAccessController.WriteAddr16(addressMode, table.limit)
+	if err != nil {
+		return err
+	}
+
+	return core.memoryAccessController.WriteAddr32(addressMode+2, base)
+}
+
+func INSTR_LGDT(core *CpuCore) {
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	core.registers.GDTR, err = core.readDescriptorTableOperand(&modrm)
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] lgdt (base: %#08x, limit: %#04x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.GDTR.base, core.registers.GDTR.limit)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_LIDT(core *CpuCore) {
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	core.registers.IDTR, err = core.readDescriptorTableOperand(&modrm)
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] lidt (base: %#08x, limit: %#04x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.IDTR.base, core.registers.IDTR.limit)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// SGDT (0x0F 0x01 /0) and SIDT (0x0F 0x01 /1)
+func INSTR_SGDT_SIDT(core *CpuCore) {
+	var table DescriptorTableRegister
+	var name string
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if modrm.mod == 3 {
+		// the operand has to be in memory
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	table, name = core.registers.GDTR, "sgdt"
+	if modrm.reg == 1 {
+		table, name = core.registers.IDTR, "sidt"
+	}
+
+	err = core.writeDescriptorTableOperand(&modrm, table)
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s (base: %#08x, limit: %#04x)", core.GetCurrentlyExecutingInstructionAddress(), name, table.base, table.limit)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// System descriptor types that LAR reports, LSL only accepts the ones that have a limit
+func isLarVisibleSystemType(descriptorType uint8) bool {
+	switch descriptorType {
+	case 0x1, 0x2, 0x3, 0x4, 0x5, 0x9, 0xB, 0xC:
+		return true
+	}
+	return false
+}
+
+func isLslVisibleSystemType(descriptorType uint8) bool {
+	switch descriptorType {
+	case 0x1, 0x2, 0x3, 0x9, 0xB:
+		return true
+	}
+	return false
+}
+
+// Checks a selector for LAR/LSL and VERR/VERW, returns the descriptor and whether it is visible at the current privilege level.
+// A nil systemTypeVisible hides every system descriptor, VERR/VERW only look at code and data segments.
+func (core *CpuCore) querySegmentDescriptor(selector uint16, systemTypeVisible func(uint8) bool) (SegmentDescriptor, bool) {
+	if selector&0xFFFC == 0 {
+		return SegmentDescriptor{}, false
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return SegmentDescriptor{}, false
+	}
+
+	if !descriptor.isCodeOrData() && (systemTypeVisible == nil || !systemTypeVisible(descriptor.access&0x0F)) {
+		return SegmentDescriptor{}, false
+	}
+
+	isConformingCode := descriptor.isCodeOrData() && descriptor.isExecutable() && descriptor.access&0x04 != 0
+	if !isConformingCode {
+		dpl := (descriptor.access >> 5) & 0x3
+		cpl := uint8(core.registers.CS.base & 0x3)
+		rpl := uint8(selector & 0x3)
+		if dpl < cpl || dpl < rpl {
+			return SegmentDescriptor{}, false
+		}
+	}
+
+	return descriptor, true
+}
+
+func (core *CpuCore) readSelectorOperand(modrm *ModRm) (uint16, error) {
+	selector, _, err := core.readRm16(modrm)
+	if err != nil {
+		return 0, err
+	}
+	return *selector, nil
+}
+
+func INSTR_LAR(core *CpuCore) {
+	var selector uint16
+	var descriptor SegmentDescriptor
+	var visible bool
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	selector, err = core.readSelectorOperand(&modrm)
+	if err != nil { goto eof }
+
+	descriptor, visible = core.querySegmentDescriptor(selector, isLarVisibleSystemType)
+	core.registers.SetFlag(ZeroFlag, visible)
+	if visible {
+		if core.flags.OperandSizeOverrideEnabled {
+			*core.registers.registers32Bit[modrm.reg] = (uint32(descriptor.access) | uint32(descriptor.flags)<<12) << 8
+		} else {
+			*core.registers.registers16Bit[modrm.reg] = uint16(descriptor.access) << 8
+		}
+	}
+
+	core.logger.Tracef("[%#04x] lar %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index16ToString(modrm.reg), selector)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_ARPL(core *CpuCore) {
+	// arpl r/m16, r16: raises the RPL of the destination selector to the RPL of the source, ZF set when adjusted
+	var src *uint16
+	var srcName, dstName string
+	var adjusted bool
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	src, srcName = core.readR16(&modrm)
+	dstName, err = core.modifyRm16(&modrm, func(selector uint16) uint16 {
+		if selector&0x3 < *src&0x3 {
+			adjusted = true
+			return selector&0xFFFC | *src&0x3
+		}
+		return selector
+	})
+	if err != nil { goto eof }
+
+	core.registers.SetFlag(ZeroFlag, adjusted)
+
+	core.logger.Tracef("[%#04x] arpl %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_LSL(core *CpuCore) {
+	var selector uint16
+	var descriptor SegmentDescriptor
+	var visible bool
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	selector, err = core.readSelectorOperand(&modrm)
+	if err != nil { goto eof }
+
+	descriptor, visible = core.querySegmentDescriptor(selector, isLslVisibleSystemType)
+	core.registers.SetFlag(ZeroFlag, visible)
+	if visible {
+		if core.flags.OperandSizeOverrideEnabled {
+			*core.registers.registers32Bit[modrm.reg] = descriptor.limit
+		} else {
+			*core.registers.registers16Bit[modrm.reg] = uint16(descriptor.limit)
+		}
+	}
+
+	core.logger.Tracef("[%#04x] lsl %s, %#04x", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index16ToString(modrm.reg), selector)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// Loads the LDT register. The selector must reference an LDT descriptor in the GDT, a null selector leaves no LDT loaded.
+func (core *CpuCore) loadLdtRegister(selector uint16) error {
+	if selector&0xFFFC == 0 {
+		core.registers.LDTR = SegmentRegister{base: selector}
+		return nil
+	}
+
+	if selector&0x4 != 0 {
+		return selectorFault(selector)
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return err
+	}
+
+	if descriptor.isCodeOrData() || descriptor.systemType() != DescriptorTypeLdt {
+		return selectorFault(selector)
+	}
+
+	if !descriptor.isPresent() {
+		return selectorFault(selector)
+	}
+
+	core.registers.LDTR.base = selector
+	core.registers.LDTR.descriptorBase = descriptor.base
+	core.registers.LDTR.limit = descriptor.limit
+	core.registers.LDTR.access_information = uint16(descriptor.access) | uint16(descriptor.flags)<<8
+
+	return nil
+}
+
+func INSTR_LLDT(core *CpuCore) {
+	var selector uint16
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	selector, err = core.readSelectorOperand(&modrm)
+	if err != nil { goto eof }
+
+	err = core.loadLdtRegister(selector)
+	if err != nil {
+		if !core.raiseProtectionFault(err) {
+			core.logger.Errorf("[%#04x] lldt %#04x failed: %s", core.GetCurrentlyExecutingInstructionAddress(), selector, err.Error())
+		}
+		goto eof
+	}
+
+	core.logger.Tracef("[%#04x] lldt %#04x", core.GetCurrentlyExecutingInstructionAddress(), selector)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_SLDT(core *CpuCore) {
+	var value uint16
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	value = core.registers.LDTR.base
+	err = core.writeRm16(&modrm, &value)
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] sldt %#04x", core.GetCurrentlyExecutingInstructionAddress(), value)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// VERR/VERW, sets ZF when the selected segment is readable (or writable) at the current privilege level
+func INSTR_VERR_VERW(core *CpuCore) {
+	var selector uint16
+	var descriptor SegmentDescriptor
+	var visible, verified bool
+	var name string
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	selector, err = core.readSelectorOperand(&modrm)
+	if err != nil { goto eof }
+
+	descriptor, visible = core.querySegmentDescriptor(selector, nil)
+	if modrm.reg == 4 {
+		name = "verr"
+		// data segments are always readable, code segments when the R bit is set
+		verified = visible && (!descriptor.isExecutable() || descriptor.isReadWrite())
+	} else {
+		name = "verw"
+		verified = visible && !descriptor.isExecutable() && descriptor.isReadWrite()
+	}
+	core.registers.SetFlag(ZeroFlag, verified)
+
+	core.logger.Tracef("[%#04x] %s %#04x", core.GetCurrentlyExecutingInstructionAddress(), name, selector)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
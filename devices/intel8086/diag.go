@@ -3,16 +3,15 @@ package intel8086
 import (
 	"fmt"
 	"github.com/andrewjc/threeatesix/common"
-	"log"
 	"strings"
 )
 
 func doCoreDump(core *CpuCore) {
 
-	log.Println("Dumping core: " + core.FriendlyPartName())
+	core.logger.Errorf("Dumping core: %s", core.FriendlyPartName())
 
 	if core.mode == common.REAL_MODE {
-		log.Println("Cpu core in real mode")
+		core.logger.Errorf("Cpu core in real mode")
 	}
 
 	// Gather next few bytes for debugging...
@@ -21,35 +20,35 @@ func doCoreDump(core *CpuCore) {
 	for _, b := range peekBytes {
 		stb.WriteString(fmt.Sprintf("%#2x ", b))
 	}
-	log.Printf("Next 10 bytes at instruction pointer: " + stb.String())
+	core.logger.Errorf("Next 10 bytes at instruction pointer: %s", stb.String())
 
-	log.Printf("CS: %#2x, IP: %#2x", core.registers.CS, core.registers.IP)
+	core.logger.Errorf("CS: %#2x, IP: %#2x", core.registers.CS, core.registers.IP)
 
-	log.Printf("8 Bit registers:")
+	core.logger.Errorf("8 Bit registers:")
 	for x, y := range core.registers.registers8Bit {
-		log.Printf("%v %#2x (pntr: %#2x)", core.registers.index8ToString(uint8(x)), *y, y)
+		core.logger.Errorf("%v %#2x (pntr: %#2x)", core.registers.index8ToString(uint8(x)), *y, y)
 	}
-	log.Printf("16 Bit registers:")
+	core.logger.Errorf("16 Bit registers:")
 	for x, y := range core.registers.registers16Bit {
-		log.Printf("%v %#2x (pntr: %#2x)", core.registers.index16ToString(uint8(x)), *y, y)
+		core.logger.Errorf("%v %#2x (pntr: %#2x)", core.registers.index16ToString(uint8(x)), *y, y)
 	}
-	log.Printf("Segment registers:")
+	core.logger.Errorf("Segment registers:")
 	for x, y := range core.registers.registersSegmentRegisters {
-		log.Printf("%v %#2x (pntr: %#2x)", core.registers.indexSegmentToString(uint8(x)), *y, y)
+		core.logger.Errorf("%v %#2x (pntr: %#2x)", core.registers.indexSegmentToString(uint8(x)), *y, y)
 	}
 
-	log.Printf("Flags:")
-	log.Printf("Z: %t", core.registers.GetFlag(ZeroFlag))
-	log.Printf("D: %t", core.registers.GetFlag(DirectionFlag))
-	log.Printf("C: %t", core.registers.GetFlag(CarryFlag))
-	log.Printf("O: %t", core.registers.GetFlag(OverFlowFlag))
-
-	log.Printf("Control flags:")
-	log.Printf("CR0[pe] = %b",  core.registers.CR0 >> 0 & 1)
-	log.Printf("CR0[mp] = %b",  core.registers.CR0 >> 1 & 1)
-	log.Printf("CR0[em] = %b",  core.registers.CR0 >> 2 & 1)
-	log.Printf("CR0[ts] = %b",  core.registers.CR0 >> 3 & 1)
-	log.Printf("CR0[et] = %b",  core.registers.CR0 >> 4 & 1)
-	log.Printf("CR0[ne] = %b",  core.registers.CR0 >> 5 & 1)
+	core.logger.Errorf("Flags:")
+	core.logger.Errorf("Z: %t", core.registers.GetFlag(ZeroFlag))
+	core.logger.Errorf("D: %t", core.registers.GetFlag(DirectionFlag))
+	core.logger.Errorf("C: %t", core.registers.GetFlag(CarryFlag))
+	core.logger.Errorf("O: %t", core.registers.GetFlag(OverFlowFlag))
+
+	core.logger.Errorf("Control flags:")
+	core.logger.Errorf("CR0[pe] = %b",  core.registers.CR0 >> 0 & 1)
+	core.logger.Errorf("CR0[mp] = %b",  core.registers.CR0 >> 1 & 1)
+	core.logger.Errorf("CR0[em] = %b",  core.registers.CR0 >> 2 & 1)
+	core.logger.Errorf("CR0[ts] = %b",  core.registers.CR0 >> 3 & 1)
+	core.logger.Errorf("CR0[et] = %b",  core.registers.CR0 >> 4 & 1)
+	core.logger.Errorf("CR0[ne] = %b",  core.registers.CR0 >> 5 & 1)
 }
 
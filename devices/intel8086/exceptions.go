@@ -0,0 +1,264 @@
+package intel8086
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Processor exceptions
+	Faults are reported with CS:IP of the faulting instruction so the handler can restart it, traps with CS:IP
+	of the following instruction. An instruction raises an exception with raiseException, and it is delivered
+	once the instruction handler returns.
+
+	A second exception raised before the first is delivered, or while delivering it, escalates to #DF when both
+	are contributory (#DE, #TS, #NP, #SS and #GP), or when the first is #PF and the second is #PF or contributory.
+	Any other pair is delivered serially, the second taken at the entry of the first one's handler.
+
+	The host can watch exceptions with a hook, called for each one as it is delivered with CS:IP already pointing
+	at the instruction the guest handler would see. A hook returning true has handled the exception itself and the
+	guest handler isn't dispatched, the CPU carries on from CS:IP as the hook left it. The first of a pair which
+	escalated to #DF is still shown to the hook, and if the hook handles it the second is delivered in place of #DF.
+*/
+
+type ExceptionKind uint8
+
+const (
+	ExceptionFault ExceptionKind = iota
+	ExceptionTrap
+	ExceptionAbort
+)
+
+const (
+	ExceptionDivideError        = 0x00
+	ExceptionDebug              = 0x01
+	ExceptionBreakpoint         = 0x03
+	ExceptionOverflow           = 0x04
+	ExceptionBoundRange         = 0x05
+	ExceptionInvalidOpcode      = 0x06
+	ExceptionDeviceNotAvailable = 0x07
+	ExceptionDoubleFault        = 0x08
+	ExceptionInvalidTss         = 0x0A
+	ExceptionSegmentNotPresent  = 0x0B
+	ExceptionStackFault         = 0x0C
+	ExceptionGeneralProtection  = 0x0D
+	ExceptionPageFault          = 0x0E
+)
+
+// How a second exception combines with one still being delivered
+type exceptionClass uint8
+
+const (
+	exceptionBenign exceptionClass = iota
+	exceptionContributory
+	exceptionClassPageFault
+)
+
+type Exception struct {
+	Vector       uint8
+	Kind         ExceptionKind
+	ErrorCode    uint32
+	HasErrorCode bool // #DF, #TS, #NP, #SS, #GP and #PF push an error code in protected mode
+
+	LinearAddress uint32 // the address which faulted, loaded into CR2 when a #PF is delivered
+}
+
+func (e Exception) Error() string {
+	kind := "fault"
+	switch e.Kind {
+	case ExceptionTrap:
+		kind = "trap"
+	case ExceptionAbort:
+		kind = "abort"
+	}
+
+	if e.HasErrorCode {
+		return fmt.Sprintf("exception %#02x (%s, error code %#04x)", e.Vector, kind, e.ErrorCode)
+	}
+	return fmt.Sprintf("exception %#02x (%s)", e.Vector, kind)
+}
+
+func NewFault(vector uint8) Exception {
+	return Exception{Vector: vector, Kind: ExceptionFault}
+}
+
+func NewFaultWithErrorCode(vector uint8, errorCode uint32) Exception {
+	return Exception{Vector: vector, Kind: ExceptionFault, ErrorCode: errorCode, HasErrorCode: true}
+}
+
+func NewPageFault(linearAddress uint32, errorCode uint32) Exception {
+	return Exception{Vector: ExceptionPageFault, Kind: ExceptionFault, ErrorCode: errorCode, HasErrorCode: true, LinearAddress: linearAddress}
+}
+
+func NewTrap(vector uint8) Exception {
+	return Exception{Vector: vector, Kind: ExceptionTrap}
+}
+
+// Called for every exception delivered, returns true when it has been handled and guest dispatch is skipped
+type ExceptionHook func(e Exception) (handled bool)
+
+// Installs a hook called as each exception is delivered, nil removes it
+func (core *CpuCore) SetExceptionHook(hook ExceptionHook) {
+	core.exceptionHook = hook
+}
+
+// Whether the exception hook took the exception instead of the guest
+func (core *CpuCore) exceptionHandledByHook(e Exception) bool {
+	return core.exceptionHook != nil && core.exceptionHook(e)
+}
+
+func newDoubleFault() Exception {
+	return Exception{Vector: ExceptionDoubleFault, Kind: ExceptionAbort, HasErrorCode: true}
+}
+
+func classifyException(vector uint8) exceptionClass {
+	switch vector {
+	case ExceptionDivideError, ExceptionInvalidTss, ExceptionSegmentNotPresent, ExceptionStackFault, ExceptionGeneralProtection:
+		return exceptionContributory
+	case ExceptionPageFault:
+		return exceptionClassPageFault
+	}
+	return exceptionBenign
+}
+
+// Whether a second exception, raised while the first is outstanding, escalates to #DF. Any other pair is
+// delivered serially.
+func causesDoubleFault(first uint8, second uint8) bool {
+	switch classifyException(first) {
+	case exceptionContributory:
+		return classifyException(second) == exceptionContributory
+	case exceptionClassPageFault:
+		return classifyException(second) != exceptionBenign
+	}
+	return false
+}
+
+// Raises an exception from the executing instruction, it is delivered when the instruction handler returns
+func (core *CpuCore) raiseException(e Exception) {
+	if core.pendingException == nil {
+		core.pendingException = &e
+		return
+	}
+
+	first := *core.pendingException
+	if core.serialException != nil {
+		first = *core.serialException
+	}
+
+	if causesDoubleFault(first.Vector, e.Vector) {
+		doubleFault := newDoubleFault()
+		core.pendingException = &doubleFault
+		core.serialException = nil
+		core.escalatedExceptions = []Exception{first, e}
+		return
+	}
+
+	// taken once the first has been delivered, at the entry of its handler
+	core.serialException = &e
+}
+
+// Called by Step after the instruction, faults are restarted from the saved CS:IP of the instruction
+func (core *CpuCore) deliverPendingException(instructionCS SegmentRegister, instructionIP uint32) {
+	e := *core.pendingException
+	core.pendingException = nil
+	serial := core.serialException
+	core.serialException = nil
+	escalated := core.escalatedExceptions
+	core.escalatedExceptions = nil
+
+	if e.Kind != ExceptionTrap {
+		core.registers.CS = instructionCS
+		core.setEIP(instructionIP)
+	}
+
+	if len(escalated) == 2 && core.exceptionHandledByHook(escalated[0]) {
+		// the host took the first, so the second wasn't raised while it was outstanding
+		e = escalated[1]
+	}
+
+	core.deliverException(e)
+
+	if serial != nil && !core.halted {
+		core.deliverException(*serial)
+	}
+}
+
+// Dispatches an exception to its handler. A fault delivering it follows the same rules as a second exception
+// raised by an instruction, and a failure delivering #DF is a triple fault.
+func (core *CpuCore) deliverException(e Exception) {
+	for {
+		core.logger.Debugf("[%#04x] %s", core.GetCurrentlyExecutingInstructionAddress(), e.Error())
+
+		if e.Vector == ExceptionPageFault {
+			core.registers.CR2 = e.LinearAddress
+		}
+
+		if core.exceptionHandledByHook(e) {
+			return
+		}
+
+		err := core.dispatchException(e)
+		if err == nil {
+			return
+		}
+		// a limit check failing while delivering is handled here rather than raised again
+		core.pendingException = nil
+
+		if e.Vector == ExceptionDoubleFault {
+			// triple fault, the processor shuts down
+			core.logger.Errorf("[%#04x] triple fault delivering %s: %s", core.GetCurrentlyExecutingInstructionAddress(), e.Error(), err.Error())
+			core.halted = true
+			return
+		}
+
+		core.logger.Warnf("[%#04x] failed to deliver %s: %s", core.GetCurrentlyExecutingInstructionAddress(), e.Error(), err.Error())
+
+		second := deliveryFault(err)
+		if causesDoubleFault(e.Vector, second.Vector) {
+			second = newDoubleFault()
+		}
+		e = second
+	}
+}
+
+// The exception for an error delivering another, anything other than a protection fault becomes #DF
+func deliveryFault(err error) Exception {
+	switch fault := err.(type) {
+	case Exception:
+		return fault
+	case common.GeneralProtectionFault:
+		return NewFaultWithErrorCode(ExceptionGeneralProtection, uint32(fault.ErrorCode))
+	case common.SegmentNotPresentFault:
+		return NewFaultWithErrorCode(ExceptionSegmentNotPresent, uint32(fault.ErrorCode))
+	}
+	return newDoubleFault()
+}
+
+// Raises #GP or #NP with the selector error code when a protection check failed, returns false for any other error
+func (core *CpuCore) raiseProtectionFault(err error) bool {
+	switch fault := err.(type) {
+	case Exception:
+		// already raised by a segment limit check
+		return true
+	case common.GeneralProtectionFault:
+		core.raiseException(NewFaultWithErrorCode(ExceptionGeneralProtection, uint32(fault.ErrorCode)))
+		return true
+	case common.SegmentNotPresentFault:
+		core.raiseException(NewFaultWithErrorCode(ExceptionSegmentNotPresent, uint32(fault.ErrorCode)))
+		return true
+	}
+	return false
+}
+
+func (core *CpuCore) dispatchException(e Exception) error {
+	// real mode handlers never receive an error code
+	return core.interruptWithErrorCode(e.Vector, e.HasErrorCode && core.mode == common.PROTECTED_MODE, e.ErrorCode)
+}
+
+func INSTR_INT3(core *CpuCore) {
+	// Breakpoint, reported as a trap so the handler returns past the int3
+	core.currentByteAddr++
+	core.logger.Tracef("[%#04x] int3", core.GetCurrentlyExecutingInstructionAddress())
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+	core.raiseException(NewTrap(ExceptionBreakpoint))
+}
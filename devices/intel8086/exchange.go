@@ -0,0 +1,180 @@
+package intel8086
+
+import (
+	"fmt"
+)
+
+/*
+	CMPXCHG and XADD
+	The destination is always written back, CMPXCHG writes its own value when the comparison fails.
+
+	CMPXCHG8B (0x0F 0xC7 /1) has a feature of its own. It compares EDX:EAX with a quadword in memory, storing
+	ECX:EBX when they match and loading EDX:EAX from memory when they don't. Only ZF is changed. A register
+	operand, or any reg field but 1, raises #UD.
+*/
+
+// CMPXCHG r/m8, r8 (0x0F 0xB0) and CMPXCHG r/m16, r16 / r/m32, r32 (0x0F 0xB1)
+func INSTR_CMPXCHG(core *CpuCore) {
+	var rmStr, rStr string
+
+	core.currentByteAddr++
+
+	if !core.features.CompareExchange {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		switch {
+		case core.currentOpCodeBeingExecuted == 0xB0:
+			var r8 *uint8
+			r8, rStr = core.readR8(&modrm)
+			rmStr, err = core.modifyRm8(&modrm, func(dest uint8) uint8 {
+				core.setSubtractFlags(uint32(core.registers.AL), uint32(dest), 8)
+				if core.registers.AL == dest {
+					return *r8
+				}
+				core.registers.AL = dest
+				return dest
+			})
+		case core.flags.OperandSizeOverrideEnabled:
+			var r32 *uint32
+			r32, rStr = core.readR32(&modrm)
+			rmStr, err = core.modifyRm32(&modrm, func(dest uint32) uint32 {
+				core.setSubtractFlags(core.registers.EAX, dest, 32)
+				if core.registers.EAX == dest {
+					return *r32
+				}
+				core.registers.EAX = dest
+				return dest
+			})
+		default:
+			var r16 *uint16
+			r16, rStr = core.readR16(&modrm)
+			rmStr, err = core.modifyRm16(&modrm, func(dest uint16) uint16 {
+				core.setSubtractFlags(uint32(core.registers.AX), uint32(dest), 16)
+				if core.registers.AX == dest {
+					return *r16
+				}
+				core.registers.AX = dest
+				return dest
+			})
+		}
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] cmpxchg %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// XADD r/m8, r8 (0x0F 0xC0) and XADD r/m16, r16 / r/m32, r32 (0x0F 0xC1)
+func INSTR_XADD(core *CpuCore) {
+	var rmStr, rStr string
+
+	core.currentByteAddr++
+
+	if !core.features.CompareExchange {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		switch {
+		case core.currentOpCodeBeingExecuted == 0xC0:
+			var r8 *uint8
+			r8, rStr = core.readR8(&modrm)
+			rmStr, err = core.modifyRm8(&modrm, func(dest uint8) uint8 {
+				core.setAddFlags(uint32(dest), uint32(*r8), 8)
+				sum := dest + *r8
+				*r8 = dest
+				return sum
+			})
+		case core.flags.OperandSizeOverrideEnabled:
+			var r32 *uint32
+			r32, rStr = core.readR32(&modrm)
+			rmStr, err = core.modifyRm32(&modrm, func(dest uint32) uint32 {
+				core.setAddFlags(dest, *r32, 32)
+				sum := dest + *r32
+				*r32 = dest
+				return sum
+			})
+		default:
+			var r16 *uint16
+			r16, rStr = core.readR16(&modrm)
+			rmStr, err = core.modifyRm16(&modrm, func(dest uint16) uint16 {
+				core.setAddFlags(uint32(dest), uint32(*r16), 16)
+				sum := dest + *r16
+				*r16 = dest
+				return sum
+			})
+		}
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] xadd %s, %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr, rStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// CMPXCHG8B m64 (0x0F 0xC7 /1)
+func INSTR_CMPXCHG8B(core *CpuCore) {
+	var rmStr string
+
+	core.currentByteAddr++
+
+	if !core.features.CompareExchange8Byte {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		if modrm.reg != 1 || modrm.mod == 3 {
+			core.raiseException(NewFault(ExceptionInvalidOpcode))
+			goto eof
+		}
+
+		addressMode := modrm.effectiveAddress(core)
+		rmStr = fmt.Sprintf("qword_F%#04x", addressMode)
+		address, err := core.translateRm(&modrm, addressMode, 8, accessWrite)
+		if err != nil { goto eof }
+		low, err := core.memoryAccessController.ReadAddr32(address)
+		if err != nil { goto eof }
+		high, err := core.memoryAccessController.ReadAddr32(address + 4)
+		if err != nil { goto eof }
+		core.watchData(address, 8, true)
+
+		if low == core.registers.EAX && high == core.registers.EDX {
+			core.registers.SetFlag(ZeroFlag, true)
+			low, high = core.registers.EBX, core.registers.ECX
+		} else {
+			core.registers.SetFlag(ZeroFlag, false)
+			core.registers.EAX, core.registers.EDX = low, high
+		}
+
+		// memory is written either way, as the locked cycle on a real part does
+		err = core.memoryAccessController.WriteAddr32(address, low)
+		if err != nil { goto eof }
+		err = core.memoryAccessController.WriteAddr32(address+4, high)
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] cmpxchg8b %s", core.GetCurrentlyExecutingInstructionAddress(), rmStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,70 @@
+package intel8086
+
+/*
+	CPU models and optional instructions
+	The core is a 386. Each instruction which arrived with a later part is gated by a feature, and raises #UD as
+	it would on a 386 while the feature is off. SetModel enables the features of a 486 or Pentium together, and
+	SetFeatures overrides single ones afterwards, for the later instructions no modelled part has.
+*/
+
+type CpuModel uint8
+
+const (
+	CpuModel386 CpuModel = iota
+	CpuModel486
+	CpuModelPentium
+)
+
+type CpuFeatures struct {
+	TimeStampCounter bool // RDTSC (0x0F 0x31), Pentium, see timestamp.go
+	ConditionalMove  bool // CMOVcc (0x0F 0x40-0x4F), Pentium Pro
+
+	ModelSpecificRegisters bool // RDMSR/WRMSR (0x0F 0x32, 0x0F 0x30), Pentium, see msr.go
+	CacheControl           bool // INVD/WBINVD/INVLPG (0x0F 0x08, 0x0F 0x09, 0x0F 0x01 /7), 486
+	CompareExchange        bool // CMPXCHG/XADD (0x0F 0xB0/0xB1, 0x0F 0xC0/0xC1), 486, see exchange.go
+	CompareExchange8Byte   bool // CMPXCHG8B (0x0F 0xC7 /1), Pentium, see exchange.go
+	SpinLoopHint           bool // PAUSE (0xF3 0x90), Pentium 4, a NOP with a stray REP prefix without it
+	ByteSwap               bool // BSWAP (0x0F 0xC8-0xCF), 486, see bswap.go
+	FloatingPoint          bool // the x87 state instructions (0xD9, 0xDB, 0xDD, 0xDF), on chip from the 486, see fpu.go
+	HintNop                bool // PREFETCH and the hint NOPs (0x0F 0x18-0x1F), Pentium Pro, see hintnop.go
+
+	NoUndocumentedOpcodes bool // SALC (0xD6) raises #UD, see salc.go
+}
+
+// Gets the features of a model, each part has those of the one before
+func (model CpuModel) Features() CpuFeatures {
+	var features CpuFeatures
+
+	if model >= CpuModel486 {
+		features.CacheControl = true
+		features.CompareExchange = true
+		features.ByteSwap = true
+		features.FloatingPoint = true
+	}
+
+	if model >= CpuModelPentium {
+		features.TimeStampCounter = true
+		features.ModelSpecificRegisters = true
+		features.CompareExchange8Byte = true
+	}
+
+	return features
+}
+
+// Selects the model, replacing any features set before
+func (core *CpuCore) SetModel(model CpuModel) {
+	core.cpuModel = model
+	core.features = model.Features()
+}
+
+func (core *CpuCore) GetModel() CpuModel {
+	return core.cpuModel
+}
+
+func (core *CpuCore) SetFeatures(features CpuFeatures) {
+	core.features = features
+}
+
+func (core *CpuCore) GetFeatures() CpuFeatures {
+	return core.features
+}
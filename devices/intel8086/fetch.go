@@ -0,0 +1,163 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Instruction fetch
+	Opcode, modrm, displacement and immediate bytes are read through these helpers. A fetch that runs past the
+	end of physical memory, or past the code segment limit in protected mode, raises #GP(0) rather than
+	returning garbage, and the instruction is abandoned. In real mode the offset wraps at 64k, so an instruction
+	straddling CS:FFFF takes its remaining bytes from CS:0000.
+
+	No instruction can be longer than 15 bytes. A fetch past the 15th byte from the start of the instruction
+	raises #GP(0) as well, however the length built up: a run of redundant prefixes, or prefixes in front of a
+	long addressing form and immediate.
+*/
+
+// Checks that size bytes at the linear address addr are inside the code segment
+func (core *CpuCore) checkFetch(addr uint32, size uint32) error {
+	if core.mode != common.PROTECTED_MODE {
+		return nil
+	}
+
+	offset := addr - core.segmentBase(core.registers.CS)
+	last := offset + size - 1
+	if last < offset || last > core.registers.CS.limit || !core.registers.CS.permits(accessFetch) {
+		return core.fetchFault()
+	}
+
+	return nil
+}
+
+// Checks that size bytes at the linear address addr are within the longest instruction from its first byte
+func (core *CpuCore) checkInstructionLength(addr uint32, size uint32) error {
+	if addr+size-core.currentByteDecodeStart > MaxInstructionLength {
+		return core.fetchFault()
+	}
+	return nil
+}
+
+// Wraps a linear code address to its 16 bit offset within CS in real mode
+func (core *CpuCore) wrapCodeAddress(addr uint32) uint32 {
+	if core.mode == common.PROTECTED_MODE {
+		return addr
+	}
+
+	base := core.segmentBase(core.registers.CS)
+	return base + (addr-base)&0xFFFF
+}
+
+// Whether a fetch of size bytes runs past the end of the real mode code segment and has to be split
+func (core *CpuCore) fetchWraps(addr uint32, size uint32) bool {
+	return core.wrapCodeAddress(addr+size-1) != core.wrapCodeAddress(addr)+size-1
+}
+
+// Raises #GP(0) for a failed fetch. Handlers may carry on fetching after a failure, so only the first is raised.
+func (core *CpuCore) fetchFault() error {
+	if core.pendingException != nil {
+		return *core.pendingException
+	}
+
+	e := NewFaultWithErrorCode(ExceptionGeneralProtection, 0)
+	core.raiseException(e)
+	return e
+}
+
+func (core *CpuCore) fetch8(addr uint32) (uint8, error) {
+	if err := core.checkInstructionLength(addr, 1); err != nil {
+		return 0, err
+	}
+
+	addr = core.wrapCodeAddress(addr)
+	if err := core.checkFetch(addr, 1); err != nil {
+		return 0, err
+	}
+
+	if core.prefetch.enabled {
+		return core.prefetchByte(addr)
+	}
+
+	value, err := core.memoryAccessController.ReadAddr8(addr)
+	if err != nil {
+		return 0, core.fetchFault()
+	}
+	return value, nil
+}
+
+func (core *CpuCore) fetch16(addr uint32) (uint16, error) {
+	if err := core.checkInstructionLength(addr, 2); err != nil {
+		return 0, err
+	}
+
+	if core.fetchWraps(addr, 2) {
+		low, err := core.fetch8(addr)
+		if err != nil {
+			return 0, err
+		}
+		high, err := core.fetch8(addr + 1)
+		return uint16(high)<<8 | uint16(low), err
+	}
+	addr = core.wrapCodeAddress(addr)
+
+	if err := core.checkFetch(addr, 2); err != nil {
+		return 0, err
+	}
+
+	if core.prefetch.enabled {
+		low, err := core.prefetchByte(addr)
+		if err != nil {
+			return 0, err
+		}
+		high, err := core.prefetchByte(addr + 1)
+		return uint16(high)<<8 | uint16(low), err
+	}
+
+	value, err := core.memoryAccessController.ReadAddr16(addr)
+	if err != nil {
+		return 0, core.fetchFault()
+	}
+	return value, nil
+}
+
+func (core *CpuCore) fetch32(addr uint32) (uint32, error) {
+	if err := core.checkInstructionLength(addr, 4); err != nil {
+		return 0, err
+	}
+
+	if core.fetchWraps(addr, 4) {
+		var value uint32
+		for i := uint32(0); i < 4; i++ {
+			b, err := core.fetch8(addr + i)
+			if err != nil {
+				return 0, err
+			}
+			value |= uint32(b) << (8 * i)
+		}
+		return value, nil
+	}
+	addr = core.wrapCodeAddress(addr)
+
+	if err := core.checkFetch(addr, 4); err != nil {
+		return 0, err
+	}
+
+	if core.prefetch.enabled {
+		var value uint32
+		for i := uint32(0); i < 4; i++ {
+			b, err := core.prefetchByte(addr + i)
+			if err != nil {
+				return 0, err
+			}
+			value |= uint32(b) << (8 * i)
+		}
+		return value, nil
+	}
+
+	value, err := core.memoryAccessController.ReadAddr32(addr)
+	if err != nil {
+		return 0, core.fetchFault()
+	}
+	return value, nil
+}
@@ -1,6 +1,8 @@
 package intel8086
 
-import "log"
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
 
 const (
 	CarryFlag = 0x0001
@@ -15,6 +17,8 @@ const (
 	IoPrivilegeLevelFlag = 0x3000
 	NestedTaskFlag = 0x4000
 
+	// bit 1 always reads as 1 and bits 3, 5 and 15 as 0, none of them are stored
+	reservedFlags = 0x802A
 )
 
 func (core *CpuRegisters) GetFlag(mask uint16) bool {
@@ -22,13 +26,14 @@ func (core *CpuRegisters) GetFlag(mask uint16) bool {
 }
 
 func (core *CpuRegisters) GetFlagInt(mask uint16) uint16 {
-	if mask == 0x0002 { return 1 } //Reserved, always 1 in EFLAGS
+	if mask == 0x0002 { return mask } //Reserved, always 1 in EFLAGS
 	if mask == 0x8000 { return 0 } // Reserved, always 1 on 8086 and 186, always 0 on later models
 
 	return core.FLAGS & mask
 }
 
 func (core *CpuRegisters) SetFlag(mask uint16, status bool) {
+	core.undefinedFlags &^= mask
 	if status {
 		core.FLAGS = core.FLAGS | mask
 	} else {
@@ -36,20 +41,235 @@ func (core *CpuRegisters) SetFlag(mask uint16, status bool) {
 	}
 }
 
+// The status and control flags by name, for setting up and checking instruction results
+type FlagsView struct {
+	CF, PF, AF, ZF, SF, TF, IF, DF, OF bool
+}
+
+type flagField struct {
+	mask  uint16
+	value *bool
+}
+
+// The named flags in FLAGS order, shared by Flags and SetFlags
+func (view *FlagsView) fields() []flagField {
+	return []flagField{
+		{CarryFlag, &view.CF},
+		{ParityFlag, &view.PF},
+		{AdjustFlag, &view.AF},
+		{ZeroFlag, &view.ZF},
+		{SignFlag, &view.SF},
+		{TrapFlag, &view.TF},
+		{InterruptFlag, &view.IF},
+		{DirectionFlag, &view.DF},
+		{OverFlowFlag, &view.OF},
+	}
+}
+
+func (core *CpuCore) Flags() FlagsView {
+	var view FlagsView
+	for _, field := range view.fields() {
+		*field.value = core.registers.GetFlag(field.mask)
+	}
+	return view
+}
+
+// Sets each named flag from view, IOPL and NT are left alone
+func (core *CpuCore) SetFlags(view FlagsView) {
+	for _, field := range view.fields() {
+		core.registers.SetFlag(field.mask, *field.value)
+	}
+}
+
+// PF is set when the low byte of a result has an even number of bits set, whatever the operand size
+func evenParity(value uint8) bool {
+	value ^= value >> 4
+	value ^= value >> 2
+	value ^= value >> 1
+	return value&1 == 0
+}
+
+// Sets the arithmetic flags for a - b at an operand width of 8, 16 or 32 bits, as CMP does
+func (core *CpuCore) setSubtractFlags(a uint32, b uint32, width uint) {
+	mask := uint32(uint64(1)<<width - 1)
+	sign := uint32(1) << (width - 1)
+	a, b = a&mask, b&mask
+	result := (a - b) & mask
+
+	core.registers.SetFlag(CarryFlag, a < b)
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&sign != 0)
+	core.registers.SetFlag(OverFlowFlag, (a^b)&(a^result)&sign != 0)
+	core.registers.SetFlag(AdjustFlag, (a^b^result)&0x10 != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+}
+
+// Sets the arithmetic flags for a + b at an operand width of 8, 16 or 32 bits, as ADD does
+func (core *CpuCore) setAddFlags(a uint32, b uint32, width uint) {
+	mask := uint32(uint64(1)<<width - 1)
+	sign := uint32(1) << (width - 1)
+	a, b = a&mask, b&mask
+	sum := uint64(a) + uint64(b)
+	result := uint32(sum) & mask
+
+	core.registers.SetFlag(CarryFlag, sum > uint64(mask))
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&sign != 0)
+	core.registers.SetFlag(OverFlowFlag, ^(a^b)&(a^result)&sign != 0)
+	core.registers.SetFlag(AdjustFlag, (a^b^result)&0x10 != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+}
+
+// Sets the arithmetic flags for a + b + carry, as ADC does, the carry in counts towards CF, AF and OF
+func (core *CpuCore) setAddWithCarryFlags(a uint32, b uint32, carry uint32, width uint) {
+	mask := uint32(uint64(1)<<width - 1)
+	sign := uint32(1) << (width - 1)
+	a, b = a&mask, b&mask
+	sum := uint64(a) + uint64(b) + uint64(carry)
+	result := uint32(sum) & mask
+
+	core.registers.SetFlag(CarryFlag, sum > uint64(mask))
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&sign != 0)
+	core.registers.SetFlag(OverFlowFlag, ^(a^b)&(a^result)&sign != 0)
+	core.registers.SetFlag(AdjustFlag, (a^b^result)&0x10 != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+}
+
+// Sets the arithmetic flags for a - b - borrow, as SBB does
+func (core *CpuCore) setSubtractWithBorrowFlags(a uint32, b uint32, borrow uint32, width uint) {
+	mask := uint32(uint64(1)<<width - 1)
+	sign := uint32(1) << (width - 1)
+	a, b = a&mask, b&mask
+	result := (a - b - borrow) & mask
+
+	core.registers.SetFlag(CarryFlag, uint64(a) < uint64(b)+uint64(borrow))
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&sign != 0)
+	core.registers.SetFlag(OverFlowFlag, (a^b)&(a^result)&sign != 0)
+	core.registers.SetFlag(AdjustFlag, (a^b^result)&0x10 != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+}
+
+// Sets the flags for the result of AND, OR, XOR or TEST, CF and OF are cleared and AF is undefined
+func (core *CpuCore) setLogicFlags(result uint32, width uint) {
+	mask := uint32(uint64(1)<<width - 1)
+	result &= mask
+
+	core.registers.SetFlag(CarryFlag, false)
+	core.registers.SetFlag(OverFlowFlag, false)
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&(uint32(1)<<(width-1)) != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+	core.undefineFlags(AdjustFlag)
+}
 
 func INSTR_CLI(core *CpuCore) {
 	// Clear interrupts
 
-	log.Printf("[%#04x] CLI", core.GetCurrentCodePointer())
+	core.logger.Tracef("[%#04x] CLI", core.GetCurrentlyExecutingInstructionAddress())
 	core.registers.SetFlag(InterruptFlag, false)
 	core.currentByteAddr++
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
 func INSTR_CLD(core *CpuCore) {
 	// Clear direction flag
 	core.currentByteAddr++
-	log.Printf("[%#04x] CLD", core.GetCurrentCodePointer())
+	core.logger.Tracef("[%#04x] CLD", core.GetCurrentlyExecutingInstructionAddress())
 	core.registers.SetFlag(DirectionFlag, false)
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_STD(core *CpuCore) {
+	// Set direction flag, string instructions step SI/DI downwards
+	core.currentByteAddr++
+	core.logger.Tracef("[%#04x] STD", core.GetCurrentlyExecutingInstructionAddress())
+	core.registers.SetFlag(DirectionFlag, true)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// The flags LAHF and SAHF move through AH
+const ahFlags = SignFlag | ZeroFlag | AdjustFlag | ParityFlag | CarryFlag
+
+func INSTR_LAHF(core *CpuCore) {
+	// Load AH from SF, ZF, AF, PF and CF, the reserved bit 1 reads as 1
+	core.currentByteAddr++
+	core.checkFlagsRead(ahFlags)
+
+	core.registers.SetAH(uint8(core.registers.FLAGS&ahFlags) | 0x02)
+
+	core.logger.Tracef("[%#04x] lahf", core.GetCurrentlyExecutingInstructionAddress())
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_SAHF(core *CpuCore) {
+	// Store AH into SF, ZF, AF, PF and CF
+	core.currentByteAddr++
+
+	for _, mask := range []uint16{SignFlag, ZeroFlag, AdjustFlag, ParityFlag, CarryFlag} {
+		core.registers.SetFlag(mask, uint16(core.registers.AH)&mask != 0)
+	}
+
+	core.logger.Tracef("[%#04x] sahf", core.GetCurrentlyExecutingInstructionAddress())
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_PUSHF(core *CpuCore) {
+	// Push flags, a 32 bit push zero extends FLAGS
+	core.currentByteAddr++
+
+	err := core.pushOperand(uint32(core.flagsImage()))
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] pushf", core.GetCurrentlyExecutingInstructionAddress())
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// The flags POPF and IRET can't change at the current privilege level. In protected mode IOPL can only be
+// changed at ring 0 and IF only when CPL <= IOPL.
+func (core *CpuCore) protectedFlags() uint16 {
+	var keep uint16
+	if core.mode == common.PROTECTED_MODE {
+		cpl := core.currentPrivilegeLevel()
+		if cpl != 0 {
+			keep |= IoPrivilegeLevelFlag
+		}
+		if uint16(cpl) > (core.registers.FLAGS&IoPrivilegeLevelFlag)>>12 {
+			keep |= InterruptFlag
+		}
+	}
+	return keep
+}
+
+// The FLAGS image PUSHF, interrupts and task switches save, with the reserved bit 1 set as it reads on hardware
+func (core *CpuCore) flagsImage() uint16 {
+	return core.registers.FLAGS | 0x0002
+}
+
+// Loads FLAGS from a popped image, leaving the bits in keep and the reserved bits alone
+func (core *CpuCore) loadFlags(value uint16, keep uint16) {
+	core.registers.FLAGS = (value&^keep | core.registers.FLAGS&keep) &^ reservedFlags
+	core.registers.undefinedFlags = 0
+}
+
+func INSTR_POPF(core *CpuCore) {
+	// Pop flags, only changing the bits the privilege level allows. A 32 bit pop drops the upper half of
+	// EFLAGS, as VM and RF aren't modelled. Setting TF here traps after the following instruction, not this one.
+	var value uint32
+	var err error
+
+	core.currentByteAddr++
+
+	value, err = core.popOperand()
+	if err != nil { goto eof }
+
+	core.loadFlags(uint16(value), core.protectedFlags())
+
+	core.logger.Tracef("[%#04x] popf", core.GetCurrentlyExecutingInstructionAddress())
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
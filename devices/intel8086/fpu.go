@@ -0,0 +1,373 @@
+package intel8086
+
+import (
+	"fmt"
+)
+
+/*
+	x87 state
+	Enough of a 387 for programs to save and restore it across a context switch: the control, status and tag words,
+	the eight 80 bit data registers, and the instructions which move them. FLDCW/FNSTCW, FNSTSW to memory or AX,
+	FNINIT, FNSAVE/FRSTOR, the FLD constants to put values on the stack, and WAIT. There is no arithmetic, any
+	other escape raises #UD.
+
+	The registers are held as raw 80 bit images and only copied, never converted. The stack top is kept in the
+	status word. FNSAVE writes the 94 byte image with a 16 bit operand size and the 108 byte one with 32, then
+	reinitialises the unit like FNINIT. The instruction and operand pointers aren't tracked, the image carries
+	whatever FRSTOR last loaded.
+
+	The escapes need the FloatingPoint feature. With CR0.EM or CR0.TS set they raise #NM so the operating system
+	can emulate the unit or switch its state lazily, WAIT only when TS and MP are both set.
+*/
+
+const (
+	// CR0 monitor coprocessor and emulation bits, the task switched bit is in taskswitch.go
+	ControlRegisterMonitorCoprocessor = 0x2
+	ControlRegisterEmulation          = 0x4
+
+	FpuControlWordInit = 0x037F
+	FpuTagWordEmpty    = 0xFFFF
+
+	FpuStatusInvalidOperation = 0x0001
+	FpuStatusStackFault       = 0x0040
+	FpuStatusC1               = 0x0200
+	fpuStatusTopShift         = 11
+
+	fpuTagValid   = 0x0
+	fpuTagZero    = 0x1
+	fpuTagSpecial = 0x2
+	fpuTagEmpty   = 0x3
+)
+
+// An 80 bit extended precision value, significand then sign and exponent
+type fpuRegister struct {
+	significand     uint64
+	signAndExponent uint16
+}
+
+type fpuState struct {
+	control   uint16
+	status    uint16
+	tag       uint16
+	registers [8]fpuRegister // physical registers, ST(i) is registers[(top+i)&7]
+
+	// loaded by FRSTOR and stored back by FNSAVE, nothing else updates them
+	instructionOffset   uint32
+	instructionSelector uint16
+	opcode              uint16
+	operandOffset       uint32
+	operandSelector     uint16
+}
+
+// the values FLD1, FLDL2T, FLDL2E, FLDPI, FLDLG2, FLDLN2 and FLDZ (0xD9 0xE8-0xEE) push
+var fpuConstants = []fpuRegister{
+	{0x8000000000000000, 0x3FFF},
+	{0xD49A784BCD1B8AFE, 0x4000},
+	{0xB8AA3B295C17F0BC, 0x3FFF},
+	{0xC90FDAA22168C235, 0x4000},
+	{0x9A209A84FBCFF799, 0x3FFD},
+	{0xB17217F7D1CF79AC, 0x3FFE},
+	{0x0000000000000000, 0x0000},
+}
+
+// the value loaded in place of a push onto a full stack, the default quiet NaN
+var fpuIndefinite = fpuRegister{0xC000000000000000, 0xFFFF}
+
+func (fpu *fpuState) init() {
+	fpu.control = FpuControlWordInit
+	fpu.status = 0
+	fpu.tag = FpuTagWordEmpty
+	fpu.instructionOffset = 0
+	fpu.instructionSelector = 0
+	fpu.opcode = 0
+	fpu.operandOffset = 0
+	fpu.operandSelector = 0
+}
+
+func (fpu *fpuState) top() uint8 {
+	return uint8(fpu.status>>fpuStatusTopShift) & 0x7
+}
+
+func (fpu *fpuState) setTop(top uint8) {
+	fpu.status = fpu.status&^(0x7<<fpuStatusTopShift) | uint16(top&0x7)<<fpuStatusTopShift
+}
+
+func (fpu *fpuState) tagOf(physical uint8) uint8 {
+	return uint8(fpu.tag>>(physical*2)) & 0x3
+}
+
+func (fpu *fpuState) setTagOf(physical uint8, tag uint8) {
+	fpu.tag = fpu.tag&^(0x3<<(physical*2)) | uint16(tag)<<(physical*2)
+}
+
+// The tag a register is given when a value is loaded into it
+func (value fpuRegister) classify() uint8 {
+	exponent := value.signAndExponent & 0x7FFF
+	switch {
+	case exponent == 0 && value.significand == 0:
+		return fpuTagZero
+	case exponent == 0 || exponent == 0x7FFF || value.significand>>63 == 0:
+		return fpuTagSpecial
+	}
+	return fpuTagValid
+}
+
+// Pushes a value onto the register stack. Pushing onto a full stack is a masked stack overflow while the invalid
+// operation exception is masked, the indefinite is pushed instead.
+func (fpu *fpuState) push(value fpuRegister) {
+	top := (fpu.top() - 1) & 0x7
+	if fpu.tagOf(top) != fpuTagEmpty {
+		fpu.status |= FpuStatusInvalidOperation | FpuStatusStackFault | FpuStatusC1
+		value = fpuIndefinite
+	}
+
+	fpu.setTop(top)
+	fpu.registers[top] = value
+	fpu.setTagOf(top, value.classify())
+}
+
+// Gets ST(i)
+func (fpu *fpuState) st(i uint8) fpuRegister {
+	return fpu.registers[(fpu.top()+i)&0x7]
+}
+
+// Raises #NM when the escape can't run: no coprocessor, CR0.EM set for emulation, or CR0.TS set after a task switch
+func (core *CpuCore) checkFpuAvailable() bool {
+	if !core.features.FloatingPoint || core.registers.CR0&(ControlRegisterEmulation|ControlRegisterTaskSwitched) != 0 {
+		core.raiseException(NewFault(ExceptionDeviceNotAvailable))
+		return false
+	}
+	return true
+}
+
+// Size of the FNSAVE/FRSTOR image at the current operand size
+func (core *CpuCore) fpuImageSize() uint32 {
+	if core.flags.OperandSizeOverrideEnabled {
+		return 108
+	}
+	return 94
+}
+
+// Writes the environment and the registers in stack order to addr
+func (core *CpuCore) writeFpuImage(addr uint32) error {
+	fpu := &core.fpu
+
+	var header []uint32
+	var fieldSize uint32
+	if core.flags.OperandSizeOverrideEnabled {
+		fieldSize = 4
+		header = []uint32{
+			uint32(fpu.control), uint32(fpu.status), uint32(fpu.tag),
+			fpu.instructionOffset, uint32(fpu.instructionSelector) | uint32(fpu.opcode&0x7FF)<<16,
+			fpu.operandOffset, uint32(fpu.operandSelector),
+		}
+	} else {
+		fieldSize = 2
+		header = []uint32{
+			uint32(fpu.control), uint32(fpu.status), uint32(fpu.tag),
+			fpu.instructionOffset & 0xFFFF, uint32(fpu.instructionSelector),
+			fpu.operandOffset & 0xFFFF, uint32(fpu.operandSelector),
+		}
+	}
+
+	for _, field := range header {
+		var err error
+		if fieldSize == 4 {
+			err = core.memoryAccessController.WriteAddr32(addr, field)
+		} else {
+			err = core.memoryAccessController.WriteAddr16(addr, uint16(field))
+		}
+		if err != nil {
+			return err
+		}
+		addr += fieldSize
+	}
+
+	for i := uint8(0); i < 8; i++ {
+		value := fpu.st(i)
+		err := core.memoryAccessController.WriteAddr32(addr, uint32(value.significand))
+		if err == nil {
+			err = core.memoryAccessController.WriteAddr32(addr+4, uint32(value.significand>>32))
+		}
+		if err == nil {
+			err = core.memoryAccessController.WriteAddr16(addr+8, value.signAndExponent)
+		}
+		if err != nil {
+			return err
+		}
+		addr += 10
+	}
+
+	return nil
+}
+
+// Loads the environment and the registers from an image written by FNSAVE
+func (core *CpuCore) readFpuImage(addr uint32) error {
+	var loaded fpuState
+
+	fieldSize := uint32(2)
+	if core.flags.OperandSizeOverrideEnabled {
+		fieldSize = 4
+	}
+
+	var header [7]uint32
+	for i := range header {
+		var err error
+		if fieldSize == 4 {
+			header[i], err = core.memoryAccessController.ReadAddr32(addr)
+		} else {
+			var word uint16
+			word, err = core.memoryAccessController.ReadAddr16(addr)
+			header[i] = uint32(word)
+		}
+		if err != nil {
+			return err
+		}
+		addr += fieldSize
+	}
+
+	loaded.control = uint16(header[0])
+	loaded.status = uint16(header[1])
+	loaded.tag = uint16(header[2])
+	loaded.instructionOffset = header[3]
+	loaded.instructionSelector = uint16(header[4])
+	loaded.operandOffset = header[5]
+	loaded.operandSelector = uint16(header[6])
+	if fieldSize == 4 {
+		loaded.opcode = uint16(header[4]>>16) & 0x7FF
+	}
+
+	top := loaded.top()
+	for i := uint8(0); i < 8; i++ {
+		low, err := core.memoryAccessController.ReadAddr32(addr)
+		if err != nil {
+			return err
+		}
+		high, err := core.memoryAccessController.ReadAddr32(addr + 4)
+		if err != nil {
+			return err
+		}
+		signAndExponent, err := core.memoryAccessController.ReadAddr16(addr + 8)
+		if err != nil {
+			return err
+		}
+		loaded.registers[(top+i)&0x7] = fpuRegister{uint64(high)<<32 | uint64(low), signAndExponent}
+		addr += 10
+	}
+
+	core.fpu = loaded
+	return nil
+}
+
+// ST(i) as an 80 bit image, for tests and debuggers: the significand and the sign and exponent word
+func (core *CpuCore) GetFpuStackRegister(i uint8) (uint64, uint16) {
+	value := core.fpu.st(i)
+	return value.significand, value.signAndExponent
+}
+
+func (core *CpuCore) GetFpuControlWord() uint16 {
+	return core.fpu.control
+}
+
+func (core *CpuCore) GetFpuStatusWord() uint16 {
+	return core.fpu.status
+}
+
+func (core *CpuCore) GetFpuTagWord() uint16 {
+	return core.fpu.tag
+}
+
+// WAIT/FWAIT (0x9B), there are no unmasked exceptions to wait for
+func INSTR_WAIT(core *CpuCore) {
+	core.currentByteAddr++
+
+	if core.registers.CR0&(ControlRegisterMonitorCoprocessor|ControlRegisterTaskSwitched) == ControlRegisterMonitorCoprocessor|ControlRegisterTaskSwitched {
+		core.raiseException(NewFault(ExceptionDeviceNotAvailable))
+	} else {
+		core.logger.Tracef("[%#04x] wait", core.GetCurrentlyExecutingInstructionAddress())
+	}
+
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// The x87 escapes 0xD9, 0xDB, 0xDD and 0xDF, for the forms listed at the top of this file
+func INSTR_FPU_ESCAPE(core *CpuCore) {
+	var name string
+	var addr uint32
+	var linear uint32
+
+	core.currentByteAddr++
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		if !core.checkFpuAvailable() {
+			goto eof
+		}
+
+		fpu := &core.fpu
+		opcode := core.currentOpCodeBeingExecuted
+
+		if modrm.mod == 3 {
+			switch {
+			case opcode == 0xD9 && modrm.reg == 5 && modrm.rm < 7:
+				fpu.push(fpuConstants[modrm.rm])
+				name = []string{"fld1", "fldl2t", "fldl2e", "fldpi", "fldlg2", "fldln2", "fldz"}[modrm.rm]
+			case opcode == 0xDB && modrm.reg == 4 && modrm.rm == 3:
+				fpu.init()
+				name = "fninit"
+			case opcode == 0xDF && modrm.reg == 4 && modrm.rm == 0:
+				core.registers.AX = fpu.status
+				name = "fnstsw ax"
+			default:
+				core.raiseException(NewFault(ExceptionInvalidOpcode))
+				goto eof
+			}
+		} else {
+			addr = modrm.effectiveAddress(core)
+
+			switch {
+			case opcode == 0xD9 && modrm.reg == 5:
+				var control *uint16
+				control, _, err = core.readRm16(&modrm)
+				if err != nil { goto eof }
+				fpu.control = *control
+				name = "fldcw"
+			case opcode == 0xD9 && modrm.reg == 7:
+				err = core.writeRm16(&modrm, &fpu.control)
+				if err != nil { goto eof }
+				name = "fnstcw"
+			case opcode == 0xDD && modrm.reg == 7:
+				err = core.writeRm16(&modrm, &fpu.status)
+				if err != nil { goto eof }
+				name = "fnstsw"
+			case opcode == 0xDD && modrm.reg == 6:
+				linear, err = core.translateRm(&modrm, addr, core.fpuImageSize(), accessWrite)
+				if err != nil { goto eof }
+				core.watchData(linear, core.fpuImageSize(), true)
+				err = core.writeFpuImage(linear)
+				if err != nil { goto eof }
+				fpu.init()
+				name = "fnsave"
+			case opcode == 0xDD && modrm.reg == 4:
+				linear, err = core.translateRm(&modrm, addr, core.fpuImageSize(), accessRead)
+				if err != nil { goto eof }
+				core.watchData(linear, core.fpuImageSize(), false)
+				err = core.readFpuImage(linear)
+				if err != nil { goto eof }
+				name = "frstor"
+			default:
+				core.raiseException(NewFault(ExceptionInvalidOpcode))
+				goto eof
+			}
+			name = fmt.Sprintf("%s [%#04x]", name, addr)
+		}
+	}
+
+	core.logger.Tracef("[%#04x] %s", core.GetCurrentlyExecutingInstructionAddress(), name)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,149 @@
+package intel8086
+
+/*
+	Stack frames
+	ENTER imm16, imm8 (0xC8) pushes the frame pointer, copies the enclosing frame pointers for a nesting level
+	above 0, makes the new frame and then reserves imm16 bytes for locals. LEAVE (0xC9) throws the frame away again.
+	Two sizes are chosen separately. The stack size, from the B bit of SS, picks SP and BP or ESP and EBP. The
+	operand size, 32 bits under the 0x66 prefix, picks the size of the frame pointer saved and of each display word.
+	The level is taken modulo 32.
+
+	BP and EBP are held separately, like SP and ESP, so with a 32 bit stack the low word of EBP comes from BP.
+*/
+
+// Gets BP, or EBP with a 32 bit stack
+func (core *CpuCore) framePointer() uint32 {
+	if core.stackIs32Bit() {
+		return core.registers.EBP&0xFFFF0000 | uint32(core.registers.BP)
+	}
+	return uint32(core.registers.BP)
+}
+
+func (core *CpuCore) setFramePointer(value uint32) {
+	if core.stackIs32Bit() {
+		core.registers.EBP = value
+	}
+	core.registers.SetBP(uint16(value))
+}
+
+// Loads BP from a pop at the operand size, a 32 bit pop sets all of EBP
+func (core *CpuCore) loadFramePointer(value uint32) {
+	if core.flags.OperandSizeOverrideEnabled {
+		core.registers.EBP = value
+	}
+	core.registers.SetBP(uint16(value))
+}
+
+// Reads the operand sized display word at offset in the stack segment
+func (core *CpuCore) readFrameWord(offset uint32) (uint32, error) {
+	size := uint32(2)
+	if core.flags.OperandSizeOverrideEnabled {
+		size = 4
+	}
+
+	err := core.checkSegmentLimit(&core.registers.SS, offset, size, accessStack)
+	if err != nil {
+		return 0, err
+	}
+
+	address := core.segmentBase(core.registers.SS) + offset
+	core.watchData(address, size, false)
+	if size == 4 {
+		return core.memoryAccessController.ReadAddr32(address)
+	}
+	value, err := core.memoryAccessController.ReadAddr16(address)
+	return uint32(value), err
+}
+
+func INSTR_ENTER(core *CpuCore) {
+	var size uint16
+	var level uint8
+	var err error
+
+	core.currentByteAddr++
+
+	{
+		size, err = core.readImm16()
+		if err != nil { goto eof }
+		level, err = core.readImm8()
+		if err != nil { goto eof }
+		level &= 31
+
+		wordSize := uint32(2)
+		if core.flags.OperandSizeOverrideEnabled {
+			wordSize = 4
+		}
+		stackMask := uint32(0xFFFF)
+		if core.stackIs32Bit() {
+			stackMask = 0xFFFFFFFF
+		}
+
+		// a fault part way through leaves the stack pointer as it was, BP isn't changed until the end
+		sp := core.stackPointer()
+
+		err = core.pushOperand(core.framePointer())
+		if err != nil { goto eof }
+		frame := core.stackPointer()
+
+		if level > 0 {
+			display := core.framePointer()
+			for i := uint8(1); i < level; i++ {
+				display = (display - wordSize) & stackMask
+				var value uint32
+				value, err = core.readFrameWord(display)
+				if err == nil {
+					err = core.pushOperand(value)
+				}
+				if err != nil {
+					core.setStackPointer(sp)
+					goto eof
+				}
+			}
+			err = core.pushOperand(frame)
+			if err != nil {
+				core.setStackPointer(sp)
+				goto eof
+			}
+		}
+
+		newSp := (core.stackPointer() - uint32(size)) & stackMask
+		if size != 0 {
+			// the locals must fit below the frame, as a push of their size would
+			err = core.checkSegmentLimit(&core.registers.SS, newSp, uint32(size), accessStack)
+			if err != nil {
+				core.setStackPointer(sp)
+				goto eof
+			}
+		}
+
+		core.setFramePointer(frame)
+		core.setStackPointer(newSp)
+	}
+
+	core.logger.Tracef("[%#04x] enter %#04x, %#02x", core.GetCurrentlyExecutingInstructionAddress(), size, level)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_LEAVE(core *CpuCore) {
+	var value uint32
+	var err error
+
+	core.currentByteAddr++
+
+	sp := core.stackPointer()
+	core.setStackPointer(core.framePointer())
+
+	value, err = core.popOperand()
+	if err != nil {
+		core.setStackPointer(sp)
+		goto eof
+	}
+	core.loadFramePointer(value)
+
+	core.logger.Tracef("[%#04x] leave", core.GetCurrentlyExecutingInstructionAddress())
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
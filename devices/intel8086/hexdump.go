@@ -0,0 +1,76 @@
+package intel8086
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"strings"
+)
+
+/*
+	Memory hex dumps for debugging
+	Bytes are read through the memory controller, so they see whatever address translation it applies.
+	Bytes that can't be read are shown as ??.
+*/
+
+const hexDumpBytesPerLine = 16
+
+// Dumps length bytes from a linear address as offset, hex and ascii columns
+func (core *CpuCore) HexDump(addr uint32, length int) string {
+	return core.hexDump(addr, length, func(lineOffset int) string {
+		return fmt.Sprintf("%08x", addr+uint32(lineOffset))
+	})
+}
+
+// Dumps length bytes from segment:offset. In protected mode segment is a selector and the base comes from its descriptor.
+func (core *CpuCore) HexDumpSegment(segment uint16, offset uint16, length int) (string, error) {
+	base := uint32(segment) << 4
+	if core.mode == common.PROTECTED_MODE {
+		descriptor, err := core.readSegmentDescriptor(segment)
+		if err != nil {
+			return "", err
+		}
+		base = descriptor.base
+	}
+
+	return core.hexDump(base+uint32(offset), length, func(lineOffset int) string {
+		return fmt.Sprintf("%04x:%04x", segment, offset+uint16(lineOffset))
+	}), nil
+}
+
+func (core *CpuCore) hexDump(addr uint32, length int, label func(lineOffset int) string) string {
+	sb := strings.Builder{}
+
+	for lineOffset := 0; lineOffset < length; lineOffset += hexDumpBytesPerLine {
+		hex := strings.Builder{}
+		ascii := strings.Builder{}
+
+		for i := 0; i < hexDumpBytesPerLine; i++ {
+			if i == hexDumpBytesPerLine/2 {
+				hex.WriteString(" ")
+			}
+
+			if lineOffset+i >= length {
+				hex.WriteString("   ")
+				continue
+			}
+
+			b, err := core.memoryAccessController.ReadAddr8(addr + uint32(lineOffset+i))
+			if err != nil {
+				hex.WriteString("?? ")
+				ascii.WriteString(".")
+				continue
+			}
+
+			hex.WriteString(fmt.Sprintf("%02x ", b))
+			if b >= 0x20 && b < 0x7F {
+				ascii.WriteByte(b)
+			} else {
+				ascii.WriteString(".")
+			}
+		}
+
+		sb.WriteString(fmt.Sprintf("%s  %s |%s|\n", label(lineOffset), hex.String(), ascii.String()))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package intel8086
+
+/*
+	Hint NOPs
+	0x0F 0x18-0x1F take a ModRM and do nothing. 0x0F 0x18 /0-/3 are the PREFETCH hints, there's no cache to fill so
+	they're NOPs too, and 0x0F 0x1F /0 is the multi byte NOP compilers pad with. The rest are reserved as NOPs for
+	later hints. The ModRM, SIB and displacement are consumed but no memory is read, so a memory operand can't
+	fault.
+*/
+
+var prefetchNames = []string{"prefetchnta", "prefetcht0", "prefetcht1", "prefetcht2"}
+
+func INSTR_HINT_NOP(core *CpuCore) {
+	var name = "nop"
+
+	core.currentByteAddr++
+
+	if !core.features.HintNop {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		if core.currentOpCodeBeingExecuted == 0x18 && modrm.reg < 4 {
+			name = prefetchNames[modrm.reg]
+		}
+	}
+
+	core.logger.Tracef("[%#04x] %s (%#02x)", core.GetCurrentlyExecutingInstructionAddress(), name, core.currentOpCodeBeingExecuted)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
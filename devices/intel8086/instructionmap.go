@@ -14,15 +14,40 @@ func mapOpCodes(c *CpuCore) {
 
 	c.opCodeMap[0xE3] = INSTR_JCXZ_SHORT_REL8
 
-	c.opCodeMap[0x74] = INSTR_JZ_SHORT_REL8
-	c.opCodeMap[0x75] = INSTR_JNZ_SHORT_REL8
+	for i := 0; i < 16; i++ {
+		c.opCodeMap[0x70+i] = INSTR_JCC_SHORT_REL8
+	}
 
 	c.opCodeMap[0xFA] = INSTR_CLI
+	c.opCodeMap[0xFB] = INSTR_STI
+	c.opCodeMap[0xF4] = INSTR_HLT
+	c.opCodeMap[0xCF] = INSTR_IRET
+	c.opCodeMap[0xCC] = INSTR_INT3
+	c.opCodeMap[0xCD] = INSTR_INT
+
+	c.opCodeMap[0x62] = INSTR_BOUND
+	c.opCodeMap[0xD4] = INSTR_AAM
+	c.opCodeMap[0xD5] = INSTR_AAD
+	c.opCodeMap[0xD6] = INSTR_SALC
+
+	c.opCodeMap[0x9B] = INSTR_WAIT
+	c.opCodeMap[0xD9] = INSTR_FPU_ESCAPE
+	c.opCodeMap[0xDB] = INSTR_FPU_ESCAPE
+	c.opCodeMap[0xDD] = INSTR_FPU_ESCAPE
+	c.opCodeMap[0xDF] = INSTR_FPU_ESCAPE
+	c.opCodeMap[0x63] = INSTR_ARPL
+
+	c.opCodeMap[0x9C] = INSTR_PUSHF
+	c.opCodeMap[0x9D] = INSTR_POPF
+	c.opCodeMap[0x9E] = INSTR_SAHF
+	c.opCodeMap[0x9F] = INSTR_LAHF
+
 	c.opCodeMap[0xFC] = INSTR_CLD
+	c.opCodeMap[0xFD] = INSTR_STD
 
 	c.opCodeMap[0xE4] = INSTR_IN //imm to AL
-	c.opCodeMap[0xE5] = INSTR_IN //DX to AL
-	c.opCodeMap[0xEC] = INSTR_IN //imm to AX
+	c.opCodeMap[0xE5] = INSTR_IN //imm to AX
+	c.opCodeMap[0xEC] = INSTR_IN //DX to AL
 	c.opCodeMap[0xED] = INSTR_IN //DX to AX
 
 	c.opCodeMap[0xE6] = INSTR_OUT //AL to imm
@@ -30,10 +55,15 @@ func mapOpCodes(c *CpuCore) {
 	c.opCodeMap[0xEE] = INSTR_OUT //AL to DX
 	c.opCodeMap[0xEF] = INSTR_OUT //AX to DX
 
+	c.opCodeMap[0x6C] = INSTR_INS  //DX to ES:DI byte
+	c.opCodeMap[0x6D] = INSTR_INS  //DX to ES:DI word
+	c.opCodeMap[0x6E] = INSTR_OUTS //DS:SI to DX byte
+	c.opCodeMap[0x6F] = INSTR_OUTS //DS:SI to DX word
+
 	c.opCodeMap[0xA8] = INSTR_TEST
 	c.opCodeMap[0xA9] = INSTR_TEST
-	c.opCodeMap[0xF6] = INSTR_TEST
-	c.opCodeMap[0xF7] = INSTR_TEST
+	c.opCodeMap[0xF6] = INSTR_F6_OPCODES
+	c.opCodeMap[0xF7] = INSTR_F6_OPCODES
 	c.opCodeMap[0x84] = INSTR_TEST
 	c.opCodeMap[0x85] = INSTR_TEST
 
@@ -49,6 +79,8 @@ func mapOpCodes(c *CpuCore) {
 		c.opCodeMap[0xB8+i] = INSTR_MOV
 	}
 
+	c.opCodeMap[0x88] = INSTR_MOV
+	c.opCodeMap[0x89] = INSTR_MOV
 	c.opCodeMap[0x8A] = INSTR_MOV
 	c.opCodeMap[0x8B] = INSTR_MOV
 	c.opCodeMap[0x8C] = INSTR_MOV
@@ -63,8 +95,8 @@ func mapOpCodes(c *CpuCore) {
 	//c.opCodeMap[0x83] = INSTR_CMP // handled by 83 opcode switch
 	c.opCodeMap[0x38] = INSTR_CMP
 	c.opCodeMap[0x39] = INSTR_CMP
-	c.opCodeMap[0xA6] = INSTR_CMP
-	c.opCodeMap[0xA7] = INSTR_CMP
+	c.opCodeMap[0xA6] = INSTR_CMPS
+	c.opCodeMap[0xA7] = INSTR_CMPS
 
 	c.opCodeMap[0x86] = INSTR_XCHG
 	c.opCodeMap[0x87] = INSTR_XCHG
@@ -74,7 +106,14 @@ func mapOpCodes(c *CpuCore) {
 
 	//c.opCodeMap[0x90] = INSTR_NOP // we don't define an NOP because NOP = xchg ax, ax
 
+	c.opCodeMap[0xC2] = INSTR_RET_NEAR
 	c.opCodeMap[0xC3] = INSTR_RET_NEAR
+	c.opCodeMap[0xC8] = INSTR_ENTER
+	c.opCodeMap[0xC9] = INSTR_LEAVE
+	c.opCodeMap[0xE8] = INSTR_CALL
+	c.opCodeMap[0x9A] = INSTR_CALL
+	c.opCodeMap[0xCA] = INSTR_RETF
+	c.opCodeMap[0xCB] = INSTR_RETF
 
 	c.opCodeMap[0x28] = INSTR_SUB
 	c.opCodeMap[0x29] = INSTR_SUB
@@ -86,6 +125,10 @@ func mapOpCodes(c *CpuCore) {
 	c.opCodeMap[0x81] = INSTR_SUB
 	c.opCodeMap[0x83] = INSTR_SUB
 
+	for i := 0; i < 6; i++ {
+		c.opCodeMap[0x18+i] = INSTR_SBB
+	}
+
 	c.opCodeMap[0x04] = INSTR_ADD
 	c.opCodeMap[0x05] = INSTR_ADD
 	c.opCodeMap[0x00] = INSTR_ADD
@@ -121,7 +164,13 @@ func mapOpCodes(c *CpuCore) {
 	c.opCodeMap[0x34] = INSTR_XOR
 	c.opCodeMap[0x35] = INSTR_XOR
 
+	for i := 0; i < len(c.registers.registers16Bit); i++ {
+		c.opCodeMap[0x40+i] = INSTR_INC
+		c.opCodeMap[0x48+i] = INSTR_DEC
+	}
+
 	// opcodes that handle multiple instructions (handled by modrm byte)
+	c.opCodeMap[0xFE] = INSTR_FE_OPCODES
 	c.opCodeMap[0xFF] = INSTR_FF_OPCODES
 	c.opCodeMap[0x80] = INSTR_80_OPCODES
 	c.opCodeMap[0x81] = INSTR_81_OPCODES
@@ -149,13 +198,67 @@ func mapOpCodes(c *CpuCore) {
 	c.opCodeMap[0x1E] = INSTR_PUSH
 	c.opCodeMap[0x06] = INSTR_PUSH
 
+	for i := 0; i < len(c.registers.registers16Bit); i++ {
+		c.opCodeMap[0x58+i] = INSTR_POP
+	}
+	c.opCodeMap[0x8F] = INSTR_POP
+	c.opCodeMap[0x07] = INSTR_POP
+	c.opCodeMap[0x17] = INSTR_POP
+	c.opCodeMap[0x1F] = INSTR_POP
+
 
 	c.opCodeMap[0xAC] = INSTR_LODS
 	c.opCodeMap[0xAD] = INSTR_LODS
+	c.opCodeMap[0xA4] = INSTR_MOVS
+	c.opCodeMap[0xA5] = INSTR_MOVS
+	c.opCodeMap[0xAA] = INSTR_STOS
+	c.opCodeMap[0xAB] = INSTR_STOS
+	c.opCodeMap[0xAE] = INSTR_SCAS
+	c.opCodeMap[0xAF] = INSTR_SCAS
 
 	// 2 byte opcodes
-	c.opCodeMap2Byte[0x01] = INSTR_SMSW
-	c.opCodeMap2Byte[0x20] = INSTR_MOV
+	c.opCodeMap2Byte[0x00] = INSTR_0F00_OPCODES
+	c.opCodeMap2Byte[0x01] = INSTR_0F01_OPCODES
+	c.opCodeMap2Byte[0x02] = INSTR_LAR
+	c.opCodeMap2Byte[0x03] = INSTR_LSL
+	c.opCodeMap2Byte[0x20] = INSTR_MOV_CONTROL_REGISTER
+	c.opCodeMap2Byte[0x21] = INSTR_MOV_DEBUG_REGISTER
+	c.opCodeMap2Byte[0x22] = INSTR_MOV_CONTROL_REGISTER
+	c.opCodeMap2Byte[0x23] = INSTR_MOV_DEBUG_REGISTER
+	c.opCodeMap2Byte[0x08] = INSTR_INVD_WBINVD
+	c.opCodeMap2Byte[0x09] = INSTR_INVD_WBINVD
+
+	for i := 0; i < 8; i++ {
+		c.opCodeMap2Byte[0x18+i] = INSTR_HINT_NOP // 0x0F 0x18-0x1F
+	}
+	c.opCodeMap2Byte[0x30] = INSTR_WRMSR
+	c.opCodeMap2Byte[0x31] = INSTR_RDTSC
+	c.opCodeMap2Byte[0x32] = INSTR_RDMSR
+	c.opCodeMap2Byte[0xB0] = INSTR_CMPXCHG
+	c.opCodeMap2Byte[0xB1] = INSTR_CMPXCHG
+	c.opCodeMap2Byte[0xC0] = INSTR_XADD
+	c.opCodeMap2Byte[0xC1] = INSTR_XADD
+	c.opCodeMap2Byte[0xC7] = INSTR_CMPXCHG8B
+	c.opCodeMap2Byte[0xA3] = INSTR_BIT_TEST
+	c.opCodeMap2Byte[0xAB] = INSTR_BIT_TEST
+	c.opCodeMap2Byte[0xB3] = INSTR_BIT_TEST
+	c.opCodeMap2Byte[0xBB] = INSTR_BIT_TEST
+	c.opCodeMap2Byte[0xBA] = INSTR_BIT_TEST_IMM
+	c.opCodeMap2Byte[0xA4] = INSTR_SHIFT_DOUBLE
+	c.opCodeMap2Byte[0xA5] = INSTR_SHIFT_DOUBLE
+	c.opCodeMap2Byte[0xAC] = INSTR_SHIFT_DOUBLE
+	c.opCodeMap2Byte[0xAD] = INSTR_SHIFT_DOUBLE
+	for i := 0; i < 16; i++ {
+		c.opCodeMap2Byte[0x40+i] = INSTR_CMOVCC
+	}
+	for i := 0; i < 8; i++ {
+		c.opCodeMap2Byte[0xC8+i] = INSTR_BSWAP
+	}
+
+	c.opCodeMap2Byte[0xA0] = INSTR_PUSH
+	c.opCodeMap2Byte[0xA8] = INSTR_PUSH
+	c.opCodeMap2Byte[0xA1] = INSTR_POP
+	c.opCodeMap2Byte[0xA9] = INSTR_POP
 }
 
 
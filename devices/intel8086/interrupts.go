@@ -0,0 +1,314 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Hardware interrupt recognition and dispatch
+	Real mode vectors through the IVT at linear address 0, protected mode through the IDT
+
+	A protected mode gate to a more privileged non-conforming code segment switches to that ring's stack from the
+	TSS. The interrupted SS and SP are pushed on the new stack ahead of FLAGS, CS and IP, and an exception's error
+	code goes last. IRET back to the outer ring pops them again.
+
+	A 32 bit gate pushes the frame as dwords, SS:ESP, EFLAGS, CS, EIP and the error code, and needs a 32 bit IRET
+	to unwind it.
+*/
+
+const (
+	GateTypeInterrupt16 = 0x6
+	GateTypeTrap16      = 0x7
+	GateTypeInterrupt32 = 0xE
+	GateTypeTrap32      = 0xF
+)
+
+// Called before each instruction fetch, dispatches an interrupt from the PIC if one is pending and IF is set
+func (core *CpuCore) handlePendingInterrupt() {
+	if core.interruptController == nil || !core.registers.GetFlag(InterruptFlag) {
+		return
+	}
+
+	if !core.interruptController.HasPendingInterrupt() {
+		return
+	}
+
+	vector := core.interruptController.AcknowledgeInterrupt()
+	core.logger.Tracef("[%#04x] hardware interrupt (vector: %#02x)", core.GetCurrentCodePointer(), vector)
+
+	core.halted = false
+
+	err := core.interrupt(vector)
+	if err == nil {
+		return
+	}
+
+	if !core.raiseProtectionFault(err) {
+		core.logger.Errorf("Failed to dispatch interrupt %#02x: %s", vector, err.Error())
+		core.pendingException = nil
+		return
+	}
+
+	// the fault is taken before the next instruction, with the EXT bit set as an external event caused it
+	if core.pendingException.HasErrorCode {
+		core.pendingException.ErrorCode |= common.GP_ERROR_CODE_EXTERNAL
+	}
+	core.deliverPendingException(core.registers.CS, core.instructionPointer())
+}
+
+func (core *CpuCore) IsHalted() bool {
+	return core.halted
+}
+
+// #GP for a bad IDT entry, the error code has the IDT bit set
+func idtFault(vector uint8) common.GeneralProtectionFault {
+	return common.GeneralProtectionFault{ErrorCode: uint16(vector)<<3 | common.GP_ERROR_CODE_IDT}
+}
+
+// Pushes FLAGS, CS and IP and transfers control to the handler for the vector
+func (core *CpuCore) interrupt(vector uint8) error {
+	return core.interruptWithErrorCode(vector, false, 0)
+}
+
+// Interrupts through the vector and pushes the error code last, at the width of the gate
+func (core *CpuCore) interruptWithErrorCode(vector uint8, hasErrorCode bool, errorCode uint32) error {
+	var handlerSegment uint16
+	var handlerOffset uint32
+	clearInterruptFlag := true
+	switchStack := false
+	wide := false
+	var targetPrivilegeLevel uint8
+
+	if core.mode == common.PROTECTED_MODE {
+		offset := uint32(vector) * 8
+		if offset+7 > uint32(core.registers.IDTR.limit) {
+			return idtFault(vector)
+		}
+
+		gateAddr := core.registers.IDTR.base + offset
+		offsetLow, err := core.memoryAccessController.ReadAddr16(gateAddr)
+		if err != nil { return err }
+		selector, err := core.memoryAccessController.ReadAddr16(gateAddr + 2)
+		if err != nil { return err }
+		access, err := core.memoryAccessController.ReadAddr8(gateAddr + 5)
+		if err != nil { return err }
+
+		if access&DescriptorAccessPresent == 0 {
+			return common.SegmentNotPresentFault{ErrorCode: idtFault(vector).ErrorCode}
+		}
+
+		switch access & 0x0F {
+		case GateTypeInterrupt16, GateTypeInterrupt32:
+			clearInterruptFlag = true
+		case GateTypeTrap16, GateTypeTrap32:
+			clearInterruptFlag = false
+		default:
+			return idtFault(vector)
+		}
+		wide = access&0x0F == GateTypeInterrupt32 || access&0x0F == GateTypeTrap32
+
+		if selector&0xFFFC == 0 {
+			return common.GeneralProtectionFault{}
+		}
+
+		target, err := core.readSegmentDescriptor(selector)
+		if err != nil { return err }
+
+		if !target.isCodeOrData() || !target.isExecutable() || target.dpl() > core.currentPrivilegeLevel() {
+			return selectorFault(selector)
+		}
+
+		handlerSegment = selector
+		if !target.isConforming() && target.dpl() < core.currentPrivilegeLevel() {
+			// the handler runs at the segment's privilege level, on that level's stack
+			switchStack = true
+			targetPrivilegeLevel = target.dpl()
+			handlerSegment = selector&0xFFFC | uint16(targetPrivilegeLevel)
+		}
+		handlerOffset = uint32(offsetLow)
+		if wide {
+			// offset bits 31..16 are in the last two bytes of a 32 bit gate
+			offsetHigh, err := core.memoryAccessController.ReadAddr16(gateAddr + 6)
+			if err != nil { return err }
+			handlerOffset |= uint32(offsetHigh) << 16
+		}
+	} else {
+		offset, err := core.memoryAccessController.ReadAddr16(uint32(vector) * 4)
+		if err != nil { return err }
+		handlerOffset = uint32(offset)
+		handlerSegment, err = core.memoryAccessController.ReadAddr16(uint32(vector)*4 + 2)
+		if err != nil { return err }
+	}
+
+	savedSS := core.registers.SS
+	savedSP := core.registers.SP
+	savedESP := core.registers.ESP
+	outerSP := core.stackPointer()
+	returnIP := core.instructionPointer()
+
+	restoreStack := func() {
+		core.registers.SS = savedSS
+		core.registers.SetSP(savedSP)
+		core.registers.ESP = savedESP
+	}
+
+	push := func(value uint32) error {
+		if wide {
+			return core.pushDword(value)
+		}
+		return core.pushWord(uint16(value))
+	}
+
+	var err error
+	if switchStack {
+		err = core.switchToInnerStack(targetPrivilegeLevel)
+		if err != nil {
+			restoreStack()
+			return err
+		}
+
+		err = push(uint32(savedSS.base))
+		if err == nil {
+			err = push(outerSP)
+		}
+	}
+
+	if err == nil {
+		err = push(uint32(core.flagsImage()))
+	}
+	if err == nil {
+		err = push(uint32(core.registers.CS.base))
+	}
+	if err == nil {
+		err = push(returnIP)
+	}
+	if err == nil && hasErrorCode {
+		err = push(errorCode)
+	}
+	if err != nil {
+		restoreStack()
+		return err
+	}
+
+	savedCS := core.registers.CS
+	err = core.loadCodeSegment(handlerSegment)
+	if err == nil {
+		err = core.checkFarOffset(handlerOffset)
+	}
+	if err != nil {
+		core.registers.CS = savedCS
+		restoreStack()
+		return err
+	}
+
+	core.setEIP(handlerOffset)
+	core.registers.SetFlag(TrapFlag, false)
+	if clearInterruptFlag {
+		core.registers.SetFlag(InterruptFlag, false)
+	}
+
+	return nil
+}
+
+func INSTR_STI(core *CpuCore) {
+	// Set interrupts, recognised after the following instruction
+	core.currentByteAddr++
+	core.logger.Tracef("[%#04x] STI", core.GetCurrentlyExecutingInstructionAddress())
+	if !core.registers.GetFlag(InterruptFlag) {
+		core.interruptInhibit = true
+	}
+	core.registers.SetFlag(InterruptFlag, true)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_HLT(core *CpuCore) {
+	// Halt until the next interrupt
+	core.currentByteAddr++
+	core.logger.Tracef("[%#04x] HLT", core.GetCurrentlyExecutingInstructionAddress())
+	core.halted = true
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_IRET(core *CpuCore) {
+	var ip, flags, sp uint32
+	var cs, ss uint16
+	var keepFlags uint16
+	var savedSP uint16
+	var savedESP uint32
+	var savedCS, savedSS SegmentRegister
+	var err error
+
+	core.currentByteAddr++
+
+	if core.mode == common.PROTECTED_MODE && core.registers.GetFlag(NestedTaskFlag) {
+		// return from a nested task to the task in the back link
+		var link uint16
+		link, err = core.memoryAccessController.ReadAddr16(core.registers.TR.descriptorBase)
+		if err == nil {
+			err = core.taskSwitch(link, taskSwitchIret, core.registers.IP+uint16(core.currentByteAddr-core.currentByteDecodeStart))
+		}
+		if err != nil {
+			if !core.raiseProtectionFault(err) {
+				core.logger.Errorf("[%#04x] iret to task failed: %s", core.GetCurrentlyExecutingInstructionAddress(), err.Error())
+			}
+			core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+			return
+		}
+		core.logger.Tracef("[%#04x] iret (task %#04x)", core.GetCurrentlyExecutingInstructionAddress(), link)
+		return
+	}
+
+	savedSP = core.registers.SP
+	savedESP = core.registers.ESP
+	savedCS = core.registers.CS
+	savedSS = core.registers.SS
+
+	// a 32 bit iret pops the dword frame a 32 bit gate pushed
+	ip, err = core.popOperand()
+	if err != nil { goto fault }
+	cs, err = core.popOperandWord()
+	if err != nil { goto fault }
+	flags, err = core.popOperand()
+	if err != nil { goto fault }
+
+	// the privilege checks on the popped flags are made at the level being returned from
+	keepFlags = core.protectedFlags()
+
+	if core.mode == common.PROTECTED_MODE && uint8(cs&0x3) > core.currentPrivilegeLevel() {
+		// return to the outer privilege level, its stack was pushed when the interrupt switched stacks
+		sp, err = core.popOperand()
+		if err != nil { goto fault }
+		ss, err = core.popOperandWord()
+		if err != nil { goto fault }
+
+		err = core.loadCodeSegment(cs)
+		if err != nil { goto fault }
+		err = core.loadSegmentRegister(&core.registers.SS, ss)
+		if err != nil { goto fault }
+
+		if core.flags.OperandSizeOverrideEnabled {
+			core.setStackPointer(sp)
+		} else {
+			core.registers.SetSP(uint16(sp))
+		}
+	} else {
+		err = core.loadCodeSegment(cs)
+		if err != nil { goto fault }
+	}
+
+	core.loadFlags(uint16(flags), keepFlags)
+	core.setEIP(ip)
+
+	core.logger.Tracef("[%#04x] iret (%#04x:%#04x)", core.GetCurrentlyExecutingInstructionAddress(), cs, ip)
+	return
+
+	fault:
+	core.registers.CS = savedCS
+	core.registers.SS = savedSS
+	core.registers.SetSP(savedSP)
+	core.registers.ESP = savedESP
+	if !core.raiseProtectionFault(err) {
+		core.logger.Errorf("[%#04x] iret failed: %s", core.GetCurrentlyExecutingInstructionAddress(), err.Error())
+	}
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,177 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Segment limit checks
+	In protected mode data accesses are checked against the limit cached when the segment register was loaded.
+	Expand down data segments, used for stacks that can be grown downwards, are valid above the limit rather
+	than below it.
+
+	Real mode accesses are checked against the cached limit too, but not the type. A selector load in real mode
+	only changes the base, and switching modes doesn't touch the caches, so a segment given a 4GB limit in
+	protected mode keeps it after the switch back to real mode: unreal mode. With the usual 64k limit this only
+	matters to 32 bit offsets, 16 bit ones can't exceed it.
+
+	Each check says what kind of access it is making, which decides the segment types allowed: fetches need a
+	code segment, reads a data segment or readable code segment, and writes and stack operations a writable
+	data segment. A stack operation, or any other access through SS, that fails raises #SS, a failed access
+	through any other segment #GP(0).
+*/
+
+const DescriptorAccessExpandDown = 0x04 // data segments only, the same bit is conforming for code segments
+
+// The kind of memory access a segment check is made for
+type memoryAccess uint8
+
+const (
+	accessFetch memoryAccess = iota
+	accessRead
+	accessWrite
+	accessStack // push and pop through SS:SP
+)
+
+// Whether the segment's type allows the access
+func (segment *SegmentRegister) permits(access memoryAccess) bool {
+	info := uint8(segment.access_information)
+	executable := info&DescriptorAccessExecutable != 0
+	readWrite := info&DescriptorAccessReadWrite != 0
+
+	switch access {
+	case accessFetch:
+		return executable
+	case accessRead:
+		return !executable || readWrite
+	default:
+		return !executable && readWrite
+	}
+}
+
+func (segment *SegmentRegister) isExpandDown() bool {
+	access := uint8(segment.access_information)
+	return access&DescriptorAccessExecutable == 0 && access&DescriptorAccessExpandDown != 0
+}
+
+// The highest offset of an expand down segment, 0xFFFF unless the B bit is set
+func (segment *SegmentRegister) expandDownUpperBound() uint32 {
+	if segment.access_information&(DescriptorFlagSize<<8) != 0 {
+		return 0xFFFFFFFF
+	}
+	return 0xFFFF
+}
+
+// Checks that size bytes at offset are inside the segment and that it allows the access, raising #SS or #GP(0)
+// if not
+func (core *CpuCore) checkSegmentLimit(segment *SegmentRegister, offset uint32, size uint32, access memoryAccess) error {
+	protectedMode := core.mode == common.PROTECTED_MODE
+
+	if protectedMode && (segment.access_information&DescriptorAccessPresent == 0 || !segment.permits(access)) {
+		// loaded with the null selector, or the wrong type of segment
+		return core.segmentLimitFault(segment, access)
+	}
+
+	last := offset + size - 1
+	if last < offset {
+		// wraps past the end of the address space
+		return core.segmentLimitFault(segment, access)
+	}
+
+	if segment.isExpandDown() {
+		if offset <= segment.limit || last > segment.expandDownUpperBound() {
+			return core.segmentLimitFault(segment, access)
+		}
+		return nil
+	}
+
+	if last > segment.limit {
+		return core.segmentLimitFault(segment, access)
+	}
+
+	return nil
+}
+
+func (core *CpuCore) segmentLimitFault(segment *SegmentRegister, access memoryAccess) error {
+	e := NewFaultWithErrorCode(ExceptionGeneralProtection, 0)
+	if access == accessStack || segment == &core.registers.SS {
+		e = NewFaultWithErrorCode(ExceptionStackFault, 0)
+	}
+	core.raiseException(e)
+	return e
+}
+
+// Applies a segment override prefix to the default segment of an access
+func (core *CpuCore) overrideSegment(segment *SegmentRegister) *SegmentRegister {
+	if core.flags.MemorySegmentOverride == 0 {
+		return segment
+	}
+
+	switch core.flags.MemorySegmentOverride {
+	case common.SEGMENT_CS:
+		return &core.registers.CS
+	case common.SEGMENT_SS:
+		return &core.registers.SS
+	case common.SEGMENT_DS:
+		return &core.registers.DS
+	case common.SEGMENT_ES:
+		return &core.registers.ES
+	case common.SEGMENT_FS:
+		return &core.registers.FS
+	case common.SEGMENT_GS:
+		return &core.registers.GS
+	default:
+		panic("Unhandled segment register override")
+	}
+}
+
+// Segment of a memory operand, BP based addressing (EBP or ESP with 32 bit addresses) defaults to SS and
+// everything else to DS
+func (core *CpuCore) modRmSegment(modrm *ModRm) *SegmentRegister {
+	segment := &core.registers.DS
+	if modrm.address32 {
+		if (modrm.rm == 5 && modrm.mod != 0) || (modrm.rm == 4 && (modrm.base == 4 || (modrm.base == 5 && modrm.mod != 0))) {
+			segment = &core.registers.SS
+		}
+	} else if modrm.rm == 2 || modrm.rm == 3 || (modrm.rm == 6 && modrm.mod != 0) {
+		segment = &core.registers.SS
+	}
+	return core.overrideSegment(segment)
+}
+
+// Checks an r/m memory operand of size bytes at the effective address against its segment limit
+func (core *CpuCore) checkRmLimit(modrm *ModRm, offset uint32, size uint32, access memoryAccess) error {
+	return core.checkSegmentLimit(core.modRmSegment(modrm), offset, size, access)
+}
+
+// Checks size bytes at offset in segment against its limit and returns the linear address they are accessed at
+func (core *CpuCore) translateOffset(segment *SegmentRegister, offset uint32, size uint32, access memoryAccess) (uint32, error) {
+	if err := core.checkSegmentLimit(segment, offset, size, access); err != nil {
+		return 0, err
+	}
+	return core.segmentBase(*segment) + offset, nil
+}
+
+// Translates an r/m memory operand of size bytes at the effective address offset, in the segment the modrm selects
+func (core *CpuCore) translateRm(modrm *ModRm, offset uint32, size uint32, access memoryAccess) (uint32, error) {
+	return core.translateOffset(core.modRmSegment(modrm), offset, size, access)
+}
+
+// Refreshes the cached base of each segment register from its real mode selector, the limit and attributes are
+// kept so they survive a trip through protected mode
+func (core *CpuCore) refreshRealModeSegmentBases() {
+	for _, segment := range core.registers.registersSegmentRegisters {
+		segment.descriptorBase = uint32(segment.base) << 4
+	}
+}
+
+// The descriptor caches describe the real mode segments after reset, a present 64k read/write segment at
+// selector<<4
+func (core *CpuCore) keepRealModeSegmentCaches() {
+	for _, segment := range core.registers.registersSegmentRegisters {
+		segment.descriptorBase = uint32(segment.base) << 4
+		segment.limit = 0xFFFF
+		segment.access_information = DescriptorAccessPresent | DescriptorAccessCodeOrData | DescriptorAccessReadWrite
+	}
+	core.registers.CS.access_information |= DescriptorAccessExecutable
+}
@@ -0,0 +1,82 @@
+package intel8086
+
+/*
+	LOCK prefix validation
+	The bus is never shared in this emulator so LOCK has no effect of its own, but the 386 raises #UD when the
+	prefix is put in front of anything other than a read-modify-write instruction with a memory destination.
+*/
+
+// One byte opcodes taking LOCK, mapped to the modrm reg fields allowed (nil for any)
+var lockableOpCodes = map[uint8][]uint8{
+	0x00: nil, 0x01: nil, // add r/m, r
+	0x08: nil, 0x09: nil, // or r/m, r
+	0x10: nil, 0x11: nil, // adc r/m, r
+	0x18: nil, 0x19: nil, // sbb r/m, r
+	0x20: nil, 0x21: nil, // and r/m, r
+	0x28: nil, 0x29: nil, // sub r/m, r
+	0x30: nil, 0x31: nil, // xor r/m, r
+	0x80: {0, 1, 2, 3, 4, 5, 6}, 0x81: {0, 1, 2, 3, 4, 5, 6}, 0x83: {0, 1, 2, 3, 4, 5, 6}, // group 1 except cmp
+	0x86: nil, 0x87: nil, // xchg
+	0xF6: {2, 3}, 0xF7: {2, 3}, // not, neg
+	0xFE: {0, 1}, 0xFF: {0, 1}, // inc, dec
+}
+
+// Two byte (0x0F) opcodes taking LOCK
+var lockableOpCodes2Byte = map[uint8][]uint8{
+	0xAB: nil,       // bts
+	0xB3: nil,       // btr
+	0xBB: nil,       // btc
+	0xBA: {5, 6, 7}, // bts/btr/btc r/m, imm8
+	0xB0: nil, 0xB1: nil, // cmpxchg
+	0xC0: nil, 0xC1: nil, // xadd
+	0xC7: {1}, // cmpxchg8b
+}
+
+// Checks the instruction at currentByteAddr may carry a LOCK prefix, the opcode byte has already been read
+func (core *CpuCore) lockPrefixValid(opcode uint8, twoByte bool) (bool, error) {
+	table := lockableOpCodes
+	if twoByte {
+		table = lockableOpCodes2Byte
+	}
+
+	if _, ok := table[opcode]; !ok {
+		return false, nil
+	}
+
+	modrmByte, err := core.fetch8(core.currentByteAddr + 1)
+	if err != nil {
+		return false, err
+	}
+
+	return lockAllowed(opcode, twoByte, modrmByte), nil
+}
+
+// Whether the opcode and modrm byte make an instruction which may carry a LOCK prefix
+func lockAllowed(opcode uint8, twoByte bool, modrmByte uint8) bool {
+	table := lockableOpCodes
+	if twoByte {
+		table = lockableOpCodes2Byte
+	}
+
+	allowedReg, ok := table[opcode]
+	if !ok {
+		return false
+	}
+
+	if modrmByte>>6 == 3 {
+		// register destination
+		return false
+	}
+
+	if allowedReg == nil {
+		return true
+	}
+
+	reg := (modrmByte >> 3) & 0x7
+	for _, allowed := range allowedReg {
+		if reg == allowed {
+			return true
+		}
+	}
+	return false
+}
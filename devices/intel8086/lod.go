@@ -2,64 +2,364 @@ package intel8086
 
 import (
 	"fmt"
-	"log"
 )
 
+// Amount string instructions step SI/DI by for an operand of size bytes, negative when DF is set
+func (core *CpuCore) stringIndexDelta(size int) int16 {
+	if core.registers.GetFlag(DirectionFlag) {
+		return int16(-size)
+	}
+	return int16(size)
+}
+
+// The source index of a string instruction, SI or ESI with a 32 bit address size. ESI is held separately from SI
+// so its low word comes from SI.
+func (core *CpuCore) sourceIndex() uint32 {
+	if core.flags.AddressSizeOverrideEnabled {
+		return core.registers.ESI&0xFFFF0000 | uint32(core.registers.SI)
+	}
+	return uint32(core.registers.SI)
+}
+
+// Steps SI, or ESI with a 32 bit address size, past an operand of size bytes
+func (core *CpuCore) advanceSourceIndex(size int) {
+	if core.flags.AddressSizeOverrideEnabled {
+		index := core.sourceIndex() + uint32(int32(core.stringIndexDelta(size)))
+		core.registers.ESI = index
+		core.registers.SI = uint16(index)
+		return
+	}
+	core.registers.SI += uint16(core.stringIndexDelta(size))
+}
+
+// The destination index of a string instruction, DI or EDI with a 32 bit address size, EDI is held like ESI
+func (core *CpuCore) destinationIndex() uint32 {
+	if core.flags.AddressSizeOverrideEnabled {
+		return core.registers.EDI&0xFFFF0000 | uint32(core.registers.DI)
+	}
+	return uint32(core.registers.DI)
+}
+
+// Steps DI, or EDI with a 32 bit address size, past an operand of size bytes
+func (core *CpuCore) advanceDestinationIndex(size int) {
+	if core.flags.AddressSizeOverrideEnabled {
+		index := core.destinationIndex() + uint32(int32(core.stringIndexDelta(size)))
+		core.registers.EDI = index
+		core.registers.DI = uint16(index)
+		return
+	}
+	core.registers.DI += uint16(core.stringIndexDelta(size))
+}
+
+// The repeat count of a string instruction, CX or ECX with a 32 bit address size, ECX is held like ESI
+func (core *CpuCore) stringCount() uint32 {
+	if core.flags.AddressSizeOverrideEnabled {
+		return core.registers.ECX&0xFFFF0000 | uint32(core.registers.CX)
+	}
+	return uint32(core.registers.CX)
+}
+
+func (core *CpuCore) decrementStringCount() {
+	if core.flags.AddressSizeOverrideEnabled {
+		count := core.stringCount() - 1
+		core.registers.ECX = count
+		core.registers.CX = uint16(count)
+		return
+	}
+	core.registers.CX--
+}
+
+// Runs a string instruction's iteration once, or stringCount times with a REP prefix. The count is tested before
+// every iteration so REP with a count of 0 does nothing at all. An iteration which fails stops the repeat with the
+// count and indices still describing it, so the faulting instruction restarts where it left off.
+func (core *CpuCore) repeatString(iteration func() error) error {
+	if !core.flags.RepPrefixEnabled {
+		return iteration()
+	}
+
+	for core.stringCount() > 0 {
+		if err := iteration(); err != nil {
+			return err
+		}
+		core.decrementStringCount()
+	}
+	return nil
+}
+
+// Runs a comparing string instruction's iteration like repeatString, except that REPE stops after an iteration
+// which clears ZF and REPNE after one which sets it
+func (core *CpuCore) repeatCompareString(iteration func() error) error {
+	if !core.flags.RepPrefixEnabled {
+		return iteration()
+	}
+
+	for core.stringCount() > 0 {
+		if err := iteration(); err != nil {
+			return err
+		}
+		core.decrementStringCount()
+		if core.registers.GetFlag(ZeroFlag) == core.flags.RepNotEqualPrefixEnabled {
+			break
+		}
+	}
+	return nil
+}
+
+// Reads the byte or word operand of a string instruction at offset in segment
+func (core *CpuCore) readStringOperand(segment *SegmentRegister, offset uint32, size uint32) (uint32, error) {
+	if err := core.checkSegmentLimit(segment, offset, size, accessRead); err != nil {
+		return 0, err
+	}
+
+	addr := core.segmentBase(*segment) + offset
+	core.watchData(addr, size, false)
+	if size == 1 {
+		value, err := core.memoryAccessController.ReadAddr8(addr)
+		return uint32(value), err
+	}
+	value, err := core.memoryAccessController.ReadAddr16(addr)
+	return uint32(value), err
+}
+
 func INSTR_LODS(core *CpuCore) {
 	core.currentByteAddr++
 
 	var prefixStr = ""
-	var operStr = ""
+	var operStr = "LODSB"
 	var extras = ""
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0xAD {
+		operStr = "LODSW"
+		size = 2
+	}
+
 	if core.flags.RepPrefixEnabled {
 		prefixStr = "REP"
 	}
 
-	if core.registers.CX > 0 && core.flags.RepPrefixEnabled {
-		extras = fmt.Sprintf("(%d repetitions)", core.registers.CX)
+	if core.stringCount() > 0 && core.flags.RepPrefixEnabled {
+		extras = fmt.Sprintf("(%d repetitions)", core.stringCount())
 	}
 
-	for (core.registers.CX > 0 && core.flags.RepPrefixEnabled) || !core.flags.RepPrefixEnabled {
+	source := core.overrideSegment(&core.registers.DS)
+
+	err := core.repeatString(func() error {
+		if err := core.checkSegmentLimit(source, core.sourceIndex(), size, accessRead); err != nil {
+			return err
+		}
 
-		switch core.currentOpCodeBeingExecuted {
-		case 0xAC:
-			{
-				operStr = "LODSB"
-				m8, err := core.memoryAccessController.ReadAddr8(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.SI))
-				if err != nil { goto eof }
-				core.registers.AL = m8
-				if core.registers.GetFlag(DirectionFlag) {
-					core.registers.SI -= 1
-				} else {
-					core.registers.SI += 1
-				}
+		addr := core.segmentBase(*source) + core.sourceIndex()
+		if size == 1 {
+			m8, err := core.memoryAccessController.ReadAddr8(addr)
+			if err != nil {
+				return err
 			}
-		case 0xAD:
-			{
-				operStr = "LODSW"
-				//log.Printf("Reading from %#04x", core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.SI))
-				m8, err := core.memoryAccessController.ReadAddr16(core.SegmentAddressToLinearAddress(core.registers.DS, core.registers.SI))
-				if err != nil { goto eof }
-				core.registers.AX = m8
-				if core.registers.GetFlag(DirectionFlag) {
-					core.registers.SI -= 2
-				} else {
-					core.registers.SI += 2
-				}
+			core.registers.AL = m8
+		} else {
+			m16, err := core.memoryAccessController.ReadAddr16(addr)
+			if err != nil {
+				return err
 			}
+			core.registers.AX = m16
 		}
 
-		if !core.flags.RepPrefixEnabled {
-			break
+		core.advanceSourceIndex(int(size))
+		return nil
+	})
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr, extras)
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_MOVS(core *CpuCore) {
+	// MOVSB/MOVSW (0xA4/0xA5), DS:SI to ES:DI. The source segment can be overridden, the destination is always ES.
+	core.currentByteAddr++
+
+	var operStr = "MOVSB"
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0xA5 {
+		operStr = "MOVSW"
+		size = 2
+	}
+
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REP"
+	}
+
+	source := core.overrideSegment(&core.registers.DS)
+
+	err := core.repeatString(func() error {
+		if err := core.checkSegmentLimit(source, core.sourceIndex(), size, accessRead); err != nil {
+			return err
+		}
+		if err := core.checkSegmentLimit(&core.registers.ES, core.destinationIndex(), size, accessWrite); err != nil {
+			return err
+		}
+
+		src := core.segmentBase(*source) + core.sourceIndex()
+		dest := core.segmentBase(core.registers.ES) + core.destinationIndex()
+		core.watchData(src, size, false)
+		core.watchData(dest, size, true)
+
+		if size == 1 {
+			value, err := core.memoryAccessController.ReadAddr8(src)
+			if err != nil {
+				return err
+			}
+			if err = core.memoryAccessController.WriteAddr8(dest, value); err != nil {
+				return err
+			}
 		} else {
-			core.registers.CX--
+			value, err := core.memoryAccessController.ReadAddr16(src)
+			if err != nil {
+				return err
+			}
+			if err = core.memoryAccessController.WriteAddr16(dest, value); err != nil {
+				return err
+			}
 		}
+
+		core.advanceSourceIndex(int(size))
+		core.advanceDestinationIndex(int(size))
+		return nil
+	})
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_STOS(core *CpuCore) {
+	// STOSB/STOSW (0xAA/0xAB), AL or AX to ES:DI. The destination is always ES, segment overrides don't apply.
+	core.currentByteAddr++
+
+	var operStr = "STOSB"
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0xAB {
+		operStr = "STOSW"
+		size = 2
 	}
 
-	log.Print(fmt.Sprintf("[%#04x] %s %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr, extras))
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REP"
+	}
+
+	err := core.repeatString(func() error {
+		if err := core.checkSegmentLimit(&core.registers.ES, core.destinationIndex(), size, accessWrite); err != nil {
+			return err
+		}
+
+		dest := core.segmentBase(core.registers.ES) + core.destinationIndex()
+		core.watchData(dest, size, true)
+
+		var err error
+		if size == 1 {
+			err = core.memoryAccessController.WriteAddr8(dest, core.registers.AL)
+		} else {
+			err = core.memoryAccessController.WriteAddr16(dest, core.registers.AX)
+		}
+		if err != nil {
+			return err
+		}
+
+		core.advanceDestinationIndex(int(size))
+		return nil
+	})
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr)
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
 
+func INSTR_CMPS(core *CpuCore) {
+	// CMPSB/CMPSW (0xA6/0xA7), DS:SI with ES:DI. The source segment can be overridden, the destination is always ES.
+	core.currentByteAddr++
 
+	var operStr = "CMPSB"
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0xA7 {
+		operStr = "CMPSW"
+		size = 2
+	}
+
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REPE"
+		if core.flags.RepNotEqualPrefixEnabled {
+			prefixStr = "REPNE"
+		}
+	}
+
+	source := core.overrideSegment(&core.registers.DS)
+
+	err := core.repeatCompareString(func() error {
+		src, err := core.readStringOperand(source, core.sourceIndex(), size)
+		if err != nil {
+			return err
+		}
+		dest, err := core.readStringOperand(&core.registers.ES, core.destinationIndex(), size)
+		if err != nil {
+			return err
+		}
+
+		core.setSubtractFlags(src, dest, uint(size*8))
+
+		core.advanceSourceIndex(int(size))
+		core.advanceDestinationIndex(int(size))
+		return nil
+	})
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_SCAS(core *CpuCore) {
+	// SCASB/SCASW (0xAE/0xAF), AL or AX with ES:DI. The destination is always ES, segment overrides don't apply.
+	core.currentByteAddr++
+
+	var operStr = "SCASB"
+	size := uint32(1)
+	accumulator := uint32(core.registers.AL)
+	if core.currentOpCodeBeingExecuted == 0xAF {
+		operStr = "SCASW"
+		size = 2
+		accumulator = uint32(core.registers.AX)
+	}
+
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REPE"
+		if core.flags.RepNotEqualPrefixEnabled {
+			prefixStr = "REPNE"
+		}
+	}
+
+	err := core.repeatCompareString(func() error {
+		dest, err := core.readStringOperand(&core.registers.ES, core.destinationIndex(), size)
+		if err != nil {
+			return err
+		}
+
+		core.setSubtractFlags(accumulator, dest, uint(size*8))
+
+		core.advanceDestinationIndex(int(size))
+		return nil
+	})
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] %s %s", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
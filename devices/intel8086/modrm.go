@@ -15,9 +15,13 @@ type ModRm struct {
 	disp16 uint16
 	disp32 uint32
 
+	address32 bool // decoded with 32 bit addressing, a sib byte and disp32 in place of disp16
 }
 
 
+// Decodes the modrm byte at currentByteAddr along with the sib and displacement bytes that follow it. The address
+// size of the instruction picks the 16 or 32 bit forms. Returns the number of bytes consumed, which the caller
+// adds to currentByteAddr.
 func (core *CpuCore) consumeModRm() (ModRm, uint32, error) {
 
 	var bytesConsumed uint32
@@ -25,7 +29,7 @@ func (core *CpuCore) consumeModRm() (ModRm, uint32, error) {
 	var modrmByte uint8
 	m := ModRm{}
 
-	modrmByte, err = core.memoryAccessController.ReadAddr8(uint32(core.currentByteAddr))
+	modrmByte, err = core.fetch8(uint32(core.currentByteAddr))
 	if err != nil { goto eof }
 
 	bytesConsumed++
@@ -33,36 +37,43 @@ func (core *CpuCore) consumeModRm() (ModRm, uint32, error) {
 	m.mod = (modrmByte >> 6) & 0x03
 	m.reg = (modrmByte >> 3) & 0x07
 	m.rm = modrmByte & 0x07
+	m.address32 = core.flags.AddressSizeOverrideEnabled
 
-	if core.registers.CR0 >> 0 & 1 == 0 {
-		// real mode
+	if m.mod == 3 {
+		// register operand, nothing follows
+		goto eof
+	}
+
+	if !m.address32 {
 		if m.mod == 1 {
-			var u8, err = core.memoryAccessController.ReadAddr8(uint32(core.currentByteAddr+bytesConsumed))
+			var u8, err = core.fetch8(uint32(core.currentByteAddr+bytesConsumed))
 			if err != nil { goto eof }
 			m.disp8 = u8
 			bytesConsumed++
 		} else if (m.mod == 0 && m.rm == 6) || m.mod == 2 {
-			var u16, err = core.memoryAccessController.ReadAddr16(core.currentByteAddr+bytesConsumed)
+			var u16, err = core.fetch16(core.currentByteAddr+bytesConsumed)
 			if err != nil { goto eof }
 			m.disp16 = u16
 			bytesConsumed += 2
 		}
 	} else {
-		// protected mode
-		if m.mod != 3 && m.rm == 4 {
-			var u8, err = core.memoryAccessController.ReadAddr8(core.currentByteAddr+bytesConsumed)
+		if m.rm == 4 {
+			var u8, err = core.fetch8(core.currentByteAddr+bytesConsumed)
 			if err != nil { goto eof }
 			m.sib = u8
+			m.base = u8 & 0x7
+			m.index = (u8 >> 3) & 0x7
+			m.scale = (u8 >> 6) & 0x3
 			bytesConsumed++
 		}
 
-		if (m.mod == 0 && m.rm == 5) || m.mod == 2 {
-			var u32, err = core.memoryAccessController.ReadAddr32(core.currentByteAddr+bytesConsumed)
+		if (m.mod == 0 && m.rm == 5) || (m.mod == 0 && m.rm == 4 && m.base == 5) || m.mod == 2 {
+			var u32, err = core.fetch32(core.currentByteAddr+bytesConsumed)
 			if err != nil { goto eof }
 			m.disp32 = u32
 			bytesConsumed += 4
 		} else if m.mod == 1 {
-			var u8, err = core.memoryAccessController.ReadAddr8(core.currentByteAddr+bytesConsumed)
+			var u8, err = core.fetch8(core.currentByteAddr+bytesConsumed)
 			if err != nil { goto eof }
 			m.disp8 = u8
 			bytesConsumed++
@@ -74,10 +85,62 @@ func (core *CpuCore) consumeModRm() (ModRm, uint32, error) {
 	return m, bytesConsumed, err
 }
 
+// The effective address of an instruction's memory operand, recorded for tracing when the address is computed
+type EffectiveAddress struct {
+	Valid   bool   // false when the instruction had no memory operand
+	Segment string // segment register the operand is addressed through
+	Offset  uint32
+}
+
+// Gets the effective address of the last memory operand used by the instruction which just executed
+func (core *CpuCore) GetLastEffectiveAddress() EffectiveAddress {
+	return core.lastEffectiveAddress
+}
+
+func (core *CpuCore) recordEffectiveAddress(m *ModRm, offset uint32) {
+	segment := core.modRmSegment(m)
+
+	name := ""
+	for i, register := range core.registers.registersSegmentRegisters {
+		if register == segment {
+			name = core.registers.indexSegmentToString(uint8(i))
+		}
+	}
+
+	core.lastEffectiveAddress = EffectiveAddress{Valid: true, Segment: name, Offset: offset}
+}
+
 // derived from:
 // https://www.intel.com.au/content/www/au/en/architecture-and-technology/64-ia-32-architectures-software-developer-instruction-set-reference-manual-325383.html
 // table 2.1
+// The offset of the memory operand at the address size it was decoded with, the sum of the base, index and
+// displacement wraps at 64k with 16 bit addressing and at 4GB with 32 bit addressing
+func (m *ModRm) effectiveAddress(core *CpuCore) uint32 {
+	if m.address32 {
+		return m.getAddressMode32(core)
+	}
+	return uint32(m.getAddressMode16(core))
+}
+
+// Wraps an offset worked out from the effective address, such as a later word of the operand, at the address size
+func (m *ModRm) wrapOffset(offset uint32) uint32 {
+	if m.address32 {
+		return offset
+	}
+	return offset & 0xFFFF
+}
+
 func (m *ModRm) getAddressMode16(core *CpuCore) uint16 {
+	if m.address32 {
+		// the operand is still addressed through a 16 bit offset
+		return uint16(m.getAddressMode32(core))
+	}
+	offset := m.addressMode16(core)
+	core.recordEffectiveAddress(m, uint32(offset))
+	return offset
+}
+
+func (m *ModRm) addressMode16(core *CpuCore) uint16 {
 	if m.mod == 0 {
 		switch m.rm {
 		case 0:
@@ -99,22 +162,36 @@ func (m *ModRm) getAddressMode16(core *CpuCore) uint16 {
 		}
 	} else if m.mod == 1 {
 		if m.rm == 6 {
-			return uint16(int32(core.registers.BP) + int32(m.disp8))
+			return uint16(int32(core.registers.BP) + int32(int8(m.disp8)))
 		}
-		m.mod = 0
-		return uint16(int32(m.getAddressMode16(core)) + int32(m.disp8))
+		// the same base registers without the displacement, m itself is left alone so it can be reused
+		base := *m
+		base.mod = 0
+		return uint16(int32(base.addressMode16(core)) + int32(int8(m.disp8)))
 	} else if m.mod == 2 {
 		if m.rm == 6 {
 			return uint16(int32(core.registers.BP) + int32(m.disp16))
 		}
-		m.mod = 0
-		return uint16(int32(m.getAddressMode16(core)) + int32(m.disp16))
+		base := *m
+		base.mod = 0
+		return uint16(int32(base.addressMode16(core)) + int32(m.disp16))
 	}
 	return uint16(0)
 }
 
 
 func (m *ModRm) getAddressMode32(core *CpuCore) uint32 {
+	offset := m.addressMode32(core)
+	core.recordEffectiveAddress(m, offset)
+	return offset
+}
+
+// Gets a base or index register of a 32 bit address, the low word comes from the 16 bit register like sourceIndex
+func (core *CpuCore) addressRegister32(index uint8) uint32 {
+	return *core.registers.registers32Bit[index]&0xFFFF0000 | uint32(*core.registers.registers16Bit[index])
+}
+
+func (m *ModRm) addressMode32(core *CpuCore) uint32 {
 	if m.mod == 0 {
 		if m.rm == 5 {
 			return m.disp32 // Is this a EBP?
@@ -123,29 +200,23 @@ func (m *ModRm) getAddressMode32(core *CpuCore) uint32 {
 			return m.regFromSib(core)
 		}
 
-		return *core.registers.registers32Bit[m.rm]
+		return core.addressRegister32(m.rm)
 	} else if m.mod == 1 {
 		var result uint32
 		if m.rm == 4 {
 			result = m.regFromSib(core)
 		} else {
-			result = *core.registers.registers32Bit[m.rm]
+			result = core.addressRegister32(m.rm)
 		}
 
-		disp8 := m.disp8
-		if disp8 < 0 {
-			result -= uint32(-disp8)
-		} else {
-			result += uint32(disp8)
-		}
-
-		return result
+		// disp8 is sign extended
+		return result + uint32(int32(int8(m.disp8)))
 	} else if m.mod == 2 {
 		var result uint32
 		if m.rm == 4 {
 			result = m.regFromSib(core)
 		} else {
-			result = *core.registers.registers32Bit[m.rm]
+			result = core.addressRegister32(m.rm)
 		}
 		result += m.disp32
 		return result
@@ -156,25 +227,19 @@ func (m *ModRm) getAddressMode32(core *CpuCore) uint32 {
 
 func (m *ModRm) regFromSib(core *CpuCore) uint32 {
 
-	// decode sip byte
-	m.sib, _ = core.memoryAccessController.ReadAddr8(core.currentByteAddr)
-	if m.mod < 3 && m.rm == 4 {
-		m.base = uint8(m.sib & 0x7)
-		m.index = uint8((m.sib >> 3) & 0x7)
-		m.scale = uint8((m.sib >> 6) & 0x3)
-	}
+	// base, index and scale were taken from the sib byte by consumeModRm
 
 	// calc base value
 	var result uint32
 	if m.base == 5 && m.mod == 0 {
 		result = m.disp32
 	} else {
-		result = *core.registers.registers32Bit[m.base]
+		result = core.addressRegister32(m.base)
 	}
 
 	// index
 	if m.index != 4 {
-		result += (*core.registers.registers32Bit[m.index]) * uint32(1<<m.scale)
+		result += core.addressRegister32(m.index) * uint32(1<<m.scale)
 	}
 
 	return result
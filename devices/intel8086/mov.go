@@ -1,149 +1,123 @@
 package intel8086
 
-import (
-	"fmt"
-	"log"
-)
-
 func INSTR_MOV(core *CpuCore) {
 	core.currentByteAddr++
 
 	switch core.currentOpCodeBeingExecuted {
-	case 0xA0:
-		{
-			// mov al, moffs8*
-			offset, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr)
-			if err != nil { goto eof }
-			core.currentByteAddr++
-
-			segOff := uint16(offset)
-
-			byteValue, err := core.memoryAccessController.ReadAddr8(uint32(segOff))
-			if err != nil { goto eof }
-
-			log.Print(fmt.Sprintf("[%#04x] MOV al, byte ptr cs:%#02x", core.GetCurrentlyExecutingInstructionAddress(), segOff))
-
-			core.registers.AL = byteValue
-		}
-	case 0xA1:
-		{
-			// mov ax, moffs16*
-			offset, err := core.memoryAccessController.ReadAddr16(core.currentByteAddr)
-			if err != nil { goto eof }
-			core.currentByteAddr += 2
-
-			byteValue, err := core.memoryAccessController.ReadAddr16(uint32(offset))
-			if err != nil { goto eof }
-			log.Print(fmt.Sprintf("[%#04x] MOV ax, byte ptr cs:%#02x", core.GetCurrentlyExecutingInstructionAddress(), offset))
-
-			core.registers.AX = byteValue
-		}
-	case 0xA2:
-		{
-			// mov moffs8*, al
-			offset, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr)
-			if err != nil { goto eof }
-
-			core.currentByteAddr++
-
-			segOff := uint16(offset)
-
-			err = core.memoryAccessController.WriteAddr8(uint32(segOff), core.registers.AL)
-			if err != nil { goto eof }
-
-			log.Print(fmt.Sprintf("[%#04x] MOV byte ptr cs:%#02x, al", core.GetCurrentlyExecutingInstructionAddress(), segOff))
-		}
-	case 0xA3:
+	case 0xA0, 0xA1, 0xA2, 0xA3:
 		{
-			// mov moffs16*, ax
-			offset, err := core.memoryAccessController.ReadAddr16(core.currentByteAddr)
-			if err != nil { goto eof }
-			core.currentByteAddr += 2
-
-			segOff := uint16(offset)
-
-			err = core.memoryAccessController.WriteAddr16(uint32(segOff), core.registers.AX)
-			if err != nil { goto eof }
-
-			log.Print(fmt.Sprintf("[%#04x] MOV byte ptr cs:%#02x, ax", core.GetCurrentlyExecutingInstructionAddress(), segOff))
+			// mov al/ax/eax, moffs and mov moffs, al/ax/eax, the offset is 32 bits with a 32 bit address size
+			var offset uint32
+			var err error
+			if core.flags.AddressSizeOverrideEnabled {
+				offset, err = core.fetch32(core.currentByteAddr)
+				if err != nil { goto eof }
+				core.currentByteAddr += 4
+			} else {
+				var offset16 uint16
+				offset16, err = core.fetch16(core.currentByteAddr)
+				if err != nil { goto eof }
+				core.currentByteAddr += 2
+				offset = uint32(offset16)
+			}
 
+			core.moveMemoryOffset(offset)
 		}
 	case 0xB0, 0xB1, 0xB2, 0xB3, 0xB4, 0xB5, 0xB6, 0xB7:
 		{
 			// mov r8, imm8
 			r8, r8Str := core.registers.registers8Bit[core.currentOpCodeBeingExecuted-0xB0], core.registers.index8ToString(core.currentOpCodeBeingExecuted-0xB0)
-			val, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr)
+			val, err := core.fetch8(core.currentByteAddr)
 			if err != nil { goto eof }
 			core.currentByteAddr++
-			log.Print(fmt.Sprintf("[%#04x] MOV %s, %#02x", core.GetCurrentlyExecutingInstructionAddress(), r8Str, val))
+			core.logger.Tracef("[%#04x] MOV %s, %#02x", core.GetCurrentlyExecutingInstructionAddress(), r8Str, val)
 			*r8 = val
 		}
 	case 0xB8, 0xB9, 0xBA, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF:
 		{
-			// mov r16, imm16
+			// mov r16, imm16 and mov r32, imm32
+			if core.flags.OperandSizeOverrideEnabled {
+				index := core.currentOpCodeBeingExecuted - 0xB8
+				val, err := core.fetch32(core.currentByteAddr)
+				if err != nil { goto eof }
+				core.currentByteAddr += 4
+				core.logger.Tracef("[%#04x] MOV %s, %#08x", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index32ToString(index), val)
+				core.registers.setRegister32(index, val)
+				goto eof
+			}
 			r16, r16Str := core.registers.registers16Bit[core.currentOpCodeBeingExecuted-0xB8], core.registers.index16ToString(core.currentOpCodeBeingExecuted-0xB8)
-			val, err := core.memoryAccessController.ReadAddr16(core.currentByteAddr)
+			val, err := core.fetch16(core.currentByteAddr)
 			if err != nil { goto eof }
 			core.currentByteAddr += 2
-			log.Print(fmt.Sprintf("[%#04x] MOV %s, %#02x", core.GetCurrentlyExecutingInstructionAddress(), r16Str, val))
+			core.logger.Tracef("[%#04x] MOV %s, %#02x", core.GetCurrentlyExecutingInstructionAddress(), r16Str, val)
 			*r16 = val
 		}
-	case 0x8A:
+	case 0x88:
 		{
-			/* 	MOV r8,r/m8 */
+			/* MOV r/m8,r8 */
 			modrm, bytesConsumed, err := core.consumeModRm()
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
-			var src *uint8
-			var srcName string
-			dest := core.registers.registers8Bit[modrm.reg]
+			src, srcName := core.readR8(&modrm)
+			err = core.writeRm8(&modrm, src)
+			if err != nil { goto eof }
 
-			dstName := core.registers.index8ToString(modrm.reg)
+			core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), "r/m8", srcName)
+		}
+	case 0x89:
+		{
+			/* MOV r/m16,r16 and MOV r/m32,r32 */
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
 
-			if modrm.mod == 3 {
-				src = core.registers.registers8Bit[modrm.rm]
-				srcName = core.registers.index8ToString(modrm.rm)
-				*dest = *src
+			if core.flags.OperandSizeOverrideEnabled {
+				src, srcName := core.readR32(&modrm)
+				err = core.writeRm32(&modrm, src)
+				if err != nil { goto eof }
+				core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), "r/m32", srcName)
 			} else {
-				addressMode := modrm.getAddressMode16(core)
-				var data, err = core.memoryAccessController.ReadAddr8(uint32(addressMode))
+				src, srcName := core.readR16(&modrm)
+				err = core.writeRm16(&modrm, src)
 				if err != nil { goto eof }
-				src = &data
-				srcName = "r/m8"
-				*dest = *src
+				core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), "r/m16", srcName)
 			}
+		}
+	case 0x8A:
+		{
+			/* 	MOV r8,r/m8 */
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
 
-			log.Print(fmt.Sprintf("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName))
+			src, srcName, err := core.readRm8(&modrm)
+			if err != nil { goto eof }
+			dstName := core.registers.index8ToString(modrm.reg)
+			core.writeR8(&modrm, src)
 
+			core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName)
 		}
 	case 0x8B:
 		{
-			/* mov r16, r/m16 */
+			/* mov r16, r/m16 and mov r32, r/m32 */
 			modrm, bytesConsumed, err := core.consumeModRm()
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
-			// dest
-			dest := core.registers.registers16Bit[modrm.reg]
-			dstName := core.registers.index16ToString(modrm.reg)
-			var src *uint16
-			var srcName string
-			if modrm.mod == 3 {
-				src = core.registers.registers16Bit[modrm.rm]
-				srcName = core.registers.index16ToString(modrm.rm)
-				*dest = *src
+			if core.flags.OperandSizeOverrideEnabled {
+				src, srcName, err := core.readRm32(&modrm)
+				if err != nil { goto eof }
+				dstName := core.registers.index32ToString(modrm.reg)
+				core.writeR32(&modrm, src)
+				core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName)
 			} else {
-				addressMode := modrm.getAddressMode16(core)
-				var data, err = core.memoryAccessController.ReadAddr16(uint32(addressMode))
+				src, srcName, err := core.readRm16(&modrm)
 				if err != nil { goto eof }
-				src = &data
-				*dest = *src
-				srcName = "rm/16"
+				dstName := core.registers.index16ToString(modrm.reg)
+				core.writeR16(&modrm, src)
+				core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName)
 			}
-
-			log.Print(fmt.Sprintf("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName))
-
 		}
 	case 0x8C:
 		{
@@ -152,6 +126,12 @@ func INSTR_MOV(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
+			if int(modrm.reg) >= len(core.registers.registersSegmentRegisters) {
+				// there are only six segment registers
+				core.raiseException(NewFault(ExceptionInvalidOpcode))
+				goto eof
+			}
+
 			src := core.registers.registersSegmentRegisters[modrm.reg]
 			srcName := core.registers.indexSegmentToString(modrm.reg)
 
@@ -162,14 +142,13 @@ func INSTR_MOV(core *CpuCore) {
 				destName = core.registers.index16ToString(modrm.rm)
 				*dest = (*src).base
 			} else {
-				addressMode := modrm.getAddressMode16(core)
-				err = core.memoryAccessController.WriteAddr16(uint32(addressMode), (*src).base)
+				value := (*src).base
+				err = core.writeRm16(&modrm, &value)
 				if err != nil { goto eof }
 				srcName = "rm/16"
 			}
 
-			log.Print(fmt.Sprintf("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), destName, srcName))
-
+			core.logger.Tracef("[%#04x] MOV %s, %s", core.GetCurrentlyExecutingInstructionAddress(), destName, srcName)
 		}
 	case 0x8E:
 		{
@@ -178,6 +157,12 @@ func INSTR_MOV(core *CpuCore) {
 			if err != nil { goto eof }
 			core.currentByteAddr += bytesConsumed
 
+			if int(modrm.reg) >= len(core.registers.registersSegmentRegisters) || modrm.reg == 1 {
+				// there are only six segment registers, and CS is only loaded by a far transfer
+				core.raiseException(NewFault(ExceptionInvalidOpcode))
+				goto eof
+			}
+
 			dest := core.registers.registersSegmentRegisters[modrm.reg]
 			dstName := core.registers.indexSegmentToString(modrm.reg)
 
@@ -186,58 +171,131 @@ func INSTR_MOV(core *CpuCore) {
 			if modrm.mod == 3 {
 				src = core.registers.registers16Bit[modrm.rm]
 				srcName = core.registers.index16ToString(modrm.rm)
-				(*dest).base = *src
 			} else {
-				addressMode := modrm.getAddressMode16(core)
-				var data, err = core.memoryAccessController.ReadAddr16(uint32(addressMode))
+				src, srcName, err = core.readRm16(&modrm)
 				if err != nil { goto eof }
-				src = &data
-				(*dest).base = *src
-				srcName = "rm/16"
 			}
 
-			log.Print(fmt.Sprintf("[%#04x] MOV %s,%s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName))
+			err = core.loadSegmentRegister(dest, *src)
+			if err != nil {
+				core.raiseProtectionFault(err)
+				goto eof
+			}
 
+			core.logger.Tracef("[%#04x] MOV %s,%s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName)
 		}
-	case 0x20:
-		{
-			/* MOV r32, cr0 */
-			modrm, bytesConsumed, err := core.consumeModRm()
-			if err != nil { goto eof }
-			core.currentByteAddr += bytesConsumed
-
-			dst := core.registers.registers32Bit[modrm.rm]
-			dstName := core.registers.index32ToString(modrm.rm)
+	default:
+		core.logger.Fatalf("Unrecognised MOV instruction!")
+	}
 
-			var srcName string
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
 
-			switch {
-			case  modrm.reg == 4:
-				*dst = core.registers.CR0
-				srcName = "CR0"
-			case  modrm.reg == 5:
-				*dst = core.registers.CR2
-				srcName = "CR2"
-			case  modrm.reg == 6:
-				*dst = core.registers.CR3
-				srcName = "CR3"
-			case  modrm.reg == 7:
-				*dst = core.registers.CR4
-				srcName = "CR4"
-			default:
-				log.Fatal("Unknown cr mov instruction")
-			}
 
+// Moves between the accumulator and the memory offset of 0xA0-0xA3, in DS unless a prefix overrides it. Bit 0 of
+// the opcode picks a word operand and bit 1 a store to memory.
+func (core *CpuCore) moveMemoryOffset(offset uint32) error {
+	size := uint32(1)
+	accumulator := "al"
+	if core.currentOpCodeBeingExecuted&0x01 != 0 {
+		size, accumulator = 2, "ax"
+		if core.flags.OperandSizeOverrideEnabled {
+			size, accumulator = 4, "eax"
+		}
+	}
 
-			log.Print(fmt.Sprintf("[%#04x] MOV %s,%s", core.GetCurrentlyExecutingInstructionAddress(), dstName, srcName))
+	store := core.currentOpCodeBeingExecuted&0x02 != 0
+	access := accessRead
+	if store {
+		access = accessWrite
+	}
 
+	segment := core.overrideSegment(&core.registers.DS)
+	address, err := core.translateOffset(segment, offset, size, access)
+	if err != nil {
+		return err
+	}
+	core.watchData(address, size, store)
+
+	switch {
+	case store && size == 1:
+		err = core.memoryAccessController.WriteAddr8(address, core.registers.AL)
+	case store && size == 2:
+		err = core.memoryAccessController.WriteAddr16(address, core.registers.AX)
+	case store:
+		err = core.memoryAccessController.WriteAddr32(address, core.registers.EAX)
+	case size == 1:
+		var value uint8
+		value, err = core.memoryAccessController.ReadAddr8(address)
+		if err == nil {
+			core.registers.SetAL(value)
+		}
+	case size == 2:
+		var value uint16
+		value, err = core.memoryAccessController.ReadAddr16(address)
+		if err == nil {
+			core.registers.AX = value
 		}
 	default:
-		log.Fatal("Unrecognised MOV instruction!")
+		var value uint32
+		value, err = core.memoryAccessController.ReadAddr32(address)
+		if err == nil {
+			core.registers.setRegister32(0, value)
+		}
+	}
+	if err != nil {
+		return err
 	}
 
-	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	if store {
+		core.logger.Tracef("[%#04x] MOV [%#04x], %s", core.GetCurrentlyExecutingInstructionAddress(), offset, accumulator)
+	} else {
+		core.logger.Tracef("[%#04x] MOV %s, [%#04x]", core.GetCurrentlyExecutingInstructionAddress(), accumulator, offset)
+	}
+	return nil
 }
 
 
+func INSTR_CMOVCC(core *CpuCore) {
+	// cmovcc r16, r/m16 and cmovcc r32, r/m32 (0x0F 0x40-0x4F), a P6 instruction enabled by the ConditionalMove feature.
+	// The source is read whether or not the condition holds, so a bad memory operand faults either way.
+	var modrm ModRm
+	var bytesConsumed uint32
+	var err error
+	var taken bool
+
+	cc := core.currentOpCodeBeingExecuted & 0xF
+
+	core.currentByteAddr++
+
+	if !core.features.ConditionalMove {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	modrm, bytesConsumed, err = core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	taken = EvaluateCondition(core, cc)
+
+	if core.flags.OperandSizeOverrideEnabled {
+		src, srcName, err := core.readRm32(&modrm)
+		if err != nil { goto eof }
+		if taken {
+			core.writeR32(&modrm, src)
+		}
+		core.logger.Tracef("[%#04x] CMOV%s %s, %s", core.GetCurrentlyExecutingInstructionAddress(), conditionMnemonic(cc), core.registers.index32ToString(modrm.reg), srcName)
+	} else {
+		src, srcName, err := core.readRm16(&modrm)
+		if err != nil { goto eof }
+		if taken {
+			core.writeR16(&modrm, src)
+		}
+		core.logger.Tracef("[%#04x] CMOV%s %s, %s", core.GetCurrentlyExecutingInstructionAddress(), conditionMnemonic(cc), core.registers.index16ToString(modrm.reg), srcName)
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
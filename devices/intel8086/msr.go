@@ -0,0 +1,139 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Model specific registers and cache control
+	There are no caches to flush so INVD/WBINVD only check privilege. The supported MSRs are the Pentium's machine
+	check and performance monitoring registers, which are plain storage, and the time stamp counter which reads
+	and writes the cycle count.
+*/
+
+const (
+	MsrMachineCheckAddress   = 0x00
+	MsrMachineCheckType      = 0x01
+	MsrTimeStampCounter      = 0x10
+	MsrControlAndEventSelect = 0x11
+	MsrCounter0              = 0x12
+	MsrCounter1              = 0x13
+)
+
+func (core *CpuCore) resetModelSpecificRegisters() {
+	core.modelSpecificRegisters = map[uint32]uint64{
+		MsrMachineCheckAddress:   0,
+		MsrMachineCheckType:      0,
+		MsrControlAndEventSelect: 0,
+		MsrCounter0:              0,
+		MsrCounter1:              0,
+	}
+}
+
+func (core *CpuCore) readModelSpecificRegister(msr uint32) (uint64, bool) {
+	if msr == MsrTimeStampCounter {
+		return core.cycles, true
+	}
+	value, ok := core.modelSpecificRegisters[msr]
+	return value, ok
+}
+
+func (core *CpuCore) writeModelSpecificRegister(msr uint32, value uint64) bool {
+	if msr == MsrTimeStampCounter {
+		core.cycles = value
+		return true
+	}
+	if _, ok := core.modelSpecificRegisters[msr]; !ok {
+		return false
+	}
+	core.modelSpecificRegisters[msr] = value
+	return true
+}
+
+// Privileged instructions raise #GP(0) outside ring 0 in protected mode
+func (core *CpuCore) checkRing0() bool {
+	if core.mode == common.PROTECTED_MODE && core.currentPrivilegeLevel() != 0 {
+		core.raiseException(NewFaultWithErrorCode(ExceptionGeneralProtection, 0))
+		return false
+	}
+	return true
+}
+
+func INSTR_RDMSR(core *CpuCore) {
+	var value uint64
+	var ok bool
+
+	core.currentByteAddr++
+
+	if !core.features.ModelSpecificRegisters {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	value, ok = core.readModelSpecificRegister(core.registers.ECX)
+	if !ok {
+		core.raiseException(NewFaultWithErrorCode(ExceptionGeneralProtection, 0))
+		goto eof
+	}
+
+	core.registers.EDX = uint32(value >> 32)
+	core.registers.EAX = uint32(value)
+
+	core.logger.Tracef("[%#04x] rdmsr (%#08x = %#016x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.ECX, value)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_WRMSR(core *CpuCore) {
+	var value uint64
+
+	core.currentByteAddr++
+
+	if !core.features.ModelSpecificRegisters {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	value = uint64(core.registers.EDX)<<32 | uint64(core.registers.EAX)
+	if !core.writeModelSpecificRegister(core.registers.ECX, value) {
+		core.raiseException(NewFaultWithErrorCode(ExceptionGeneralProtection, 0))
+		goto eof
+	}
+
+	core.logger.Tracef("[%#04x] wrmsr (%#08x = %#016x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.ECX, value)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+// INVD (0x0F 0x08) and WBINVD (0x0F 0x09)
+func INSTR_INVD_WBINVD(core *CpuCore) {
+	core.currentByteAddr++
+
+	if !core.features.CacheControl {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	if !core.checkRing0() {
+		goto eof
+	}
+
+	if core.currentOpCodeBeingExecuted == 0x08 {
+		core.logger.Tracef("[%#04x] invd", core.GetCurrentlyExecutingInstructionAddress())
+	} else {
+		core.logger.Tracef("[%#04x] wbinvd", core.GetCurrentlyExecutingInstructionAddress())
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
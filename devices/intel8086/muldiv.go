@@ -0,0 +1,141 @@
+package intel8086
+
+/*
+	Multiply and divide
+	MUL, IMUL, DIV and IDIV r/m (0xF6/0xF7 /4 to /7) take their other operand from the accumulator at the operand
+	size. A product is left in AX, DX:AX or EDX:EAX. A dividend is taken from the same registers and leaves the
+	quotient in AL, AX or EAX and the remainder in AH, DX or EDX.
+
+	MUL and IMUL set CF and OF when the upper half of the product is significant, leaving SF, ZF, AF and PF
+	undefined. Every flag is undefined after a divide. Dividing by zero, or a quotient too large for its register,
+	raises #DE.
+*/
+
+// Sign extends the low width bits of value
+func signExtend(value uint64, width uint) int64 {
+	shift := 64 - width
+	return int64(value<<shift) >> shift
+}
+
+// Reads AL and AH, AX and DX or EAX and EDX, the halves of the accumulator pair at width
+func (core *CpuCore) accumulatorPair(width uint) (uint32, uint32) {
+	switch width {
+	case 8:
+		return uint32(core.registers.AL), uint32(core.registers.AH)
+	case 16:
+		return uint32(core.registers.AX), uint32(core.registers.DX)
+	}
+	return core.registers.EAX, core.registers.EDX
+}
+
+func (core *CpuCore) setAccumulatorPair(width uint, low uint32, high uint32) {
+	switch width {
+	case 8:
+		core.registers.AX = uint16(high)<<8 | uint16(uint8(low))
+	case 16:
+		core.registers.AX = uint16(low)
+		core.registers.DX = uint16(high)
+	default:
+		core.registers.setRegister32(0, low)
+		core.registers.setRegister32(2, high)
+	}
+}
+
+func INSTR_MUL_DIV(core *CpuCore) {
+	var modrm ModRm
+	var bytesConsumed uint32
+	var err error
+
+	var source uint32
+	var sourceName string
+	var width uint
+	var mask uint64
+	var low, high uint32
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err = core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	switch {
+	case core.currentOpCodeBeingExecuted == 0xF6:
+		var value *uint8
+		value, sourceName, err = core.readRm8(&modrm)
+		if err != nil { goto eof }
+		source, width = uint32(*value), 8
+	case core.flags.OperandSizeOverrideEnabled:
+		var value *uint32
+		value, sourceName, err = core.readRm32(&modrm)
+		if err != nil { goto eof }
+		source, width = *value, 32
+	default:
+		var value *uint16
+		value, sourceName, err = core.readRm16(&modrm)
+		if err != nil { goto eof }
+		source, width = uint32(*value), 16
+	}
+
+	mask = uint64(1)<<width - 1
+	low, high = core.accumulatorPair(width)
+
+	switch modrm.reg {
+	case 4:
+		{
+			// mul
+			product := uint64(low) * uint64(source)
+			core.setAccumulatorPair(width, uint32(product&mask), uint32(product>>width&mask))
+
+			core.registers.SetFlag(CarryFlag, product>>width != 0)
+			core.registers.SetFlag(OverFlowFlag, product>>width != 0)
+			core.undefineFlags(SignFlag | ZeroFlag | AdjustFlag | ParityFlag)
+			core.logger.Tracef("[%#04x] mul %s", core.GetCurrentlyExecutingInstructionAddress(), sourceName)
+		}
+	case 5:
+		{
+			// imul, the product doesn't fit the lower half when sign extending it doesn't give the product back
+			product := signExtend(uint64(low), width) * signExtend(uint64(source), width)
+			core.setAccumulatorPair(width, uint32(uint64(product)&mask), uint32(uint64(product)>>width&mask))
+
+			overflow := signExtend(uint64(product), width) != product
+			core.registers.SetFlag(CarryFlag, overflow)
+			core.registers.SetFlag(OverFlowFlag, overflow)
+			core.undefineFlags(SignFlag | ZeroFlag | AdjustFlag | ParityFlag)
+			core.logger.Tracef("[%#04x] imul %s", core.GetCurrentlyExecutingInstructionAddress(), sourceName)
+		}
+	case 6:
+		{
+			// div
+			dividend := uint64(high)<<width | uint64(low)
+			if source == 0 || dividend/uint64(source) > mask {
+				core.raiseException(NewFault(ExceptionDivideError))
+				goto eof
+			}
+			core.setAccumulatorPair(width, uint32(dividend/uint64(source)), uint32(dividend%uint64(source)))
+
+			core.undefineFlags(CarryFlag | OverFlowFlag | SignFlag | ZeroFlag | AdjustFlag | ParityFlag)
+			core.logger.Tracef("[%#04x] div %s", core.GetCurrentlyExecutingInstructionAddress(), sourceName)
+		}
+	default:
+		{
+			// idiv, the quotient is rounded towards zero and the remainder takes the sign of the dividend
+			dividend := signExtend(uint64(high)<<width|uint64(low), 2*width)
+			divisor := signExtend(uint64(source), width)
+			if divisor == 0 {
+				core.raiseException(NewFault(ExceptionDivideError))
+				goto eof
+			}
+			quotient := dividend / divisor
+			if quotient != signExtend(uint64(quotient), width) {
+				core.raiseException(NewFault(ExceptionDivideError))
+				goto eof
+			}
+			core.setAccumulatorPair(width, uint32(uint64(quotient)&mask), uint32(uint64(dividend%divisor)&mask))
+
+			core.undefineFlags(CarryFlag | OverFlowFlag | SignFlag | ZeroFlag | AdjustFlag | ParityFlag)
+			core.logger.Tracef("[%#04x] idiv %s", core.GetCurrentlyExecutingInstructionAddress(), sourceName)
+		}
+	}
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -1,7 +1,5 @@
 package intel8086
 
-import "log"
-
 func INSTR_IN(core *CpuCore) {
 	// Read from port
 
@@ -9,56 +7,60 @@ func INSTR_IN(core *CpuCore) {
 	case 0xE4:
 		{
 			// Read from port (imm) to AL
-			imm, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr + 1)
+			imm, err := core.fetch8(core.currentByteAddr + 1)
 			if err != nil { goto eof }
 			core.currentByteAddr++
 
 			data := core.ioPortAccessController.ReadAddr8(uint16(imm))
 
 			core.registers.AL = data
-			log.Printf("[%#04x] IN AL, IMM8 (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, data)
+			core.logger.Tracef("[%#04x] IN AL, IMM8 (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, data)
 		}
 	case 0xE5:
 		{
-			// Read from port (DX) to AL
-
-			dx := core.registers.DX
-
-			data := core.ioPortAccessController.ReadAddr8(uint16(dx))
+			// Read from port (imm) to AX, or EAX with a 0x66 prefix
+			imm, err := core.fetch8(core.currentByteAddr + 1)
+			if err != nil { goto eof }
+			core.currentByteAddr++
 
-			core.registers.AL = data
-			log.Printf("[%#04x] IN AL, DX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), dx, data)
+			core.inWord(uint16(imm))
 		}
 	case 0xEC:
 		{
-			// Read from port (imm) to AX
+			// Read from port (DX) to AL
 
-			imm, err := core.memoryAccessController.ReadAddr16(core.currentByteAddr + 1)
-			if err != nil { goto eof }
-			core.currentByteAddr += 2
+			dx := core.registers.DX
 
-			data := core.ioPortAccessController.ReadAddr16(imm)
+			data := core.ioPortAccessController.ReadAddr8(uint16(dx))
 
-			core.registers.AX = data
-			log.Printf("[%#04x] IN AX, IMM16 (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, data)
+			core.registers.AL = data
+			core.logger.Tracef("[%#04x] IN AL, DX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), dx, data)
 		}
 	case 0xED:
 		{
-			// Read from port (DX) to AX
-
-			dx := core.registers.DX
-
-			data := core.ioPortAccessController.ReadAddr16(uint16(dx))
-
-			core.registers.AX = data
-			log.Printf("[%#04x] IN AX, DX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), dx, data)
+			// Read from port (DX) to AX, or EAX with a 0x66 prefix
+			core.inWord(core.registers.DX)
 		}
 	default:
-		log.Fatal("Unrecognised IN (port read) instruction!")
+		core.logger.Fatalf("Unrecognised IN (port read) instruction!")
 	}
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart) +1
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart + 1)
+}
+
+// Word or dword IN at the current operand size
+func (core *CpuCore) inWord(port uint16) {
+	if core.flags.OperandSizeOverrideEnabled {
+		data := core.ioPortAccessController.ReadAddr32(port)
+		core.registers.EAX = data
+		core.logger.Tracef("[%#04x] IN EAX (Port: %#04x, data = %#08x)", core.GetCurrentlyExecutingInstructionAddress(), port, data)
+		return
+	}
+
+	data := core.ioPortAccessController.ReadAddr16(port)
+	core.registers.AX = data
+	core.logger.Tracef("[%#04x] IN AX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), port, data)
 }
 
 func INSTR_OUT(core *CpuCore) {
@@ -68,24 +70,22 @@ func INSTR_OUT(core *CpuCore) {
 	case 0xE6:
 		{
 			// Write value in AL to port addr imm8
-			imm, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr + 1)
+			imm, err := core.fetch8(core.currentByteAddr + 1)
 			if err != nil { goto eof }
 			core.currentByteAddr++
 
 			core.ioPortAccessController.WriteAddr8(uint16(imm), core.registers.AL)
 
-			log.Printf("[%#04x] OUT %#04x, AL (data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, core.registers.AL)
+			core.logger.Tracef("[%#04x] OUT %#04x, AL (data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, core.registers.AL)
 		}
 	case 0xE7:
 		{
-			// Write value in AX to port addr imm8
-			imm, err := core.memoryAccessController.ReadAddr8(core.currentByteAddr + 1)
+			// Write value in AX, or EAX with a 0x66 prefix, to port addr imm8
+			imm, err := core.fetch8(core.currentByteAddr + 1)
 			if err != nil { goto eof }
 			core.currentByteAddr++
 
-			core.ioPortAccessController.WriteAddr16(uint16(imm), core.registers.AX)
-
-			log.Printf("[%#04x] OUT %#04x, AX (data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), imm, core.registers.AX)
+			core.outWord(uint16(imm))
 		}
 	case 0xEE:
 		{
@@ -93,22 +93,122 @@ func INSTR_OUT(core *CpuCore) {
 
 			core.ioPortAccessController.WriteAddr8(uint16(core.registers.DX), core.registers.AL)
 
-			log.Printf("[%#04x] OUT DX, AL (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.DX, core.registers.AL)
+			core.logger.Tracef("[%#04x] OUT DX, AL (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.DX, core.registers.AL)
 		}
 	case 0xEF:
 		{
-			// Use value of DX as io port addr, and write value in AX
-
-			core.ioPortAccessController.WriteAddr16(uint16(core.registers.DX), core.registers.AX)
-
-			log.Printf("[%#04x] OUT DX, AX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), core.registers.DX, core.registers.AX)
+			// Use value of DX as io port addr, and write value in AX or EAX
+			core.outWord(core.registers.DX)
 		}
 	default:
-		log.Fatal("Unrecognised OUT (port read) instruction!")
+		core.logger.Fatalf("Unrecognised OUT (port read) instruction!")
 	}
 
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart) +1
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart + 1)
+}
+
+// Word or dword OUT at the current operand size
+func (core *CpuCore) outWord(port uint16) {
+	if core.flags.OperandSizeOverrideEnabled {
+		core.ioPortAccessController.WriteAddr32(port, core.registers.EAX)
+		core.logger.Tracef("[%#04x] OUT EAX (Port: %#04x, data = %#08x)", core.GetCurrentlyExecutingInstructionAddress(), port, core.registers.EAX)
+		return
+	}
+
+	core.ioPortAccessController.WriteAddr16(port, core.registers.AX)
+	core.logger.Tracef("[%#04x] OUT AX (Port: %#04x, data = %#04x)", core.GetCurrentlyExecutingInstructionAddress(), port, core.registers.AX)
+}
+
+func INSTR_INS(core *CpuCore) {
+	// INSB/INSW (0x6C/0x6D), port DX to ES:DI. The destination is always ES, segment overrides don't apply.
+	core.currentByteAddr++
+
+	var operStr = "INSB"
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0x6D {
+		operStr = "INSW"
+		size = 2
+	}
+
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REP"
+	}
+
+	core.logger.Tracef("[%#04x] %s %s (Port: %#04x)", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr, core.registers.DX)
+
+	core.repeatString(func() error {
+		err := core.checkSegmentLimit(&core.registers.ES, core.destinationIndex(), size, accessWrite)
+		if err != nil {
+			return err
+		}
+
+		addr := core.segmentBase(core.registers.ES) + core.destinationIndex()
+		core.watchData(addr, size, true)
+		if size == 1 {
+			err = core.memoryAccessController.WriteAddr8(addr, core.ioPortAccessController.ReadAddr8(core.registers.DX))
+		} else {
+			err = core.memoryAccessController.WriteAddr16(addr, core.ioPortAccessController.ReadAddr16(core.registers.DX))
+		}
+		if err != nil {
+			return err
+		}
+
+		core.advanceDestinationIndex(int(size))
+		return nil
+	})
+
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_OUTS(core *CpuCore) {
+	// OUTSB/OUTSW (0x6E/0x6F), DS:SI to port DX. The source segment can be overridden.
+	core.currentByteAddr++
+
+	var operStr = "OUTSB"
+	size := uint32(1)
+	if core.currentOpCodeBeingExecuted == 0x6F {
+		operStr = "OUTSW"
+		size = 2
+	}
+
+	var prefixStr = ""
+	if core.flags.RepPrefixEnabled {
+		prefixStr = "REP"
+	}
+
+	core.logger.Tracef("[%#04x] %s %s (Port: %#04x)", core.GetCurrentlyExecutingInstructionAddress(), prefixStr, operStr, core.registers.DX)
+
+	source := core.overrideSegment(&core.registers.DS)
+
+	core.repeatString(func() error {
+		err := core.checkSegmentLimit(source, core.sourceIndex(), size, accessRead)
+		if err != nil {
+			return err
+		}
+
+		addr := core.segmentBase(*source) + core.sourceIndex()
+		if size == 1 {
+			var value uint8
+			value, err = core.memoryAccessController.ReadAddr8(addr)
+			if err != nil {
+				return err
+			}
+			core.ioPortAccessController.WriteAddr8(core.registers.DX, value)
+		} else {
+			var value uint16
+			value, err = core.memoryAccessController.ReadAddr16(addr)
+			if err != nil {
+				return err
+			}
+			core.ioPortAccessController.WriteAddr16(core.registers.DX, value)
+		}
+
+		core.advanceSourceIndex(int(size))
+		return nil
+	})
 
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
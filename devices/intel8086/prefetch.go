@@ -0,0 +1,65 @@
+package intel8086
+
+/*
+	Prefetch queue
+	The 386 fetches up to 16 bytes ahead of the instruction being executed, so a write to code that has already
+	been prefetched isn't seen until the queue is flushed by a control transfer. The model is off by default.
+	When enabled, instruction fetches are served from the queue, which is refilled when a fetch runs off its
+	end and flushed whenever execution doesn't continue at the byte following the last instruction.
+*/
+
+const PrefetchQueueSize = 16
+
+type prefetchQueue struct {
+	enabled        bool
+	start          uint32 // linear address of bytes[0]
+	bytes          []uint8
+	sequentialNext uint32 // address following the last instruction decoded
+}
+
+// Enables the stale fetch behaviour of the prefetch queue, disabled fetches always read memory
+func (core *CpuCore) SetPrefetchQueueEnabled(enabled bool) {
+	core.prefetch.enabled = enabled
+	core.flushPrefetchQueue()
+}
+
+func (core *CpuCore) IsPrefetchQueueEnabled() bool {
+	return core.prefetch.enabled
+}
+
+func (core *CpuCore) flushPrefetchQueue() {
+	core.prefetch.bytes = core.prefetch.bytes[:0]
+}
+
+// Called by Step before decoding, anything other than running into the next instruction discards the queue
+func (core *CpuCore) syncPrefetchQueue(codePointer uint32) {
+	if codePointer != core.prefetch.sequentialNext {
+		core.flushPrefetchQueue()
+	}
+}
+
+func (core *CpuCore) refillPrefetchQueue(addr uint32) {
+	core.prefetch.start = addr
+	core.prefetch.bytes = core.prefetch.bytes[:0]
+	for i := uint32(0); i < PrefetchQueueSize; i++ {
+		value, err := core.memoryAccessController.ReadAddr8(addr + i)
+		if err != nil {
+			break
+		}
+		core.prefetch.bytes = append(core.prefetch.bytes, value)
+	}
+}
+
+func (core *CpuCore) prefetchByte(addr uint32) (uint8, error) {
+	queue := &core.prefetch
+	if addr < queue.start || addr-queue.start >= uint32(len(queue.bytes)) {
+		core.refillPrefetchQueue(addr)
+	}
+
+	if len(queue.bytes) == 0 {
+		// nothing could be read at addr
+		return 0, core.fetchFault()
+	}
+
+	return queue.bytes[addr-queue.start], nil
+}
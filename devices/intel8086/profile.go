@@ -0,0 +1,53 @@
+package intel8086
+
+/*
+	Opcode profiling
+	While enabled every instruction the decoder dispatches is counted by its opcode. One byte opcodes are keyed by
+	the opcode itself and two byte opcodes by 0x0F00 | the second byte, prefixes aren't counted. Instructions
+	refused before dispatch, such as a LOCK prefix raising #UD, aren't counted either. Disabled costs a nil check.
+*/
+
+type opcodeProfile struct {
+	oneByte [256]uint64
+	twoByte [256]uint64
+}
+
+// Starts counting executions per opcode, counts already taken are kept
+func (core *CpuCore) EnableOpcodeProfiling() {
+	if core.opcodeProfile == nil {
+		core.opcodeProfile = &opcodeProfile{}
+	}
+}
+
+// Stops counting and discards the counts
+func (core *CpuCore) DisableOpcodeProfiling() {
+	core.opcodeProfile = nil
+}
+
+// Gets the execution count of every opcode seen since profiling was enabled, nil when it isn't
+func (core *CpuCore) OpcodeHistogram() map[uint16]uint64 {
+	if core.opcodeProfile == nil {
+		return nil
+	}
+
+	histogram := make(map[uint16]uint64)
+	for opcode, count := range core.opcodeProfile.oneByte {
+		if count > 0 {
+			histogram[uint16(opcode)] = count
+		}
+	}
+	for opcode, count := range core.opcodeProfile.twoByte {
+		if count > 0 {
+			histogram[0x0F00|uint16(opcode)] = count
+		}
+	}
+	return histogram
+}
+
+func (profile *opcodeProfile) count(opcode uint8, twoByte bool) {
+	if twoByte {
+		profile.twoByte[opcode]++
+	} else {
+		profile.oneByte[opcode]++
+	}
+}
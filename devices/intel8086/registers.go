@@ -7,6 +7,27 @@ type SegmentRegister struct {
 	limit uint32
 	//selector uint16
 	access_information uint16
+	descriptorBase uint32 // base address from the cached descriptor (protected mode)
+}
+
+func (s SegmentRegister) Selector() uint16 {
+	return s.base
+}
+
+func (s SegmentRegister) DescriptorBase() uint32 {
+	return s.descriptorBase
+}
+
+func (s SegmentRegister) Limit() uint32 {
+	return s.limit
+}
+
+func (s SegmentRegister) AccessInformation() uint16 {
+	return s.access_information
+}
+
+func (s SegmentRegister) Present() bool {
+	return s.access_information&DescriptorAccessPresent != 0
 }
 
 type CpuRegisters struct {
@@ -24,12 +45,12 @@ type CpuRegisters struct {
 	FS SegmentRegister // ?? segment
 	GS SegmentRegister // ?? segment
 
-	IP uint16 // 16 bit instruction pointer
+	IP uint16 // 16 bit instruction pointer, the low word of EIP
 	SP uint16
 	BP uint16
 	SI uint16
 	DI uint16
-	EIP uint32 // 32 bit instruction pointer
+	EIP uint32 // 32 bit instruction pointer, used in full by 32 bit code segments
 	ESP uint32
 	EBP uint32
 	ESI uint32
@@ -66,6 +87,7 @@ type CpuRegisters struct {
 
 	// Flags
 	FLAGS uint16
+	undefinedFlags uint16 // left undefined by the last instruction to touch them, see strictflags.go
 
 	// Control Flag
 	CR0   uint32
@@ -74,6 +96,66 @@ type CpuRegisters struct {
 	CR3   uint32
 	CR4   uint32
 
+	// Debug registers, DR4 and DR5 are aliases of DR6 and DR7
+	DR0 uint32
+	DR1 uint32
+	DR2 uint32
+	DR3 uint32
+	DR6 uint32
+	DR7 uint32
+
+	// Descriptor table registers
+	GDTR DescriptorTableRegister
+	IDTR DescriptorTableRegister
+
+	// Task register, caches the descriptor of the current task state segment
+	TR SegmentRegister
+
+	// Local descriptor table register, caches the LDT descriptor selected by LLDT
+	LDTR SegmentRegister
+
+	// the general registers as syncViews last left them
+	views registerViews
+}
+
+// The 8, 16 and 32 bit general registers are separate fields rather than views of one register. syncViews runs
+// either side of every instruction and copies whichever view of a register changed into the others, so a write
+// of any width reads back through all of them.
+type registerViews struct {
+	registers8  [8]uint8
+	registers16 [8]uint16
+	registers32 [8]uint32
+}
+
+func (core *CpuRegisters) syncViews() {
+	views := &core.views
+
+	for i := 0; i < 8; i++ {
+		r32, r16 := core.registers32Bit[i], core.registers16Bit[i]
+
+		// the widest view written wins, an instruction writing more than one writes them alike
+		switch {
+		case *r32 != views.registers32[i]:
+			*r16 = uint16(*r32)
+		case *r16 != views.registers16[i]:
+			*r32 = *r32&0xFFFF0000 | uint32(*r16)
+		case i < 4 && (*core.registers8Bit[i] != views.registers8[i] || *core.registers8Bit[i+4] != views.registers8[i+4]):
+			*r16 = uint16(*core.registers8Bit[i+4])<<8 | uint16(*core.registers8Bit[i])
+			*r32 = *r32&0xFFFF0000 | uint32(*r16)
+		}
+
+		if i < 4 {
+			// AX, CX, DX and BX split into the low and high byte registers
+			*core.registers8Bit[i] = uint8(*r16)
+			*core.registers8Bit[i+4] = uint8(*r16 >> 8)
+		}
+	}
+
+	for i := 0; i < 8; i++ {
+		views.registers8[i] = *core.registers8Bit[i]
+		views.registers16[i] = *core.registers16Bit[i]
+		views.registers32[i] = *core.registers32Bit[i]
+	}
 }
 
 func (c *CpuRegisters) index8ToString(i uint8) string {
@@ -165,3 +247,37 @@ func (core *CpuRegisters) indexSegmentToString(i uint8) string {
 		return fmt.Sprintf("Unrecognised segment register index %d", i)
 	}
 }
+
+// Writes AL or AH along with AX, for code which reads AX back before syncViews next runs
+func (core *CpuRegisters) SetAL(value uint8) {
+	core.AL = value
+	core.AX = core.AX&0xFF00 | uint16(value)
+}
+
+func (core *CpuRegisters) SetAH(value uint8) {
+	core.AH = value
+	core.AX = core.AX&0x00FF | uint16(value)<<8
+}
+
+// Writes the 32 bit register at index along with its 16 and 8 bit views, for code which reads one of them back
+// before syncViews next runs
+func (core *CpuRegisters) setRegister32(index uint8, value uint32) {
+	*core.registers32Bit[index] = value
+	*core.registers16Bit[index] = uint16(value)
+	if index < 4 {
+		*core.registers8Bit[index] = uint8(value)
+		*core.registers8Bit[index+4] = uint8(value >> 8)
+	}
+}
+
+// Writes SP or BP along with the low word of ESP or EBP, an instruction which has already written the 32 bit
+// register would otherwise have the 16 bit write lost to it when syncViews runs
+func (core *CpuRegisters) SetSP(value uint16) {
+	core.SP = value
+	core.ESP = core.ESP&0xFFFF0000 | uint32(value)
+}
+
+func (core *CpuRegisters) SetBP(value uint16) {
+	core.BP = value
+	core.EBP = core.EBP&0xFFFF0000 | uint32(value)
+}
@@ -0,0 +1,55 @@
+package intel8086
+
+/*
+	Reset state
+	The 386 starts executing at F000:FFF0, just below the top of the bios image. A ResetConfig overrides the
+	vector and seeds registers so boot sectors and test code can be run without a bios.
+*/
+
+const (
+	ResetVectorCS = 0xF000
+	ResetVectorIP = 0xFFF0
+)
+
+type ResetConfig struct {
+	CS uint16
+	IP uint16
+
+	// Optional, called after the reset vector is loaded to seed the initial register state
+	SeedRegisters func(registers *CpuRegisters)
+}
+
+// Sets the reset vector and initial registers used by Reset, nil restores the standard vector
+func (core *CpuCore) SetResetConfig(config *ResetConfig) {
+	core.resetConfig = config
+}
+
+func (core *CpuCore) GetResetConfig() *ResetConfig {
+	return core.resetConfig
+}
+
+// Clears the segment registers and loads the reset vector. The descriptor caches are set up as in real mode,
+// a 64k read/write segment at selector<<4, so CS starts out with base 0xF0000.
+func (core *CpuCore) resetSegmentRegisters() {
+	for _, segment := range core.registers.registersSegmentRegisters {
+		*segment = SegmentRegister{}
+	}
+
+	core.loadResetVector()
+	core.keepRealModeSegmentCaches()
+}
+
+func (core *CpuCore) loadResetVector() {
+	if core.resetConfig == nil {
+		core.registers.CS.base = ResetVectorCS
+		core.registers.IP = ResetVectorIP
+		return
+	}
+
+	core.registers.CS.base = core.resetConfig.CS
+	core.registers.IP = core.resetConfig.IP
+
+	if core.resetConfig.SeedRegisters != nil {
+		core.resetConfig.SeedRegisters(core.registers)
+	}
+}
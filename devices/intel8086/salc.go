@@ -0,0 +1,26 @@
+package intel8086
+
+/*
+	SALC
+	SALC (0xD6) is undocumented but executed by every part from the 8086 on: AL becomes 0xFF with CF set and 0x00
+	with it clear. Flags are left alone. Setting the NoUndocumentedOpcodes feature makes it #UD, for checking
+	code only relies on documented instructions.
+*/
+
+func INSTR_SALC(core *CpuCore) {
+	core.currentByteAddr++
+
+	if core.features.NoUndocumentedOpcodes {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+	} else {
+		var al uint8
+		if core.registers.GetFlag(CarryFlag) {
+			al = 0xFF
+		}
+		core.registers.SetAL(al)
+
+		core.logger.Tracef("[%#04x] salc", core.GetCurrentlyExecutingInstructionAddress())
+	}
+
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,128 @@
+package intel8086
+
+import (
+	"fmt"
+)
+
+/*
+	Double precision shifts
+	SHLD and SHRD shift the r/m destination by the count, filling the vacated bits from the register source,
+	which is left alone. The same handler serves both widths: 16 bit operands, or 32 bit ones under the operand
+	size prefix. The count is an imm8 (0x0F 0xA4 and 0x0F 0xAC) or CL (0x0F 0xA5 and 0x0F 0xAD), taken modulo
+	32 at either width, and a masked count of 0 changes nothing, not even the flags.
+
+	A 16 bit count above 16 is undefined. As on Intel parts the bits shifted in past the source come from the
+	destination again, the operands are treated as one 48 bit value destination:source:destination.
+
+	CF is the last bit shifted out and SF, ZF and PF follow the result. OF is set when the sign changed, which
+	is only defined for a count of 1. AF is undefined and left alone.
+*/
+
+// Shifts dest left, or right, by count bits filling from src at an operand width of 16 or 32 bits, setting the
+// flags. count is already masked and isn't 0.
+func (core *CpuCore) shiftDouble(dest uint32, src uint32, count uint32, width uint32, left bool) uint32 {
+	mask := uint32(uint64(1)<<width - 1)
+	sign := uint32(1) << (width - 1)
+	dest, src = dest&mask, src&mask
+
+	// the operands in one value, the destination copied below the source at 16 bits
+	var joined uint64
+	var joinedWidth uint32
+	if width == 16 {
+		joined = uint64(dest)<<32 | uint64(src)<<16 | uint64(dest)
+		joinedWidth = 48
+	} else {
+		joined = uint64(dest)<<32 | uint64(src)
+		joinedWidth = 64
+	}
+
+	var result uint32
+	var carry bool
+	if left {
+		result = uint32(joined>>(joinedWidth-width-count)) & mask
+		carry = joined>>(joinedWidth-count)&1 != 0
+	} else {
+		if width == 32 {
+			// the source fills from the top
+			joined = uint64(src)<<32 | uint64(dest)
+		}
+		result = uint32(joined>>count) & mask
+		carry = joined>>(count-1)&1 != 0
+	}
+
+	core.registers.SetFlag(CarryFlag, carry)
+	core.registers.SetFlag(ZeroFlag, result == 0)
+	core.registers.SetFlag(SignFlag, result&sign != 0)
+	core.registers.SetFlag(OverFlowFlag, (dest^result)&sign != 0)
+	core.registers.SetFlag(ParityFlag, evenParity(uint8(result)))
+
+	core.undefineFlags(AdjustFlag)
+	if count > 1 {
+		core.undefineFlags(OverFlowFlag)
+	}
+	if count > width {
+		core.undefineFlags(CarryFlag | SignFlag | ZeroFlag | ParityFlag)
+	}
+
+	return result
+}
+
+// SHLD (0x0F 0xA4 and 0x0F 0xA5) and SHRD (0x0F 0xAC and 0x0F 0xAD) r/m16, r16 / r/m32, r32 by imm8 or CL
+func INSTR_SHIFT_DOUBLE(core *CpuCore) {
+	var count uint32
+	var countStr string
+	var rmStr, rStr string
+	var name = "shld"
+
+	left := core.currentOpCodeBeingExecuted < 0xA8
+	if !left {
+		name = "shrd"
+	}
+
+	core.currentByteAddr++
+
+	{
+		modrm, bytesConsumed, err := core.consumeModRm()
+		if err != nil { goto eof }
+		core.currentByteAddr += bytesConsumed
+
+		if core.currentOpCodeBeingExecuted&0x1 == 0 {
+			imm, err := core.readImm8()
+			if err != nil { goto eof }
+			count = uint32(imm)
+			countStr = fmt.Sprintf("%#02x", imm)
+		} else {
+			count = uint32(core.registers.CL)
+			countStr = "cl"
+		}
+		count &= 31
+
+		if core.flags.OperandSizeOverrideEnabled {
+			var r32 *uint32
+			r32, rStr = core.readR32(&modrm)
+			if count == 0 {
+				_, rmStr, err = core.readRm32(&modrm)
+			} else {
+				rmStr, err = core.modifyRm32(&modrm, func(dest uint32) uint32 {
+					return core.shiftDouble(dest, *r32, count, 32, left)
+				})
+			}
+		} else {
+			var r16 *uint16
+			r16, rStr = core.readR16(&modrm)
+			if count == 0 {
+				_, rmStr, err = core.readRm16(&modrm)
+			} else {
+				rmStr, err = core.modifyRm16(&modrm, func(dest uint16) uint16 {
+					return uint16(core.shiftDouble(uint32(dest), uint32(*r16), count, 16, left))
+				})
+			}
+		}
+		if err != nil { goto eof }
+	}
+
+	core.logger.Tracef("[%#04x] %s %s, %s, %s", core.GetCurrentlyExecutingInstructionAddress(), name, rmStr, rStr, countStr)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,131 @@
+package intel8086
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+	Register snapshots
+	A copy of the general, segment and control registers and FLAGS, taken between instructions. The instruction
+	pointer is left out as it changes with every instruction. DiffSnapshots lists what changed from one snapshot to
+	another, registers in the order the modrm encoding numbers them and then each flag on its own, so a test can
+	say an instruction changed AX and ZF and nothing else.
+*/
+
+type RegisterSnapshot struct {
+	Registers8  [8]uint8  // AL, CL, DL, BL, AH, CH, DH, BH
+	Registers16 [8]uint16 // AX, CX, DX, BX, SP, BP, SI, DI
+	Registers32 [8]uint32 // EAX, ECX, EDX, EBX, ESP, EBP, ESI, EDI
+	Segments    [6]uint16 // ES, CS, SS, DS, FS, GS selectors
+
+	FLAGS uint16
+
+	CR0 uint32
+	CR2 uint32
+	CR3 uint32
+	CR4 uint32
+}
+
+// A field which differs between two snapshots
+type FieldDiff struct {
+	Name   string
+	Before uint32
+	After  uint32
+
+	digits int // hex digits to print the values with
+}
+
+func (diff FieldDiff) String() string {
+	return fmt.Sprintf("%s=%0*x->%0*x", diff.Name, diff.digits, diff.Before, diff.digits, diff.After)
+}
+
+var snapshotFlags = []struct {
+	name string
+	mask uint16
+}{
+	{"CF", CarryFlag},
+	{"PF", ParityFlag},
+	{"AF", AdjustFlag},
+	{"ZF", ZeroFlag},
+	{"SF", SignFlag},
+	{"TF", TrapFlag},
+	{"IF", InterruptFlag},
+	{"DF", DirectionFlag},
+	{"OF", OverFlowFlag},
+	{"IOPL", IoPrivilegeLevelFlag},
+	{"NT", NestedTaskFlag},
+}
+
+func (core *CpuCore) SnapshotRegisters() RegisterSnapshot {
+	registers := core.registers
+	// registers written since the last step read back through all their views
+	registers.syncViews()
+
+	snapshot := RegisterSnapshot{
+		FLAGS: registers.FLAGS,
+		CR0:   registers.CR0,
+		CR2:   registers.CR2,
+		CR3:   registers.CR3,
+		CR4:   registers.CR4,
+	}
+	for i := 0; i < 8; i++ {
+		snapshot.Registers8[i] = *registers.registers8Bit[i]
+		snapshot.Registers16[i] = *registers.registers16Bit[i]
+		snapshot.Registers32[i] = *registers.registers32Bit[i]
+	}
+	for i, segment := range registers.registersSegmentRegisters {
+		snapshot.Segments[i] = segment.base
+	}
+	return snapshot
+}
+
+// Lists the fields that differ from a to b
+func DiffSnapshots(a, b RegisterSnapshot) []FieldDiff {
+	// only the index to name lookups are used
+	var names CpuRegisters
+
+	var diffs []FieldDiff
+	add := func(name string, before uint32, after uint32, digits int) {
+		if before != after {
+			diffs = append(diffs, FieldDiff{Name: name, Before: before, After: after, digits: digits})
+		}
+	}
+
+	for i := uint8(0); i < 8; i++ {
+		add(names.index8ToString(i), uint32(a.Registers8[i]), uint32(b.Registers8[i]), 2)
+	}
+	for i := uint8(0); i < 8; i++ {
+		add(names.index16ToString(i), uint32(a.Registers16[i]), uint32(b.Registers16[i]), 4)
+	}
+	for i := uint8(0); i < 8; i++ {
+		add(names.index32ToString(i), a.Registers32[i], b.Registers32[i], 8)
+	}
+	for i := uint8(0); i < 6; i++ {
+		add(names.indexSegmentToString(i), uint32(a.Segments[i]), uint32(b.Segments[i]), 4)
+	}
+
+	for _, flag := range snapshotFlags {
+		shift := 0
+		for flag.mask>>shift&1 == 0 {
+			shift++
+		}
+		add(flag.name, uint32(a.FLAGS&flag.mask)>>shift, uint32(b.FLAGS&flag.mask)>>shift, 1)
+	}
+
+	add("CR0", a.CR0, b.CR0, 8)
+	add("CR2", a.CR2, b.CR2, 8)
+	add("CR3", a.CR3, b.CR3, 8)
+	add("CR4", a.CR4, b.CR4, 8)
+
+	return diffs
+}
+
+// Formats diffs space separated, as in a trace line
+func FormatDiffs(diffs []FieldDiff) string {
+	var fields []string
+	for _, diff := range diffs {
+		fields = append(fields, diff.String())
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,60 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Software interrupts
+	INT imm8 (0xCD) calls the handler for the vector like a hardware interrupt, returning past the INT.
+
+	A host service can take over a vector in real mode, which is how the bios services layer answers the bios
+	calls without a bios image. The service runs in place of the IVT handler with the caller's registers and
+	reports its results in them directly, CF included, as if the handler had returned with IRET. Returning false
+	passes the call on to the IVT handler. Protected mode always goes through the IDT.
+*/
+
+// Host implementation of a real mode software interrupt, returns false to leave the call to the IVT handler
+type InterruptService func(registers *CpuRegisters) bool
+
+// Installs a host service for the vector, nil removes it
+func (core *CpuCore) SetInterruptService(vector uint8, service InterruptService) {
+	if service == nil {
+		delete(core.interruptServices, vector)
+		return
+	}
+	if core.interruptServices == nil {
+		core.interruptServices = make(map[uint8]InterruptService)
+	}
+	core.interruptServices[vector] = service
+}
+
+func INSTR_INT(core *CpuCore) {
+	var vector uint8
+	var err error
+
+	core.currentByteAddr++
+
+	vector, err = core.readImm8()
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] int %#02x", core.GetCurrentlyExecutingInstructionAddress(), vector)
+
+	// the handler returns to the instruction after the int
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+
+	if service, ok := core.interruptServices[vector]; ok && core.mode == common.REAL_MODE {
+		if service(core.registers) {
+			return
+		}
+	}
+
+	err = core.interrupt(vector)
+	if err != nil && !core.raiseProtectionFault(err) {
+		core.logger.Errorf("[%#04x] int %#02x failed: %s", core.GetCurrentlyExecutingInstructionAddress(), vector, err.Error())
+	}
+	return
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
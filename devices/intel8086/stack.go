@@ -1,25 +1,155 @@
 package intel8086
 
 import (
-	"fmt"
-	"log"
+	"github.com/andrewjc/threeatesix/common"
 )
 
+// In protected mode the B bit of the SS descriptor selects ESP rather than SP as the stack pointer
+func (core *CpuCore) stackIs32Bit() bool {
+	return core.mode == common.PROTECTED_MODE && core.registers.SS.access_information&(DescriptorFlagSize<<8) != 0
+}
+
+// Gets the stack pointer. SP and ESP are held separately, so with a 32 bit stack the low word comes from SP.
+func (core *CpuCore) stackPointer() uint32 {
+	if core.stackIs32Bit() {
+		return core.registers.ESP&0xFFFF0000 | uint32(core.registers.SP)
+	}
+	return uint32(core.registers.SP)
+}
+
+func (core *CpuCore) setStackPointer(value uint32) {
+	if core.stackIs32Bit() {
+		core.registers.ESP = value
+	}
+	core.registers.SetSP(uint16(value))
+}
+
+// Gets the linear address of the top of the stack (SS:SP)
+func (core *CpuCore) stackAddress() uint32 {
+	return core.segmentBase(core.registers.SS) + core.stackPointer()
+}
+
+func (core *CpuCore) pushWord(value uint16) error {
+	sp := core.stackPointer()
+	core.checkStackWrap(true, sp, 2)
+	core.setStackPointer(sp - 2)
+
+	err := core.checkSegmentLimit(&core.registers.SS, core.stackPointer(), 2, accessStack)
+	if err != nil {
+		core.setStackPointer(sp)
+		return err
+	}
+
+	core.watchData(core.stackAddress(), 2, true)
+	err = core.memoryAccessController.WriteAddr16(core.stackAddress(), value)
+	if err != nil {
+		core.setStackPointer(sp)
+		return err
+	}
+
+	return nil
+}
+
+func (core *CpuCore) popWord() (uint16, error) {
+	err := core.checkSegmentLimit(&core.registers.SS, core.stackPointer(), 2, accessStack)
+	if err != nil {
+		return 0, err
+	}
+
+	core.watchData(core.stackAddress(), 2, false)
+	value, err := core.memoryAccessController.ReadAddr16(core.stackAddress())
+	if err != nil {
+		return 0, err
+	}
+
+	core.checkStackWrap(false, core.stackPointer(), 2)
+	core.setStackPointer(core.stackPointer() + 2)
+
+	return value, nil
+}
+
+func (core *CpuCore) pushDword(value uint32) error {
+	sp := core.stackPointer()
+	core.checkStackWrap(true, sp, 4)
+	core.setStackPointer(sp - 4)
+
+	err := core.checkSegmentLimit(&core.registers.SS, core.stackPointer(), 4, accessStack)
+	if err != nil {
+		core.setStackPointer(sp)
+		return err
+	}
+
+	core.watchData(core.stackAddress(), 4, true)
+	err = core.memoryAccessController.WriteAddr32(core.stackAddress(), value)
+	if err != nil {
+		core.setStackPointer(sp)
+		return err
+	}
+
+	return nil
+}
+
+func (core *CpuCore) popDword() (uint32, error) {
+	err := core.checkSegmentLimit(&core.registers.SS, core.stackPointer(), 4, accessStack)
+	if err != nil {
+		return 0, err
+	}
+
+	core.watchData(core.stackAddress(), 4, false)
+	value, err := core.memoryAccessController.ReadAddr32(core.stackAddress())
+	if err != nil {
+		return 0, err
+	}
+
+	core.checkStackWrap(false, core.stackPointer(), 4)
+	core.setStackPointer(core.stackPointer() + 4)
+
+	return value, nil
+}
+
+// Pushes a value at the current operand size, a 0x66 prefix makes it 4 bytes
+func (core *CpuCore) pushOperand(value uint32) error {
+	if core.flags.OperandSizeOverrideEnabled {
+		return core.pushDword(value)
+	}
+	return core.pushWord(uint16(value))
+}
+
+func (core *CpuCore) popOperand() (uint32, error) {
+	if core.flags.OperandSizeOverrideEnabled {
+		return core.popDword()
+	}
+	value, err := core.popWord()
+	return uint32(value), err
+}
+
+// Pops a value at the current operand size and keeps the low word, for offsets and selectors pushed as dwords
+func (core *CpuCore) popOperandWord() (uint16, error) {
+	value, err := core.popOperand()
+	return uint16(value), err
+}
+
 func INSTR_PUSH(core *CpuCore) {
 	core.currentByteAddr++
 
 	switch core.currentOpCodeBeingExecuted {
 	case 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57:
 		{
-			// PUSH r16
-			val, valName := core.registers.registers16Bit[core.currentOpCodeBeingExecuted-0x50], core.registers.index16ToString(core.currentOpCodeBeingExecuted-0x50)
-
-			core.registers.SP = core.registers.SP - 2
-
-			err := core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), *val)
+			// PUSH r16 / r32
+			index := core.currentOpCodeBeingExecuted - 0x50
+
+			var err error
+			var valName string
+			if core.flags.OperandSizeOverrideEnabled {
+				valName = core.registers.index32ToString(index)
+				err = core.pushDword(*core.registers.registers32Bit[index])
+			} else {
+				valName = core.registers.index16ToString(index)
+				err = core.pushWord(*core.registers.registers16Bit[index])
+			}
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), valName)
+			core.logger.Tracef("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), valName)
 
 		}
 	case 0x6A:
@@ -30,87 +160,171 @@ func INSTR_PUSH(core *CpuCore) {
 			val, err := core.readImm8()
 			if err != nil { goto eof }
 
-			core.registers.SP = core.registers.SP - 2
-
-			err = core.memoryAccessController.WriteAddr8(uint32(core.registers.SP), val)
+			// imm8 is sign extended to the operand size
+			err = core.pushOperand(uint32(int32(int8(val))))
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %#04x", core.GetCurrentlyExecutingInstructionAddress(), val)
+			core.logger.Tracef("[%#04x] push %#04x", core.GetCurrentlyExecutingInstructionAddress(), val)
 		}
 	case 0x68:
 		{
-			// PUSH imm16
-
-
-			val, err := core.readImm16()
+			// PUSH imm16 / imm32
+
+			var val uint32
+			var err error
+			if core.flags.OperandSizeOverrideEnabled {
+				val, err = core.readImm32()
+			} else {
+				var val16 uint16
+				val16, err = core.readImm16()
+				val = uint32(val16)
+			}
 			if err != nil { goto eof }
 
-			core.registers.SP = core.registers.SP - 2
-
-			err = core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), val)
+			err = core.pushOperand(val)
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %#04x", core.GetCurrentlyExecutingInstructionAddress(), val)
+			core.logger.Tracef("[%#04x] push %#04x", core.GetCurrentlyExecutingInstructionAddress(), val)
 		}
-	case 0x0E:
+	case 0xFF:
 		{
-			// PUSH CS
-
-
-			val := core.registers.CS.base
+			// PUSH r/m16 / r/m32 (0xFF /6)
+			modrm, bytesConsumed, err := core.consumeModRm()
+			if err != nil { goto eof }
+			core.currentByteAddr += bytesConsumed
+
+			var valName string
+			if core.flags.OperandSizeOverrideEnabled {
+				var val *uint32
+				val, valName, err = core.readRm32(&modrm)
+				if err != nil { goto eof }
+				err = core.pushDword(*val)
+			} else {
+				var val *uint16
+				val, valName, err = core.readRm16(&modrm)
+				if err != nil { goto eof }
+				err = core.pushWord(*val)
+			}
+			if err != nil { goto eof }
 
-			core.registers.SP = core.registers.SP - 2
+			core.logger.Tracef("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), valName)
+		}
+	case 0x0E, 0x16, 0x1E, 0x06, 0xA0, 0xA8:
+		{
+			// PUSH CS/SS/DS/ES, PUSH FS/GS (0x0F 0xA0 / 0x0F 0xA8)
+			// a 32 bit push zero extends the selector
+			segment, segmentName := core.pushPopSegmentRegister()
 
-			err := core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), val)
+			err := core.pushOperand(uint32(segment.base))
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), "CS")
+			core.logger.Tracef("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), segmentName)
 		}
-	case 0x16:
-		{
-			// PUSH SS
+	default:
+		core.logger.Errorf("Unhandled PUSH instruction:  %#04x", core.currentOpCodeBeingExecuted)
+		doCoreDump(core)
+	}
 
-			val := core.registers.SS.base
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
 
-			core.registers.SP = core.registers.SP - 2
+// Segment register named by a segment push or pop opcode
+func (core *CpuCore) pushPopSegmentRegister() (*SegmentRegister, string) {
+	switch core.currentOpCodeBeingExecuted {
+	case 0x06, 0x07:
+		return &core.registers.ES, "ES"
+	case 0x0E:
+		return &core.registers.CS, "CS"
+	case 0x16, 0x17:
+		return &core.registers.SS, "SS"
+	case 0x1E, 0x1F:
+		return &core.registers.DS, "DS"
+	case 0xA0, 0xA1:
+		return &core.registers.FS, "FS"
+	case 0xA8, 0xA9:
+		return &core.registers.GS, "GS"
+	}
+	return nil, ""
+}
 
-			err := core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), val)
-			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), "SS")
-		}
-	case 0x1E:
-		{
-			// PUSH DS
+func INSTR_POP(core *CpuCore) {
+	var savedSP uint32
 
-			val := core.registers.DS.base
+	core.currentByteAddr++
 
-			core.registers.SP = core.registers.SP - 2
+	savedSP = core.stackPointer()
 
-			err :=core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), val)
+	switch core.currentOpCodeBeingExecuted {
+	case 0x58, 0x59, 0x5A, 0x5B, 0x5C, 0x5D, 0x5E, 0x5F:
+		{
+			// POP r16 / r32
+			index := core.currentOpCodeBeingExecuted - 0x58
+
+			if core.flags.OperandSizeOverrideEnabled {
+				val, err := core.popDword()
+				if err != nil { goto eof }
+				*core.registers.registers32Bit[index] = val
+				core.logger.Tracef("[%#04x] pop %s", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index32ToString(index))
+			} else {
+				val, err := core.popWord()
+				if err != nil { goto eof }
+				*core.registers.registers16Bit[index] = val
+				core.logger.Tracef("[%#04x] pop %s", core.GetCurrentlyExecutingInstructionAddress(), core.registers.index16ToString(index))
+			}
+		}
+	case 0x8F:
+		{
+			// POP r/m16 / r/m32 (0x8F /0)
+			modrm, bytesConsumed, err := core.consumeModRm()
 			if err != nil { goto eof }
-
-			log.Printf("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), "DS")
+			core.currentByteAddr += bytesConsumed
+
+			if core.flags.OperandSizeOverrideEnabled {
+				var val uint32
+				val, err = core.popDword()
+				if err == nil {
+					err = core.writeRm32(&modrm, &val)
+				}
+			} else {
+				var val uint16
+				val, err = core.popWord()
+				if err == nil {
+					err = core.writeRm16(&modrm, &val)
+				}
+			}
+			if err != nil {
+				core.setStackPointer(savedSP)
+				goto eof
+			}
+
+			core.logger.Tracef("[%#04x] pop r/m", core.GetCurrentlyExecutingInstructionAddress())
 		}
-	case 0x06:
+	case 0x07, 0x17, 0x1F, 0xA1, 0xA9:
 		{
-			// PUSH ES
-
-			val := core.registers.ES.base
-
-			core.registers.SP = core.registers.SP - 2
+			// POP ES/SS/DS, POP FS/GS (0x0F 0xA1 / 0x0F 0xA9)
+			dest, destName := core.pushPopSegmentRegister()
 
-			err := core.memoryAccessController.WriteAddr16(uint32(core.registers.SP), val)
+			val, err := core.popOperand()
 			if err != nil { goto eof }
 
-			log.Printf("[%#04x] push %s", core.GetCurrentlyExecutingInstructionAddress(), "ES")
+			// the selector goes through the same load path as mov sreg, so
+			// in protected mode the descriptor gets cached
+			err = core.loadSegmentRegister(dest, uint16(val))
+			if err != nil {
+				core.setStackPointer(savedSP)
+				core.raiseProtectionFault(err)
+				goto eof
+			}
+
+			core.logger.Tracef("[%#04x] pop %s", core.GetCurrentlyExecutingInstructionAddress(), destName)
 		}
 	default:
-		log.Println(fmt.Printf("Unhandled PUSH instruction:  %#04x", core.currentOpCodeBeingExecuted))
+		core.logger.Errorf("Unhandled POP instruction:  %#04x", core.currentOpCodeBeingExecuted)
 		doCoreDump(core)
 	}
 
 	eof:
-	core.registers.IP += uint16(core.currentByteAddr - core.currentByteDecodeStart)
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
 }
-
@@ -0,0 +1,49 @@
+package intel8086
+
+/*
+	Stack guard
+	A 16 bit stack wraps at 64k, so a push with SP below the operand size carries on from the top of the stack
+	segment and a pop running off the top comes back round to 0. The processor does this without complaint and so
+	does the emulator, but in guest code it almost always means the pushes and pops don't balance. With the guard
+	enabled every wrap is reported, as a warning or to a handler, and the push or pop still goes ahead. 32 bit
+	stacks aren't watched.
+*/
+
+// Called when a push or pop of size bytes wraps the stack pointer, sp is its value before the access
+type StackWrapHandler func(push bool, sp uint32, size uint32)
+
+type stackGuard struct {
+	enabled bool
+	handler StackWrapHandler
+}
+
+// Turns reporting of stack pointer wraps on or off
+func (core *CpuCore) SetStackGuard(enabled bool) {
+	core.stackGuard.enabled = enabled
+}
+
+// Reports stack pointer wraps to the handler rather than as warnings, nil goes back to warnings
+func (core *CpuCore) SetStackGuardHandler(handler StackWrapHandler) {
+	core.stackGuard.handler = handler
+}
+
+func (core *CpuCore) checkStackWrap(push bool, sp uint32, size uint32) {
+	if !core.stackGuard.enabled || core.stackIs32Bit() {
+		return
+	}
+
+	if push && sp >= size || !push && sp+size < 0x10000 {
+		return
+	}
+
+	if core.stackGuard.handler != nil {
+		core.stackGuard.handler(push, sp, size)
+		return
+	}
+
+	operation := "pop"
+	if push {
+		operation = "push"
+	}
+	core.logger.Warnf("[%#04x] %s of %d bytes wraps SP from %#04x", core.GetCurrentlyExecutingInstructionAddress(), operation, size, sp)
+}
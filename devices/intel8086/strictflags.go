@@ -0,0 +1,69 @@
+package intel8086
+
+/*
+	Strict flags
+	Many instructions leave some of the arithmetic flags undefined: AF after the logical operations, OF after a
+	shift by more than one, everything but CF after a bit test. The emulator leaves them holding whatever they held,
+	real parts don't always, so guest code which tests one is relying on behaviour that differs between processors.
+
+	With strict mode on those flags are marked undefined as each instruction leaves them, and the mark is cleared
+	when an instruction sets the flag again or FLAGS is loaded as a whole. A conditional jump, set or move, or a
+	LAHF, reading a marked flag is reported, as a warning or to a handler, and goes ahead with the value it finds.
+	Pushing FLAGS isn't reported, it's how the flags are saved and doesn't mean they're relied on.
+*/
+
+// Called when the instruction at address reads flags left undefined, flags is the mask of those read
+type UndefinedFlagsHandler func(address uint32, flags uint16)
+
+type strictFlags struct {
+	enabled bool
+	handler UndefinedFlagsHandler
+}
+
+// Turns tracking and reporting of reads of undefined flags on or off
+func (core *CpuCore) SetStrictFlags(enabled bool) {
+	core.strictFlags.enabled = enabled
+	core.registers.undefinedFlags = 0
+}
+
+// Reports reads of undefined flags to the handler rather than as warnings, nil goes back to warnings
+func (core *CpuCore) SetStrictFlagsHandler(handler UndefinedFlagsHandler) {
+	core.strictFlags.handler = handler
+}
+
+// Marks the flags in mask undefined, after the instruction has set the ones it defines
+func (core *CpuCore) undefineFlags(mask uint16) {
+	if core.strictFlags.enabled {
+		core.registers.undefinedFlags |= mask
+	}
+}
+
+// Reports the read of any flags in mask which are marked undefined
+func (core *CpuCore) checkFlagsRead(mask uint16) {
+	undefined := core.registers.undefinedFlags & mask
+	if !core.strictFlags.enabled || undefined == 0 {
+		return
+	}
+
+	if core.strictFlags.handler != nil {
+		core.strictFlags.handler(core.GetCurrentlyExecutingInstructionAddress(), undefined)
+		return
+	}
+
+	core.logger.Warnf("[%#04x] reads undefined flags %s", core.GetCurrentlyExecutingInstructionAddress(), flagNames(undefined))
+}
+
+// The names of the flags in mask, in FLAGS order
+func flagNames(mask uint16) string {
+	names := ""
+	for _, flag := range snapshotFlags {
+		if mask&flag.mask == 0 {
+			continue
+		}
+		if names != "" {
+			names += " "
+		}
+		names += flag.name
+	}
+	return names
+}
@@ -0,0 +1,360 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Hardware task switching
+	A far JMP or CALL to a TSS or task gate selector saves the current task's registers into its TSS and loads
+	the registers of the new task from the new TSS. A CALL nests the new task, linking back to the caller so
+	that IRET with NT set returns to it.
+*/
+
+const (
+	GateTypeTask = 0x5
+
+	// CR0 task switched bit
+	ControlRegisterTaskSwitched = 0x8
+)
+
+type taskSwitchSource uint8
+
+const (
+	taskSwitchJump taskSwitchSource = iota
+	taskSwitchCall
+	taskSwitchIret
+)
+
+// Register image held in a task state segment
+type taskState struct {
+	link     uint16
+	cr3      uint32
+	ip       uint32
+	flags    uint32
+	general  [8]uint32 // AX, CX, DX, BX, SP, BP, SI, DI
+	segments [6]uint16 // ES, CS, SS, DS, FS, GS
+	ldt      uint16
+}
+
+// Offsets of the register image in a 16 or 32 bit TSS
+type taskStateLayout struct {
+	width       uint32
+	minimumSize uint32
+	cr3         uint32
+	ip          uint32
+	flags       uint32
+	general     uint32
+	segments    uint32
+	ldt         uint32
+}
+
+var tss16Layout = taskStateLayout{width: 2, minimumSize: 0x2C, ip: 0x0E, flags: 0x10, general: 0x12, segments: 0x22, ldt: 0x2A}
+var tss32Layout = taskStateLayout{width: 4, minimumSize: 0x68, cr3: 0x1C, ip: 0x20, flags: 0x24, general: 0x28, segments: 0x48, ldt: 0x60}
+
+func layoutForTssType(descriptorType uint8) taskStateLayout {
+	switch descriptorType {
+	case DescriptorTypeTss16Available, DescriptorTypeTss16Busy:
+		return tss16Layout
+	}
+	return tss32Layout
+}
+
+func (core *CpuCore) readTssValue(addr uint32, width uint32) (uint32, error) {
+	if width == 2 {
+		value, err := core.memoryAccessController.ReadAddr16(addr)
+		return uint32(value), err
+	}
+	return core.memoryAccessController.ReadAddr32(addr)
+}
+
+func (core *CpuCore) writeTssValue(addr uint32, width uint32, value uint32) error {
+	if width == 2 {
+		return core.memoryAccessController.WriteAddr16(addr, uint16(value))
+	}
+	return core.memoryAccessController.WriteAddr32(addr, value)
+}
+
+func (core *CpuCore) readTaskState(base uint32, layout taskStateLayout) (taskState, error) {
+	state := taskState{}
+
+	link, err := core.memoryAccessController.ReadAddr16(base)
+	if err != nil {
+		return state, err
+	}
+	state.link = link
+
+	if layout.width == 4 {
+		state.cr3, err = core.memoryAccessController.ReadAddr32(base + layout.cr3)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	state.ip, err = core.readTssValue(base+layout.ip, layout.width)
+	if err != nil {
+		return state, err
+	}
+	state.flags, err = core.readTssValue(base+layout.flags, layout.width)
+	if err != nil {
+		return state, err
+	}
+
+	for i := range state.general {
+		state.general[i], err = core.readTssValue(base+layout.general+uint32(i)*layout.width, layout.width)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	// the 16 bit TSS has no FS and GS slots
+	segmentCount := 6
+	if layout.width == 2 {
+		segmentCount = 4
+	}
+	for i := 0; i < segmentCount; i++ {
+		state.segments[i], err = core.memoryAccessController.ReadAddr16(base + layout.segments + uint32(i)*layout.width)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	state.ldt, err = core.memoryAccessController.ReadAddr16(base + layout.ldt)
+	if err != nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+// Writes the dynamic part of the register image, the stack pointers for the inner rings, CR3 and the LDT are left alone
+func (core *CpuCore) writeTaskState(base uint32, layout taskStateLayout, state taskState) error {
+	err := core.writeTssValue(base+layout.ip, layout.width, state.ip)
+	if err != nil {
+		return err
+	}
+	err = core.writeTssValue(base+layout.flags, layout.width, state.flags)
+	if err != nil {
+		return err
+	}
+
+	for i, value := range state.general {
+		err = core.writeTssValue(base+layout.general+uint32(i)*layout.width, layout.width, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	segmentCount := 6
+	if layout.width == 2 {
+		segmentCount = 4
+	}
+	for i := 0; i < segmentCount; i++ {
+		err = core.memoryAccessController.WriteAddr16(base+layout.segments+uint32(i)*layout.width, state.segments[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Captures the current registers as a task image. The 16 and 32 bit registers are held separately, so the
+// image takes the low word from the 16 bit register and the high word from the 32 bit one.
+func (core *CpuCore) captureTaskState(ip uint16) taskState {
+	state := taskState{
+		ip:    uint32(ip),
+		flags: uint32(core.flagsImage()),
+	}
+
+	for i := range state.general {
+		state.general[i] = *core.registers.registers32Bit[i]&0xFFFF0000 | uint32(*core.registers.registers16Bit[i])
+	}
+
+	for i, segment := range core.registers.registersSegmentRegisters {
+		state.segments[i] = segment.base
+	}
+
+	return state
+}
+
+// Loads the general registers, flags and IP from a task image
+func (core *CpuCore) applyTaskState(state taskState, layout taskStateLayout) {
+	for i, value := range state.general {
+		*core.registers.registers16Bit[i] = uint16(value)
+		if layout.width == 4 {
+			*core.registers.registers32Bit[i] = value
+		}
+	}
+
+	// AL/AH through BL/BH follow AX through BX
+	for i := 0; i < 4; i++ {
+		*core.registers.registers8Bit[i] = uint8(state.general[i])
+		*core.registers.registers8Bit[i+4] = uint8(state.general[i] >> 8)
+	}
+
+	core.registers.FLAGS = uint16(state.flags)
+	core.registers.undefinedFlags = 0
+	core.registers.IP = uint16(state.ip)
+
+	if layout.width == 4 {
+		core.registers.CR3 = state.cr3
+	}
+}
+
+// Checks whether a far JMP or CALL selector references a TSS or a task gate
+func (core *CpuCore) isTaskSelector(selector uint16) bool {
+	if core.mode != common.PROTECTED_MODE || selector&0xFFFC == 0 {
+		return false
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil || descriptor.isCodeOrData() {
+		return false
+	}
+
+	return descriptor.systemType() == GateTypeTask || isTssDescriptorType(descriptor.systemType())
+}
+
+// Resolves a far JMP or CALL selector to the selector of the TSS to switch to, following a task gate
+func (core *CpuCore) resolveTaskSelector(selector uint16) (uint16, error) {
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return 0, err
+	}
+
+	cpl := core.currentPrivilegeLevel()
+	rpl := uint8(selector & 0x3)
+	if descriptor.dpl() < cpl || descriptor.dpl() < rpl {
+		return 0, selectorFault(selector)
+	}
+
+	if !descriptor.isPresent() {
+		return 0, selectorFault(selector)
+	}
+
+	if descriptor.systemType() != GateTypeTask {
+		return selector, nil
+	}
+
+	raw, err := core.readDescriptorBytes(selector)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(raw[2]) | uint16(raw[3])<<8, nil
+}
+
+// Switches to the task whose TSS is referenced by selector (or by the back link for an IRET).
+// returnIP is saved in the outgoing task so that it resumes after the instruction that switched away.
+func (core *CpuCore) taskSwitch(selector uint16, source taskSwitchSource, returnIP uint16) error {
+	var err error
+
+	if core.registers.TR.base&0xFFFC == 0 {
+		// there's no current TSS to save into
+		return common.GeneralProtectionFault{}
+	}
+
+	if source != taskSwitchIret {
+		selector, err = core.resolveTaskSelector(selector)
+		if err != nil {
+			return err
+		}
+	}
+
+	if selector&0xFFFC == 0 {
+		return common.GeneralProtectionFault{}
+	}
+
+	newDescriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return err
+	}
+
+	if newDescriptor.isCodeOrData() || !isTssDescriptorType(newDescriptor.systemType()) || !newDescriptor.isPresent() {
+		return selectorFault(selector)
+	}
+
+	// a nested task is returned to with IRET, so it must still be busy, anything else must be available
+	isBusy := newDescriptor.systemType()&DescriptorTypeBusyBit != 0
+	if isBusy != (source == taskSwitchIret) {
+		return selectorFault(selector)
+	}
+
+	newLayout := layoutForTssType(newDescriptor.systemType())
+	if newDescriptor.limit < newLayout.minimumSize-1 {
+		return selectorFault(selector)
+	}
+
+	oldSelector := core.registers.TR.base
+	oldLayout := layoutForTssType(uint8(core.registers.TR.access_information & 0x0F))
+
+	outgoing := core.captureTaskState(returnIP)
+	if source == taskSwitchIret {
+		outgoing.flags &^= NestedTaskFlag
+	}
+
+	err = core.writeTaskState(core.registers.TR.descriptorBase, oldLayout, outgoing)
+	if err != nil {
+		return err
+	}
+
+	if source != taskSwitchCall {
+		// the outgoing task is no longer nested or running
+		err = core.setTssBusy(oldSelector, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	incoming, err := core.readTaskState(newDescriptor.base, newLayout)
+	if err != nil {
+		return err
+	}
+
+	if source == taskSwitchCall {
+		err = core.memoryAccessController.WriteAddr16(newDescriptor.base, oldSelector)
+		if err != nil {
+			return err
+		}
+		incoming.flags |= NestedTaskFlag
+	}
+
+	if source != taskSwitchIret {
+		err = core.setTssBusy(selector, true)
+		if err != nil {
+			return err
+		}
+		newDescriptor.access |= DescriptorTypeBusyBit
+	}
+
+	core.cacheTaskRegister(selector, newDescriptor)
+	core.registers.CR0 |= ControlRegisterTaskSwitched
+
+	core.applyTaskState(incoming, newLayout)
+
+	// faults from here on belong to the new task, the LDT goes first as the segment selectors may reference it
+	err = core.loadLdtRegister(incoming.ldt)
+	if err != nil {
+		return err
+	}
+
+	err = core.loadCodeSegment(incoming.segments[1])
+	if err != nil {
+		return err
+	}
+
+	for i, segment := range core.registers.registersSegmentRegisters {
+		if segment == &core.registers.CS {
+			continue
+		}
+		err = core.loadSegmentRegister(segment, incoming.segments[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	core.logger.Debugf("[%#04x] task switch %#04x -> %#04x", core.GetCurrentlyExecutingInstructionAddress(), oldSelector, selector)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Time stamp counter
+	Instruction timings aren't modelled, so the cycle count advances by one for every Step, including halted ones.
+*/
+
+// CR4 time stamp disable bit, restricts RDTSC to ring 0
+const ControlRegisterTimeStampDisable = 0x4
+
+// Number of cycles the core has been stepped for since reset
+func (core *CpuCore) GetCycleCount() uint64 {
+	return core.cycles
+}
+
+func INSTR_RDTSC(core *CpuCore) {
+	core.currentByteAddr++
+
+	if !core.features.TimeStampCounter {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	if core.mode == common.PROTECTED_MODE && core.registers.CR4&ControlRegisterTimeStampDisable != 0 && core.currentPrivilegeLevel() != 0 {
+		core.raiseException(NewFaultWithErrorCode(ExceptionGeneralProtection, 0))
+		goto eof
+	}
+
+	core.registers.EDX = uint32(core.cycles >> 32)
+	core.registers.EAX = uint32(core.cycles)
+
+	core.logger.Tracef("[%#04x] rdtsc (%d)", core.GetCurrentlyExecutingInstructionAddress(), core.cycles)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -0,0 +1,142 @@
+package intel8086
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"os"
+	"strings"
+)
+
+/*
+	Instruction trace files
+	While a trace is running every instruction is written as a line of linear address, instruction bytes and the
+	disassembly the handler logs at trace level, then the effective address of its memory operand if it had one and
+	optionally the registers it changed. Everything the core logs while an instruction executes goes to the trace
+	rather than the core's logger.
+*/
+
+const traceMaxInstructionBytes = 15
+
+type instructionTrace struct {
+	file           *os.File
+	writer         *bufio.Writer
+	registerDeltas bool
+
+	capture bytes.Buffer
+	logger  *common.Logger // swapped in for the core's logger while an instruction executes
+}
+
+// Starts writing a disassembled trace of every instruction stepped to path, replacing any trace already running
+func (core *CpuCore) TraceToFile(path string) error {
+	if err := core.StopTrace(); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	trace := &instructionTrace{file: file, writer: bufio.NewWriter(file)}
+	trace.logger = common.NewLogger(common.LOG_LEVEL_TRACE)
+	trace.logger.SetOutput(&trace.capture)
+	trace.logger.SetFlags(0)
+
+	core.trace = trace
+	return nil
+}
+
+// Appends the registers each instruction changed to its trace line
+func (core *CpuCore) SetTraceRegisterDeltas(enabled bool) {
+	if core.trace != nil {
+		core.trace.registerDeltas = enabled
+	}
+}
+
+// Flushes and closes the trace file
+func (core *CpuCore) StopTrace() error {
+	trace := core.trace
+	if trace == nil {
+		return nil
+	}
+	core.trace = nil
+
+	if err := trace.writer.Flush(); err != nil {
+		trace.file.Close()
+		return err
+	}
+	return trace.file.Close()
+}
+
+func (core *CpuCore) traceRegisterDeltas(before RegisterSnapshot) string {
+	return FormatDiffs(DiffSnapshots(before, core.SnapshotRegisters()))
+}
+
+// The handler log lines with the level and address prefixes dropped
+func (trace *instructionTrace) disassembly() string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(trace.capture.String()), "\n") {
+		line = strings.TrimPrefix(line, "TRACE ")
+		if strings.HasPrefix(line, "[") {
+			if end := strings.Index(line, "] "); end >= 0 {
+				line = line[end+2:]
+			}
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "; ")
+}
+
+func (core *CpuCore) tracedStep() {
+	trace := core.trace
+	wasHalted := core.halted
+	before := core.SnapshotRegisters()
+
+	logger := core.logger
+	core.logger = trace.logger
+	trace.capture.Reset()
+
+	core.step()
+
+	core.logger = logger
+
+	if wasHalted && core.halted {
+		// nothing was fetched
+		return
+	}
+
+	hex := strings.Builder{}
+	length := core.currentByteAddr - core.currentByteDecodeStart
+	if length > traceMaxInstructionBytes {
+		length = traceMaxInstructionBytes
+	}
+	for i := uint32(0); i < length; i++ {
+		b, err := core.memoryAccessController.ReadAddr8(core.currentByteDecodeStart + i)
+		if err != nil {
+			hex.WriteString("?? ")
+			continue
+		}
+		hex.WriteString(fmt.Sprintf("%02x ", b))
+	}
+
+	var notes []string
+	if ea := core.lastEffectiveAddress; ea.Valid {
+		notes = append(notes, fmt.Sprintf("ea=%s:%04x", ea.Segment, ea.Offset))
+	}
+	if trace.registerDeltas {
+		if deltas := core.traceRegisterDeltas(before); deltas != "" {
+			notes = append(notes, deltas)
+		}
+	}
+
+	line := fmt.Sprintf("%08x  %-30s %s", core.currentByteDecodeStart, hex.String(), trace.disassembly())
+	if len(notes) > 0 {
+		line += "  ; " + strings.Join(notes, " ")
+	}
+
+	fmt.Fprintln(trace.writer, strings.TrimRight(line, " "))
+}
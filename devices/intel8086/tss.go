@@ -0,0 +1,184 @@
+package intel8086
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Task state segments
+	https://wiki.osdev.org/Task_State_Segment
+*/
+
+const (
+	DescriptorTypeTss16Available = 0x1
+	DescriptorTypeTss16Busy      = 0x3
+	DescriptorTypeTss32Available = 0x9
+	DescriptorTypeTss32Busy      = 0xB
+
+	DescriptorTypeBusyBit = 0x2
+)
+
+func isTssDescriptorType(descriptorType uint8) bool {
+	switch descriptorType {
+	case DescriptorTypeTss16Available, DescriptorTypeTss16Busy, DescriptorTypeTss32Available, DescriptorTypeTss32Busy:
+		return true
+	}
+	return false
+}
+
+// Reads the stack pointer for a privilege level from the current task state segment
+func (core *CpuCore) innerStack(privilegeLevel uint8) (ss uint16, sp uint32, err error) {
+	if core.registers.TR.base&0xFFFC == 0 {
+		// no task register loaded
+		return 0, 0, common.GeneralProtectionFault{}
+	}
+
+	var spOffset, ssOffset uint32
+	wide := false
+	switch uint8(core.registers.TR.access_information & 0x0F) {
+	case DescriptorTypeTss16Available, DescriptorTypeTss16Busy:
+		spOffset = 2 + uint32(privilegeLevel)*4
+		ssOffset = spOffset + 2
+	default:
+		// ESPn is a dword, a 16 bit stack only keeps the low word
+		spOffset = 4 + uint32(privilegeLevel)*8
+		ssOffset = spOffset + 4
+		wide = true
+	}
+
+	if ssOffset+1 > core.registers.TR.limit {
+		return 0, 0, selectorFault(core.registers.TR.base)
+	}
+
+	if wide {
+		sp, err = core.memoryAccessController.ReadAddr32(core.registers.TR.descriptorBase + spOffset)
+	} else {
+		var sp16 uint16
+		sp16, err = core.memoryAccessController.ReadAddr16(core.registers.TR.descriptorBase + spOffset)
+		sp = uint32(sp16)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	ss, err = core.memoryAccessController.ReadAddr16(core.registers.TR.descriptorBase + ssOffset)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ss, sp, nil
+}
+
+// Loads the task register from an available TSS descriptor and marks the descriptor busy
+func (core *CpuCore) loadTaskRegister(selector uint16) error {
+	if selector&0xFFFC == 0 {
+		return common.GeneralProtectionFault{}
+	}
+
+	descriptor, err := core.readSegmentDescriptor(selector)
+	if err != nil {
+		return err
+	}
+
+	if descriptor.isCodeOrData() {
+		return selectorFault(selector)
+	}
+
+	if descriptor.systemType() != DescriptorTypeTss16Available && descriptor.systemType() != DescriptorTypeTss32Available {
+		return selectorFault(selector)
+	}
+
+	if !descriptor.isPresent() {
+		return selectorFault(selector)
+	}
+
+	err = core.setTssBusy(selector, true)
+	if err != nil {
+		return err
+	}
+
+	descriptor.access |= DescriptorTypeBusyBit
+	core.cacheTaskRegister(selector, descriptor)
+
+	return nil
+}
+
+func (core *CpuCore) cacheTaskRegister(selector uint16, descriptor SegmentDescriptor) {
+	core.registers.TR.base = selector
+	core.registers.TR.descriptorBase = descriptor.base
+	core.registers.TR.limit = descriptor.limit
+	core.registers.TR.access_information = uint16(descriptor.access) | uint16(descriptor.flags)<<8
+}
+
+// Sets or clears the busy bit of the TSS descriptor in the descriptor table
+func (core *CpuCore) setTssBusy(selector uint16, busy bool) error {
+	addr, err := core.descriptorAddress(selector)
+	if err != nil {
+		return err
+	}
+
+	access, err := core.memoryAccessController.ReadAddr8(addr + 5)
+	if err != nil {
+		return err
+	}
+
+	if busy {
+		access |= DescriptorTypeBusyBit
+	} else {
+		access &^= DescriptorTypeBusyBit
+	}
+
+	return core.memoryAccessController.WriteAddr8(addr+5, access)
+}
+
+func INSTR_LTR(core *CpuCore) {
+	var selector uint16
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	selector, err = core.readSelectorOperand(&modrm)
+	if err != nil { goto eof }
+
+	err = core.loadTaskRegister(selector)
+	if err != nil {
+		if !core.raiseProtectionFault(err) {
+			core.logger.Errorf("[%#04x] ltr %#04x failed: %s", core.GetCurrentlyExecutingInstructionAddress(), selector, err.Error())
+		}
+		goto eof
+	}
+
+	core.logger.Tracef("[%#04x] ltr %#04x", core.GetCurrentlyExecutingInstructionAddress(), selector)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
+
+func INSTR_STR(core *CpuCore) {
+	var value uint16
+
+	core.currentByteAddr++
+	modrm, bytesConsumed, err := core.consumeModRm()
+	if err != nil { goto eof }
+	core.currentByteAddr += bytesConsumed
+
+	if core.mode != common.PROTECTED_MODE {
+		core.raiseException(NewFault(ExceptionInvalidOpcode))
+		goto eof
+	}
+
+	value = core.registers.TR.base
+	err = core.writeRm16(&modrm, &value)
+	if err != nil { goto eof }
+
+	core.logger.Tracef("[%#04x] str %#04x", core.GetCurrentlyExecutingInstructionAddress(), value)
+
+	eof:
+	core.advanceIP(core.currentByteAddr - core.currentByteDecodeStart)
+}
@@ -2,8 +2,8 @@ package intel82335
 
 import (
 	"fmt"
+	"github.com/andrewjc/threeatesix/common"
 	"github.com/andrewjc/threeatesix/devices/bus"
-	"log"
 	"strings"
 )
 
@@ -72,7 +72,7 @@ func (device *Intel82335) McrRegisterInitialize(registerValue uint8) {
 	device.videoReadOnly = getRegisterBit(registerValue, MCR_VIDEO_READ_ONLY)
 
 
-	log.Printf(fmt.Sprintf("MCR Set Config: %s", device.toString()))
+	common.DefaultLogger.Infof("MCR Set Config: %s", device.toString())
 }
 
 func (device *Intel82335) toString() string {
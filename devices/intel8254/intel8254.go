@@ -0,0 +1,300 @@
+package intel8254
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
+	"time"
+)
+
+/*
+	Simulated 8254 Programmable Interval Timer
+
+	Ports 0x40-0x42 are the counters for channels 0-2, port 0x43 is the control word register.
+	Counters aren't stepped by the emulator, their value is derived from the time elapsed on the
+	injected clock since the counter was loaded.
+
+	Channel 0's output is wired to IRQ0. Tick raises it when the channel has reached its terminal count since
+	the last tick: once per period in the rate generator and square wave modes, and once after loading in the
+	interrupt on terminal count and software strobe modes. Periods which pass between two ticks are coalesced
+	into one request, as the edge triggered interrupt controller would see them. A channel doesn't count until
+	its counter is first written.
+*/
+
+const (
+	PIT_INPUT_FREQUENCY = 1193182 // hz
+
+	PIT_ACCESS_LATCH  = 0
+	PIT_ACCESS_LOBYTE = 1
+	PIT_ACCESS_HIBYTE = 2
+	PIT_ACCESS_LOHI   = 3
+
+	PIT_MODE_INTERRUPT_ON_TERMINAL_COUNT = 0
+	PIT_MODE_ONE_SHOT                    = 1
+	PIT_MODE_RATE_GENERATOR              = 2
+	PIT_MODE_SQUARE_WAVE                 = 3
+	PIT_MODE_SOFTWARE_STROBE             = 4
+	PIT_MODE_HARDWARE_STROBE             = 5
+
+	PIT_TIMER_IRQ_LINE = 0
+)
+
+type pitChannel struct {
+	reload   uint16 // 0 is treated as 0x10000
+	loadedAt time.Time
+	loaded   bool
+
+	periodsSignalled uint64 // terminal counts already raised on the output since loading
+
+	accessMode    uint8
+	operatingMode uint8
+	bcd           bool
+
+	latched    bool
+	latchValue uint16
+
+	readHighByteNext  bool
+	writeHighByteNext bool
+	pendingLowByte    uint8
+}
+
+type Intel8254 struct {
+	bus   *bus.Bus
+	busId uint32
+
+	clock common.Clock
+
+	channels [3]pitChannel
+
+	speaker speaker // driven by channel 2, see speaker.go
+}
+
+func NewIntel8254(clock common.Clock) *Intel8254 {
+	chip := &Intel8254{clock: clock}
+
+	now := clock.Now()
+	for i := range chip.channels {
+		chip.channels[i].accessMode = PIT_ACCESS_LOHI
+		chip.channels[i].loadedAt = now
+	}
+
+	return chip
+}
+
+func (device *Intel8254) SetDeviceBusId(id uint32) {
+	device.busId = id
+}
+
+func (device *Intel8254) OnReceiveMessage(message bus.BusMessage) {
+
+}
+
+func (device *Intel8254) GetBus() *bus.Bus {
+	return device.bus
+}
+
+func (device *Intel8254) SetBus(bus *bus.Bus) {
+	device.bus = bus
+}
+
+func (device *Intel8254) SetClock(clock common.Clock) {
+	device.clock = clock
+}
+
+// Port 0x43
+func (device *Intel8254) WriteControlWord(value uint8) {
+	channelIndex := value >> 6
+	if channelIndex == 3 {
+		// read-back command is 8254 only, not supported yet
+		common.DefaultLogger.Warnf("PIT read-back command not supported: [%#04x]", value)
+		return
+	}
+
+	channel := &device.channels[channelIndex]
+	accessMode := (value >> 4) & 0x3
+
+	if accessMode == PIT_ACCESS_LATCH {
+		if !channel.latched {
+			channel.latched = true
+			channel.latchValue = device.currentCount(channel)
+		}
+		return
+	}
+
+	channel.accessMode = accessMode
+	channel.operatingMode = (value >> 1) & 0x7
+	if channel.operatingMode > 5 {
+		// modes 6 and 7 alias modes 2 and 3
+		channel.operatingMode -= 4
+	}
+	channel.bcd = value&0x1 != 0
+	channel.loaded = false // counting stops until the new count is written
+	channel.latched = false
+	channel.readHighByteNext = false
+	channel.writeHighByteNext = false
+
+	if channelIndex == PIT_SPEAKER_CHANNEL {
+		device.updateSpeaker()
+	}
+}
+
+// Ports 0x40-0x42
+func (device *Intel8254) WriteCounter(channelIndex uint8, value uint8) {
+	channelIndex %= 3
+	channel := &device.channels[channelIndex]
+
+	switch channel.accessMode {
+	case PIT_ACCESS_LOBYTE:
+		device.loadCounter(channel, uint16(value))
+	case PIT_ACCESS_HIBYTE:
+		device.loadCounter(channel, uint16(value)<<8)
+	case PIT_ACCESS_LOHI:
+		if !channel.writeHighByteNext {
+			channel.pendingLowByte = value
+			channel.writeHighByteNext = true
+			return
+		}
+		channel.writeHighByteNext = false
+		device.loadCounter(channel, uint16(value)<<8|uint16(channel.pendingLowByte))
+	}
+
+	if channelIndex == PIT_SPEAKER_CHANNEL {
+		device.updateSpeaker()
+	}
+}
+
+// Ports 0x40-0x42
+func (device *Intel8254) ReadCounter(channelIndex uint8) uint8 {
+	channel := &device.channels[channelIndex%3]
+
+	count := channel.latchValue
+	if !channel.latched {
+		count = device.currentCount(channel)
+	}
+
+	var value uint8
+	switch channel.accessMode {
+	case PIT_ACCESS_LOBYTE:
+		value = uint8(count)
+		channel.latched = false
+	case PIT_ACCESS_HIBYTE:
+		value = uint8(count >> 8)
+		channel.latched = false
+	default:
+		if !channel.readHighByteNext {
+			value = uint8(count)
+			channel.readHighByteNext = true
+		} else {
+			value = uint8(count >> 8)
+			channel.readHighByteNext = false
+			channel.latched = false
+		}
+	}
+
+	return value
+}
+
+func (device *Intel8254) loadCounter(channel *pitChannel, reload uint16) {
+	channel.reload = reload
+	channel.loadedAt = device.clock.Now()
+	channel.loaded = true
+	channel.periodsSignalled = 0
+}
+
+// Raises IRQ0 if channel 0 has reached its terminal count since the last tick
+func (device *Intel8254) Tick() {
+	if device.outputFired(&device.channels[0]) && device.bus != nil {
+		device.bus.FindSingleDevice(common.MODULE_MASTER_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a).RaiseIrq(PIT_TIMER_IRQ_LINE)
+	}
+}
+
+// Reports whether the channel's output has fired since it was last asked
+func (device *Intel8254) outputFired(channel *pitChannel) bool {
+	if !channel.loaded {
+		return false
+	}
+
+	reload := uint64(channel.reload)
+	if reload == 0 {
+		reload = 0x10000
+	}
+	periods := device.elapsedTicks(channel) / reload
+
+	switch channel.operatingMode {
+	case PIT_MODE_RATE_GENERATOR, PIT_MODE_SQUARE_WAVE:
+	case PIT_MODE_INTERRUPT_ON_TERMINAL_COUNT, PIT_MODE_SOFTWARE_STROBE:
+		if periods > 1 {
+			periods = 1
+		}
+	default:
+		// the hardware triggered modes need a gate input, which isn't wired
+		return false
+	}
+
+	if periods <= channel.periodsSignalled {
+		return false
+	}
+	channel.periodsSignalled = periods
+	return true
+}
+
+// The channel's period in input clock ticks, a reload value of 0 counting 0x10000
+func reloadTicks(channel *pitChannel) uint64 {
+	if channel.reload == 0 {
+		return 0x10000
+	}
+	return uint64(channel.reload)
+}
+
+// The level of the channel's output
+func (device *Intel8254) outputHigh(channel *pitChannel) bool {
+	if !channel.loaded {
+		// writing the control word sets the output low in mode 0 and high in the others
+		return channel.operatingMode != PIT_MODE_INTERRUPT_ON_TERMINAL_COUNT
+	}
+
+	reload := reloadTicks(channel)
+	ticks := device.elapsedTicks(channel)
+
+	switch channel.operatingMode {
+	case PIT_MODE_INTERRUPT_ON_TERMINAL_COUNT:
+		return ticks >= reload
+	case PIT_MODE_RATE_GENERATOR:
+		// low for the one tick before the reload
+		return ticks%reload != reload-1
+	case PIT_MODE_SQUARE_WAVE:
+		// high for the first half of the period, the longer half with an odd reload value
+		return ticks%reload < (reload+1)/2
+	default:
+		return true
+	}
+}
+
+// Number of input clock ticks since the channel was last loaded
+func (device *Intel8254) elapsedTicks(channel *pitChannel) uint64 {
+	elapsed := device.clock.Now().Sub(channel.loadedAt)
+	if elapsed < 0 {
+		return 0
+	}
+	seconds := uint64(elapsed / time.Second)
+	remainder := uint64(elapsed % time.Second)
+	return seconds*PIT_INPUT_FREQUENCY + remainder*PIT_INPUT_FREQUENCY/uint64(time.Second)
+}
+
+func (device *Intel8254) currentCount(channel *pitChannel) uint16 {
+	reload := uint64(channel.reload)
+	if reload == 0 {
+		reload = 0x10000
+	}
+
+	ticks := device.elapsedTicks(channel)
+
+	switch channel.operatingMode {
+	case PIT_MODE_RATE_GENERATOR, PIT_MODE_SQUARE_WAVE:
+		// periodic modes reload when the count reaches zero
+		return uint16(reload - ticks%reload)
+	default:
+		// one shot modes keep counting down and wrap
+		return uint16(reload - ticks%0x10000)
+	}
+}
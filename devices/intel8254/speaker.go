@@ -0,0 +1,74 @@
+package intel8254
+
+/*
+	PC speaker
+	The speaker is driven by PIT channel 2 through port 0x61, the system control port. Bit 0 is channel 2's gate
+	and bit 1 connects the channel's output to the speaker, with both set and the channel in the rate generator
+	or square wave mode the speaker sounds at the input frequency divided by the channel's reload value. Reading
+	the port gives back the two control bits along with the level of channel 2's output in bit 5.
+
+	No audio is produced. A handler can be set to be told the frequency each time the tone changes, 0 being
+	silence. The gate only decides whether the speaker sounds, channel 2 keeps counting with it low.
+*/
+
+const (
+	SPEAKER_CONTROL_PORT = 0x61
+
+	SPEAKER_TIMER_GATE   = 0x01
+	SPEAKER_DATA_ENABLE  = 0x02
+	SPEAKER_TIMER_OUTPUT = 0x20 // read only
+
+	PIT_SPEAKER_CHANNEL = 2
+)
+
+// Called when the speaker's tone changes, frequency is in hz and 0 when the speaker is silent
+type SpeakerHandler func(frequency float64)
+
+type speaker struct {
+	control   uint8
+	frequency float64
+	handler   SpeakerHandler
+}
+
+func (device *Intel8254) SetSpeakerHandler(handler SpeakerHandler) {
+	device.speaker.handler = handler
+}
+
+// The frequency the speaker is sounding at in hz, 0 when it is silent
+func (device *Intel8254) GetSpeakerFrequency() float64 {
+	return device.speaker.frequency
+}
+
+// Port 0x61
+func (device *Intel8254) WriteSpeakerControl(value uint8) {
+	device.speaker.control = value & (SPEAKER_TIMER_GATE | SPEAKER_DATA_ENABLE)
+	device.updateSpeaker()
+}
+
+// Port 0x61
+func (device *Intel8254) ReadSpeakerControl() uint8 {
+	value := device.speaker.control
+	if device.outputHigh(&device.channels[PIT_SPEAKER_CHANNEL]) {
+		value |= SPEAKER_TIMER_OUTPUT
+	}
+	return value
+}
+
+// Works out the tone from the port and channel 2, telling the handler if it has changed
+func (device *Intel8254) updateSpeaker() {
+	frequency := 0.0
+
+	channel := &device.channels[PIT_SPEAKER_CHANNEL]
+	periodic := channel.operatingMode == PIT_MODE_RATE_GENERATOR || channel.operatingMode == PIT_MODE_SQUARE_WAVE
+	if device.speaker.control == SPEAKER_TIMER_GATE|SPEAKER_DATA_ENABLE && channel.loaded && periodic {
+		frequency = PIT_INPUT_FREQUENCY / float64(reloadTicks(channel))
+	}
+
+	if frequency == device.speaker.frequency {
+		return
+	}
+	device.speaker.frequency = frequency
+	if device.speaker.handler != nil {
+		device.speaker.handler(frequency)
+	}
+}
@@ -1,27 +1,236 @@
 package intel8259a
 
-import "github.com/andrewjc/threeatesix/devices/bus"
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+)
 
 /*
 	Simulated 8259A Interrupt Controller Chip
 
 	IRQ0 through IRQ7 are the master 8259's interrupt lines, while IRQ8 through IRQ15 are the slave 8259's interrupt lines.
+	The slave is cascaded through IRQ2 on the master.
+
+	Only the fixed priority, edge triggered configuration used by the PC/AT is modelled.
 */
 
+const (
+	ICW1_IC4         = 0x01 // ICW4 will be sent
+	ICW1_SINGLE      = 0x02 // single controller, no ICW3
+	ICW1_INITIALIZE  = 0x10
+	ICW4_AUTO_EOI    = 0x02
+	OCW2_EOI         = 0x20
+	OCW2_SPECIFIC    = 0x40
+	OCW3_SELECT      = 0x08
+	OCW3_READ_ISR    = 0x03
+	OCW3_READ_IRR    = 0x02
+	CASCADE_IRQ_LINE = 2
+)
+
 type Intel8259a struct {
 	busId uint32
+
+	slave *Intel8259a // set on the master when a slave is cascaded
+
+	interruptRequestRegister uint8
+	inServiceRegister        uint8
+	interruptMaskRegister    uint8
+
+	vectorBase uint8
+	autoEoi    bool
+	readIsr    bool // OCW3 selects whether the command port reads the ISR or IRR
+
+	// initialization sequence state, 0 when not initializing
+	expectedIcw   uint8
+	icw4Requested bool
+	singleMode    bool
 }
 
 func NewIntel8259a() *Intel8259a {
 	chip := &Intel8259a{}
-
+	chip.Reset()
 	return chip
 }
 
+// Returns to the power on state, keeping the cascade wiring
+func (device *Intel8259a) Reset() {
+	slave := device.slave
+	*device = Intel8259a{busId: device.busId, slave: slave}
+
+	// all lines masked until the bios programs the controller
+	device.interruptMaskRegister = 0xFF
+}
+
 func (device *Intel8259a) SetDeviceBusId(id uint32) {
 	device.busId = id
 }
 
 func (device *Intel8259a) OnReceiveMessage(message bus.BusMessage) {
+	if message.Subject == common.MESSAGE_GLOBAL_RESET {
+		device.Reset()
+	}
+}
+
+// Cascades the slave controller through IRQ2 of this controller
+func (device *Intel8259a) ConnectSlave(slave *Intel8259a) {
+	device.slave = slave
+}
+
+func (device *Intel8259a) GetVectorBase() uint8 {
+	return device.vectorBase
+}
+
+func (device *Intel8259a) GetInterruptMaskRegister() uint8 {
+	return device.interruptMaskRegister
+}
+
+func (device *Intel8259a) GetInServiceRegister() uint8 {
+	return device.inServiceRegister
+}
+
+// Latches an interrupt request on one of this controller's lines (0-7)
+func (device *Intel8259a) RaiseIrq(line uint8) {
+	device.interruptRequestRegister |= 1 << (line & 0x7)
+}
 
-}
\ No newline at end of file
+func (device *Intel8259a) LowerIrq(line uint8) {
+	device.interruptRequestRegister &^= 1 << (line & 0x7)
+}
+
+// Requests that have arrived and aren't masked, including the cascade line when the slave has one pending
+func (device *Intel8259a) pendingRequests() uint8 {
+	requests := device.interruptRequestRegister
+	if device.slave != nil && device.slave.HasPendingInterrupt() {
+		requests |= 1 << CASCADE_IRQ_LINE
+	}
+	return requests &^ device.interruptMaskRegister
+}
+
+// Returns the highest priority pending line which isn't blocked by an interrupt already in service
+func (device *Intel8259a) highestPriorityRequest() (uint8, bool) {
+	requests := device.pendingRequests()
+	for line := uint8(0); line < 8; line++ {
+		if device.inServiceRegister&(1<<line) != 0 {
+			// equal or lower priority requests wait for the EOI
+			return 0, false
+		}
+		if requests&(1<<line) != 0 {
+			return line, true
+		}
+	}
+	return 0, false
+}
+
+func (device *Intel8259a) HasPendingInterrupt() bool {
+	_, ok := device.highestPriorityRequest()
+	return ok
+}
+
+// Interrupt acknowledge cycle, returns the vector number to dispatch
+func (device *Intel8259a) AcknowledgeInterrupt() uint8 {
+	line, ok := device.highestPriorityRequest()
+	if !ok {
+		// spurious interrupt, reported on the lowest priority line
+		return device.vectorBase | 7
+	}
+
+	if !device.autoEoi {
+		device.inServiceRegister |= 1 << line
+	}
+
+	if line == CASCADE_IRQ_LINE && device.slave != nil && device.slave.HasPendingInterrupt() {
+		return device.slave.AcknowledgeInterrupt()
+	}
+
+	device.interruptRequestRegister &^= 1 << line
+
+	return device.vectorBase | line
+}
+
+// Port 0x20 / 0xA0
+func (device *Intel8259a) WriteCommandRegister(value uint8) {
+	if value&ICW1_INITIALIZE != 0 {
+		device.interruptMaskRegister = 0
+		device.inServiceRegister = 0
+		device.interruptRequestRegister = 0
+		device.autoEoi = false
+		device.readIsr = false
+		device.icw4Requested = value&ICW1_IC4 != 0
+		device.singleMode = value&ICW1_SINGLE != 0
+		device.expectedIcw = 2
+		return
+	}
+
+	if value&OCW3_SELECT != 0 {
+		// OCW3
+		switch value & 0x3 {
+		case OCW3_READ_IRR:
+			device.readIsr = false
+		case OCW3_READ_ISR:
+			device.readIsr = true
+		}
+		return
+	}
+
+	// OCW2
+	if value&OCW2_EOI != 0 {
+		if value&OCW2_SPECIFIC != 0 {
+			device.inServiceRegister &^= 1 << (value & 0x7)
+		} else {
+			device.endOfInterrupt()
+		}
+		return
+	}
+
+	common.DefaultLogger.Warnf("PIC unhandled OCW2: [%#04x]", value)
+}
+
+// Non specific EOI clears the highest priority interrupt in service
+func (device *Intel8259a) endOfInterrupt() {
+	for line := uint8(0); line < 8; line++ {
+		if device.inServiceRegister&(1<<line) != 0 {
+			device.inServiceRegister &^= 1 << line
+			return
+		}
+	}
+}
+
+// Port 0x21 / 0xA1
+func (device *Intel8259a) WriteDataRegister(value uint8) {
+	switch device.expectedIcw {
+	case 2:
+		device.vectorBase = value & 0xF8
+		device.expectedIcw = 3
+		if device.singleMode {
+			device.expectedIcw = 4
+		}
+		if device.expectedIcw == 4 && !device.icw4Requested {
+			device.expectedIcw = 0
+		}
+	case 3:
+		// cascade wiring is fixed by ConnectSlave
+		device.expectedIcw = 0
+		if device.icw4Requested {
+			device.expectedIcw = 4
+		}
+	case 4:
+		device.autoEoi = value&ICW4_AUTO_EOI != 0
+		device.expectedIcw = 0
+	default:
+		// OCW1
+		device.interruptMaskRegister = value
+	}
+}
+
+// Port 0x20 / 0xA0
+func (device *Intel8259a) ReadCommandRegister() uint8 {
+	if device.readIsr {
+		return device.inServiceRegister
+	}
+	return device.interruptRequestRegister
+}
+
+// Port 0x21 / 0xA1
+func (device *Intel8259a) ReadDataRegister() uint8 {
+	return device.interruptMaskRegister
+}
@@ -3,9 +3,11 @@ package io
 import (
 	"github.com/andrewjc/threeatesix/common"
 	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/intel8254"
 	"github.com/andrewjc/threeatesix/devices/intel82335"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
+	"github.com/andrewjc/threeatesix/devices/mc146818"
 	"github.com/andrewjc/threeatesix/devices/ps2"
-	"log"
 )
 
 /*
@@ -18,6 +20,30 @@ type IOPortAccessController struct {
 	bus                   *bus.Bus
 	busId                 uint32
 	highIntegrationInterfaceDevice *intel82335.Intel82335
+
+	portDevices []portDeviceRange // attached with AttachPortDevice, checked before the built in ports
+
+	pollWatch pollWatch // see pollwatch.go
+}
+
+// A device decoding a range of io ports. Word accesses are passed through as a single 16 bit access.
+type PortDevice interface {
+	ReadPort8(port uint16) uint8
+	WritePort8(port uint16, value uint8)
+	ReadPort16(port uint16) uint16
+	WritePort16(port uint16, value uint16)
+}
+
+// Implemented by devices that decode dword accesses themselves, others see them as two word accesses
+type PortDevice32 interface {
+	ReadPort32(port uint16) uint32
+	WritePort32(port uint16, value uint32)
+}
+
+type portDeviceRange struct {
+	first  uint16
+	last   uint16
+	device PortDevice
 }
 
 
@@ -29,31 +55,102 @@ func (mem *IOPortAccessController) OnReceiveMessage(message bus.BusMessage) {
 
 }
 
+// Maps ports first-last (inclusive) to the device, replacing any device already attached to them
+func (r *IOPortAccessController) AttachPortDevice(first uint16, last uint16, device PortDevice) {
+	r.DetachPortDevice(first, last)
+	r.portDevices = append(r.portDevices, portDeviceRange{first, last, device})
+}
+
+// Removes the devices attached to any port in first-last
+func (r *IOPortAccessController) DetachPortDevice(first uint16, last uint16) {
+	var devices []portDeviceRange
+	for _, attached := range r.portDevices {
+		if attached.last < first || attached.first > last {
+			devices = append(devices, attached)
+		}
+	}
+	r.portDevices = devices
+}
+
+func (r *IOPortAccessController) portDevice(addr uint16) PortDevice {
+	for _, attached := range r.portDevices {
+		if addr >= attached.first && addr <= attached.last {
+			return attached.device
+		}
+	}
+	return nil
+}
+
 func (r *IOPortAccessController) ReadAddr8(addr uint16) uint8 {
+	value := r.readAddr8(addr)
+	r.pollWatch.read(addr, uint32(value))
+	return value
+}
+
+func (r *IOPortAccessController) readAddr8(addr uint16) uint8 {
 	var byteData uint8
 
+	if device := r.portDevice(addr); device != nil {
+		return device.ReadPort8(addr)
+	}
+
 	if addr == 0x64 {
 		// Status Register READ
 		sr := r.GetBus().FindSingleDevice(common.MODULE_PS2_CONTROLLER).(*ps2.Ps2Controller).ReadStatusRegister()
-		log.Printf("PS2 Controller status read: %v", sr)
+		common.DefaultLogger.Debugf("PS2 Controller status read: %v", sr)
 		return sr
 	}
 
+	if addr == 0x60 {
+		// PS2 data port
+		return r.GetBus().FindSingleDevice(common.MODULE_PS2_CONTROLLER).(*ps2.Ps2Controller).ReadDataRegister()
+	}
+
 	if addr == 0x0022 {
 		// MCR register setup
 		return r.highIntegrationInterfaceDevice.GetMcrRegister()
 	}
 
+	if addr == 0x20 || addr == 0x21 || addr == 0xA0 || addr == 0xA1 {
+		// Interrupt controllers
+		pic := r.interruptController(addr)
+		if addr&1 == 0 {
+			return pic.ReadCommandRegister()
+		}
+		return pic.ReadDataRegister()
+	}
+
+	if addr >= 0x40 && addr <= 0x42 {
+		// PIT counters
+		return r.GetBus().FindSingleDevice(common.MODULE_PROGRAMMABLE_INTERVAL_TIMER).(*intel8254.Intel8254).ReadCounter(uint8(addr - 0x40))
+	}
+
+	if addr == intel8254.SPEAKER_CONTROL_PORT {
+		// PIT channel 2 gate and speaker
+		return r.GetBus().FindSingleDevice(common.MODULE_PROGRAMMABLE_INTERVAL_TIMER).(*intel8254.Intel8254).ReadSpeakerControl()
+	}
+
+	if addr == 0x71 {
+		// RTC/CMOS data register
+		return r.GetBus().FindSingleDevice(common.MODULE_REAL_TIME_CLOCK).(*mc146818.Mc146818).ReadDataRegister()
+	}
+
 	byteData = (r.backingMemory)[addr]
 
 	return byteData
 }
 
 func (r *IOPortAccessController) WriteAddr8(addr uint16, value uint8) {
+	r.pollWatch.reset()
+
+	if device := r.portDevice(addr); device != nil {
+		device.WritePort8(addr, value)
+		return
+	}
 
 	if addr == 0x00F1 {
 		// 80287 math coprocessor
-		r.GetBus().SendMessageSingle(common.MODULE_MATH_CO_PROCESSOR, bus.BusMessage{common.MESSAGE_REQUEST_CPU_MODESWITCH, []byte{common.REAL_MODE}})
+		r.GetBus().SendMessageSingle(common.MODULE_MATH_CO_PROCESSOR, bus.BusMessage{Subject: common.MESSAGE_REQUEST_CPU_MODESWITCH, Data: []byte{common.REAL_MODE}, Sender: r.busId})
 		return
 	}
 
@@ -63,9 +160,50 @@ func (r *IOPortAccessController) WriteAddr8(addr uint16, value uint8) {
 		return
 	}
 
+	if addr == 0x20 || addr == 0x21 || addr == 0xA0 || addr == 0xA1 {
+		// Interrupt controllers
+		pic := r.interruptController(addr)
+		if addr&1 == 0 {
+			pic.WriteCommandRegister(value)
+		} else {
+			pic.WriteDataRegister(value)
+		}
+		return
+	}
+
+	if addr >= 0x40 && addr <= 0x42 {
+		// PIT counters
+		r.GetBus().FindSingleDevice(common.MODULE_PROGRAMMABLE_INTERVAL_TIMER).(*intel8254.Intel8254).WriteCounter(uint8(addr-0x40), value)
+		return
+	}
+
+	if addr == 0x43 {
+		// PIT control word
+		r.GetBus().FindSingleDevice(common.MODULE_PROGRAMMABLE_INTERVAL_TIMER).(*intel8254.Intel8254).WriteControlWord(value)
+		return
+	}
+
+	if addr == intel8254.SPEAKER_CONTROL_PORT {
+		// PIT channel 2 gate and speaker
+		r.GetBus().FindSingleDevice(common.MODULE_PROGRAMMABLE_INTERVAL_TIMER).(*intel8254.Intel8254).WriteSpeakerControl(value)
+		return
+	}
+
+	if addr == 0x70 {
+		// RTC/CMOS register select
+		r.GetBus().FindSingleDevice(common.MODULE_REAL_TIME_CLOCK).(*mc146818.Mc146818).WriteIndexRegister(value)
+		return
+	}
+
+	if addr == 0x71 {
+		// RTC/CMOS data register
+		r.GetBus().FindSingleDevice(common.MODULE_REAL_TIME_CLOCK).(*mc146818.Mc146818).WriteDataRegister(value)
+		return
+	}
+
 	if addr == 0x80 {
 		// bios post diag
-		log.Printf("BIOS POST: %v - %s", value, common.BiosPostCodeToString(value))
+		common.DefaultLogger.Infof("BIOS POST: %v - %s", value, common.BiosPostCodeToString(value))
 		return
 	}
 
@@ -74,27 +212,69 @@ func (r *IOPortAccessController) WriteAddr8(addr uint16, value uint8) {
 		r.highIntegrationInterfaceDevice.McrRegisterInitialize(value)
 	}
 
-	/*if addr == 0x0A0 {
-		// Interrupt controller 1
+	r.backingMemory[addr] = value
+}
 
-		return
+// Ports 0x20/0x21 belong to the master controller, 0xA0/0xA1 to the slave
+func (r *IOPortAccessController) interruptController(addr uint16) *intel8259a.Intel8259a {
+	if addr >= 0xA0 {
+		return r.GetBus().FindSingleDevice(common.MODULE_SLAVE_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a)
 	}
-
-	if addr == 0x0A1 {
-		// Interrupt controller 2
-	}*/
-
-	r.backingMemory[addr] = value
+	return r.GetBus().FindSingleDevice(common.MODULE_MASTER_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a)
 }
 
 func (r *IOPortAccessController) ReadAddr16(addr uint16) uint16 {
-	b1 := uint16(r.ReadAddr8(addr))
-	b2 := uint16(r.ReadAddr8(addr + 1))
+	value := r.readAddr16(addr)
+	r.pollWatch.read(addr, uint32(value))
+	return value
+}
+
+func (r *IOPortAccessController) readAddr16(addr uint16) uint16 {
+	if device := r.portDevice(addr); device != nil {
+		return device.ReadPort16(addr)
+	}
+
+	b1 := uint16(r.readAddr8(addr))
+	b2 := uint16(r.readAddr8(addr + 1))
 	return b2<<8 | b1
 }
 
 func (r *IOPortAccessController) WriteAddr16(addr uint16, value uint16) {
+	r.pollWatch.reset()
+	if device := r.portDevice(addr); device != nil {
+		device.WritePort16(addr, value)
+		return
+	}
+
+	r.WriteAddr8(addr, uint8(value))
+	r.WriteAddr8(addr+1, uint8(value>>8))
+}
+
+func (r *IOPortAccessController) ReadAddr32(addr uint16) uint32 {
+	value := r.readAddr32(addr)
+	r.pollWatch.read(addr, value)
+	return value
+}
+
+func (r *IOPortAccessController) readAddr32(addr uint16) uint32 {
+	if device, ok := r.portDevice(addr).(PortDevice32); ok {
+		return device.ReadPort32(addr)
+	}
+
+	w1 := uint32(r.readAddr16(addr))
+	w2 := uint32(r.readAddr16(addr + 2))
+	return w2<<16 | w1
+}
+
+func (r *IOPortAccessController) WriteAddr32(addr uint16, value uint32) {
+	r.pollWatch.reset()
+	if device, ok := r.portDevice(addr).(PortDevice32); ok {
+		device.WritePort32(addr, value)
+		return
+	}
 
+	r.WriteAddr16(addr, uint16(value))
+	r.WriteAddr16(addr+2, uint16(value>>16))
 }
 
 func (controller *IOPortAccessController) GetBus() *bus.Bus {
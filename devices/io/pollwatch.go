@@ -0,0 +1,58 @@
+package io
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+)
+
+/*
+	Port poll watch
+	A bios waiting on a status bit that an emulated device never sets just spins on an IN, which looks like a hang.
+	With the watch enabled, reading the same port over and over and getting the same value back is reported once it
+	has happened threshold times in a row. Reading a different port, getting a different value, or any port write
+	ends the run. This is only a diagnostic, the read itself goes ahead as normal.
+*/
+
+// Called when a run of identical reads from port reaches the threshold
+type PollWatchHandler func(port uint16, value uint32, reads int)
+
+type pollWatch struct {
+	threshold int // 0 when disabled
+	handler   PollWatchHandler
+
+	port  uint16
+	value uint32
+	reads int
+}
+
+// Reports runs of threshold identical reads from one port to the handler, a nil handler logs a warning instead.
+// A threshold of 0 turns the watch off.
+func (r *IOPortAccessController) SetPollWatch(threshold int, handler PollWatchHandler) {
+	r.pollWatch = pollWatch{threshold: threshold, handler: handler}
+}
+
+func (watch *pollWatch) read(port uint16, value uint32) {
+	if watch.threshold == 0 {
+		return
+	}
+
+	if watch.reads == 0 || port != watch.port || value != watch.value {
+		watch.port = port
+		watch.value = value
+		watch.reads = 0
+	}
+	watch.reads++
+
+	if watch.reads != watch.threshold {
+		return
+	}
+
+	if watch.handler != nil {
+		watch.handler(port, value, watch.reads)
+		return
+	}
+	common.DefaultLogger.Warnf("Port %#04x read %d times in a row returning %#x, is a device not responding?", port, watch.reads, value)
+}
+
+func (watch *pollWatch) reset() {
+	watch.reads = 0
+}
@@ -0,0 +1,166 @@
+package mc146818
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+)
+
+/*
+	Simulated MC146818 Real Time Clock and CMOS RAM
+
+	Port 0x70 selects the register (bit 7 disables NMI), port 0x71 reads/writes the selected register.
+	The time registers are read from the injected clock rather than counted by the device.
+*/
+
+const (
+	RTC_SECONDS      = 0x00
+	RTC_MINUTES      = 0x02
+	RTC_HOURS        = 0x04
+	RTC_DAY_OF_WEEK  = 0x06
+	RTC_DAY_OF_MONTH = 0x07
+	RTC_MONTH        = 0x08
+	RTC_YEAR         = 0x09
+	RTC_STATUS_A     = 0x0A
+	RTC_STATUS_B     = 0x0B
+	RTC_STATUS_C     = 0x0C
+	RTC_STATUS_D     = 0x0D
+	RTC_CENTURY      = 0x32
+
+	RTC_STATUS_B_24_HOUR     = 0x02
+	RTC_STATUS_B_BINARY_MODE = 0x04
+
+	RTC_STATUS_D_VALID_RAM = 0x80
+
+	CMOS_RAM_SIZE = 128
+)
+
+type Mc146818 struct {
+	bus   *bus.Bus
+	busId uint32
+
+	clock common.Clock
+
+	selectedRegister uint8
+	nmiDisabled      bool
+
+	ram [CMOS_RAM_SIZE]uint8
+}
+
+func NewMc146818(clock common.Clock) *Mc146818 {
+	chip := &Mc146818{clock: clock}
+
+	chip.ram[RTC_STATUS_A] = 0x26 // 32.768khz time base, 1024hz periodic rate
+	chip.ram[RTC_STATUS_B] = RTC_STATUS_B_24_HOUR
+	chip.ram[RTC_STATUS_D] = RTC_STATUS_D_VALID_RAM
+
+	return chip
+}
+
+func (device *Mc146818) SetDeviceBusId(id uint32) {
+	device.busId = id
+}
+
+func (device *Mc146818) OnReceiveMessage(message bus.BusMessage) {
+
+}
+
+func (device *Mc146818) GetBus() *bus.Bus {
+	return device.bus
+}
+
+func (device *Mc146818) SetBus(bus *bus.Bus) {
+	device.bus = bus
+}
+
+func (device *Mc146818) SetClock(clock common.Clock) {
+	device.clock = clock
+}
+
+// Port 0x70
+func (device *Mc146818) WriteIndexRegister(value uint8) {
+	device.nmiDisabled = value&0x80 != 0
+	device.selectedRegister = value & 0x7F
+}
+
+func (device *Mc146818) IsNmiDisabled() bool {
+	return device.nmiDisabled
+}
+
+// Port 0x71
+func (device *Mc146818) ReadDataRegister() uint8 {
+	return device.ReadRegister(device.selectedRegister)
+}
+
+// Port 0x71
+func (device *Mc146818) WriteDataRegister(value uint8) {
+	device.WriteRegister(device.selectedRegister, value)
+}
+
+func (device *Mc146818) ReadRegister(index uint8) uint8 {
+	index &= CMOS_RAM_SIZE - 1
+
+	now := device.clock.Now()
+
+	switch index {
+	case RTC_SECONDS:
+		return device.encode(uint8(now.Second()))
+	case RTC_MINUTES:
+		return device.encode(uint8(now.Minute()))
+	case RTC_HOURS:
+		return device.encodeHour(uint8(now.Hour()))
+	case RTC_DAY_OF_WEEK:
+		return device.encode(uint8(now.Weekday()) + 1)
+	case RTC_DAY_OF_MONTH:
+		return device.encode(uint8(now.Day()))
+	case RTC_MONTH:
+		return device.encode(uint8(now.Month()))
+	case RTC_YEAR:
+		return device.encode(uint8(now.Year() % 100))
+	case RTC_CENTURY:
+		return device.encode(uint8(now.Year() / 100))
+	case RTC_STATUS_C:
+		// reading status C acknowledges any pending interrupt
+		value := device.ram[RTC_STATUS_C]
+		device.ram[RTC_STATUS_C] = 0
+		return value
+	}
+
+	return device.ram[index]
+}
+
+func (device *Mc146818) WriteRegister(index uint8, value uint8) {
+	index &= CMOS_RAM_SIZE - 1
+
+	switch index {
+	case RTC_STATUS_C, RTC_STATUS_D:
+		// read only
+		return
+	}
+
+	device.ram[index] = value
+}
+
+func (device *Mc146818) encodeHour(hour uint8) uint8 {
+	if device.ram[RTC_STATUS_B]&RTC_STATUS_B_24_HOUR != 0 {
+		return device.encode(hour)
+	}
+
+	pm := hour >= 12
+	hour %= 12
+	if hour == 0 {
+		hour = 12
+	}
+
+	value := device.encode(hour)
+	if pm {
+		value |= 0x80
+	}
+	return value
+}
+
+func (device *Mc146818) encode(value uint8) uint8 {
+	if device.ram[RTC_STATUS_B]&RTC_STATUS_B_BINARY_MODE != 0 {
+		return value
+	}
+	return (value/10)<<4 | value%10
+}
@@ -0,0 +1,32 @@
+package memmap
+
+/*
+	A20 gate
+	With the gate disabled address line 20 is held low, so addresses from 1MB wrap back onto the first megabyte
+	as they did on the 8086. The gate starts out enabled, the machine has no bios image of its own that expects
+	to be the one to open it. Masked accesses don't take the ram fast path.
+*/
+
+const a20Bit = 1 << 20
+
+// Opens or closes the A20 gate
+func (mem *MemoryAccessController) SetA20Enabled(enabled bool) {
+	mem.a20Disabled = !enabled
+}
+
+func (mem *MemoryAccessController) IsA20Enabled() bool {
+	return !mem.a20Disabled
+}
+
+// Applies the A20 gate to a physical address
+func (mem *MemoryAccessController) a20Mask(addr uint32) uint32 {
+	if mem.a20Disabled {
+		return addr &^ a20Bit
+	}
+	return addr
+}
+
+// Bytes of ram installed
+func (mem *MemoryAccessController) GetRamSize() uint32 {
+	return uint32(len(*mem.backingRam))
+}
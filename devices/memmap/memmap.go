@@ -17,11 +17,25 @@ type MemoryAccessController struct {
 
 	resetVectorBaseAddr uint32
 
+	fastPathEnabled bool // plain ram accesses index the backing ram directly
+
+	a20Disabled bool // address line 20 is held low, see a20.go
+
+	writeProtectedRegions []memoryRegion // writes to these ranges are dropped, see LockRegion
+
+	deviceRegions []deviceRegion // windows claimed by devices, see RegisterRegion
+
 	bus                 *bus.Bus
 	busId               uint32
 }
 
 
+// Inclusive address range
+type memoryRegion struct {
+	start uint32
+	end   uint32
+}
+
 type MemoryAccessProvider interface {
 	ReadAddr8(u uint32) (uint8,error)
 	ReadAddr16(u uint32) (uint16,error)
@@ -41,12 +55,24 @@ func (mem *MemoryAccessController) OnReceiveMessage(message bus.BusMessage) {
 		mem.UnlockBootVector()
 	case message.Subject == common.MESSAGE_GLOBAL_CPU_MODESWITCH:
 		mem.HandleMemoryMapSwitch(message.Data[0])
+	case message.Subject == common.MESSAGE_LOCK_REGION:
+		if start, end, ok := common.DecodeRegion(message.Data); ok {
+			mem.LockRegion(start, end)
+		}
+	case message.Subject == common.MESSAGE_UNLOCK_REGION:
+		if start, end, ok := common.DecodeRegion(message.Data); ok {
+			mem.UnlockRegion(start, end)
+		}
 	}
 }
 
 
 func CreateMemoryController(ram *[]byte, bios *[]byte) *MemoryAccessController {
-	return &MemoryAccessController{ram, bios, nil, 0, nil, 0}
+	return &MemoryAccessController{
+		backingRam:      ram,
+		biosImage:       bios,
+		fastPathEnabled: true,
+	}
 }
 
 func (mem *MemoryAccessController) HandleMemoryMapSwitch(modeSwitch byte) {
@@ -60,29 +86,77 @@ func (controller *MemoryAccessController) SetBus(bus *bus.Bus) {
 	controller.bus = bus
 }
 
+// Enables or disables the direct ram access fast path, the general path always goes through the access provider
+func (mem *MemoryAccessController) SetFastPathEnabled(enabled bool) {
+	mem.fastPathEnabled = enabled
+}
+
+func (mem *MemoryAccessController) isBiosAddress(addr uint32) bool {
+	biosImageLength := uint32(len(*mem.biosImage))
+	return biosImageLength > 0 && addr <= BiosAddressSpaceTop && addr > BiosAddressSpaceTop-biosImageLength
+}
+
+// Addresses that are backed by ram and not overlaid by the bios image can skip the access provider
+func (mem *MemoryAccessController) isPlainRam(addr uint32, length uint32) bool {
+	if !mem.fastPathEnabled || mem.a20Disabled || uint64(addr)+uint64(length) > uint64(len(*mem.backingRam)) {
+		return false
+	}
+
+	if mem.resetVectorBaseAddr > 0 && (mem.isBiosAddress(addr) || mem.isBiosAddress(addr+length-1)) {
+		return false
+	}
+
+	return true
+}
+
 func (mem *MemoryAccessController) ReadAddr8(address uint32) (uint8,error) {
+	if mem.isPlainRam(address, 1) {
+		return (*mem.backingRam)[address], nil
+	}
 	return mem.memoryAccessProvider.ReadAddr8(address)
 }
 
 func (mem *MemoryAccessController) ReadAddr16(address uint32) (uint16,error) {
+	if mem.isPlainRam(address, 2) {
+		ram := *mem.backingRam
+		return uint16(ram[address+1])<<8 | uint16(ram[address]), nil
+	}
 	return mem.memoryAccessProvider.ReadAddr16(address)
 }
 
 func (mem *MemoryAccessController) ReadAddr32(address uint32) (uint32,error) {
+	if mem.isPlainRam(address, 4) {
+		ram := *mem.backingRam
+		return uint32(ram[address+3])<<24 | uint32(ram[address+2])<<16 | uint32(ram[address+1])<<8 | uint32(ram[address]), nil
+	}
 	return mem.memoryAccessProvider.ReadAddr32(address)
 }
 
 func (mem *MemoryAccessController) WriteAddr8(address uint32, value uint8) error {
-	if int(address) > len(*mem.backingRam) || address < 0 {
+	address = mem.a20Mask(address)
+
+	if int(address) >= len(*mem.backingRam) {
 		return common.GeneralProtectionFault{}
 	}
 
+	if mem.isWriteProtected(address, 1) {
+		// dropped, like a write to rom
+		return nil
+	}
+
 	(*mem.backingRam)[address] = value
 
 	return nil
 }
 
 func (mem *MemoryAccessController) WriteAddr16(address uint32, value uint16) error {
+	if mem.isPlainRam(address, 2) && !mem.isWriteProtected(address, 2) {
+		ram := *mem.backingRam
+		ram[address] = uint8(value)
+		ram[address+1] = uint8(value >> 8)
+		return nil
+	}
+
 	for i := uint32(0); i < 2; i++ {
 		err := mem.WriteAddr8(address+i, uint8(value>>uint32(i*8)&0xFF))
 		if err != nil {
@@ -93,6 +167,62 @@ func (mem *MemoryAccessController) WriteAddr16(address uint32, value uint16) err
 	return nil
 }
 
+// Little endian 32 bit write. Outside the fast path this is composed from byte writes so an access that
+// straddles a region (or page) boundary is split correctly.
+func (mem *MemoryAccessController) WriteAddr32(address uint32, value uint32) error {
+	if mem.isPlainRam(address, 4) && !mem.isWriteProtected(address, 4) {
+		ram := *mem.backingRam
+		ram[address] = uint8(value)
+		ram[address+1] = uint8(value >> 8)
+		ram[address+2] = uint8(value >> 16)
+		ram[address+3] = uint8(value >> 24)
+		return nil
+	}
+
+	for i := uint32(0); i < 4; i++ {
+		err := mem.WriteAddr8(address+i, uint8(value>>(i*8)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write protects the inclusive range start-end, writes to it are dropped until it is unlocked
+func (mem *MemoryAccessController) LockRegion(start uint32, end uint32) {
+	mem.UnlockRegion(start, end)
+	mem.writeProtectedRegions = append(mem.writeProtectedRegions, memoryRegion{start, end})
+}
+
+// Removes write protection from the inclusive range start-end, splitting any locked region it overlaps
+func (mem *MemoryAccessController) UnlockRegion(start uint32, end uint32) {
+	var regions []memoryRegion
+	for _, region := range mem.writeProtectedRegions {
+		if region.end < start || region.start > end {
+			regions = append(regions, region)
+			continue
+		}
+		if region.start < start {
+			regions = append(regions, memoryRegion{region.start, start - 1})
+		}
+		if region.end > end {
+			regions = append(regions, memoryRegion{end + 1, region.end})
+		}
+	}
+	mem.writeProtectedRegions = regions
+}
+
+func (mem *MemoryAccessController) isWriteProtected(address uint32, length uint32) bool {
+	last := address + length - 1
+	for _, region := range mem.writeProtectedRegions {
+		if address <= region.end && last >= region.start {
+			return true
+		}
+	}
+	return false
+}
+
 func (mem *MemoryAccessController) LockBootVector() {
 	mem.resetVectorBaseAddr = 0xFFFF0000
 }
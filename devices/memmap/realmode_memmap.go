@@ -2,18 +2,22 @@ package memmap
 
 import "github.com/andrewjc/threeatesix/common"
 
+// The bios image is mapped so that its last byte sits at the top of the first megabyte
+const BiosAddressSpaceTop = 0xFFFFF
+
 type RealModeAccessProvider struct {
 	*MemoryAccessController
 }
 
 func (r *RealModeAccessProvider) ReadAddr8(addr uint32) (uint8,error) {
+	addr = r.a20Mask(addr)
+
 
 	var byteData uint8
-	inBiosSpace := (addr > uint32(len(*r.biosImage)-1) - (0xF000FFFF - addr)) && addr < 0xF000FFFF
-	if r.resetVectorBaseAddr > 0 && inBiosSpace {
+	if r.resetVectorBaseAddr > 0 && r.isBiosAddress(addr) {
 		return r.ReadFromBiosAddressSpace(addr)
 	} else {
-		if int(addr) > len(*r.backingRam) || addr < 0 {
+		if int(addr) >= len(*r.backingRam) {
 			return 0, common.GeneralProtectionFault{}
 		}
 		byteData = (*r.backingRam)[addr]
@@ -43,7 +47,7 @@ func (r *RealModeAccessProvider) ReadAddr32(addr uint32) (uint32,error) {
 	if err != nil {
 		return 0, err
 	}
-	b2,err2 := r.ReadAddr16(addr + 1)
+	b2,err2 := r.ReadAddr16(addr + 2)
 	if err2 != nil {
 		return 0, err2
 	}
@@ -55,12 +59,7 @@ func (r *RealModeAccessProvider) PeekNextBytesImpl(addr uint32, numBytes uint32)
 	buffer := make([]byte, numBytes)
 
 	for i := uint32(0); i < numBytes; i++ {
-
-		if r.resetVectorBaseAddr > 0 {
-			buffer[i],_ = r.ReadFromBiosAddressSpace(addr+i)
-		} else {
-			buffer[i] = (*r.backingRam)[addr+i]
-		}
+		buffer[i], _ = r.ReadAddr8(addr + i)
 	}
 
 	return buffer
@@ -69,13 +68,13 @@ func (r *RealModeAccessProvider) PeekNextBytesImpl(addr uint32, numBytes uint32)
 func (r *RealModeAccessProvider) ReadFromBiosAddressSpace(addr uint32) (uint8, error) {
 
 
-	ddd := 0xF000FFFF - addr
+	ddd := BiosAddressSpaceTop - addr
 
 	biosImageLength := uint32(len(*r.biosImage)-1)
 
 	offs := biosImageLength - ddd
 
-	if int(offs) > len(*r.biosImage) || offs < 0 {
+	if int(offs) >= len(*r.biosImage) {
 		return 0, common.GeneralProtectionFault{}
 	}
 	byteData := (*r.biosImage)[offs]
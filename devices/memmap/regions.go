@@ -0,0 +1,142 @@
+package memmap
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+	Memory map introspection
+	MemoryMap flattens the address space into a sorted list of regions which don't overlap: the backing ram, the
+	bios image while it is mapped below the top of the first megabyte, and the windows registered by devices.
+	Device windows sit above the bios image, which sits above ram. Entries are split where write protection
+	starts or stops, so WriteProtected holds for the whole of an entry. Addresses nothing answers are left out,
+	so gaps show up as a jump between one entry's end and the next one's start.
+*/
+
+type RegionKind uint8
+
+const (
+	RegionRam RegionKind = iota
+	RegionRom
+	RegionMmio
+)
+
+func (kind RegionKind) String() string {
+	switch kind {
+	case RegionRam:
+		return "RAM"
+	case RegionRom:
+		return "ROM"
+	case RegionMmio:
+		return "MMIO"
+	}
+	return "unknown"
+}
+
+type RegionInfo struct {
+	Start          uint32
+	End            uint32 // inclusive
+	Kind           RegionKind
+	Name           string // ram, bios or the device name
+	WriteProtected bool
+}
+
+// Address window claimed by a device
+type deviceRegion struct {
+	memoryRegion
+	name string
+}
+
+// Claims the inclusive range start-end for a device, it is listed by MemoryMap. Device windows may not overlap.
+func (mem *MemoryAccessController) RegisterRegion(name string, start uint32, end uint32) error {
+	if end < start {
+		return fmt.Errorf("region %s ends at %#08x before it starts at %#08x", name, end, start)
+	}
+
+	for _, region := range mem.deviceRegions {
+		if start <= region.end && end >= region.start {
+			return fmt.Errorf("region %s at %#08x-%#08x overlaps %s at %#08x-%#08x", name, start, end, region.name, region.start, region.end)
+		}
+	}
+
+	mem.deviceRegions = append(mem.deviceRegions, deviceRegion{memoryRegion{start, end}, name})
+	return nil
+}
+
+// Describes the topmost thing answering at addr
+func (mem *MemoryAccessController) regionAt(addr uint32) (RegionInfo, bool) {
+	for _, region := range mem.deviceRegions {
+		if addr >= region.start && addr <= region.end {
+			return RegionInfo{Kind: RegionMmio, Name: region.name}, true
+		}
+	}
+
+	if mem.resetVectorBaseAddr > 0 && mem.isBiosAddress(addr) {
+		return RegionInfo{Kind: RegionRom, Name: "bios"}, true
+	}
+
+	if uint64(addr) < uint64(len(*mem.backingRam)) {
+		return RegionInfo{Kind: RegionRam, Name: "ram"}, true
+	}
+
+	return RegionInfo{}, false
+}
+
+// Lists the regions making up the address space, sorted by address
+func (mem *MemoryAccessController) MemoryMap() []RegionInfo {
+	// every address where what answers, or its protection, can change
+	boundaries := map[uint64]bool{0: true}
+	addBoundaries := func(start uint32, end uint32) {
+		boundaries[uint64(start)] = true
+		boundaries[uint64(end)+1] = true
+	}
+
+	if len(*mem.backingRam) > 0 {
+		addBoundaries(0, uint32(len(*mem.backingRam)-1))
+	}
+	if biosLength := uint32(len(*mem.biosImage)); mem.resetVectorBaseAddr > 0 && biosLength > 0 {
+		addBoundaries(BiosAddressSpaceTop-biosLength+1, BiosAddressSpaceTop)
+	}
+	for _, region := range mem.deviceRegions {
+		addBoundaries(region.start, region.end)
+	}
+	for _, region := range mem.writeProtectedRegions {
+		addBoundaries(region.start, region.end)
+	}
+
+	var starts []uint64
+	for start := range boundaries {
+		if start <= 0xFFFFFFFF {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var regions []RegionInfo
+	for i, start := range starts {
+		end := uint64(0xFFFFFFFF)
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+
+		region, ok := mem.regionAt(uint32(start))
+		if !ok {
+			continue
+		}
+		region.Start = uint32(start)
+		region.End = uint32(end)
+		region.WriteProtected = mem.isWriteProtected(uint32(start), 1)
+
+		if last := len(regions) - 1; last >= 0 {
+			previous := &regions[last]
+			if uint64(previous.End)+1 == start && previous.Kind == region.Kind && previous.Name == region.Name && previous.WriteProtected == region.WriteProtected {
+				previous.End = region.End
+				continue
+			}
+		}
+		regions = append(regions, region)
+	}
+
+	return regions
+}
@@ -0,0 +1,296 @@
+package ns16550
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
+	"io"
+)
+
+/*
+	Simulated 16550 UART
+
+	Eight registers from the port base. With the divisor latch access bit in the line control register set the
+	first two are the baud rate divisor instead of the data and interrupt enable registers. Baud rate, word
+	length and parity are stored but have no effect: a byte written to the transmit register goes straight to
+	the output stream, and bytes from the input stream are queued to be read from the receive register.
+
+	The input stream is read on its own goroutine so a blocking reader can't stall the machine. What it has
+	read is only moved into the receive queue when the uart is accessed or ticked, so the registers and the
+	interrupt line only change on the machine's goroutine.
+
+	Received data and an empty transmit register can each raise the interrupt line, when enabled in the
+	interrupt enable register and with OUT2 set in the modem control register, which gates the line on a PC.
+	The transmitter is never busy, so the transmit register empty interrupt becomes pending as soon as it's
+	enabled and again after every byte written, and is cleared when the identification register reports it.
+*/
+
+const (
+	UART_DATA             = 0 // receive buffer / transmit holding, divisor low byte with DLAB set
+	UART_INTERRUPT_ENABLE = 1 // divisor high byte with DLAB set
+	UART_INTERRUPT_ID     = 2 // FIFO control when written
+	UART_LINE_CONTROL     = 3
+	UART_MODEM_CONTROL    = 4
+	UART_LINE_STATUS      = 5
+	UART_MODEM_STATUS     = 6
+	UART_SCRATCH          = 7
+	UART_REGISTER_COUNT   = 8
+
+	UART_IER_RECEIVED_DATA  = 0x01
+	UART_IER_TRANSMIT_EMPTY = 0x02
+
+	UART_IIR_NONE           = 0x01
+	UART_IIR_TRANSMIT_EMPTY = 0x02
+	UART_IIR_RECEIVED_DATA  = 0x04
+	UART_IIR_FIFO_ENABLED   = 0xC0
+
+	UART_FCR_ENABLE        = 0x01
+	UART_FCR_CLEAR_RECEIVE = 0x02
+
+	UART_LCR_DLAB = 0x80
+
+	UART_MCR_OUT2 = 0x08
+
+	UART_LSR_DATA_READY       = 0x01
+	UART_LSR_TRANSMIT_EMPTY   = 0x20 // holding register empty
+	UART_LSR_TRANSMITTER_IDLE = 0x40
+
+	UART_RECEIVE_BUFFER = 4096 // bytes the input goroutine can read ahead of the receive queue
+)
+
+type Ns16550 struct {
+	bus   *bus.Bus
+	busId uint32
+
+	base    uint16 // first of the eight io ports
+	irqLine uint8  // master interrupt controller line
+
+	output   io.Writer
+	incoming chan byte // filled by the input goroutine
+	received []byte    // waiting to be read from the data register
+
+	divisor         uint16
+	interruptEnable uint8
+	fifoControl     uint8
+	lineControl     uint8
+	modemControl    uint8
+	scratch         uint8
+
+	transmitEmptyPending bool
+}
+
+// Builds a uart decoding the ports from base and raising irqLine on the master interrupt controller. Bytes read
+// from input are received, and transmitted bytes are written to output. Either stream can be nil.
+func NewNs16550(base uint16, irqLine uint8, input io.Reader, output io.Writer) *Ns16550 {
+	uart := &Ns16550{base: base, irqLine: irqLine, output: output}
+	uart.Reset()
+
+	if input != nil {
+		uart.incoming = make(chan byte, UART_RECEIVE_BUFFER)
+		go uart.readInput(input)
+	}
+	return uart
+}
+
+// Returns to the power on state, keeping the streams and anything not yet received
+func (device *Ns16550) Reset() {
+	device.divisor = 0
+	device.interruptEnable = 0
+	device.fifoControl = 0
+	device.lineControl = 0
+	device.modemControl = 0
+	device.scratch = 0
+	device.transmitEmptyPending = false
+}
+
+func (device *Ns16550) SetDeviceBusId(id uint32) {
+	device.busId = id
+}
+
+func (device *Ns16550) OnReceiveMessage(message bus.BusMessage) {
+	if message.Subject == common.MESSAGE_GLOBAL_RESET {
+		device.Reset()
+	}
+}
+
+func (device *Ns16550) GetBus() *bus.Bus {
+	return device.bus
+}
+
+func (device *Ns16550) SetBus(bus *bus.Bus) {
+	device.bus = bus
+}
+
+func (device *Ns16550) GetBase() uint16 {
+	return device.base
+}
+
+func (device *Ns16550) GetIrqLine() uint8 {
+	return device.irqLine
+}
+
+func (device *Ns16550) readInput(input io.Reader) {
+	buffer := make([]byte, 256)
+	for {
+		n, err := input.Read(buffer)
+		for _, b := range buffer[:n] {
+			device.incoming <- b
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Moves whatever the input goroutine has read into the receive queue
+func (device *Ns16550) pollInput() {
+	for {
+		select {
+		case b := <-device.incoming:
+			device.received = append(device.received, b)
+		default:
+			return
+		}
+	}
+}
+
+// Polls the input stream, raising the interrupt line if data has arrived. Called by the scheduler.
+func (device *Ns16550) Tick() {
+	device.pollInput()
+	device.updateInterrupt()
+}
+
+// The highest priority interrupt pending and enabled, UART_IIR_NONE when there isn't one
+func (device *Ns16550) pendingInterrupt() uint8 {
+	if device.interruptEnable&UART_IER_RECEIVED_DATA != 0 && len(device.received) > 0 {
+		return UART_IIR_RECEIVED_DATA
+	}
+	if device.interruptEnable&UART_IER_TRANSMIT_EMPTY != 0 && device.transmitEmptyPending {
+		return UART_IIR_TRANSMIT_EMPTY
+	}
+	return UART_IIR_NONE
+}
+
+func (device *Ns16550) updateInterrupt() {
+	if device.bus == nil || device.modemControl&UART_MCR_OUT2 == 0 || device.pendingInterrupt() == UART_IIR_NONE {
+		return
+	}
+	device.bus.FindSingleDevice(common.MODULE_MASTER_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a).RaiseIrq(device.irqLine)
+}
+
+func (device *Ns16550) transmit(value uint8) {
+	if device.output != nil {
+		_, err := device.output.Write([]byte{value})
+		if err != nil {
+			common.DefaultLogger.Warnf("UART output failed: %s", err.Error())
+		}
+	}
+	device.transmitEmptyPending = true
+}
+
+// Reads the register at offset 0-7 from the base
+func (device *Ns16550) ReadRegister(offset uint8) uint8 {
+	device.pollInput()
+	defer device.updateInterrupt()
+
+	dlab := device.lineControl&UART_LCR_DLAB != 0
+
+	switch offset {
+	case UART_DATA:
+		if dlab {
+			return uint8(device.divisor)
+		}
+		if len(device.received) == 0 {
+			return 0
+		}
+		value := device.received[0]
+		device.received = device.received[1:]
+		return value
+	case UART_INTERRUPT_ENABLE:
+		if dlab {
+			return uint8(device.divisor >> 8)
+		}
+		return device.interruptEnable
+	case UART_INTERRUPT_ID:
+		id := device.pendingInterrupt()
+		if id == UART_IIR_TRANSMIT_EMPTY {
+			// reading the identification clears the transmit interrupt
+			device.transmitEmptyPending = false
+		}
+		if device.fifoControl&UART_FCR_ENABLE != 0 {
+			id |= UART_IIR_FIFO_ENABLED
+		}
+		return id
+	case UART_LINE_CONTROL:
+		return device.lineControl
+	case UART_MODEM_CONTROL:
+		return device.modemControl
+	case UART_LINE_STATUS:
+		status := uint8(UART_LSR_TRANSMIT_EMPTY | UART_LSR_TRANSMITTER_IDLE)
+		if len(device.received) > 0 {
+			status |= UART_LSR_DATA_READY
+		}
+		return status
+	case UART_MODEM_STATUS:
+		return 0
+	case UART_SCRATCH:
+		return device.scratch
+	}
+	return 0xFF
+}
+
+// Writes the register at offset 0-7 from the base
+func (device *Ns16550) WriteRegister(offset uint8, value uint8) {
+	device.pollInput()
+	defer device.updateInterrupt()
+
+	dlab := device.lineControl&UART_LCR_DLAB != 0
+
+	switch offset {
+	case UART_DATA:
+		if dlab {
+			device.divisor = device.divisor&0xFF00 | uint16(value)
+			return
+		}
+		device.transmit(value)
+	case UART_INTERRUPT_ENABLE:
+		if dlab {
+			device.divisor = device.divisor&0x00FF | uint16(value)<<8
+			return
+		}
+		if value&UART_IER_TRANSMIT_EMPTY != 0 && device.interruptEnable&UART_IER_TRANSMIT_EMPTY == 0 {
+			// the holding register is already empty
+			device.transmitEmptyPending = true
+		}
+		device.interruptEnable = value & 0x0F
+	case UART_INTERRUPT_ID:
+		device.fifoControl = value
+		if value&UART_FCR_CLEAR_RECEIVE != 0 {
+			device.received = nil
+		}
+	case UART_LINE_CONTROL:
+		device.lineControl = value
+	case UART_MODEM_CONTROL:
+		device.modemControl = value & 0x1F
+	case UART_SCRATCH:
+		device.scratch = value
+	}
+}
+
+func (device *Ns16550) ReadPort8(port uint16) uint8 {
+	return device.ReadRegister(uint8(port - device.base))
+}
+
+func (device *Ns16550) WritePort8(port uint16, value uint8) {
+	device.WriteRegister(uint8(port-device.base), value)
+}
+
+// The registers are a byte wide, a word access reaches two of them
+func (device *Ns16550) ReadPort16(port uint16) uint16 {
+	return uint16(device.ReadPort8(port)) | uint16(device.ReadPort8(port+1))<<8
+}
+
+func (device *Ns16550) WritePort16(port uint16, value uint16) {
+	device.WritePort8(port, uint8(value))
+	device.WritePort8(port+1, uint8(value>>8))
+}
@@ -0,0 +1,191 @@
+package pci
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+)
+
+/*
+	PCI host bridge
+	Configuration mechanism #1: a dword written to the address port 0xCF8 selects a bus, device, function and
+	register, and the data ports 0xCFC-0xCFF then read and write that register. Bit 31 of the address enables the
+	cycle, with it clear the data ports read back all ones. Byte and word accesses to the data ports pick out the
+	bytes of the register by the low two bits of the port. Only dword accesses reach the address register.
+
+	Devices are registered by bus/device/function. A read from a slot with no device returns 0xFFFFFFFF, which is
+	how configuration software finds it empty. The bridge itself is function 0 of device 0 on bus 0.
+*/
+
+const (
+	ConfigAddressPort = 0xCF8
+	ConfigDataPort    = 0xCFC
+
+	ConfigAddressEnable = 0x80000000
+
+	// configuration header registers
+	ConfigVendorId   = 0x00 // device id in the upper word
+	ConfigCommand    = 0x04 // status in the upper word
+	ConfigClassCode  = 0x08 // revision id in the low byte
+	ConfigHeaderType = 0x0C // header type in byte 2
+
+	HostBridgeVendorId  = 0x8086   // Intel
+	HostBridgeDeviceId  = 0x1237   // 82441FX
+	HostBridgeClassCode = 0x060000 // bridge, host bridge
+
+	MaxDevices   = 32
+	MaxFunctions = 8
+)
+
+// A function on the PCI bus. register is the dword aligned byte offset into its 256 byte configuration space.
+type Device interface {
+	ReadConfig32(register uint8) uint32
+	WriteConfig32(register uint8, value uint32)
+}
+
+// A configuration space with read only identification registers, the rest is plain storage
+type ConfigSpace struct {
+	VendorId   uint16
+	DeviceId   uint16
+	ClassCode  uint32 // class, subclass and programming interface
+	Revision   uint8
+	HeaderType uint8
+
+	registers [64]uint32
+}
+
+func (config *ConfigSpace) ReadConfig32(register uint8) uint32 {
+	switch register &^ 0x3 {
+	case ConfigVendorId:
+		return uint32(config.DeviceId)<<16 | uint32(config.VendorId)
+	case ConfigClassCode:
+		return config.ClassCode<<8 | uint32(config.Revision)
+	case ConfigHeaderType:
+		return config.registers[register>>2]&^0x00FF0000 | uint32(config.HeaderType)<<16
+	}
+	return config.registers[register>>2]
+}
+
+func (config *ConfigSpace) WriteConfig32(register uint8, value uint32) {
+	switch register &^ 0x3 {
+	case ConfigVendorId, ConfigClassCode:
+		return
+	}
+	config.registers[register>>2] = value
+}
+
+type HostBridge struct {
+	busId uint32
+
+	address uint32 // the last dword written to 0xCF8
+
+	config  ConfigSpace
+	devices map[uint32]Device // keyed by bus<<8 | device<<3 | function, as in the address register
+}
+
+func NewHostBridge() *HostBridge {
+	bridge := &HostBridge{devices: make(map[uint32]Device)}
+	bridge.config = ConfigSpace{
+		VendorId:  HostBridgeVendorId,
+		DeviceId:  HostBridgeDeviceId,
+		ClassCode: HostBridgeClassCode,
+	}
+	bridge.devices[0] = &bridge.config
+	return bridge
+}
+
+func (bridge *HostBridge) SetDeviceBusId(id uint32) {
+	bridge.busId = id
+}
+
+func (bridge *HostBridge) OnReceiveMessage(message bus.BusMessage) {
+	if message.Subject == common.MESSAGE_GLOBAL_RESET {
+		bridge.address = 0
+	}
+}
+
+func slot(busNumber uint8, device uint8, function uint8) uint32 {
+	return uint32(busNumber)<<8 | uint32(device)<<3 | uint32(function)
+}
+
+// Places a device at bus/device/function, each slot takes one device
+func (bridge *HostBridge) RegisterDevice(busNumber uint8, device uint8, function uint8, dev Device) error {
+	if device >= MaxDevices || function >= MaxFunctions {
+		return fmt.Errorf("pci slot %02x:%02x.%x is out of range", busNumber, device, function)
+	}
+	key := slot(busNumber, device, function)
+	if _, ok := bridge.devices[key]; ok {
+		return fmt.Errorf("pci slot %02x:%02x.%x is already in use", busNumber, device, function)
+	}
+	bridge.devices[key] = dev
+	return nil
+}
+
+// Gets the device at bus/device/function, nil for an empty slot
+func (bridge *HostBridge) GetDevice(busNumber uint8, device uint8, function uint8) Device {
+	return bridge.devices[slot(busNumber, device, function)]
+}
+
+func (bridge *HostBridge) GetConfigAddress() uint32 {
+	return bridge.address
+}
+
+// The device and register selected by the address register, nil when the cycle isn't enabled or the slot is empty
+func (bridge *HostBridge) selected() (Device, uint8) {
+	if bridge.address&ConfigAddressEnable == 0 {
+		return nil, 0
+	}
+	return bridge.devices[(bridge.address>>8)&0xFFFF], uint8(bridge.address) & 0xFC
+}
+
+// Reads the selected register shifted down to the byte addressed by a data port
+func (bridge *HostBridge) readData(port uint16) uint32 {
+	device, register := bridge.selected()
+	if device == nil || port < ConfigDataPort {
+		return 0xFFFFFFFF
+	}
+	return device.ReadConfig32(register) >> ((port & 0x3) * 8)
+}
+
+// Merges the bytes in mask, positioned at the byte addressed by a data port, into the selected register
+func (bridge *HostBridge) writeData(port uint16, value uint32, mask uint32) {
+	device, register := bridge.selected()
+	if device == nil || port < ConfigDataPort {
+		return
+	}
+	shift := (port & 0x3) * 8
+	current := device.ReadConfig32(register)
+	device.WriteConfig32(register, current&^(mask<<shift)|(value&mask)<<shift)
+}
+
+func (bridge *HostBridge) ReadPort8(port uint16) uint8 {
+	return uint8(bridge.readData(port))
+}
+
+func (bridge *HostBridge) WritePort8(port uint16, value uint8) {
+	bridge.writeData(port, uint32(value), 0xFF)
+}
+
+func (bridge *HostBridge) ReadPort16(port uint16) uint16 {
+	return uint16(bridge.readData(port))
+}
+
+func (bridge *HostBridge) WritePort16(port uint16, value uint16) {
+	bridge.writeData(port, uint32(value), 0xFFFF)
+}
+
+func (bridge *HostBridge) ReadPort32(port uint16) uint32 {
+	if port == ConfigAddressPort {
+		return bridge.address
+	}
+	return bridge.readData(port)
+}
+
+func (bridge *HostBridge) WritePort32(port uint16, value uint32) {
+	if port == ConfigAddressPort {
+		// bits 30-24 and 1-0 are reserved and read back as 0
+		bridge.address = value &^ 0x7F000003
+		return
+	}
+	bridge.writeData(port, value, 0xFFFFFFFF)
+}
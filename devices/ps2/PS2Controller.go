@@ -1,14 +1,24 @@
 package ps2
 
 import (
+	"github.com/andrewjc/threeatesix/common"
 	"github.com/andrewjc/threeatesix/devices/bus"
-	"log"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
+)
+
+const (
+	STATUS_OUTPUT_BUFFER_FULL = 0x01
+	KEYBOARD_IRQ_LINE         = 1
+
+	COMMAND_PULSE_RESET = 0xFE // pulses the output port line wired to the cpu reset
 )
 
 type Ps2Controller struct {
 	bus            *bus.Bus
 	busId          uint32
 	statusRegister uint8
+
+	outputBuffer []uint8 // scancodes waiting to be read from the data port
 }
 
 func (controller *Ps2Controller) SetDeviceBusId(id uint32) {
@@ -16,7 +26,10 @@ func (controller *Ps2Controller) SetDeviceBusId(id uint32) {
 }
 
 func (controller *Ps2Controller) OnReceiveMessage(message bus.BusMessage) {
-
+	if message.Subject == common.MESSAGE_GLOBAL_RESET {
+		controller.statusRegister = 0
+		controller.outputBuffer = nil
+	}
 }
 
 func CreatePS2Controller() *Ps2Controller {
@@ -35,6 +48,44 @@ func (controller *Ps2Controller) ReadStatusRegister() uint8 {
 	return controller.statusRegister
 }
 
+// Port 0x64
 func (controller *Ps2Controller) WriteCommandRegister(value uint8) {
-	log.Printf("PS2 controller write command: [%#04x]", value)
-}
\ No newline at end of file
+	common.DefaultLogger.Debugf("PS2 controller write command: [%#04x]", value)
+
+	if value == COMMAND_PULSE_RESET && controller.bus != nil {
+		// resets the whole machine, the way software reboots or gets a 286 back out of protected mode
+		controller.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_RESET, Data: []byte{}, Sender: controller.busId})
+	}
+}
+
+// Queues a scancode from the keyboard and signals IRQ1
+func (controller *Ps2Controller) SendScancode(code uint8) {
+	controller.outputBuffer = append(controller.outputBuffer, code)
+	controller.statusRegister |= STATUS_OUTPUT_BUFFER_FULL
+	controller.raiseKeyboardIrq()
+}
+
+// Port 0x60, returns the oldest waiting scancode, 0 when the buffer is empty
+func (controller *Ps2Controller) ReadDataRegister() uint8 {
+	if len(controller.outputBuffer) == 0 {
+		return 0
+	}
+
+	code := controller.outputBuffer[0]
+	controller.outputBuffer = controller.outputBuffer[1:]
+
+	if len(controller.outputBuffer) == 0 {
+		controller.statusRegister &^= STATUS_OUTPUT_BUFFER_FULL
+	} else {
+		controller.raiseKeyboardIrq()
+	}
+
+	return code
+}
+
+func (controller *Ps2Controller) raiseKeyboardIrq() {
+	if controller.bus == nil {
+		return
+	}
+	controller.bus.FindSingleDevice(common.MODULE_MASTER_INTERRUPT_CONTROLLER).(*intel8259a.Intel8259a).RaiseIrq(KEYBOARD_IRQ_LINE)
+}
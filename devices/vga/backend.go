@@ -0,0 +1,77 @@
+package vga
+
+import (
+	"strings"
+)
+
+/*
+	Video backends
+	The adapter renders the frame buffer into a backend, which decides how it is presented (terminal, window,
+	or an in memory buffer for tests). Cells and pixels are only presented when they change, Flush is called
+	once the frame has been rendered.
+*/
+
+type VideoBackend interface {
+	PresentTextCell(row int, column int, character uint8, attribute uint8)
+	PresentPixel(x int, y int, color uint8)
+	Flush()
+}
+
+// Discards everything, used until a backend is attached
+type NullBackend struct{}
+
+func (backend NullBackend) PresentTextCell(row int, column int, character uint8, attribute uint8) {}
+
+func (backend NullBackend) PresentPixel(x int, y int, color uint8) {}
+
+func (backend NullBackend) Flush() {}
+
+// Keeps the text screen as strings so the output can be asserted on
+type StringBackend struct {
+	rows    [][]uint8
+	flushes int
+}
+
+func NewStringBackend() *StringBackend {
+	backend := &StringBackend{}
+	backend.rows = make([][]uint8, TEXT_ROWS)
+	for i := range backend.rows {
+		backend.rows[i] = []uint8(strings.Repeat(" ", TEXT_COLUMNS))
+	}
+	return backend
+}
+
+func (backend *StringBackend) PresentTextCell(row int, column int, character uint8, attribute uint8) {
+	if row < 0 || row >= len(backend.rows) || column < 0 || column >= TEXT_COLUMNS {
+		return
+	}
+	if character < 0x20 || character > 0x7E {
+		// only printable ascii is kept
+		character = ' '
+	}
+	backend.rows[row][column] = character
+}
+
+func (backend *StringBackend) PresentPixel(x int, y int, color uint8) {}
+
+func (backend *StringBackend) Flush() {
+	backend.flushes++
+}
+
+// A row of the screen with trailing spaces removed
+func (backend *StringBackend) Row(row int) string {
+	return strings.TrimRight(string(backend.rows[row]), " ")
+}
+
+// The screen contents, one line per row with trailing blank rows removed
+func (backend *StringBackend) String() string {
+	lines := make([]string, len(backend.rows))
+	for i := range backend.rows {
+		lines[i] = backend.Row(i)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func (backend *StringBackend) FlushCount() int {
+	return backend.flushes
+}
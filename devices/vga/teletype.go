@@ -0,0 +1,94 @@
+package vga
+
+/*
+	Text mode teletype
+	Writes characters at the cursor and moves it on, the way the bios teletype call does. CR returns to the first
+	column, LF moves down a row, BS moves back a column without erasing and stops at the start of the row, and BEL
+	is swallowed as there's no speaker. Running off the last column wraps to the next row, and moving down from the
+	last row scrolls the screen up a row and clears the bottom one.
+
+	Characters are written without changing the attribute already in the cell, the scrolled in row is light grey
+	on black.
+*/
+
+const (
+	TELETYPE_BELL            = 0x07
+	TELETYPE_BACKSPACE       = 0x08
+	TELETYPE_LINE_FEED       = 0x0A
+	TELETYPE_CARRIAGE_RETURN = 0x0D
+
+	TEXT_DEFAULT_ATTRIBUTE = 0x07
+)
+
+func (device *Vga) SetCursor(row int, column int) {
+	device.cursorRow = row
+	device.cursorColumn = column
+}
+
+func (device *Vga) GetCursor() (row int, column int) {
+	return device.cursorRow, device.cursorColumn
+}
+
+// Writes a character at the cursor and advances it, scrolling at the bottom of the screen
+func (device *Vga) Teletype(character uint8) error {
+	switch character {
+	case TELETYPE_BELL:
+		return nil
+	case TELETYPE_BACKSPACE:
+		if device.cursorColumn > 0 {
+			device.cursorColumn--
+		}
+		return nil
+	case TELETYPE_CARRIAGE_RETURN:
+		device.cursorColumn = 0
+		return nil
+	case TELETYPE_LINE_FEED:
+		return device.lineFeed()
+	}
+
+	addr := TEXT_MODE_BUFFER + uint32(device.cursorRow*TEXT_COLUMNS+device.cursorColumn)*2
+	err := device.memoryAccessController.WriteAddr8(addr, character)
+	if err != nil {
+		return err
+	}
+
+	device.cursorColumn++
+	if device.cursorColumn < TEXT_COLUMNS {
+		return nil
+	}
+	device.cursorColumn = 0
+	return device.lineFeed()
+}
+
+func (device *Vga) lineFeed() error {
+	if device.cursorRow < TEXT_ROWS-1 {
+		device.cursorRow++
+		return nil
+	}
+	return device.scrollUp()
+}
+
+// Moves every text row up one, the top row is lost and the bottom one is cleared
+func (device *Vga) scrollUp() error {
+	const rowBytes = TEXT_COLUMNS * 2
+
+	for offset := uint32(0); offset < (TEXT_ROWS-1)*rowBytes; offset += 2 {
+		cell, err := device.memoryAccessController.ReadAddr16(TEXT_MODE_BUFFER + offset + rowBytes)
+		if err != nil {
+			return err
+		}
+		err = device.memoryAccessController.WriteAddr16(TEXT_MODE_BUFFER+offset, cell)
+		if err != nil {
+			return err
+		}
+	}
+
+	for offset := uint32((TEXT_ROWS - 1) * rowBytes); offset < TEXT_ROWS*rowBytes; offset += 2 {
+		err := device.memoryAccessController.WriteAddr16(TEXT_MODE_BUFFER+offset, TEXT_DEFAULT_ATTRIBUTE<<8|' ')
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package vga
+
+import (
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/memmap"
+)
+
+/*
+	Simulated VGA adapter
+
+	Text mode 3 is 80x25 character/attribute pairs at 0xB8000, graphics mode 0x13 is 320x200 with one byte
+	per pixel at 0xA0000. The frame buffer lives in system ram, Refresh compares it against the last frame
+	and presents the cells or pixels that changed to the attached backend. The 0xA0000-0xBFFFF window is
+	registered with the memory controller so it shows up in the memory map.
+*/
+
+const (
+	TEXT_MODE_BUFFER     = 0xB8000
+	GRAPHICS_MODE_BUFFER = 0xA0000
+	VIDEO_MEMORY_START   = 0xA0000
+	VIDEO_MEMORY_END     = 0xBFFFF
+
+	TEXT_COLUMNS = 80
+	TEXT_ROWS    = 25
+
+	GRAPHICS_WIDTH  = 320
+	GRAPHICS_HEIGHT = 200
+
+	VIDEO_MODE_TEXT_80X25       = 0x03
+	VIDEO_MODE_GRAPHICS_320X200 = 0x13
+)
+
+type Vga struct {
+	bus   *bus.Bus
+	busId uint32
+
+	memoryAccessController *memmap.MemoryAccessController
+
+	backend VideoBackend
+
+	mode      uint8
+	lastFrame []uint8
+
+	cursorRow    int // text cursor, see teletype.go
+	cursorColumn int
+}
+
+func NewVga(memoryAccessController *memmap.MemoryAccessController) *Vga {
+	memoryAccessController.RegisterRegion("vga", VIDEO_MEMORY_START, VIDEO_MEMORY_END)
+
+	return &Vga{
+		memoryAccessController: memoryAccessController,
+		backend:                NullBackend{},
+		mode:                   VIDEO_MODE_TEXT_80X25,
+	}
+}
+
+func (device *Vga) SetDeviceBusId(id uint32) {
+	device.busId = id
+}
+
+func (device *Vga) OnReceiveMessage(message bus.BusMessage) {
+
+}
+
+func (device *Vga) SetBus(bus *bus.Bus) {
+	device.bus = bus
+}
+
+// Attaches the backend frames are presented to, nil detaches it. The next refresh presents the whole frame.
+func (device *Vga) SetBackend(backend VideoBackend) {
+	if backend == nil {
+		backend = NullBackend{}
+	}
+	device.backend = backend
+	device.lastFrame = nil
+}
+
+func (device *Vga) GetBackend() VideoBackend {
+	return device.backend
+}
+
+func (device *Vga) SetMode(mode uint8) {
+	device.mode = mode
+	device.lastFrame = nil
+}
+
+func (device *Vga) GetMode() uint8 {
+	return device.mode
+}
+
+// Presents the parts of the frame buffer that changed since the last refresh
+func (device *Vga) Refresh() error {
+	var base, length uint32
+	switch device.mode {
+	case VIDEO_MODE_GRAPHICS_320X200:
+		base, length = GRAPHICS_MODE_BUFFER, GRAPHICS_WIDTH*GRAPHICS_HEIGHT
+	default:
+		base, length = TEXT_MODE_BUFFER, TEXT_COLUMNS*TEXT_ROWS*2
+	}
+
+	frame := make([]uint8, length)
+	for i := range frame {
+		value, err := device.memoryAccessController.ReadAddr8(base + uint32(i))
+		if err != nil {
+			return err
+		}
+		frame[i] = value
+	}
+
+	fullFrame := len(device.lastFrame) != len(frame)
+
+	if device.mode == VIDEO_MODE_GRAPHICS_320X200 {
+		for i, color := range frame {
+			if fullFrame || device.lastFrame[i] != color {
+				device.backend.PresentPixel(i%GRAPHICS_WIDTH, i/GRAPHICS_WIDTH, color)
+			}
+		}
+	} else {
+		for i := 0; i < len(frame); i += 2 {
+			if fullFrame || device.lastFrame[i] != frame[i] || device.lastFrame[i+1] != frame[i+1] {
+				cell := i / 2
+				device.backend.PresentTextCell(cell/TEXT_COLUMNS, cell%TEXT_COLUMNS, frame[i], frame[i+1])
+			}
+		}
+	}
+
+	device.lastFrame = frame
+	device.backend.Flush()
+
+	return nil
+}
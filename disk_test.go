@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/disk"
+	"testing"
+)
+
+func Test_CHSToLBA(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		c, h, s     uint32
+		geometry    disk.Geometry
+		expectedLBA uint32
+	}{
+		{"TestFirstSector", 0, 0, 1, disk.Floppy1440K, 0},
+		{"TestLastSectorOfTrack", 0, 0, 18, disk.Floppy1440K, 17},
+		{"TestSecondHead", 0, 1, 1, disk.Floppy1440K, 18},
+		{"TestSecondCylinder", 1, 0, 1, disk.Floppy1440K, 36},
+		{"TestLastSector", 79, 1, 18, disk.Floppy1440K, 2879},
+		{"TestHardDisk", 2, 3, 4, disk.Geometry{Cylinders: 1024, Heads: 16, SectorsPerTrack: 63}, (2*16+3)*63 + 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lba, err := disk.CHSToLBA(tt.c, tt.h, tt.s, tt.geometry.Heads, tt.geometry.SectorsPerTrack)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if lba != tt.expectedLBA {
+				t.Errorf("Expected %d/%d/%d to be block %d but got %d", tt.c, tt.h, tt.s, tt.expectedLBA, lba)
+			}
+
+			c, h, s := disk.LBAToCHS(lba, tt.geometry.Heads, tt.geometry.SectorsPerTrack)
+			if c != tt.c || h != tt.h || s != tt.s {
+				t.Errorf("Expected block %d to be %d/%d/%d but got %d/%d/%d", lba, tt.c, tt.h, tt.s, c, h, s)
+			}
+		})
+	}
+}
+
+func Test_CHSOutOfRange(t *testing.T) {
+
+	geometry := disk.Floppy1440K
+
+	if _, err := geometry.ToLBA(0, 0, 0); err == nil {
+		t.Errorf("Expected sector 0 to be refused")
+	}
+	if _, err := geometry.ToLBA(0, 0, 19); err == nil {
+		t.Errorf("Expected sector 19 to be refused")
+	}
+	if _, err := geometry.ToLBA(0, 2, 1); err == nil {
+		t.Errorf("Expected head 2 to be refused")
+	}
+	if _, err := geometry.ToLBA(80, 0, 1); err == nil {
+		t.Errorf("Expected cylinder 80 to be refused")
+	}
+	if _, _, _, err := geometry.ToCHS(2880); err == nil {
+		t.Errorf("Expected block 2880 to be refused")
+	}
+}
+
+func Test_GeometryForImageSize(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		size     uint32
+		expected disk.Geometry
+	}{
+		{"TestFloppy1440K", 1474560, disk.Floppy1440K},
+		{"TestFloppy720K", 737280, disk.Floppy720K},
+		{"TestFloppy360K", 368640, disk.Floppy360K},
+		// a 10MB image rounds up to whole cylinders of 16 heads and 63 sectors
+		{"TestHardDisk", 10 * 1024 * 1024, disk.Geometry{Cylinders: 21, Heads: 16, SectorsPerTrack: 63}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if geometry := disk.GeometryForImageSize(tt.size); geometry != tt.expected {
+				t.Errorf("Expected geometry %s but got %s", tt.expected, geometry)
+			}
+		})
+	}
+}
+
+func Test_DiskSectors(t *testing.T) {
+
+	image := make([]byte, 2*disk.SECTOR_SIZE)
+	image[disk.SECTOR_SIZE] = 0x55
+
+	floppy, err := disk.NewDisk(image, disk.Floppy1440K)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	// block 1 is the second sector of the first track
+	sector, err := floppy.ReadSectorsCHS(0, 0, 2, 1)
+	if err != nil || sector[0] != 0x55 {
+		t.Errorf("Expected to read the second sector but got %v", err)
+	}
+
+	// the image is extended to the whole geometry
+	written := make([]byte, disk.SECTOR_SIZE)
+	written[0] = 0xaa
+	if err := floppy.WriteSectorsCHS(79, 1, 18, written); err != nil {
+		t.Fatalf("Unexpected error writing the last sector: %s", err.Error())
+	}
+	if sector, _ := floppy.ReadSectors(2879, 1); sector[0] != 0xaa {
+		t.Errorf("Expected the last sector to read back [%#02x] but got [%#02x]", 0xaa, sector[0])
+	}
+
+	if _, err := floppy.ReadSectors(2879, 2); err == nil {
+		t.Errorf("Expected a read past the last sector to fail")
+	}
+
+	floppy.SetReadOnly(true)
+	if err := floppy.WriteSectors(0, written); err == nil {
+		t.Errorf("Expected a write to a read only disk to fail")
+	}
+
+	if _, err := disk.NewDisk(make([]byte, 1474561), disk.Floppy1440K); err == nil {
+		t.Errorf("Expected an image larger than its geometry to be refused")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// builds a pc in protected mode running at 0x08:0x0200 in a flat 32 bit code segment
+func newTestPcIn32BitCodeSegment() *pc.PersonalComputer {
+	gdt := [][]uint8{
+		// 0x08: 32 bit code, base 0, limit 4GB
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0xcf, 0x00},
+	}
+
+	// jmp 0x0008:0x00000200
+	testPc := newTestPcWithGdt(gdt, []uint8{0x66, 0xea, 0x00, 0x02, 0x00, 0x00, 0x08, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.Step()
+
+	return testPc
+}
+
+func Test_NearJump32BitCodeSegment(t *testing.T) {
+	testPc := newTestPcIn32BitCodeSegment()
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x00200: {0xe9, 0x00, 0x00, 0x01, 0x00}, // jmp rel32 +0x10000
+		0x10205: {0xeb, 0xf9},                   // jmp short -7
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	cpu.Step()
+
+	if cpu.GetEIP() != 0x00010205 {
+		t.Errorf("Expected the jump to update all of EIP [%#08x] but got [%#08x]", 0x00010205, cpu.GetEIP())
+	}
+	if cpu.GetIP() != 0x0205 {
+		t.Errorf("Expected IP to be the low word of EIP [%#04x] but got [%#04x]", 0x0205, cpu.GetIP())
+	}
+
+	// fetched from the full EIP
+	cpu.Step()
+
+	if cpu.GetEIP() != 0x00010200 {
+		t.Errorf("Expected the short jump to land at [%#08x] but got [%#08x]", 0x00010200, cpu.GetEIP())
+	}
+}
+
+func Test_NearCall32BitCodeSegment(t *testing.T) {
+	testPc := newTestPcIn32BitCodeSegment()
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x00200: {0xe8, 0xfb, 0x01, 0x01, 0x00}, // call rel32 to 0x10400
+		0x10400: {0xc3},                         // ret
+	})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	cpu.Step()
+
+	if cpu.GetEIP() != 0x00010400 {
+		t.Errorf("Expected the call to land at [%#08x] but got [%#08x]", 0x00010400, cpu.GetEIP())
+	}
+	if cpu.GetRegisters().SP != 0x1ffc {
+		t.Errorf("Expected a dword return address leaving SP [%#04x] but got [%#04x]", 0x1ffc, cpu.GetRegisters().SP)
+	}
+	if ip, _ := mem.ReadAddr32(0x1ffc); ip != 0x00000205 {
+		t.Errorf("Expected the return EIP [%#08x] on the stack but got [%#08x]", 0x205, ip)
+	}
+
+	cpu.Step()
+
+	if cpu.GetEIP() != 0x00000205 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected ret to return to [%#08x] with SP [%#04x] but got [%#08x] with SP [%#04x]", 0x205, 0x2000, cpu.GetEIP(), cpu.GetRegisters().SP)
+	}
+}
+
+func Test_InstructionPointerWraps16BitCodeSegment(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		ip          uint16
+		instruction []uint8
+		expectedIP  uint16
+	}{
+		// jmp rel16 +0x10 from 0xfffd
+		{"TestNearJumpWraps", 0xfffd, []uint8{0xe9, 0x10, 0x00}, 0x0010},
+		// jmp short +4 from 0xfffe
+		{"TestShortJumpWraps", 0xfffe, []uint8{0xeb, 0x04}, 0x0004},
+		// nop at 0xffff
+		{"TestAdvanceWraps", 0xffff, []uint8{0x90}, 0x0000},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(tt.ip, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+			if cpu.GetEIP() != uint32(tt.expectedIP) {
+				t.Errorf("Expected the upper half of EIP to stay clear [%#08x] but got [%#08x]", tt.expectedIP, cpu.GetEIP())
+			}
+		})
+	}
+}
+
+func newTestPcIn16BitCodeSegment() *pc.PersonalComputer {
+	gdt := [][]uint8{
+		// 0x08: 16 bit code, base 0, limit 0xffff
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	}
+
+	// jmp 0x0008:0x0200
+	testPc := newTestPcWithGdt(gdt, []uint8{0xea, 0x00, 0x02, 0x08, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.Step()
+
+	return testPc
+}
+
+func Test_PrefixesFlipCodeSegmentSize(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		segment32   bool
+		instruction []uint8
+		expectedEIP uint32
+		expectedSP  uint16
+	}{
+		// jmp rel16 -0x100, a 16 bit segment defaults to 16 bit offsets
+		{"Test16BitJump", false, []uint8{0xe9, 0x00, 0xff}, 0x00000103, 0x2000},
+		// jmp rel32 +0x100, 0x66 selects a 32 bit offset
+		{"Test16BitJumpOperandOverride", false, []uint8{0x66, 0xe9, 0x00, 0x01, 0x00, 0x00}, 0x00000306, 0x2000},
+		// call rel32 +0x100, 0x66 pushes a dword return address
+		{"Test16BitCallOperandOverride", false, []uint8{0x66, 0xe8, 0x00, 0x01, 0x00, 0x00}, 0x00000306, 0x1ffc},
+		// call rel16 +0x100
+		{"Test16BitCall", false, []uint8{0xe8, 0x00, 0x01}, 0x00000303, 0x1ffe},
+		// jmp rel32 +0x10000, a 32 bit segment defaults to 32 bit offsets
+		{"Test32BitJump", true, []uint8{0xe9, 0x00, 0x00, 0x01, 0x00}, 0x00010205, 0x2000},
+		// jmp rel16 -0x300, 0x66 selects a 16 bit offset and the target wraps at 64k
+		{"Test32BitJumpOperandOverride", true, []uint8{0x66, 0xe9, 0x00, 0xfd}, 0x0000ff04, 0x2000},
+		// call rel16 +0x100, 0x66 pushes a word return address
+		{"Test32BitCallOperandOverride", true, []uint8{0x66, 0xe8, 0x00, 0x01}, 0x00000304, 0x1ffe},
+	}
+	for _, tt := range tests {
+
+		var testPc *pc.PersonalComputer
+		if tt.segment32 {
+			testPc = newTestPcIn32BitCodeSegment()
+		} else {
+			testPc = newTestPcIn16BitCodeSegment()
+		}
+		writeTestCode(testPc, map[uint32][]uint8{0x200: tt.instruction})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			cpu.Step()
+
+			if cpu.GetEIP() != tt.expectedEIP {
+				t.Errorf("Expected EIP [%#08x] but got [%#08x]", tt.expectedEIP, cpu.GetEIP())
+			}
+			if cpu.GetRegisters().SP != tt.expectedSP {
+				t.Errorf("Expected SP [%#04x] but got [%#04x]", tt.expectedSP, cpu.GetRegisters().SP)
+			}
+		})
+	}
+}
+
+func Test_JcxzAddressSize(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		segment32   bool
+		instruction []uint8
+		expectedEIP uint32
+	}{
+		// ECX is 0x00010000 throughout, so CX is zero and ECX isn't
+		// jcxz +0x10, a 16 bit segment tests CX
+		{"Test16BitJcxz", false, []uint8{0xe3, 0x10}, 0x00000212},
+		// jecxz +0x10, 0x67 tests ECX
+		{"Test16BitJecxz", false, []uint8{0x67, 0xe3, 0x10}, 0x00000203},
+		// jecxz +0x10, a 32 bit segment tests ECX
+		{"Test32BitJecxz", true, []uint8{0xe3, 0x10}, 0x00000202},
+		// jcxz +0x10, 0x67 tests CX
+		{"Test32BitJcxz", true, []uint8{0x67, 0xe3, 0x10}, 0x00000213},
+	}
+	for _, tt := range tests {
+
+		var testPc *pc.PersonalComputer
+		if tt.segment32 {
+			testPc = newTestPcIn32BitCodeSegment()
+		} else {
+			testPc = newTestPcIn16BitCodeSegment()
+		}
+		writeTestCode(testPc, map[uint32][]uint8{0x200: tt.instruction})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().ECX = 0x00010000
+
+			cpu.Step()
+
+			if cpu.GetEIP() != tt.expectedEIP {
+				t.Errorf("Expected EIP [%#08x] but got [%#08x]", tt.expectedEIP, cpu.GetEIP())
+			}
+		})
+	}
+}
+
+func Test_StraightLine32BitCodeSegment(t *testing.T) {
+	testPc := newTestPcIn32BitCodeSegment()
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {
+			0xb8, 0x78, 0x56, 0x34, 0x12, // mov eax, 0x12345678
+			0x05, 0x11, 0x11, 0x11, 0x11, // add eax, 0x11111111
+			0xa3, 0x00, 0x30, 0x00, 0x00, // mov [0x3000], eax
+			0x3d, 0x89, 0x67, 0x45, 0x23, // cmp eax, 0x23456789
+			0x25, 0x00, 0x00, 0xff, 0xff, // and eax, 0xffff0000
+			0xa9, 0x00, 0x00, 0x00, 0x80, // test eax, 0x80000000
+			0xa1, 0x00, 0x30, 0x00, 0x00, // mov eax, [0x3000]
+		},
+	})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	steps := []struct {
+		name        string
+		expectedEIP uint32
+		expectedEAX uint32
+		expectedZF  bool
+	}{
+		{"mov eax, imm32", 0x205, 0x12345678, false},
+		{"add eax, imm32", 0x20a, 0x23456789, false},
+		{"mov moffs32, eax", 0x20f, 0x23456789, false},
+		{"cmp eax, imm32", 0x214, 0x23456789, true},
+		{"and eax, imm32", 0x219, 0x23450000, false},
+		{"test eax, imm32", 0x21e, 0x23450000, true},
+		{"mov eax, moffs32", 0x223, 0x23456789, true},
+	}
+	for _, step := range steps {
+		cpu.Step()
+
+		if cpu.GetEIP() != step.expectedEIP {
+			t.Fatalf("Expected %s to leave EIP [%#08x] but got [%#08x]", step.name, step.expectedEIP, cpu.GetEIP())
+		}
+		if cpu.GetRegisters().EAX != step.expectedEAX || cpu.GetRegisters().AX != uint16(step.expectedEAX) {
+			t.Errorf("Expected %s to leave EAX [%#08x] but got [%#08x] (AX [%#04x])", step.name, step.expectedEAX, cpu.GetRegisters().EAX, cpu.GetRegisters().AX)
+		}
+		if cpu.GetFlag(intel8086.ZeroFlag) != step.expectedZF {
+			t.Errorf("Expected %s to leave ZF %t but got %t", step.name, step.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+		}
+	}
+
+	if value, _ := mem.ReadAddr32(0x3000); value != 0x23456789 {
+		t.Errorf("Expected [%#08x] stored at 0x3000 but got [%#08x]", 0x23456789, value)
+	}
+}
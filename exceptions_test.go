@@ -0,0 +1,280 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_ExceptionReturnAddress(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		vector      uint32
+		expectedIP  uint16
+	}{
+		// lar ax, bx is #UD in real mode, a fault reports the faulting instruction
+		{"TestFaultPushesFaultingIP", []uint8{0x0f, 0x02, 0xc3}, 0x06, 0x0100},
+		// int3 is a trap, reporting the next instruction
+		{"TestTrapPushesNextIP", []uint8{0xcc}, 0x03, 0x0101},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			// handler at 0000:0500 which returns with iret
+			mem.WriteAddr16(tt.vector*4, 0x0500)
+			mem.WriteAddr16(tt.vector*4+2, 0x0000)
+			mem.WriteAddr8(0x0500, 0xcf)
+
+			cpu.Step()
+
+			if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0500 {
+				t.Errorf("Expected the handler at [0000:0500] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+			}
+			if cpu.GetRegisters().SP != 0x1ffa {
+				t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x1ffa, cpu.GetRegisters().SP)
+			}
+			if ip, _ := mem.ReadAddr16(0x1ffa); ip != tt.expectedIP {
+				t.Errorf("Expected pushed IP [%#04x] but got [%#04x]", tt.expectedIP, ip)
+			}
+
+			cpu.Step() // iret
+
+			if cpu.GetIP() != tt.expectedIP || cpu.GetRegisters().SP != 0x2000 {
+				t.Errorf("Expected iret to [%#04x] with SP [%#04x] but got [%#04x] with [%#04x]", tt.expectedIP, 0x2000, cpu.GetIP(), cpu.GetRegisters().SP)
+			}
+		})
+	}
+}
+
+func Test_GeneralProtectionErrorCode(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code for the handler
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x10: data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x18: execute only code, can't be loaded into a data segment register
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x98, 0x00, 0x00},
+	}
+
+	tests := []struct {
+		name              string
+		selector          uint16
+		segmentModRm      uint8
+		expectedErrorCode uint16
+	}{
+		// mov ds, ax with a selector past the gdt limit
+		{"TestSelectorBeyondGdtLimit", 0x0028, 0xd8, 0x0028},
+		// the rpl is dropped and the TI bit kept when the LDT isn't loaded
+		{"TestLdtSelectorWithoutLdt", 0x002f, 0xd8, 0x002c},
+		// mov ds, ax with an execute only code segment
+		{"TestExecuteOnlyIntoDs", 0x0018, 0xd8, 0x0018},
+		// mov ss, ax with the null selector reports error code 0
+		{"TestNullStackSegment", 0x0000, 0xd0, 0x0000},
+	}
+	for _, tt := range tests {
+
+		// lidt [0x0810]; mov ax, selector; mov sreg, ax
+		testPc := newTestPcWithGdt(gdt, []uint8{
+			0x0f, 0x01, 0x1e, 0x10, 0x08,
+			0xb8, uint8(tt.selector), uint8(tt.selector >> 8),
+			0x8e, tt.segmentModRm,
+		})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			// idtr pseudo descriptor: limit 0x007f, base 0x00001800
+			mem.WriteAddr16(0x0810, 0x007f)
+			mem.WriteAddr16(0x0812, 0x1800)
+			mem.WriteAddr16(0x0814, 0x0000)
+
+			// #GP interrupt gate to 0008:0600
+			for i, b := range []uint8{0x00, 0x06, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00} {
+				mem.WriteAddr8(0x1800+0x0d*8+uint32(i), b)
+			}
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0600 {
+				t.Fatalf("Expected the #GP handler at [0008:0600] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+			}
+			if cpu.GetRegisters().SP != 0x1ff8 {
+				t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x1ff8, cpu.GetRegisters().SP)
+			}
+			if code, _ := mem.ReadAddr16(0x1ff8); code != tt.expectedErrorCode {
+				t.Errorf("Expected error code [%#04x] but got [%#04x]", tt.expectedErrorCode, code)
+			}
+			if ip, _ := mem.ReadAddr16(0x1ffa); ip != 0x010d {
+				t.Errorf("Expected pushed IP of the faulting mov [%#04x] but got [%#04x]", 0x010d, ip)
+			}
+		})
+	}
+}
+
+func Test_ExceptionHook(t *testing.T) {
+
+	tests := []struct {
+		name              string
+		instruction       []uint8
+		handled           bool
+		expectedVector    uint8
+		expectedErrorCode uint32
+		expectedHasCode   bool
+		expectedIP        uint16
+	}{
+		// aam 0 raises #DE, which has no error code
+		{"TestDivideErrorHandled", []uint8{0xd4, 0x00}, true, intel8086.ExceptionDivideError, 0, false, 0x0100},
+		{"TestDivideErrorPassedOn", []uint8{0xd4, 0x00}, false, intel8086.ExceptionDivideError, 0, false, 0x0500},
+		// lodsw past the 64k limit of DS raises #GP(0)
+		{"TestGeneralProtectionHandled", []uint8{0x67, 0xad}, true, intel8086.ExceptionGeneralProtection, 0, true, 0x0100},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().ESI = 0x00012000
+			mem.WriteAddr16(uint32(tt.expectedVector)*4, 0x0500)
+			mem.WriteAddr16(uint32(tt.expectedVector)*4+2, 0x0000)
+
+			var seen []intel8086.Exception
+			cpu.SetExceptionHook(func(e intel8086.Exception) bool {
+				seen = append(seen, e)
+				return tt.handled
+			})
+
+			cpu.Step()
+
+			if len(seen) != 1 {
+				t.Fatalf("Expected the hook to see 1 exception but it saw %d", len(seen))
+			}
+			if seen[0].Vector != tt.expectedVector || seen[0].ErrorCode != tt.expectedErrorCode || seen[0].HasErrorCode != tt.expectedHasCode {
+				t.Errorf("Expected vector [%#02x] with error code [%#04x] (%t) but got %s", tt.expectedVector, tt.expectedErrorCode, tt.expectedHasCode, seen[0].Error())
+			}
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+			expectedSP := uint16(0x2000)
+			if !tt.handled {
+				expectedSP = 0x1ffa
+			}
+			if cpu.GetRegisters().SP != expectedSP {
+				t.Errorf("Expected SP [%#04x] but got [%#04x]", expectedSP, cpu.GetRegisters().SP)
+			}
+		})
+	}
+}
+
+func Test_DoubleFaultClassification(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code for the handlers
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	}
+
+	tests := []struct {
+		name              string
+		instruction       []uint8
+		gates             map[uint8]uint16
+		expectedIP        uint16
+		expectedErrorCode uint16
+	}{
+		// #BP is benign, the #NP for its missing gate is delivered on its own
+		{"TestBenignThenContributory", []uint8{0xcc}, map[uint8]uint16{0x0b: 0x0600, 0x08: 0x0700}, 0x0600, 0x03<<3 | 0x2},
+		// #GP with a missing gate raises #NP, two contributory exceptions make #DF
+		{"TestContributoryThenContributory", []uint8{0xb8, 0x28, 0x00, 0x8e, 0xd8}, map[uint8]uint16{0x08: 0x0700}, 0x0700, 0x0000},
+	}
+	for _, tt := range tests {
+
+		// lidt [0x0810]
+		testPc := newTestPcWithGdt(gdt, append([]uint8{0x0f, 0x01, 0x1e, 0x10, 0x08}, tt.instruction...))
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			// idtr pseudo descriptor: limit 0x007f, base 0x00001800
+			mem.WriteAddr16(0x0810, 0x007f)
+			mem.WriteAddr16(0x0812, 0x1800)
+			mem.WriteAddr16(0x0814, 0x0000)
+
+			for vector, offset := range tt.gates {
+				for i, b := range []uint8{uint8(offset), uint8(offset >> 8), 0x08, 0x00, 0x00, 0x86, 0x00, 0x00} {
+					mem.WriteAddr8(0x1800+uint32(vector)*8+uint32(i), b)
+				}
+			}
+
+			for cpu.GetIP() < 0x0600 && !cpu.IsHalted() {
+				cpu.Step()
+			}
+
+			if cpu.GetCS() != 0x0008 || cpu.GetIP() != tt.expectedIP {
+				t.Fatalf("Expected the handler at [0008:%04x] but got [%04x:%04x]", tt.expectedIP, cpu.GetCS(), cpu.GetIP())
+			}
+			if code, _ := mem.ReadAddr16(0x1ff8); code != tt.expectedErrorCode {
+				t.Errorf("Expected error code [%#04x] but got [%#04x]", tt.expectedErrorCode, code)
+			}
+		})
+	}
+}
+
+func Test_ExceptionHookSeesEscalatedPair(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code for the #DF handler
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	}
+
+	// lidt [0x0810]; mov ax, 0x28; mov ds, ax raises #GP(0x28), which has no gate
+	testPc := newTestPcWithGdt(gdt, []uint8{0x0f, 0x01, 0x1e, 0x10, 0x08, 0xb8, 0x28, 0x00, 0x8e, 0xd8})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+
+	// idtr pseudo descriptor: limit 0x007f, base 0x00001800, with a #DF gate to 0008:0700
+	mem.WriteAddr16(0x0810, 0x007f)
+	mem.WriteAddr16(0x0812, 0x1800)
+	mem.WriteAddr16(0x0814, 0x0000)
+	for i, b := range []uint8{0x00, 0x07, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00} {
+		mem.WriteAddr8(0x1800+0x08*8+uint32(i), b)
+	}
+
+	var seen []intel8086.Exception
+	cpu.SetExceptionHook(func(e intel8086.Exception) bool {
+		seen = append(seen, e)
+		return false
+	})
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if len(seen) != 2 {
+		t.Fatalf("Expected the hook to see 2 exceptions but it saw %d", len(seen))
+	}
+	if seen[0].Vector != intel8086.ExceptionGeneralProtection || seen[0].ErrorCode != 0x28 {
+		t.Errorf("Expected #GP(0x28) first but got %s", seen[0].Error())
+	}
+	if seen[1].Vector != intel8086.ExceptionDoubleFault {
+		t.Errorf("Expected #DF second but got %s", seen[1].Error())
+	}
+	if cpu.GetIP() != 0x0700 {
+		t.Errorf("Expected the #DF handler at [%#04x] but got [%#04x]", 0x0700, cpu.GetIP())
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_Cmpxchg(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		ax          uint16
+		expectedAX  uint16
+		expectedBX  uint16
+		expectedM   uint16
+		expectedZF  bool
+	}{
+		// cmpxchg bx, cx
+		{"TestCmpxchgEqual", []uint8{0x0f, 0xb1, 0xcb}, 0x1111, 0x1111, 0x3333, 0xbeef, true},
+		{"TestCmpxchgNotEqual", []uint8{0x0f, 0xb1, 0xcb}, 0x2222, 0x1111, 0x1111, 0xbeef, false},
+		// cmpxchg [0x0600], cx
+		{"TestCmpxchgMemoryEqual", []uint8{0x0f, 0xb1, 0x0e, 0x00, 0x06}, 0xbeef, 0xbeef, 0x1111, 0x3333, true},
+		{"TestCmpxchgMemoryNotEqual", []uint8{0x0f, 0xb1, 0x0e, 0x00, 0x06}, 0x2222, 0xbeef, 0x1111, 0xbeef, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(intel8086.CpuFeatures{CompareExchange: true})
+			mem.WriteAddr16(0x0600, 0xbeef)
+			cpu.GetRegisters().AX = tt.ax
+			cpu.GetRegisters().BX = 0x1111
+			cpu.GetRegisters().CX = 0x3333
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetRegisters().BX != tt.expectedBX {
+				t.Errorf("Expected BX [%#04x] but got [%#04x]", tt.expectedBX, cpu.GetRegisters().BX)
+			}
+			if value, _ := mem.ReadAddr16(0x0600); value != tt.expectedM {
+				t.Errorf("Expected [%#04x] in memory but got [%#04x]", tt.expectedM, value)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetRegisters().CX != 0x3333 {
+				t.Errorf("Expected the source CX to be left alone but got [%#04x]", cpu.GetRegisters().CX)
+			}
+		})
+	}
+}
+
+func Test_Cmpxchg8And32(t *testing.T) {
+
+	// cmpxchg bl, cl; cmpxchg ebx, ecx
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0xb0, 0xcb, 0x66, 0x0f, 0xb1, 0xcb})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetFeatures(intel8086.CpuFeatures{CompareExchange: true})
+	cpu.GetRegisters().EAX = 0x12345611
+	cpu.GetRegisters().EBX = 0x87654311
+	cpu.GetRegisters().ECX = 0x33333333
+
+	cpu.Step()
+	if cpu.GetRegisters().BL != 0x33 || !cpu.GetFlag(intel8086.ZeroFlag) {
+		t.Errorf("Expected BL [%#02x] with ZF set but got [%#02x] with ZF %t", 0x33, cpu.GetRegisters().BL, cpu.GetFlag(intel8086.ZeroFlag))
+	}
+
+	cpu.Step()
+	// the first compare left BL, the low byte of EBX, holding CL
+	if cpu.GetRegisters().EAX != 0x87654333 || cpu.GetRegisters().EBX != 0x87654333 || cpu.GetFlag(intel8086.ZeroFlag) {
+		t.Errorf("Expected EAX loaded with [%#08x] and ZF clear but got EAX [%#08x] EBX [%#08x] ZF %t", 0x87654333, cpu.GetRegisters().EAX, cpu.GetRegisters().EBX, cpu.GetFlag(intel8086.ZeroFlag))
+	}
+	if cpu.GetIP() != 0x0107 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0107, cpu.GetIP())
+	}
+}
+
+func Test_Xadd(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedBX  uint16
+		expectedCX  uint16
+		expectedM   uint16
+		expectedCF  bool
+	}{
+		// xadd bx, cx
+		{"TestXaddRegister", []uint8{0x0f, 0xc1, 0xcb}, 0x4444, 0x1111, 0x0600, false},
+		// xadd [0x0600], cx
+		{"TestXaddMemory", []uint8{0x0f, 0xc1, 0x0e, 0x00, 0x06}, 0x1111, 0x0600, 0x3933, false},
+		// xadd [0x0602], cx with a carry out
+		{"TestXaddCarry", []uint8{0x0f, 0xc1, 0x0e, 0x02, 0x06}, 0x1111, 0xf000, 0x2333, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(intel8086.CpuFeatures{CompareExchange: true})
+			mem.WriteAddr16(0x0600, 0x0600)
+			mem.WriteAddr16(0x0602, 0xf000)
+			cpu.GetRegisters().BX = 0x1111
+			cpu.GetRegisters().CX = 0x3333
+
+			cpu.Step()
+
+			if cpu.GetRegisters().BX != tt.expectedBX {
+				t.Errorf("Expected BX [%#04x] but got [%#04x]", tt.expectedBX, cpu.GetRegisters().BX)
+			}
+			if cpu.GetRegisters().CX != tt.expectedCX {
+				t.Errorf("Expected the old destination [%#04x] in CX but got [%#04x]", tt.expectedCX, cpu.GetRegisters().CX)
+			}
+			if tt.instruction[2] != 0xcb {
+				addr := uint32(tt.instruction[3]) | uint32(tt.instruction[4])<<8
+				if value, _ := mem.ReadAddr16(addr); value != tt.expectedM {
+					t.Errorf("Expected the sum [%#04x] in memory but got [%#04x]", tt.expectedM, value)
+				}
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+		})
+	}
+}
+
+func Test_CmpxchgWithoutFeature(t *testing.T) {
+
+	// cmpxchg bx, cx is #UD on a plain 386
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0xb1, 0xcb})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+}
+
+func Test_Cmpxchg8b(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		eax, edx    uint32
+		expectedEAX uint32
+		expectedEDX uint32
+		expectedLow uint32
+		expectedHi  uint32
+		expectedZF  bool
+	}{
+		// cmpxchg8b [0x0600], memory holds 0x11111111_22222222
+		{"TestCmpxchg8bEqual", 0x22222222, 0x11111111, 0x22222222, 0x11111111, 0x44444444, 0x33333333, true},
+		{"TestCmpxchg8bNotEqual", 0x22222222, 0x55555555, 0x22222222, 0x11111111, 0x22222222, 0x11111111, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0xc7, 0x0e, 0x00, 0x06})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(intel8086.CpuFeatures{CompareExchange8Byte: true})
+			mem.WriteAddr32(0x0600, 0x22222222)
+			mem.WriteAddr32(0x0604, 0x11111111)
+			cpu.GetRegisters().EAX = tt.eax
+			cpu.GetRegisters().EDX = tt.edx
+			cpu.GetRegisters().EBX = 0x44444444
+			cpu.GetRegisters().ECX = 0x33333333
+
+			cpu.Step()
+
+			if cpu.GetRegisters().EAX != tt.expectedEAX || cpu.GetRegisters().EDX != tt.expectedEDX {
+				t.Errorf("Expected EDX:EAX [%#08x:%#08x] but got [%#08x:%#08x]", tt.expectedEDX, tt.expectedEAX, cpu.GetRegisters().EDX, cpu.GetRegisters().EAX)
+			}
+			low, _ := mem.ReadAddr32(0x0600)
+			high, _ := mem.ReadAddr32(0x0604)
+			if low != tt.expectedLow || high != tt.expectedHi {
+				t.Errorf("Expected [%#08x:%#08x] in memory but got [%#08x:%#08x]", tt.expectedHi, tt.expectedLow, high, low)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetRegisters().EBX != 0x44444444 || cpu.GetRegisters().ECX != 0x33333333 {
+				t.Errorf("Expected ECX:EBX to be left alone but got [%#08x:%#08x]", cpu.GetRegisters().ECX, cpu.GetRegisters().EBX)
+			}
+			if cpu.GetIP() != 0x0105 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0105, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_Cmpxchg8bInvalidForms(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		features    intel8086.CpuFeatures
+		instruction []uint8
+	}{
+		// cmpxchg8b [0x0600] on a core before the Pentium
+		{"TestWithoutFeature", intel8086.CpuFeatures{CompareExchange: true}, []uint8{0x0f, 0xc7, 0x0e, 0x00, 0x06}},
+		// a register operand
+		{"TestRegisterOperand", intel8086.CpuFeatures{CompareExchange8Byte: true}, []uint8{0x0f, 0xc7, 0xcb}},
+		// reg field 2
+		{"TestWrongRegField", intel8086.CpuFeatures{CompareExchange8Byte: true}, []uint8{0x0f, 0xc7, 0x16, 0x00, 0x06}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(tt.features)
+			cpu.GetRegisters().SP = 0x2000
+			mem.WriteAddr16(0x06*4, 0x0500)
+			mem.WriteAddr16(0x06*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != 0x0500 {
+				t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_JmpFarPointer(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedCS  uint16
+		expectedIP  uint16
+		expectedEIP uint32
+	}{
+		// jmp 0x0010:0x0200
+		{"TestJmpPtr16", []uint8{0xea, 0x00, 0x02, 0x10, 0x00}, 0x0010, 0x0200, 0x00000200},
+		// jmp 0x0010:0x00000200
+		{"TestJmpPtr32", []uint8{0x66, 0xea, 0x00, 0x02, 0x00, 0x00, 0x10, 0x00}, 0x0010, 0x0200, 0x00000200},
+		// jmp far [0x0600], m16:16
+		{"TestJmpMem16", []uint8{0xff, 0x2e, 0x00, 0x06}, 0x0020, 0x0300, 0x00000300},
+		// jmp far [0x0610], m16:32
+		{"TestJmpMem32", []uint8{0x66, 0xff, 0x2e, 0x10, 0x06}, 0x0030, 0x0400, 0x00000400},
+		// jmp 0x0000:0x00010000 is past the real mode limit, #GP to the handler at 0x0500
+		{"TestJmpPtr32PastLimit", []uint8{0x66, 0xea, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}, 0x0000, 0x0500, 0x00000500},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+			mem.WriteAddr16(0x0600, 0x0300)
+			mem.WriteAddr16(0x0602, 0x0020)
+			mem.WriteAddr32(0x0610, 0x00000400)
+			mem.WriteAddr16(0x0614, 0x0030)
+			mem.WriteAddr16(0x0d*4, 0x0500)
+			mem.WriteAddr16(0x0d*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetCS() != tt.expectedCS || cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected [%04x:%04x] but got [%04x:%04x]", tt.expectedCS, tt.expectedIP, cpu.GetCS(), cpu.GetIP())
+			}
+			if cpu.GetRegisters().EIP != tt.expectedEIP {
+				t.Errorf("Expected EIP [%#08x] but got [%#08x]", tt.expectedEIP, cpu.GetRegisters().EIP)
+			}
+		})
+	}
+}
+
+func Test_JmpFarPointer32ProtectedMode(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: 32 bit code, base 0, limit 4GB
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0xcf, 0x00},
+	}
+
+	// jmp 0x0008:0x00012345
+	testPc := newTestPcWithGdt(gdt, []uint8{0x66, 0xea, 0x45, 0x23, 0x01, 0x00, 0x08, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 {
+		t.Errorf("Expected CS [%#04x] but got [%#04x]", 0x0008, cpu.GetCS())
+	}
+	if cpu.GetRegisters().EIP != 0x00012345 {
+		t.Errorf("Expected the full 32 bit offset in EIP [%#08x] but got [%#08x]", 0x00012345, cpu.GetRegisters().EIP)
+	}
+	if cpu.GetIP() != 0x2345 {
+		t.Errorf("Expected IP to hold the low word [%#04x] but got [%#04x]", 0x2345, cpu.GetIP())
+	}
+}
+
+func Test_CallFarPointer32(t *testing.T) {
+
+	// call 0x0000:0x00000400; at 0x400 retf with a 32 bit operand size
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0x9a, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00})
+	writeTestCode(testPc, map[uint32][]uint8{0x400: {0x66, 0xcb}})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0400 {
+		t.Errorf("Expected the call to land at [0000:0400] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SP != 0x1ff8 {
+		t.Errorf("Expected the return address pushed as two dwords leaving SP [%#04x] but got [%#04x]", 0x1ff8, cpu.GetRegisters().SP)
+	}
+	if ip, _ := mem.ReadAddr32(0x1ff8); ip != 0x00000108 {
+		t.Errorf("Expected the return offset [%#08x] on the stack but got [%#08x]", 0x108, ip)
+	}
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0108 {
+		t.Errorf("Expected retf to return to [0000:0108] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] after the return but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_CpuModelFeatures(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		model       intel8086.CpuModel
+		instruction []uint8
+		expectedUD  bool
+	}{
+		// bswap eax arrived with the 486, rdtsc with the Pentium
+		{"Test386Bswap", intel8086.CpuModel386, []uint8{0x0f, 0xc8}, true},
+		{"Test486Bswap", intel8086.CpuModel486, []uint8{0x0f, 0xc8}, false},
+		{"Test486Rdtsc", intel8086.CpuModel486, []uint8{0x0f, 0x31}, true},
+		{"TestPentiumRdtsc", intel8086.CpuModelPentium, []uint8{0x0f, 0x31}, false},
+		{"TestPentiumBswap", intel8086.CpuModelPentium, []uint8{0x0f, 0xc8}, false},
+		// cmovz ax, bx is a Pentium Pro instruction, no modelled part has it
+		{"TestPentiumCmov", intel8086.CpuModelPentium, []uint8{0x0f, 0x44, 0xc3}, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			// #UD handler at 0000:0500
+			mem.WriteAddr16(0x06*4, 0x0500)
+			mem.WriteAddr16(0x06*4+2, 0x0000)
+
+			cpu.SetModel(tt.model)
+			if cpu.GetModel() != tt.model {
+				t.Errorf("Expected model %d but got %d", tt.model, cpu.GetModel())
+			}
+
+			cpu.Step()
+
+			expectedIP := 0x0100 + uint16(len(tt.instruction))
+			if tt.expectedUD {
+				expectedIP = 0x0500
+			}
+			if cpu.GetIP() != expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_FeatureOverridesModel(t *testing.T) {
+
+	// cmovz ax, bx
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x44, 0xc3})
+	cpu := testPc.GetPrimaryCpu()
+
+	cpu.SetModel(intel8086.CpuModelPentium)
+	features := cpu.GetFeatures()
+	features.ConditionalMove = true
+	cpu.SetFeatures(features)
+
+	cpu.GetRegisters().AX = 0x1111
+	cpu.GetRegisters().BX = 0x2222
+	cpu.SetFlag(intel8086.ZeroFlag, true)
+
+	cpu.Step()
+
+	if cpu.GetRegisters().AX != 0x2222 {
+		t.Errorf("Expected cmovz to move [%#04x] but got [%#04x]", 0x2222, cpu.GetRegisters().AX)
+	}
+	if !cpu.GetFeatures().TimeStampCounter {
+		t.Errorf("Expected the Pentium features to be kept alongside the override")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+func Test_TruncatedInstructionFetch(t *testing.T) {
+
+	// code segment whose offset 0x000f is the last byte of ram
+	ramTop := uint32(pc.MaxRAMBytes - 0x10)
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code for the handler
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x10: code at the top of ram
+		{0xff, 0xff, uint8(ramTop), uint8(ramTop >> 8), uint8(ramTop >> 16), 0x9a, 0x00, uint8(ramTop >> 24)},
+		// 0x18: code, base 0, limit 0x0fff
+		{0xff, 0x0f, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	}
+
+	tests := []struct {
+		name     string
+		selector uint16
+		offset   uint16
+	}{
+		// mov ax, imm16 with the immediate past the end of ram
+		{"TestEndOfMemory", 0x0010, 0x000f},
+		// mov ax, imm16 with the immediate past the code segment limit
+		{"TestCodeSegmentLimit", 0x0018, 0x0fff},
+	}
+	for _, tt := range tests {
+
+		// lidt [0x0810]; jmp selector:offset
+		testPc := newTestPcWithGdt(gdt, []uint8{
+			0x0f, 0x01, 0x1e, 0x10, 0x08,
+			0xea, uint8(tt.offset), uint8(tt.offset >> 8), uint8(tt.selector), uint8(tt.selector >> 8),
+		})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			mem.WriteAddr16(0x0810, 0x007f)
+			mem.WriteAddr16(0x0812, 0x1800)
+			mem.WriteAddr16(0x0814, 0x0000)
+			writeTestCode(testPc, map[uint32][]uint8{
+				0x1800 + 0x0d*8: {0x00, 0x06, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00},
+			})
+
+			descriptorBase := uint32(0)
+			if tt.selector == 0x0010 {
+				descriptorBase = ramTop
+			}
+			mem.WriteAddr8(descriptorBase+uint32(tt.offset), 0xb8)
+
+			cpu.Step() // lidt
+			cpu.Step() // jmp
+
+			if cpu.GetCS() != tt.selector || cpu.GetIP() != tt.offset {
+				t.Fatalf("Expected [%04x:%04x] but got [%04x:%04x]", tt.selector, tt.offset, cpu.GetCS(), cpu.GetIP())
+			}
+
+			cpu.Step() // mov ax, imm16
+
+			if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0600 {
+				t.Fatalf("Expected the #GP handler at [0008:0600] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+			}
+			if code, _ := mem.ReadAddr16(0x1ff8); code != 0x0000 {
+				t.Errorf("Expected error code [%#04x] but got [%#04x]", 0x0000, code)
+			}
+			if ip, _ := mem.ReadAddr16(0x1ffa); ip != tt.offset {
+				t.Errorf("Expected pushed IP of the truncated instruction [%#04x] but got [%#04x]", tt.offset, ip)
+			}
+			if cs, _ := mem.ReadAddr16(0x1ffc); cs != tt.selector {
+				t.Errorf("Expected pushed CS [%#04x] but got [%#04x]", tt.selector, cs)
+			}
+		})
+	}
+}
+
+func Test_RealModeCodeOffsetWrap(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		ip         uint16
+		code       map[uint32][]uint8
+		expectedAX uint16
+		expectedIP uint16
+	}{
+		// mov ax, 0x1234 starting at 0100:ffff
+		{"TestImmediateWraps", 0xffff, map[uint32][]uint8{0x10fff: {0xb8}, 0x1000: {0x34, 0x12}}, 0x1234, 0x0002},
+		// mov ax, 0x1234 starting at 0100:fffe, the immediate straddles the wrap
+		{"TestImmediateStraddlesWrap", 0xfffe, map[uint32][]uint8{0x10ffe: {0xb8, 0x34}, 0x1000: {0x12}}, 0x1234, 0x0001},
+		// jmp short +2 at 0100:ffff
+		{"TestJumpDisplacementWraps", 0xffff, map[uint32][]uint8{0x10fff: {0xeb}, 0x1000: {0x02}}, 0x0000, 0x0003},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetCS(0x0100)
+			cpu.SetIP(tt.ip)
+			cpu.GetRegisters().AX = 0
+			writeTestCode(testPc, tt.code)
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetCS() != 0x0100 || cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected [0100:%04x] but got [%04x:%04x]", tt.expectedIP, cpu.GetCS(), cpu.GetIP())
+			}
+		})
+	}
+}
@@ -46,3 +46,248 @@ func Test_SetFlag(t *testing.T) {
 		})
 	}
 }
+
+func Test_DirectionFlagStringIndexDelta(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedSI  uint16
+	}{
+		// cld; lodsb
+		{"TestByteIncrement", []uint8{0xfc, 0xac}, 0x0601},
+		// std; lodsb
+		{"TestByteDecrement", []uint8{0xfd, 0xac}, 0x05ff},
+		// cld; lodsw
+		{"TestWordIncrement", []uint8{0xfc, 0xad}, 0x0602},
+		// std; lodsw
+		{"TestWordDecrement", []uint8{0xfd, 0xad}, 0x05fe},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().SI = 0x0600
+
+			cpu.Step()
+			cpu.Step()
+
+			if cpu.GetRegisters().SI != tt.expectedSI {
+				t.Errorf("Expected SI [%#04x] but got [%#04x]", tt.expectedSI, cpu.GetRegisters().SI)
+			}
+		})
+	}
+}
+
+func Test_TestParityFlag(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		al          uint8
+		ax          uint16
+		expectedPF  bool
+		expectedZF  bool
+		expectedSF  bool
+	}{
+		// test al, imm8
+		{"TestNoBitsSet", []uint8{0xa8, 0xff}, 0x00, 0, true, true, false},
+		{"TestOneBitSet", []uint8{0xa8, 0xff}, 0x01, 0, false, false, false},
+		{"TestTwoBitsSet", []uint8{0xa8, 0xff}, 0x03, 0, true, false, false},
+		{"TestThreeBitsSet", []uint8{0xa8, 0xff}, 0x07, 0, false, false, false},
+		{"TestSevenBitsSet", []uint8{0xa8, 0xff}, 0xfe, 0, false, false, true},
+		{"TestAllBitsSet", []uint8{0xa8, 0xff}, 0xff, 0, true, false, true},
+		{"TestMasked", []uint8{0xa8, 0x0f}, 0x1f, 0, true, false, false},
+		// test ax, imm16, only the low byte counts towards parity
+		{"TestWordHighByteIgnored", []uint8{0xa9, 0xff, 0xff}, 0, 0x0103, true, false, false},
+		{"TestWordSign", []uint8{0xa9, 0xff, 0xff}, 0, 0x8001, false, false, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().AL = tt.al
+			cpu.GetRegisters().AX = tt.ax
+			cpu.SetFlag(intel8086.ParityFlag, !tt.expectedPF)
+
+			cpu.Step()
+
+			if cpu.GetFlag(intel8086.ParityFlag) != tt.expectedPF {
+				t.Errorf("Expected PF %t but got %t", tt.expectedPF, cpu.GetFlag(intel8086.ParityFlag))
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetFlag(intel8086.SignFlag) != tt.expectedSF {
+				t.Errorf("Expected SF %t but got %t", tt.expectedSF, cpu.GetFlag(intel8086.SignFlag))
+			}
+		})
+	}
+}
+
+func Test_PopfProtectedFlags(t *testing.T) {
+
+	// NT, IOPL 1, DF, IF, SF, ZF, AF, PF, CF and the reserved bits
+	const popped = 0xe6ff
+
+	tests := []struct {
+		name          string
+		setup         func() *pc.PersonalComputer
+		flags         uint16
+		instruction   []uint8
+		expectedFlags uint16
+	}{
+		// push 0xe6ff; popf
+		{"TestRealMode", func() *pc.PersonalComputer { return newTestPcWithInstructions(0x200, nil) }, 0x0000, []uint8{0x68, 0xff, 0xe6, 0x9d}, 0x66d5},
+		{"TestRing0", newTestPcIn16BitCodeSegment, 0x0000, []uint8{0x68, 0xff, 0xe6, 0x9d}, 0x66d5},
+		// IF and IOPL are kept
+		{"TestRing3", func() *pc.PersonalComputer { return newTestPcAtRing3WithIdt(nil) }, 0x0000, []uint8{0x68, 0xff, 0xe6, 0x9d}, 0x44d5},
+		// IOPL 3 lets ring 3 change IF but not IOPL
+		{"TestRing3Iopl3", func() *pc.PersonalComputer { return newTestPcAtRing3WithIdt(nil) }, 0x3000, []uint8{0x68, 0xff, 0xe6, 0x9d}, 0x76d5},
+		// push 0xe6ff; push cs; push 0x0300; iret
+		{"TestIretRing0", newTestPcIn16BitCodeSegment, 0x0000, []uint8{0x68, 0xff, 0xe6, 0x0e, 0x68, 0x00, 0x03, 0xcf}, 0x66d5},
+		{"TestIretRing3", func() *pc.PersonalComputer { return newTestPcAtRing3WithIdt(nil) }, 0x0000, []uint8{0x68, 0xff, 0xe6, 0x0e, 0x68, 0x00, 0x03, 0xcf}, 0x44d5},
+	}
+	for _, tt := range tests {
+
+		testPc := tt.setup()
+		writeTestCode(testPc, map[uint32][]uint8{0x200: tt.instruction})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().FLAGS = tt.flags
+
+			// the pushes, then popf or iret
+			for cpu.GetIP() < 0x200+uint16(len(tt.instruction)) {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().FLAGS != tt.expectedFlags {
+				t.Errorf("Expected %#04x to load FLAGS [%#04x] but got [%#04x]", popped, tt.expectedFlags, cpu.GetRegisters().FLAGS)
+			}
+			if !cpu.GetFlag(0x0002) || cpu.GetFlag(0x8000) {
+				t.Errorf("Expected the reserved bits to read 1 and 0")
+			}
+		})
+	}
+}
+
+func Test_PushfReservedBit(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		expectedImage uint16
+	}{
+		// push 0; popf; pushf; pop ax
+		{"TestClear", []uint8{0x6a, 0x00, 0x9d, 0x9c, 0x58}, 0x0002},
+		// push 0xfeff; popf; pushf; pop ax, everything but TF, bits 3, 5 and 15 still read as 0
+		{"TestSet", []uint8{0x68, 0xff, 0xfe, 0x9d, 0x9c, 0x58}, 0x7ed7},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			for cpu.GetIP() < 0x100+uint16(len(tt.instruction)) {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().AX != tt.expectedImage {
+				t.Errorf("Expected pushf to push [%#04x] but got [%#04x]", tt.expectedImage, cpu.GetRegisters().AX)
+			}
+		})
+	}
+}
+
+func Test_FlagsView(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		view          intel8086.FlagsView
+		expectedFlags uint16
+	}{
+		{"TestNone", intel8086.FlagsView{}, 0x3000},
+		{"TestCarryZero", intel8086.FlagsView{CF: true, ZF: true}, 0x3041},
+		{"TestArithmetic", intel8086.FlagsView{PF: true, AF: true, SF: true, OF: true}, 0x3894},
+		{"TestControl", intel8086.FlagsView{TF: true, IF: true, DF: true}, 0x3700},
+		{"TestAll", intel8086.FlagsView{CF: true, PF: true, AF: true, ZF: true, SF: true, TF: true, IF: true, DF: true, OF: true}, 0x3fd5},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			// IOPL is left alone
+			cpu.GetRegisters().FLAGS = 0x3fd5
+			cpu.SetFlags(intel8086.FlagsView{})
+			cpu.SetFlags(tt.view)
+
+			if cpu.GetRegisters().FLAGS != tt.expectedFlags {
+				t.Errorf("Expected FLAGS [%#04x] but got [%#04x]", tt.expectedFlags, cpu.GetRegisters().FLAGS)
+			}
+			if cpu.Flags() != tt.view {
+				t.Errorf("Expected to read back %+v but got %+v", tt.view, cpu.Flags())
+			}
+		})
+	}
+}
+
+func Test_ArithmeticFlags(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		al          uint8
+		bx          uint16
+		expectedCF  bool
+		expectedZF  bool
+		expectedSF  bool
+		expectedOF  bool
+	}{
+		// cmp al, imm8
+		{"TestCmpSignedOverflow", []uint8{0x3c, 0x01}, 0x80, 0, false, false, false, true},
+		{"TestCmpBorrow", []uint8{0x3c, 0x02}, 0x01, 0, true, false, true, false},
+		{"TestCmpEqual", []uint8{0x3c, 0x42}, 0x42, 0, false, true, false, false},
+		// add al, imm8
+		{"TestAddCarryToZero", []uint8{0x04, 0x01}, 0xff, 0, true, true, false, false},
+		// add bx, imm8 and sub bx, imm8, the immediate is sign extended
+		{"TestAddWordSignedOverflow", []uint8{0x83, 0xc3, 0x01}, 0, 0x7fff, false, false, true, true},
+		{"TestSubSignExtendedImmediate", []uint8{0x83, 0xeb, 0xff}, 0, 0x0001, true, false, false, false},
+		// sub bx, bx
+		{"TestSubSelf", []uint8{0x29, 0xdb}, 0, 0x1234, false, true, false, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().AL = tt.al
+			cpu.GetRegisters().BX = tt.bx
+
+			cpu.Step()
+
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetFlag(intel8086.SignFlag) != tt.expectedSF {
+				t.Errorf("Expected SF %t but got %t", tt.expectedSF, cpu.GetFlag(intel8086.SignFlag))
+			}
+			if cpu.GetFlag(intel8086.OverFlowFlag) != tt.expectedOF {
+				t.Errorf("Expected OF %t but got %t", tt.expectedOF, cpu.GetFlag(intel8086.OverFlowFlag))
+			}
+		})
+	}
+}
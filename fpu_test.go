@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_FpuControlWord(t *testing.T) {
+
+	// fldcw [0x1200]; fnstcw [0x1202]
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xd9, 0x2e, 0x00, 0x12, 0xd9, 0x3e, 0x02, 0x12})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.SetFeatures(intel8086.CpuFeatures{FloatingPoint: true})
+	mem.WriteAddr16(0x1200, 0x027f)
+
+	if cpu.GetFpuControlWord() != intel8086.FpuControlWordInit {
+		t.Errorf("Expected the control word to start at [%#04x] but got [%#04x]", intel8086.FpuControlWordInit, cpu.GetFpuControlWord())
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetFpuControlWord() != 0x027f {
+		t.Errorf("Expected control word [%#04x] but got [%#04x]", 0x027f, cpu.GetFpuControlWord())
+	}
+	if stored, _ := mem.ReadAddr16(0x1202); stored != 0x027f {
+		t.Errorf("Expected fnstcw to store [%#04x] but got [%#04x]", 0x027f, stored)
+	}
+	if cpu.GetIP() != 0x108 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x108, cpu.GetIP())
+	}
+}
+
+func Test_FpuSaveRestore(t *testing.T) {
+
+	instructions := []uint8{
+		0xd9, 0xe8, // fld1
+		0xd9, 0xeb, // fldpi
+		0xdd, 0x36, 0x00, 0x10, // fnsave [0x1000]
+		0xd9, 0xee, // fldz
+		0xdd, 0x26, 0x00, 0x10, // frstor [0x1000]
+		0xdf, 0xe0, // fnstsw ax
+		0xdd, 0x36, 0x00, 0x11, // fnsave [0x1100]
+	}
+	testPc := newTestPcWithInstructions(0x100, instructions)
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.SetFeatures(intel8086.CpuFeatures{FloatingPoint: true})
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	// top is 6, ST(0) pi and ST(1) 1.0 in physical registers 6 and 7
+	expectedHeader := []uint16{0x037f, 0x3000, 0x0fff}
+	for i, expected := range expectedHeader {
+		if word, _ := mem.ReadAddr16(0x1000 + uint32(i)*2); word != expected {
+			t.Errorf("Expected image word %d [%#04x] but got [%#04x]", i, expected, word)
+		}
+	}
+	if low, _ := mem.ReadAddr32(0x1000 + 14); low != 0x2168c235 {
+		t.Errorf("Expected ST(0) low significand [%#08x] but got [%#08x]", 0x2168c235, low)
+	}
+	if high, _ := mem.ReadAddr32(0x1000 + 18); high != 0xc90fdaa2 {
+		t.Errorf("Expected ST(0) high significand [%#08x] but got [%#08x]", 0xc90fdaa2, high)
+	}
+	if exponent, _ := mem.ReadAddr16(0x1000 + 22); exponent != 0x4000 {
+		t.Errorf("Expected ST(0) exponent [%#04x] but got [%#04x]", 0x4000, exponent)
+	}
+	if high, _ := mem.ReadAddr32(0x1000 + 28); high != 0x80000000 {
+		t.Errorf("Expected ST(1) high significand [%#08x] but got [%#08x]", 0x80000000, high)
+	}
+	if exponent, _ := mem.ReadAddr16(0x1000 + 32); exponent != 0x3fff {
+		t.Errorf("Expected ST(1) exponent [%#04x] but got [%#04x]", 0x3fff, exponent)
+	}
+	if cpu.GetFpuTagWord() != intel8086.FpuTagWordEmpty || cpu.GetFpuStatusWord() != 0 {
+		t.Errorf("Expected fnsave to reinitialise the fpu but got status [%#04x] tags [%#04x]", cpu.GetFpuStatusWord(), cpu.GetFpuTagWord())
+	}
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().AX != 0x3000 {
+		t.Errorf("Expected fnstsw ax to read [%#04x] but got [%#04x]", 0x3000, cpu.GetRegisters().AX)
+	}
+	first := make([]uint8, 94)
+	second := make([]uint8, 94)
+	for i := range first {
+		first[i], _ = mem.ReadAddr8(0x1000 + uint32(i))
+		second[i], _ = mem.ReadAddr8(0x1100 + uint32(i))
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected the restored state to save the same image\n% x\n% x", first, second)
+	}
+}
+
+func Test_FpuStackOverflow(t *testing.T) {
+
+	// nine fld1, one more than there are registers
+	testPc := newTestPcWithInstructions(0x100, bytes.Repeat([]uint8{0xd9, 0xe8}, 9))
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetFeatures(intel8086.CpuFeatures{FloatingPoint: true})
+
+	for i := 0; i < 8; i++ {
+		cpu.Step()
+	}
+	if cpu.GetFpuStatusWord() != 0 || cpu.GetFpuTagWord() != 0 {
+		t.Errorf("Expected a full stack of valid registers but got status [%#04x] tags [%#04x]", cpu.GetFpuStatusWord(), cpu.GetFpuTagWord())
+	}
+
+	cpu.Step()
+
+	expectedStatus := uint16(7<<11 | intel8086.FpuStatusC1 | intel8086.FpuStatusStackFault | intel8086.FpuStatusInvalidOperation)
+	if cpu.GetFpuStatusWord() != expectedStatus {
+		t.Errorf("Expected status [%#04x] but got [%#04x]", expectedStatus, cpu.GetFpuStatusWord())
+	}
+	if significand, exponent := cpu.GetFpuStackRegister(0); significand != 0xc000000000000000 || exponent != 0xffff {
+		t.Errorf("Expected the indefinite in ST(0) but got [%#016x] [%#04x]", significand, exponent)
+	}
+}
+
+func Test_FpuRaisesNm(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		features intel8086.CpuFeatures
+		cr0      uint32
+	}{
+		{"TestNoCoprocessor", intel8086.CpuFeatures{}, 0},
+		{"TestEmulation", intel8086.CpuFeatures{FloatingPoint: true}, intel8086.ControlRegisterEmulation},
+		{"TestTaskSwitched", intel8086.CpuFeatures{FloatingPoint: true}, intel8086.ControlRegisterTaskSwitched},
+	}
+	for _, tt := range tests {
+
+		// fld1
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xd9, 0xe8})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(tt.features)
+			cpu.GetRegisters().CR0 |= tt.cr0
+			cpu.GetRegisters().SP = 0x2000
+
+			// #NM handler at 0000:0500
+			mem.WriteAddr16(0x07*4, 0x0500)
+			mem.WriteAddr16(0x07*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != 0x0500 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+			}
+			if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+				t.Errorf("Expected the fault to return to the fld1 [%#04x] but got [%#04x]", 0x0100, returnIP)
+			}
+			if cpu.GetFpuTagWord() != intel8086.FpuTagWordEmpty {
+				t.Errorf("Expected the stack to be left empty but got tags [%#04x]", cpu.GetFpuTagWord())
+			}
+		})
+	}
+}
+
+func Test_FpuWait(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		cr0        uint32
+		expectedIP uint16
+	}{
+		{"TestWait", 0, 0x101},
+		{"TestWaitTaskSwitched", intel8086.ControlRegisterTaskSwitched, 0x101},
+		{"TestWaitMonitored", intel8086.ControlRegisterMonitorCoprocessor | intel8086.ControlRegisterTaskSwitched, 0x0500},
+	}
+	for _, tt := range tests {
+
+		// wait
+		testPc := newTestPcWithInstructions(0x100, []uint8{0x9b})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().CR0 |= tt.cr0
+			cpu.GetRegisters().SP = 0x2000
+			mem.WriteAddr16(0x07*4, 0x0500)
+			mem.WriteAddr16(0x07*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
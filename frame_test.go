@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_EnterLeave(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		expectedBP    uint16
+		expectedSP    uint16
+		expectedStack []uint16 // words from SP after enter
+	}{
+		// enter 8, 0: push bp and reserve 8 bytes
+		{"TestNoNesting", []uint8{0xc8, 0x08, 0x00, 0x00}, 0x1ffe, 0x1ff6, nil},
+		// enter 4, 2: copies the enclosing frame pointer then pushes the new one
+		{"TestNested", []uint8{0xc8, 0x04, 0x00, 0x02}, 0x1ffe, 0x1ff6, []uint16{0, 0, 0x1ffe, 0xaaaa, 0x3000}},
+		// enter 0, 1: the new frame pointer is the only display word
+		{"TestLevelOne", []uint8{0xc8, 0x00, 0x00, 0x01}, 0x1ffe, 0x1ffc, []uint16{0x1ffe, 0x3000}},
+		// the level is taken modulo 32
+		{"TestLevelWraps", []uint8{0xc8, 0x00, 0x00, 0x21}, 0x1ffe, 0x1ffc, []uint16{0x1ffe, 0x3000}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, append(tt.instruction, 0xc9))
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x2ffe, 0xaaaa)
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().BP = 0x3000
+
+			cpu.Step()
+
+			if cpu.GetRegisters().BP != tt.expectedBP || cpu.GetRegisters().SP != tt.expectedSP {
+				t.Errorf("Expected BP [%#04x] and SP [%#04x] but got [%#04x] and [%#04x]", tt.expectedBP, tt.expectedSP, cpu.GetRegisters().BP, cpu.GetRegisters().SP)
+			}
+			for i, expected := range tt.expectedStack {
+				if value, _ := mem.ReadAddr16(uint32(tt.expectedSP) + uint32(i*2)); value != expected {
+					t.Errorf("Expected [%#04x] at SP+%d but got [%#04x]", expected, i*2, value)
+				}
+			}
+
+			cpu.Step() // leave
+
+			if cpu.GetRegisters().BP != 0x3000 || cpu.GetRegisters().SP != 0x2000 {
+				t.Errorf("Expected leave to restore BP [%#04x] and SP [%#04x] but got [%#04x] and [%#04x]", 0x3000, 0x2000, cpu.GetRegisters().BP, cpu.GetRegisters().SP)
+			}
+		})
+	}
+}
+
+func Test_Enter32BitOperands(t *testing.T) {
+
+	// enter 4, 3 and leave with 32 bit operands on a 16 bit stack
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0xc8, 0x04, 0x00, 0x03, 0x66, 0xc9})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr32(0x2ffc, 0x11111111)
+	mem.WriteAddr32(0x2ff8, 0x22222222)
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().BP = 0x3000
+
+	cpu.Step()
+
+	if cpu.GetRegisters().BP != 0x1ffc || cpu.GetRegisters().SP != 0x1fec {
+		t.Errorf("Expected BP [%#04x] and SP [%#04x] but got [%#04x] and [%#04x]", 0x1ffc, 0x1fec, cpu.GetRegisters().BP, cpu.GetRegisters().SP)
+	}
+	for i, expected := range []uint32{0x00001ffc, 0x22222222, 0x11111111, 0x00003000} {
+		if value, _ := mem.ReadAddr32(0x1ff0 + uint32(i*4)); value != expected {
+			t.Errorf("Expected display dword [%#08x] at [%#04x] but got [%#08x]", expected, 0x1ff0+i*4, value)
+		}
+	}
+
+	cpu.Step() // leave
+
+	if cpu.GetRegisters().EBP != 0x00003000 || cpu.GetRegisters().BP != 0x3000 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected EBP [%#08x] and SP [%#04x] but got [%#08x] and [%#04x]", 0x3000, 0x2000, cpu.GetRegisters().EBP, cpu.GetRegisters().SP)
+	}
+}
+
+func Test_EnterWith32BitStackSegment(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data segment with the B bit set, base 0, limit 0xfffff with 4k granularity
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00},
+	}
+
+	// mov ax, 0x08; mov ss, ax; enter 0x10, 2; leave, with 32 bit operands
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd0, 0x66, 0xc8, 0x10, 0x00, 0x02, 0x66, 0xc9})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr32(0x00012ffc, 0xdeadbeef)
+	cpu.GetRegisters().ESP = 0x00012000
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().EBP = 0x00013000
+	cpu.GetRegisters().BP = 0x3000
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step() // enter
+
+	if cpu.GetRegisters().EBP != 0x00011ffc || cpu.GetRegisters().ESP != 0x00011fe4 {
+		t.Errorf("Expected EBP [%#08x] and ESP [%#08x] but got [%#08x] and [%#08x]", 0x00011ffc, 0x00011fe4, cpu.GetRegisters().EBP, cpu.GetRegisters().ESP)
+	}
+	for i, expected := range []uint32{0x00011ffc, 0xdeadbeef, 0x00013000} {
+		if value, _ := mem.ReadAddr32(0x00011ff4 + uint32(i*4)); value != expected {
+			t.Errorf("Expected display dword [%#08x] at [%#08x] but got [%#08x]", expected, 0x00011ff4+i*4, value)
+		}
+	}
+
+	cpu.Step() // leave
+
+	if cpu.GetRegisters().EBP != 0x00013000 || cpu.GetRegisters().ESP != 0x00012000 {
+		t.Errorf("Expected EBP [%#08x] and ESP [%#08x] but got [%#08x] and [%#08x]", 0x00013000, 0x00012000, cpu.GetRegisters().EBP, cpu.GetRegisters().ESP)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086/asm"
+	"github.com/andrewjc/threeatesix/pc"
+)
+
+// builds a new pc with the cpu initialised and the boot vector unlocked
+func newTestPc() *pc.PersonalComputer {
+	testPc := pc.NewPc()
+	testPc.GetPrimaryCpu().Init(testPc.GetBus())
+	testPc.GetMemoryController().UnlockBootVector()
+	return testPc
+}
+
+// builds a new pc and loads the instructions at 0000:ip
+func newTestPcWithInstructions(ip uint16, instructions []uint8) *pc.PersonalComputer {
+	testPc := newTestPc()
+	testPc.GetPrimaryCpu().SetCS(0x0)
+	testPc.GetPrimaryCpu().SetIP(ip)
+
+	for x := 0; x < len(instructions); x++ {
+		testPc.GetMemoryController().WriteAddr8(uint32(ip)+uint32(x), instructions[x])
+	}
+
+	return testPc
+}
+
+// builds a new pc and assembles the source at 0000:ip
+func newTestPcWithProgram(ip uint16, source string) *pc.PersonalComputer {
+	return newTestPcWithInstructions(ip, asm.MustAssemble(ip, source))
+}
+
+// writes each block of instructions at its address
+func writeTestCode(testPc *pc.PersonalComputer, blocks map[uint32][]uint8) {
+	for addr, code := range blocks {
+		for i, b := range code {
+			testPc.GetMemoryController().WriteAddr8(addr+uint32(i), b)
+		}
+	}
+}
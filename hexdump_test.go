@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_HexDump(t *testing.T) {
+
+	testPc := newTestPcWithInstructions(0x100, []uint8{})
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x7c00: []uint8("Hello, world!\x00\x01\x02threeatesix"),
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	expected := "" +
+		"00007c00  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 00 01 02  |Hello, world!...|\n" +
+		"00007c10  74 68 72 65 65 61 74 65  73 69 78                 |threeatesix|\n"
+
+	if dump := cpu.HexDump(0x7c00, 27); dump != expected {
+		t.Errorf("Expected linear dump\n%s but got\n%s", expected, dump)
+	}
+
+	expectedSegment := "" +
+		"07c0:0007  77 6f 72 6c 64 21 00 01                           |world!..|\n"
+
+	dump, err := cpu.HexDumpSegment(0x07c0, 0x0007, 8)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	if dump != expectedSegment {
+		t.Errorf("Expected segment dump\n%s but got\n%s", expectedSegment, dump)
+	}
+
+	if dump := cpu.HexDump(0x7c00, 0); dump != "" {
+		t.Errorf("Expected an empty dump for zero length but got %q", dump)
+	}
+}
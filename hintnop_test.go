@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_HintNop(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+	}{
+		// prefetchnta [0x0600]
+		{"TestPrefetchDisplacement", []uint8{0x0f, 0x18, 0x06, 0x00, 0x06}},
+		// prefetcht0 [bp+0x10]
+		{"TestPrefetchDisp8", []uint8{0x0f, 0x18, 0x4e, 0x10}},
+		// 0x0F 0x18 /4 is a reserved hint
+		{"TestReservedPrefetch", []uint8{0x0f, 0x18, 0x20}},
+		// nop [bx+si]
+		{"TestNopMemory", []uint8{0x0f, 0x1f, 0x00}},
+		// nop [bx+si+0x0100]
+		{"TestNopDisp16", []uint8{0x0f, 0x1f, 0x80, 0x00, 0x01}},
+		// nop ax
+		{"TestNopRegister", []uint8{0x0f, 0x1f, 0xc0}},
+		// nop dword [eax+eax*1+0x00], the 5 byte pad with its address size prefix
+		{"TestNopSib", []uint8{0x67, 0x0f, 0x1f, 0x44, 0x00, 0x00}},
+		// nop word [eax+eax*1+0x00000000], the 10 byte pad
+		{"TestNopDisp32", []uint8{0x66, 0x67, 0x0f, 0x1f, 0x84, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		// reserved nops through 0x0F 0x1E
+		{"TestReserved19", []uint8{0x0f, 0x19, 0xc0}},
+		{"TestReserved1e", []uint8{0x0f, 0x1e, 0x06, 0x00, 0x06}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(intel8086.CpuFeatures{HintNop: true})
+			testPc.GetMemoryController().WriteAddr16(0x0600, 0x1234)
+			cpu.GetRegisters().AX = 0xffff
+
+			before := cpu.SnapshotRegisters()
+			cpu.Step()
+
+			if diffs := intel8086.DiffSnapshots(before, cpu.SnapshotRegisters()); len(diffs) != 0 {
+				t.Errorf("Expected no register changes but got %s", intel8086.FormatDiffs(diffs))
+			}
+			if value, _ := testPc.GetMemoryController().ReadAddr16(0x0600); value != 0x1234 {
+				t.Errorf("Expected memory to be left alone but got [%#04x]", value)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_HintNopWithoutFeature(t *testing.T) {
+
+	// nop [bx+si] is #UD on a plain 386
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x1f, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+
+	// #UD handler at 0000:0500
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected #UD to the handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+}
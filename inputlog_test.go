@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/pc"
+	"strings"
+	"testing"
+)
+
+// initialises the master pic at vector 0x08 with IRQ0 and IRQ1 unmasked, installs a keyboard handler
+// at 0000:0500 that adds each scancode to BL and a timer handler at 0000:0520 that counts ticks in DX,
+// then runs a loop counting in CX
+func newTestPcWithInputHandlers() *pc.PersonalComputer {
+	// mov al, 0x11; out 0x20, al; mov al, 0x08; out 0x21, al; mov al, 0x04; out 0x21, al
+	// mov al, 0x01; out 0x21, al; mov al, 0xfc; out 0x21, al; sti; loop: inc cx; jmp loop
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xb0, 0x11, 0xe6, 0x20, 0xb0, 0x08, 0xe6, 0x21, 0xb0, 0x04, 0xe6, 0x21,
+		0xb0, 0x01, 0xe6, 0x21, 0xb0, 0xfc, 0xe6, 0x21, 0xfb, 0x41, 0xeb, 0xfd})
+	mem := testPc.GetMemoryController()
+
+	// ivt entry 8 -> 0000:0520, entry 9 -> 0000:0500
+	mem.WriteAddr16(0x08*4, 0x0520)
+	mem.WriteAddr16(0x08*4+2, 0x0000)
+	mem.WriteAddr16(0x09*4, 0x0500)
+	mem.WriteAddr16(0x09*4+2, 0x0000)
+
+	writeTestCode(testPc, map[uint32][]uint8{
+		// in al, 0x60; add bl, al; mov al, 0x20; out 0x20, al; iret
+		0x0500: {0xe4, 0x60, 0x00, 0xc3, 0xb0, 0x20, 0xe6, 0x20, 0xcf},
+		// inc dx; mov al, 0x20; out 0x20, al; iret
+		0x0520: {0x42, 0xb0, 0x20, 0xe6, 0x20, 0xcf},
+	})
+
+	testPc.GetPrimaryCpu().GetRegisters().SP = 0x2000
+
+	return testPc
+}
+
+func stepTestPc(testPc *pc.PersonalComputer, steps int) {
+	for i := 0; i < steps; i++ {
+		testPc.Step()
+	}
+}
+
+func Test_RecordAndReplayInputs(t *testing.T) {
+
+	log := &bytes.Buffer{}
+
+	recorded := newTestPcWithInputHandlers()
+	recorded.RecordInputs(log)
+
+	stepTestPc(recorded, 15)
+	recorded.InjectScancode(0x1e) // 'a' make
+	stepTestPc(recorded, 7)
+	recorded.InjectTimerTick()
+	stepTestPc(recorded, 3)
+	recorded.InjectScancode(0x9e) // 'a' break
+	stepTestPc(recorded, 20)
+
+	if strings.Count(log.String(), "\n") != 3 {
+		t.Errorf("Expected 3 events in the log but got %q", log.String())
+	}
+
+	cpu := recorded.GetPrimaryCpu()
+	if cpu.GetRegisters().BL != 0xbc {
+		t.Errorf("Expected keyboard handler to sum the scancodes to [%#02x] but got [%#02x]", 0xbc, cpu.GetRegisters().BL)
+	}
+	if cpu.GetRegisters().DX != 1 {
+		t.Errorf("Expected timer handler to count 1 tick but got %d", cpu.GetRegisters().DX)
+	}
+
+	replayed := newTestPcWithInputHandlers()
+	err := replayed.ReplayInputs(strings.NewReader(log.String()))
+	if err != nil {
+		t.Fatalf("Expected log to replay but got %s", err.Error())
+	}
+
+	stepTestPc(replayed, 45)
+
+	recordedRegs := recorded.GetPrimaryCpu().GetRegisters()
+	replayedRegs := replayed.GetPrimaryCpu().GetRegisters()
+	for _, reg := range []struct {
+		name     string
+		recorded uint16
+		replayed uint16
+	}{
+		{"AX", recordedRegs.AX, replayedRegs.AX},
+		{"BX", recordedRegs.BX, replayedRegs.BX},
+		{"CX", recordedRegs.CX, replayedRegs.CX},
+		{"DX", recordedRegs.DX, replayedRegs.DX},
+		{"SP", recordedRegs.SP, replayedRegs.SP},
+		{"FLAGS", recordedRegs.FLAGS, replayedRegs.FLAGS},
+		{"IP", recorded.GetPrimaryCpu().GetIP(), replayed.GetPrimaryCpu().GetIP()},
+	} {
+		if reg.recorded != reg.replayed {
+			t.Errorf("Expected replayed %s [%#04x] to match the recorded run but got [%#04x]", reg.name, reg.recorded, reg.replayed)
+		}
+	}
+}
+
+func Test_ReplayInputsRejectsMalformedLog(t *testing.T) {
+
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"TestUnknownEvent", "10 mouse 0x01\n"},
+		{"TestMissingScancode", "10 scancode\n"},
+		{"TestBadCycle", "ten tick\n"},
+	}
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+			testPc := newTestPc()
+			if err := testPc.ReplayInputs(strings.NewReader(tt.log)); err == nil {
+				t.Errorf("Expected %q to be rejected", tt.log)
+			}
+		})
+	}
+}
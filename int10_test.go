@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_Int10Teletype(t *testing.T) {
+
+	// int 0x10, once for each character
+	code := bytes.Repeat([]uint8{0xcd, 0x10}, 64)
+	testPc := newTestPcWithInstructions(0x100, code)
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	video := testPc.GetVideoAdapter()
+
+	teletype := func(characters string) {
+		for _, c := range []byte(characters) {
+			cpu.GetRegisters().AX = 0x0e00 | uint16(c)
+			cpu.Step()
+		}
+	}
+	cell := func(row int, column int) uint8 {
+		value, _ := mem.ReadAddr8(0xb8000 + uint32(row*80+column)*2)
+		return value
+	}
+
+	teletype("Ax\bB\a")
+	if cell(0, 0) != 'A' || cell(0, 1) != 'B' {
+		t.Errorf("Expected the backspace to let B overwrite x but got %q%q", cell(0, 0), cell(0, 1))
+	}
+	if row, column := video.GetCursor(); row != 0 || column != 2 {
+		t.Errorf("Expected the cursor at 0,2 but got %d,%d", row, column)
+	}
+
+	teletype("\r\nC")
+	if cell(1, 0) != 'C' {
+		t.Errorf("Expected C at the start of row 1 but got %q", cell(1, 0))
+	}
+
+	// 23 more rows reaches the bottom of the screen without scrolling
+	teletype(string(bytes.Repeat([]byte{'\n'}, 23)))
+	if row, _ := video.GetCursor(); row != 24 || cell(0, 0) != 'A' {
+		t.Errorf("Expected the cursor on the last row with nothing scrolled but got row %d and %q", row, cell(0, 0))
+	}
+
+	// one more scrolls everything up a row
+	teletype("\n")
+	if row, _ := video.GetCursor(); row != 24 {
+		t.Errorf("Expected the cursor to stay on the last row but got %d", row)
+	}
+	if cell(0, 0) != 'C' {
+		t.Errorf("Expected row 1 to scroll up to row 0 but got %q", cell(0, 0))
+	}
+	if attribute, _ := mem.ReadAddr8(0xb8000 + 24*80*2 + 1); cell(24, 0) != ' ' || attribute != 0x07 {
+		t.Errorf("Expected a blank bottom row but got %q with attribute %#02x", cell(24, 0), attribute)
+	}
+}
+
+func Test_Int10TeletypeWraps(t *testing.T) {
+
+	testPc := newTestPc()
+	video := testPc.GetVideoAdapter()
+	video.SetCursor(24, 79)
+
+	if err := video.Teletype('Z'); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	// the last cell is written, then the screen scrolls to give the cursor a new row
+	if value, _ := testPc.GetMemoryController().ReadAddr8(0xb8000 + (23*80+79)*2); value != 'Z' {
+		t.Errorf("Expected Z to have scrolled up to row 23 but got %q", value)
+	}
+	if row, column := video.GetCursor(); row != 24 || column != 0 {
+		t.Errorf("Expected the cursor at 24,0 but got %d,%d", row, column)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/disk"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// a 20 cylinder hard disk, each sector filled with the low byte of its block number
+func newTestHardDisk(t *testing.T) *disk.Disk {
+	geometry := disk.Geometry{Cylinders: 20, Heads: 16, SectorsPerTrack: 63}
+	image := make([]byte, geometry.Sectors()*disk.SECTOR_SIZE)
+	for i := range image {
+		image[i] = uint8(i / disk.SECTOR_SIZE)
+	}
+
+	hardDisk, err := disk.NewDisk(image, geometry)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return hardDisk
+}
+
+// writes a disk address packet for count sectors from lba to the buffer at segment:offset
+func writeDiskAddressPacket(testPc *pc.PersonalComputer, addr uint32, count uint16, segment uint16, offset uint16, lba uint32) {
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr8(addr, 0x10)
+	mem.WriteAddr8(addr+1, 0)
+	mem.WriteAddr16(addr+2, count)
+	mem.WriteAddr16(addr+4, offset)
+	mem.WriteAddr16(addr+6, segment)
+	mem.WriteAddr32(addr+8, lba)
+	mem.WriteAddr32(addr+12, 0)
+}
+
+func Test_Int13CheckExtensions(t *testing.T) {
+
+	testPc := newTestPcWithProgram(0x100, "mov ah, 0x41\nmov bx, 0x55aa\nmov dl, 0x80\nint 0x13")
+	testPc.AttachDisk(0x80, newTestHardDisk(t))
+	cpu := testPc.GetPrimaryCpu()
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	registers := cpu.GetRegisters()
+	if registers.BX != 0xaa55 || registers.AH != 0x30 || registers.CX&0x0001 == 0 {
+		t.Errorf("Expected BX [aa55] AH [30] and CX bit 0 but got [%#04x] [%#02x] and [%#04x]", registers.BX, registers.AH, registers.CX)
+	}
+	if cpu.GetFlag(intel8086.CarryFlag) {
+		t.Errorf("Expected CF to be clear")
+	}
+}
+
+func Test_Int13ExtendedRead(t *testing.T) {
+
+	testPc := newTestPcWithProgram(0x100, "mov ah, 0x42\nmov dl, 0x80\nmov si, 0x0600\nint 0x13")
+	testPc.AttachDisk(0x80, newTestHardDisk(t))
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	// 2 sectors from block 20000 to 2000:0010
+	writeDiskAddressPacket(testPc, 0x0600, 2, 0x2000, 0x0010, 20000)
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetFlag(intel8086.CarryFlag) || cpu.GetRegisters().AH != 0 {
+		t.Fatalf("Expected success but got CF set with AH [%#02x]", cpu.GetRegisters().AH)
+	}
+	for i, expected := range []uint8{uint8(20000 & 0xff), uint8(20001 & 0xff)} {
+		for _, offset := range []uint32{0, disk.SECTOR_SIZE - 1} {
+			addr := 0x20010 + uint32(i)*disk.SECTOR_SIZE + offset
+			if value, _ := mem.ReadAddr8(addr); value != expected {
+				t.Errorf("Expected [%#02x] at [%#05x] but got [%#02x]", expected, addr, value)
+			}
+		}
+	}
+	if value, _ := mem.ReadAddr8(0x20010 + 2*disk.SECTOR_SIZE); value != 0 {
+		t.Errorf("Expected nothing past the 2 sectors but got [%#02x]", value)
+	}
+	if count, _ := mem.ReadAddr16(0x0602); count != 2 {
+		t.Errorf("Expected the packet to report 2 sectors moved but got %d", count)
+	}
+}
+
+func Test_Int13ExtendedWrite(t *testing.T) {
+
+	testPc := newTestPcWithProgram(0x100, "mov ah, 0x43\nmov dl, 0x80\nmov si, 0x0600\nint 0x13")
+	hardDisk := newTestHardDisk(t)
+	testPc.AttachDisk(0x80, hardDisk)
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	// 1 sector from 0000:0800 to block 15000
+	writeDiskAddressPacket(testPc, 0x0600, 1, 0x0000, 0x0800, 15000)
+	for i := uint32(0); i < disk.SECTOR_SIZE; i++ {
+		mem.WriteAddr8(0x0800+i, 0xa5)
+	}
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetFlag(intel8086.CarryFlag) {
+		t.Fatalf("Expected success but got CF set with AH [%#02x]", cpu.GetRegisters().AH)
+	}
+	sector, _ := hardDisk.ReadSectors(15000, 1)
+	if sector[0] != 0xa5 || sector[disk.SECTOR_SIZE-1] != 0xa5 {
+		t.Errorf("Expected the sector written to the disk but got [%#02x]...[%#02x]", sector[0], sector[disk.SECTOR_SIZE-1])
+	}
+}
+
+func Test_Int13ExtendedErrors(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		drive          uint8
+		function       uint8
+		lba            uint32
+		readOnly       bool
+		expectedStatus uint8
+	}{
+		{"TestPastTheEnd", 0x80, 0x42, 20160 - 1, false, 0x04},
+		{"TestNoDisk", 0x81, 0x42, 0, false, 0x80},
+		{"TestWriteProtected", 0x80, 0x43, 0, true, 0x03},
+		{"TestUnknownFunction", 0x80, 0x47, 0, false, 0x01},
+	}
+	for _, tt := range tests {
+
+		// mov ah, function; mov dl, drive; mov si, 0x0600; int 0x13
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xb4, tt.function, 0xb2, tt.drive, 0xbe, 0x00, 0x06, 0xcd, 0x13})
+		hardDisk := newTestHardDisk(t)
+		hardDisk.SetReadOnly(tt.readOnly)
+		testPc.AttachDisk(0x80, hardDisk)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+
+			// 2 sectors, so the last block on the disk runs past the end
+			writeDiskAddressPacket(testPc, 0x0600, 2, 0x2000, 0x0000, tt.lba)
+
+			for i := 0; i < 4; i++ {
+				cpu.Step()
+			}
+
+			if !cpu.GetFlag(intel8086.CarryFlag) || cpu.GetRegisters().AH != tt.expectedStatus {
+				t.Errorf("Expected CF set with AH [%#02x] but got CF %t with AH [%#02x]", tt.expectedStatus, cpu.GetFlag(intel8086.CarryFlag), cpu.GetRegisters().AH)
+			}
+			if value, _ := mem.ReadAddr8(0x20000); value != 0 {
+				t.Errorf("Expected nothing read to the buffer but got [%#02x]", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// builds a pc with the given amount of ram and loads the instructions at 0000:0100
+func newTestPcWithRam(ramBytes uint32, instructions []uint8) *pc.PersonalComputer {
+	testPc := pc.NewPcWithConfig(pc.MachineConfig{RamBytes: ramBytes})
+	testPc.GetPrimaryCpu().Init(testPc.GetBus())
+	testPc.GetMemoryController().UnlockBootVector()
+	testPc.GetPrimaryCpu().SetCS(0x0)
+	testPc.GetPrimaryCpu().SetIP(0x100)
+	writeTestCode(testPc, map[uint32][]uint8{0x100: instructions})
+	return testPc
+}
+
+// mov ax, 0xe801; int 0x15
+var int15E801 = []uint8{0xb8, 0x01, 0xe8, 0xcd, 0x15}
+
+func Test_Int15MemorySizeE801(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		ramBytes   uint32
+		expectedAX uint16
+		expectedBX uint16
+	}{
+		{"Test4Mb", 0x400000, 0x0c00, 0x0000},
+		{"Test16Mb", 0x1000000, 0x3c00, 0x0000},
+		{"Test32Mb", 0x2000000, 0x3c00, 0x0100},
+		{"TestDefault", 0, (pc.MaxRAMBytes - 0x100000) / 1024, 0x0000},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithRam(tt.ramBytes, int15E801)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().SetFlag(intel8086.CarryFlag, true)
+
+			cpu.Step()
+			cpu.Step()
+
+			registers := cpu.GetRegisters()
+			if registers.AX != tt.expectedAX || registers.CX != tt.expectedAX {
+				t.Errorf("Expected AX and CX [%#04x] but got [%#04x] and [%#04x]", tt.expectedAX, registers.AX, registers.CX)
+			}
+			if registers.BX != tt.expectedBX || registers.DX != tt.expectedBX {
+				t.Errorf("Expected BX and DX [%#04x] but got [%#04x] and [%#04x]", tt.expectedBX, registers.BX, registers.DX)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) {
+				t.Errorf("Expected CF to be clear")
+			}
+			if cpu.GetIP() != 0x105 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x105, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_Int15ExtendedMemorySize(t *testing.T) {
+
+	// mov ax, 0x8800; int 0x15
+	testPc := newTestPcWithRam(0x400000, []uint8{0xb8, 0x00, 0x88, 0xcd, 0x15})
+	cpu := testPc.GetPrimaryCpu()
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetRegisters().AX != 0x0c00 {
+		t.Errorf("Expected AX [%#04x] but got [%#04x]", 0x0c00, cpu.GetRegisters().AX)
+	}
+}
+
+func Test_Int15MemoryMapE820(t *testing.T) {
+
+	// int 0x15, once for each entry and once more
+	testPc := newTestPcWithRam(0x400000, []uint8{0xcd, 0x15, 0xcd, 0x15, 0xcd, 0x15, 0xcd, 0x15, 0xcd, 0x15})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	expected := []struct {
+		base   uint32
+		length uint32
+		kind   uint32
+	}{
+		{0x00000000, 0x0009fc00, 1},
+		{0x0009fc00, 0x00000400, 2},
+		{0x000f0000, 0x00010000, 2},
+		{0x00100000, 0x00300000, 1},
+	}
+
+	registers := cpu.GetRegisters()
+	registers.EBX = 0
+	registers.DI = 0x0600
+
+	for i, entry := range expected {
+		registers.EAX = 0xe820
+		registers.ECX = 20
+		registers.EDX = 0x534d4150
+
+		cpu.Step()
+
+		if cpu.GetFlag(intel8086.CarryFlag) {
+			t.Fatalf("Expected entry %d to be returned but CF was set", i)
+		}
+		if registers.EAX != 0x534d4150 || registers.ECX != 20 {
+			t.Errorf("Expected EAX 'SMAP' and ECX 20 but got [%#08x] and %d", registers.EAX, registers.ECX)
+		}
+
+		base, _ := mem.ReadAddr32(0x0600)
+		length, _ := mem.ReadAddr32(0x0608)
+		kind, _ := mem.ReadAddr32(0x0610)
+		if base != entry.base || length != entry.length || kind != entry.kind {
+			t.Errorf("Expected entry %d to be %#08x+%#08x type %d but got %#08x+%#08x type %d", i, entry.base, entry.length, entry.kind, base, length, kind)
+		}
+	}
+
+	if registers.EBX != 0 {
+		t.Errorf("Expected EBX 0 after the last entry but got %d", registers.EBX)
+	}
+
+	// a bad signature is refused
+	registers.EAX = 0xe820
+	registers.EDX = 0
+
+	cpu.Step()
+
+	if !cpu.GetFlag(intel8086.CarryFlag) || registers.AX>>8 != 0x86 {
+		t.Errorf("Expected CF set with AH 0x86 but got CF %t AX [%#04x]", cpu.GetFlag(intel8086.CarryFlag), registers.AX)
+	}
+}
+
+func Test_Int15A20(t *testing.T) {
+
+	// int 0x15, once for each call
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xcd, 0x15, 0xcd, 0x15, 0xcd, 0x15, 0xcd, 0x15})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	call := func(ax uint16) {
+		cpu.GetRegisters().AX = ax
+		cpu.Step()
+		if cpu.GetFlag(intel8086.CarryFlag) {
+			t.Errorf("Expected AX=%#04x to succeed but CF was set", ax)
+		}
+	}
+
+	if !mem.IsA20Enabled() {
+		t.Fatalf("Expected the A20 gate to start out enabled")
+	}
+
+	call(0x2400)
+	if mem.IsA20Enabled() {
+		t.Errorf("Expected AX=2400h to disable the A20 gate")
+	}
+
+	// with the gate closed 1MB wraps onto 0
+	mem.WriteAddr8(0x100600, 0x5a)
+	if value, _ := mem.ReadAddr8(0x000600); value != 0x5a {
+		t.Errorf("Expected the write to wrap to [%#06x] but read [%#02x]", 0x000600, value)
+	}
+	if value, _ := mem.ReadAddr16(0x1005ff); value != 0x5a00 {
+		t.Errorf("Expected the read to wrap to [%#06x] but read [%#04x]", 0x0005ff, value)
+	}
+
+	call(0x2402)
+	if cpu.GetRegisters().AX != 0 {
+		t.Errorf("Expected AX=2402h to report the gate disabled but got [%#04x]", cpu.GetRegisters().AX)
+	}
+
+	call(0x2401)
+	if !mem.IsA20Enabled() {
+		t.Errorf("Expected AX=2401h to enable the A20 gate")
+	}
+	mem.WriteAddr8(0x100600, 0xa5)
+	if value, _ := mem.ReadAddr8(0x000600); value != 0x5a {
+		t.Errorf("Expected the write above 1MB to leave [%#06x] alone but read [%#02x]", 0x000600, value)
+	}
+
+	call(0x2402)
+	if cpu.GetRegisters().AX != 1 {
+		t.Errorf("Expected AX=2402h to report the gate enabled but got [%#04x]", cpu.GetRegisters().AX)
+	}
+}
+
+func Test_SoftwareInterrupt(t *testing.T) {
+
+	// int 0x21
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xcd, 0x21})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().SetFlag(intel8086.InterruptFlag, true)
+
+	// handler at 0000:0500
+	mem.WriteAddr16(0x21*4, 0x0500)
+	mem.WriteAddr16(0x21*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0102 {
+		t.Errorf("Expected the handler to return to [%#04x] but got [%#04x]", 0x0102, returnIP)
+	}
+	if cpu.GetFlag(intel8086.InterruptFlag) {
+		t.Errorf("Expected IF to be cleared")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// A 64KB bios which adds 1 to 10 through a subroutine, writes the sum and then the 0xaa sentinel to port 0xe9
+// and halts
+func newTestBootBios() []byte {
+	image := make([]byte, pc.BiosImageSize64K)
+
+	code := map[uint32][]uint8{
+		// reset vector: jmp 0xf000:0xe000
+		0xfff0: {0xea, 0x00, 0xe0, 0x00, 0xf0},
+
+		0xe000: {
+			0xb8, 0x00, 0x00, // mov ax, 0
+			0x8e, 0xd0, // mov ss, ax
+			0xbc, 0x00, 0x70, // mov sp, 0x7000
+			0xb9, 0x0a, 0x00, // mov cx, 10
+			0xbb, 0x00, 0x00, // mov bx, 0
+			0x51,             // loop: push cx
+			0xe8, 0x1e, 0x00, // call add_cx
+			0x59,             // pop cx
+			0x49,             // dec cx
+			0x83, 0xf9, 0x00, // cmp cx, 0
+			0x75, 0xf5, // jnz loop
+			0x89, 0xd8, // mov ax, bx
+			0xe7, 0xe9, // out 0xe9, ax
+			0xb0, 0xaa, // mov al, 0xaa
+			0xe6, 0xe9, // out 0xe9, al
+			0xf4, // hlt
+		},
+
+		// add_cx: add bx, cx; ret
+		0xe030: {0x01, 0xcb, 0xc3},
+	}
+	for offset, bytes := range code {
+		copy(image[offset:], bytes)
+	}
+
+	return image
+}
+
+func Test_BootToSentinel(t *testing.T) {
+
+	testPc := pc.NewPc()
+	err := testPc.LoadBiosImage(newTestBootBios(), pc.BiosImageOptions{})
+	if err != nil {
+		t.Fatalf("Failed to load the bios: %s", err)
+	}
+
+	port := &stubPortDevice{}
+	testPc.GetIOPortController().AttachPortDevice(0xe9, 0xe9, port)
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.Init(testPc.GetBus())
+
+	steps, err := testPc.RunSteps(200, func() bool {
+		return len(port.output) > 0 && port.output[len(port.output)-1] == 0xaa
+	})
+	if err != nil {
+		t.Fatalf("Expected the bios to write the sentinel but got %s with output %#02x", err, port.output)
+	}
+
+	if len(port.output) != 2 || port.output[0] != 55 {
+		t.Errorf("Expected the sum 55 then the sentinel on port 0xe9 but got %#02x", port.output)
+	}
+	if cpu.GetRegisters().SP != 0x7000 {
+		t.Errorf("Expected the pushes and calls to balance leaving SP [%#04x] but got [%#04x]", 0x7000, cpu.GetRegisters().SP)
+	}
+	if cpu.GetCS() != 0xf000 || cpu.GetIP() != 0xe021 {
+		t.Errorf("Expected to stop after the last out at [f000:e023] but got [%04x:%04x] after %d steps", cpu.GetCS(), cpu.GetIP(), steps)
+	}
+}
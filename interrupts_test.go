@@ -0,0 +1,432 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+// initialises the master pic at vector 0x08 with only IRQ0 unmasked and installs
+// an IRQ0 handler at 0000:0500 that sends an EOI and returns
+func newTestPcWithIrq0Handler(instructions []uint8) *pc.PersonalComputer {
+	// mov al, 0x11; out 0x20, al; mov al, 0x08; out 0x21, al; mov al, 0x04; out 0x21, al
+	// mov al, 0x01; out 0x21, al; mov al, 0xfe; out 0x21, al
+	picInit := []uint8{0xb0, 0x11, 0xe6, 0x20, 0xb0, 0x08, 0xe6, 0x21, 0xb0, 0x04, 0xe6, 0x21,
+		0xb0, 0x01, 0xe6, 0x21, 0xb0, 0xfe, 0xe6, 0x21}
+
+	testPc := newTestPcWithInstructions(0x100, append(picInit, instructions...))
+	mem := testPc.GetMemoryController()
+
+	// ivt entry 8 -> 0000:0500
+	mem.WriteAddr16(0x08*4, 0x0500)
+	mem.WriteAddr16(0x08*4+2, 0x0000)
+
+	// mov al, 0x20; out 0x20, al; iret
+	for i, b := range []uint8{0xb0, 0x20, 0xe6, 0x20, 0xcf} {
+		mem.WriteAddr8(0x0500+uint32(i), b)
+	}
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+	for i := 0; i < 10; i++ {
+		cpu.Step()
+	}
+
+	return testPc
+}
+
+func Test_HardwareInterruptDispatch(t *testing.T) {
+
+	// sti; nop; nop
+	testPc := newTestPcWithIrq0Handler([]uint8{0xfb, 0x90, 0x90})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	if testPc.GetMasterInterruptController().GetVectorBase() != 0x08 {
+		t.Errorf("Expected pic vector base [%#02x] but got [%#02x]", 0x08, testPc.GetMasterInterruptController().GetVectorBase())
+	}
+
+	testPc.GetMasterInterruptController().RaiseIrq(0)
+
+	cpu.Step() // sti
+	cpu.Step() // nop, interrupts are held off for one instruction after sti
+
+	if cpu.GetIP() != 0x0116 {
+		t.Errorf("Expected interrupt to be delayed until after the instruction following sti, IP [%#04x] but got [%#04x]", 0x0116, cpu.GetIP())
+	}
+
+	cpu.Step() // interrupt dispatched, mov al, 0x20 in handler
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0502 {
+		t.Errorf("Expected handler at [0000:0502] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetFlag(intel8086.InterruptFlag) {
+		t.Errorf("Expected interrupt flag to be cleared in the handler")
+	}
+	if cpu.GetRegisters().SP != 0x2000-6 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000-6, cpu.GetRegisters().SP)
+	}
+	if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0116 {
+		t.Errorf("Expected return IP [%#04x] on the stack but got [%#04x]", 0x0116, returnIP)
+	}
+
+	cpu.Step() // out 0x20, al (eoi)
+	cpu.Step() // iret
+
+	if cpu.GetIP() != 0x0116 {
+		t.Errorf("Expected iret to return to [%#04x] but got [%#04x]", 0x0116, cpu.GetIP())
+	}
+	if !cpu.GetFlag(intel8086.InterruptFlag) {
+		t.Errorf("Expected interrupt flag to be restored by iret")
+	}
+	if testPc.GetMasterInterruptController().GetInServiceRegister() != 0 {
+		t.Errorf("Expected EOI to clear the in service register but got [%#02x]", testPc.GetMasterInterruptController().GetInServiceRegister())
+	}
+}
+
+func Test_HardwareInterruptWakesHalt(t *testing.T) {
+
+	// sti; hlt; nop
+	testPc := newTestPcWithIrq0Handler([]uint8{0xfb, 0xf4, 0x90})
+	cpu := testPc.GetPrimaryCpu()
+
+	cpu.Step() // sti
+	cpu.Step() // hlt
+	cpu.Step() // halted, nothing pending
+
+	if !cpu.IsHalted() || cpu.GetIP() != 0x0116 {
+		t.Errorf("Expected cpu to be halted at [%#04x] but got halted=%v at [%#04x]", 0x0116, cpu.IsHalted(), cpu.GetIP())
+	}
+
+	testPc.GetMasterInterruptController().RaiseIrq(0)
+	cpu.Step()
+
+	if cpu.IsHalted() {
+		t.Errorf("Expected interrupt to wake the halted cpu")
+	}
+	if cpu.GetIP() != 0x0502 {
+		t.Errorf("Expected handler IP [%#04x] but got [%#04x]", 0x0502, cpu.GetIP())
+	}
+}
+
+func Test_HardwareInterruptBreaksIdleLoop(t *testing.T) {
+
+	// sti; jmp $
+	testPc := newTestPcWithIrq0Handler([]uint8{0xfb, 0xeb, 0xfe})
+	cpu := testPc.GetPrimaryCpu()
+
+	// spinning on the jmp with nothing pending
+	for i := 0; i < 5; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetIP() != 0x0115 {
+		t.Fatalf("Expected the cpu to spin at [%#04x] but got [%#04x]", 0x0115, cpu.GetIP())
+	}
+
+	testPc.GetMasterInterruptController().RaiseIrq(0)
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0502 {
+		t.Fatalf("Expected handler at [0000:0502] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+
+	cpu.Step() // out 0x20, al (eoi)
+	cpu.Step() // iret
+
+	if cpu.GetIP() != 0x0115 {
+		t.Errorf("Expected iret to return to the loop at [%#04x] but got [%#04x]", 0x0115, cpu.GetIP())
+	}
+}
+
+func Test_MaskedInterruptNotDispatched(t *testing.T) {
+
+	// sti; nop; nop
+	testPc := newTestPcWithIrq0Handler([]uint8{0xfb, 0x90, 0x90})
+	cpu := testPc.GetPrimaryCpu()
+
+	// IRQ1 is masked
+	testPc.GetMasterInterruptController().RaiseIrq(1)
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetIP() != 0x0117 {
+		t.Errorf("Expected masked interrupt to be ignored, IP [%#04x] but got [%#04x]", 0x0117, cpu.GetIP())
+	}
+}
+
+// builds a pc in protected mode running at ring 3 at 0x1b:0x0200 with the stack at 0x23:0x2000, a 16 bit TSS
+// at 0x3000 whose ring 0 stack is 0x10:0x4000, and an IDT at 0x1800 holding the given gates
+func newTestPcAtRing3WithIdt(gates map[uint8][]uint8) *pc.PersonalComputer {
+	gdt := [][]uint8{
+		// 0x08: ring 0 code, base 0, limit 0xffff
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x10: ring 0 data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x18: ring 3 code
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0xfa, 0x00, 0x00},
+		// 0x20: ring 3 data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0xf2, 0x00, 0x00},
+		// 0x28: available 16 bit TSS, base 0x3000, limit 0x2b
+		{0x2b, 0x00, 0x00, 0x30, 0x00, 0x81, 0x00, 0x00},
+	}
+
+	// lidt [0x0810]; mov ax, 0x28; ltr ax; push 0x23; push 0x2000; push 0x1b; push 0x0200; retf
+	testPc := newTestPcWithGdt(gdt, []uint8{
+		0x0f, 0x01, 0x1e, 0x10, 0x08,
+		0xb8, 0x28, 0x00, 0x0f, 0x00, 0xd8,
+		0x68, 0x23, 0x00, 0x68, 0x00, 0x20, 0x68, 0x1b, 0x00, 0x68, 0x00, 0x02, 0xcb,
+	})
+	mem := testPc.GetMemoryController()
+
+	// idtr pseudo descriptor: limit 0x007f, base 0x00001800
+	mem.WriteAddr16(0x0810, 0x007f)
+	mem.WriteAddr16(0x0812, 0x1800)
+	mem.WriteAddr16(0x0814, 0x0000)
+
+	for vector, gate := range gates {
+		for i, b := range gate {
+			mem.WriteAddr8(0x1800+uint32(vector)*8+uint32(i), b)
+		}
+	}
+
+	// ring 0 stack in the TSS: SP0 0x4000, SS0 0x10
+	mem.WriteAddr16(0x3002, 0x4000)
+	mem.WriteAddr16(0x3004, 0x0010)
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x1000
+	for i := 0; i < 8; i++ {
+		cpu.Step()
+	}
+
+	return testPc
+}
+
+func Test_InterruptInnerPrivilegeStackSwitch(t *testing.T) {
+
+	// #GP interrupt gate to 0008:0600
+	testPc := newTestPcAtRing3WithIdt(map[uint8][]uint8{
+		0x0d: {0x00, 0x06, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00},
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	if cpu.GetCS() != 0x001b || cpu.GetIP() != 0x0200 || cpu.GetRegisters().SS.Selector() != 0x0023 {
+		t.Fatalf("Expected to be running at ring 3 but got [%04x:%04x] with SS [%#04x]", cpu.GetCS(), cpu.GetIP(), cpu.GetRegisters().SS.Selector())
+	}
+
+	// mov cr0, eax is privileged, #GP(0) at ring 3
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0x0f, 0x22, 0xc0},
+	})
+	flags := cpu.GetRegisters().FLAGS
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0600 {
+		t.Fatalf("Expected the #GP handler at [0008:0600] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0010 || cpu.GetRegisters().SP != 0x3ff4 {
+		t.Errorf("Expected ring 0 stack [0010:3ff4] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+
+	// error code, IP and CS of the faulting instruction, FLAGS, then the interrupted SP and SS
+	expectedStack := []uint16{0x0000, 0x0200, 0x001b, flags | 0x0002, 0x2000, 0x0023}
+	for i, expected := range expectedStack {
+		value, _ := mem.ReadAddr16(0x3ff4 + uint32(i*2))
+		if value != expected {
+			t.Errorf("Expected stack word %d [%#04x] but got [%#04x]", i, expected, value)
+		}
+	}
+}
+
+func Test_InterruptReturnToOuterPrivilege(t *testing.T) {
+
+	// breakpoint trap gate to 0008:0700
+	testPc := newTestPcAtRing3WithIdt(map[uint8][]uint8{
+		0x03: {0x00, 0x07, 0x08, 0x00, 0x00, 0x87, 0x00, 0x00},
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0xcc}, // int3
+		0x700: {0xcf}, // iret
+	})
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0700 {
+		t.Fatalf("Expected the breakpoint handler at [0008:0700] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0010 || cpu.GetRegisters().SP != 0x3ff6 {
+		t.Errorf("Expected ring 0 stack [0010:3ff6] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+	if ip, _ := mem.ReadAddr16(0x3ff6); ip != 0x0201 {
+		t.Errorf("Expected pushed IP past the int3 [%#04x] but got [%#04x]", 0x0201, ip)
+	}
+
+	cpu.Step() // iret
+
+	if cpu.GetCS() != 0x001b || cpu.GetIP() != 0x0201 {
+		t.Errorf("Expected iret to [001b:0201] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0023 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected ring 3 stack [0023:2000] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+}
+
+func Test_Interrupt32BitGateFrame(t *testing.T) {
+
+	// breakpoint 32 bit trap gate to 0008:0700
+	testPc := newTestPcAtRing3WithIdt(map[uint8][]uint8{
+		0x03: {0x00, 0x07, 0x08, 0x00, 0x00, 0x8f, 0x00, 0x00},
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	// make the ring 0 stack segment 32 bit, it's read when the gate switches stacks
+	mem.WriteAddr8(0x1016, 0x40)
+
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0xcc},       // int3
+		0x700: {0x66, 0xcf}, // iretd
+	})
+	// stale upper bits that the inner stack pointer must not keep
+	cpu.GetRegisters().ESP = 0xdead0000 | uint32(cpu.GetRegisters().SP)
+	flags := cpu.GetRegisters().FLAGS
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0700 {
+		t.Fatalf("Expected the breakpoint handler at [0008:0700] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().ESP != 0x3fec {
+		t.Errorf("Expected ring 0 ESP [%#08x] but got [%#08x]", 0x3fec, cpu.GetRegisters().ESP)
+	}
+
+	// EIP past the int3, CS, EFLAGS, then the interrupted ESP and SS, all as dwords
+	expectedStack := []uint32{0x0201, 0x001b, uint32(flags | 0x0002), 0x2000, 0x0023}
+	for i, expected := range expectedStack {
+		value, _ := mem.ReadAddr32(0x3fec + uint32(i*4))
+		if value != expected {
+			t.Errorf("Expected stack dword %d [%#08x] but got [%#08x]", i, expected, value)
+		}
+	}
+
+	cpu.Step() // iretd
+
+	if cpu.GetCS() != 0x001b || cpu.GetIP() != 0x0201 {
+		t.Errorf("Expected iret to [001b:0201] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SS.Selector() != 0x0023 || cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected ring 3 stack [0023:2000] but got [%04x:%04x]", cpu.GetRegisters().SS.Selector(), cpu.GetRegisters().SP)
+	}
+}
+
+func Test_Interrupt32BitGateOffset(t *testing.T) {
+
+	// breakpoint 32 bit trap gate to 0008:00010700, the ring 0 code segment is made 32 bit to reach it
+	testPc := newTestPcAtRing3WithIdt(map[uint8][]uint8{
+		0x03: {0x00, 0x07, 0x08, 0x00, 0x00, 0x8f, 0x01, 0x00},
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	// limit 0xfffff with 4k granularity and the D bit
+	mem.WriteAddr8(0x100e, 0xcf)
+
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0xcc}, // int3
+	})
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetRegisters().EIP != 0x00010700 {
+		t.Errorf("Expected the breakpoint handler at [0008:00010700] but got [%04x:%08x]", cpu.GetCS(), cpu.GetRegisters().EIP)
+	}
+}
+
+func Test_Interrupt32BitGateErrorCode(t *testing.T) {
+
+	// #GP 32 bit interrupt gate to 0008:0600
+	testPc := newTestPcAtRing3WithIdt(map[uint8][]uint8{
+		0x0d: {0x00, 0x06, 0x08, 0x00, 0x00, 0x8e, 0x00, 0x00},
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+
+	// mov ax, 0x28; mov ds, ax loads the TSS descriptor, #GP(0x28)
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0xb8, 0x28, 0x00, 0x8e, 0xd8},
+	})
+
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0600 {
+		t.Fatalf("Expected the #GP handler at [0008:0600] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SP != 0x3fe8 {
+		t.Errorf("Expected ring 0 SP [%#04x] but got [%#04x]", 0x3fe8, cpu.GetRegisters().SP)
+	}
+
+	// the error code as a dword, then EIP of the faulting mov
+	if code, _ := mem.ReadAddr32(0x3fe8); code != 0x0028 {
+		t.Errorf("Expected error code dword [%#08x] but got [%#08x]", 0x0028, code)
+	}
+	if ip, _ := mem.ReadAddr32(0x3fec); ip != 0x0203 {
+		t.Errorf("Expected pushed EIP [%#08x] but got [%#08x]", 0x0203, ip)
+	}
+}
+
+func Test_HardwareInterruptMissingGate(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code for the handler
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	}
+
+	// lidt [0x0810], then the pic set up as in newTestPcWithIrq0Handler; sti; nop; nop
+	code := []uint8{0x0f, 0x01, 0x1e, 0x10, 0x08,
+		0xb0, 0x11, 0xe6, 0x20, 0xb0, 0x08, 0xe6, 0x21, 0xb0, 0x04, 0xe6, 0x21,
+		0xb0, 0x01, 0xe6, 0x21, 0xb0, 0xfe, 0xe6, 0x21,
+		0xfb, 0x90, 0x90}
+	testPc := newTestPcWithGdt(gdt, code)
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+
+	// idtr pseudo descriptor: limit 0x007f, base 0x00001800, with only a #NP gate to 0008:0600
+	mem.WriteAddr16(0x0810, 0x007f)
+	mem.WriteAddr16(0x0812, 0x1800)
+	mem.WriteAddr16(0x0814, 0x0000)
+	for i, b := range []uint8{0x00, 0x06, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00} {
+		mem.WriteAddr8(0x1800+0x0b*8+uint32(i), b)
+	}
+	mem.WriteAddr8(0x0600, 0x90)
+
+	for i := 0; i < 11; i++ {
+		cpu.Step()
+	}
+	testPc.GetMasterInterruptController().RaiseIrq(0)
+	cpu.Step() // sti
+	cpu.Step() // nop
+
+	cpu.Step() // IRQ0 through the missing gate, then the nop in the #NP handler
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0601 {
+		t.Fatalf("Expected the #NP handler at [0008:0601] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+
+	// the gate index with the IDT and EXT bits
+	if errorCode, _ := mem.ReadAddr16(0x1ff8); errorCode != 0x08<<3|0x2|0x1 {
+		t.Errorf("Expected error code [%#04x] but got [%#04x]", 0x08<<3|0x2|0x1, errorCode)
+	}
+	if returnIP, _ := mem.ReadAddr16(0x1ffa); returnIP != 0x0120 {
+		t.Errorf("Expected return IP of the interrupted instruction [%#04x] but got [%#04x]", 0x0120, returnIP)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+	"time"
+)
+
+func Test_PauseResume(t *testing.T) {
+
+	// loop: inc cx; jmp loop
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x41, 0xeb, 0xfd})
+	cpu := testPc.GetPrimaryCpu()
+
+	testPc.Start()
+	defer testPc.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+	testPc.Pause()
+
+	if !testPc.IsPaused() || !testPc.IsRunning() {
+		t.Fatalf("Expected a paused running machine but got paused=%t running=%t", testPc.IsPaused(), testPc.IsRunning())
+	}
+
+	cycles := cpu.GetCycleCount()
+	cx := cpu.GetRegisters().CX
+	ip := cpu.GetIP()
+	if cycles == 0 {
+		t.Fatalf("Expected the machine to have run before the pause")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if cpu.GetCycleCount() != cycles || cpu.GetRegisters().CX != cx || cpu.GetIP() != ip {
+		t.Errorf("Expected no progress while paused but went from %d cycles to %d", cycles, cpu.GetCycleCount())
+	}
+
+	testPc.Resume()
+	time.Sleep(10 * time.Millisecond)
+	testPc.Pause()
+
+	if cpu.GetCycleCount() <= cycles {
+		t.Errorf("Expected the machine to continue after resume but stayed at %d cycles", cycles)
+	}
+	if cpu.GetRegisters().CX == cx {
+		t.Errorf("Expected CX to keep counting after resume but stayed at [%#04x]", cx)
+	}
+}
+
+func Test_RunLoopStopsAtZeroIP(t *testing.T) {
+
+	// jmp 0x0000
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xe9, 0xfd, 0xfe})
+
+	testPc.Start()
+	testPc.Wait()
+
+	if testPc.IsRunning() {
+		t.Errorf("Expected the run loop to finish once IP reached 0")
+	}
+	if testPc.GetPrimaryCpu().GetIP() != 0 {
+		t.Errorf("Expected IP 0 but got [%#04x]", testPc.GetPrimaryCpu().GetIP())
+	}
+}
+
+func Test_MachineReset(t *testing.T) {
+
+	// loop: inc cx; jmp loop
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x41, 0xeb, 0xfd})
+	writeTestCode(testPc, map[uint32][]uint8{
+		// loop: inc dx; jmp loop
+		0x200: {0x42, 0xeb, 0xfd},
+	})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetResetConfig(&intel8086.ResetConfig{CS: 0x0000, IP: 0x0200})
+
+	testPc.Start()
+	defer testPc.Stop()
+
+	time.Sleep(5 * time.Millisecond)
+	testPc.Reset()
+	time.Sleep(5 * time.Millisecond)
+	testPc.Pause()
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() < 0x0200 || cpu.GetIP() > 0x0203 {
+		t.Errorf("Expected to be running from the reset vector but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().DX == 0 {
+		t.Errorf("Expected the run loop to carry on after the reset")
+	}
+	if testPc.GetMasterInterruptController().GetInterruptMaskRegister() != 0xff {
+		t.Errorf("Expected the reset to mask every interrupt line")
+	}
+}
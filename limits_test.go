@@ -0,0 +1,218 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+var limitTestGdt = [][]uint8{
+	// 0x08: ring 0 code for the handlers
+	{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+	// 0x10: data, base 0, limit 0x0fff
+	{0xff, 0x0f, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+	// 0x18: expand down data, base 0, valid from 0x1000 to 0xffff
+	{0xff, 0x0f, 0x00, 0x00, 0x00, 0x96, 0x00, 0x00},
+	// 0x20: read only data, base 0, limit 0xffff
+	{0xff, 0xff, 0x00, 0x00, 0x00, 0x90, 0x00, 0x00},
+}
+
+// builds a protected mode pc with #SS and #GP handlers at 0008:0700 and 0008:0600, then runs the lidt
+func newTestPcWithFaultHandlers(instructions []uint8) *pc.PersonalComputer {
+	// lidt [0x0810]
+	testPc := newTestPcWithGdt(limitTestGdt, append([]uint8{0x0f, 0x01, 0x1e, 0x10, 0x08}, instructions...))
+	mem := testPc.GetMemoryController()
+
+	mem.WriteAddr16(0x0810, 0x007f)
+	mem.WriteAddr16(0x0812, 0x1800)
+	mem.WriteAddr16(0x0814, 0x0000)
+
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x1800 + 0x0c*8: {0x00, 0x07, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00},
+		0x1800 + 0x0d*8: {0x00, 0x06, 0x08, 0x00, 0x00, 0x86, 0x00, 0x00},
+	})
+
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.Step() // lidt
+
+	return testPc
+}
+
+func Test_DataSegmentLimit(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		selector      uint16
+		offset        uint16
+		expectedFault bool
+	}{
+		// a word at 0x0ffe ends on the limit
+		{"TestWithinLimit", 0x0010, 0x0ffe, false},
+		// a word at 0x0fff crosses the limit
+		{"TestBeyondLimit", 0x0010, 0x0fff, true},
+		// expand down segments start above the limit
+		{"TestExpandDownAboveLimit", 0x0018, 0x1000, false},
+		{"TestExpandDownBelowLimit", 0x0018, 0x0ffe, true},
+	}
+	for _, tt := range tests {
+
+		// mov ax, selector; mov ds, ax; mov ax, [offset]
+		testPc := newTestPcWithFaultHandlers([]uint8{
+			0xb8, uint8(tt.selector), uint8(tt.selector >> 8),
+			0x8e, 0xd8,
+			0x8b, 0x06, uint8(tt.offset), uint8(tt.offset >> 8),
+		})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(uint32(tt.offset), 0xbeef)
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if !tt.expectedFault {
+				if cpu.GetRegisters().AX != 0xbeef || cpu.GetIP() != 0x0113 {
+					t.Errorf("Expected AX [%#04x] and IP [%#04x] but got [%#04x] and [%#04x]", 0xbeef, 0x0113, cpu.GetRegisters().AX, cpu.GetIP())
+				}
+				return
+			}
+
+			if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0600 {
+				t.Fatalf("Expected the #GP handler at [0008:0600] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+			}
+			if code, _ := mem.ReadAddr16(0x1ff8); code != 0x0000 {
+				t.Errorf("Expected error code [%#04x] but got [%#04x]", 0x0000, code)
+			}
+			if ip, _ := mem.ReadAddr16(0x1ffa); ip != 0x010f {
+				t.Errorf("Expected pushed IP of the faulting mov [%#04x] but got [%#04x]", 0x010f, ip)
+			}
+			if cpu.GetRegisters().AX != tt.selector {
+				t.Errorf("Expected AX to be left [%#04x] but got [%#04x]", tt.selector, cpu.GetRegisters().AX)
+			}
+		})
+	}
+}
+
+func Test_StackSegmentLimit(t *testing.T) {
+
+	// mov ax, 0x10; mov ss, ax; push ax; mov sp, 0x0fff; pop cx
+	testPc := newTestPcWithFaultHandlers([]uint8{
+		0xb8, 0x10, 0x00, 0x8e, 0xd0,
+		0x50,
+		0xbc, 0xff, 0x0f,
+		0x59,
+	})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x1000
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().SP != 0x0ffe {
+		t.Errorf("Expected the push below the limit to succeed with SP [%#04x] but got [%#04x]", 0x0ffe, cpu.GetRegisters().SP)
+	}
+
+	cpu.Step()
+	cpu.Step() // pop cx reads 0x0fff-0x1000
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0700 {
+		t.Fatalf("Expected the #SS handler at [0008:0700] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SP != 0x0ff7 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x0ff7, cpu.GetRegisters().SP)
+	}
+	if ip, _ := mem.ReadAddr16(0x0ff9); ip != 0x0113 {
+		t.Errorf("Expected pushed IP of the faulting pop [%#04x] but got [%#04x]", 0x0113, ip)
+	}
+}
+
+func Test_ExpandDownStackSegment(t *testing.T) {
+
+	// mov ax, 0x18; mov ss, ax; push ax; mov sp, 0xffff; pop cx
+	testPc := newTestPcWithFaultHandlers([]uint8{
+		0xb8, 0x18, 0x00, 0x8e, 0xd0,
+		0x50,
+		0xbc, 0xff, 0xff,
+		0x59,
+	})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x1002
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().SP != 0x1000 {
+		t.Errorf("Expected the push above the limit to succeed with SP [%#04x] but got [%#04x]", 0x1000, cpu.GetRegisters().SP)
+	}
+	if value, _ := mem.ReadAddr16(0x1000); value != 0x0018 {
+		t.Errorf("Expected [%#04x] at the top of the stack but got [%#04x]", 0x0018, value)
+	}
+
+	cpu.Step()
+	cpu.Step() // pop cx reads past the 0xffff upper bound
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0700 {
+		t.Fatalf("Expected the #SS handler at [0008:0700] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().CX != 0x0000 {
+		t.Errorf("Expected CX to be left [%#04x] but got [%#04x]", 0x0000, cpu.GetRegisters().CX)
+	}
+}
+
+func Test_SegmentAccessTypes(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		load        []uint8 // mov ds, ax or mov ss, ax
+		selector    uint16
+		instruction []uint8
+		expectedIP  uint16 // the handler for a fault, or the next instruction
+	}{
+		// mov ax, [0x0600] and mov [0x0600], ax through a read only ds
+		{"TestReadReadOnlyData", []uint8{0x8e, 0xd8}, 0x0020, []uint8{0x8b, 0x06, 0x00, 0x06}, 0x0113},
+		{"TestWriteReadOnlyData", []uint8{0x8e, 0xd8}, 0x0020, []uint8{0x89, 0x06, 0x00, 0x06}, 0x0600},
+		// the same through a cs override, the code segment is readable but never writable
+		{"TestReadCodeSegment", []uint8{0x8e, 0xd8}, 0x0010, []uint8{0x2e, 0x8b, 0x06, 0x00, 0x06}, 0x0114},
+		{"TestWriteCodeSegment", []uint8{0x8e, 0xd8}, 0x0010, []uint8{0x2e, 0x89, 0x06, 0x00, 0x06}, 0x0600},
+		// mov ax, [bp] past the ss limit is a stack fault even though it isn't a push or pop
+		{"TestDataThroughStackSegment", []uint8{0x8e, 0xd0}, 0x0010, []uint8{0x8b, 0x46, 0x00}, 0x0700},
+		// and past the ds limit a general protection fault
+		{"TestDataThroughDataSegment", []uint8{0x8e, 0xd8}, 0x0010, []uint8{0x3e, 0x8b, 0x46, 0x00}, 0x0600},
+	}
+	for _, tt := range tests {
+
+		// mov ax, selector; mov ds/ss, ax
+		code := append([]uint8{0xb8, uint8(tt.selector), uint8(tt.selector >> 8)}, tt.load...)
+		testPc := newTestPcWithFaultHandlers(append(code, tt.instruction...))
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x0600, 0xbeef)
+			cpu.GetRegisters().SP = 0x0f00
+			cpu.GetRegisters().BP = 0x1000
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Fatalf("Expected IP [%#04x] but got [%04x:%04x]", tt.expectedIP, cpu.GetCS(), cpu.GetIP())
+			}
+			if tt.expectedIP == 0x0600 || tt.expectedIP == 0x0700 {
+				if ip, _ := mem.ReadAddr16(0x0f00 - 6); ip != 0x010f {
+					t.Errorf("Expected pushed IP of the faulting instruction [%#04x] but got [%#04x]", 0x010f, ip)
+				}
+			}
+			if value, _ := mem.ReadAddr16(0x0600); value != 0xbeef {
+				t.Errorf("Expected [0x0600] to be left [0xbeef] but got [%#04x]", value)
+			}
+		})
+	}
+}
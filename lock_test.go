@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_LockPrefix(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		instruction    []uint8
+		expectedIP     uint16
+		expectedMemory uint16
+	}{
+		// lock xchg [0x0600], bx
+		{"TestLockXchgMemory", []uint8{0xf0, 0x87, 0x1e, 0x00, 0x06}, 0x0105, 0x5678},
+		// lock add [0x0600], bx
+		{"TestLockAddMemory", []uint8{0xf0, 0x01, 0x1e, 0x00, 0x06}, 0x0105, 0x68ac},
+		// lock inc word [0x0600]
+		{"TestLockIncMemory", []uint8{0xf0, 0xff, 0x06, 0x00, 0x06}, 0x0105, 0x1235},
+		// lock mov [0x0600], bx
+		{"TestLockMovRaisesUd", []uint8{0xf0, 0x89, 0x1e, 0x00, 0x06}, 0x0500, 0x1234},
+		// lock add ax, bx has a register destination
+		{"TestLockRegisterDestinationRaisesUd", []uint8{0xf0, 0x01, 0xd8}, 0x0500, 0x1234},
+		// lock cmp word [0x0600], 1 doesn't write its destination
+		{"TestLockCmpRaisesUd", []uint8{0xf0, 0x83, 0x3e, 0x00, 0x06, 0x01}, 0x0500, 0x1234},
+		// lock bt [0x0600], bx only reads its destination
+		{"TestLockBtRaisesUd", []uint8{0xf0, 0x0f, 0xa3, 0x1e, 0x00, 0x06}, 0x0500, 0x1234},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().BX = 0x5678
+			mem.WriteAddr16(0x0600, 0x1234)
+
+			// #UD handler at 0000:0500
+			mem.WriteAddr16(0x06*4, 0x0500)
+			mem.WriteAddr16(0x06*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+			if value, _ := mem.ReadAddr16(0x0600); value != tt.expectedMemory {
+				t.Errorf("Expected [%#04x] in memory but got [%#04x]", tt.expectedMemory, value)
+			}
+			if tt.expectedIP == 0x0500 {
+				if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+					t.Errorf("Expected the fault to return to the lock prefix [%#04x] but got [%#04x]", 0x0100, returnIP)
+				}
+			}
+		})
+	}
+}
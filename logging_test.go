@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"strings"
+	"testing"
+)
+
+func Test_LoggerLevelFiltering(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		level    common.LogLevel
+		expected []string
+		filtered []string
+	}{
+		{"TestTraceLevel", common.LOG_LEVEL_TRACE, []string{"trace msg", "debug msg", "info msg", "warn msg", "error msg"}, []string{}},
+		{"TestInfoLevel", common.LOG_LEVEL_INFO, []string{"info msg", "warn msg", "error msg"}, []string{"trace msg", "debug msg"}},
+		{"TestWarnLevel", common.LOG_LEVEL_WARN, []string{"warn msg", "error msg"}, []string{"trace msg", "debug msg", "info msg"}},
+		{"TestErrorLevel", common.LOG_LEVEL_ERROR, []string{"error msg"}, []string{"trace msg", "debug msg", "info msg", "warn msg"}},
+	}
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			logger := common.NewLogger(tt.level)
+			logger.SetOutput(output)
+
+			logger.Tracef("trace %s", "msg")
+			logger.Debugf("debug %s", "msg")
+			logger.Infof("info %s", "msg")
+			logger.Warnf("warn %s", "msg")
+			logger.Errorf("error %s", "msg")
+
+			for _, msg := range tt.expected {
+				if !strings.Contains(output.String(), msg) {
+					t.Errorf("Expected output to contain %q but got %q", msg, output.String())
+				}
+			}
+			for _, msg := range tt.filtered {
+				if strings.Contains(output.String(), msg) {
+					t.Errorf("Expected %q to be filtered but got %q", msg, output.String())
+				}
+			}
+		})
+	}
+}
+
+func Test_CpuInstructionTraceLogLevel(t *testing.T) {
+
+	// cli; cld
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xfa, 0xfc})
+	cpu := testPc.GetPrimaryCpu()
+
+	output := &bytes.Buffer{}
+	cpu.GetLogger().SetOutput(output)
+
+	if cpu.GetLogger().GetLevel() != common.LOG_LEVEL_WARN {
+		t.Errorf("Expected default log level warn but got %d", cpu.GetLogger().GetLevel())
+	}
+
+	cpu.Step()
+	if output.Len() != 0 {
+		t.Errorf("Expected no instruction trace at the default level but got %q", output.String())
+	}
+
+	cpu.SetLogLevel(common.LOG_LEVEL_TRACE)
+	cpu.Step()
+	if !strings.Contains(output.String(), "CLD") {
+		t.Errorf("Expected instruction trace at trace level but got %q", output.String())
+	}
+}
+
+func Test_JumpTraceAddress(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		mnemonic    string
+		target      string
+	}{
+		// jmp short 0x0180
+		{"TestJmpShort", []uint8{0xeb, 0x7e}, "JMP", "[0x0180]"},
+		// jmp 0x0180
+		{"TestJmpNear", []uint8{0xe9, 0x7d, 0x00}, "JMP", "[0x0180]"},
+		// jmp 0x0020:0x0010
+		{"TestJmpFar", []uint8{0xea, 0x10, 0x00, 0x20, 0x00}, "JMP", "[0x0210]"},
+		// jz 0x0180 with ZF set
+		{"TestJzTaken", []uint8{0x74, 0x7e}, "JZ", "[0x0180]"},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().SetFlag(intel8086.ZeroFlag, true)
+
+			output := &bytes.Buffer{}
+			cpu.GetLogger().SetOutput(output)
+			cpu.SetLogLevel(common.LOG_LEVEL_TRACE)
+
+			cpu.Step()
+
+			if !strings.Contains(output.String(), "[0x0100] "+tt.mnemonic) {
+				t.Errorf("Expected the %s traced at its own address [0x0100] but got %q", tt.mnemonic, output.String())
+			}
+			if strings.Contains(output.String(), tt.target) {
+				t.Errorf("Expected nothing traced at the target %s but got %q", tt.target, output.String())
+			}
+		})
+	}
+}
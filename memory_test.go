@@ -0,0 +1,224 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/memmap"
+	"testing"
+)
+
+func Test_MemoryFastPathMatchesGeneralPath(t *testing.T) {
+
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+
+	for i := uint32(0); i < 0x1000; i++ {
+		mem.WriteAddr8(0x5000+i, uint8(i*7+3))
+	}
+
+	for addr := uint32(0x5000); addr < 0x6000; addr++ {
+		mem.SetFastPathEnabled(true)
+		fast8, err1 := mem.ReadAddr8(addr)
+		fast16, err2 := mem.ReadAddr16(addr)
+
+		mem.SetFastPathEnabled(false)
+		general8, err3 := mem.ReadAddr8(addr)
+		general16, err4 := mem.ReadAddr16(addr)
+
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			t.Fatalf("Unexpected read error at [%#04x]", addr)
+		}
+		if fast8 != general8 || fast16 != general16 {
+			t.Fatalf("Fast path read [%#02x/%#04x] differs from general path [%#02x/%#04x] at [%#04x]", fast8, fast16, general8, general16, addr)
+		}
+	}
+
+	mem.SetFastPathEnabled(true)
+	mem.WriteAddr16(0x7000, 0xbeef)
+	mem.SetFastPathEnabled(false)
+	if value, _ := mem.ReadAddr16(0x7000); value != 0xbeef {
+		t.Errorf("Expected fast path write to be visible to the general path, got [%#04x]", value)
+	}
+}
+
+func benchmarkMemoryReads(b *testing.B, fastPath bool) {
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+	mem.SetFastPathEnabled(fastPath)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addr := uint32(i) & 0xFFFF
+		mem.ReadAddr8(addr)
+		mem.ReadAddr16(addr)
+	}
+}
+
+func Benchmark_MemoryReadFastPath(b *testing.B) {
+	benchmarkMemoryReads(b, true)
+}
+
+func Benchmark_MemoryReadGeneralPath(b *testing.B) {
+	benchmarkMemoryReads(b, false)
+}
+
+func Test_MemoryReadWrite32(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fastPath bool
+		addr     uint32
+	}{
+		{"TestFastPathAligned", true, 0x3000},
+		{"TestFastPathUnaligned", true, 0x3003},
+		{"TestGeneralPathAligned", false, 0x3000},
+		{"TestGeneralPathUnaligned", false, 0x3003},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testPc.GetMemoryController()
+			mem.SetFastPathEnabled(tt.fastPath)
+
+			err := mem.WriteAddr32(tt.addr, 0xdeadbeef)
+			if err != nil {
+				t.Fatalf("Unexpected write error: %s", err.Error())
+			}
+
+			value, err := mem.ReadAddr32(tt.addr)
+			if err != nil || value != 0xdeadbeef {
+				t.Errorf("Expected [%#08x] but got [%#08x] (%v)", 0xdeadbeef, value, err)
+			}
+
+			// little endian
+			for i, expected := range []uint8{0xef, 0xbe, 0xad, 0xde} {
+				if b, _ := mem.ReadAddr8(tt.addr + uint32(i)); b != expected {
+					t.Errorf("Expected byte [%#02x] at [%#04x] but got [%#02x]", expected, tt.addr+uint32(i), b)
+				}
+			}
+		})
+	}
+}
+
+func Test_MemoryRegionLock(t *testing.T) {
+
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+
+	mem.WriteAddr16(0x8000, 0x1111)
+	mem.WriteAddr16(0x8ffe, 0x2222)
+
+	testPc.GetBus().SendMessage(bus.BusMessage{Subject: common.MESSAGE_LOCK_REGION, Data: common.EncodeRegion(0x8000, 0x8fff)})
+
+	mem.WriteAddr16(0x8000, 0xbeef)
+	mem.WriteAddr32(0x8ffe, 0xcafef00d)
+	mem.WriteAddr8(0x9004, 0x33)
+
+	if value, _ := mem.ReadAddr16(0x8000); value != 0x1111 {
+		t.Errorf("Expected the write to the locked region to be dropped, got [%#04x]", value)
+	}
+	// a write straddling the end of the region only lands outside of it
+	if value, _ := mem.ReadAddr32(0x8ffe); value != 0xcafe2222 {
+		t.Errorf("Expected [%#08x] across the region boundary but got [%#08x]", 0xcafe2222, value)
+	}
+	if value, _ := mem.ReadAddr8(0x9004); value != 0x33 {
+		t.Errorf("Expected the write after the region to apply, got [%#02x]", value)
+	}
+
+	testPc.GetBus().SendMessage(bus.BusMessage{Subject: common.MESSAGE_UNLOCK_REGION, Data: common.EncodeRegion(0x8000, 0x8fff)})
+
+	mem.WriteAddr16(0x8000, 0xbeef)
+	if value, _ := mem.ReadAddr16(0x8000); value != 0xbeef {
+		t.Errorf("Expected the write to apply after unlocking, got [%#04x]", value)
+	}
+}
+
+func Test_MemoryRegionPartialUnlock(t *testing.T) {
+
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+
+	mem.LockRegion(0x8000, 0x8fff)
+	mem.UnlockRegion(0x8400, 0x84ff)
+
+	for _, tt := range []struct {
+		addr     uint32
+		writable bool
+	}{
+		{0x83ff, false},
+		{0x8400, true},
+		{0x84ff, true},
+		{0x8500, false},
+	} {
+		mem.WriteAddr8(tt.addr, 0x00)
+		mem.WriteAddr8(tt.addr, 0x5a)
+		value, _ := mem.ReadAddr8(tt.addr)
+		if (value == 0x5a) != tt.writable {
+			t.Errorf("Expected [%#04x] writable %t but got [%#02x]", tt.addr, tt.writable, value)
+		}
+	}
+}
+
+func Test_MemoryMap(t *testing.T) {
+
+	ram := make([]byte, 0x100000)
+	bios := make([]byte, 0x10000)
+	mem := memmap.CreateMemoryController(&ram, &bios)
+	mem.LockBootVector()
+	mem.LockRegion(0xf0000, 0xfffff)
+
+	if err := mem.RegisterRegion("vga", 0xa0000, 0xbffff); err != nil {
+		t.Fatalf("Expected the vga window to register but got %s", err)
+	}
+	if err := mem.RegisterRegion("overlapping", 0xb8000, 0xc7fff); err == nil {
+		t.Errorf("Expected a window overlapping vga to be rejected")
+	}
+
+	expected := []memmap.RegionInfo{
+		{Start: 0x00000, End: 0x9ffff, Kind: memmap.RegionRam, Name: "ram"},
+		{Start: 0xa0000, End: 0xbffff, Kind: memmap.RegionMmio, Name: "vga"},
+		{Start: 0xc0000, End: 0xeffff, Kind: memmap.RegionRam, Name: "ram"},
+		{Start: 0xf0000, End: 0xfffff, Kind: memmap.RegionRom, Name: "bios", WriteProtected: true},
+	}
+
+	regions := mem.MemoryMap()
+	if len(regions) != len(expected) {
+		t.Fatalf("Expected %d regions but got %+v", len(expected), regions)
+	}
+	for i, region := range regions {
+		if region != expected[i] {
+			t.Errorf("Expected region %d to be %+v but got %+v", i, expected[i], region)
+		}
+	}
+}
+
+func Test_MemoryMapSplitsOnWriteProtection(t *testing.T) {
+
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+	mem.LockRegion(0x8000, 0x8fff)
+
+	regions := mem.MemoryMap()
+	if len(regions) < 3 {
+		t.Fatalf("Expected the locked range to split ram but got %+v", regions)
+	}
+	if regions[0].End != 0x7fff || regions[0].WriteProtected {
+		t.Errorf("Expected writable ram up to [%#05x] but got %+v", 0x7fff, regions[0])
+	}
+	if regions[1].Start != 0x8000 || regions[1].End != 0x8fff || !regions[1].WriteProtected || regions[1].Kind != memmap.RegionRam {
+		t.Errorf("Expected locked ram at [%#05x-%#05x] but got %+v", 0x8000, 0x8fff, regions[1])
+	}
+
+	// the video adapter claims its window when the pc is built
+	found := false
+	for _, region := range regions {
+		if region.Kind == memmap.RegionMmio && region.Name == "vga" {
+			found = region.Start == 0xa0000 && region.End == 0xbffff
+		}
+	}
+	if !found {
+		t.Errorf("Expected the vga window in %+v", regions)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_ModRmLength(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		instruction    []uint8
+		expectedLength uint32
+	}{
+		// mov ax, bx
+		{"TestRegisterDirect", []uint8{0x8b, 0xc3}, 2},
+		// mov ax, [bx]
+		{"TestDisp0", []uint8{0x8b, 0x07}, 2},
+		// mov ax, [bx+4]
+		{"TestDisp8", []uint8{0x8b, 0x47, 0x04}, 3},
+		// mov ax, [0x600]
+		{"TestDirectDisp16", []uint8{0x8b, 0x06, 0x00, 0x06}, 4},
+		// mov ax, [bx+si+0x1234]
+		{"TestDisp16", []uint8{0x8b, 0x80, 0x34, 0x12}, 4},
+		// mov ax, [esp]
+		{"TestSib", []uint8{0x67, 0x8b, 0x04, 0x24}, 4},
+		// mov ax, [esp+4]
+		{"TestSibDisp8", []uint8{0x67, 0x8b, 0x44, 0x24, 0x04}, 5},
+		// mov ax, [eax*2+0x600]
+		{"TestSibNoBaseDisp32", []uint8{0x67, 0x8b, 0x04, 0x45, 0x00, 0x06, 0x00, 0x00}, 8},
+		// mov ax, [0x600]
+		{"TestDirectDisp32", []uint8{0x67, 0x8b, 0x05, 0x00, 0x06, 0x00, 0x00}, 7},
+		// mov ax, [ebx+0x600]
+		{"TestDisp32", []uint8{0x67, 0x8b, 0x83, 0x00, 0x06, 0x00, 0x00}, 7},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			decoded, err := cpu.DecodeOnly(0x100)
+			if err != nil {
+				t.Fatalf("Expected the instruction to decode but got %s", err)
+			}
+
+			cpu.Step()
+
+			if executed := uint32(cpu.GetIP()) - 0x100; executed != tt.expectedLength {
+				t.Errorf("Expected the handler to consume %d bytes but it consumed %d", tt.expectedLength, executed)
+			}
+			if decoded.Length != tt.expectedLength {
+				t.Errorf("Expected DecodeOnly to report %d bytes but got %d", tt.expectedLength, decoded.Length)
+			}
+		})
+	}
+}
+
+func Test_ModRmEffectiveAddress(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		instruction     []uint8
+		expectedSegment string
+		expectedOffset  uint32
+	}{
+		// mov ax, [bx-4]
+		{"TestNegativeDisp8", []uint8{0x8b, 0x47, 0xfc}, "DS", 0x06fc},
+		// mov ax, [ebx-4]
+		{"TestNegativeDisp8Address32", []uint8{0x67, 0x8b, 0x43, 0xfc}, "DS", 0x06fc},
+		// mov ax, [ebx+esi*4+8]
+		{"TestScaledIndex", []uint8{0x67, 0x8b, 0x44, 0xb3, 0x08}, "DS", 0x0748},
+		// mov ax, [eax*2+0x600]
+		{"TestIndexWithoutBase", []uint8{0x67, 0x8b, 0x04, 0x45, 0x00, 0x06, 0x00, 0x00}, "DS", 0x0620},
+		// mov ax, [esp+4]
+		{"TestStackPointerBase", []uint8{0x67, 0x8b, 0x44, 0x24, 0x04}, "SS", 0x0804},
+		// mov ax, [ebp+8]
+		{"TestFramePointerBase", []uint8{0x67, 0x8b, 0x45, 0x08}, "SS", 0x0908},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().EAX = 0x0010
+			cpu.GetRegisters().EBX = 0x0700
+			cpu.GetRegisters().ESI = 0x0010
+			cpu.GetRegisters().ESP = 0x0800
+			cpu.GetRegisters().EBP = 0x0900
+
+			cpu.Step()
+
+			ea := cpu.GetLastEffectiveAddress()
+			if !ea.Valid || ea.Segment != tt.expectedSegment || ea.Offset != tt.expectedOffset {
+				t.Errorf("Expected effective address %s:%04x but got %+v", tt.expectedSegment, tt.expectedOffset, ea)
+			}
+		})
+	}
+}
+
+func Test_ModRmAddressWrap16(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		bx, si, bp  uint16
+	}{
+		// mov ax, [bx+si] where bx+si is 0x10010
+		{"TestBaseIndexWraps", []uint8{0x8b, 0x00}, 0xfff0, 0x0020, 0},
+		// mov ax, [bx+0x20]
+		{"TestDisp8Wraps", []uint8{0x8b, 0x47, 0x20}, 0xfff0, 0, 0},
+		// mov ax, [bp+si+0x8000]
+		{"TestDisp16Wraps", []uint8{0x8b, 0x82, 0x00, 0x80}, 0, 0x0010, 0x8000},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x00010, 0x1234)
+			mem.WriteAddr16(0x10010, 0x9999)
+			cpu.GetRegisters().BX = tt.bx
+			cpu.GetRegisters().SI = tt.si
+			cpu.GetRegisters().BP = tt.bp
+
+			cpu.Step()
+
+			if ea := cpu.GetLastEffectiveAddress(); ea.Offset != 0x0010 {
+				t.Errorf("Expected the offset to wrap to [%#04x] but got [%#x]", 0x0010, ea.Offset)
+			}
+			if cpu.GetRegisters().AX != 0x1234 {
+				t.Errorf("Expected AX [%#04x] from the wrapped offset but got [%#04x]", 0x1234, cpu.GetRegisters().AX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_ModRmAddress32DoesNotWrapAt64k(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data, base 0, limit 0xfffff with 4k granularity
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00},
+	}
+
+	// mov ax, 0x08; mov ds, ax; mov ax, [ebx+0x20]
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd8, 0x67, 0x8b, 0x43, 0x20})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x00010, 0x1234)
+	mem.WriteAddr16(0x10010, 0x9999)
+	cpu.GetRegisters().EBX = 0x0000fff0
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+
+	if ea := cpu.GetLastEffectiveAddress(); ea.Offset != 0x00010010 {
+		t.Errorf("Expected the offset [%#08x] but got [%#08x]", 0x00010010, ea.Offset)
+	}
+	if cpu.GetRegisters().AX != 0x9999 {
+		t.Errorf("Expected AX [%#04x] from above 64k but got [%#04x]", 0x9999, cpu.GetRegisters().AX)
+	}
+}
+
+func Test_ModRmAddress32ReadsSixteenBitWrites(t *testing.T) {
+
+	// mov bx, 0x3000; mov ax, [ebx]
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xbb, 0x00, 0x30, 0x67, 0x8b, 0x03})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x1111, 0x9999)
+	mem.WriteAddr16(0x3000, 0x1234)
+	cpu.GetRegisters().EBX = 0x00001111
+
+	cpu.Step()
+	cpu.Step()
+
+	if ea := cpu.GetLastEffectiveAddress(); ea.Offset != 0x3000 {
+		t.Errorf("Expected the offset [%#08x] but got [%#08x]", 0x3000, ea.Offset)
+	}
+	if cpu.GetRegisters().AX != 0x1234 {
+		t.Errorf("Expected AX [%#04x] through the EBX BX was written to but got [%#04x]", 0x1234, cpu.GetRegisters().AX)
+	}
+}
+
+func Test_ModRmSegmentBase(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		address     uint32
+	}{
+		// mov ax, 0x1000; mov ds, ax; mov ax, [0x10]
+		{"TestDataSegment", []uint8{0xb8, 0x00, 0x10, 0x8e, 0xd8, 0x8b, 0x06, 0x10, 0x00}, 0x10010},
+		// mov ax, 0x2000; mov es, ax; mov ax, es:[0x10]
+		{"TestSegmentOverride", []uint8{0xb8, 0x00, 0x20, 0x8e, 0xc0, 0x26, 0x8b, 0x06, 0x10, 0x00}, 0x20010},
+		// mov ax, 0x3000; mov ss, ax; mov ax, [bp+0x10]
+		{"TestStackSegment", []uint8{0xb8, 0x00, 0x30, 0x8e, 0xd0, 0x8b, 0x46, 0x10}, 0x30010},
+		// mov ax, 0x1000; mov ds, ax; mov ax, [moffs 0x10]
+		{"TestMemoryOffset", []uint8{0xb8, 0x00, 0x10, 0x8e, 0xd8, 0xa1, 0x10, 0x00}, 0x10010},
+		// mov ax, 0x2000; mov es, ax; mov ax, es:[moffs 0x10]
+		{"TestMemoryOffsetOverride", []uint8{0xb8, 0x00, 0x20, 0x8e, 0xc0, 0x26, 0xa1, 0x10, 0x00}, 0x20010},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x00010, 0x1234)
+			mem.WriteAddr16(tt.address, 0x9999)
+
+			cpu.Step()
+			cpu.Step()
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != 0x9999 {
+				t.Errorf("Expected AX [%#04x] from [%#05x] but got [%#04x]", 0x9999, tt.address, cpu.GetRegisters().AX)
+			}
+		})
+	}
+}
+
+func Test_ModRmProtectedModeSegmentBase(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data, base 0x20000, limit 0xffff
+		{0xff, 0xff, 0x00, 0x00, 0x02, 0x92, 0x00, 0x00},
+	}
+
+	// mov ax, 0x08; mov ds, ax; mov ax, 0x1234; mov [0x10], ax
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd8, 0xb8, 0x34, 0x12, 0x89, 0x06, 0x10, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+
+	if value, _ := mem.ReadAddr16(0x20010); value != 0x1234 {
+		t.Errorf("Expected [%#05x] to be written through the segment base as [%#04x] but got [%#04x]", 0x20010, 0x1234, value)
+	}
+	if value, _ := mem.ReadAddr16(0x00010); value == 0x1234 {
+		t.Errorf("Expected the offset not to be written as a physical address")
+	}
+}
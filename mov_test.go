@@ -25,3 +25,94 @@ func Test_MovTests(t *testing.T) {
 		testPc.GetPrimaryCpu().Step()
 	}
 }
+
+func Test_Mov32BitOperands(t *testing.T) {
+
+	// mov eax, ebx (66 89 d8); mov ecx, eax (66 8b c8); mov [bx], eax (66 89 07); mov edx, [bx] (66 8b 17)
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0x89, 0xd8, 0x66, 0x8b, 0xc8, 0x66, 0x89, 0x07, 0x66, 0x8b, 0x17})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	registers := cpu.GetRegisters()
+
+	// only the 32 bit register is set, BX is its low word and addresses the memory operands
+	registers.EBX = 0x12340856
+	mem.WriteAddr8(0x0860, 0xaa)
+
+	// each 32 bit write reads back through the 16 and 8 bit views of the register
+	expectViews := func(name string, r32 uint32, r16 uint16, low uint8, high uint8) {
+		if r32 != 0x12340856 || r16 != 0x0856 || low != 0x56 || high != 0x08 {
+			t.Errorf("Expected E%s [%#08x] %s [%#04x] and its bytes [%#02x] [%#02x] but got [%#08x] [%#04x] [%#02x] [%#02x]",
+				name, 0x12340856, name, 0x0856, 0x56, 0x08, r32, r16, low, high)
+		}
+	}
+
+	cpu.Step()
+	expectViews("AX", registers.EAX, registers.AX, registers.AL, registers.AH)
+
+	cpu.Step()
+	expectViews("CX", registers.ECX, registers.CX, registers.CL, registers.CH)
+
+	cpu.Step()
+	for i, expected := range []uint8{0x56, 0x08, 0x34, 0x12} {
+		if b, _ := mem.ReadAddr8(0x0856 + uint32(i)); b != expected {
+			t.Errorf("Expected byte [%#02x] at [%#04x] but got [%#02x]", expected, 0x0856+i, b)
+		}
+	}
+
+	cpu.Step()
+	expectViews("DX", registers.EDX, registers.DX, registers.DL, registers.DH)
+
+	if cpu.GetIP() != 0x010c {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x010c, cpu.GetIP())
+	}
+}
+
+func Test_Mov16BitOperands(t *testing.T) {
+
+	// mov [bx], ax (89 07); mov cl, [bx] (8a 0f); mov dx, [bx] (8b 17); mov [bx], ch (88 2f)
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x89, 0x07, 0x8a, 0x0f, 0x8b, 0x17, 0x88, 0x2f})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+
+	cpu.GetRegisters().AX = 0xbeef
+	cpu.GetRegisters().BX = 0x0800
+	mem.WriteAddr16(0x0802, 0xcccc)
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if value, _ := mem.ReadAddr16(0x0800); value != 0xbe00 {
+		t.Errorf("Expected word [%#04x] but got [%#04x]", 0xbe00, value)
+	}
+	if value, _ := mem.ReadAddr16(0x0802); value != 0xcccc {
+		t.Errorf("Expected 16 bit mov to leave the following word [%#04x] but got [%#04x]", 0xcccc, value)
+	}
+	if cpu.GetRegisters().CL != 0xef {
+		t.Errorf("Expected CL [%#02x] but got [%#02x]", 0xef, cpu.GetRegisters().CL)
+	}
+	if cpu.GetRegisters().DX != 0xbeef {
+		t.Errorf("Expected DX [%#04x] but got [%#04x]", 0xbeef, cpu.GetRegisters().DX)
+	}
+}
+
+func Test_MovByteHalvesReadBackAsWord(t *testing.T) {
+
+	// mov al, 0x34; mov ah, 0x12; mov [0x3000], ax
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xb0, 0x34, 0xb4, 0x12, 0xa3, 0x00, 0x30})
+	cpu := testPc.GetPrimaryCpu()
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().AX != 0x1234 {
+		t.Errorf("Expected AX [%#04x] but got [%#04x]", 0x1234, cpu.GetRegisters().AX)
+	}
+	if cpu.GetRegisters().EAX != 0x1234 {
+		t.Errorf("Expected EAX [%#08x] but got [%#08x]", 0x1234, cpu.GetRegisters().EAX)
+	}
+	if word, _ := testPc.GetMemoryController().ReadAddr16(0x3000); word != 0x1234 {
+		t.Errorf("Expected [%#04x] stored at 0x3000 but got [%#04x]", 0x1234, word)
+	}
+}
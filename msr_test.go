@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_ModelSpecificRegisterRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		msr         uint32
+		expectedEDX uint32
+		expectedEAX uint32
+	}{
+		{"TestCounter0", intel8086.MsrCounter0, 0x000000aa, 0x12345678},
+		{"TestControlAndEventSelect", intel8086.MsrControlAndEventSelect, 0x00000000, 0x00ff00ff},
+		// the cycle count moves on by one for the rdmsr itself
+		{"TestTimeStampCounter", intel8086.MsrTimeStampCounter, 0x000000aa, 0x12345679},
+	}
+	for _, tt := range tests {
+
+		// wrmsr; xor eax, eax; xor edx, edx; rdmsr
+		testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x30, 0x66, 0x31, 0xc0, 0x66, 0x31, 0xd2, 0x0f, 0x32})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(intel8086.CpuFeatures{ModelSpecificRegisters: true})
+			cpu.GetRegisters().ECX = tt.msr
+			cpu.GetRegisters().EDX = tt.expectedEDX
+			cpu.GetRegisters().EAX = tt.expectedEAX
+			if tt.msr == intel8086.MsrTimeStampCounter {
+				cpu.GetRegisters().EAX = tt.expectedEAX - 3
+			}
+
+			for i := 0; i < 4; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().EDX != tt.expectedEDX || cpu.GetRegisters().EAX != tt.expectedEAX {
+				t.Errorf("Expected EDX:EAX [%#08x:%#08x] but got [%#08x:%#08x]", tt.expectedEDX, tt.expectedEAX, cpu.GetRegisters().EDX, cpu.GetRegisters().EAX)
+			}
+			if cpu.GetIP() != 0x010a {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x010a, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_ModelSpecificRegisterFaults(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		features    intel8086.CpuFeatures
+		expectedIP  uint16
+	}{
+		// rdmsr of an unknown msr
+		{"TestUnknownMsrRead", []uint8{0x0f, 0x32}, intel8086.CpuFeatures{ModelSpecificRegisters: true}, 0x0600},
+		// wrmsr of an unknown msr
+		{"TestUnknownMsrWrite", []uint8{0x0f, 0x30}, intel8086.CpuFeatures{ModelSpecificRegisters: true}, 0x0600},
+		// rdmsr on a plain 386
+		{"TestRdmsrWithoutFeature", []uint8{0x0f, 0x32}, intel8086.CpuFeatures{}, 0x0500},
+		// wbinvd on a plain 386
+		{"TestWbinvdWithoutFeature", []uint8{0x0f, 0x09}, intel8086.CpuFeatures{}, 0x0500},
+		// wbinvd and invd just move on
+		{"TestWbinvd", []uint8{0x0f, 0x09}, intel8086.CpuFeatures{CacheControl: true}, 0x0102},
+		{"TestInvd", []uint8{0x0f, 0x08}, intel8086.CpuFeatures{CacheControl: true}, 0x0102},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.SetFeatures(tt.features)
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().ECX = 0xc0000080
+
+			// #UD handler at 0000:0500, #GP handler at 0000:0600
+			mem.WriteAddr16(0x06*4, 0x0500)
+			mem.WriteAddr16(0x06*4+2, 0x0000)
+			mem.WriteAddr16(0x0d*4, 0x0600)
+			mem.WriteAddr16(0x0d*4+2, 0x0000)
+
+			cpu.Step()
+
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_ModelSpecificRegisterRequiresRing0(t *testing.T) {
+
+	// any gate will do, the code only needs to be running at ring 3
+	testPc := newTestPcWithCallGate([]uint8{0x00, 0x04, 0x08, 0x00, 0x00, 0x84, 0x00, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetFeatures(intel8086.CpuFeatures{ModelSpecificRegisters: true})
+	cpu.GetRegisters().ECX = intel8086.MsrCounter0
+	cpu.GetRegisters().EAX = 0x11111111
+
+	// rdmsr
+	writeTestCode(testPc, map[uint32][]uint8{
+		0x200: {0x0f, 0x32},
+	})
+
+	cpu.Step()
+
+	if cpu.GetRegisters().EAX != 0x11111111 {
+		t.Errorf("Expected rdmsr to fault at ring 3 leaving EAX [%#08x] but got [%#08x]", 0x11111111, cpu.GetRegisters().EAX)
+	}
+	if cpu.GetIP() == 0x0202 {
+		t.Errorf("Expected rdmsr to fault at ring 3 rather than complete")
+	}
+}
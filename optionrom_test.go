@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+// builds an option rom image of the given number of 512 byte blocks with the init entry code at offset 3
+// and the checksum byte fixed up in the last byte
+func newTestOptionRom(blocks uint8, initCode []uint8) []byte {
+	image := make([]byte, int(blocks)*512)
+	image[0] = 0x55
+	image[1] = 0xaa
+	image[2] = blocks
+	copy(image[3:], initCode)
+
+	var sum uint8
+	for _, b := range image {
+		sum += b
+	}
+	image[len(image)-1] = -sum
+
+	return image
+}
+
+func Test_OptionRomInitEntryCalled(t *testing.T) {
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+	services := testPc.GetBiosServices()
+
+	// mov bx, 0x1234; retf
+	err := services.RegisterOptionRom(0xc800, newTestOptionRom(1, []uint8{0xbb, 0x34, 0x12, 0xcb}))
+	if err != nil {
+		t.Fatalf("Failed to register option rom: %s", err.Error())
+	}
+
+	// no signature, must not be called
+	testPc.GetMemoryController().WriteAddr8(0xd0003, 0xf4)
+
+	cpu.GetRegisters().SP = 0x2000
+	returnCS, returnIP := cpu.GetCS(), cpu.GetIP()
+
+	err = services.Post()
+	if err != nil {
+		t.Fatalf("Post failed: %s", err.Error())
+	}
+
+	initialized := services.GetInitializedOptionRoms()
+	if len(initialized) != 1 || initialized[0] != 0xc800 {
+		t.Errorf("Expected option rom at segment [0xc800] to be initialized but got %v", initialized)
+	}
+	if cpu.GetRegisters().BX != 0x1234 {
+		t.Errorf("Expected option rom init to set BX [%#04x] but got [%#04x]", 0x1234, cpu.GetRegisters().BX)
+	}
+	if cpu.GetCS() != returnCS || cpu.GetIP() != returnIP {
+		t.Errorf("Expected to return to [%04x:%04x] but got [%04x:%04x]", returnCS, returnIP, cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+}
+
+func Test_OptionRomBadChecksumSkipped(t *testing.T) {
+
+	testPc := newTestPc()
+	services := testPc.GetBiosServices()
+
+	// hlt, would never return
+	image := newTestOptionRom(1, []uint8{0xf4})
+	image[len(image)-1]++
+
+	err := services.RegisterOptionRom(0xc000, image)
+	if err != nil {
+		t.Fatalf("Failed to register option rom: %s", err.Error())
+	}
+
+	if roms := services.ScanOptionRoms(); len(roms) != 0 {
+		t.Errorf("Expected option rom with a bad checksum to be skipped but found %v", roms)
+	}
+}
+
+func Test_OptionRomRegistrationValidation(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		segment uint16
+		image   []byte
+	}{
+		{"TestBelowExpansionArea", 0xb800, newTestOptionRom(1, nil)},
+		{"TestUnalignedSegment", 0xc810, newTestOptionRom(1, nil)},
+		{"TestMissingSignature", 0xc800, make([]byte, 512)},
+		{"TestPastExpansionArea", 0xef80, newTestOptionRom(8, nil)},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPc()
+
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testPc.GetBiosServices().RegisterOptionRom(tt.segment, tt.image); err == nil {
+				t.Errorf("Expected option rom registration at segment [%#04x] to fail", tt.segment)
+			}
+		})
+	}
+}
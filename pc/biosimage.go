@@ -0,0 +1,69 @@
+package pc
+
+import (
+	"fmt"
+)
+
+/*
+	BIOS image loading
+	The image is mapped so its last byte sits at the top of the first megabyte. Images come in 64KB, 128KB and
+	256KB parts, and a part smaller than the window it is decoded into shows up once for each repeat of its size,
+	as a 64KB chip answering in a 128KB window does on real boards.
+*/
+
+const (
+	BiosImageSize64K  = 0x10000
+	BiosImageSize128K = 0x20000
+	BiosImageSize256K = 0x40000
+)
+
+type BiosImageOptions struct {
+	Window         uint32 // size of the address window the image is mapped into, 0 maps it into a window of its own size
+	VerifyChecksum bool   // the bytes of the image must add up to zero
+}
+
+func isBiosImageSize(size uint32) bool {
+	switch size {
+	case BiosImageSize64K, BiosImageSize128K, BiosImageSize256K:
+		return true
+	}
+	return false
+}
+
+// Validates a bios image and maps it into the top of the first megabyte, mirrored to fill the window
+func (pc *PersonalComputer) LoadBiosImage(image []byte, options BiosImageOptions) error {
+	size := uint32(len(image))
+
+	window := options.Window
+	if window == 0 {
+		window = size
+	}
+
+	if !isBiosImageSize(window) {
+		return fmt.Errorf("bios window of %#x bytes is not 64KB, 128KB or 256KB", window)
+	}
+	if size > window {
+		return fmt.Errorf("bios image of %#x bytes does not fit the %#x byte window", size, window)
+	}
+	if !isBiosImageSize(size) {
+		return fmt.Errorf("bios image of %#x bytes is not a 64KB, 128KB or 256KB part", size)
+	}
+
+	if options.VerifyChecksum {
+		var checksum uint8
+		for _, b := range image {
+			checksum += b
+		}
+		if checksum != 0 {
+			return fmt.Errorf("bios image checksum is %#02x, expected 0", checksum)
+		}
+	}
+
+	bios := make([]byte, window)
+	for offset := uint32(0); offset < window; offset += size {
+		copy(bios[offset:], image)
+	}
+	pc.rom.bios = bios
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package pc
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"math/rand"
+)
+
+/*
+	Machine configuration
+	Options fixed when the pc is built. The zero value is the default machine: the system clock, MaxRAMBytes
+	of ram cleared to zero, and timers which are never ticked.
+
+	Real ram comes up holding whatever it held, so code which reads memory before writing it can behave
+	differently from one power on to the next. The ram fill makes that repeatable: a fixed byte pattern, or a
+	pseudo random fill which is the same for the same seed.
+*/
+
+const (
+	RAM_INIT_ZERO = iota
+	RAM_INIT_PATTERN
+	RAM_INIT_SEEDED
+)
+
+// How ram is filled when the pc is built
+type RamInit struct {
+	Kind    int
+	Pattern byte  // fill byte for RAM_INIT_PATTERN
+	Seed    int64 // random source seed for RAM_INIT_SEEDED
+}
+
+// Clears ram to zero
+func RamInitZero() RamInit {
+	return RamInit{Kind: RAM_INIT_ZERO}
+}
+
+// Fills every byte of ram with value
+func RamInitPattern(value byte) RamInit {
+	return RamInit{Kind: RAM_INIT_PATTERN, Pattern: value}
+}
+
+// Fills ram with pseudo random bytes, the same seed always gives the same contents
+func RamInitSeeded(seed int64) RamInit {
+	return RamInit{Kind: RAM_INIT_SEEDED, Seed: seed}
+}
+
+func (ramInit RamInit) fill(ram []byte) {
+	switch ramInit.Kind {
+	case RAM_INIT_PATTERN:
+		for i := range ram {
+			ram[i] = ramInit.Pattern
+		}
+	case RAM_INIT_SEEDED:
+		rand.New(rand.NewSource(ramInit.Seed)).Read(ram)
+	default:
+		for i := range ram {
+			ram[i] = 0
+		}
+	}
+}
+
+type MachineConfig struct {
+	Clock    common.Clock // time source for the RTC and PIT, nil for the system clock
+	RamBytes uint32       // ram installed, 0 for MaxRAMBytes
+	RamInit  RamInit
+
+	Scheduler SchedulerConfig // how often the timers are ticked, see scheduler.go
+}
@@ -0,0 +1,133 @@
+package pc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+	Replayable input event log
+
+	Injected input events are stamped with the cpu cycle count they arrived at rather than wall time,
+	so replaying a log against a fresh machine (with a FixedClock) delivers every event on the same
+	instruction boundary as the recorded run and reproduces it exactly.
+
+	The log is line based text, one event per line:
+		<cycle> scancode <code>
+		<cycle> tick
+*/
+
+const (
+	INPUT_EVENT_SCANCODE   = "scancode"
+	INPUT_EVENT_TIMER_TICK = "tick"
+)
+
+type InputEvent struct {
+	Cycle uint64 // cpu cycle count the event was injected at
+	Kind  string
+	Value uint8
+}
+
+type inputLog struct {
+	recorder io.Writer
+	replayed []InputEvent // waiting to be injected, in cycle order
+}
+
+func (event InputEvent) String() string {
+	if event.Kind == INPUT_EVENT_SCANCODE {
+		return fmt.Sprintf("%d %s %#02x", event.Cycle, event.Kind, event.Value)
+	}
+	return fmt.Sprintf("%d %s", event.Cycle, event.Kind)
+}
+
+// Logs every input event injected from now on to w, nil stops recording
+func (pc *PersonalComputer) RecordInputs(w io.Writer) {
+	pc.inputs.recorder = w
+}
+
+// Schedules the events in a recorded log to be injected as the machine is stepped
+func (pc *PersonalComputer) ReplayInputs(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		event, err := parseInputEvent(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("input log line %d: %s", line, err.Error())
+		}
+		pc.inputs.replayed = append(pc.inputs.replayed, event)
+	}
+
+	return scanner.Err()
+}
+
+func parseInputEvent(line string) (InputEvent, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return InputEvent{}, fmt.Errorf("malformed event %q", line)
+	}
+
+	cycle, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return InputEvent{}, fmt.Errorf("bad cycle count %q", fields[0])
+	}
+
+	event := InputEvent{Cycle: cycle, Kind: fields[1]}
+
+	switch event.Kind {
+	case INPUT_EVENT_SCANCODE:
+		if len(fields) != 3 {
+			return InputEvent{}, fmt.Errorf("scancode event without a code")
+		}
+		code, err := strconv.ParseUint(fields[2], 0, 8)
+		if err != nil {
+			return InputEvent{}, fmt.Errorf("bad scancode %q", fields[2])
+		}
+		event.Value = uint8(code)
+	case INPUT_EVENT_TIMER_TICK:
+		if len(fields) != 2 {
+			return InputEvent{}, fmt.Errorf("unexpected operand on tick event")
+		}
+	default:
+		return InputEvent{}, fmt.Errorf("unknown event kind %q", event.Kind)
+	}
+
+	return event, nil
+}
+
+// Sends a key scancode through the ps2 controller
+func (pc *PersonalComputer) InjectScancode(code uint8) {
+	pc.injectInput(InputEvent{Cycle: pc.cpu.GetCycleCount(), Kind: INPUT_EVENT_SCANCODE, Value: code})
+}
+
+// Signals a timer tick on IRQ0
+func (pc *PersonalComputer) InjectTimerTick() {
+	pc.injectInput(InputEvent{Cycle: pc.cpu.GetCycleCount(), Kind: INPUT_EVENT_TIMER_TICK})
+}
+
+func (pc *PersonalComputer) injectInput(event InputEvent) {
+	if pc.inputs.recorder != nil {
+		fmt.Fprintln(pc.inputs.recorder, event.String())
+	}
+
+	switch event.Kind {
+	case INPUT_EVENT_SCANCODE:
+		pc.ps2Controller.SendScancode(event.Value)
+	case INPUT_EVENT_TIMER_TICK:
+		pc.masterInterruptController.RaiseIrq(0)
+	}
+}
+
+// Injects the replayed events which are due at the current cycle count
+func (pc *PersonalComputer) deliverReplayedInputs() {
+	for len(pc.inputs.replayed) > 0 && pc.inputs.replayed[0].Cycle <= pc.cpu.GetCycleCount() {
+		event := pc.inputs.replayed[0]
+		pc.inputs.replayed = pc.inputs.replayed[1:]
+		pc.injectInput(event)
+	}
+}
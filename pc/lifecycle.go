@@ -0,0 +1,187 @@
+package pc
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"sync"
+)
+
+/*
+	Machine lifecycle
+	Start runs the cpu on its own goroutine until the instruction pointer reaches 0 or Stop is called. Pause blocks
+	until the run loop is parked between instructions, so the machine state can be inspected or changed safely
+	until Resume.
+
+	RunSteps runs the machine on the caller's goroutine instead, for a bounded number of instructions, and is
+	meant for tests and scripted runs while the run loop isn't started.
+*/
+
+type runLoop struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	running bool
+	paused  bool
+	parked  bool // the run loop is waiting in paused state
+	stop    bool
+	done    chan struct{}
+}
+
+func (loop *runLoop) init() {
+	if loop.cond == nil {
+		loop.cond = sync.NewCond(&loop.mutex)
+	}
+}
+
+// Starts the run loop on a new goroutine, does nothing if it's already running
+func (pc *PersonalComputer) Start() {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+	loop.init()
+
+	if loop.running {
+		return
+	}
+
+	loop.running = true
+	loop.stop = false
+	loop.done = make(chan struct{})
+	go pc.run(loop.done)
+}
+
+// Blocks until the run loop has stopped between instructions
+func (pc *PersonalComputer) Pause() {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+	loop.init()
+
+	loop.paused = true
+	for loop.running && !loop.parked {
+		loop.cond.Wait()
+	}
+}
+
+// Continues a paused run loop from where it stopped
+func (pc *PersonalComputer) Resume() {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+	loop.init()
+
+	loop.paused = false
+	loop.cond.Broadcast()
+}
+
+func (pc *PersonalComputer) IsPaused() bool {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+
+	return loop.paused
+}
+
+func (pc *PersonalComputer) IsRunning() bool {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+
+	return loop.running
+}
+
+// Ends the run loop and waits for its goroutine to exit
+func (pc *PersonalComputer) Stop() {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	loop.init()
+	done := loop.done
+	loop.stop = true
+	loop.cond.Broadcast()
+	loop.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Waits for the run loop to finish
+func (pc *PersonalComputer) Wait() {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	done := loop.done
+	loop.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Steps the machine until done reports true after an instruction, giving up after maxSteps instructions. Returns
+// the number of instructions run.
+func (pc *PersonalComputer) RunSteps(maxSteps int, done func() bool) (int, error) {
+	for steps := 1; steps <= maxSteps; steps++ {
+		pc.Step()
+
+		if done() {
+			return steps, nil
+		}
+	}
+	return maxSteps, fmt.Errorf("machine did not finish within %d steps", maxSteps)
+}
+
+// Sends every device the global reset message. A running machine is paused around the reset and carries on
+// from the reset vector.
+func (pc *PersonalComputer) Reset() {
+	wasPaused := pc.IsPaused()
+	pc.Pause()
+
+	pc.bus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_RESET, Data: []byte{}})
+
+	if !wasPaused {
+		pc.Resume()
+	}
+}
+
+// Parks the run loop while it's paused, returns false when it should exit
+func (pc *PersonalComputer) waitWhilePaused() bool {
+	loop := &pc.runLoop
+	loop.mutex.Lock()
+	defer loop.mutex.Unlock()
+
+	for loop.paused && !loop.stop {
+		if !loop.parked {
+			loop.parked = true
+			loop.cond.Broadcast()
+		}
+		loop.cond.Wait()
+	}
+	loop.parked = false
+
+	return !loop.stop
+}
+
+func (pc *PersonalComputer) run(done chan struct{}) {
+	defer func() {
+		loop := &pc.runLoop
+		loop.mutex.Lock()
+		loop.running = false
+		loop.parked = false
+		loop.cond.Broadcast()
+		loop.mutex.Unlock()
+
+		pc.refreshVideo()
+		close(done)
+	}()
+
+	for steps := 1; pc.waitWhilePaused(); steps++ {
+		if pc.cpu.GetIP() == 0x0 { break } //loop until instruction pointer equals 0
+
+		pc.Step()
+
+		if steps%VideoRefreshSteps == 0 {
+			pc.refreshVideo()
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package pc
+
+/*
+	Memory access for host tooling (debuggers, scripting harnesses, UIs)
+	Accesses go through the memory controller the cpu uses, so the bios overlay and locked regions apply.
+	Addresses are physical, there is nothing between the cpu's linear addresses and the memory controller.
+*/
+
+// Reads n bytes from physical address addr, stopping short at the end of the address space
+func (pc *PersonalComputer) ReadMemory(addr uint32, n int) []byte {
+	data := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		value, err := pc.memController.ReadAddr8(addr + uint32(i))
+		if err != nil {
+			break
+		}
+		data = append(data, value)
+	}
+	return data
+}
+
+// Writes data at physical address addr, bytes past the end of ram are discarded
+func (pc *PersonalComputer) WriteMemory(addr uint32, data []byte) {
+	for i, value := range data {
+		err := pc.memController.WriteAddr8(addr+uint32(i), value)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Reads n bytes from the real mode address segment:offset
+func (pc *PersonalComputer) ReadMemorySegmented(segment uint16, offset uint16, n int) []byte {
+	return pc.ReadMemory(realModeAddress(segment, offset), n)
+}
+
+// Writes data at the real mode address segment:offset
+func (pc *PersonalComputer) WriteMemorySegmented(segment uint16, offset uint16, data []byte) {
+	pc.WriteMemory(realModeAddress(segment, offset), data)
+}
+
+func realModeAddress(segment uint16, offset uint16) uint32 {
+	return uint32(segment)<<4 + uint32(offset)
+}
@@ -3,12 +3,19 @@ package pc
 import (
 	"fmt"
 	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bios"
 	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/disk"
 	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/devices/intel8254"
 	"github.com/andrewjc/threeatesix/devices/intel8259a"
 	"github.com/andrewjc/threeatesix/devices/io"
+	"github.com/andrewjc/threeatesix/devices/mc146818"
 	"github.com/andrewjc/threeatesix/devices/memmap"
+	"github.com/andrewjc/threeatesix/devices/ns16550"
+	"github.com/andrewjc/threeatesix/devices/pci"
 	"github.com/andrewjc/threeatesix/devices/ps2"
+	"github.com/andrewjc/threeatesix/devices/vga"
 	"io/ioutil"
 	"os"
 )
@@ -34,16 +41,38 @@ type PersonalComputer struct {
 	ioPortController *io.IOPortAccessController
 
 	ps2Controller    *ps2.Ps2Controller
+
+	realTimeClock             *mc146818.Mc146818
+	programmableIntervalTimer *intel8254.Intel8254
+
+	biosServices *bios.BiosServices
+
+	videoAdapter *vga.Vga
+
+	pciHostBridge *pci.HostBridge // nil until EnablePci
+
+	serialPorts [MaxSerialPorts]*ns16550.Ns16550 // see serial.go
+
+	clock common.Clock
+
+	inputs inputLog // see inputlog.go
+
+	runLoop runLoop // see lifecycle.go
+
+	scheduler scheduler // ticks the timers, see scheduler.go
 }
 
 // BiosFilename - name of the bios image the virtual machine will boot up
 const BiosFilename = "bios.bin"
 
-// MaxRAMBytes - the amount of ram installed in this virtual machine
+// MaxRAMBytes - the amount of ram installed in this virtual machine, unless the MachineConfig sets it
 //const MaxRAMBytes = 0x1E84800 //32 million (32mb)
 const MaxRAMBytes = 0xF42400 //8mb
 //const MaxRAMBytes = 0x100000000 //4GB
 
+// VideoRefreshSteps - the number of instructions executed between video refreshes
+const VideoRefreshSteps = 10000
+
 func (pc *PersonalComputer) Power() {
 	// do stuff
 
@@ -51,47 +80,81 @@ func (pc *PersonalComputer) Power() {
 	pc.cpu.Init(pc.bus)
 	pc.mathCoProcessor.Init(pc.bus)
 
-	for {
-		if pc.cpu.GetIP() == 0x0 { break } //loop until instruction pointer equals 0
-
-		pc.cpu.Step()
-
+	err := pc.biosServices.Post()
+	if err != nil {
+		common.DefaultLogger.Errorf("BIOS services POST failed: %s", err.Error())
 	}
+
+	pc.Start()
+	pc.Wait()
 }
 
+// Executes a single instruction, first injecting any replayed input events that are due, then ticks the timers
+// if they are due
+func (pc *PersonalComputer) Step() {
+	pc.deliverReplayedInputs()
+	wasHalted := pc.cpu.IsHalted()
+	pc.cpu.Step()
+	pc.advanceScheduler(!wasHalted || !pc.cpu.IsHalted())
+}
 
 func NewPc() *PersonalComputer {
+	return NewPcWithClock(common.SystemClock{})
+}
+
+// Builds a pc whose time dependent devices (RTC, PIT) read from the given clock
+func NewPcWithClock(clock common.Clock) *PersonalComputer {
+	return NewPcWithConfig(MachineConfig{Clock: clock})
+}
+
+// Builds a pc with the options in config, see config.go
+func NewPcWithConfig(config MachineConfig) *PersonalComputer {
 	pc := &PersonalComputer{}
 
+	pc.clock = config.Clock
+	if pc.clock == nil {
+		pc.clock = common.SystemClock{}
+	}
+
 	pc.bus = bus.NewDeviceBus()
-	pc.ram = make([]byte, MaxRAMBytes)
+	ramBytes := config.RamBytes
+	if ramBytes == 0 {
+		ramBytes = MaxRAMBytes
+	}
+	pc.ram = make([]byte, ramBytes)
+	config.RamInit.fill(pc.ram)
 	pc.rom = romimages{}
 	pc.cpu = intel8086.New80386CPU()
 	pc.mathCoProcessor = intel8086.New80287MathCoProcessor()
 
 	pc.masterInterruptController = intel8259a.NewIntel8259a() //pic1
 	pc.slaveInterruptController = intel8259a.NewIntel8259a()  //pic2
+	pc.masterInterruptController.ConnectSlave(pc.slaveInterruptController)
 
 	pc.memController = memmap.CreateMemoryController(&pc.ram, &pc.rom.bios)
-
 	pc.ioPortController = io.CreateIOPortController()
-
-	pc.memController.SetBus(pc.bus)
-
-	pc.ioPortController.SetBus(pc.bus)
-
 	pc.ps2Controller = ps2.CreatePS2Controller()
-	pc.ps2Controller.SetBus(pc.bus)
+	pc.realTimeClock = mc146818.NewMc146818(pc.clock)
+	pc.programmableIntervalTimer = intel8254.NewIntel8254(pc.clock)
+	pc.videoAdapter = vga.NewVga(pc.memController)
+	pc.biosServices = bios.NewBiosServices(pc.cpu, pc.memController, pc.videoAdapter)
 
-	pc.bus.RegisterDevice(pc.cpu, common.MODULE_PRIMARY_PROCESSOR)
-	pc.bus.RegisterDevice(pc.mathCoProcessor, common.MODULE_MATH_CO_PROCESSOR)
-	pc.bus.RegisterDevice(pc.masterInterruptController, common.MODULE_MASTER_INTERRUPT_CONTROLLER)
-	pc.bus.RegisterDevice(pc.slaveInterruptController, common.MODULE_SLAVE_INTERRUPT_CONTROLLER)
+	pc.AttachDevice(pc.cpu, common.MODULE_PRIMARY_PROCESSOR)
+	pc.AttachDevice(pc.mathCoProcessor, common.MODULE_MATH_CO_PROCESSOR)
+	pc.AttachDevice(pc.masterInterruptController, common.MODULE_MASTER_INTERRUPT_CONTROLLER)
+	pc.AttachDevice(pc.slaveInterruptController, common.MODULE_SLAVE_INTERRUPT_CONTROLLER)
 
-	pc.bus.RegisterDevice(pc.memController, common.MODULE_MEMORY_ACCESS_CONTROLLER)
-	pc.bus.RegisterDevice(pc.ioPortController, common.MODULE_IO_PORT_ACCESS_CONTROLLER)
+	pc.AttachDevice(pc.memController, common.MODULE_MEMORY_ACCESS_CONTROLLER)
+	pc.AttachDevice(pc.ioPortController, common.MODULE_IO_PORT_ACCESS_CONTROLLER)
 
-	pc.bus.RegisterDevice(pc.ps2Controller, common.MODULE_PS2_CONTROLLER)
+	pc.AttachDevice(pc.ps2Controller, common.MODULE_PS2_CONTROLLER)
+	pc.AttachDevice(pc.realTimeClock, common.MODULE_REAL_TIME_CLOCK)
+	pc.AttachDevice(pc.programmableIntervalTimer, common.MODULE_PROGRAMMABLE_INTERVAL_TIMER)
+	pc.AttachDevice(pc.biosServices, common.MODULE_BIOS_SERVICES)
+	pc.AttachDevice(pc.videoAdapter, common.MODULE_VIDEO_ADAPTER)
+
+	pc.AttachTimer(pc.programmableIntervalTimer)
+	pc.SetSchedulerConfig(config.Scheduler)
 
 	return pc
 }
@@ -104,18 +167,111 @@ func (pc *PersonalComputer) GetMemoryController() *memmap.MemoryAccessController
 	return pc.memController
 }
 
+func (pc *PersonalComputer) GetMasterInterruptController() *intel8259a.Intel8259a {
+	return pc.masterInterruptController
+}
+
+func (pc *PersonalComputer) GetSlaveInterruptController() *intel8259a.Intel8259a {
+	return pc.slaveInterruptController
+}
+
+func (pc *PersonalComputer) GetBiosServices() *bios.BiosServices {
+	return pc.biosServices
+}
+
+func (pc *PersonalComputer) GetIOPortController() *io.IOPortAccessController {
+	return pc.ioPortController
+}
+
+func (pc *PersonalComputer) GetVideoAdapter() *vga.Vga {
+	return pc.videoAdapter
+}
+
+// Attaches the backend the video adapter renders into, nil discards the output
+func (pc *PersonalComputer) SetVideoBackend(backend vga.VideoBackend) {
+	pc.videoAdapter.SetBackend(backend)
+}
+
+// Attaches a handler told the frequency of the PC speaker whenever its tone changes, nil stops the reports
+func (pc *PersonalComputer) SetSpeakerHandler(handler intel8254.SpeakerHandler) {
+	pc.programmableIntervalTimer.SetSpeakerHandler(handler)
+}
+
+func (pc *PersonalComputer) refreshVideo() {
+	err := pc.videoAdapter.Refresh()
+	if err != nil {
+		common.DefaultLogger.Errorf("Video refresh failed: %s", err.Error())
+	}
+}
+
+// Adds a PCI host bridge decoding the configuration ports 0xCF8-0xCFF. The AT has no PCI bus so it is left out
+// unless a machine asks for it.
+func (pc *PersonalComputer) EnablePci() *pci.HostBridge {
+	if pc.pciHostBridge == nil {
+		pc.pciHostBridge = pci.NewHostBridge()
+		pc.AttachDevice(pc.pciHostBridge, common.MODULE_PCI_HOST_BRIDGE)
+		pc.ioPortController.AttachPortDevice(pci.ConfigAddressPort, pci.ConfigDataPort+3, pc.pciHostBridge)
+	}
+	return pc.pciHostBridge
+}
+
+// Gets the PCI host bridge, nil unless EnablePci has been called
+func (pc *PersonalComputer) GetPciHostBridge() *pci.HostBridge {
+	return pc.pciHostBridge
+}
+
 func (pc *PersonalComputer) GetBus() *bus.Bus {
 	return pc.bus
 }
 
+// Devices which talk to the rest of the machine over the bus implement this to be handed it when attached
+type busConnectedDevice interface {
+	SetBus(bus *bus.Bus)
+}
+
+// Attaches a device to the machine's bus under the given module id, returning the bus id assigned to it. Devices
+// which need the bus are connected to it first, so they can find their peers once the machine is running.
+func (pc *PersonalComputer) AttachDevice(device bus.BusDevice, deviceType bus.DeviceType) uint32 {
+	if connected, ok := device.(busConnectedDevice); ok {
+		connected.SetBus(pc.bus)
+	}
+	return pc.bus.RegisterDevice(device, deviceType)
+}
+
+func (pc *PersonalComputer) GetClock() common.Clock {
+	return pc.clock
+}
+
+// Attaches a disk image as the first hard disk and loads its boot sector at 0000:7C00 ready to run
+func (pc *PersonalComputer) BootFromImage(path string) error {
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = pc.biosServices.LoadBootSector(image, bios.BOOT_DRIVE_FIRST_HARD_DISK)
+	if err != nil {
+		return err
+	}
+
+	bootDisk, err := disk.NewDiskFromImage(image)
+	if err != nil {
+		return err
+	}
+	pc.AttachDisk(bios.BOOT_DRIVE_FIRST_HARD_DISK, bootDisk)
+	return nil
+}
+
+// Attaches a disk as the bios drive number, 00h for the first floppy and 80h for the first hard disk
+func (pc *PersonalComputer) AttachDisk(drive uint8, attached *disk.Disk) {
+	pc.biosServices.AttachDisk(drive, attached)
+}
+
 func (pc *PersonalComputer) LoadBios() {
-	var fileLength int32
-	fi, err := os.Stat(BiosFilename)
+	_, err := os.Stat(BiosFilename)
 	if err != nil {
 		// Could not obtain stat, handle error
 	} else {
-		fileLength = int32(fi.Size())
-
 		biosData, err := ioutil.ReadFile(BiosFilename)
 
 		if err != nil {
@@ -123,11 +279,10 @@ func (pc *PersonalComputer) LoadBios() {
 			os.Exit(1)
 		}
 
-		romChipSize := int32(fileLength)
-		pc.rom.bios = make([]byte, romChipSize)
-		for i := fileLength-1;i>=0;i-- {
-			offset := romChipSize-(fileLength-i)
-			pc.rom.bios[offset] = biosData[i]
+		err = pc.LoadBiosImage(biosData, BiosImageOptions{})
+		if err != nil {
+			fmt.Printf("Failed to load bios! - %s", err.Error())
+			os.Exit(1)
 		}
 	}
 
@@ -0,0 +1,67 @@
+package pc
+
+/*
+	Device timing scheduler
+	The cpu runs with no notion of device time, so a timer only notices time passing when something asks it to.
+	The scheduler ticks every attached timer once a set number of instructions has executed or a set number of
+	cpu cycles has accumulated, whichever comes first. On a tick the timers raise their interrupt lines for
+	anything that fell due, and the cpu takes the interrupts at the following instruction boundaries.
+
+	Both intervals are 0 by default, which turns them off, so the timers are never ticked until the machine is
+	configured to. Halted steps count cycles but not instructions.
+*/
+
+// How often the scheduler ticks the timers, 0 disables an interval
+type SchedulerConfig struct {
+	InstructionsPerTick uint64
+	CyclesPerTick       uint64
+}
+
+// A device which advances on the scheduler's ticks
+type TimerDevice interface {
+	Tick()
+}
+
+type scheduler struct {
+	config SchedulerConfig
+	timers []TimerDevice
+
+	instructions  uint64 // executed since the last tick
+	lastTickCycle uint64
+}
+
+func (pc *PersonalComputer) SetSchedulerConfig(config SchedulerConfig) {
+	pc.scheduler.config = config
+	pc.scheduler.instructions = 0
+	pc.scheduler.lastTickCycle = pc.cpu.GetCycleCount()
+}
+
+func (pc *PersonalComputer) GetSchedulerConfig() SchedulerConfig {
+	return pc.scheduler.config
+}
+
+// Adds a device to be ticked by the scheduler
+func (pc *PersonalComputer) AttachTimer(timer TimerDevice) {
+	pc.scheduler.timers = append(pc.scheduler.timers, timer)
+}
+
+// Counts a step and ticks the timers when either interval has elapsed
+func (pc *PersonalComputer) advanceScheduler(executed bool) {
+	s := &pc.scheduler
+	if executed {
+		s.instructions++
+	}
+
+	cycles := pc.cpu.GetCycleCount()
+	due := s.config.InstructionsPerTick != 0 && s.instructions >= s.config.InstructionsPerTick
+	due = due || s.config.CyclesPerTick != 0 && cycles-s.lastTickCycle >= s.config.CyclesPerTick
+	if !due {
+		return
+	}
+
+	s.instructions = 0
+	s.lastTickCycle = cycles
+	for _, timer := range s.timers {
+		timer.Tick()
+	}
+}
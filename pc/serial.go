@@ -0,0 +1,48 @@
+package pc
+
+import (
+	"fmt"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/ns16550"
+	"io"
+)
+
+/*
+	Serial ports
+	Up to four 16550 uarts at the standard COM port bases, COM1 and COM3 sharing IRQ4 and COM2 and COM4 sharing
+	IRQ3. Each has its own host streams. None are fitted until attached, and an attached port is ticked by the
+	scheduler so data arriving on its input stream can interrupt without the program polling it.
+*/
+
+const MaxSerialPorts = 4
+
+var serialPortBases = [MaxSerialPorts]uint16{0x3F8, 0x2F8, 0x3E8, 0x2E8}
+var serialPortIrqs = [MaxSerialPorts]uint8{4, 3, 4, 3}
+
+// Fits COMn (1-4) with a uart reading from input and writing to output, either of which can be nil
+func (pc *PersonalComputer) AttachSerialPort(n int, input io.Reader, output io.Writer) (*ns16550.Ns16550, error) {
+	if n < 1 || n > MaxSerialPorts {
+		return nil, fmt.Errorf("there is no COM%d, ports are COM1 to COM%d", n, MaxSerialPorts)
+	}
+	if pc.serialPorts[n-1] != nil {
+		return nil, fmt.Errorf("COM%d is already attached", n)
+	}
+
+	base := serialPortBases[n-1]
+	uart := ns16550.NewNs16550(base, serialPortIrqs[n-1], input, output)
+	pc.serialPorts[n-1] = uart
+
+	pc.AttachDevice(uart, common.MODULE_SERIAL_PORT)
+	pc.ioPortController.AttachPortDevice(base, base+ns16550.UART_REGISTER_COUNT-1, uart)
+	pc.AttachTimer(uart)
+
+	return uart, nil
+}
+
+// Gets the uart fitted as COMn, nil if there isn't one
+func (pc *PersonalComputer) GetSerialPort(n int) *ns16550.Ns16550 {
+	if n < 1 || n > MaxSerialPorts {
+		return nil
+	}
+	return pc.serialPorts[n-1]
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+func Test_HostMemoryAccess(t *testing.T) {
+
+	// nop
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x90})
+	data := []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02, 0x03}
+
+	testPc.WriteMemory(0x4000, data)
+	testPc.GetPrimaryCpu().Step()
+
+	if read := testPc.ReadMemory(0x4000, len(data)); !bytes.Equal(read, data) {
+		t.Errorf("Expected [% x] to read back after a step but got [% x]", data, read)
+	}
+	if value, _ := testPc.GetMemoryController().ReadAddr16(0x4002); value != 0xefbe {
+		t.Errorf("Expected the memory controller to see [%#04x] but got [%#04x]", 0xefbe, value)
+	}
+}
+
+func Test_HostMemoryAccessSegmented(t *testing.T) {
+
+	testPc := newTestPc()
+
+	testPc.WriteMemorySegmented(0x0400, 0x0010, []byte{0x11, 0x22})
+
+	if read := testPc.ReadMemory(0x4010, 2); !bytes.Equal(read, []byte{0x11, 0x22}) {
+		t.Errorf("Expected 0400:0010 to map to [%#05x] but read [% x]", 0x4010, read)
+	}
+	if read := testPc.ReadMemorySegmented(0x0401, 0x0000, 2); !bytes.Equal(read, []byte{0x11, 0x22}) {
+		t.Errorf("Expected 0401:0000 to alias 0400:0010 but read [% x]", read)
+	}
+}
+
+func Test_HostMemoryAccessPastEndOfRam(t *testing.T) {
+
+	testPc := newTestPc()
+
+	// the bytes past the end of ram are dropped rather than panicking
+	testPc.WriteMemory(pc.MaxRAMBytes-2, []byte{0x01, 0x02, 0x03, 0x04})
+
+	if read := testPc.ReadMemory(pc.MaxRAMBytes-2, 2); !bytes.Equal(read, []byte{0x01, 0x02}) {
+		t.Errorf("Expected the bytes inside ram to be written but read [% x]", read)
+	}
+}
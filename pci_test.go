@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/pci"
+	"testing"
+)
+
+// mov dx, 0xcf8; out dx, eax; mov dx, 0xcfc; in eax, dx
+var readPciConfig = []uint8{0xba, 0xf8, 0x0c, 0x66, 0xef, 0xba, 0xfc, 0x0c, 0x66, 0xed}
+
+func Test_PciHostBridgeId(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		address  uint32
+		expected uint32
+	}{
+		{"TestVendorAndDeviceId", 0x80000000, 0x12378086},
+		{"TestClassCode", 0x80000008, 0x06000000},
+		{"TestEmptySlot", 0x80001800, 0xffffffff},
+		{"TestCycleNotEnabled", 0x00000000, 0xffffffff},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, readPciConfig)
+		testPc.EnablePci()
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().EAX = tt.address
+
+			for i := 0; i < 4; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().EAX != tt.expected {
+				t.Errorf("Expected [%#08x] but got [%#08x]", tt.expected, cpu.GetRegisters().EAX)
+			}
+			if testPc.GetPciHostBridge().GetConfigAddress() != tt.address {
+				t.Errorf("Expected the address register to hold [%#08x] but got [%#08x]", tt.address, testPc.GetPciHostBridge().GetConfigAddress())
+			}
+		})
+	}
+}
+
+func Test_PciDeviceConfigAccess(t *testing.T) {
+	testPc := newTestPc()
+	bridge := testPc.EnablePci()
+	device := &pci.ConfigSpace{VendorId: 0x10ec, DeviceId: 0x8029, ClassCode: 0x020000}
+
+	if err := bridge.RegisterDevice(0, 3, 0, device); err != nil {
+		t.Fatalf("Expected the device to register but got %s", err)
+	}
+	if err := bridge.RegisterDevice(0, 3, 0, device); err == nil {
+		t.Errorf("Expected a second device in the same slot to be refused")
+	}
+	if err := bridge.RegisterDevice(0, 32, 0, device); err == nil {
+		t.Errorf("Expected an out of range device number to be refused")
+	}
+
+	ports := testPc.GetIOPortController()
+
+	// bus 0, device 3, function 0, register 0x10
+	ports.WriteAddr32(pci.ConfigAddressPort, 0x80001810)
+	ports.WriteAddr32(pci.ConfigDataPort, 0xfebc0000)
+	ports.WriteAddr8(pci.ConfigDataPort+1, 0x12)
+
+	if value := ports.ReadAddr32(pci.ConfigDataPort); value != 0xfebc1200 {
+		t.Errorf("Expected the register to hold [%#08x] but got [%#08x]", 0xfebc1200, value)
+	}
+	if value := ports.ReadAddr16(pci.ConfigDataPort + 2); value != 0xfebc {
+		t.Errorf("Expected the upper word [%#04x] but got [%#04x]", 0xfebc, value)
+	}
+
+	// the identification registers are read only
+	ports.WriteAddr32(pci.ConfigAddressPort, 0x80001800)
+	ports.WriteAddr32(pci.ConfigDataPort, 0)
+
+	if value := ports.ReadAddr32(pci.ConfigDataPort); value != 0x802910ec {
+		t.Errorf("Expected the vendor and device id [%#08x] but got [%#08x]", 0x802910ec, value)
+	}
+}
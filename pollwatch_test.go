@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_PollWatch(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		expectedCalls int
+	}{
+		// l: in al, dx; test al, 0x80; jz l
+		{"TestTightPollLoop", []uint8{0xec, 0xa8, 0x80, 0x74, 0xfb}, 1},
+		// l: in al, dx; out 0xe0, al; test al, 0x80; jz l
+		{"TestWriteEndsTheRun", []uint8{0xec, 0xe6, 0xe0, 0xa8, 0x80, 0x74, 0xf9}, 0},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().DX = 0x0300
+
+			calls := 0
+			testPc.GetIOPortController().SetPollWatch(10, func(port uint16, value uint32, reads int) {
+				calls++
+				if port != 0x0300 || value != 0 || reads != 10 {
+					t.Errorf("Expected 10 reads of 0 from port 0x0300 but got %d reads of [%#x] from [%#04x]", reads, value, port)
+				}
+			})
+
+			for i := 0; i < 60; i++ {
+				cpu.Step()
+			}
+
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected the watch to fire %d times but it fired %d times", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func Test_PollWatchChangingValue(t *testing.T) {
+	testPc := newTestPc()
+	ports := testPc.GetIOPortController()
+	device := &stubPortDevice{input: []uint16{1, 1, 1, 2, 2, 2, 2}}
+	ports.AttachPortDevice(0x1f0, 0x1f7, device)
+
+	calls := 0
+	ports.SetPollWatch(4, func(port uint16, value uint32, reads int) {
+		calls++
+		if value != 2 {
+			t.Errorf("Expected the run of 2s to fire but got [%#x]", value)
+		}
+	})
+
+	for i := 0; i < 7; i++ {
+		ports.ReadAddr8(0x1f7)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the watch to fire once but it fired %d times", calls)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+)
+
+// Port device decoding dword accesses as a single register, like the PCI configuration ports
+type stubPortDevice32 struct {
+	stubPortDevice
+	register uint32
+}
+
+func (device *stubPortDevice32) ReadPort32(port uint16) uint32 {
+	return device.register
+}
+
+func (device *stubPortDevice32) WritePort32(port uint16, value uint32) {
+	device.register = value
+}
+
+func Test_PortIo32(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedIP  uint16
+	}{
+		// out dx, eax; xor eax, eax; in eax, dx
+		{"TestPortIo32Dx", []uint8{0x66, 0xef, 0x66, 0x31, 0xc0, 0x66, 0xed}, 0x0107},
+		// out 0xf8, eax; xor eax, eax; in eax, 0xf8
+		{"TestPortIo32Imm8", []uint8{0x66, 0xe7, 0xf8, 0x66, 0x31, 0xc0, 0x66, 0xe5, 0xf8}, 0x0109},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			device := &stubPortDevice32{}
+			testPc.GetIOPortController().AttachPortDevice(0xf8, 0xff, device)
+			cpu.GetRegisters().DX = 0x00f8
+			cpu.GetRegisters().EAX = 0x80001234
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			if device.register != 0x80001234 {
+				t.Errorf("Expected the device to see a single dword write [%#08x] but got [%#08x]", 0x80001234, device.register)
+			}
+			if len(device.output) != 0 {
+				t.Errorf("Expected no word writes but got %v", device.output)
+			}
+			if cpu.GetRegisters().EAX != 0x80001234 {
+				t.Errorf("Expected EAX [%#08x] but got [%#08x]", 0x80001234, cpu.GetRegisters().EAX)
+			}
+			if cpu.GetIP() != tt.expectedIP {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", tt.expectedIP, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_PortIo32SplitIntoWords(t *testing.T) {
+
+	// out dx, eax; in eax, dx
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x66, 0xef, 0x66, 0xed})
+	cpu := testPc.GetPrimaryCpu()
+	device := &stubPortDevice{input: []uint16{0xbeef, 0xdead}}
+	testPc.GetIOPortController().AttachPortDevice(0x1f0, 0x1f7, device)
+	cpu.GetRegisters().DX = 0x01f0
+	cpu.GetRegisters().EAX = 0x11112222
+
+	cpu.Step()
+	cpu.Step()
+
+	if len(device.output) != 2 || device.output[0] != 0x2222 || device.output[1] != 0x1111 {
+		t.Errorf("Expected word writes [0x2222 0x1111] but got %#04x", device.output)
+	}
+	if cpu.GetRegisters().EAX != 0xdeadbeef {
+		t.Errorf("Expected EAX [%#08x] but got [%#08x]", 0xdeadbeef, cpu.GetRegisters().EAX)
+	}
+}
+
+func Test_PortIo16(t *testing.T) {
+
+	// in ax, 0xf8; in al, dx
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xe5, 0xf8, 0xec})
+	cpu := testPc.GetPrimaryCpu()
+	device := &stubPortDevice{input: []uint16{0x1234, 0x0056}}
+	testPc.GetIOPortController().AttachPortDevice(0xf8, 0xff, device)
+	cpu.GetRegisters().DX = 0x00fa
+
+	cpu.Step()
+	if cpu.GetRegisters().AX != 0x1234 || cpu.GetIP() != 0x0102 {
+		t.Errorf("Expected in ax, imm8 to read [%#04x] and end at [%#04x] but got [%#04x] at [%#04x]", 0x1234, 0x0102, cpu.GetRegisters().AX, cpu.GetIP())
+	}
+
+	cpu.Step()
+	if cpu.GetRegisters().AL != 0x56 || cpu.GetIP() != 0x0103 {
+		t.Errorf("Expected in al, dx to read [%#02x] and end at [%#04x] but got [%#02x] at [%#04x]", 0x56, 0x0103, cpu.GetRegisters().AL, cpu.GetIP())
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_PrefetchQueueStaleFetch(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		prefetch   bool
+		expectedAX uint16
+	}{
+		{"TestPrefetchQueueEnabled", true, 0x9040},
+		{"TestPrefetchQueueDisabled", false, 0x9041},
+	}
+	for _, tt := range tests {
+
+		// mov [0x0104], ax; nop; nop, the write turns the first nop into inc ax
+		testPc := newTestPcWithInstructions(0x100, []uint8{0x89, 0x06, 0x04, 0x01, 0x90, 0x90})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetPrefetchQueueEnabled(tt.prefetch)
+			cpu.GetRegisters().AX = 0x9040
+
+			cpu.Step()
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetIP() != 0x0105 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0105, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_PrefetchQueueFlushedByJump(t *testing.T) {
+
+	// mov [0x0104], ax; nop; nop; jmp 0x0104
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x89, 0x06, 0x04, 0x01, 0x90, 0x90, 0xeb, 0xfc})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetPrefetchQueueEnabled(true)
+	cpu.GetRegisters().AX = 0x9040
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().AX != 0x9040 || cpu.GetIP() != 0x0104 {
+		t.Fatalf("Expected the stale nop to run and the jump to land on [%#04x] but got AX [%#04x] at [%#04x]", 0x0104, cpu.GetRegisters().AX, cpu.GetIP())
+	}
+
+	cpu.Step() // inc ax, fetched fresh after the jump
+
+	if cpu.GetRegisters().AX != 0x9041 {
+		t.Errorf("Expected the jump to flush the queue so inc ax runs, AX [%#04x] but got [%#04x]", 0x9041, cpu.GetRegisters().AX)
+	}
+}
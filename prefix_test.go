@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_StackedPrefixes(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedAX  uint16
+	}{
+		// lodsw from es:si with prefixes from different groups either way round
+		{"TestSegmentThenRep", []uint8{0x26, 0xf3, 0xad}, 0x2211},
+		{"TestRepThenSegment", []uint8{0xf3, 0x26, 0xad}, 0x2211},
+		// the last segment override wins
+		{"TestLastSegmentOverrideCs", []uint8{0x26, 0x2e, 0xad}, 0xbbaa},
+		{"TestLastSegmentOverrideEs", []uint8{0x2e, 0x26, 0xad}, 0x2211},
+		// redundant prefixes are ignored
+		{"TestRepeatedPrefixes", []uint8{0x26, 0xf3, 0x26, 0xf3, 0x26, 0xad}, 0x2211},
+	}
+	for _, tt := range tests {
+
+		// mov ax, 0x0100; mov es, ax; mov ax, 0x0200; mov ds, ax
+		testPc := newTestPcWithInstructions(0x100, append([]uint8{0xb8, 0x00, 0x01, 0x8e, 0xc0, 0xb8, 0x00, 0x02, 0x8e, 0xd8}, tt.instruction...))
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr16(0x0600, 0xbbaa)
+			mem.WriteAddr16(0x1000+0x0600, 0x2211)
+			mem.WriteAddr16(0x2000+0x0600, 0x3333)
+			cpu.GetRegisters().SI = 0x0600
+			cpu.GetRegisters().CX = 1
+
+			for i := 0; i < 5; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().AX != tt.expectedAX {
+				t.Errorf("Expected AX [%#04x] but got [%#04x]", tt.expectedAX, cpu.GetRegisters().AX)
+			}
+			if cpu.GetIP() != 0x10a+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x10a+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_RepneMovs(t *testing.T) {
+
+	// repne movsb repeats as rep does, only the compares check ZF
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xf2, 0xa4})
+	cpu := testPc.GetPrimaryCpu()
+	for i, b := range []uint8{0x11, 0x22, 0x33} {
+		testPc.GetMemoryController().WriteAddr8(0x0600+uint32(i), b)
+	}
+	cpu.GetRegisters().CX = 3
+	cpu.GetRegisters().SI = 0x0600
+	cpu.GetRegisters().DI = 0x0700
+
+	cpu.Step()
+
+	if copied := testPc.ReadMemory(0x0700, 3); string(copied) != string([]uint8{0x11, 0x22, 0x33}) {
+		t.Errorf("Expected 11 22 33 at [%#04x] but got % x", 0x0700, copied)
+	}
+	if cpu.GetRegisters().CX != 0 || cpu.GetIP() != 0x102 {
+		t.Errorf("Expected CX [0000] and IP [0102] but got [%#04x] and [%#04x]", cpu.GetRegisters().CX, cpu.GetIP())
+	}
+}
+
+func Test_InstructionLengthLimit(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		instruction   []uint8
+		expectedFault bool
+	}{
+		// 14 prefixes and a nop is 15 bytes
+		{"TestFifteenBytes", append(repeatedPrefix(0x26, 14), 0x90), false},
+		{"TestSixteenBytes", append(repeatedPrefix(0x26, 15), 0x90), true},
+		// push dword 0x11223344 is 6 bytes with its size prefix
+		{"TestImmediateWithinLimit", append(repeatedPrefix(0x26, 9), 0x66, 0x68, 0x44, 0x33, 0x22, 0x11), false},
+		// the immediate crosses the limit
+		{"TestImmediateBeyondLimit", append(repeatedPrefix(0x26, 10), 0x66, 0x68, 0x44, 0x33, 0x22, 0x11), true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			cpu.GetRegisters().SP = 0x2000
+
+			// #GP handler at 0000:0500
+			mem.WriteAddr16(0x0d*4, 0x0500)
+			mem.WriteAddr16(0x0d*4+2, 0x0000)
+
+			cpu.Step()
+
+			if !tt.expectedFault {
+				if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+					t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+				}
+				return
+			}
+
+			if cpu.GetIP() != 0x0500 {
+				t.Errorf("Expected #GP to the handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+			}
+			if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+				t.Errorf("Expected #GP to return to the first prefix [%#04x] but got [%#04x]", 0x0100, returnIP)
+			}
+		})
+	}
+}
+
+func repeatedPrefix(prefix uint8, count int) []uint8 {
+	prefixes := make([]uint8, count)
+	for i := range prefixes {
+		prefixes[i] = prefix
+	}
+	return prefixes
+}
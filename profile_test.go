@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_OpcodeHistogram(t *testing.T) {
+
+	// nop; mov ax, 1; inc ax; inc ax; bt bx, ax; inc ax; bt bx, ax; mov ax, es:[bx]; nop
+	testPc := newTestPcWithInstructions(0x100, []uint8{
+		0x90,
+		0xb8, 0x01, 0x00,
+		0x40,
+		0x40,
+		0x0f, 0xa3, 0xc3,
+		0x40,
+		0x0f, 0xa3, 0xc3,
+		0x26, 0x8b, 0x07,
+		0x90,
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	if cpu.OpcodeHistogram() != nil {
+		t.Errorf("Expected no histogram before profiling is enabled")
+	}
+
+	// the first nop runs before profiling starts
+	cpu.Step()
+	cpu.EnableOpcodeProfiling()
+
+	for i := 0; i < 8; i++ {
+		cpu.Step()
+	}
+
+	expected := map[uint16]uint64{
+		0x00b8: 1,
+		0x008b: 1,
+		0x0040: 3,
+		0x0fa3: 2,
+		0x0090: 1,
+	}
+	if histogram := cpu.OpcodeHistogram(); !reflect.DeepEqual(histogram, expected) {
+		t.Errorf("Expected histogram %v but got %v", expected, histogram)
+	}
+
+	cpu.DisableOpcodeProfiling()
+	if cpu.OpcodeHistogram() != nil {
+		t.Errorf("Expected no histogram once profiling is disabled")
+	}
+}
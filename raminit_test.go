@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+func Test_RamInit(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		ramInit  pc.RamInit
+		expected byte
+	}{
+		{"TestDefaultIsZero", pc.RamInit{}, 0x00},
+		{"TestZero", pc.RamInitZero(), 0x00},
+		{"TestPattern", pc.RamInitPattern(0xa5), 0xa5},
+	}
+	for _, tt := range tests {
+
+		testPc := pc.NewPcWithConfig(pc.MachineConfig{RamInit: tt.ramInit})
+
+		t.Run(tt.name, func(t *testing.T) {
+			for _, addr := range []uint32{0x0000, 0x0600, 0x7c00, 0x9ffff, 0x100000, pc.MaxRAMBytes - 0x100} {
+				for i, value := range testPc.ReadMemory(addr, 0x100) {
+					if value != tt.expected {
+						t.Fatalf("Expected [%#02x] at [%#06x] but got [%#02x]", tt.expected, addr+uint32(i), value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_RamInitSeeded(t *testing.T) {
+
+	first := pc.NewPcWithConfig(pc.MachineConfig{RamInit: pc.RamInitSeeded(386)})
+	second := pc.NewPcWithConfig(pc.MachineConfig{RamInit: pc.RamInitSeeded(386)})
+	other := pc.NewPcWithConfig(pc.MachineConfig{RamInit: pc.RamInitSeeded(486)})
+
+	for _, addr := range []uint32{0x0000, 0x7c00, 0x100000} {
+		a := first.ReadMemory(addr, 0x1000)
+		b := second.ReadMemory(addr, 0x1000)
+		c := other.ReadMemory(addr, 0x1000)
+
+		if !bytes.Equal(a, b) {
+			t.Errorf("Expected the same seed to fill [%#06x] the same way", addr)
+		}
+		if bytes.Equal(a, c) {
+			t.Errorf("Expected a different seed to fill [%#06x] differently", addr)
+		}
+		if bytes.Equal(a, make([]byte, len(a))) {
+			t.Errorf("Expected a seeded fill at [%#06x] but it was all zero", addr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+)
+
+func Test_DefaultResetVector(t *testing.T) {
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+
+	if cpu.GetCS() != intel8086.ResetVectorCS || cpu.GetIP() != intel8086.ResetVectorIP {
+		t.Errorf("Expected reset vector [%04x:%04x] but got [%04x:%04x]", intel8086.ResetVectorCS, intel8086.ResetVectorIP, cpu.GetCS(), cpu.GetIP())
+	}
+}
+
+func Test_CustomResetVector(t *testing.T) {
+
+	testPc := pc.NewPc()
+	cpu := testPc.GetPrimaryCpu()
+
+	// start at a boot sector with the boot drive in DL
+	cpu.SetResetConfig(&intel8086.ResetConfig{
+		CS: 0x0000,
+		IP: 0x7c00,
+		SeedRegisters: func(registers *intel8086.CpuRegisters) {
+			registers.DL = 0x80
+			registers.SP = 0x7c00
+		},
+	})
+	cpu.Init(testPc.GetBus())
+
+	// mov ax, 0x1234
+	for i, b := range []uint8{0xb8, 0x34, 0x12} {
+		testPc.GetMemoryController().WriteAddr8(0x7c00+uint32(i), b)
+	}
+
+	if cpu.GetCurrentCodePointer() != 0x7c00 {
+		t.Errorf("Expected first fetch at [%#05x] but got [%#05x]", 0x7c00, cpu.GetCurrentCodePointer())
+	}
+	if cpu.GetRegisters().DL != 0x80 || cpu.GetRegisters().SP != 0x7c00 {
+		t.Errorf("Expected seeded DL [%#02x] and SP [%#04x] but got [%#02x] and [%#04x]", 0x80, 0x7c00, cpu.GetRegisters().DL, cpu.GetRegisters().SP)
+	}
+
+	cpu.Step()
+
+	if cpu.GetRegisters().AX != 0x1234 || cpu.GetIP() != 0x7c03 {
+		t.Errorf("Expected to execute at the reset vector, got AX [%#04x] IP [%#04x]", cpu.GetRegisters().AX, cpu.GetIP())
+	}
+
+	// clearing the config restores the standard vector
+	cpu.SetResetConfig(nil)
+	cpu.Reset()
+	if cpu.GetCS() != intel8086.ResetVectorCS || cpu.GetIP() != intel8086.ResetVectorIP {
+		t.Errorf("Expected reset vector [%04x:%04x] but got [%04x:%04x]", intel8086.ResetVectorCS, intel8086.ResetVectorIP, cpu.GetCS(), cpu.GetIP())
+	}
+}
+
+func Test_ResetSegmentRegisters(t *testing.T) {
+
+	testPc := newTestPc()
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().DS = cpu.GetRegisters().CS
+
+	cpu.Reset()
+
+	cs := cpu.GetRegisters().CS
+	if cs.Selector() != 0xf000 || cs.DescriptorBase() != 0xf0000 {
+		t.Errorf("Expected CS selector [%#04x] and base [%#05x] but got [%#04x] and [%#05x]", 0xf000, 0xf0000, cs.Selector(), cs.DescriptorBase())
+	}
+	if cs.Limit() != 0xffff || !cs.Present() {
+		t.Errorf("Expected CS to be a present 64k segment but got limit [%#04x] present %t", cs.Limit(), cs.Present())
+	}
+
+	for _, seg := range []struct {
+		name string
+		reg  intel8086.SegmentRegister
+	}{
+		{"DS", cpu.GetRegisters().DS},
+		{"ES", cpu.GetRegisters().ES},
+		{"SS", cpu.GetRegisters().SS},
+		{"FS", cpu.GetRegisters().FS},
+		{"GS", cpu.GetRegisters().GS},
+	} {
+		if seg.reg.Selector() != 0 || seg.reg.DescriptorBase() != 0 {
+			t.Errorf("Expected %s selector and base 0 but got [%#04x] and [%#05x]", seg.name, seg.reg.Selector(), seg.reg.DescriptorBase())
+		}
+		if seg.reg.Limit() != 0xffff || !seg.reg.Present() {
+			t.Errorf("Expected %s to be a present 64k segment but got limit [%#04x] present %t", seg.name, seg.reg.Limit(), seg.reg.Present())
+		}
+	}
+}
+
+func Test_KeyboardControllerPulseReset(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		command       uint8
+		expectedReset bool
+	}{
+		{"TestPulseReset", 0xfe, true},
+		{"TestOtherCommand", 0xad, false},
+	}
+	for _, tt := range tests {
+
+		// mov al, command; out 0x64, al
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xb0, tt.command, 0xe6, 0x64})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+
+			cpu.Step()
+			cpu.Step()
+
+			atResetVector := cpu.GetCS() == intel8086.ResetVectorCS && cpu.GetIP() == intel8086.ResetVectorIP
+			if atResetVector != tt.expectedReset {
+				t.Errorf("Expected reset %t but the cpu is at [%04x:%04x]", tt.expectedReset, cpu.GetCS(), cpu.GetIP())
+			}
+			if !tt.expectedReset && cpu.GetIP() != 0x104 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x104, cpu.GetIP())
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_Salc(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		cf         bool
+		expectedAL uint8
+	}{
+		{"TestCarrySet", true, 0xff},
+		{"TestCarryClear", false, 0x00},
+	}
+	for _, tt := range tests {
+
+		// salc
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xd6})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().AH = 0x12
+			cpu.GetRegisters().AL = 0x5a
+			cpu.GetRegisters().AX = 0x125a
+			cpu.SetFlags(intel8086.FlagsView{CF: tt.cf, ZF: true})
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AL != tt.expectedAL || cpu.GetRegisters().AX != 0x1200|uint16(tt.expectedAL) {
+				t.Errorf("Expected AL [%#02x] AX [%#04x] but got AL [%#02x] AX [%#04x]", tt.expectedAL, 0x1200|uint16(tt.expectedAL), cpu.GetRegisters().AL, cpu.GetRegisters().AX)
+			}
+			if cpu.Flags() != (intel8086.FlagsView{CF: tt.cf, ZF: true}) {
+				t.Errorf("Expected the flags to be left alone but got %+v", cpu.Flags())
+			}
+			if cpu.GetIP() != 0x101 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x101, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_SalcDisabled(t *testing.T) {
+
+	// salc is #UD without the undocumented opcodes
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xd6})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.SetFeatures(intel8086.CpuFeatures{NoUndocumentedOpcodes: true})
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().AL = 0x5a
+	cpu.SetFlags(intel8086.FlagsView{CF: true})
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if returnIP, _ := mem.ReadAddr16(0x2000 - 6); returnIP != 0x0100 {
+		t.Errorf("Expected the fault to return to the salc [%#04x] but got [%#04x]", 0x0100, returnIP)
+	}
+	if cpu.GetRegisters().AL != 0x5a {
+		t.Errorf("Expected AL to be unchanged but got [%#02x]", cpu.GetRegisters().AL)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/pc"
+	"testing"
+	"time"
+)
+
+func Test_SchedulerTicksPit(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		controlWord  uint8
+		config       pc.SchedulerConfig
+		expectedIrqs int
+	}{
+		{"TestEveryInstruction", 0x34, pc.SchedulerConfig{InstructionsPerTick: 1}, 100},
+		{"TestCoalesced", 0x34, pc.SchedulerConfig{InstructionsPerTick: 50}, 20},
+		{"TestEveryCycles", 0x34, pc.SchedulerConfig{CyclesPerTick: 250}, 4},
+		{"TestSquareWave", 0x36, pc.SchedulerConfig{InstructionsPerTick: 1}, 100},
+		{"TestTerminalCount", 0x30, pc.SchedulerConfig{InstructionsPerTick: 1}, 1},
+		{"TestDisabled", 0x34, pc.SchedulerConfig{}, 0},
+	}
+	for _, tt := range tests {
+
+		// cli; mov al, control; out 0x43, al; mov al, 0xa9; out 0x40, al; mov al, 0x04; out 0x40, al
+		// loads channel 0 with 1193, a period of 1ms, followed by nops
+		setup := []uint8{0xfa, 0xb0, tt.controlWord, 0xe6, 0x43, 0xb0, 0xa9, 0xe6, 0x40, 0xb0, 0x04, 0xe6, 0x40}
+		clock := common.NewFixedClock(time.Date(1994, time.March, 17, 13, 45, 30, 0, time.UTC))
+		testPc := newTestPcWithClock(clock, 0x100, append(setup, bytes.Repeat([]uint8{0x90}, 1000)...))
+
+		t.Run(tt.name, func(t *testing.T) {
+			pic := testPc.GetMasterInterruptController()
+			pic.WriteCommandRegister(0x11)
+			pic.WriteDataRegister(0x08)
+			pic.WriteDataRegister(0x04)
+			pic.WriteDataRegister(0x01)
+
+			testPc.SetSchedulerConfig(tt.config)
+			for i := 0; i < 7; i++ {
+				testPc.Step()
+			}
+
+			// 100us pass with every nop, 100ms in all
+			irqs := 0
+			for i := 0; i < 1000; i++ {
+				clock.Advance(100 * time.Microsecond)
+				testPc.Step()
+
+				if pic.HasPendingInterrupt() {
+					if vector := pic.AcknowledgeInterrupt(); vector != 0x08 {
+						t.Fatalf("Expected IRQ0 on vector [%#02x] but got [%#02x]", 0x08, vector)
+					}
+					pic.WriteCommandRegister(0x20)
+					irqs++
+				}
+			}
+
+			if irqs != tt.expectedIrqs {
+				t.Errorf("Expected %d timer interrupts but got %d", tt.expectedIrqs, irqs)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/devices/ns16550"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SerialPortsRouteOutput(t *testing.T) {
+
+	// mov dx, 0x3f8; mov al, 'A'; out dx, al; mov dx, 0x2f8; mov al, 'B'; out dx, al; mov al, 'C'; out dx, al
+	testPc := newTestPcWithInstructions(0x100, []uint8{
+		0xba, 0xf8, 0x03, 0xb0, 'A', 0xee,
+		0xba, 0xf8, 0x02, 0xb0, 'B', 0xee, 0xb0, 'C', 0xee,
+	})
+
+	var com1, com2 bytes.Buffer
+	if _, err := testPc.AttachSerialPort(1, nil, &com1); err != nil {
+		t.Fatalf("Failed to attach COM1: %s", err)
+	}
+	if _, err := testPc.AttachSerialPort(2, nil, &com2); err != nil {
+		t.Fatalf("Failed to attach COM2: %s", err)
+	}
+
+	cpu := testPc.GetPrimaryCpu()
+	for i := 0; i < 8; i++ {
+		cpu.Step()
+	}
+
+	if com1.String() != "A" {
+		t.Errorf("Expected COM1 to receive %q but got %q", "A", com1.String())
+	}
+	if com2.String() != "BC" {
+		t.Errorf("Expected COM2 to receive %q but got %q", "BC", com2.String())
+	}
+}
+
+func Test_SerialPortAttach(t *testing.T) {
+
+	testPc := newTestPc()
+
+	for n, expected := range map[int]struct {
+		base uint16
+		irq  uint8
+	}{1: {0x3f8, 4}, 2: {0x2f8, 3}, 3: {0x3e8, 4}, 4: {0x2e8, 3}} {
+		uart, err := testPc.AttachSerialPort(n, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to attach COM%d: %s", n, err)
+		}
+		if uart.GetBase() != expected.base || uart.GetIrqLine() != expected.irq {
+			t.Errorf("Expected COM%d at [%#04x] on IRQ%d but got [%#04x] on IRQ%d", n, expected.base, expected.irq, uart.GetBase(), uart.GetIrqLine())
+		}
+		if testPc.GetSerialPort(n) != uart {
+			t.Errorf("Expected GetSerialPort(%d) to return the attached uart", n)
+		}
+	}
+
+	if _, err := testPc.AttachSerialPort(1, nil, nil); err == nil {
+		t.Errorf("Expected attaching COM1 twice to fail")
+	}
+	if _, err := testPc.AttachSerialPort(5, nil, nil); err == nil {
+		t.Errorf("Expected attaching COM5 to fail")
+	}
+}
+
+func Test_SerialPortReceive(t *testing.T) {
+
+	testPc := newTestPc()
+	_, err := testPc.AttachSerialPort(2, strings.NewReader("hi"), nil)
+	if err != nil {
+		t.Fatalf("Failed to attach COM2: %s", err)
+	}
+
+	pic := testPc.GetMasterInterruptController()
+	pic.WriteCommandRegister(0x11)
+	pic.WriteDataRegister(0x08)
+	pic.WriteDataRegister(0x04)
+	pic.WriteDataRegister(0x01)
+
+	io := testPc.GetIOPortController()
+	// received data interrupt, OUT2 to connect the line
+	io.WriteAddr8(0x2f8+ns16550.UART_INTERRUPT_ENABLE, ns16550.UART_IER_RECEIVED_DATA)
+	io.WriteAddr8(0x2f8+ns16550.UART_MODEM_CONTROL, ns16550.UART_MCR_OUT2)
+
+	// the input stream is read on its own goroutine
+	deadline := time.Now().Add(time.Second)
+	for io.ReadAddr8(0x2f8+ns16550.UART_LINE_STATUS)&ns16550.UART_LSR_DATA_READY == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected data to arrive from the input stream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if !pic.HasPendingInterrupt() || pic.AcknowledgeInterrupt() != 0x08+3 {
+		t.Errorf("Expected received data to raise IRQ3")
+	}
+	if id := io.ReadAddr8(0x2f8 + ns16550.UART_INTERRUPT_ID); id != ns16550.UART_IIR_RECEIVED_DATA {
+		t.Errorf("Expected interrupt id [%#02x] but got [%#02x]", ns16550.UART_IIR_RECEIVED_DATA, id)
+	}
+
+	var data []byte
+	for len(data) < 2 && time.Now().Before(deadline) {
+		if io.ReadAddr8(0x2f8+ns16550.UART_LINE_STATUS)&ns16550.UART_LSR_DATA_READY != 0 {
+			data = append(data, io.ReadAddr8(0x2f8+ns16550.UART_DATA))
+		}
+	}
+	if string(data) != "hi" {
+		t.Errorf("Expected to receive %q but got %q", "hi", string(data))
+	}
+	if id := io.ReadAddr8(0x2f8 + ns16550.UART_INTERRUPT_ID); id != ns16550.UART_IIR_NONE {
+		t.Errorf("Expected no interrupt once the data is read but got [%#02x]", id)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_ShiftDouble(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		dest        uint32
+		src         uint32
+		cl          uint8
+		expected    uint32
+		expectedCF  bool
+	}{
+		// shld eax, ebx, imm8 and shrd eax, ebx, imm8
+		{"TestShld32By1", []uint8{0x66, 0x0f, 0xa4, 0xd8, 0x01}, 0x80000001, 0x80000000, 0, 0x00000003, true},
+		{"TestShld32By16", []uint8{0x66, 0x0f, 0xa4, 0xd8, 0x10}, 0x12345678, 0x9abcdef0, 0, 0x56789abc, false},
+		{"TestShld32By31", []uint8{0x66, 0x0f, 0xa4, 0xd8, 0x1f}, 0x12345678, 0x9abcdef0, 0, 0x4d5e6f78, false},
+		{"TestShrd32By1", []uint8{0x66, 0x0f, 0xac, 0xd8, 0x01}, 0x00000001, 0x00000001, 0, 0x80000000, true},
+		{"TestShrd32By16", []uint8{0x66, 0x0f, 0xac, 0xd8, 0x10}, 0x12345678, 0x9abcdef0, 0, 0xdef01234, false},
+		{"TestShrd32By31", []uint8{0x66, 0x0f, 0xac, 0xd8, 0x1f}, 0x12345678, 0x9abcdef0, 0, 0x3579bde0, false},
+		// shld eax, ebx, cl, the count is taken modulo 32
+		{"TestShld32ByCl32", []uint8{0x66, 0x0f, 0xa5, 0xd8}, 0x12345678, 0x9abcdef0, 32, 0x12345678, false},
+		{"TestShld32ByCl33", []uint8{0x66, 0x0f, 0xa5, 0xd8}, 0x80000001, 0x80000000, 33, 0x00000003, true},
+		{"TestShrd32ByCl63", []uint8{0x66, 0x0f, 0xad, 0xd8}, 0x12345678, 0x9abcdef0, 63, 0x3579bde0, false},
+		// shld ax, bx, imm8 and shrd ax, bx, cl
+		{"TestShld16By4", []uint8{0x0f, 0xa4, 0xd8, 0x04}, 0x1234, 0xabcd, 0, 0x234a, true},
+		{"TestShrd16ByCl4", []uint8{0x0f, 0xad, 0xd8}, 0x1234, 0xabcd, 4, 0xd123, false},
+		// past 16 the destination's own bits come back in
+		{"TestShld16By20", []uint8{0x0f, 0xa4, 0xd8, 0x14}, 0x1234, 0xabcd, 0, 0xbcd1, false},
+		{"TestShrd16By20", []uint8{0x0f, 0xac, 0xd8, 0x14}, 0x1234, 0xabcd, 0, 0x4abc, true},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			registers := cpu.GetRegisters()
+			registers.EAX = tt.dest
+			registers.EBX = tt.src
+			registers.AX = uint16(tt.dest)
+			registers.BX = uint16(tt.src)
+			registers.CL = tt.cl
+			// a count of 0 leaves it set
+			cpu.SetFlag(intel8086.CarryFlag, false)
+
+			cpu.Step()
+
+			result := registers.EAX
+			if tt.instruction[0] != 0x66 {
+				result = uint32(registers.AX)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected [%#08x] but got [%#08x]", tt.expected, result)
+			}
+			if cpu.GetFlag(intel8086.CarryFlag) != tt.expectedCF {
+				t.Errorf("Expected CF %t but got %t", tt.expectedCF, cpu.GetFlag(intel8086.CarryFlag))
+			}
+			if registers.EBX != tt.src {
+				t.Errorf("Expected the source to be left [%#08x] but got [%#08x]", tt.src, registers.EBX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_ShiftDoubleFlags(t *testing.T) {
+
+	// shld dword [0x0600], ebx, 8 then shrd dword [0x0600], ebx, 1
+	testPc := newTestPcWithInstructions(0x100, []uint8{
+		0x66, 0x0f, 0xa4, 0x1e, 0x00, 0x06, 0x08,
+		0x66, 0x0f, 0xac, 0x1e, 0x00, 0x06, 0x01,
+	})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr32(0x0600, 0x11223344)
+	cpu.GetRegisters().EBX = 0xaabbccdd
+
+	cpu.Step()
+
+	if value, _ := mem.ReadAddr32(0x0600); value != 0x223344aa {
+		t.Errorf("Expected [0x223344aa] but got [%#08x]", value)
+	}
+	if !cpu.GetFlag(intel8086.CarryFlag) || cpu.GetFlag(intel8086.ZeroFlag) || cpu.GetFlag(intel8086.SignFlag) || !cpu.GetFlag(intel8086.ParityFlag) {
+		t.Errorf("Expected CF and PF set, ZF and SF clear but got FLAGS [%#04x]", cpu.GetRegisters().FLAGS)
+	}
+
+	cpu.Step()
+
+	// the low bit of ebx comes in at the top, flipping the sign
+	if value, _ := mem.ReadAddr32(0x0600); value != 0x9119a255 {
+		t.Errorf("Expected [0x9119a255] but got [%#08x]", value)
+	}
+	if cpu.GetFlag(intel8086.CarryFlag) || !cpu.GetFlag(intel8086.SignFlag) || !cpu.GetFlag(intel8086.OverFlowFlag) {
+		t.Errorf("Expected SF and OF set and CF clear but got FLAGS [%#04x]", cpu.GetRegisters().FLAGS)
+	}
+}
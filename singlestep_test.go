@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_SingleStepTrap(t *testing.T) {
+
+	// push 0x0100; popf; nop; nop; nop with an iret as the #DB handler
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x68, 0x00, 0x01, 0x9d, 0x90, 0x90, 0x90})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	mem.WriteAddr16(0x01*4, 0x0500)
+	mem.WriteAddr16(0x01*4+2, 0x0000)
+	mem.WriteAddr8(0x0500, 0xcf)
+
+	cpu.Step() // push
+	cpu.Step() // popf sets TF, which doesn't trap the popf itself
+	if cpu.GetIP() != 0x0104 || !cpu.GetFlag(intel8086.TrapFlag) {
+		t.Fatalf("Expected popf to set TF and carry on to [%#04x] but got [%#04x] with TF %t", 0x0104, cpu.GetIP(), cpu.GetFlag(intel8086.TrapFlag))
+	}
+
+	cpu.Step() // nop, then #DB
+	if cpu.GetIP() != 0x0500 {
+		t.Fatalf("Expected #DB after one instruction, handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if ret, _ := mem.ReadAddr16(0x2000 - 6); ret != 0x0105 {
+		t.Errorf("Expected the trap to return past the nop [%#04x] but got [%#04x]", 0x0105, ret)
+	}
+	if flags, _ := mem.ReadAddr16(0x2000 - 2); flags&intel8086.TrapFlag == 0 {
+		t.Errorf("Expected the pushed flags [%#04x] to have TF set", flags)
+	}
+	if cpu.GetFlag(intel8086.TrapFlag) {
+		t.Errorf("Expected TF to be cleared on entry to the handler")
+	}
+	if cpu.GetRegisters().DR6&intel8086.DebugStatusSingleStep == 0 {
+		t.Errorf("Expected BS set in DR6 but got [%#08x]", cpu.GetRegisters().DR6)
+	}
+
+	cpu.Step() // iret restores TF, the iret itself isn't stepped
+	if cpu.GetIP() != 0x0105 {
+		t.Fatalf("Expected iret back to [%#04x] but got [%#04x]", 0x0105, cpu.GetIP())
+	}
+
+	cpu.Step() // the next nop traps again
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected #DB after the next instruction, handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if ret, _ := mem.ReadAddr16(0x2000 - 6); ret != 0x0106 {
+		t.Errorf("Expected the trap to return to [%#04x] but got [%#04x]", 0x0106, ret)
+	}
+}
+
+func Test_PushfPopf(t *testing.T) {
+
+	// pushf; pop ax; push 0x08c1; popf
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x9c, 0x58, 0x68, 0xc1, 0x08, 0x9d})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().FLAGS = 0x0202
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().AX != 0x0202 {
+		t.Errorf("Expected pushf to push [%#04x] but got [%#04x]", 0x0202, cpu.GetRegisters().AX)
+	}
+	if cpu.GetRegisters().FLAGS != 0x08c1 {
+		t.Errorf("Expected popf to load FLAGS [%#04x] but got [%#04x]", 0x08c1, cpu.GetRegisters().FLAGS)
+	}
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+}
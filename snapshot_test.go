@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_DiffSnapshots(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		ax          uint16
+		expected    string
+	}{
+		// mov ax, 0x1234
+		{"TestMovChangesOneRegister", []uint8{0xb8, 0x34, 0x12}, 0x0000, "AL=00->34 AH=00->12 AX=0000->1234 EAX=00000000->00001234"},
+		// inc ax
+		{"TestIncChangesRegisterAndFlags", []uint8{0x40}, 0xffff, "AL=ff->00 AH=ff->00 AX=ffff->0000 EAX=0000ffff->00000000 PF=0->1 AF=0->1 ZF=0->1"},
+		// nop
+		{"TestNopChangesNothing", []uint8{0x90}, 0xffff, ""},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().AX = tt.ax
+			cpu.GetRegisters().FLAGS = 0
+
+			before := cpu.SnapshotRegisters()
+			cpu.Step()
+			diffs := intel8086.DiffSnapshots(before, cpu.SnapshotRegisters())
+
+			if formatted := intel8086.FormatDiffs(diffs); formatted != tt.expected {
+				t.Errorf("Expected the diff %q but got %q", tt.expected, formatted)
+			}
+		})
+	}
+}
+
+func Test_DiffSnapshotsFields(t *testing.T) {
+
+	// mov bx, 0x0042
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xbb, 0x42, 0x00})
+	cpu := testPc.GetPrimaryCpu()
+
+	before := cpu.SnapshotRegisters()
+	cpu.Step()
+	diffs := intel8086.DiffSnapshots(before, cpu.SnapshotRegisters())
+
+	// BX changes along with the BL and EBX views of it
+	if len(diffs) != 3 {
+		t.Fatalf("Expected exactly three fields to change but got %v", diffs)
+	}
+	if diffs[1].Name != "BX" || diffs[1].Before != 0 || diffs[1].After != 0x42 {
+		t.Errorf("Expected BX to change from 0 to 0x42 but got %+v", diffs[1])
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/intel8254"
+	"testing"
+	"time"
+)
+
+func Test_PcSpeaker(t *testing.T) {
+
+	clock := common.NewFixedClock(time.Date(1994, time.March, 17, 13, 45, 30, 0, time.UTC))
+
+	// mov al, 0xb6; out 0x43, al; mov al, 0xa9; out 0x42, al; mov al, 0x04; out 0x42, al
+	// channel 2, lo/hi access, square wave, reload 1193
+	// in al, 0x61; or al, 3; out 0x61, al; in al, 0x61; mov al, 0; out 0x61, al
+	testPc := newTestPcWithClock(clock, 0x100, []uint8{
+		0xb0, 0xb6, 0xe6, 0x43, 0xb0, 0xa9, 0xe6, 0x42, 0xb0, 0x04, 0xe6, 0x42,
+		0xe4, 0x61, 0x0c, 0x03, 0xe6, 0x61, 0xe4, 0x61, 0xb0, 0x00, 0xe6, 0x61,
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	var reported []float64
+	testPc.SetSpeakerHandler(func(frequency float64) {
+		reported = append(reported, frequency)
+	})
+
+	for i := 0; i < 6; i++ {
+		cpu.Step()
+	}
+	if len(reported) != 0 {
+		t.Errorf("Expected the speaker to stay silent until port 0x61 enables it but got %v", reported)
+	}
+
+	// in al, 0x61; or al, 3; out 0x61, al
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	expected := float64(intel8254.PIT_INPUT_FREQUENCY) / 1193
+	if len(reported) != 1 || reported[0] != expected {
+		t.Fatalf("Expected the speaker to report %f hz but got %v", expected, reported)
+	}
+
+	// 600 input clock ticks, past the high half of the square wave
+	clock.Advance(time.Second * 600 / intel8254.PIT_INPUT_FREQUENCY)
+
+	// in al, 0x61
+	cpu.Step()
+	if cpu.GetRegisters().AL != intel8254.SPEAKER_TIMER_GATE|intel8254.SPEAKER_DATA_ENABLE {
+		t.Errorf("Expected port 0x61 to read [%#02x] with channel 2's output low but got [%#02x]", intel8254.SPEAKER_TIMER_GATE|intel8254.SPEAKER_DATA_ENABLE, cpu.GetRegisters().AL)
+	}
+
+	// mov al, 0; out 0x61, al
+	cpu.Step()
+	cpu.Step()
+	if len(reported) != 2 || reported[1] != 0 {
+		t.Errorf("Expected the speaker to report silence but got %v", reported)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"testing"
+)
+
+func Test_PushPopSegmentRegisters(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		steps       int
+		expectedDS  uint16
+		expectedES  uint16
+	}{
+		// mov ax, 0x1234; mov ds, ax; push ds; pop es
+		{"TestPushDsPopEs", []uint8{0xb8, 0x34, 0x12, 0x8e, 0xd8, 0x1e, 0x07}, 4, 0x1234, 0x1234},
+		// push 0x1122; pop ds
+		{"TestPushImmPopDs", []uint8{0x68, 0x22, 0x11, 0x1f}, 2, 0x1122, 0x0000},
+		// push 0x1122; pop ds; push fs; pop ds
+		{"TestPushFsPopDs", []uint8{0x68, 0x22, 0x11, 0x1f, 0x0f, 0xa0, 0x1f}, 4, 0x0000, 0x0000},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().SP = 0x2000
+
+			for i := 0; i < tt.steps; i++ {
+				cpu.Step()
+			}
+
+			if cpu.GetRegisters().DS.Selector() != tt.expectedDS {
+				t.Errorf("Expected DS [%#04x] but got [%#04x]", tt.expectedDS, cpu.GetRegisters().DS.Selector())
+			}
+			if cpu.GetRegisters().ES.Selector() != tt.expectedES {
+				t.Errorf("Expected ES [%#04x] but got [%#04x]", tt.expectedES, cpu.GetRegisters().ES.Selector())
+			}
+			if cpu.GetRegisters().SP != 0x2000 {
+				t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+			}
+		})
+	}
+}
+
+func Test_PopSegmentRegisterProtectedMode(t *testing.T) {
+
+	// lgdt [0x0800]; push 0x0008; pop ds; push ds; pop es
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x01, 0x16, 0x00, 0x08, 0x68, 0x08, 0x00, 0x1f, 0x1e, 0x07})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+
+	// gdtr pseudo descriptor: limit 0x000f, base 0x00001000
+	for i, b := range []uint8{0x0f, 0x00, 0x00, 0x10, 0x00, 0x00} {
+		mem.WriteAddr8(0x0800+uint32(i), b)
+	}
+
+	// gdt entry 1: base 0x00020000, limit 0xffff, present ring 0 read/write data
+	for i, b := range []uint8{0xff, 0xff, 0x00, 0x00, 0x02, 0x92, 0x00, 0x00} {
+		mem.WriteAddr8(0x1008+uint32(i), b)
+	}
+
+	cpu.Step() // lgdt
+	cpu.EnterMode(common.PROTECTED_MODE)
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	for _, seg := range []struct {
+		name string
+		reg  interface {
+			Selector() uint16
+			DescriptorBase() uint32
+			Limit() uint32
+			AccessInformation() uint16
+		}
+	}{
+		{"DS", cpu.GetRegisters().DS},
+		{"ES", cpu.GetRegisters().ES},
+	} {
+		if seg.reg.Selector() != 0x0008 {
+			t.Errorf("Expected %s selector [%#04x] but got [%#04x]", seg.name, 0x0008, seg.reg.Selector())
+		}
+		if seg.reg.DescriptorBase() != 0x00020000 {
+			t.Errorf("Expected %s base [%#08x] but got [%#08x]", seg.name, 0x00020000, seg.reg.DescriptorBase())
+		}
+		if seg.reg.Limit() != 0xffff {
+			t.Errorf("Expected %s limit [%#04x] but got [%#04x]", seg.name, 0xffff, seg.reg.Limit())
+		}
+		if seg.reg.AccessInformation()&0xff != 0x92 {
+			t.Errorf("Expected %s access [%#02x] but got [%#02x]", seg.name, 0x92, seg.reg.AccessInformation()&0xff)
+		}
+	}
+
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+}
+
+func Test_PushPop32BitOperands(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedTop uint32
+		expectedEBX uint32
+		expectedBX  uint16
+	}{
+		// push eax; pop ebx
+		{"TestPushPopEax", []uint8{0x66, 0x50, 0x66, 0x5b}, 0x12345678, 0x12345678, 0x5678},
+		// push 0x87654321; pop ebx
+		{"TestPushImm32", []uint8{0x66, 0x68, 0x21, 0x43, 0x65, 0x87, 0x66, 0x5b}, 0x87654321, 0x87654321, 0x4321},
+		// push -2 (sign extended to 32 bits); pop ebx
+		{"TestPushImm8SignExtended", []uint8{0x66, 0x6a, 0xfe, 0x66, 0x5b}, 0xfffffffe, 0xfffffffe, 0xfffe},
+		// push dword [0x0600]; pop ebx
+		{"TestPushRm32", []uint8{0x66, 0xff, 0x36, 0x00, 0x06, 0x66, 0x5b}, 0xcafef00d, 0xcafef00d, 0xf00d},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr32(0x0600, 0xcafef00d)
+			cpu.GetRegisters().SP = 0x2000
+			cpu.GetRegisters().EAX = 0x12345678
+			cpu.GetRegisters().EBX = 0xaaaaaaaa
+
+			cpu.Step()
+			if cpu.GetRegisters().SP != 0x1ffc {
+				t.Errorf("Expected SP [%#04x] after a 32 bit push but got [%#04x]", 0x1ffc, cpu.GetRegisters().SP)
+			}
+			if top, _ := mem.ReadAddr32(0x1ffc); top != tt.expectedTop {
+				t.Errorf("Expected top of stack [%#08x] but got [%#08x]", tt.expectedTop, top)
+			}
+
+			cpu.Step()
+			if cpu.GetRegisters().SP != 0x2000 {
+				t.Errorf("Expected SP [%#04x] after a 32 bit pop but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+			}
+			if cpu.GetRegisters().EBX != tt.expectedEBX {
+				t.Errorf("Expected EBX [%#08x] but got [%#08x]", tt.expectedEBX, cpu.GetRegisters().EBX)
+			}
+			if cpu.GetRegisters().BX != tt.expectedBX {
+				t.Errorf("Expected BX to read back the low word [%#04x] but got [%#04x]", tt.expectedBX, cpu.GetRegisters().BX)
+			}
+		})
+	}
+}
+
+func Test_PushPop16BitOperands(t *testing.T) {
+
+	// push ax; pop bx; push word [0x0600]; pop word [0x0602]
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x50, 0x5b, 0xff, 0x36, 0x00, 0x06, 0x8f, 0x06, 0x02, 0x06})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x0600, 0xbeef)
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().AX = 0x1234
+
+	cpu.Step()
+	if cpu.GetRegisters().SP != 0x1ffe {
+		t.Errorf("Expected SP [%#04x] after a 16 bit push but got [%#04x]", 0x1ffe, cpu.GetRegisters().SP)
+	}
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().BX != 0x1234 {
+		t.Errorf("Expected BX [%#04x] but got [%#04x]", 0x1234, cpu.GetRegisters().BX)
+	}
+	if value, _ := mem.ReadAddr16(0x0602); value != 0xbeef {
+		t.Errorf("Expected pop r/m16 to write [%#04x] but got [%#04x]", 0xbeef, value)
+	}
+	if cpu.GetRegisters().SP != 0x2000 {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0x2000, cpu.GetRegisters().SP)
+	}
+}
+
+func Test_PushWith32BitStackSegment(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data segment with the B bit set, base 0, limit 0xfffff with 4k granularity
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00},
+	}
+
+	// mov ax, 0x08; mov ss, ax; push ax; pop cx
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd0, 0x50, 0x59})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().ESP = 0x00012000
+	cpu.GetRegisters().SP = 0x2000
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step() // push ax
+
+	if cpu.GetRegisters().ESP != 0x00011ffe {
+		t.Errorf("Expected ESP [%#08x] but got [%#08x]", 0x00011ffe, cpu.GetRegisters().ESP)
+	}
+	if value, _ := mem.ReadAddr16(0x00011ffe); value != 0x0008 {
+		t.Errorf("Expected [%#04x] at ESP but got [%#04x]", 0x0008, value)
+	}
+
+	cpu.Step() // pop cx
+
+	if cpu.GetRegisters().CX != 0x0008 || cpu.GetRegisters().ESP != 0x00012000 {
+		t.Errorf("Expected CX [%#04x] and ESP [%#08x] but got [%#04x] and [%#08x]", 0x0008, 0x00012000, cpu.GetRegisters().CX, cpu.GetRegisters().ESP)
+	}
+}
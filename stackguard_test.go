@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_StackGuardPushWraps(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		guard       bool
+		expectedLog bool
+	}{
+		{"TestGuardOn", true, true},
+		{"TestGuardOff", false, false},
+	}
+	for _, tt := range tests {
+
+		// push ax
+		testPc := newTestPcWithInstructions(0x100, []uint8{0x50})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			output := &bytes.Buffer{}
+			cpu.GetLogger().SetOutput(output)
+			cpu.SetStackGuard(tt.guard)
+			cpu.GetRegisters().AX = 0x1234
+			cpu.GetRegisters().SP = 0x0000
+
+			cpu.Step()
+
+			if logged := strings.Contains(output.String(), "wraps SP"); logged != tt.expectedLog {
+				t.Errorf("Expected a wrap warning %t but got %q", tt.expectedLog, output.String())
+			}
+			if cpu.GetRegisters().SP != 0xfffe {
+				t.Errorf("Expected SP to wrap to [%#04x] but got [%#04x]", 0xfffe, cpu.GetRegisters().SP)
+			}
+			if value, _ := mem.ReadAddr16(0xfffe); value != 0x1234 {
+				t.Errorf("Expected [%#04x] at the top of the stack segment but got [%#04x]", 0x1234, value)
+			}
+		})
+	}
+}
+
+func Test_StackGuardHandler(t *testing.T) {
+
+	// pop bx; pop cx; push bx
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x5b, 0x59, 0x53})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetStackGuard(true)
+	cpu.GetRegisters().SP = 0xfffc
+
+	type wrap struct {
+		push bool
+		sp   uint32
+	}
+	var wraps []wrap
+	cpu.SetStackGuardHandler(func(push bool, sp uint32, size uint32) {
+		wraps = append(wraps, wrap{push, sp})
+	})
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	// only the second pop runs off the top, the push after it starts from 0 again
+	if len(wraps) != 2 || wraps[0] != (wrap{false, 0xfffe}) || wraps[1] != (wrap{true, 0x0000}) {
+		t.Errorf("Expected a pop wrap from 0xfffe then a push wrap from 0 but got %+v", wraps)
+	}
+	if cpu.GetRegisters().SP != 0xfffe {
+		t.Errorf("Expected SP [%#04x] but got [%#04x]", 0xfffe, cpu.GetRegisters().SP)
+	}
+}
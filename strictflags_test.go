@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"strings"
+	"testing"
+)
+
+func Test_StrictFlags(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		program         string
+		steps           int
+		strict          bool
+		expectedAddress uint32
+		expectedFlags   uint16
+	}{
+		// AF is undefined after and, lahf reads it
+		{"TestAndThenLahf", "and al, bl\nlahf", 2, true, 0x0102, intel8086.AdjustFlag},
+		{"TestStrictOff", "and al, bl\nlahf", 2, false, 0, 0},
+		// inc sets AF again
+		{"TestRedefined", "and al, bl\ninc cx\nlahf", 3, true, 0, 0},
+		// jz only reads ZF, which and defines
+		{"TestDefinedFlagRead", "and al, bl\njz done\ndone: nop", 2, true, 0, 0},
+		// OF is undefined after a shift by more than 1, shld ax, dx, cl and shld ax, dx, 1
+		{"TestShiftThenJo", "db 0x0f, 0xa5, 0xd0\njo done\ndone: nop", 2, true, 0x0103, intel8086.OverFlowFlag},
+		{"TestShiftByOneThenJo", "db 0x0f, 0xa4, 0xd0, 0x01\njo done\ndone: nop", 2, true, 0, 0},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithProgram(0x100, tt.program)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetStrictFlags(tt.strict)
+			cpu.GetRegisters().CL = 2
+
+			var address uint32
+			var flags uint16
+			cpu.SetStrictFlagsHandler(func(at uint32, undefined uint16) {
+				address, flags = at, undefined
+			})
+
+			for i := 0; i < tt.steps; i++ {
+				cpu.Step()
+			}
+
+			if address != tt.expectedAddress || flags != tt.expectedFlags {
+				t.Errorf("Expected undefined flags [%#04x] read at [%#04x] but got [%#04x] at [%#04x]", tt.expectedFlags, tt.expectedAddress, flags, address)
+			}
+		})
+	}
+}
+
+func Test_StrictFlagsWarning(t *testing.T) {
+
+	testPc := newTestPcWithProgram(0x100, "xor ax, ax\nlahf")
+	cpu := testPc.GetPrimaryCpu()
+	output := &bytes.Buffer{}
+	cpu.GetLogger().SetOutput(output)
+	cpu.SetStrictFlags(true)
+
+	cpu.Step()
+	cpu.Step()
+
+	if !strings.Contains(output.String(), "[0x0102] reads undefined flags AF") {
+		t.Errorf("Expected a warning for the read of AF but got %q", output.String())
+	}
+	if cpu.GetRegisters().AH != 0x46 {
+		t.Errorf("Expected lahf to load AH [%#02x] but got [%#02x]", 0x46, cpu.GetRegisters().AH)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+// Port device that feeds reads from a queue and records writes
+type stubPortDevice struct {
+	input  []uint16
+	output []uint16
+}
+
+func (device *stubPortDevice) next() uint16 {
+	if len(device.input) == 0 {
+		return 0xffff
+	}
+	value := device.input[0]
+	device.input = device.input[1:]
+	return value
+}
+
+func (device *stubPortDevice) ReadPort8(port uint16) uint8 {
+	return uint8(device.next())
+}
+
+func (device *stubPortDevice) WritePort8(port uint16, value uint8) {
+	device.output = append(device.output, uint16(value))
+}
+
+func (device *stubPortDevice) ReadPort16(port uint16) uint16 {
+	return device.next()
+}
+
+func (device *stubPortDevice) WritePort16(port uint16, value uint16) {
+	device.output = append(device.output, value)
+}
+
+func Test_RepInsw(t *testing.T) {
+
+	// mov ax, 0x0100; mov es, ax; rep insw
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xb8, 0x00, 0x01, 0x8e, 0xc0, 0xf3, 0x6d})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	device := &stubPortDevice{input: []uint16{0x1111, 0x2222, 0x3333, 0x4444}}
+	testPc.GetIOPortController().AttachPortDevice(0x1f0, 0x1f7, device)
+
+	cpu.GetRegisters().DI = 0x0010
+	cpu.GetRegisters().DX = 0x01f0
+	cpu.GetRegisters().CX = 4
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+
+	for i, expected := range []uint16{0x1111, 0x2222, 0x3333, 0x4444} {
+		if value, _ := mem.ReadAddr16(0x1010 + uint32(i*2)); value != expected {
+			t.Errorf("Expected [%#04x] at ES:[%#04x] but got [%#04x]", expected, 0x0010+i*2, value)
+		}
+	}
+	if cpu.GetRegisters().DI != 0x0018 || cpu.GetRegisters().CX != 0 {
+		t.Errorf("Expected DI [%#04x] and CX [%#04x] but got [%#04x] and [%#04x]", 0x0018, 0, cpu.GetRegisters().DI, cpu.GetRegisters().CX)
+	}
+	if cpu.GetIP() != 0x0107 {
+		t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0107, cpu.GetIP())
+	}
+}
+
+func Test_RepOutsw(t *testing.T) {
+
+	// rep outsw
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xf3, 0x6f})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	device := &stubPortDevice{}
+	testPc.GetIOPortController().AttachPortDevice(0x1f0, 0x1f7, device)
+
+	mem.WriteAddr16(0x0600, 0xaaaa)
+	mem.WriteAddr16(0x0602, 0xbbbb)
+	mem.WriteAddr16(0x0604, 0xcccc)
+	cpu.GetRegisters().SI = 0x0600
+	cpu.GetRegisters().DX = 0x01f0
+	cpu.GetRegisters().CX = 3
+
+	cpu.Step()
+
+	expected := []uint16{0xaaaa, 0xbbbb, 0xcccc}
+	if len(device.output) != len(expected) {
+		t.Fatalf("Expected %d words written to the port but got %d", len(expected), len(device.output))
+	}
+	for i := range expected {
+		if device.output[i] != expected[i] {
+			t.Errorf("Expected word %d to be [%#04x] but got [%#04x]", i, expected[i], device.output[i])
+		}
+	}
+	if cpu.GetRegisters().SI != 0x0606 || cpu.GetRegisters().CX != 0 {
+		t.Errorf("Expected SI [%#04x] and CX [%#04x] but got [%#04x] and [%#04x]", 0x0606, 0, cpu.GetRegisters().SI, cpu.GetRegisters().CX)
+	}
+}
+
+func Test_StringIoByteForms(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		instruction    []uint8
+		direction      bool
+		expectedOutput uint16
+		expectedSI     uint16
+		expectedDI     uint16
+		expectedMemory uint8
+	}{
+		// outsb reads DS:SI
+		{"TestOutsb", []uint8{0x6e}, false, 0x11, 0x0601, 0x0010, 0x00},
+		// es: outsb reads ES:SI
+		{"TestOutsbSegmentOverride", []uint8{0x26, 0x6e}, false, 0x22, 0x0601, 0x0010, 0x00},
+		// insb writes ES:DI and steps DI backwards with DF set
+		{"TestInsbDirection", []uint8{0x6c}, true, 0xffff, 0x0600, 0x000f, 0x5a},
+		// the segment override doesn't apply to the INS destination
+		{"TestInsbIgnoresOverride", []uint8{0x3e, 0x6c}, false, 0xffff, 0x0600, 0x0011, 0x5a},
+	}
+	for _, tt := range tests {
+
+		// mov ax, 0x0100; mov es, ax
+		testPc := newTestPcWithInstructions(0x100, append([]uint8{0xb8, 0x00, 0x01, 0x8e, 0xc0}, tt.instruction...))
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			device := &stubPortDevice{input: []uint16{0x5a}}
+			testPc.GetIOPortController().AttachPortDevice(0x1f0, 0x1f7, device)
+
+			mem.WriteAddr8(0x0600, 0x11)
+			mem.WriteAddr8(0x1600, 0x22)
+			cpu.GetRegisters().SI = 0x0600
+			cpu.GetRegisters().DI = 0x0010
+			cpu.GetRegisters().DX = 0x01f0
+			cpu.SetFlag(intel8086.DirectionFlag, tt.direction)
+
+			for i := 0; i < 3; i++ {
+				cpu.Step()
+			}
+
+			output := uint16(0xffff)
+			if len(device.output) > 0 {
+				output = device.output[0]
+			}
+			if output != tt.expectedOutput {
+				t.Errorf("Expected port output [%#04x] but got [%#04x]", tt.expectedOutput, output)
+			}
+			if cpu.GetRegisters().SI != tt.expectedSI || cpu.GetRegisters().DI != tt.expectedDI {
+				t.Errorf("Expected SI [%#04x] DI [%#04x] but got [%#04x] [%#04x]", tt.expectedSI, tt.expectedDI, cpu.GetRegisters().SI, cpu.GetRegisters().DI)
+			}
+			if value, _ := mem.ReadAddr8(0x1010); value != tt.expectedMemory {
+				t.Errorf("Expected [%#02x] at ES:0010 but got [%#02x]", tt.expectedMemory, value)
+			}
+		})
+	}
+}
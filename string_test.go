@@ -0,0 +1,161 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_RepMovs(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		cx          uint16
+		expectedSI  uint16
+		expectedDI  uint16
+		expected    []uint8
+	}{
+		// rep movsb
+		{"TestRepMovsb", []uint8{0xf3, 0xa4}, 3, 0x0603, 0x0703, []uint8{0x11, 0x22, 0x33, 0x00}},
+		// rep movsw
+		{"TestRepMovsw", []uint8{0xf3, 0xa5}, 2, 0x0604, 0x0704, []uint8{0x11, 0x22, 0x33, 0x44}},
+		// movsb without a prefix copies once whatever CX holds
+		{"TestMovsb", []uint8{0xa4}, 0, 0x0601, 0x0701, []uint8{0x11, 0x00, 0x00, 0x00}},
+		// CX is tested before the first copy
+		{"TestRepMovsbCxZero", []uint8{0xf3, 0xa4}, 0, 0x0600, 0x0700, []uint8{0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			for i, b := range []uint8{0x11, 0x22, 0x33, 0x44} {
+				testPc.GetMemoryController().WriteAddr8(0x0600+uint32(i), b)
+			}
+			cpu.GetRegisters().CX = tt.cx
+			cpu.GetRegisters().SI = 0x0600
+			cpu.GetRegisters().DI = 0x0700
+
+			cpu.Step()
+
+			if copied := testPc.ReadMemory(0x0700, 4); string(copied) != string(tt.expected) {
+				t.Errorf("Expected % x at [%#04x] but got % x", tt.expected, 0x0700, copied)
+			}
+			if cpu.GetRegisters().SI != tt.expectedSI || cpu.GetRegisters().DI != tt.expectedDI {
+				t.Errorf("Expected SI [%#04x] DI [%#04x] but got SI [%#04x] DI [%#04x]", tt.expectedSI, tt.expectedDI, cpu.GetRegisters().SI, cpu.GetRegisters().DI)
+			}
+			if tt.instruction[0] == 0xf3 && cpu.GetRegisters().CX != 0 {
+				t.Errorf("Expected CX to count down to 0 but got [%#04x]", cpu.GetRegisters().CX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_StringSegmentOverride(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		opcode     uint8
+		al         uint8
+		destByte   uint8 // at ES:DI before the instruction
+		expectedAL uint8
+		expectedES uint8 // at ES:DI after the instruction
+		expectedZF bool
+	}{
+		// the cs override moves the source to CS:SI, 0x11, while DS:SI holds 0x22
+		{"TestMovsb", 0xa4, 0x00, 0x00, 0x00, 0x11, false},
+		{"TestLodsb", 0xac, 0x00, 0x00, 0x11, 0x00, false},
+		{"TestCmpsb", 0xa6, 0x00, 0x11, 0x00, 0x11, true},
+		// the destination stays ES:DI, DS:DI and CS:DI hold 0x33
+		{"TestStosb", 0xaa, 0x44, 0x00, 0x44, 0x44, false},
+		{"TestScasb", 0xae, 0x11, 0x11, 0x11, 0x11, true},
+	}
+	for _, tt := range tests {
+
+		// mov ax, 0x0080; mov ds, ax; mov ax, 0x0100; mov es, ax; then the string instruction with a cs override
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xb8, 0x80, 0x00, 0x8e, 0xd8, 0xb8, 0x00, 0x01, 0x8e, 0xc0, 0x2e, tt.opcode})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			mem := testPc.GetMemoryController()
+			mem.WriteAddr8(0x0600, 0x11) // CS:SI
+			mem.WriteAddr8(0x0e00, 0x22) // DS:SI
+			mem.WriteAddr8(0x0700, 0x33) // CS:DI
+			mem.WriteAddr8(0x0f00, 0x33) // DS:DI
+			mem.WriteAddr8(0x1700, tt.destByte)
+
+			for i := 0; i < 4; i++ {
+				cpu.Step()
+			}
+			cpu.GetRegisters().AL = tt.al
+			cpu.GetRegisters().SI = 0x0600
+			cpu.GetRegisters().DI = 0x0700
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AL != tt.expectedAL {
+				t.Errorf("Expected AL [%#02x] but got [%#02x]", tt.expectedAL, cpu.GetRegisters().AL)
+			}
+			if value, _ := mem.ReadAddr8(0x1700); value != tt.expectedES {
+				t.Errorf("Expected [%#02x] at ES:DI but got [%#02x]", tt.expectedES, value)
+			}
+			for _, addr := range []uint32{0x0700, 0x0f00} {
+				if value, _ := mem.ReadAddr8(addr); value != 0x33 {
+					t.Errorf("Expected [%#05x] to be left alone but got [%#02x]", addr, value)
+				}
+			}
+			if (tt.opcode == 0xa6 || tt.opcode == 0xae) && cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+			if cpu.GetIP() != 0x010c {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x010c, cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_RepeatCompareString(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		program    string
+		expectedCX uint16
+		expectedDI uint16
+		expectedZF bool
+	}{
+		// repne scasb finds the 0x33 at the third byte
+		{"TestRepneScasb", "repne scasb", 2, 0x0703, true},
+		// repe cmpsb stops at the first difference, the fourth byte
+		{"TestRepeCmpsb", "repe cmpsb", 1, 0x0704, false},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithProgram(0x100, tt.program)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			for i, b := range []uint8{0x11, 0x22, 0x33, 0x44, 0x55} {
+				testPc.GetMemoryController().WriteAddr8(0x0600+uint32(i), b)
+				testPc.GetMemoryController().WriteAddr8(0x0700+uint32(i), b)
+			}
+			testPc.GetMemoryController().WriteAddr8(0x0703, 0x00)
+			cpu.GetRegisters().AL = 0x33
+			cpu.GetRegisters().CX = 5
+			cpu.GetRegisters().SI = 0x0600
+			cpu.GetRegisters().DI = 0x0700
+
+			cpu.Step()
+
+			if cpu.GetRegisters().CX != tt.expectedCX || cpu.GetRegisters().DI != tt.expectedDI {
+				t.Errorf("Expected CX [%#04x] DI [%#04x] but got CX [%#04x] DI [%#04x]", tt.expectedCX, tt.expectedDI, cpu.GetRegisters().CX, cpu.GetRegisters().DI)
+			}
+			if cpu.GetFlag(intel8086.ZeroFlag) != tt.expectedZF {
+				t.Errorf("Expected ZF %t but got %t", tt.expectedZF, cpu.GetFlag(intel8086.ZeroFlag))
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_TaskSwitchCallAndIret(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: ring 0 code, base 0, limit 0xffff
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		// 0x10: ring 0 data
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		// 0x18: available 32 bit TSS for the first task, base 0x3000
+		{0x67, 0x00, 0x00, 0x30, 0x00, 0x89, 0x00, 0x00},
+		// 0x20: available 32 bit TSS for the second task, base 0x3100
+		{0x67, 0x00, 0x00, 0x31, 0x00, 0x89, 0x00, 0x00},
+	}
+
+	// jmp 0x08:0x010a; mov ax, 0x10; mov ss, ax; mov ax, 0x18; ltr ax; call 0x20:0x0000; nop
+	testPc := newTestPcWithGdt(gdt, []uint8{
+		0xea, 0x0a, 0x01, 0x08, 0x00,
+		0xb8, 0x10, 0x00, 0x8e, 0xd0,
+		0xb8, 0x18, 0x00, 0x0f, 0x00, 0xd8,
+		0x9a, 0x00, 0x00, 0x20, 0x00,
+		0x90,
+	})
+	mem := testPc.GetMemoryController()
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().SP = 0x2000
+
+	// register image of the second task, which starts with an iret at 0x0400
+	image := map[uint32]uint32{
+		0x20: 0x00000400, // EIP
+		0x24: 0x00000002, // EFLAGS
+		0x28: 0x11112222, // EAX
+		0x2c: 0x33334444, // ECX
+		0x30: 0x55556666, // EDX
+		0x34: 0x77778888, // EBX
+		0x38: 0x00005000, // ESP
+		0x3c: 0x00000100, // EBP
+		0x40: 0x00000200, // ESI
+		0x44: 0x00000300, // EDI
+	}
+	for offset, value := range image {
+		mem.WriteAddr32(0x3100+offset, value)
+	}
+	for offset, selector := range map[uint32]uint16{0x48: 0x10, 0x4c: 0x08, 0x50: 0x10, 0x54: 0x10} {
+		mem.WriteAddr16(0x3100+offset, selector)
+	}
+	mem.WriteAddr8(0x0400, 0xcf)
+
+	for i := 0; i < 6; i++ {
+		cpu.Step()
+	}
+
+	registers := cpu.GetRegisters()
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x0400 {
+		t.Errorf("Expected the new task to start at [0008:0400] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if registers.TR.Selector() != 0x0020 {
+		t.Errorf("Expected TR [%#04x] but got [%#04x]", 0x0020, registers.TR.Selector())
+	}
+	if registers.EAX != 0x11112222 || registers.AX != 0x2222 || registers.AH != 0x22 {
+		t.Errorf("Expected EAX [%#08x] but got EAX [%#08x] AX [%#04x] AH [%#02x]", 0x11112222, registers.EAX, registers.AX, registers.AH)
+	}
+	if registers.ECX != 0x33334444 || registers.DX != 0x6666 || registers.BL != 0x88 {
+		t.Errorf("Expected ECX, DX and BL from the TSS but got [%#08x] [%#04x] [%#02x]", registers.ECX, registers.DX, registers.BL)
+	}
+	if registers.SP != 0x5000 || registers.BP != 0x0100 || registers.SI != 0x0200 || registers.DI != 0x0300 {
+		t.Errorf("Expected SP, BP, SI and DI from the TSS but got [%#04x] [%#04x] [%#04x] [%#04x]", registers.SP, registers.BP, registers.SI, registers.DI)
+	}
+	if registers.DS.Selector() != 0x0010 || registers.ES.Selector() != 0x0010 || registers.SS.Selector() != 0x0010 {
+		t.Errorf("Expected data segments [%#04x] but got DS [%#04x] ES [%#04x] SS [%#04x]", 0x0010, registers.DS.Selector(), registers.ES.Selector(), registers.SS.Selector())
+	}
+	if !cpu.GetFlag(intel8086.NestedTaskFlag) {
+		t.Errorf("Expected NT to be set in the nested task")
+	}
+	if registers.CR0&0x8 == 0 {
+		t.Errorf("Expected CR0.TS to be set after a task switch")
+	}
+	if link, _ := mem.ReadAddr16(0x3100); link != 0x0018 {
+		t.Errorf("Expected back link [%#04x] but got [%#04x]", 0x0018, link)
+	}
+	for _, tss := range []uint32{0x1018, 0x1020} {
+		if access, _ := mem.ReadAddr8(tss + 5); access != 0x8b {
+			t.Errorf("Expected TSS descriptor at [%#04x] to be busy but got access [%#02x]", tss, access)
+		}
+	}
+
+	// outgoing state saved in the first TSS
+	if eip, _ := mem.ReadAddr32(0x3020); eip != 0x011a {
+		t.Errorf("Expected saved EIP [%#04x] but got [%#04x]", 0x011a, eip)
+	}
+	if eax, _ := mem.ReadAddr32(0x3028); eax&0xffff != 0x0018 {
+		t.Errorf("Expected saved AX [%#04x] but got [%#04x]", 0x0018, eax&0xffff)
+	}
+
+	cpu.Step() // iret back to the first task
+
+	if cpu.GetCS() != 0x0008 || cpu.GetIP() != 0x011a {
+		t.Errorf("Expected iret to resume the first task at [0008:011a] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if registers.TR.Selector() != 0x0018 || registers.AX != 0x0018 || registers.SP != 0x2000 {
+		t.Errorf("Expected the first task's registers but got TR [%#04x] AX [%#04x] SP [%#04x]", registers.TR.Selector(), registers.AX, registers.SP)
+	}
+	if cpu.GetFlag(intel8086.NestedTaskFlag) {
+		t.Errorf("Expected NT to be clear after returning from the nested task")
+	}
+	if access, _ := mem.ReadAddr8(0x1020 + 5); access != 0x89 {
+		t.Errorf("Expected the nested TSS to be available after iret but got access [%#02x]", access)
+	}
+}
+
+func Test_TaskSwitchJumpToBusyTss(t *testing.T) {
+
+	gdt := [][]uint8{
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0x00, 0x00},
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0x00, 0x00},
+		{0x67, 0x00, 0x00, 0x30, 0x00, 0x89, 0x00, 0x00},
+		// 0x20: busy TSS, can't be jumped to
+		{0x67, 0x00, 0x00, 0x31, 0x00, 0x8b, 0x00, 0x00},
+	}
+
+	// jmp 0x08:0x010a; mov ax, 0x18; ltr ax; jmp 0x20:0x0000
+	testPc := newTestPcWithGdt(gdt, []uint8{
+		0xea, 0x0a, 0x01, 0x08, 0x00,
+		0xb8, 0x18, 0x00, 0x0f, 0x00, 0xd8,
+		0xea, 0x00, 0x00, 0x20, 0x00,
+	})
+	cpu := testPc.GetPrimaryCpu()
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	if cpu.GetRegisters().TR.Selector() != 0x0018 {
+		t.Errorf("Expected TR to stay [%#04x] but got [%#04x]", 0x0018, cpu.GetRegisters().TR.Selector())
+	}
+	// the jump faults with #GP, so CS:IP is left at the jump
+	if cpu.GetIP() != 0x0110 {
+		t.Errorf("Expected IP [%#04x] at the faulting jump but got [%#04x]", 0x0110, cpu.GetIP())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/bus"
+	"github.com/andrewjc/threeatesix/devices/intel8259a"
+	"github.com/andrewjc/threeatesix/devices/io"
+	"testing"
+)
+
+func Test_TestBusPicEndOfInterrupt(t *testing.T) {
+
+	// the interrupt controllers and the io ports on their own, with a stub in place of the cpu
+	testBus := bus.NewTestBus()
+	master := intel8259a.NewIntel8259a()
+	slave := intel8259a.NewIntel8259a()
+	master.ConnectSlave(slave)
+	ports := io.CreateIOPortController()
+	ports.SetBus(testBus.Bus)
+
+	testBus.RegisterDevice(master, common.MODULE_MASTER_INTERRUPT_CONTROLLER)
+	testBus.RegisterDevice(slave, common.MODULE_SLAVE_INTERRUPT_CONTROLLER)
+	testBus.RegisterDevice(ports, common.MODULE_IO_PORT_ACCESS_CONTROLLER)
+	cpu := testBus.RegisterStub(common.MODULE_PRIMARY_PROCESSOR)
+
+	// ICW1-4 with the vectors at 0x08, then unmask every line
+	for _, write := range []struct {
+		port  uint16
+		value uint8
+	}{{0x20, 0x11}, {0x21, 0x08}, {0x21, 0x04}, {0x21, 0x01}, {0x21, 0x00}} {
+		ports.WriteAddr8(write.port, write.value)
+	}
+
+	master.RaiseIrq(1)
+	master.RaiseIrq(3)
+	if vector := master.AcknowledgeInterrupt(); vector != 0x09 {
+		t.Fatalf("Expected IRQ1 to be acknowledged as vector [%#02x] but got [%#02x]", 0x09, vector)
+	}
+
+	// OCW3 selects the ISR for reads of port 0x20
+	ports.WriteAddr8(0x20, 0x0b)
+	if isr := ports.ReadAddr8(0x20); isr != 0x02 {
+		t.Errorf("Expected ISR [%#02x] with IRQ1 in service but got [%#02x]", 0x02, isr)
+	}
+	if master.HasPendingInterrupt() {
+		t.Errorf("Expected IRQ3 to wait for the EOI of IRQ1")
+	}
+
+	// non specific EOI
+	ports.WriteAddr8(0x20, 0x20)
+	if isr := ports.ReadAddr8(0x20); isr != 0 {
+		t.Errorf("Expected the EOI to clear the ISR but got [%#02x]", isr)
+	}
+	if vector := master.AcknowledgeInterrupt(); vector != 0x0b {
+		t.Errorf("Expected IRQ3 to be acknowledged as vector [%#02x] after the EOI but got [%#02x]", 0x0b, vector)
+	}
+
+	if len(testBus.Recorded()) != 0 || len(cpu.Received) != 0 {
+		t.Errorf("Expected port accesses to send no bus messages but got %v", testBus.Recorded())
+	}
+
+	// a reset delivered to the master alone masks its lines again
+	testBus.Inject(master, bus.BusMessage{Subject: common.MESSAGE_GLOBAL_RESET})
+	if imr := master.GetInterruptMaskRegister(); imr != 0xff {
+		t.Errorf("Expected the reset to mask every line but got IMR [%#02x]", imr)
+	}
+	if len(cpu.Received) != 0 {
+		t.Errorf("Expected the injected reset to reach only the master but the cpu stub got %v", cpu.Received)
+	}
+
+	// a broadcast reaches every device and is recorded once for each
+	testBus.ClearRecorded()
+	testBus.SendMessage(bus.BusMessage{Subject: common.MESSAGE_GLOBAL_RESET})
+	if recorded := testBus.RecordedWithSubject(common.MESSAGE_GLOBAL_RESET); len(recorded) != 4 || recorded[3].To != cpu.BusId {
+		t.Errorf("Expected the reset delivered to 4 devices, the cpu stub last, but got %v", recorded)
+	}
+	if len(cpu.Received) != 1 {
+		t.Errorf("Expected the cpu stub to receive the reset but it got %v", cpu.Received)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_RdtscCountsSteppedInstructions(t *testing.T) {
+
+	// nop; nop; nop; rdtsc; nop; rdtsc
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x90, 0x90, 0x90, 0x0f, 0x31, 0x90, 0x0f, 0x31})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.SetFeatures(intel8086.CpuFeatures{TimeStampCounter: true})
+
+	for i := 0; i < 4; i++ {
+		cpu.Step()
+	}
+
+	first := uint64(cpu.GetRegisters().EDX)<<32 | uint64(cpu.GetRegisters().EAX)
+	if first != 4 {
+		t.Errorf("Expected a count of 4 after 4 instructions but got %d", first)
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	second := uint64(cpu.GetRegisters().EDX)<<32 | uint64(cpu.GetRegisters().EAX)
+	if second <= first || second-first != 2 {
+		t.Errorf("Expected the count to advance by 2 from %d but got %d", first, second)
+	}
+	if cpu.GetCycleCount() != second {
+		t.Errorf("Expected cycle count %d but got %d", second, cpu.GetCycleCount())
+	}
+}
+
+func Test_RdtscUnsupportedModel(t *testing.T) {
+
+	// rdtsc, #UD without the time stamp counter feature
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x0f, 0x31})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().EAX = 0xaaaaaaaa
+	mem.WriteAddr16(0x06*4, 0x0500)
+	mem.WriteAddr16(0x06*4+2, 0x0000)
+
+	cpu.Step()
+
+	if cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #UD handler at [%#04x] but got [%#04x]", 0x0500, cpu.GetIP())
+	}
+	if cpu.GetRegisters().EAX != 0xaaaaaaaa {
+		t.Errorf("Expected EAX to be unchanged but got [%#08x]", cpu.GetRegisters().EAX)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_TraceToFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.log")
+
+	// mov ax, 0x1234; mov bx, ax; cld
+	testPc := newTestPcWithInstructions(0x100, []uint8{0xb8, 0x34, 0x12, 0x89, 0xc3, 0xfc})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().AX = 0
+	cpu.GetRegisters().BX = 0
+
+	if err := cpu.TraceToFile(path); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	cpu.SetTraceRegisterDeltas(true)
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+
+	if err := cpu.StopTrace(); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 trace lines but got %d:\n%s", len(lines), contents)
+	}
+
+	for i, expected := range []struct {
+		prefix string
+		text   []string
+	}{
+		{"00000100  b8 34 12 ", []string{"ax", "0x1234", "ax=0000->1234"}},
+		{"00000103  89 c3 ", []string{"bx", "ax", "bx=0000->1234"}},
+		{"00000105  fc ", []string{"CLD"}},
+	} {
+		if !strings.HasPrefix(lines[i], expected.prefix) {
+			t.Errorf("Expected trace line %d to start with %q but got %q", i, expected.prefix, lines[i])
+		}
+		for _, text := range expected.text {
+			if !strings.Contains(strings.ToLower(lines[i]), strings.ToLower(text)) {
+				t.Errorf("Expected trace line %d to contain %q but got %q", i, text, lines[i])
+			}
+		}
+	}
+}
+
+func Test_EffectiveAddress(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		instruction     []uint8
+		expectedSegment string
+		expectedOffset  uint32
+	}{
+		// mov ax, [bx+si+4]
+		{"TestBaseIndexDisp8", []uint8{0x8b, 0x40, 0x04}, "DS", 0x0534},
+		// mov ax, [bp+di+0x100]
+		{"TestStackBase", []uint8{0x8b, 0x83, 0x00, 0x01}, "SS", 0x0640},
+		// mov ax, es:[bx+si+4]
+		{"TestSegmentOverride", []uint8{0x26, 0x8b, 0x40, 0x04}, "ES", 0x0534},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().BX = 0x0500
+			cpu.GetRegisters().SI = 0x0030
+			cpu.GetRegisters().BP = 0x0520
+			cpu.GetRegisters().DI = 0x0020
+
+			cpu.Step()
+
+			ea := cpu.GetLastEffectiveAddress()
+			if !ea.Valid || ea.Segment != tt.expectedSegment || ea.Offset != tt.expectedOffset {
+				t.Errorf("Expected effective address %s:%04x but got %+v", tt.expectedSegment, tt.expectedOffset, ea)
+			}
+		})
+	}
+}
+
+func Test_TraceEffectiveAddress(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.log")
+
+	// mov ax, [bx+si+4]; mov bx, ax
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x8b, 0x40, 0x04, 0x89, 0xc3})
+	cpu := testPc.GetPrimaryCpu()
+	cpu.GetRegisters().BX = 0x0500
+	cpu.GetRegisters().SI = 0x0030
+
+	if err := cpu.TraceToFile(path); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	cpu.Step()
+	cpu.Step()
+
+	if err := cpu.StopTrace(); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 trace lines but got %d:\n%s", len(lines), contents)
+	}
+	if !strings.Contains(lines[0], "ea=DS:0534") {
+		t.Errorf("Expected the memory operand's address in %q", lines[0])
+	}
+	if strings.Contains(lines[1], "ea=") {
+		t.Errorf("Expected no effective address for a register operand in %q", lines[1])
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/common"
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_UnrealMode(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data, base 0, limit 0xfffff with 4k granularity
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00},
+	}
+
+	// mov ax, 0x08; mov ds, ax; then back in real mode xor ax, ax; mov ds, ax; lodsw with a 32 bit address
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd8, 0x31, 0xc0, 0x8e, 0xd8, 0x67, 0xad})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x00012000, 0xbeef)
+
+	cpu.Step()
+	cpu.Step()
+	cpu.EnterMode(common.REAL_MODE)
+
+	cpu.GetRegisters().ESI = 0x00012000
+	cpu.GetRegisters().SI = 0x2000
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step() // lodsw
+
+	if cpu.GetRegisters().AX != 0xbeef {
+		t.Errorf("Expected lodsw through the 4GB limit to load AX [%#04x] but got [%#04x]", 0xbeef, cpu.GetRegisters().AX)
+	}
+	if cpu.GetRegisters().ESI != 0x00012002 || cpu.GetRegisters().SI != 0x2002 {
+		t.Errorf("Expected ESI [%#08x] and SI [%#04x] but got [%#08x] and [%#04x]", 0x00012002, 0x2002, cpu.GetRegisters().ESI, cpu.GetRegisters().SI)
+	}
+}
+
+func Test_RealModeLimitWithoutUnreal(t *testing.T) {
+
+	// lodsw with a 32 bit address past the 64k limit of a real mode DS raises #GP
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x67, 0xad})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x00012000, 0xbeef)
+	mem.WriteAddr16(uint32(intel8086.ExceptionGeneralProtection)*4, 0x0500)
+	mem.WriteAddr16(uint32(intel8086.ExceptionGeneralProtection)*4+2, 0x0000)
+	cpu.GetRegisters().SP = 0x2000
+	cpu.GetRegisters().ESI = 0x00012000
+	cpu.GetRegisters().SI = 0x2000
+
+	cpu.Step()
+
+	if cpu.GetCS() != 0x0000 || cpu.GetIP() != 0x0500 {
+		t.Errorf("Expected the #GP handler at [0000:0500] but got [%04x:%04x]", cpu.GetCS(), cpu.GetIP())
+	}
+	if cpu.GetRegisters().AX == 0xbeef || cpu.GetRegisters().ESI != 0x00012000 {
+		t.Errorf("Expected the faulting lodsw to leave AX and ESI alone but got [%#04x] and [%#08x]", cpu.GetRegisters().AX, cpu.GetRegisters().ESI)
+	}
+}
+
+func Test_UnrealModeRepMovs(t *testing.T) {
+
+	gdt := [][]uint8{
+		// 0x08: data, base 0, limit 0xfffff with 4k granularity
+		{0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00},
+	}
+
+	// mov ax, 0x08; mov ds, ax; mov es, ax; then back in real mode xor ax, ax; mov ds, ax; mov es, ax;
+	// rep movsb with a 32 bit address
+	testPc := newTestPcWithGdt(gdt, []uint8{0xb8, 0x08, 0x00, 0x8e, 0xd8, 0x8e, 0xc0, 0x31, 0xc0, 0x8e, 0xd8, 0x8e, 0xc0, 0x67, 0xf3, 0xa4})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	for i := uint32(0); i < 3; i++ {
+		mem.WriteAddr8(0x00012000+i, uint8(0xa0+i))
+	}
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+	cpu.EnterMode(common.REAL_MODE)
+
+	cpu.GetRegisters().ESI = 0x00012000
+	cpu.GetRegisters().SI = 0x2000
+	cpu.GetRegisters().EDI = 0x00023000
+	cpu.GetRegisters().DI = 0x3000
+	cpu.GetRegisters().ECX = 0x00000003
+	cpu.GetRegisters().CX = 0x0003
+
+	cpu.Step()
+	cpu.Step()
+	cpu.Step()
+	cpu.Step() // rep movsb
+
+	for i := uint32(0); i < 3; i++ {
+		if value, _ := mem.ReadAddr8(0x00023000 + i); value != uint8(0xa0+i) {
+			t.Errorf("Expected [%#08x] to be copied as [%#02x] but got [%#02x]", 0x00023000+i, 0xa0+i, value)
+		}
+	}
+	if cpu.GetRegisters().ESI != 0x00012003 || cpu.GetRegisters().EDI != 0x00023003 {
+		t.Errorf("Expected ESI [%#08x] and EDI [%#08x] but got [%#08x] and [%#08x]", 0x00012003, 0x00023003, cpu.GetRegisters().ESI, cpu.GetRegisters().EDI)
+	}
+	if cpu.GetRegisters().ECX != 0 || cpu.GetRegisters().CX != 0 {
+		t.Errorf("Expected ECX and CX to count down to 0 but got [%#08x] and [%#04x]", cpu.GetRegisters().ECX, cpu.GetRegisters().CX)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/vga"
+	"testing"
+)
+
+func Test_TextModeReachesBackend(t *testing.T) {
+
+	testPc := newTestPc()
+	mem := testPc.GetMemoryController()
+	backend := vga.NewStringBackend()
+	testPc.SetVideoBackend(backend)
+
+	// "Hi" at the top left and "!" at row 1 column 2, light grey on black
+	mem.WriteAddr16(0xb8000, 0x0748)
+	mem.WriteAddr16(0xb8002, 0x0769)
+	mem.WriteAddr16(0xb8000+(1*80+2)*2, 0x0721)
+
+	err := testPc.GetVideoAdapter().Refresh()
+	if err != nil {
+		t.Fatalf("Expected the refresh to succeed but got %s", err.Error())
+	}
+
+	if backend.String() != "Hi\n  !" {
+		t.Errorf("Expected the screen %q but got %q", "Hi\n  !", backend.String())
+	}
+	if backend.FlushCount() != 1 {
+		t.Errorf("Expected 1 flush but got %d", backend.FlushCount())
+	}
+
+	// a new backend gets the whole screen, then only the cells that changed
+	presented := &countingBackend{}
+	testPc.SetVideoBackend(presented)
+	testPc.GetVideoAdapter().Refresh()
+	mem.WriteAddr8(0xb8002, 'o')
+	testPc.GetVideoAdapter().Refresh()
+
+	if presented.cells != 80*25+1 {
+		t.Errorf("Expected %d cells presented but got %d", 80*25+1, presented.cells)
+	}
+}
+
+type countingBackend struct {
+	cells int
+}
+
+func (backend *countingBackend) PresentTextCell(row int, column int, character uint8, attribute uint8) {
+	backend.cells++
+}
+
+func (backend *countingBackend) PresentPixel(x int, y int, color uint8) {}
+
+func (backend *countingBackend) Flush() {}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/andrewjc/threeatesix/devices/intel8086"
+	"testing"
+)
+
+func Test_XchgRegisters(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		instruction []uint8
+		expectedAX  uint16
+		expectedCX  uint16
+		expectedEAX uint32
+		expectedECX uint32
+	}{
+		// nop
+		{"TestNop", []uint8{0x90}, 0x1111, 0x2222, 0x11111111, 0x22222222},
+		// xchg ax, cx
+		{"TestXchgAxCx", []uint8{0x91}, 0x2222, 0x1111, 0x11112222, 0x22221111},
+		// xchg eax, ecx
+		{"TestXchgEaxEcx", []uint8{0x66, 0x91}, 0x2222, 0x1111, 0x22222222, 0x11111111},
+		// xchg cx, ax (r/m16 form)
+		{"TestXchgRm16", []uint8{0x87, 0xc1}, 0x2222, 0x1111, 0x11112222, 0x22221111},
+	}
+	for _, tt := range tests {
+
+		testPc := newTestPcWithInstructions(0x100, tt.instruction)
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.GetRegisters().EAX = 0x11111111
+			cpu.GetRegisters().ECX = 0x22222222
+
+			cpu.Step()
+
+			if cpu.GetRegisters().AX != tt.expectedAX || cpu.GetRegisters().CX != tt.expectedCX {
+				t.Errorf("Expected AX [%#04x] CX [%#04x] but got AX [%#04x] CX [%#04x]", tt.expectedAX, tt.expectedCX, cpu.GetRegisters().AX, cpu.GetRegisters().CX)
+			}
+			if cpu.GetRegisters().EAX != tt.expectedEAX || cpu.GetRegisters().ECX != tt.expectedECX {
+				t.Errorf("Expected EAX [%#08x] ECX [%#08x] but got EAX [%#08x] ECX [%#08x]", tt.expectedEAX, tt.expectedECX, cpu.GetRegisters().EAX, cpu.GetRegisters().ECX)
+			}
+			if cpu.GetIP() != 0x100+uint16(len(tt.instruction)) {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x100+len(tt.instruction), cpu.GetIP())
+			}
+		})
+	}
+}
+
+func Test_XchgMemoryOperand(t *testing.T) {
+
+	// xchg [0x0600], bx; xchg [0x0602], al
+	testPc := newTestPcWithInstructions(0x100, []uint8{0x87, 0x1e, 0x00, 0x06, 0x86, 0x06, 0x02, 0x06})
+	cpu := testPc.GetPrimaryCpu()
+	mem := testPc.GetMemoryController()
+	mem.WriteAddr16(0x0600, 0xbeef)
+	mem.WriteAddr8(0x0602, 0x42)
+	cpu.GetRegisters().BX = 0x1234
+	cpu.GetRegisters().AL = 0x99
+
+	cpu.Step()
+	cpu.Step()
+
+	if value, _ := mem.ReadAddr16(0x0600); value != 0x1234 {
+		t.Errorf("Expected memory word [%#04x] but got [%#04x]", 0x1234, value)
+	}
+	if cpu.GetRegisters().BX != 0xbeef {
+		t.Errorf("Expected BX [%#04x] but got [%#04x]", 0xbeef, cpu.GetRegisters().BX)
+	}
+	if value, _ := mem.ReadAddr8(0x0602); value != 0x99 {
+		t.Errorf("Expected memory byte [%#02x] but got [%#02x]", 0x99, value)
+	}
+	if cpu.GetRegisters().AL != 0x42 {
+		t.Errorf("Expected AL [%#02x] but got [%#02x]", 0x42, cpu.GetRegisters().AL)
+	}
+}
+
+func Test_Pause(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		features intel8086.CpuFeatures
+	}{
+		{"TestPause", intel8086.CpuFeatures{SpinLoopHint: true}},
+		// a 386 sees a stray rep prefix on a nop
+		{"TestRepNop", intel8086.CpuFeatures{}},
+	}
+	for _, tt := range tests {
+
+		// pause
+		testPc := newTestPcWithInstructions(0x100, []uint8{0xf3, 0x90})
+
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := testPc.GetPrimaryCpu()
+			cpu.SetFeatures(tt.features)
+			cpu.GetRegisters().AX = 0x1111
+			cpu.GetRegisters().CX = 0x0002
+
+			decoded, err := cpu.DecodeOnly(0x100)
+			if err != nil || decoded.Length != 2 {
+				t.Errorf("Expected pause to decode to 2 bytes but got %d (%v)", decoded.Length, err)
+			}
+
+			cpu.Step()
+
+			if cpu.GetIP() != 0x0102 {
+				t.Errorf("Expected IP [%#04x] but got [%#04x]", 0x0102, cpu.GetIP())
+			}
+			if cpu.GetRegisters().AX != 0x1111 || cpu.GetRegisters().CX != 0x0002 {
+				t.Errorf("Expected AX [%#04x] CX [%#04x] to be left alone but got AX [%#04x] CX [%#04x]", 0x1111, 0x0002, cpu.GetRegisters().AX, cpu.GetRegisters().CX)
+			}
+		})
+	}
+}